@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/zesbe/lumina-ai/internal/cache"
+	"github.com/zesbe/lumina-ai/internal/config"
+	"github.com/zesbe/lumina-ai/internal/database"
+	"github.com/zesbe/lumina-ai/internal/health"
+	"github.com/zesbe/lumina-ai/internal/version"
+)
+
+// runCheck verifies the configuration and each dependency with the same
+// checks /health/ready runs, prints one line per check and returns the
+// exit code: 1 if anything failed. It changes nothing: no migrations, no
+// seeding. With verifyProvider it also spends one MiniMax API call
+// checking the key.
+func runCheck(cfg *config.Config, verifyProvider bool) int {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintf(w, "lumina ai api %s self-check\n", version.Version)
+
+	failed := false
+	line := func(status, name, detail string) {
+		if status == "FAIL" {
+			failed = true
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\n", status, name, detail)
+	}
+	report := func(name string, d health.Dependency) {
+		switch {
+		case d.Failed():
+			line("FAIL", name, joinDetail(d.Error, d.Detail))
+		case d.Status != "ok":
+			line("warn", name, d.Detail)
+		case d.LatencyMs > 0:
+			line("ok", name, fmt.Sprintf("%dms", d.LatencyMs))
+		default:
+			line("ok", name, d.Detail)
+		}
+	}
+
+	warnings, err := cfg.Validate()
+	for _, warning := range warnings {
+		line("warn", "config", warning)
+	}
+	if err != nil {
+		var invalid *config.ValidationError
+		if errors.As(err, &invalid) {
+			for _, problem := range invalid.Problems {
+				line("FAIL", "config", problem)
+			}
+		} else {
+			line("FAIL", "config", err.Error())
+		}
+		// The connections below would mostly fail for the same reasons.
+		return 1
+	}
+	line("ok", "config", cfg.Environment)
+
+	ctx := context.Background()
+	if db, err := database.Open(cfg); err != nil {
+		line("FAIL", "database", err.Error())
+	} else {
+		report("database", health.Database(ctx, db))
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	}
+
+	if err := cache.InitRedis(cfg.RedisURL); err != nil {
+		line("FAIL", "redis", err.Error())
+	} else {
+		report("redis", health.Redis(ctx))
+		cache.Cache.Close()
+	}
+
+	report("ffmpeg", health.FFmpeg())
+
+	if verifyProvider {
+		report("minimax", health.ProviderKey(ctx, cfg))
+	} else {
+		report("minimax", health.Provider(cfg))
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+func joinDetail(err, detail string) string {
+	if detail == "" {
+		return err
+	}
+	return err + " (" + detail + ")"
+}
@@ -1,143 +1,208 @@
 package main
 
 import (
-	"log"
+	"context"
+	"crypto/tls"
+	"flag"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/cors"
-	"github.com/gofiber/fiber/v2/middleware/helmet"
-	"github.com/gofiber/fiber/v2/middleware/logger"
-	"github.com/gofiber/fiber/v2/middleware/recover"
 	"github.com/joho/godotenv"
 
+	"github.com/zesbe/lumina-ai/internal/app"
+	"github.com/zesbe/lumina-ai/internal/audit"
 	"github.com/zesbe/lumina-ai/internal/cache"
 	"github.com/zesbe/lumina-ai/internal/config"
+	"github.com/zesbe/lumina-ai/internal/crypto"
 	"github.com/zesbe/lumina-ai/internal/database"
-	"github.com/zesbe/lumina-ai/internal/handlers"
-	"github.com/zesbe/lumina-ai/internal/middleware"
+	"github.com/zesbe/lumina-ai/internal/erasure"
+	"github.com/zesbe/lumina-ai/internal/geoip"
+	"github.com/zesbe/lumina-ai/internal/logger"
+	"github.com/zesbe/lumina-ai/internal/purge"
+	"github.com/zesbe/lumina-ai/internal/reporting"
+	"github.com/zesbe/lumina-ai/internal/server"
+	"github.com/zesbe/lumina-ai/internal/services"
+	"github.com/zesbe/lumina-ai/internal/settings"
+	"github.com/zesbe/lumina-ai/internal/tracing"
+	"github.com/zesbe/lumina-ai/internal/version"
+	"github.com/zesbe/lumina-ai/internal/watermark"
 )
 
 func main() {
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found, using system environment variables")
-	}
+	check := flag.Bool("check", false, "check the configuration, database, Redis, ffmpeg and MiniMax, then exit")
+	checkMiniMax := flag.Bool("check-minimax", false, "with -check, also verify the MiniMax key with one API call")
+	encryptFields := flag.Bool("encrypt-fields", false, "encrypt values of encrypted columns still stored in plaintext or under an old key with the newest key, then exit")
+	flag.Parse()
+
+	envErr := godotenv.Load()
 
 	cfg := config.Load()
+	logger.Init(cfg.Environment)
+	if envErr != nil {
+		slog.Info("no .env file found, using system environment variables")
+	}
+
+	if *check {
+		os.Exit(runCheck(cfg, *checkMiniMax))
+	}
+
+	warnings, err := cfg.Validate()
+	for _, w := range warnings {
+		slog.Warn("config: " + w)
+	}
+	if err != nil {
+		slog.Error("refusing to start", "error", err)
+		os.Exit(1)
+	}
+	crypto.SetPasswordParams(&cfg.Argon2)
+	crypto.SetFieldKeys(cfg.FieldKeys)
+
+	shutdownTracing, err := tracing.Init(context.Background(), cfg.Environment)
+	if err != nil {
+		slog.Error("failed to initialize tracing", "error", err)
+		os.Exit(1)
+	}
+
+	if err := reporting.Init(cfg); err != nil {
+		slog.Error("failed to initialize error reporting", "error", err)
+		os.Exit(1)
+	}
 
 	// Connect to database
-	db, err := database.Connect(cfg.DatabaseURL)
+	db, err := database.Connect(cfg)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		slog.Error("failed to connect to database", "error", err)
+		os.Exit(1)
+	}
+
+	if *encryptFields {
+		n, err := database.EncryptFields(context.Background(), db)
+		if err != nil {
+			slog.Error("failed to encrypt fields", "encrypted", n, "error", err)
+			os.Exit(1)
+		}
+		slog.Info("encrypted fields", "encrypted", n)
+		os.Exit(0)
 	}
 
+	if err := geoip.Init(cfg.GeoIPDBPath); err != nil {
+		slog.Error("failed to load GeoIP database", "error", err)
+		os.Exit(1)
+	}
+
+	if cfg.Watermark.Enabled {
+		if err := watermark.Init(cfg.Watermark); err != nil {
+			slog.Error("failed to load watermark assets", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	app.Init(cfg, db)
+	audit.StartRetention(db, cfg.AuditRetention, cfg.AuditArchiveDir)
+	purge.Start(db, cfg.PurgeRetention, cfg.UploadPath, cfg.DataExportDir)
+	erasure.Start(db, cfg.UploadPath, cfg.DataExportDir)
+
 	// Initialize Redis cache
 	if err := cache.InitRedis(cfg.RedisURL); err != nil {
-		log.Printf("⚠️ Redis not available, running without cache: %v", err)
+		slog.Warn("redis not available, running without cache", "error", err)
 	} else {
-		log.Println("✅ Redis cache connected")
+		slog.Info("redis cache connected")
 	}
 
-	app := fiber.New(fiber.Config{
-		AppName:               "Lumina AI API",
-		DisableStartupMessage: cfg.Environment == "production",
-		ErrorHandler:          handlers.ErrorHandler,
-		BodyLimit:             int(cfg.UploadMaxSize),
+	settings.OnChange(func(old, new settings.Settings) {
+		slog.Info("runtime settings changed", "settings", new)
 	})
 
-	// Global middlewares
-	app.Use(recover.New())
-	app.Use(logger.New(logger.Config{
-		Format:     "[]  -   - \n",
-		TimeFormat: "2006-01-02 15:04:05",
-	}))
-	app.Use(helmet.New())
-	app.Use(cors.New(cors.Config{
-		AllowOrigins:     "*",
-		AllowMethods:     "GET,POST,PUT,DELETE,PATCH,OPTIONS",
-		AllowHeaders:     "Origin,Content-Type,Accept,Authorization,X-Request-ID,X-CSRF-Token,Upgrade,Connection",
-		AllowCredentials: false,
-		MaxAge:           86400,
-	}))
-
-	// Rate limiting
-	app.Use(middleware.RateLimiter(cfg.RateLimitRequests, cfg.RateLimitWindow))
-
-	// Health check
-	app.Get("/health", handlers.HealthCheck)
-
-	// API routes
-	api := app.Group("/api/v1")
-
-	// Public routes
-	auth := api.Group("/auth")
-	auth.Post("/register", middleware.StrictRateLimiter(5, cfg.RateLimitWindow), handlers.Register(db))
-	auth.Post("/login", middleware.StrictRateLimiter(10, cfg.RateLimitWindow), handlers.Login(db, cfg))
-	auth.Post("/refresh", handlers.RefreshToken(cfg))
-	auth.Get("/csrf-token", handlers.GenerateCSRFToken)
-
-	// Public Explore (no auth required)
-	api.Get("/explore", handlers.GetPublicGenerations(db))
-
-	// Protected routes
-	protected := api.Group("/", middleware.JWTAuth(cfg.JWTSecret))
-
-	// WebSocket for real-time updates
-	protected.Use("/ws", handlers.WebSocketUpgrade())
-	protected.Get("/ws", handlers.WebSocketHandler())
-
-	// Profile
-	protected.Get("/profile", handlers.GetProfile(db))
-	protected.Put("/profile", handlers.UpdateProfile(db))
-	protected.Post("/profile/change-password", handlers.ChangePassword(db))
-	protected.Post("/logout", handlers.Logout)
-
-	// Generations
-	generations := protected.Group("/generations")
-	generations.Get("/", handlers.GetGenerations(db))
-	generations.Get("/:id", handlers.GetGeneration(db))
-	generations.Delete("/:id", handlers.DeleteGeneration(db))
-	generations.Post("/:id/favorite", handlers.ToggleFavorite(db))
-	generations.Post("/:id/public", handlers.TogglePublic(db))
-
-
-	// Music Generation
-	music := protected.Group("/music")
-	music.Post("/generate", handlers.GenerateMusic(db, cfg))
-
-	// Video Generation
-	video := protected.Group("/video")
-	video.Post("/generate", handlers.GenerateVideo(db, cfg))
-
-	// Stats (protected)
-	protected.Get("/stats", handlers.ServerStats)
-
-	// Serve uploaded files
-	if cfg.StorageType == "local" {
-		app.Static("/uploads", cfg.UploadPath)
-	}
-
-	// Graceful shutdown
+	api, h := app.New(cfg, db, cache.Cache, services.NewMiniMaxService(cfg.MiniMaxAPIKey, cfg.MiniMaxGroupID))
+	var sideApps []*fiber.App
+	for addr, side := range app.SideApps(cfg, h) {
+		sideApps = append(sideApps, serveSide(side, addr))
+	}
+
+	// Video jobs and data exports a previous shutdown cut off
+	h.ResumeInterrupted()
+	h.ResumeDataExports()
+
+	// Graceful shutdown: drain generations while the API still answers,
+	// then stop serving, write out the audit queue, and close the database
+	// and Redis last.
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	stopped := make(chan struct{})
 
 	go func() {
+		defer close(stopped)
 		<-quit
-		log.Println("Shutting down server...")
+		slog.Info("shutting down server", "grace", cfg.ShutdownGracePeriod)
+		h.Drain(cfg.ShutdownGracePeriod)
+		if err := api.Shutdown(); err != nil {
+			slog.Error("error during shutdown", "error", err)
+		}
+		for _, side := range sideApps {
+			side.Shutdown()
+		}
 		if cache.Cache != nil {
 			cache.Cache.Close()
 		}
-		if err := app.Shutdown(); err != nil {
-			log.Printf("Error during shutdown: %v", err)
+		audit.Close(5 * time.Second)
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+		if err := shutdownTracing(context.Background()); err != nil {
+			slog.Error("error flushing traces", "error", err)
 		}
+		reporting.Flush(5 * time.Second)
 	}()
 
 	addr := ":" + cfg.Port
-	log.Printf("🚀 Lumina AI API starting on %s (env: %s)", addr, cfg.Environment)
+	slog.Info("lumina ai api starting", "addr", addr, "env", cfg.Environment, "version", version.Version, "commit", version.Commit, "tls", cfg.TLSEnabled(), "mtls", cfg.MTLSEnabled)
+
+	if err := listen(api, addr, cfg); err != nil {
+		slog.Error("failed to start server", "error", err)
+		os.Exit(1)
+	}
+	// listen returns as soon as the listener closes; wait for the rest of
+	// shutdown.
+	<-stopped
+}
+
+// listen serves app on addr: plain HTTP, HTTPS when a certificate is
+// configured (reloaded on SIGHUP), or HTTPS requiring verified client
+// certificates when mTLS is enabled.
+func listen(app *fiber.App, addr string, cfg *config.Config) error {
+	if !cfg.TLSEnabled() {
+		return app.Listen(addr)
+	}
 
-	if err := app.Listen(addr); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	certs, err := server.NewCertReloader(cfg.TLSCertPath, cfg.TLSKeyPath)
+	if err != nil {
+		return err
+	}
+	certs.ReloadOnSIGHUP()
+
+	tlsConfig := server.TLSConfig(certs)
+	if cfg.MTLSEnabled {
+		if tlsConfig, err = server.MutualTLSConfig(certs, cfg.MTLSCAPath); err != nil {
+			return err
+		}
+	}
+	ln, err := tls.Listen("tcp", addr, tlsConfig)
+	if err != nil {
+		return err
 	}
+	return app.Listener(ln)
+}
+
+// serveSide starts a secondary plain-HTTP app on addr in the background.
+func serveSide(app *fiber.App, addr string) *fiber.App {
+	go func() {
+		if err := app.Listen(addr); err != nil {
+			slog.Error("secondary listener failed", "addr", addr, "error", err)
+		}
+	}()
+	return app
 }
@@ -0,0 +1,200 @@
+// Package apierror writes error responses. Every error the API returns has
+// a stable machine-readable code next to its localized message.
+//
+// Clients that send "Accept-Version: 2" get the envelope
+//
+//	{"error": {"code": "NOT_FOUND", "message": "...", "details": ..., "request_id": "..."}}
+//
+// Everyone else gets the v1 shape the API has always returned, with the
+// code and request ID added:
+//
+//	{"error": "Not Found", "message": "...", "code": "NOT_FOUND", "request_id": "..."}
+package apierror
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// VersionHeader selects the error shape; see the package comment.
+const VersionHeader = "Accept-Version"
+
+// Code identifies an error for programs. Codes are stable: add new ones,
+// never rename or reuse them.
+type Code string
+
+const (
+	CodeBadRequest       Code = "BAD_REQUEST"
+	CodeValidationFailed Code = "VALIDATION_FAILED"
+	CodeNarrationTooLong Code = "NARRATION_TOO_LONG"
+
+	CodeUnauthorized       Code = "UNAUTHORIZED"
+	CodeInvalidCredentials Code = "INVALID_CREDENTIALS"
+	CodeInvalidToken       Code = "INVALID_TOKEN"
+	CodeTokenExpired       Code = "TOKEN_EXPIRED"
+	CodeReauthRequired     Code = "REAUTH_REQUIRED"
+
+	CodeInsufficientCredits Code = "INSUFFICIENT_CREDITS"
+
+	CodeForbidden              Code = "FORBIDDEN"
+	CodeCSRFFailed             Code = "CSRF_FAILED"
+	CodeImpersonationForbidden Code = "IMPERSONATION_FORBIDDEN"
+	CodeAPIKeyForbidden        Code = "API_KEY_FORBIDDEN"
+	CodeInsufficientScope      Code = "INSUFFICIENT_SCOPE"
+	CodePlanUpgradeRequired    Code = "PLAN_UPGRADE_REQUIRED"
+	CodePublishingBanned       Code = "PUBLISHING_BANNED"
+	CodeContentRemoved         Code = "CONTENT_REMOVED"
+	CodeCaptchaRequired        Code = "CAPTCHA_REQUIRED"
+	CodeEmailNotVerified       Code = "EMAIL_NOT_VERIFIED"
+
+	CodeNotFound         Code = "NOT_FOUND"
+	CodeMethodNotAllowed Code = "METHOD_NOT_ALLOWED"
+	CodeConflict         Code = "CONFLICT"
+	CodeEmailTaken       Code = "EMAIL_TAKEN"
+	CodePayloadTooLarge  Code = "PAYLOAD_TOO_LARGE"
+	CodeUpgradeRequired  Code = "UPGRADE_REQUIRED"
+
+	CodePolicyViolation  Code = "POLICY_VIOLATION"
+	CodePublishBlocked   Code = "PUBLISH_BLOCKED"
+	CodeCreditsBelowZero Code = "CREDITS_BELOW_ZERO"
+	CodeDisposableEmail  Code = "DISPOSABLE_EMAIL"
+
+	CodeRateLimited       Code = "RATE_LIMITED"
+	CodeDailyLimitReached Code = "DAILY_LIMIT_REACHED"
+
+	CodeInternal            Code = "INTERNAL_ERROR"
+	CodeProviderUnavailable Code = "PROVIDER_UNAVAILABLE"
+	CodeServiceUnavailable  Code = "SERVICE_UNAVAILABLE"
+	CodeMaintenance         Code = "MAINTENANCE"
+	CodeShuttingDown        Code = "SHUTTING_DOWN"
+	CodeQueueFull           Code = "QUEUE_FULL"
+	CodeTimeout             Code = "TIMEOUT"
+)
+
+// Codes lists every code, for the API documentation.
+var Codes = []Code{
+	CodeBadRequest, CodeValidationFailed, CodeNarrationTooLong,
+	CodeUnauthorized, CodeInvalidCredentials, CodeInvalidToken, CodeTokenExpired, CodeReauthRequired,
+	CodeInsufficientCredits,
+	CodeForbidden, CodeCSRFFailed, CodeImpersonationForbidden, CodeAPIKeyForbidden, CodeInsufficientScope, CodePlanUpgradeRequired, CodePublishingBanned, CodeContentRemoved, CodeCaptchaRequired, CodeEmailNotVerified,
+	CodeNotFound, CodeMethodNotAllowed, CodeConflict, CodeEmailTaken, CodePayloadTooLarge, CodeUpgradeRequired,
+	CodePolicyViolation, CodePublishBlocked, CodeCreditsBelowZero, CodeDisposableEmail,
+	CodeRateLimited, CodeDailyLimitReached,
+	CodeInternal, CodeProviderUnavailable, CodeServiceUnavailable, CodeMaintenance, CodeShuttingDown, CodeQueueFull, CodeTimeout,
+}
+
+// legacyTitles are the v1 "error" strings that weren't the status text.
+var legacyTitles = map[Code]string{
+	CodeValidationFailed: "Validation Failed",
+	CodeNarrationTooLong: "Narration Too Long",
+}
+
+// statusCodes is the code of an error known only by its status, such as a
+// *fiber.Error.
+var statusCodes = map[int]Code{
+	fiber.StatusBadRequest:            CodeBadRequest,
+	fiber.StatusUnauthorized:          CodeUnauthorized,
+	fiber.StatusPaymentRequired:       CodeInsufficientCredits,
+	fiber.StatusForbidden:             CodeForbidden,
+	fiber.StatusNotFound:              CodeNotFound,
+	fiber.StatusMethodNotAllowed:      CodeMethodNotAllowed,
+	fiber.StatusConflict:              CodeConflict,
+	fiber.StatusRequestEntityTooLarge: CodePayloadTooLarge,
+	fiber.StatusUnprocessableEntity:   CodeValidationFailed,
+	fiber.StatusUpgradeRequired:       CodeUpgradeRequired,
+	fiber.StatusTooManyRequests:       CodeRateLimited,
+	fiber.StatusServiceUnavailable:    CodeServiceUnavailable,
+	fiber.StatusGatewayTimeout:        CodeTimeout,
+}
+
+// ForStatus is the generic code for an HTTP status.
+func ForStatus(status int) Code {
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	if status >= fiber.StatusInternalServerError {
+		return CodeInternal
+	}
+	return CodeBadRequest
+}
+
+// Error is an API error. Message is already localized.
+type Error struct {
+	Status  int
+	Code    Code
+	Message string
+	// Details is the list of validation failures, or a map of facts about
+	// the error (retry_after, limit, ...). v1 puts map entries at the top
+	// level of the body, where they have always been.
+	Details interface{}
+}
+
+func New(status int, code Code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// WithDetails sets Details.
+func (e *Error) WithDetails(details interface{}) *Error {
+	e.Details = details
+	return e
+}
+
+// With adds one entry to map Details.
+func (e *Error) With(key string, value interface{}) *Error {
+	details, ok := e.Details.(fiber.Map)
+	if !ok {
+		details = fiber.Map{}
+		e.Details = details
+	}
+	details[key] = value
+	return e
+}
+
+// Respond writes e in the shape the client asked for.
+func Respond(c *fiber.Ctx, e *Error) error {
+	requestID, _ := c.Locals("requestID").(string)
+	c.Vary(VersionHeader)
+
+	if wantsV2(c) {
+		body := fiber.Map{
+			"code":       e.Code,
+			"message":    e.Message,
+			"request_id": requestID,
+		}
+		if e.Details != nil {
+			body["details"] = e.Details
+		}
+		return c.Status(e.Status).JSON(fiber.Map{"error": body})
+	}
+
+	title, ok := legacyTitles[e.Code]
+	if !ok {
+		title = http.StatusText(e.Status)
+	}
+	body := fiber.Map{}
+	switch details := e.Details.(type) {
+	case nil:
+	case fiber.Map:
+		for k, v := range details {
+			body[k] = v
+		}
+	default:
+		body["details"] = details
+	}
+	body["error"] = title
+	body["message"] = e.Message
+	body["code"] = e.Code
+	body["request_id"] = requestID
+	return c.Status(e.Status).JSON(body)
+}
+
+func wantsV2(c *fiber.Ctx) bool {
+	v := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(c.Get(VersionHeader))), "v")
+	return v == "2"
+}
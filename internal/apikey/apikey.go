@@ -0,0 +1,208 @@
+// Package apikey authenticates programs that call the API with a key
+// instead of logging in. A key looks like lum_<12 hex><48 hex>; the first
+// 16 characters are its prefix, stored in the clear to find the key, and
+// the whole key is stored as a SHA-256 hash.
+//
+// Keys are cached for CacheTTL after a lookup so authenticating stays a
+// map read, and last-used times are written in batches in the background.
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/zesbe/lumina-ai/internal/crypto"
+	"github.com/zesbe/lumina-ai/internal/logger"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+const (
+	// Prefix starts every key, so keys can be told apart from JWTs.
+	Prefix = "lum_"
+
+	prefixLength = len(Prefix) + 12
+	keyLength    = prefixLength + 48
+
+	// CacheTTL bounds how long a revoked key, or a changed plan or role,
+	// keeps working on instances other than the one that changed it.
+	CacheTTL = 30 * time.Second
+	// touchInterval is how often last-used times are written.
+	touchInterval = 30 * time.Second
+)
+
+// Plans are the plans whose users can create and use keys.
+var Plans = []string{string(models.PlanPro), string(models.PlanEnterprise)}
+
+var (
+	// ErrInvalid is a key that was never issued, was revoked or belongs
+	// to a disabled account.
+	ErrInvalid = errors.New("invalid api key")
+	// ErrExpired is a key past its expiry.
+	ErrExpired = errors.New("api key expired")
+)
+
+// Principal is who a key authenticates as.
+type Principal struct {
+	KeyID  uint
+	UserID uint
+	Email  string
+	Role   string
+	Plan   string
+	Scopes []string
+
+	secretHash string
+	expiresAt  *time.Time
+	active     bool
+	loadedAt   time.Time
+}
+
+// Allows reports whether the key has scope. A generate key can also read.
+func (p *Principal) Allows(scope string) bool {
+	if scope == models.ScopeRead && slices.Contains(p.Scopes, models.ScopeGenerate) {
+		return true
+	}
+	return slices.Contains(p.Scopes, scope)
+}
+
+type store struct {
+	db *gorm.DB
+
+	mu   sync.Mutex
+	keys map[string]*Principal
+	used map[uint]time.Time
+}
+
+var s *store
+
+// Init enables key authentication. Until it is called every key is
+// refused.
+func Init(db *gorm.DB) {
+	s = &store{db: db, keys: map[string]*Principal{}, used: map[uint]time.Time{}}
+	go s.run()
+}
+
+// IsKey reports whether token is meant as an API key rather than a JWT.
+func IsKey(token string) bool {
+	return strings.HasPrefix(token, Prefix)
+}
+
+// Generate makes a new key. The caller stores the returned prefix and
+// hash and shows the key once.
+func Generate() (key, prefix, hash string, err error) {
+	b := make([]byte, (keyLength-len(Prefix))/2)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", err
+	}
+	key = Prefix + hex.EncodeToString(b)
+	return key, key[:prefixLength], crypto.HashToken(key), nil
+}
+
+// Authenticate resolves key to its owner and scopes.
+func Authenticate(ctx context.Context, key string) (*Principal, error) {
+	if s == nil || len(key) != keyLength || !IsKey(key) {
+		return nil, ErrInvalid
+	}
+	prefix := key[:prefixLength]
+
+	s.mu.Lock()
+	p, ok := s.keys[prefix]
+	s.mu.Unlock()
+	if !ok || time.Since(p.loadedAt) > CacheTTL {
+		var err error
+		if p, err = s.load(ctx, prefix); err != nil {
+			return nil, err
+		}
+	}
+
+	if subtle.ConstantTimeCompare([]byte(p.secretHash), []byte(crypto.HashToken(key))) != 1 || !p.active {
+		return nil, ErrInvalid
+	}
+	if p.expiresAt != nil && time.Now().After(*p.expiresAt) {
+		return nil, ErrExpired
+	}
+
+	s.mu.Lock()
+	s.used[p.KeyID] = time.Now()
+	s.mu.Unlock()
+	return p, nil
+}
+
+// Forget drops a key from this instance's cache, e.g. once it is revoked.
+func Forget(prefix string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	delete(s.keys, prefix)
+	s.mu.Unlock()
+}
+
+func (s *store) load(ctx context.Context, prefix string) (*Principal, error) {
+	var key models.APIKey
+	if err := s.db.WithContext(ctx).Where("prefix = ? AND revoked_at IS NULL", prefix).First(&key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// Unknown prefixes aren't cached, so made-up keys can't
+			// fill the cache.
+			return nil, ErrInvalid
+		}
+		return nil, err
+	}
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, key.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalid
+		}
+		return nil, err
+	}
+
+	p := &Principal{
+		KeyID:      key.ID,
+		UserID:     user.ID,
+		Email:      user.Email,
+		Role:       user.Role,
+		Plan:       user.Plan,
+		Scopes:     models.SplitList(key.Scopes),
+		secretHash: key.SecretHash,
+		expiresAt:  key.ExpiresAt,
+		active:     user.IsActive,
+		loadedAt:   time.Now(),
+	}
+	s.mu.Lock()
+	// Keyed on the stored prefix: the caller's may point into a request
+	// buffer that is reused.
+	s.keys[key.Prefix] = p
+	s.mu.Unlock()
+	return p, nil
+}
+
+// run writes last-used times and drops stale cache entries.
+func (s *store) run() {
+	ticker := time.NewTicker(touchInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.mu.Lock()
+		used := s.used
+		s.used = map[uint]time.Time{}
+		for prefix, p := range s.keys {
+			if time.Since(p.loadedAt) > CacheTTL {
+				delete(s.keys, prefix)
+			}
+		}
+		s.mu.Unlock()
+
+		for id, at := range used {
+			if err := s.db.Model(&models.APIKey{}).Where("id = ?", id).Update("last_used_at", at).Error; err != nil {
+				logger.L().Warn("failed to record api key use", "key_id", id, "error", err)
+			}
+		}
+	}
+}
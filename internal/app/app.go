@@ -0,0 +1,141 @@
+// Package app wires the API together: its middleware, its routes and the
+// package-level services the handlers read. main builds the dependencies
+// and serves what New returns; apptest builds the same app for tests.
+package app
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/helmet"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+	"gorm.io/gorm"
+
+	"github.com/zesbe/lumina-ai/internal/apikey"
+	"github.com/zesbe/lumina-ai/internal/audit"
+	"github.com/zesbe/lumina-ai/internal/cache"
+	"github.com/zesbe/lumina-ai/internal/captcha"
+	"github.com/zesbe/lumina-ai/internal/config"
+	"github.com/zesbe/lumina-ai/internal/disposable"
+	"github.com/zesbe/lumina-ai/internal/flags"
+	"github.com/zesbe/lumina-ai/internal/handlers"
+	"github.com/zesbe/lumina-ai/internal/mail"
+	"github.com/zesbe/lumina-ai/internal/middleware"
+	"github.com/zesbe/lumina-ai/internal/moderation"
+	"github.com/zesbe/lumina-ai/internal/server"
+	"github.com/zesbe/lumina-ai/internal/services"
+	"github.com/zesbe/lumina-ai/internal/settings"
+	"github.com/zesbe/lumina-ai/internal/userstate"
+)
+
+// Init sets up the services handlers and middleware reach through package
+// state, and the runtime settings at their boot values. The background
+// workers (audit retention, purge, erasure) are main's to start.
+func Init(cfg *config.Config, db *gorm.DB) {
+	audit.Init(db)
+	moderation.Init(db, cfg)
+	disposable.Init(db, cfg)
+	captcha.Init(cfg)
+	flags.Init(db)
+	apikey.Init(db)
+	userstate.Init(db)
+	mail.Init(cfg)
+	settings.Init(BootSettings(cfg))
+}
+
+// BootSettings are the values the settings admins can change at runtime
+// start with.
+func BootSettings(cfg *config.Config) settings.Settings {
+	return settings.Settings{
+		RateLimitRequests:       cfg.RateLimitRequests,
+		RateLimitWindowSeconds:  int(cfg.RateLimitWindow.Seconds()),
+		ListCountCacheSeconds:   60,
+		AnalyticsCacheSeconds:   300,
+		MusicCreditCost:         1,
+		VideoCreditCost:         2,
+		NarratedVideoCreditCost: 3,
+		ReferralBonusCredits:    5,
+		ReferralMonthlyCap:      10,
+		LowCreditThreshold:      3,
+		SavedPromptLimits:       map[string]int{"free": 20, "basic": 100, "pro": 500, "enterprise": 1000},
+	}
+}
+
+// New builds the API with every middleware and route, and the handlers
+// behind them, which main also needs to resume and drain background work.
+// The handlers cache in redis, if not nil, and generate through minimax;
+// tests pass fakes of both. Init must have run.
+func New(cfg *config.Config, db *gorm.DB, redis *cache.RedisCache, minimax *services.MiniMaxService) (*fiber.App, *handlers.Handlers) {
+	h := handlers.New(db, cfg, redis, minimax)
+	app := fiber.New(fiber.Config{
+		AppName:               "Lumina AI API",
+		DisableStartupMessage: cfg.Environment == "production",
+		ErrorHandler:          handlers.ErrorHandler(cfg),
+		// The global limit is the upload ceiling; JSON routes are clamped
+		// further by middleware.BodyLimit. Streaming lets that middleware
+		// refuse oversized bodies without buffering them first.
+		BodyLimit:         int(cfg.UploadMaxSize),
+		StreamRequestBody: true,
+	})
+
+	// Global middlewares
+	app.Use(recover.New(recover.Config{
+		EnableStackTrace:  true,
+		StackTraceHandler: handlers.ReportPanic,
+	}))
+	app.Use(middleware.RequestID())
+	app.Use(middleware.Version())
+	app.Use(middleware.BaseURL(cfg.PublicBaseURL))
+	if cfg.MTLSEnabled {
+		app.Use(middleware.ClientCert(cfg.MTLSAllowedSubjects))
+	}
+	// Profiling for admins, unless it has a listener of its own. Mounted
+	// ahead of the logger and rate limiter so profiles aren't throttled and
+	// don't fill the request log.
+	if cfg.PprofAddr == "" {
+		app.Use("/debug/pprof", middleware.JWTAuth(cfg.JWTKeys, cfg.DenylistFailClosed), middleware.RequireRole("admin"), h.Profiling())
+	}
+	app.Use(middleware.Tracing())
+	app.Use(middleware.RequestLogger())
+	app.Use(helmet.New())
+	app.Use(middleware.CORS(cfg.AllowedOrigins, cfg.Environment))
+
+	// Compress JSON over 1KB. Uploaded media, the WebSocket, data export
+	// bundles and the ledger export (which gzips itself as it streams) are
+	// left alone.
+	app.Use(middleware.Compress(1024, "/uploads", "/api/v1/ws", "/api/v1/exports", "/api/v1/admin/transactions/export"))
+
+	// Rate limiting
+	app.Use(middleware.RateLimiter(settings.RateLimit))
+
+	// Maintenance mode; /health, the JWKS, login and /admin stay reachable
+	app.Use(middleware.Maintenance())
+
+	registerRoutes(app, cfg, h)
+	return app, h
+}
+
+// SideApps are the secondary plain-HTTP listeners, by address: health
+// checks for load balancers that can't present a client certificate, the
+// HTTP to HTTPS redirect and loopback-only profiling. Each is only there
+// when configured.
+func SideApps(cfg *config.Config, h *handlers.Handlers) map[string]*fiber.App {
+	apps := map[string]*fiber.App{}
+	if cfg.HealthPort != "" {
+		healthApp := fiber.New(fiber.Config{DisableStartupMessage: true})
+		healthApp.Get("/health", h.HealthCheck())
+		healthApp.Get("/health/deep", h.DeepHealthCheck())
+		healthApp.Get("/health/live", h.LiveCheck())
+		healthApp.Get("/health/ready", h.ReadyCheck())
+		apps[":"+cfg.HealthPort] = healthApp
+	}
+	if cfg.HTTPRedirectPort != "" {
+		redirectApp := fiber.New(fiber.Config{DisableStartupMessage: true})
+		redirectApp.Use(server.RedirectToHTTPS(cfg.Port))
+		apps[":"+cfg.HTTPRedirectPort] = redirectApp
+	}
+	if cfg.PprofAddr != "" {
+		pprofApp := fiber.New(fiber.Config{DisableStartupMessage: true})
+		pprofApp.Use(h.Profiling())
+		apps[cfg.PprofAddr] = pprofApp
+	}
+	return apps
+}
@@ -0,0 +1,217 @@
+// Package apptest builds the whole API for end-to-end tests, through the
+// same app.New as the server: on an in-memory SQLite database, without
+// Redis unless WithRedis is given, and in demo mode, so generate requests
+// complete at once without calling MiniMax. WithMiniMax runs their jobs
+// against a fake of it instead.
+//
+// The services the app reaches through package state are set up again for
+// every App, so tests that build one must not run in parallel.
+package apptest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/glebarez/sqlite"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/zesbe/lumina-ai/internal/app"
+	"github.com/zesbe/lumina-ai/internal/cache"
+	"github.com/zesbe/lumina-ai/internal/config"
+	"github.com/zesbe/lumina-ai/internal/crypto"
+	"github.com/zesbe/lumina-ai/internal/database"
+	"github.com/zesbe/lumina-ai/internal/handlers"
+	"github.com/zesbe/lumina-ai/internal/models"
+	"github.com/zesbe/lumina-ai/internal/services"
+)
+
+// App is the API under test, with the database, configuration and fakes
+// it was built from, and its handlers, for draining.
+type App struct {
+	*fiber.App
+	DB       *gorm.DB
+	Config   *config.Config
+	Handlers *handlers.Handlers
+	// Redis is the app's cache, or nil without WithRedis.
+	Redis *miniredis.Miniredis
+	// MiniMax is the fake provider, or nil without WithMiniMax.
+	MiniMax *MiniMax
+	tb      testing.TB
+}
+
+// Setup is what New builds the app from. The configuration's fields can
+// be set on it directly.
+type Setup struct {
+	*config.Config
+	// Redis, if not nil, is where the app caches.
+	Redis *miniredis.Miniredis
+	// MiniMax, if not nil, is the provider the app generates through.
+	MiniMax *MiniMax
+	tb      testing.TB
+}
+
+// WithRedis gives the app a cache, on a miniredis of its own.
+func WithRedis(s *Setup) {
+	s.Redis = miniredis.RunT(s.tb)
+}
+
+// New builds the API. Configure, if given, adjusts the setup before
+// anything is built from it.
+func New(tb testing.TB, configure ...func(*Setup)) *App {
+	tb.Helper()
+
+	cfg := config.Load()
+	cfg.Environment = "test"
+	cfg.DemoMode = true
+	cfg.MiniMaxAPIKey = ""
+	cfg.JWTSecret = "apptest-jwt-secret-at-least-32-characters"
+	cfg.EncryptionKey = "apptest-encryption-key-32-bytes!"
+	cfg.EncryptionKeys = ""
+	cfg.DatabaseURL = "sqlite://memory"
+	cfg.RedisURL = ""
+	cfg.AdminEmail, cfg.AdminPassword = "", ""
+	cfg.UploadPath = tb.TempDir()
+	cfg.DataExportDir = tb.TempDir()
+	cfg.AuditArchiveDir = ""
+	cfg.SMTPHost = ""
+	cfg.Captcha = config.Captcha{}
+	cfg.ModerationAPIURL = ""
+	cfg.ModerationReloadInterval = 0
+	cfg.DisposableDomainsURL = ""
+	cfg.EmailMXCheck = false
+	cfg.MTLSEnabled = false
+	cfg.TLSCertPath, cfg.TLSKeyPath = "", ""
+	cfg.PprofAddr = ""
+	cfg.Loudness.Enabled = false
+	cfg.Watermark.Enabled = false
+	cfg.RateLimitRequests = 100000
+	// Hashing at the production cost would make every login take a
+	// noticeable share of a second.
+	cfg.Argon2 = crypto.Argon2Params{Memory: 8192, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	setup := &Setup{Config: cfg, tb: tb}
+	for _, fn := range configure {
+		fn(setup)
+	}
+	if setup.Redis != nil {
+		cfg.RedisURL = "redis://" + setup.Redis.Addr()
+	}
+	if _, err := cfg.Validate(); err != nil {
+		tb.Fatalf("apptest: %v", err)
+	}
+	crypto.SetPasswordParams(&cfg.Argon2)
+	crypto.SetFieldKeys(cfg.FieldKeys)
+	cache.Cache = nil
+	if cfg.RedisURL != "" {
+		if err := cache.InitRedis(cfg.RedisURL); err != nil {
+			tb.Fatalf("apptest: connect to Redis: %v", err)
+		}
+		tb.Cleanup(func() {
+			cache.Cache.Close()
+			cache.Cache = nil
+		})
+	}
+
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(tb.Name())
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", name)), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		tb.Fatalf("apptest: open database: %v", err)
+	}
+	// One connection keeps the in-memory database alive for the whole
+	// test and spares SQLite concurrent writers from the generation jobs.
+	sqlDB, err := db.DB()
+	if err != nil {
+		tb.Fatalf("apptest: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	tb.Cleanup(func() { sqlDB.Close() })
+	if err := database.Setup(db, cfg); err != nil {
+		tb.Fatalf("apptest: set up database: %v", err)
+	}
+
+	minimax := services.NewMiniMaxService(cfg.MiniMaxAPIKey, cfg.MiniMaxGroupID)
+	if setup.MiniMax != nil {
+		minimax = minimax.WithHTTPClient(setup.MiniMax.client())
+	}
+	app.Init(cfg, db)
+	api, h := app.New(cfg, db, cache.Cache, minimax)
+	// No job may outlive the database it records its outcome in.
+	tb.Cleanup(func() { h.Drain(time.Second) })
+	return &App{App: api, DB: db, Config: cfg, Handlers: h, Redis: setup.Redis, MiniMax: setup.MiniMax, tb: tb}
+}
+
+// Do sends req to the app, failing the test if it can't be served.
+func (a *App) Do(req *http.Request) *http.Response {
+	a.tb.Helper()
+	resp, err := a.Test(req, -1)
+	if err != nil {
+		a.tb.Fatalf("apptest: %s %s: %v", req.Method, req.URL.Path, err)
+	}
+	return resp
+}
+
+// JSON sends body, if not nil, as JSON to path, with token as the bearer
+// token if not empty, and decodes the response into out if not nil. It
+// returns the status code.
+func (a *App) JSON(method, path, token string, body, out interface{}) int {
+	a.tb.Helper()
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			a.tb.Fatalf("apptest: encode %s %s: %v", method, path, err)
+		}
+		r = bytes.NewReader(b)
+	}
+	req := httptest.NewRequest(method, path, r)
+	if body != nil {
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	}
+	if token != "" {
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	}
+
+	resp := a.Do(req)
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			a.tb.Fatalf("apptest: decode %s %s (%d): %v", method, path, resp.StatusCode, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// Login registers an account with email and password, marks its email
+// verified, as following the mailed link would, and logs it in, returning
+// the access token.
+func (a *App) Login(email, password string) string {
+	a.tb.Helper()
+	creds := map[string]string{"email": email, "password": password}
+	account := map[string]string{"email": email, "password": password, "name": "Test User"}
+	if status := a.JSON(http.MethodPost, "/api/v1/auth/register", "", account, nil); status != http.StatusCreated {
+		a.tb.Fatalf("apptest: register %s: status %d", email, status)
+	}
+	if err := a.DB.Model(&models.User{}).Where("email = ?", models.NormalizeEmail(email)).Update("is_verified", true).Error; err != nil {
+		a.tb.Fatalf("apptest: verify %s: %v", email, err)
+	}
+	var login struct {
+		Tokens struct {
+			AccessToken string `json:"access_token"`
+		} `json:"tokens"`
+	}
+	if status := a.JSON(http.MethodPost, "/api/v1/auth/login", "", creds, &login); status != http.StatusOK || login.Tokens.AccessToken == "" {
+		a.tb.Fatalf("apptest: login %s: status %d", email, status)
+	}
+	return login.Tokens.AccessToken
+}
@@ -0,0 +1,126 @@
+package apptest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// MiniMax is a fake of the MiniMax API for apps built WithMiniMax. Music
+// and image requests succeed at once, with outputs the fake serves itself
+// under /files/, unless held. Every request the app makes through its
+// MiniMax client reaches the fake, whatever host it was for.
+type MiniMax struct {
+	*httptest.Server
+
+	mu    sync.Mutex
+	calls map[string]int
+	held  chan struct{}
+}
+
+// WithMiniMax turns demo mode off and gives the app a MiniMax client that
+// talks to a fake, so generate requests run their jobs for real.
+func WithMiniMax(s *Setup) {
+	s.DemoMode = false
+	s.MiniMaxAPIKey = "apptest-minimax-key"
+	s.MiniMax = newMiniMax(s.tb)
+}
+
+func newMiniMax(tb testing.TB) *MiniMax {
+	m := &MiniMax{calls: map[string]int{}}
+	m.Server = httptest.NewServer(http.HandlerFunc(m.serve))
+	tb.Cleanup(m.Close)
+	// Held requests must go before the server can close.
+	tb.Cleanup(m.release)
+	return m
+}
+
+// Calls is how many requests the fake has had for path, such as
+// "/v1/music_generation".
+func (m *MiniMax) Calls(path string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.calls[path]
+}
+
+// Hold makes music and image requests wait until release is called, or
+// the app gives up on them.
+func (m *MiniMax) Hold() (release func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.held == nil {
+		m.held = make(chan struct{})
+	}
+	return m.release
+}
+
+func (m *MiniMax) release() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.held != nil {
+		close(m.held)
+		m.held = nil
+	}
+}
+
+// client sends every request to the fake, keeping only its path and
+// query.
+func (m *MiniMax) client() *http.Client {
+	target, _ := url.Parse(m.URL)
+	transport := m.Client().Transport
+	return &http.Client{Transport: roundTripper(func(req *http.Request) (*http.Response, error) {
+		req = req.Clone(req.Context())
+		req.URL.Scheme, req.URL.Host = target.Scheme, target.Host
+		return transport.RoundTrip(req)
+	})}
+}
+
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func (m *MiniMax) serve(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	m.calls[r.URL.Path]++
+	held := m.held
+	m.mu.Unlock()
+
+	if strings.HasPrefix(r.URL.Path, "/files/") {
+		w.Write([]byte("apptest output"))
+		return
+	}
+	if held != nil {
+		select {
+		case <-held:
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	ok := map[string]interface{}{"status_code": 0, "status_msg": "success"}
+	switch r.URL.Path {
+	case "/v1/music_generation":
+		writeJSON(w, map[string]interface{}{
+			"data":       map[string]interface{}{"audio": m.URL + "/files/music.mp3", "status": 2},
+			"extra_info": map[string]interface{}{"music_duration": 30000},
+			"base_resp":  ok,
+		})
+	case "/v1/image_generation":
+		writeJSON(w, map[string]interface{}{
+			"data":      map[string]interface{}{"image_urls": []string{m.URL + "/files/cover.jpg"}},
+			"base_resp": ok,
+		})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		writeJSON(w, map[string]interface{}{"base_resp": map[string]interface{}{"status_code": 1004, "status_msg": "not faked: " + r.URL.Path}})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,126 @@
+package app_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/zesbe/lumina-ai/internal/app/apptest"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+// mediaURLs are the media URLs of a generation response.
+type mediaURLs struct {
+	OutputURL    string `json:"output_url"`
+	ThumbnailURL string `json:"thumbnail_url"`
+}
+
+// seedMedia stores one generation whose files are on this server and one
+// whose files the provider hosts, and returns their IDs.
+func seedMedia(t *testing.T, a *apptest.App, email string) (local, hosted uint) {
+	t.Helper()
+	id := userID(t, a, email)
+	generations := []models.Generation{
+		{UserID: id, Type: models.TypeMusic, Status: models.StatusCompleted, Title: "local", Prompt: "p",
+			OutputURL: "/uploads/audio/42.mp3", ThumbnailURL: "/uploads/images/42.jpg"},
+		{UserID: id, Type: models.TypeVideo, Status: models.StatusCompleted, Title: "hosted", Prompt: "p",
+			OutputURL: "https://cdn.minimax.io/out/43.mp4", ThumbnailURL: "https://cdn.minimax.io/out/43.jpg"},
+	}
+	if err := a.DB.Create(&generations).Error; err != nil {
+		t.Fatal(err)
+	}
+	return generations[0].ID, generations[1].ID
+}
+
+// getMedia fetches the generation id with the given request headers.
+func getMedia(t *testing.T, a *apptest.App, token string, id uint, headers map[string]string) mediaURLs {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/generations/"+strconv.FormatUint(uint64(id), 10), nil)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp := a.Do(req)
+	defer resp.Body.Close()
+	var body struct {
+		Generation mediaURLs `json:"generation"`
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET generation %d: status %d", id, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	return body.Generation
+}
+
+var hostedMedia = mediaURLs{"https://cdn.minimax.io/out/43.mp4", "https://cdn.minimax.io/out/43.jpg"}
+
+func TestMediaURLsWithConfiguredBase(t *testing.T) {
+	a := apptest.New(t, func(s *apptest.Setup) { s.PublicBaseURL = "https://api.example.com" })
+	token := a.Login("base@example.com", "Str0ng!Passw0rd#")
+	local, hosted := seedMedia(t, a, "base@example.com")
+
+	// A proxy's headers don't override the configured base.
+	proxied := map[string]string{fiber.HeaderXForwardedProto: "http", fiber.HeaderXForwardedHost: "internal.example.net"}
+	for name, headers := range map[string]map[string]string{"direct": nil, "proxied": proxied} {
+		want := mediaURLs{"https://api.example.com/uploads/audio/42.mp3", "https://api.example.com/uploads/images/42.jpg"}
+		if got := getMedia(t, a, token, local, headers); got != want {
+			t.Errorf("%s, stored on this server: %+v, want %+v", name, got, want)
+		}
+		if got := getMedia(t, a, token, hosted, headers); got != hostedMedia {
+			t.Errorf("%s, hosted by the provider: %+v, want %+v", name, got, hostedMedia)
+		}
+	}
+}
+
+func TestMediaURLsBehindProxy(t *testing.T) {
+	a := apptest.New(t, apptest.WithRedis)
+	token := a.Login("proxied@example.com", "Str0ng!Passw0rd#")
+	local, hosted := seedMedia(t, a, "proxied@example.com")
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    mediaURLs
+	}{
+		{"direct", nil,
+			mediaURLs{"http://example.com/uploads/audio/42.mp3", "http://example.com/uploads/images/42.jpg"}},
+		{"proxied", map[string]string{fiber.HeaderXForwardedProto: "https", fiber.HeaderXForwardedHost: "api.example.com"},
+			mediaURLs{"https://api.example.com/uploads/audio/42.mp3", "https://api.example.com/uploads/images/42.jpg"}},
+		{"another host", map[string]string{fiber.HeaderXForwardedProto: "https", fiber.HeaderXForwardedHost: "media.example.org"},
+			mediaURLs{"https://media.example.org/uploads/audio/42.mp3", "https://media.example.org/uploads/images/42.jpg"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getMedia(t, a, token, local, tt.headers); got != tt.want {
+				t.Errorf("stored on this server: %+v, want %+v", got, tt.want)
+			}
+			if got := getMedia(t, a, token, hosted, tt.headers); got != hostedMedia {
+				t.Errorf("hosted by the provider: %+v, want %+v", got, hostedMedia)
+			}
+
+			// The list is cached, but never served to another host.
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/generations?sort=oldest", nil)
+			req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			resp := a.Do(req)
+			defer resp.Body.Close()
+			var list struct {
+				Generations []mediaURLs `json:"generations"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+				t.Fatal(err)
+			}
+			if len(list.Generations) != 2 || list.Generations[0] != tt.want || list.Generations[1] != hostedMedia {
+				t.Errorf("list: %+v, want %+v then %+v", list.Generations, tt.want, hostedMedia)
+			}
+		})
+	}
+}
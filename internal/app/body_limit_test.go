@@ -0,0 +1,39 @@
+package app_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/zesbe/lumina-ai/internal/app/apptest"
+)
+
+func TestLoginRejectsOversizedBody(t *testing.T) {
+	a := apptest.New(t)
+
+	body, _ := json.Marshal(map[string]string{
+		"email":    "someone@example.com",
+		"password": strings.Repeat("x", 2<<20),
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp := a.Do(req)
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status %d, want 413", resp.StatusCode)
+	}
+	var got struct {
+		Code  string `json:"code"`
+		Limit int64  `json:"limit"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Code != "PAYLOAD_TOO_LARGE" || got.Limit != a.Config.JSONBodyLimit {
+		t.Errorf("got %+v, want PAYLOAD_TOO_LARGE with limit %d", got, a.Config.JSONBodyLimit)
+	}
+}
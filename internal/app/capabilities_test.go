@@ -0,0 +1,107 @@
+package app_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/zesbe/lumina-ai/internal/app/apptest"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+// planError is the body of a refused generate request.
+type planError struct {
+	Code         string `json:"code"`
+	Field        string `json:"field"`
+	RequiredPlan string `json:"required_plan"`
+}
+
+func TestPlanBoundaries(t *testing.T) {
+	a := apptest.New(t)
+	tokens := map[string]string{}
+	for _, plan := range []string{"free", "basic", "pro"} {
+		email := plan + "@example.com"
+		tokens[plan] = a.Login(email, "Str0ng!Passw0rd#")
+		a.DB.Model(&models.User{}).Where("email = ?", email).Updates(map[string]interface{}{"plan": plan, "credits": 10000})
+	}
+
+	video := func(opts map[string]interface{}) map[string]interface{} {
+		body := map[string]interface{}{"prompt": "A lighthouse at dusk, waves rolling in"}
+		for k, v := range opts {
+			body[k] = v
+		}
+		return body
+	}
+	music := func(opts map[string]interface{}) map[string]interface{} {
+		body := map[string]interface{}{"prompt": "Warm acoustic folk song", "lyrics": "[verse]\nThe road runs home tonight"}
+		for k, v := range opts {
+			body[k] = v
+		}
+		return body
+	}
+
+	// Demo mode completes a generation in the response.
+	const ok = http.StatusOK
+	tests := []struct {
+		name       string
+		plan       string
+		path       string
+		body       map[string]interface{}
+		wantStatus int
+		wantField  string
+		wantPlan   string
+	}{
+		{"free video defaults", "free", "/api/v1/video/generate", video(nil), ok, "", ""},
+		{"free at its highest resolution", "free", "/api/v1/video/generate", video(map[string]interface{}{"resolution": "768P", "duration": 6}), ok, "", ""},
+		{"free over its resolution", "free", "/api/v1/video/generate", video(map[string]interface{}{"resolution": "1080P"}), http.StatusForbidden, "resolution", "basic"},
+		{"free over its duration", "free", "/api/v1/video/generate", video(map[string]interface{}{"duration": 10}), http.StatusForbidden, "duration", "basic"},
+		{"free with a paid model", "free", "/api/v1/video/generate", video(map[string]interface{}{"model": "MiniMax-Hailuo-02"}), http.StatusForbidden, "model", "basic"},
+		{"basic at its limits", "basic", "/api/v1/video/generate", video(map[string]interface{}{"model": "MiniMax-Hailuo-02", "resolution": "1080P", "duration": 10}), ok, "", ""},
+		{"no plan renders 4K", "pro", "/api/v1/video/generate", video(map[string]interface{}{"resolution": "4K"}), http.StatusBadRequest, "", ""},
+		{"no plan renders 20s", "pro", "/api/v1/video/generate", video(map[string]interface{}{"duration": 20}), http.StatusBadRequest, "", ""},
+		{"unknown model", "pro", "/api/v1/video/generate", video(map[string]interface{}{"model": "video-99"}), http.StatusBadRequest, "", ""},
+		{"free at its highest bitrate", "free", "/api/v1/music/generate", music(map[string]interface{}{"bitrate": 256000}), ok, "", ""},
+		{"free over its bitrate", "free", "/api/v1/music/generate", music(map[string]interface{}{"bitrate": 320000}), http.StatusForbidden, "bitrate", "basic"},
+		{"basic at its highest bitrate", "basic", "/api/v1/music/generate", music(map[string]interface{}{"bitrate": 320000}), ok, "", ""},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Each request differs, so none is taken for a repeat of another.
+			tt.body["title"] = fmt.Sprintf("boundary %d", i)
+			var resp planError
+			status := a.JSON(http.MethodPost, tt.path, tokens[tt.plan], tt.body, &resp)
+			if status != tt.wantStatus {
+				t.Fatalf("status %d (%+v), want %d", status, resp, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusForbidden &&
+				(resp.Code != "PLAN_UPGRADE_REQUIRED" || resp.Field != tt.wantField || resp.RequiredPlan != tt.wantPlan) {
+				t.Errorf("refusal %+v, want PLAN_UPGRADE_REQUIRED on %s naming %s", resp, tt.wantField, tt.wantPlan)
+			}
+		})
+	}
+}
+
+// TestPlanChangeAppliesAtOnce checks that the plan is read fresh, not
+// taken from the token issued under the old one.
+func TestPlanChangeAppliesAtOnce(t *testing.T) {
+	a := apptest.New(t)
+	token := a.Login("upgrader@example.com", "Str0ng!Passw0rd#")
+	body := map[string]interface{}{"prompt": "A lighthouse at dusk, waves rolling in", "resolution": "1080P"}
+
+	if status := a.JSON(http.MethodPost, "/api/v1/video/generate", token, body, nil); status != http.StatusForbidden {
+		t.Fatalf("free: status %d, want 403", status)
+	}
+	a.DB.Model(&models.User{}).Where("email = ?", "upgrader@example.com").Update("plan", "basic")
+	var caps struct {
+		Plan         string `json:"plan"`
+		Capabilities struct {
+			MaxResolution string `json:"max_resolution"`
+		} `json:"capabilities"`
+	}
+	if status := a.JSON(http.MethodGet, "/api/v1/capabilities", token, nil, &caps); status != http.StatusOK || caps.Plan != "basic" || caps.Capabilities.MaxResolution != "1080P" {
+		t.Errorf("capabilities: status %d, %+v; want basic with 1080P", status, caps)
+	}
+	if status := a.JSON(http.MethodPost, "/api/v1/video/generate", token, body, nil); status != http.StatusOK {
+		t.Errorf("after upgrading with the same token: status %d, want 200", status)
+	}
+}
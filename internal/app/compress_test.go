@@ -0,0 +1,89 @@
+package app_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/zesbe/lumina-ai/internal/app/apptest"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+func TestCompressesLargeLists(t *testing.T) {
+	a := apptest.New(t)
+	token := a.Login("lister@example.com", "Str0ng!Passw0rd#")
+	owner := userID(t, a, "lister@example.com")
+	seeded := make([]models.Generation, 100)
+	for i := range seeded {
+		seeded[i] = models.Generation{
+			UserID: owner, Type: models.TypeMusic, Status: models.StatusCompleted,
+			Title: fmt.Sprintf("Track %d", i), Prompt: "Warm acoustic folk song with a slow build", Style: "folk",
+		}
+	}
+	if err := a.DB.Create(&seeded).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(path, encoding string) (*http.Response, []byte) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+		if encoding != "" {
+			req.Header.Set(fiber.HeaderAcceptEncoding, encoding)
+		}
+		resp := a.Do(req)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s (%s): status %d", path, encoding, resp.StatusCode)
+		}
+		return resp, body
+	}
+
+	const list = "/api/v1/generations?limit=100"
+	resp, plain := get(list, "")
+	if got := resp.Header.Get(fiber.HeaderContentEncoding); got != "" {
+		t.Errorf("without Accept-Encoding: Content-Encoding %q", got)
+	}
+	if !bytes.Contains(plain, []byte(`"title":"Track 99"`)) {
+		t.Fatalf("the list is missing seeded generations: %d bytes", len(plain))
+	}
+
+	for _, encoding := range []string{"gzip", "br"} {
+		resp, body := get(list, encoding)
+		if got := resp.Header.Get(fiber.HeaderContentEncoding); got != encoding {
+			t.Errorf("%s: Content-Encoding %q", encoding, got)
+		}
+		// The repeated fields compress to well under a quarter.
+		if len(body)*4 > len(plain) {
+			t.Errorf("%s: %d bytes for %d uncompressed", encoding, len(body), len(plain))
+		}
+		if encoding != "gzip" {
+			continue
+		}
+		r, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		unzipped, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(unzipped, plain) {
+			t.Error("gzip: the body doesn't decompress to the plain one")
+		}
+	}
+
+	// Small bodies are sent as they are.
+	if resp, _ := get("/health/live", "gzip"); resp.Header.Get(fiber.HeaderContentEncoding) != "" {
+		t.Errorf("small body: Content-Encoding %q", resp.Header.Get(fiber.HeaderContentEncoding))
+	}
+}
@@ -0,0 +1,98 @@
+package app_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/zesbe/lumina-ai/internal/app/apptest"
+	"github.com/zesbe/lumina-ai/internal/middleware"
+)
+
+func TestCSRFOnCookieSessions(t *testing.T) {
+	a := apptest.New(t)
+	token := a.Login("csrf@example.com", "Str0ng!Passw0rd#")
+
+	var issued struct {
+		CSRFToken string `json:"csrf_token"`
+	}
+	resp := a.Do(httptest.NewRequest(http.MethodGet, "/api/v1/auth/csrf-token", nil))
+	if err := json.NewDecoder(resp.Body).Decode(&issued); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	var cookie *http.Cookie
+	for _, c := range resp.Cookies() {
+		if c.Name == middleware.CSRFCookieName {
+			cookie = c
+		}
+	}
+	if resp.StatusCode != http.StatusOK || issued.CSRFToken == "" || cookie == nil || cookie.Value != issued.CSRFToken {
+		t.Fatalf("csrf-token: status %d, body token %q, cookie %v", resp.StatusCode, issued.CSRFToken, cookie)
+	}
+	if !cookie.HttpOnly || cookie.SameSite != http.SameSiteStrictMode {
+		t.Errorf("csrf cookie %+v, want HttpOnly and SameSite=Strict", cookie)
+	}
+
+	tests := []struct {
+		name        string
+		bearer      bool
+		header      string
+		cookie      string
+		wantStatus  int
+		wantRefused bool
+	}{
+		{name: "cookie session without token", wantStatus: http.StatusForbidden, wantRefused: true},
+		{name: "cookie session with only the cookie", cookie: issued.CSRFToken, wantStatus: http.StatusForbidden, wantRefused: true},
+		{name: "cookie session with a wrong header", header: "x" + issued.CSRFToken, cookie: issued.CSRFToken, wantStatus: http.StatusForbidden, wantRefused: true},
+		{name: "cookie session with the token", header: issued.CSRFToken, cookie: issued.CSRFToken, wantStatus: http.StatusOK},
+		{name: "bearer token", bearer: true, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(map[string]string{"name": "Renamed User"})
+			req := httptest.NewRequest(http.MethodPut, "/api/v1/profile", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.bearer {
+				req.Header.Set("Authorization", "Bearer "+token)
+			} else {
+				req.AddCookie(&http.Cookie{Name: middleware.AccessTokenCookie, Value: token})
+			}
+			if tt.header != "" {
+				req.Header.Set(middleware.CSRFHeader, tt.header)
+			}
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: middleware.CSRFCookieName, Value: tt.cookie})
+			}
+			resp := a.Do(req)
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if !tt.wantRefused {
+				return
+			}
+			var got struct {
+				Code string `json:"code"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Code != "CSRF_FAILED" {
+				t.Errorf("code = %q, want CSRF_FAILED", got.Code)
+			}
+		})
+	}
+
+	// Reads need no token even on a cookie session.
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/profile", nil)
+	req.AddCookie(&http.Cookie{Name: middleware.AccessTokenCookie, Value: token})
+	resp = a.Do(req)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET profile on a cookie session: status %d, want 200", resp.StatusCode)
+	}
+}
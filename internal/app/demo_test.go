@@ -0,0 +1,73 @@
+package app_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/zesbe/lumina-ai/internal/app/apptest"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+func TestDemoMode(t *testing.T) {
+	a := apptest.New(t)
+	token := a.Login("demo@example.com", "Str0ng!Passw0rd#")
+	owner := userID(t, a, "demo@example.com")
+	admin := a.Login("ops@example.com", "Str0ng!Passw0rd#")
+	a.DB.Model(&models.User{}).Where("id = ?", userID(t, a, "ops@example.com")).Update("role", "admin")
+	before := credits(t, a, "demo@example.com")
+
+	var demo struct {
+		Generation struct {
+			generated
+			IsDemo bool `json:"is_demo"`
+		} `json:"generation"`
+	}
+	if status := a.JSON(http.MethodPost, "/api/v1/music/generate", token, map[string]interface{}{
+		"title": "Placeholder", "prompt": "Warm acoustic folk song", "lyrics": "[verse]\nThe road runs home tonight",
+	}, &demo); status != http.StatusOK {
+		t.Fatalf("generate: status %d", status)
+	}
+	if g := demo.Generation; !g.IsDemo || g.Status != string(models.StatusCompleted) || g.CreditsCost != 0 {
+		t.Errorf("demo generation %+v, want completed, is_demo and free", g)
+	}
+	if after := credits(t, a, "demo@example.com"); after != before {
+		t.Errorf("credits %d after a demo generate, want %d", after, before)
+	}
+	var charged int64
+	a.DB.Model(&models.CreditTransaction{}).Where("user_id = ?", owner).Count(&charged)
+	if charged != 0 {
+		t.Errorf("%d credit transactions for a demo generate, want none", charged)
+	}
+
+	// Published, a demo generation still stays off Explore.
+	if status := a.JSON(http.MethodPost, fmt.Sprintf("/api/v1/generations/%d/public", demo.Generation.ID), token, nil, nil); status != http.StatusOK {
+		t.Fatalf("publish: status %d", status)
+	}
+	real := models.Generation{UserID: owner, Type: models.TypeMusic, Status: models.StatusCompleted, Title: "Real", Prompt: "p", IsPublic: true}
+	if err := a.DB.Create(&real).Error; err != nil {
+		t.Fatal(err)
+	}
+	var explore struct {
+		Generations []struct {
+			ID uint `json:"id"`
+		} `json:"generations"`
+	}
+	if status := a.JSON(http.MethodGet, "/api/v1/explore", "", nil, &explore); status != http.StatusOK {
+		t.Fatalf("explore: status %d", status)
+	}
+	if len(explore.Generations) != 1 || explore.Generations[0].ID != real.ID {
+		t.Errorf("explore = %+v, want only generation %d", explore.Generations, real.ID)
+	}
+
+	// The instance stats count only the real one.
+	var stats struct {
+		LastHour map[string]int64 `json:"generations_last_hour"`
+	}
+	if status := a.JSON(http.MethodGet, "/api/v1/stats", admin, nil, &stats); status != http.StatusOK {
+		t.Fatalf("stats: status %d", status)
+	}
+	if got := stats.LastHour[string(models.StatusCompleted)]; got != 1 {
+		t.Errorf("completed in the last hour = %d, want 1", got)
+	}
+}
@@ -0,0 +1,47 @@
+package app_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/zesbe/lumina-ai/internal/app/apptest"
+	"github.com/zesbe/lumina-ai/internal/crypto"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+// An account flagged by the lowercasing migration keeps its address, the
+// same as the older account's, but signing in with it reaches the older
+// one only.
+func TestEmailConflictLeftOutOfLogin(t *testing.T) {
+	a := apptest.New(t)
+	create := func(name, password string) *models.User {
+		t.Helper()
+		hash, err := crypto.HashPassword(password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		u := &models.User{Email: "shared@example.com", PasswordHash: hash, Name: name, Role: "user", IsActive: true, IsVerified: true}
+		if err := a.DB.Create(u).Error; err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+	// The flagged row comes first, so a lookup that doesn't skip it finds
+	// it before the account that kept the address.
+	flagged := create("Flagged", "Fl4gged!Passw0rd#")
+	kept := create("Kept", "K3pt!Passw0rd#")
+	if err := a.DB.Model(flagged).Update("email_conflict_with", kept.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	login := func(password string) int {
+		t.Helper()
+		return a.JSON(http.MethodPost, "/api/v1/auth/login", "", map[string]string{"email": "Shared@Example.com", "password": password}, nil)
+	}
+	if status := login("K3pt!Passw0rd#"); status != http.StatusOK {
+		t.Errorf("kept account: status %d, want 200", status)
+	}
+	if status := login("Fl4gged!Passw0rd#"); status != http.StatusUnauthorized {
+		t.Errorf("flagged account: status %d, want 401", status)
+	}
+}
@@ -0,0 +1,54 @@
+package app_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/zesbe/lumina-ai/internal/app/apptest"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+func TestExplorePlayCounts(t *testing.T) {
+	a := apptest.New(t)
+	token := a.Login("player@example.com", "Str0ng!Passw0rd#")
+	owner := userID(t, a, "player@example.com")
+	public := models.Generation{UserID: owner, Type: models.TypeMusic, Status: models.StatusCompleted, Title: "Played", Prompt: "secret prompt", IsPublic: true}
+	private := models.Generation{UserID: owner, Type: models.TypeMusic, Status: models.StatusCompleted, Title: "Private", Prompt: "p"}
+	if err := a.DB.Create(&[]*models.Generation{&public, &private}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	play := func(id uint) int {
+		t.Helper()
+		return a.JSON(http.MethodPost, fmt.Sprintf("/api/v1/explore/%d/play", id), "", nil, nil)
+	}
+	for i := 0; i < 3; i++ {
+		if status := play(public.ID); status != http.StatusNoContent {
+			t.Fatalf("play: status %d, want 204", status)
+		}
+	}
+	if status := play(private.ID); status != http.StatusNotFound {
+		t.Errorf("playing a private generation: status %d, want 404", status)
+	}
+
+	var explore struct {
+		Generations []map[string]json.RawMessage `json:"generations"`
+	}
+	if status := a.JSON(http.MethodGet, "/api/v1/explore", "", nil, &explore); status != http.StatusOK || len(explore.Generations) != 1 {
+		t.Fatalf("explore: status %d, %d generations", status, len(explore.Generations))
+	}
+	item := explore.Generations[0]
+	if got := string(item["counts"]); got != `{"plays":3}` {
+		t.Errorf("counts = %s, want 3 plays", got)
+	}
+	if _, ok := item["prompt"]; ok {
+		t.Error("explore shows the prompt")
+	}
+
+	status, resp := graphql(t, a, token, `{ publicFeed { items { title counts { plays } } } }`, nil)
+	if status != http.StatusOK || len(resp.Errors) > 0 || string(resp.Data) != `{"publicFeed":{"items":[{"counts":{"plays":3},"title":"Played"}]}}` {
+		t.Errorf("publicFeed: status %d, data %s, errors %+v", status, resp.Data, resp.Errors)
+	}
+}
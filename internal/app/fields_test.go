@@ -0,0 +1,105 @@
+package app_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/zesbe/lumina-ai/internal/app/apptest"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+// fieldsPage is a page of a list asked for with ?fields=.
+type fieldsPage struct {
+	Code        string                       `json:"code"`
+	Generations []map[string]json.RawMessage `json:"generations"`
+	Pagination  struct {
+		Page  int   `json:"page"`
+		Total int64 `json:"total"`
+	} `json:"pagination"`
+}
+
+// keys lists the fields of each item, sorted and comma-separated.
+func (p fieldsPage) keys() []string {
+	var out []string
+	for _, item := range p.Generations {
+		var names []string
+		for name := range item {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		out = append(out, strings.Join(names, ","))
+	}
+	return out
+}
+
+func TestListFields(t *testing.T) {
+	a := apptest.New(t, apptest.WithRedis)
+	token := a.Login("fields@example.com", "Str0ng!Passw0rd#")
+	owner := userID(t, a, "fields@example.com")
+	for i := 0; i < 5; i++ {
+		g := models.Generation{UserID: owner, Type: models.TypeMusic, Status: models.StatusCompleted, Title: fmt.Sprintf("Track %d", i), Prompt: "p", IsPublic: true}
+		if err := a.DB.Create(&g).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list := func(path string) (int, fieldsPage) {
+		t.Helper()
+		var page fieldsPage
+		status := a.JSON(http.MethodGet, path, token, nil, &page)
+		return status, page
+	}
+
+	t.Run("unknown field", func(t *testing.T) {
+		for _, path := range []string{"/api/v1/generations?fields=id,nope", "/api/v1/explore?fields=title,prompt", "/api/v1/generations?view=tiny"} {
+			if status, page := list(path); status != http.StatusBadRequest || page.Code != "VALIDATION_FAILED" {
+				t.Errorf("%s: status %d code %q, want 400 VALIDATION_FAILED", path, status, page.Code)
+			}
+		}
+	})
+
+	t.Run("with pagination", func(t *testing.T) {
+		for _, path := range []string{"/api/v1/generations", "/api/v1/explore"} {
+			status, page := list(path + "?fields=title,id&limit=2&page=3")
+			if status != http.StatusOK || page.Pagination.Page != 3 || page.Pagination.Total != 5 {
+				t.Fatalf("%s: status %d, pagination %+v", path, status, page.Pagination)
+			}
+			if got := page.keys(); len(got) != 1 || got[0] != "id,title" {
+				t.Errorf("%s: last page fields %v, want one item with id,title", path, got)
+			}
+		}
+	})
+
+	t.Run("part of the cache key", func(t *testing.T) {
+		// The full list is cached first; a subset must not be served from it,
+		// nor the full list from the subset's entry.
+		const path = "/api/v1/generations?limit=5"
+		if status, page := list(path); status != http.StatusOK || len(page.Generations) != 5 || len(page.Generations[0]) <= 2 {
+			t.Fatalf("full list: status %d, %d items", status, len(page.Generations))
+		}
+		for _, fields := range []string{"id,title", "title,id,id"} {
+			if _, page := list(path + "&fields=" + fields); len(page.keys()) != 5 || page.keys()[0] != "id,title" {
+				t.Errorf("fields=%s: %v, want id,title", fields, page.keys())
+			}
+		}
+		if _, page := list(path); len(page.Generations[0]) <= 2 {
+			t.Errorf("full list after a subset: %v", page.keys()[0])
+		}
+
+		// Order and duplicates don't change the key.
+		prefix := fmt.Sprintf("generations:%d:1:5:", owner)
+		var keys []string
+		for _, key := range a.Redis.Keys() {
+			if strings.HasPrefix(key, prefix) {
+				keys = append(keys, key)
+			}
+		}
+		if len(keys) != 2 {
+			t.Errorf("cached lists %v, want the full one and one subset", keys)
+		}
+	})
+}
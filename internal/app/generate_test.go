@@ -0,0 +1,229 @@
+package app_test
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/zesbe/lumina-ai/internal/app/apptest"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+type generated struct {
+	ID           uint   `json:"id"`
+	Status       string `json:"status"`
+	OutputURL    string `json:"output_url"`
+	ThumbnailURL string `json:"thumbnail_url"`
+	ErrorMessage string `json:"error_message"`
+	CreditsCost  int    `json:"credits_cost"`
+}
+
+// generateMusic posts a music generate request and returns its status and
+// body.
+func generateMusic(t *testing.T, a *apptest.App, token, prompt string) (int, generated, uint, string) {
+	t.Helper()
+	var body struct {
+		Generation  generated `json:"generation"`
+		DuplicateOf uint      `json:"duplicate_of"`
+		Code        string    `json:"code"`
+	}
+	status := a.JSON(http.MethodPost, "/api/v1/music/generate", token, map[string]interface{}{
+		"title": "Road home", "prompt": prompt, "lyrics": "[verse]\nThe road runs home tonight",
+	}, &body)
+	return status, body.Generation, body.DuplicateOf, body.Code
+}
+
+// awaitGeneration polls the generation until it leaves processing.
+func awaitGeneration(t *testing.T, a *apptest.App, token string, id uint) generated {
+	t.Helper()
+	var body struct {
+		Generation generated `json:"generation"`
+	}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if status := a.JSON(http.MethodGet, "/api/v1/generations/"+strconv.FormatUint(uint64(id), 10), token, nil, &body); status != http.StatusOK {
+			t.Fatalf("GET generation %d: status %d", id, status)
+		}
+		if body.Generation.Status != string(models.StatusProcessing) {
+			return body.Generation
+		}
+	}
+	t.Fatalf("generation %d still processing", id)
+	return body.Generation
+}
+
+func credits(t *testing.T, a *apptest.App, email string) int {
+	t.Helper()
+	var user models.User
+	if err := a.DB.Where("email = ?", email).First(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user.Credits
+}
+
+// TestGenerateMusicJob runs a generate request the way production does,
+// through its background job against a fake MiniMax: register, log in,
+// generate, see the duplicate click collapsed, list, and drain.
+func TestGenerateMusicJob(t *testing.T) {
+	a := apptest.New(t, apptest.WithRedis, apptest.WithMiniMax)
+	token := a.Login("job@example.com", "Str0ng!Passw0rd#")
+	before := credits(t, a, "job@example.com")
+
+	release := a.MiniMax.Hold()
+	status, first, _, _ := generateMusic(t, a, token, "Warm acoustic folk song")
+	if status != http.StatusAccepted || first.Status != string(models.StatusProcessing) {
+		t.Fatalf("generate: status %d, generation %+v; want 202 and processing", status, first)
+	}
+
+	// A second click while the first is running gets the same generation.
+	status, again, duplicateOf, _ := generateMusic(t, a, token, "Warm   acoustic folk song")
+	if status != http.StatusOK || duplicateOf != first.ID || again.ID != first.ID {
+		t.Fatalf("duplicate: status %d, generation %d, duplicate_of %d; want 200 and %d", status, again.ID, duplicateOf, first.ID)
+	}
+
+	var list struct {
+		Generations []generated `json:"generations"`
+	}
+	if status := a.JSON(http.MethodGet, "/api/v1/generations", token, nil, &list); status != http.StatusOK ||
+		len(list.Generations) != 1 || list.Generations[0].Status != string(models.StatusProcessing) {
+		t.Fatalf("list while running: status %d, %+v; want the one processing generation", status, list.Generations)
+	}
+
+	release()
+	done := awaitGeneration(t, a, token, first.ID)
+	if done.Status != string(models.StatusCompleted) || done.OutputURL != a.MiniMax.URL+"/files/music.mp3" ||
+		done.ThumbnailURL != a.MiniMax.URL+"/files/cover.jpg" {
+		t.Fatalf("finished generation %+v, want it completed with the fake's outputs", done)
+	}
+	if n := a.MiniMax.Calls("/v1/music_generation"); n != 1 {
+		t.Errorf("MiniMax asked for %d tracks, want 1", n)
+	}
+	if got := credits(t, a, "job@example.com"); got != before-done.CreditsCost || done.CreditsCost == 0 {
+		t.Errorf("credits %d after a generation costing %d, started with %d", got, done.CreditsCost, before)
+	}
+
+	// The list cached while the job ran is dropped just after the job
+	// records its outcome.
+	listed := ""
+	for deadline := time.Now().Add(5 * time.Second); listed != string(models.StatusCompleted) && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if status := a.JSON(http.MethodGet, "/api/v1/generations", token, nil, &list); status != http.StatusOK || len(list.Generations) != 1 {
+			t.Fatalf("list after the job: status %d, %+v; want the one generation", status, list.Generations)
+		}
+		listed = list.Generations[0].Status
+	}
+	if listed != string(models.StatusCompleted) {
+		t.Errorf("list after the job still shows the generation %s", listed)
+	}
+
+	// Shutdown cancels a job still waiting on MiniMax once the grace period
+	// runs out; it fails without a charge and no new one starts.
+	a.MiniMax.Hold()
+	charged := credits(t, a, "job@example.com")
+	status, cut, _, _ := generateMusic(t, a, token, "Slow piano ballad in the rain")
+	if status != http.StatusAccepted {
+		t.Fatalf("generate before shutdown: status %d", status)
+	}
+	a.Handlers.Drain(50 * time.Millisecond)
+	if got := awaitGeneration(t, a, token, cut.ID); got.Status != string(models.StatusFailed) || got.ErrorMessage != "Interrupted by server shutdown" {
+		t.Errorf("generation cut off by shutdown: %+v", got)
+	}
+	if got := credits(t, a, "job@example.com"); got != charged {
+		t.Errorf("credits %d after an interrupted generation, want %d", got, charged)
+	}
+	if status, _, _, code := generateMusic(t, a, token, "Anything at all, after the drain"); status != http.StatusServiceUnavailable || code != "SHUTTING_DOWN" {
+		t.Errorf("generate after shutdown began: status %d code %s, want 503 SHUTTING_DOWN", status, code)
+	}
+}
+
+// TestForceFailStopsJob has support fail a generation while its job waits
+// on MiniMax: the job is cancelled and neither completes the generation
+// nor charges for it.
+func TestForceFailStopsJob(t *testing.T) {
+	a := apptest.New(t, apptest.WithMiniMax)
+	token := a.Login("stuck@example.com", "Str0ng!Passw0rd#")
+	admin := a.Login("support@example.com", "Str0ng!Passw0rd#")
+	a.DB.Model(&models.User{}).Where("email = ?", "support@example.com").Update("role", "admin")
+	before := credits(t, a, "stuck@example.com")
+
+	release := a.MiniMax.Hold()
+	status, gen, _, _ := generateMusic(t, a, token, "Slow drone that never ends")
+	if status != http.StatusAccepted {
+		t.Fatalf("generate: status %d", status)
+	}
+
+	path := "/api/v1/admin/generations/" + strconv.FormatUint(uint64(gen.ID), 10) + "/fail"
+	if status := a.JSON(http.MethodPost, path, admin, map[string]string{"reason": "stuck"}, nil); status != http.StatusOK {
+		t.Fatalf("force-fail: status %d", status)
+	}
+	release()
+	// Drain returns once every job has ended.
+	a.Handlers.Drain(5 * time.Second)
+
+	var stored models.Generation
+	if err := a.DB.First(&stored, gen.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != models.StatusFailed || stored.ErrorMessage != "Failed by support: stuck" || stored.OutputURL != "" {
+		t.Errorf("generation after its job ended: status %s, error %q, output %q; want it failed by support",
+			stored.Status, stored.ErrorMessage, stored.OutputURL)
+	}
+	if got := credits(t, a, "stuck@example.com"); got != before {
+		t.Errorf("credits %d after a force-failed generation, want %d", got, before)
+	}
+	// The job gave up on the track, so it never went on to the cover.
+	if n := a.MiniMax.Calls("/v1/image_generation"); n != 0 {
+		t.Errorf("the stopped job asked MiniMax for %d covers, want none", n)
+	}
+	if status := a.JSON(http.MethodPost, path, admin, map[string]string{"reason": "again"}, nil); status != http.StatusConflict {
+		t.Errorf("second force-fail: status %d, want 409", status)
+	}
+}
+
+// TestDuplicateWithDefaultsSpelledOut checks that a request leaving out a
+// default and one spelling it out count as the same request.
+func TestDuplicateWithDefaultsSpelledOut(t *testing.T) {
+	a := apptest.New(t, apptest.WithMiniMax)
+	token := a.Login("defaults@example.com", "Str0ng!Passw0rd#")
+	a.MiniMax.Hold()
+
+	music := map[string]interface{}{"prompt": "Warm acoustic folk song", "lyrics": "[verse]\nThe road runs home tonight"}
+	video := map[string]interface{}{"prompt": "A slow pan over the harbour at dawn"}
+	tests := []struct {
+		name     string
+		path     string
+		body     map[string]interface{}
+		explicit map[string]interface{}
+	}{
+		{"music format", "/api/v1/music/generate", music, map[string]interface{}{"format": "mp3"}},
+		{"music model and bitrate", "/api/v1/music/generate", music, map[string]interface{}{"model": "music-2.0", "bitrate": 256000}},
+		{"video settings", "/api/v1/video/generate", video, map[string]interface{}{
+			"model": "video-01", "duration": 6, "resolution": "768P", "aspect_ratio": "16:9",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var first, second struct {
+				Generation  generated `json:"generation"`
+				DuplicateOf uint      `json:"duplicate_of"`
+			}
+			// The title keeps each case apart from the others.
+			left := map[string]interface{}{"title": tt.name}
+			for k, v := range tt.body {
+				left[k] = v
+			}
+			if status := a.JSON(http.MethodPost, tt.path, token, left, &first); status != http.StatusAccepted {
+				t.Fatalf("first request: status %d", status)
+			}
+			body := map[string]interface{}{}
+			for k, v := range left {
+				body[k] = v
+			}
+			for k, v := range tt.explicit {
+				body[k] = v
+			}
+			if status := a.JSON(http.MethodPost, tt.path, token, body, &second); status != http.StatusOK || second.DuplicateOf != first.Generation.ID {
+				t.Errorf("with the defaults spelled out: status %d, duplicate_of %d; want 200 and %d", status, second.DuplicateOf, first.Generation.ID)
+			}
+		})
+	}
+}
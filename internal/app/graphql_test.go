@@ -0,0 +1,257 @@
+package app_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/zesbe/lumina-ai/internal/app/apptest"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+type graphqlResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string                 `json:"message"`
+		Extensions map[string]interface{} `json:"extensions"`
+	} `json:"errors"`
+}
+
+// graphql posts query to the GraphQL endpoint and returns the status and
+// response.
+func graphql(t *testing.T, a *apptest.App, token, query string, variables map[string]interface{}) (int, graphqlResponse) {
+	t.Helper()
+	var resp graphqlResponse
+	status := a.JSON(http.MethodPost, "/api/v1/graphql", token, map[string]interface{}{"query": query, "variables": variables}, &resp)
+	return status, resp
+}
+
+func userID(t *testing.T, a *apptest.App, email string) uint {
+	t.Helper()
+	var user models.User
+	if err := a.DB.Where("email = ?", email).First(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user.ID
+}
+
+func TestGraphQLDashboardQueries(t *testing.T) {
+	a := apptest.New(t)
+	token := a.Login("dashboard@example.com", "Str0ng!Passw0rd#")
+	a.Login("ana@example.com", "Str0ng!Passw0rd#")
+	a.Login("budi@example.com", "Str0ng!Passw0rd#")
+	me, ana, budi := userID(t, a, "dashboard@example.com"), userID(t, a, "ana@example.com"), userID(t, a, "budi@example.com")
+	a.DB.Model(&models.User{}).Where("id = ?", ana).Update("name", "Ana")
+	a.DB.Model(&models.User{}).Where("id = ?", budi).Update("name", "Budi")
+
+	start := time.Now().Add(-time.Hour)
+	generations := []models.Generation{
+		{UserID: me, Type: models.TypeMusic, Status: models.StatusCompleted, Title: "Mine, favorite", Prompt: "p", IsFavorite: true, CreatedAt: start},
+		{UserID: me, Type: models.TypeVideo, Status: models.StatusFailed, Title: "Mine, failed", Prompt: "p", CreatedAt: start.Add(time.Minute)},
+		{UserID: ana, Type: models.TypeMusic, Status: models.StatusCompleted, Title: "Ana 1", Prompt: "p", IsPublic: true, CreatedAt: start.Add(2 * time.Minute)},
+		{UserID: ana, Type: models.TypeMusic, Status: models.StatusCompleted, Title: "Ana 2", Prompt: "p", IsPublic: true, CreatedAt: start.Add(3 * time.Minute)},
+		{UserID: budi, Type: models.TypeVideo, Status: models.StatusCompleted, Title: "Budi", Prompt: "p", IsPublic: true, CreatedAt: start.Add(4 * time.Minute)},
+		{UserID: budi, Type: models.TypeVideo, Status: models.StatusCompleted, Title: "Budi, private", Prompt: "p", CreatedAt: start.Add(5 * time.Minute)},
+	}
+	if err := a.DB.Create(&generations).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := a.DB.Create(&[]models.CreditTransaction{
+		{UserID: me, Amount: -5, Type: "usage", Description: "older", BalanceBefore: 100, BalanceAfter: 95, CreatedAt: start},
+		{UserID: me, Amount: 5, Type: "refund", Description: "newer", BalanceBefore: 95, BalanceAfter: 100, CreatedAt: start.Add(time.Minute)},
+		{UserID: ana, Amount: -5, Type: "usage", Description: "not mine", CreatedAt: start},
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	status, resp := graphql(t, a, token, `query Dashboard($status: GenerationStatus) {
+		me { user { email } stats { generations { total by_type { key count } } favorites } }
+		favorites: generations(favorite: true) { items { title is_favorite } pagination { total } }
+		failed: generations(status: $status, limit: 5) { items { title type } }
+		creditTransactions(limit: 1) { items { description amount } pagination { total total_pages } }
+		publicFeed(sort: oldest) { items { title creator { name } } pagination { total } }
+	}`, map[string]interface{}{"status": "failed"})
+	if status != http.StatusOK || len(resp.Errors) > 0 {
+		t.Fatalf("status %d, errors %+v", status, resp.Errors)
+	}
+
+	type counted struct {
+		Key   string `json:"key"`
+		Count int    `json:"count"`
+	}
+	var data struct {
+		Me struct {
+			User struct {
+				Email string `json:"email"`
+			} `json:"user"`
+			Stats struct {
+				Generations struct {
+					Total  int       `json:"total"`
+					ByType []counted `json:"by_type"`
+				} `json:"generations"`
+				Favorites int `json:"favorites"`
+			} `json:"stats"`
+		} `json:"me"`
+		Favorites struct {
+			Items []struct {
+				Title      string `json:"title"`
+				IsFavorite bool   `json:"is_favorite"`
+			} `json:"items"`
+			Pagination struct {
+				Total int `json:"total"`
+			} `json:"pagination"`
+		} `json:"favorites"`
+		Failed struct {
+			Items []struct {
+				Title string `json:"title"`
+				Type  string `json:"type"`
+			} `json:"items"`
+		} `json:"failed"`
+		CreditTransactions struct {
+			Items []struct {
+				Description string `json:"description"`
+				Amount      int    `json:"amount"`
+			} `json:"items"`
+			Pagination struct {
+				Total      int `json:"total"`
+				TotalPages int `json:"total_pages"`
+			} `json:"pagination"`
+		} `json:"creditTransactions"`
+		PublicFeed struct {
+			Items []struct {
+				Title   string `json:"title"`
+				Creator struct {
+					Name string `json:"name"`
+				} `json:"creator"`
+			} `json:"items"`
+			Pagination struct {
+				Total int `json:"total"`
+			} `json:"pagination"`
+		} `json:"publicFeed"`
+	}
+	if err := json.Unmarshal(resp.Data, &data); err != nil {
+		t.Fatal(err)
+	}
+
+	if data.Me.User.Email != "dashboard@example.com" {
+		t.Errorf("me.user.email = %q", data.Me.User.Email)
+	}
+	stats := data.Me.Stats
+	wantByType := []counted{{"music", 1}, {"video", 1}}
+	if stats.Generations.Total != 2 || stats.Favorites != 1 || len(stats.Generations.ByType) != 2 ||
+		stats.Generations.ByType[0] != wantByType[0] || stats.Generations.ByType[1] != wantByType[1] {
+		t.Errorf("me.stats = %+v, want 2 generations by type %v and 1 favorite", stats, wantByType)
+	}
+	if len(data.Favorites.Items) != 1 || data.Favorites.Items[0].Title != "Mine, favorite" || !data.Favorites.Items[0].IsFavorite || data.Favorites.Pagination.Total != 1 {
+		t.Errorf("favorites = %+v", data.Favorites)
+	}
+	if len(data.Failed.Items) != 1 || data.Failed.Items[0].Title != "Mine, failed" || data.Failed.Items[0].Type != "video" {
+		t.Errorf("failed = %+v", data.Failed)
+	}
+	ledger := data.CreditTransactions
+	if len(ledger.Items) != 1 || ledger.Items[0].Description != "newer" || ledger.Items[0].Amount != 5 ||
+		ledger.Pagination.Total != 2 || ledger.Pagination.TotalPages != 2 {
+		t.Errorf("creditTransactions = %+v, want the newer of the caller's 2 on a page of 1", ledger)
+	}
+	var feed []string
+	for _, item := range data.PublicFeed.Items {
+		feed = append(feed, item.Title+" by "+item.Creator.Name)
+	}
+	if want := []string{"Ana 1 by Ana", "Ana 2 by Ana", "Budi by Budi"}; len(feed) != len(want) || feed[0] != want[0] || feed[1] != want[1] || feed[2] != want[2] {
+		t.Errorf("publicFeed = %v, want %v", feed, want)
+	}
+
+	// generation(id) only finds the caller's own.
+	for _, tt := range []struct {
+		id   uint
+		want string
+	}{
+		{generations[0].ID, `{"generation":{"title":"Mine, favorite"}}`},
+		{generations[2].ID, `{"generation":null}`},
+	} {
+		status, resp := graphql(t, a, token, `query($id: ID!) { generation(id: $id) { title } }`, map[string]interface{}{"id": tt.id})
+		if status != http.StatusOK || len(resp.Errors) > 0 || string(resp.Data) != tt.want {
+			t.Errorf("generation(%d): status %d, data %s, errors %+v; want %s", tt.id, status, resp.Data, resp.Errors, tt.want)
+		}
+	}
+}
+
+func TestGraphQLBatchesCreators(t *testing.T) {
+	a := apptest.New(t)
+	token := a.Login("feed@example.com", "Str0ng!Passw0rd#")
+	var creators []uint
+	for _, email := range []string{"one@example.com", "two@example.com", "three@example.com"} {
+		a.Login(email, "Str0ng!Passw0rd#")
+		creators = append(creators, userID(t, a, email))
+	}
+	var public []models.Generation
+	for i := 0; i < 9; i++ {
+		public = append(public, models.Generation{UserID: creators[i%3], Type: models.TypeMusic, Status: models.StatusCompleted, Title: "public", Prompt: "p", IsPublic: true})
+	}
+	if err := a.DB.Create(&public).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var userQueries int
+	a.DB.Callback().Query().After("gorm:query").Register("test:count_user_queries", func(tx *gorm.DB) {
+		if tx.Statement.Table == "users" {
+			userQueries++
+		}
+	})
+	count := func(query string) int {
+		t.Helper()
+		userQueries = 0
+		if status, resp := graphql(t, a, token, query, nil); status != http.StatusOK || len(resp.Errors) > 0 {
+			t.Fatalf("status %d, errors %+v", status, resp.Errors)
+		}
+		return userQueries
+	}
+
+	// Authenticating the request may read the user too; the creators
+	// must add one query however many items there are.
+	without := count(`{ publicFeed { items { title } } }`)
+	with := count(`{ publicFeed { items { title creator { name } } } }`)
+	if with != without+1 {
+		t.Errorf("%d user queries with creators, %d without; want one more for the page", with, without)
+	}
+}
+
+func TestGraphQLRefusals(t *testing.T) {
+	a := apptest.New(t)
+	token := a.Login("refused@example.com", "Str0ng!Passw0rd#")
+
+	if status, _ := graphql(t, a, "", `{ me { user { email } } }`, nil); status != http.StatusUnauthorized {
+		t.Errorf("without a token: status %d, want 401", status)
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "syntax error", query: `{ me {`, wantStatus: 400, wantCode: "BAD_REQUEST"},
+		{name: "unknown field", query: `{ me { password } }`, wantStatus: 400, wantCode: "BAD_REQUEST"},
+		{name: "mutation", query: `mutation { me { user { email } } }`, wantStatus: 400, wantCode: "BAD_REQUEST"},
+		{name: "too complex", query: `{ generations(limit: 100) { items {
+			id type status title prompt lyrics narration voice_id style duration resolution model
+			output_url thumbnail_url error_message credits_cost is_favorite is_public created_at } } }`,
+			wantStatus: 400, wantCode: "BAD_REQUEST"},
+		{name: "limit past the REST maximum", query: `{ generations(limit: 500) { items { id } } }`, wantStatus: 200, wantCode: "VALIDATION_FAILED"},
+		{name: "bad generation ID", query: `{ generation(id: "abc") { id } }`, wantStatus: 200, wantCode: "BAD_REQUEST"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, resp := graphql(t, a, token, tt.query, nil)
+			if status != tt.wantStatus || len(resp.Errors) == 0 {
+				t.Fatalf("status %d, errors %+v; want %d with errors", status, resp.Errors, tt.wantStatus)
+			}
+			if code := resp.Errors[0].Extensions["code"]; code != tt.wantCode {
+				t.Errorf("code %v (%s), want %s", code, resp.Errors[0].Message, tt.wantCode)
+			}
+		})
+	}
+}
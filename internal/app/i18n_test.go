@@ -0,0 +1,71 @@
+package app_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/zesbe/lumina-ai/internal/app/apptest"
+)
+
+func TestLocalizedValidationErrors(t *testing.T) {
+	a := apptest.New(t)
+
+	type detail struct {
+		Field   string `json:"field"`
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	tests := []struct {
+		name           string
+		query          string
+		acceptLanguage string
+		wantMessage    string
+		wantDetail     detail
+	}{
+		{name: "english by default",
+			wantMessage: "Some fields are invalid",
+			wantDetail:  detail{"password", "password_uppercase", "Password must contain at least one uppercase letter"}},
+		{name: "indonesian from accept-language", acceptLanguage: "id-ID,id;q=0.9,en;q=0.8",
+			wantMessage: "Beberapa kolom tidak valid",
+			wantDetail:  detail{"password", "password_uppercase", "Kata sandi harus mengandung minimal satu huruf kapital"}},
+		{name: "lang query overrides the header", query: "?lang=en", acceptLanguage: "id-ID",
+			wantMessage: "Some fields are invalid",
+			wantDetail:  detail{"password", "password_uppercase", "Password must contain at least one uppercase letter"}},
+		{name: "unsupported locale falls back to english", acceptLanguage: "fr-FR,fr;q=0.9",
+			wantMessage: "Some fields are invalid",
+			wantDetail:  detail{"password", "password_uppercase", "Password must contain at least one uppercase letter"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(map[string]string{"email": "weak@example.com", "password": "weakpassw0rd!", "name": "Weak"})
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/register"+tt.query, bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.acceptLanguage != "" {
+				req.Header.Set("Accept-Language", tt.acceptLanguage)
+			}
+			resp := a.Do(req)
+			defer resp.Body.Close()
+
+			var got struct {
+				Code    string   `json:"code"`
+				Message string   `json:"message"`
+				Details []detail `json:"details"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != http.StatusBadRequest || got.Code != "VALIDATION_FAILED" {
+				t.Fatalf("status %d code %q, want 400 VALIDATION_FAILED", resp.StatusCode, got.Code)
+			}
+			if got.Message != tt.wantMessage {
+				t.Errorf("message %q, want %q", got.Message, tt.wantMessage)
+			}
+			if len(got.Details) != 1 || got.Details[0] != tt.wantDetail {
+				t.Errorf("details %+v, want [%+v]", got.Details, tt.wantDetail)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package app_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/zesbe/lumina-ai/internal/app/apptest"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+var linkPart = regexp.MustCompile(`<([^>]*)>; rel="([a-z]+)"`)
+
+// pageLinks reads a Link header into its URLs by rel.
+func pageLinks(header string) map[string]string {
+	links := map[string]string{}
+	for _, m := range linkPart.FindAllStringSubmatch(header, -1) {
+		links[m[2]] = m[1]
+	}
+	return links
+}
+
+func TestLinkHeaderRoundTrip(t *testing.T) {
+	a := apptest.New(t)
+	token := a.Login("pager@example.com", "Str0ng!Passw0rd#")
+	owner := userID(t, a, "pager@example.com")
+	for i := 0; i < 7; i++ {
+		g := models.Generation{UserID: owner, Type: models.TypeMusic, Status: models.StatusCompleted, Title: fmt.Sprintf("Track %d", i), Prompt: "p"}
+		if err := a.DB.Create(&g).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	get := func(url string) map[string]string {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+		resp := a.Do(req)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: status %d", url, resp.StatusCode)
+		}
+		return pageLinks(resp.Header.Get(fiber.HeaderLink))
+	}
+
+	// Follow next from the first page; the filters ride along.
+	const first = "/api/v1/generations?type=music&limit=3"
+	url, visited := first, 0
+	var links map[string]string
+	for {
+		links = get(url)
+		visited++
+		if visited > 5 {
+			t.Fatal("next never ran out")
+		}
+		for rel, link := range links {
+			if !strings.Contains(link, "type=music") || !strings.Contains(link, "limit=3") {
+				t.Errorf("page %d: %s link %q dropped the filters", visited, rel, link)
+			}
+		}
+		next, ok := links["next"]
+		if !ok {
+			break
+		}
+		url = next
+	}
+
+	if visited != 3 {
+		t.Errorf("visited %d pages, want 3", visited)
+	}
+	if !strings.Contains(links["last"], "page=3") || url != links["last"] {
+		t.Errorf("last page %q, link last %q", url, links["last"])
+	}
+	if !strings.Contains(links["prev"], "page=2") {
+		t.Errorf("last page prev %q, want page 2", links["prev"])
+	}
+	if !strings.Contains(links["first"], "page=1") {
+		t.Errorf("last page first %q, want page 1", links["first"])
+	}
+
+	// And back: prev from the last page leads to the first, which has none.
+	links = get(links["prev"])
+	if !strings.Contains(links["prev"], "page=1") {
+		t.Fatalf("page 2 prev %q, want page 1", links["prev"])
+	}
+	if links = get(links["prev"]); links["prev"] != "" || links["next"] == "" {
+		t.Errorf("page 1 links %v, want next and no prev", links)
+	}
+}
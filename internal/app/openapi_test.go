@@ -0,0 +1,22 @@
+package app_test
+
+import (
+	"testing"
+
+	"github.com/zesbe/lumina-ai/internal/app/apptest"
+	"github.com/zesbe/lumina-ai/internal/openapi"
+)
+
+// TestRoutesDocumented keeps internal/openapi in step with the routes:
+// every route registered needs an operation, and every operation a route.
+func TestRoutesDocumented(t *testing.T) {
+	a := apptest.New(t)
+	routes := a.GetRoutes(true)
+
+	for _, route := range openapi.Undocumented(routes) {
+		t.Errorf("%s is served but missing from internal/openapi", route)
+	}
+	for _, op := range openapi.Unserved(routes) {
+		t.Errorf("%s is documented in internal/openapi but not served", op)
+	}
+}
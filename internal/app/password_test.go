@@ -0,0 +1,37 @@
+package app_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/zesbe/lumina-ai/internal/app/apptest"
+)
+
+// TestPasswordChangeRefusesOldTokens runs without Redis, so nothing but the
+// time the password changed refuses the old access token.
+func TestPasswordChangeRefusesOldTokens(t *testing.T) {
+	a := apptest.New(t)
+	// Start on a fresh second so the login and the change share it; only
+	// the fraction of a second orders them.
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+	old := a.Login("changer@example.com", "Str0ng!Passw0rd#")
+
+	var changed struct {
+		Tokens tokenPair `json:"tokens"`
+	}
+	body := map[string]string{"current_password": "Str0ng!Passw0rd#", "new_password": "N3w!Str0ngPassw0rd"}
+	if status := a.JSON(http.MethodPost, "/api/v1/profile/change-password", old, body, &changed); status != http.StatusOK || changed.Tokens.AccessToken == "" {
+		t.Fatalf("change password: status %d", status)
+	}
+
+	var refused struct {
+		Code string `json:"code"`
+	}
+	if status := a.JSON(http.MethodGet, "/api/v1/profile", old, nil, &refused); status != http.StatusUnauthorized || refused.Code != "INVALID_TOKEN" {
+		t.Errorf("old token right after the change: status %d code %s, want 401 INVALID_TOKEN", status, refused.Code)
+	}
+	if status := a.JSON(http.MethodGet, "/api/v1/profile", changed.Tokens.AccessToken, nil, nil); status != http.StatusOK {
+		t.Errorf("token issued with the change: status %d, want 200", status)
+	}
+}
@@ -0,0 +1,51 @@
+package app_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/zesbe/lumina-ai/internal/app/apptest"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+func TestProfilingIsAdminOnly(t *testing.T) {
+	a := apptest.New(t)
+	admin := a.Login("profiler@example.com", "Str0ng!Passw0rd#")
+	a.DB.Model(&models.User{}).Where("id = ?", userID(t, a, "profiler@example.com")).Update("role", "admin")
+	user := a.Login("curious@example.com", "Str0ng!Passw0rd#")
+
+	tests := []struct {
+		name       string
+		token      string
+		wantStatus int
+	}{
+		{"admin", admin, http.StatusOK},
+		{"user", user, http.StatusForbidden},
+		{"anonymous", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/debug/pprof/goroutine?debug=1", nil)
+			if tt.token != "" {
+				req.Header.Set(fiber.HeaderAuthorization, "Bearer "+tt.token)
+			}
+			resp := a.Do(req)
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			want := tt.wantStatus == http.StatusOK
+			if got := strings.Contains(string(body), "goroutine profile:"); got != want {
+				t.Errorf("profile in the body = %v, want %v", got, want)
+			}
+		})
+	}
+}
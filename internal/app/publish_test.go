@@ -0,0 +1,127 @@
+package app_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/zesbe/lumina-ai/internal/app/apptest"
+	"github.com/zesbe/lumina-ai/internal/models"
+	"github.com/zesbe/lumina-ai/internal/settings"
+)
+
+func TestPublishFilter(t *testing.T) {
+	a := apptest.New(t)
+	admin := a.Login("moderator@example.com", "Str0ng!Passw0rd#")
+	a.DB.Model(&models.User{}).Where("id = ?", userID(t, a, "moderator@example.com")).Update("role", "admin")
+	token := a.Login("publisher@example.com", "Str0ng!Passw0rd#")
+	owner := userID(t, a, "publisher@example.com")
+
+	// The lists are managed through the settings endpoint, which refuses
+	// entries that don't compile.
+	filters := func(hard ...string) map[string]interface{} {
+		return map[string]interface{}{"publish_filters": map[string]settings.PublishFilter{"en": {Hard: hard, Soft: []string{"damn"}}}}
+	}
+	if status := a.JSON(http.MethodPut, "/api/v1/admin/settings", admin, filters("/(/"), nil); status != http.StatusBadRequest {
+		t.Errorf("invalid entry: status %d, want 400", status)
+	}
+	if status := a.JSON(http.MethodPut, "/api/v1/admin/settings", admin, filters("shit"), nil); status != http.StatusOK {
+		t.Fatalf("put settings: status %d", status)
+	}
+
+	create := func(title string) uint {
+		t.Helper()
+		g := models.Generation{UserID: owner, Type: models.TypeMusic, Status: models.StatusCompleted, Title: title, Prompt: "p"}
+		if err := a.DB.Create(&g).Error; err != nil {
+			t.Fatal(err)
+		}
+		return g.ID
+	}
+	publish := func(id uint) (int, string) {
+		t.Helper()
+		var body struct {
+			Code string `json:"code"`
+		}
+		return a.JSON(http.MethodPost, fmt.Sprintf("/api/v1/generations/%d/public", id), token, nil, &body), body.Code
+	}
+	stored := func(id uint) models.Generation {
+		t.Helper()
+		var g models.Generation
+		if err := a.DB.First(&g, id).Error; err != nil {
+			t.Fatal(err)
+		}
+		return g
+	}
+	explore := func() []string {
+		t.Helper()
+		var body struct {
+			Generations []struct {
+				Title string `json:"title"`
+			} `json:"generations"`
+		}
+		if status := a.JSON(http.MethodGet, "/api/v1/explore", "", nil, &body); status != http.StatusOK {
+			t.Fatalf("explore: status %d", status)
+		}
+		var titles []string
+		for _, g := range body.Generations {
+			titles = append(titles, g.Title)
+		}
+		return titles
+	}
+
+	blocked := create("Sh1iiit storm")
+	if status, code := publish(blocked); status != http.StatusUnprocessableEntity || code != "PUBLISH_BLOCKED" {
+		t.Errorf("hard match: status %d code %s, want 422 PUBLISH_BLOCKED", status, code)
+	}
+	if stored(blocked).IsPublic {
+		t.Error("blocked generation went public")
+	}
+
+	held := create("D4mn fine")
+	if status, _ := publish(held); status != http.StatusOK {
+		t.Fatalf("soft match: status %d", status)
+	}
+	if g := stored(held); !g.IsPublic || g.ModerationStatus != models.ModerationPendingReview {
+		t.Errorf("soft match stored public %v with status %q, want public and pending review", g.IsPublic, g.ModerationStatus)
+	}
+
+	// Like bulk publish, only a finished generation can go public.
+	unfinished := models.Generation{UserID: owner, Type: models.TypeMusic, Status: models.StatusProcessing, Title: "Half done", Prompt: "p"}
+	if err := a.DB.Create(&unfinished).Error; err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := publish(unfinished.ID); status != http.StatusConflict {
+		t.Errorf("processing: status %d, want 409", status)
+	}
+	if stored(unfinished.ID).IsPublic {
+		t.Error("processing generation went public")
+	}
+
+	clean := create("Sunday morning")
+	if status, _ := publish(clean); status != http.StatusOK {
+		t.Fatalf("clean: status %d", status)
+	}
+	if titles := explore(); len(titles) != 1 || titles[0] != "Sunday morning" {
+		t.Errorf("explore = %v, want only the clean generation", titles)
+	}
+
+	// Renaming a public generation is checked too.
+	rename := func(id uint, title string) int {
+		t.Helper()
+		return a.JSON(http.MethodPatch, fmt.Sprintf("/api/v1/generations/%d", id), token, map[string]string{"title": title}, nil)
+	}
+	if status := rename(clean, "s.h.i.t"); status != http.StatusUnprocessableEntity {
+		t.Errorf("hard rename: status %d, want 422", status)
+	}
+	if g := stored(clean); g.Title != "Sunday morning" {
+		t.Errorf("title after a blocked rename = %q", g.Title)
+	}
+
+	// An admin's approval lets the held one onto Explore.
+	if status := a.JSON(http.MethodPost, fmt.Sprintf("/api/v1/admin/generations/%d/approve", held), admin, nil, nil); status != http.StatusOK {
+		t.Fatalf("approve: status %d", status)
+	}
+	if titles := explore(); len(titles) != 2 {
+		t.Errorf("explore after approval = %v, want both", titles)
+	}
+}
@@ -0,0 +1,87 @@
+package app_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/zesbe/lumina-ai/internal/app/apptest"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+type tokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+func TestRefreshTokenReuseEndsSession(t *testing.T) {
+	// The access tokens of a revoked session are denied through Redis.
+	a := apptest.New(t, apptest.WithRedis)
+
+	a.Login("reuse@example.com", "Str0ng!Passw0rd#")
+	var login struct {
+		Tokens tokenPair `json:"tokens"`
+	}
+	creds := map[string]string{"email": "reuse@example.com", "password": "Str0ng!Passw0rd#"}
+	if status := a.JSON(http.MethodPost, "/api/v1/auth/login", "", creds, &login); status != http.StatusOK {
+		t.Fatalf("login: status %d", status)
+	}
+	// A second session, which the reuse mustn't touch.
+	var other struct {
+		Tokens tokenPair `json:"tokens"`
+	}
+	if status := a.JSON(http.MethodPost, "/api/v1/auth/login", "", creds, &other); status != http.StatusOK {
+		t.Fatalf("second login: status %d", status)
+	}
+
+	refresh := func(token string) (int, tokenPair, string) {
+		t.Helper()
+		var body struct {
+			Tokens tokenPair `json:"tokens"`
+			Code   string    `json:"code"`
+		}
+		status := a.JSON(http.MethodPost, "/api/v1/auth/refresh", "", map[string]string{"refresh_token": token}, &body)
+		return status, body.Tokens, body.Code
+	}
+	profile := func(token string) int {
+		t.Helper()
+		return a.JSON(http.MethodGet, "/api/v1/profile", token, nil, nil)
+	}
+
+	status, rotated, _ := refresh(login.Tokens.RefreshToken)
+	if status != http.StatusOK || rotated.RefreshToken == "" || rotated.RefreshToken == login.Tokens.RefreshToken {
+		t.Fatalf("refresh: status %d, tokens %+v", status, rotated)
+	}
+	if status := profile(rotated.AccessToken); status != http.StatusOK {
+		t.Fatalf("profile with the rotated access token: status %d", status)
+	}
+
+	// Presenting the consumed token again ends the session at once.
+	if status, _, code := refresh(login.Tokens.RefreshToken); status != http.StatusUnauthorized || code != "INVALID_TOKEN" {
+		t.Fatalf("reused refresh token: status %d code %s, want 401 INVALID_TOKEN", status, code)
+	}
+	if status, _, _ := refresh(rotated.RefreshToken); status != http.StatusUnauthorized {
+		t.Errorf("rotated refresh token after reuse: status %d, want 401", status)
+	}
+	for name, token := range map[string]string{"first": login.Tokens.AccessToken, "rotated": rotated.AccessToken} {
+		if status := profile(token); status != http.StatusUnauthorized {
+			t.Errorf("%s access token after reuse: status %d, want 401", name, status)
+		}
+	}
+
+	if status := profile(other.Tokens.AccessToken); status != http.StatusOK {
+		t.Errorf("other session's access token: status %d, want 200", status)
+	}
+	if status, _, _ := refresh(other.Tokens.RefreshToken); status != http.StatusOK {
+		t.Errorf("other session's refresh token: status %d, want 200", status)
+	}
+
+	// Audit entries are written in the background.
+	var audited int64
+	for deadline := time.Now().Add(2 * time.Second); audited == 0 && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		a.DB.Model(&models.AuditLog{}).Where("action = ?", models.AuditRefreshTokenReuse).Count(&audited)
+	}
+	if audited != 1 {
+		t.Errorf("%d refresh token reuses audited, want 1", audited)
+	}
+}
@@ -0,0 +1,65 @@
+package app_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/zesbe/lumina-ai/internal/app/apptest"
+	"github.com/zesbe/lumina-ai/internal/crypto"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+func TestLoginRehashesOldPasswords(t *testing.T) {
+	a := apptest.New(t)
+	token := a.Login("rehash@example.com", "Str0ng!Passw0rd#")
+	stored := func() models.User {
+		t.Helper()
+		var user models.User
+		if err := a.DB.Where("email = ?", "rehash@example.com").First(&user).Error; err != nil {
+			t.Fatal(err)
+		}
+		return user
+	}
+	old := stored().PasswordHash
+
+	// The cost is raised, as by a new ARGON2_MEMORY on the next deploy.
+	raised := a.Config.Argon2
+	raised.Memory *= 2
+	crypto.SetPasswordParams(&raised)
+	t.Cleanup(func() { crypto.SetPasswordParams(&a.Config.Argon2) })
+
+	login := func(password string) int {
+		t.Helper()
+		return a.JSON(http.MethodPost, "/api/v1/auth/login", "", map[string]string{"email": "rehash@example.com", "password": password}, nil)
+	}
+
+	if status := login("Wr0ng!Passw0rd#"); status != http.StatusUnauthorized {
+		t.Fatalf("wrong password: status %d", status)
+	}
+	if got := stored().PasswordHash; got != old {
+		t.Fatal("a failed login replaced the hash")
+	}
+
+	if status := login("Str0ng!Passw0rd#"); status != http.StatusOK {
+		t.Fatalf("login: status %d", status)
+	}
+	user := stored()
+	if user.PasswordHash == old || crypto.NeedsRehash(user.PasswordHash) || !strings.Contains(user.PasswordHash, "m=16384,") {
+		t.Fatalf("hash after login %s, want one made with the raised memory", user.PasswordHash)
+	}
+	// The password is the same, so no session ends.
+	if user.PasswordChangedAt != nil {
+		t.Errorf("password_changed_at set to %v by a rehash", user.PasswordChangedAt)
+	}
+	if status := a.JSON(http.MethodGet, "/api/v1/profile", token, nil, nil); status != http.StatusOK {
+		t.Errorf("token from before the rehash: status %d, want 200", status)
+	}
+
+	if status := login("Str0ng!Passw0rd#"); status != http.StatusOK {
+		t.Fatalf("login with the new hash: status %d", status)
+	}
+	if got := stored().PasswordHash; got != user.PasswordHash {
+		t.Error("a current hash was replaced again")
+	}
+}
@@ -0,0 +1,221 @@
+package app
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/zesbe/lumina-ai/internal/apikey"
+	"github.com/zesbe/lumina-ai/internal/config"
+	"github.com/zesbe/lumina-ai/internal/handlers"
+	"github.com/zesbe/lumina-ai/internal/middleware"
+	"github.com/zesbe/lumina-ai/internal/models"
+	"github.com/zesbe/lumina-ai/internal/oauth"
+)
+
+// registerRoutes mounts every route of the API on app, served by h, behind
+// the global middleware New has already added.
+func registerRoutes(app *fiber.App, cfg *config.Config, h *handlers.Handlers) {
+	// Health check
+	app.Get("/health", h.HealthCheck())
+	app.Get("/health/deep", h.DeepHealthCheck())
+	app.Get("/health/live", h.LiveCheck())
+	app.Get("/health/ready", h.ReadyCheck())
+
+	// Keys for other services to verify tokens with
+	app.Get("/.well-known/jwks.json", h.JWKS())
+
+	// API routes. Everything under /api/v1 is JSON; routes that accept file
+	// uploads must be mounted outside this group to get the larger limit.
+	api := app.Group("/api/v1", middleware.BodyLimit(int(cfg.JSONBodyLimit)))
+
+	// Per-route deadlines. The WebSocket route is deliberately left without
+	// one.
+	authTimeout := middleware.Timeout(cfg.AuthTimeout)
+	requestTimeout := middleware.Timeout(cfg.RequestTimeout)
+	generateTimeout := middleware.Timeout(cfg.GenerateTimeout)
+
+	// Public routes
+	auth := api.Group("/auth", authTimeout)
+	auth.Post("/register", middleware.StrictRateLimiter(5, cfg.RateLimitWindow), h.Register())
+	auth.Post("/login", middleware.StrictRateLimiter(10, cfg.RateLimitWindow), h.Login())
+	auth.Post("/refresh", h.RefreshToken())
+	auth.Get("/csrf-token", h.GenerateCSRFToken())
+	auth.Post("/confirm-email-change", middleware.StrictRateLimiter(10, cfg.RateLimitWindow), h.ConfirmEmailChange())
+	auth.Post("/undo-email-change", middleware.StrictRateLimiter(10, cfg.RateLimitWindow), h.UndoEmailChange())
+	auth.Post("/magic-link", middleware.StrictRateLimiter(5, cfg.RateLimitWindow), h.RequestMagicLink())
+	auth.Post("/magic-link/verify", middleware.StrictRateLimiter(10, cfg.RateLimitWindow), h.VerifyMagicLink())
+	auth.Post("/secure-account", middleware.StrictRateLimiter(10, cfg.RateLimitWindow), h.SecureAccount())
+	auth.Post("/verify-email", middleware.StrictRateLimiter(10, cfg.RateLimitWindow), h.VerifyEmail())
+	auth.Post("/resend-verification", middleware.StrictRateLimiter(3, cfg.RateLimitWindow), h.ResendVerification())
+	auth.Post("/cancel-deletion", middleware.StrictRateLimiter(10, cfg.RateLimitWindow), h.CancelDeletion())
+	for _, provider := range []oauth.Provider{
+		oauth.NewGoogle(cfg.GoogleClientID, cfg.GoogleClientSecret, cfg.GoogleRedirectURL),
+		oauth.NewGitHub(cfg.GitHubClientID, cfg.GitHubClientSecret, cfg.GitHubRedirectURL),
+	} {
+		auth.Get("/"+provider.Name(), middleware.StrictRateLimiter(10, cfg.RateLimitWindow), h.OAuthURL(provider))
+		auth.Get("/"+provider.Name()+"/callback", middleware.StrictRateLimiter(10, cfg.RateLimitWindow), h.OAuthCallback(provider))
+	}
+
+	// Public Explore (no auth required)
+	api.Get("/explore", requestTimeout, h.GetPublicGenerations())
+	api.Post("/explore/:id/play", middleware.StrictRateLimiter(30, cfg.RateLimitWindow), h.RecordPlay())
+	api.Get("/music/styles", requestTimeout, h.ListStylePresets())
+	api.Get("/video/templates", requestTimeout, h.ListVideoTemplates())
+	api.Get("/stats/public", h.PublicStats())
+	api.Get("/version", h.GetVersion())
+	api.Get("/openapi.json", h.OpenAPI())
+
+	// Data export bundles; the signed link is the credential
+	api.Get("/exports/:id/download", middleware.StrictRateLimiter(10, cfg.RateLimitWindow), h.DownloadDataExport())
+	api.Get("/media/:id", middleware.StrictRateLimiter(30, cfg.RateLimitWindow), h.GenerationMedia())
+	api.Post("/unsubscribe", middleware.StrictRateLimiter(10, cfg.RateLimitWindow), h.Unsubscribe())
+
+	// Interactive API docs, outside production only
+	if cfg.Environment != "production" {
+		app.Use("/docs", h.SwaggerUI())
+	}
+
+	// Protected routes, for a login or an API key. Routes with
+	// DenyAPIKey need the login.
+	protected := api.Group("/",
+		middleware.APIKeyAuth(cfg.APIKeyRateLimit, time.Minute),
+		middleware.JWTAuth(cfg.JWTKeys, cfg.DenylistFailClosed),
+		middleware.CSRF(middleware.NewCSRFTokens(cfg.JWTSecret)),
+	)
+
+	// WebSocket for real-time updates
+	protected.Use("/ws", h.WebSocketUpgrade())
+	protected.Get("/ws", h.WebSocketHandler())
+
+	// Profile
+	protected.Get("/profile", authTimeout, h.GetProfile())
+	protected.Put("/profile", authTimeout, h.UpdateProfile())
+	protected.Delete("/profile", authTimeout, middleware.DenyAPIKey(), middleware.DenyImpersonation(),
+		middleware.StrictRateLimiter(5, cfg.RateLimitWindow), h.DeleteAccount())
+	protected.Post("/profile/change-password", authTimeout, middleware.DenyAPIKey(), middleware.DenyImpersonation(), h.ChangePassword())
+	protected.Post("/profile/change-email", authTimeout, middleware.DenyAPIKey(), middleware.DenyImpersonation(),
+		middleware.StrictRateLimiter(5, cfg.RateLimitWindow), h.ChangeEmail())
+	protected.Get("/profile/login-history", authTimeout, middleware.DenyAPIKey(), h.LoginHistory())
+	protected.Post("/profile/export", authTimeout, middleware.DenyAPIKey(), middleware.DenyImpersonation(), h.RequestDataExport())
+	protected.Get("/profile/export", authTimeout, middleware.DenyAPIKey(), h.GetDataExport())
+	protected.Get("/profile/notifications", authTimeout, h.GetNotificationPreferences())
+	protected.Put("/profile/notifications", authTimeout, middleware.DenyAPIKey(), h.UpdateNotificationPreferences())
+	protected.Get("/referrals", authTimeout, h.GetReferrals())
+	protected.Get("/stats/me", requestTimeout, h.GetMyStats())
+	protected.Get("/notifications", authTimeout, h.ListNotifications())
+	protected.Post("/notifications/read-all", authTimeout, h.MarkAllNotificationsRead())
+	protected.Post("/notifications/:id/read", authTimeout, h.MarkNotificationRead())
+	protected.Post("/logout", authTimeout, middleware.DenyAPIKey(), h.Logout())
+	protected.Post("/logout-all", authTimeout, middleware.DenyAPIKey(), middleware.DenyImpersonation(), h.LogoutAll())
+	protected.Get("/flags", requestTimeout, h.GetFlags())
+	protected.Get("/capabilities", requestTimeout, h.GetCapabilities())
+	protected.Post("/graphql", requestTimeout, middleware.DenyAPIKey(), h.GraphQL())
+
+	// Sessions
+	sessions := protected.Group("/sessions", authTimeout, middleware.DenyAPIKey(), middleware.DenyImpersonation())
+	sessions.Get("/", h.ListSessions())
+	sessions.Post("/revoke-others", h.RevokeOtherSessions())
+	sessions.Delete("/:id", h.RevokeSession())
+
+	// API keys
+	apiKeys := protected.Group("/api-keys", authTimeout, middleware.DenyAPIKey(), middleware.DenyImpersonation())
+	apiKeys.Get("/", h.ListAPIKeys())
+	apiKeys.Post("/", middleware.RequirePlan(apikey.Plans...), h.CreateAPIKey())
+	apiKeys.Delete("/:id", h.RevokeAPIKey())
+
+	// Generations
+	generations := protected.Group("/generations", requestTimeout)
+	generations.Get("/", h.GetGenerations())
+	generations.Post("/bulk", h.BulkUpdateGenerations())
+	generations.Get("/export", middleware.StrictRateLimiter(2, time.Hour), h.ExportGenerations())
+	generations.Get("/:id", h.GetGeneration())
+	generations.Patch("/:id", h.UpdateGeneration())
+	generations.Delete("/:id", h.DeleteGeneration())
+	generations.Post("/:id/favorite", h.ToggleFavorite())
+	generations.Post("/:id/public", h.TogglePublic())
+	generations.Post("/:id/rerender", h.RerenderGeneration())
+
+	// Saved prompts
+	prompts := protected.Group("/prompts", requestTimeout)
+	prompts.Get("/", h.ListSavedPrompts())
+	prompts.Post("/", h.CreateSavedPrompt())
+	prompts.Get("/history", h.GetPromptHistory())
+	prompts.Get("/:id", h.GetSavedPrompt())
+	prompts.Put("/:id", h.UpdateSavedPrompt())
+	prompts.Delete("/:id", h.DeleteSavedPrompt())
+
+	// Drafts. Submitting one starts a generation, so it goes through the
+	// same gate and deadline as the generate routes.
+	drafts := protected.Group("/drafts")
+	drafts.Get("/", requestTimeout, h.ListDrafts())
+	drafts.Post("/", requestTimeout, h.CreateDraft())
+	drafts.Get("/:id", requestTimeout, h.GetDraft())
+	drafts.Put("/:id", requestTimeout, h.UpdateDraft())
+	drafts.Delete("/:id", requestTimeout, h.DeleteDraft())
+	drafts.Post("/:id/submit", generateTimeout, h.GenerationGate(), h.SubmitDraft())
+
+	// Music Generation
+	music := protected.Group("/music", generateTimeout, h.GenerationGate())
+	music.Post("/generate", h.GenerateMusic())
+
+	// Video Generation
+	video := protected.Group("/video", generateTimeout, h.GenerationGate())
+	video.Post("/generate", h.GenerateVideo())
+
+	// Admin
+	admin := protected.Group("/admin", middleware.DenyAPIKey(), middleware.RequireRole("admin"), requestTimeout)
+	admin.Get("/audit", h.GetAuditLogs())
+	admin.Get("/users/:id/audit", h.GetUserAuditLogs())
+	admin.Get("/analytics", h.GetAnalytics())
+	admin.Get("/maintenance", h.GetMaintenance())
+	admin.Post("/purge", h.RunPurge())
+	admin.Post("/maintenance", h.SetMaintenance())
+	admin.Get("/settings", h.GetSettings())
+	admin.Put("/settings", h.UpdateSettings())
+	admin.Post("/users/:id/credits", h.AdjustUserCredits())
+	admin.Post("/users/:id/promote", h.PromoteUser())
+	admin.Delete("/users/:id/lockout", h.ClearLockout())
+	admin.Post("/impersonate/:userID", h.Impersonate())
+	admin.Get("/transactions/export", h.ExportCreditTransactions())
+	admin.Get("/generations", h.AdminListGenerations())
+	admin.Get("/generations/:id", h.AdminGetGeneration())
+	admin.Post("/generations/:id/fail", h.AdminFailGeneration())
+	admin.Post("/generations/:id/retry", h.GenerationGate(), h.AdminRetryGeneration())
+	admin.Post("/generations/:id/unpublish", h.AdminUnpublishGeneration())
+	admin.Post("/generations/:id/approve", h.AdminApproveGeneration())
+	admin.Get("/flags", h.ListFeatureFlags())
+	admin.Put("/flags/:key", h.UpsertFeatureFlag())
+	admin.Delete("/flags/:key", h.DeleteFeatureFlag())
+	admin.Put("/flags/:key/overrides/:userId", h.SetFeatureFlagOverride())
+	admin.Delete("/flags/:key/overrides/:userId", h.DeleteFeatureFlagOverride())
+	admin.Get("/styles", h.AdminListStylePresets())
+	admin.Put("/styles/:name", h.UpsertStylePreset())
+	admin.Delete("/styles/:name", h.DeleteStylePreset())
+	admin.Get("/video-templates", h.AdminListVideoTemplates())
+	admin.Put("/video-templates/:name", h.UpsertVideoTemplate())
+	admin.Delete("/video-templates/:name", h.DeleteVideoTemplate())
+	admin.Get("/moderation/rules", h.ListModerationRules())
+	admin.Post("/moderation/rules", h.CreateModerationRule())
+	admin.Delete("/moderation/rules/:id", h.DeleteModerationRule())
+	admin.Get("/moderation/blocks", h.GetModerationBlocks())
+	admin.Get("/moderation/queue", h.AdminModerationQueue())
+	admin.Get("/disposable-domains", h.ListDisposableDomains())
+	admin.Post("/disposable-domains", h.SetDisposableDomain())
+	admin.Delete("/disposable-domains/:domain", h.DeleteDisposableDomain())
+	admin.Get("/disposable-domains/blocks", h.GetDisposableBlocks())
+
+	// Stats: full numbers for admins only
+	protected.Get("/stats", requestTimeout, middleware.DenyAPIKey(), middleware.RequireRole("admin"), h.ServerStats())
+
+	// Serve uploaded files
+	if cfg.StorageType == "local" {
+		app.Static("/uploads", cfg.UploadPath, fiber.Static{
+			// Unwatermarked copies of free-plan outputs stay private.
+			Next: func(c *fiber.Ctx) bool {
+				return strings.HasPrefix(c.Path(), models.CleanMediaPrefix)
+			},
+		})
+	}
+}
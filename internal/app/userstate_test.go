@@ -0,0 +1,101 @@
+package app_test
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/zesbe/lumina-ai/internal/app/apptest"
+	"github.com/zesbe/lumina-ai/internal/models"
+	"github.com/zesbe/lumina-ai/internal/userstate"
+)
+
+func TestDeactivatedUserLockedOut(t *testing.T) {
+	a := apptest.New(t, apptest.WithRedis)
+	token := a.Login("deactivated@example.com", "Str0ng!Passw0rd#")
+	id := userID(t, a, "deactivated@example.com")
+
+	profile := func() (int, string) {
+		t.Helper()
+		var body struct {
+			Code string `json:"code"`
+		}
+		return a.JSON(http.MethodGet, "/api/v1/profile", token, nil, &body), body.Code
+	}
+	setActive := func(active bool) {
+		t.Helper()
+		if err := a.DB.Model(&models.User{}).Where("id = ?", id).Update("is_active", active).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The first request caches the state the next ones are checked on.
+	if status, _ := profile(); status != http.StatusOK {
+		t.Fatalf("profile: status %d", status)
+	}
+
+	// Deactivating forgets the cached state, so the very next request
+	// with the same token is refused.
+	setActive(false)
+	userstate.Forget(id)
+	if status, code := profile(); status != http.StatusForbidden || code != "FORBIDDEN" {
+		t.Fatalf("after deactivating: status %d code %s, want 403 FORBIDDEN", status, code)
+	}
+	setActive(true)
+	userstate.Forget(id)
+	if status, _ := profile(); status != http.StatusOK {
+		t.Fatalf("after reactivating: status %d, want 200", status)
+	}
+
+	// An edit made straight in the database is picked up once the cached
+	// state expires, a minute at most.
+	setActive(false)
+	if status, _ := profile(); status != http.StatusOK {
+		t.Fatalf("before the cached state expires: status %d, want 200", status)
+	}
+	a.Redis.FastForward(userstate.CacheTTL)
+	if status, code := profile(); status != http.StatusForbidden || code != "FORBIDDEN" {
+		t.Errorf("after %v: status %d code %s, want 403 FORBIDDEN", userstate.CacheTTL, status, code)
+	}
+
+	// A deleted account's token stops working altogether.
+	if err := a.DB.Unscoped().Delete(&models.User{}, id).Error; err != nil {
+		t.Fatal(err)
+	}
+	userstate.Forget(id)
+	if status, code := profile(); status != http.StatusUnauthorized || code != "INVALID_TOKEN" {
+		t.Errorf("after deleting: status %d code %s, want 401 INVALID_TOKEN", status, code)
+	}
+}
+
+func TestRoleChangeAppliesToIssuedTokens(t *testing.T) {
+	a := apptest.New(t, apptest.WithRedis)
+	admin := a.Login("admin@example.com", "Str0ng!Passw0rd#")
+	a.DB.Model(&models.User{}).Where("id = ?", userID(t, a, "admin@example.com")).Update("role", "admin")
+	token := a.Login("promoted@example.com", "Str0ng!Passw0rd#")
+	id := userID(t, a, "promoted@example.com")
+
+	maintenance := func() int {
+		t.Helper()
+		return a.JSON(http.MethodGet, "/api/v1/admin/maintenance", token, nil, nil)
+	}
+	if status := maintenance(); status != http.StatusForbidden {
+		t.Fatalf("before promotion: status %d, want 403", status)
+	}
+
+	// The token was issued with the user role; promotion applies to it on
+	// the next request all the same.
+	if status := a.JSON(http.MethodPost, "/api/v1/admin/users/"+strconv.FormatUint(uint64(id), 10)+"/promote", admin, nil, nil); status != http.StatusOK {
+		t.Fatalf("promote: status %d", status)
+	}
+	if status := maintenance(); status != http.StatusOK {
+		t.Errorf("after promotion: status %d, want 200", status)
+	}
+
+	// And so does a demotion.
+	a.DB.Model(&models.User{}).Where("id = ?", id).Update("role", "user")
+	userstate.Forget(id)
+	if status := maintenance(); status != http.StatusForbidden {
+		t.Errorf("after demotion: status %d, want 403", status)
+	}
+}
@@ -0,0 +1,143 @@
+package app_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zesbe/lumina-ai/internal/app/apptest"
+	"github.com/zesbe/lumina-ai/internal/crypto"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+// unverify marks email's address unverified again, as it is until the
+// mailed link is followed.
+func unverify(t *testing.T, a *apptest.App, email string) uint {
+	t.Helper()
+	id := userID(t, a, email)
+	if err := a.DB.Model(&models.User{}).Where("id = ?", id).Update("is_verified", false).Error; err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// verifyWith stores a verification link for the user with token, expiring
+// at expires, as a mail would have carried.
+func verifyWith(t *testing.T, a *apptest.App, id uint, token string, expires time.Time) {
+	t.Helper()
+	if err := a.DB.Create(&models.EmailVerification{UserID: id, TokenHash: crypto.HashToken(token), ExpiresAt: expires}).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func verified(t *testing.T, a *apptest.App, id uint) bool {
+	t.Helper()
+	var user models.User
+	if err := a.DB.First(&user, id).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user.IsVerified
+}
+
+func verifyEmail(a *apptest.App, token string) (int, string) {
+	var body struct {
+		Code string `json:"code"`
+	}
+	status := a.JSON(http.MethodPost, "/api/v1/auth/verify-email", "", map[string]string{"token": token}, &body)
+	return status, body.Code
+}
+
+func TestVerifyEmailOnce(t *testing.T) {
+	a := apptest.New(t)
+	a.Login("once@example.com", "Str0ng!Passw0rd#")
+	id := unverify(t, a, "once@example.com")
+	verifyWith(t, a, id, "first-link", time.Now().Add(time.Hour))
+	verifyWith(t, a, id, "second-link", time.Now().Add(time.Hour))
+
+	if status, code := verifyEmail(a, "first-link"); status != http.StatusOK {
+		t.Fatalf("verify: status %d code %s, want 200", status, code)
+	}
+	if !verified(t, a, id) {
+		t.Fatal("address not verified after following the link")
+	}
+
+	// The link is used up, and with it every other link still out.
+	for _, token := range []string{"first-link", "second-link"} {
+		if status, code := verifyEmail(a, token); status != http.StatusBadRequest || code != "INVALID_TOKEN" {
+			t.Errorf("%s again: status %d code %s, want 400 INVALID_TOKEN", token, status, code)
+		}
+	}
+}
+
+func TestVerifyEmailExpired(t *testing.T) {
+	a := apptest.New(t)
+	a.Login("expired@example.com", "Str0ng!Passw0rd#")
+	id := unverify(t, a, "expired@example.com")
+	verifyWith(t, a, id, "stale-link", time.Now().Add(-time.Minute))
+
+	if status, code := verifyEmail(a, "stale-link"); status != http.StatusBadRequest || code != "INVALID_TOKEN" {
+		t.Errorf("expired link: status %d code %s, want 400 INVALID_TOKEN", status, code)
+	}
+	if verified(t, a, id) {
+		t.Error("address verified by an expired link")
+	}
+}
+
+// TestResendVerificationSameAnswer checks resend-verification can't be
+// used to find out which addresses have accounts.
+func TestResendVerificationSameAnswer(t *testing.T) {
+	a := apptest.New(t)
+	a.Login("pending@example.com", "Str0ng!Passw0rd#")
+	id := unverify(t, a, "pending@example.com")
+
+	links := func() int64 {
+		t.Helper()
+		var n int64
+		if err := a.DB.Model(&models.EmailVerification{}).Where("user_id = ?", id).Count(&n).Error; err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	resend := func(email string) (int, string) {
+		t.Helper()
+		var body struct {
+			Message string `json:"message"`
+		}
+		status := a.JSON(http.MethodPost, "/api/v1/auth/resend-verification", "", map[string]string{"email": email}, &body)
+		return status, body.Message
+	}
+
+	before := links()
+	knownStatus, known := resend("pending@example.com")
+	if links() != before+1 {
+		t.Errorf("no new link stored for an account waiting on one")
+	}
+	unknownStatus, unknown := resend("nobody@example.com")
+	// Each answer names the address it was asked about, and nothing more.
+	if knownStatus != http.StatusOK || unknownStatus != knownStatus ||
+		strings.ReplaceAll(known, "pending@example.com", "nobody@example.com") != unknown {
+		t.Errorf("known account: %d %q; unknown: %d %q; want the same 200", knownStatus, known, unknownStatus, unknown)
+	}
+}
+
+func TestGenerateNeedsVerifiedEmail(t *testing.T) {
+	a := apptest.New(t)
+	token := a.Login("unverified@example.com", "Str0ng!Passw0rd#")
+	id := unverify(t, a, "unverified@example.com")
+
+	var body struct {
+		Code string `json:"code"`
+	}
+	status := a.JSON(http.MethodPost, "/api/v1/music/generate", token, map[string]interface{}{
+		"title": "Road home", "prompt": "Warm acoustic folk song", "lyrics": "[verse]\nThe road runs home tonight",
+	}, &body)
+	if status != http.StatusForbidden || body.Code != "EMAIL_NOT_VERIFIED" {
+		t.Errorf("generate: status %d code %s, want 403 EMAIL_NOT_VERIFIED", status, body.Code)
+	}
+	var count int64
+	a.DB.Model(&models.Generation{}).Where("user_id = ?", id).Count(&count)
+	if count != 0 {
+		t.Errorf("%d generations stored for an unverified address", count)
+	}
+}
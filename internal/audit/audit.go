@@ -0,0 +1,212 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"github.com/zesbe/lumina-ai/internal/geoip"
+	"github.com/zesbe/lumina-ai/internal/logger"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+// Target identifies the object an audited action was performed on.
+type Target struct {
+	Type string
+	ID   string
+}
+
+func User(id uint) Target {
+	return Target{Type: "user", ID: strconv.FormatUint(uint64(id), 10)}
+}
+
+func Generation(id uint) Target {
+	return Target{Type: "generation", ID: strconv.FormatUint(uint64(id), 10)}
+}
+
+type recorder struct {
+	db *gorm.DB
+	// entries holds models.AuditLog and models.LoginEvent rows.
+	entries chan interface{}
+	// done is closed once run has written everything queued before
+	// entries was closed.
+	done chan struct{}
+
+	// mu orders enqueueing against Close closing entries.
+	mu     sync.RWMutex
+	closed bool
+}
+
+var rec *recorder
+
+// Init starts the background writer. Until it is called Record only logs.
+func Init(db *gorm.DB) {
+	rec = &recorder{
+		db:      db,
+		entries: make(chan interface{}, 1024),
+		done:    make(chan struct{}),
+	}
+	go rec.run()
+}
+
+// Close stops taking entries and waits up to timeout for the queued ones
+// to be written, so shutdown doesn't lose them; call it before closing the
+// database. It reports whether the queue was written out in time. Entries
+// recorded after Close are only logged.
+func Close(timeout time.Duration) bool {
+	r := rec
+	if r == nil {
+		return true
+	}
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.entries)
+	}
+	r.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-r.done:
+		return true
+	case <-timer.C:
+		logger.L().Error("audit entries not written before shutdown", "pending", len(r.entries))
+		return false
+	}
+}
+
+func (r *recorder) run() {
+	defer close(r.done)
+	for entry := range r.entries {
+		if err := r.db.Create(entry).Error; err != nil {
+			logger.L().Error("failed to write audit log", "entry", describe(entry), "error", err)
+		}
+	}
+}
+
+// Record captures who did what from the request and writes it
+// asynchronously, so auditing never blocks or fails the request. The actor
+// is the authenticated user, if any.
+func Record(c *fiber.Ctx, action models.AuditAction, target Target, meta map[string]interface{}) {
+	var actorID *uint
+	if id, ok := c.Locals("userID").(uint); ok {
+		actorID = &id
+	}
+	RecordAs(c, actorID, action, target, meta)
+}
+
+// RecordAs is Record with an explicit actor, e.g. for failed logins where
+// nobody is authenticated yet.
+func RecordAs(c *fiber.Ctx, actorID *uint, action models.AuditAction, target Target, meta map[string]interface{}) {
+	entry := models.AuditLog{
+		ActorID:    actorID,
+		Action:     action,
+		TargetType: target.Type,
+		TargetID:   target.ID,
+		// Copy out of the fasthttp buffers, which are reused after the
+		// handler returns.
+		IP:        c.IP(),
+		UserAgent: truncate(string(c.Request().Header.UserAgent()), 255),
+		Metadata:  "{}",
+		CreatedAt: time.Now(),
+	}
+	if reqID, ok := c.Locals("requestID").(string); ok {
+		if meta == nil {
+			meta = map[string]interface{}{}
+		}
+		meta["request_id"] = reqID
+	}
+	if adminID, ok := c.Locals("impersonatorID").(uint); ok {
+		if meta == nil {
+			meta = map[string]interface{}{}
+		}
+		meta["impersonator_id"] = adminID
+	}
+	if len(meta) > 0 {
+		if b, err := json.Marshal(meta); err == nil {
+			entry.Metadata = string(b)
+		}
+	}
+
+	enqueue(&entry)
+}
+
+// RecordSystem is Record for actions the server takes on its own, outside
+// any request, such as a background job granting credits. There is no
+// actor, IP or user agent.
+func RecordSystem(action models.AuditAction, target Target, meta map[string]interface{}) {
+	entry := models.AuditLog{
+		Action:     action,
+		TargetType: target.Type,
+		TargetID:   target.ID,
+		Metadata:   "{}",
+		CreatedAt:  time.Now(),
+	}
+	if len(meta) > 0 {
+		if b, err := json.Marshal(meta); err == nil {
+			entry.Metadata = string(b)
+		}
+	}
+
+	enqueue(&entry)
+}
+
+// RecordLogin adds a login attempt to the user's login history, with the
+// IP resolved to a rough location when a GeoIP database is configured.
+// It is written like Record, in the background.
+func RecordLogin(c *fiber.Ctx, userID uint, method, outcome, reason string) {
+	ip := c.IP()
+	enqueue(&models.LoginEvent{
+		UserID:    userID,
+		Method:    method,
+		Outcome:   outcome,
+		Reason:    reason,
+		IP:        ip,
+		Location:  truncate(geoip.Locate(ip), 255),
+		UserAgent: truncate(string(c.Request().Header.UserAgent()), 255),
+		CreatedAt: time.Now(),
+	})
+}
+
+func enqueue(entry interface{}) {
+	r := rec
+	if r == nil {
+		logger.L().Warn("audit recorder not initialized", "entry", describe(entry))
+		return
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.closed {
+		logger.L().Warn("audit recorder closed", "entry", describe(entry))
+		return
+	}
+	select {
+	case r.entries <- entry:
+	default:
+		logger.L().Error("audit queue full, dropping entry", "entry", describe(entry))
+	}
+}
+
+// describe identifies an entry in logs.
+func describe(entry interface{}) string {
+	switch e := entry.(type) {
+	case *models.AuditLog:
+		return fmt.Sprintf("%s on %s %s", e.Action, e.TargetType, e.TargetID)
+	case *models.LoginEvent:
+		return fmt.Sprintf("login %s for user %d", e.Outcome, e.UserID)
+	}
+	return fmt.Sprintf("%T", entry)
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
@@ -0,0 +1,91 @@
+package audit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+func openDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := db.AutoMigrate(&models.AuditLog{}, &models.LoginEvent{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestCloseWritesQueuedEntries(t *testing.T) {
+	db := openDB(t)
+	Init(db)
+	t.Cleanup(func() { rec = nil })
+
+	const n = 200
+	for i := 0; i < n; i++ {
+		RecordSystem(models.AuditPurge, User(uint(i)), map[string]interface{}{"i": i})
+	}
+	if !Close(5 * time.Second) {
+		t.Fatal("Close timed out")
+	}
+
+	var count int64
+	if err := db.Model(&models.AuditLog{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != n {
+		t.Fatalf("%d entries written, want %d", count, n)
+	}
+
+	// Recording after Close is dropped rather than sent on the closed
+	// queue, and closing again is harmless.
+	RecordSystem(models.AuditPurge, User(1), nil)
+	if !Close(time.Second) {
+		t.Fatal("second Close timed out")
+	}
+	if err := db.Model(&models.AuditLog{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != n {
+		t.Fatalf("%d entries after Close, want %d", count, n)
+	}
+}
+
+func TestCloseTimesOut(t *testing.T) {
+	db := openDB(t)
+	Init(db)
+	t.Cleanup(func() { rec = nil })
+
+	// Hold the only connection so the writer can't make progress.
+	tx := db.Begin()
+	if err := tx.Create(&models.AuditLog{Action: models.AuditPurge, Metadata: "{}", CreatedAt: time.Now()}).Error; err != nil {
+		t.Fatal(err)
+	}
+	RecordSystem(models.AuditPurge, User(1), nil)
+	if Close(50 * time.Millisecond) {
+		t.Fatal("Close reported the queue written while the database was blocked")
+	}
+	tx.Rollback()
+}
+
+func TestCloseWithoutInit(t *testing.T) {
+	rec = nil
+	if !Close(time.Millisecond) {
+		t.Fatal("Close without Init should have nothing to wait for")
+	}
+}
@@ -0,0 +1,120 @@
+package audit
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/zesbe/lumina-ai/internal/logger"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+const (
+	retentionInterval  = 24 * time.Hour
+	retentionBatchSize = 1000
+)
+
+// StartRetention prunes entries older than retention once at startup and
+// then daily. When archiveDir is set the pruned rows are first written
+// there as gzipped JSON lines. A retention of zero keeps everything.
+func StartRetention(db *gorm.DB, retention time.Duration, archiveDir string) {
+	if retention <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(retentionInterval)
+		defer ticker.Stop()
+		for {
+			n, err := Prune(context.Background(), db, time.Now().Add(-retention), archiveDir)
+			if err != nil {
+				logger.L().Error("audit retention failed", "error", err)
+			} else if n > 0 {
+				logger.L().Info("pruned audit logs", "count", n, "archived", archiveDir != "")
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// Prune removes entries created before cutoff in batches and returns how
+// many went. Each batch is locked with SKIP LOCKED, so instances running
+// the job at the same time never archive the same row twice.
+func Prune(ctx context.Context, db *gorm.DB, cutoff time.Time, archiveDir string) (int64, error) {
+	var archive *gzip.Writer
+	var closers []func() error
+	openArchive := func() error {
+		if err := os.MkdirAll(archiveDir, 0o750); err != nil {
+			return err
+		}
+		name := fmt.Sprintf("audit-%s-%d.jsonl.gz", time.Now().UTC().Format("20060102-150405"), os.Getpid())
+		f, err := os.OpenFile(filepath.Join(archiveDir, name), os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o640)
+		if err != nil {
+			return err
+		}
+		archive = gzip.NewWriter(f)
+		closers = append(closers, archive.Close, f.Close)
+		return nil
+	}
+	defer func() {
+		for _, closeFn := range closers {
+			closeFn()
+		}
+	}()
+
+	var total int64
+	for {
+		var n int
+		err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			var batch []models.AuditLog
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Where("created_at < ?", cutoff).
+				Order("id").Limit(retentionBatchSize).
+				Find(&batch).Error; err != nil {
+				return err
+			}
+			if len(batch) == 0 {
+				return nil
+			}
+
+			if archiveDir != "" && archive == nil {
+				if err := openArchive(); err != nil {
+					return err
+				}
+			}
+			if archive != nil {
+				enc := json.NewEncoder(archive)
+				for _, entry := range batch {
+					if err := enc.Encode(entry); err != nil {
+						return err
+					}
+				}
+				// Write the batch out before the rows leave the database.
+				if err := archive.Flush(); err != nil {
+					return err
+				}
+			}
+
+			ids := make([]uint, len(batch))
+			for i, entry := range batch {
+				ids[i] = entry.ID
+			}
+			n = len(batch)
+			return tx.Delete(&models.AuditLog{}, ids).Error
+		})
+		if err != nil {
+			return total, err
+		}
+		total += int64(n)
+		if n < retentionBatchSize {
+			return total, nil
+		}
+	}
+}
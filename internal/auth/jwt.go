@@ -13,11 +13,21 @@ var (
 	ErrExpiredToken = errors.New("token has expired")
 )
 
+// Token times carry microseconds, so a token issued just before a password
+// change is told apart from one issued just after it.
+func init() {
+	jwt.TimePrecision = time.Microsecond
+}
+
 type TokenType string
 
 const (
 	AccessToken  TokenType = "access"
 	RefreshToken TokenType = "refresh"
+
+	// ImpersonationExpiry is the lifetime of an impersonation token. There
+	// is no refresh token; the admin starts a new session instead.
+	ImpersonationExpiry = 15 * time.Minute
 )
 
 type Claims struct {
@@ -26,73 +36,103 @@ type Claims struct {
 	Role      string    `json:"role"`
 	Plan      string    `json:"plan"`
 	TokenType TokenType `json:"token_type"`
+	// ImpersonatorID is the admin acting as this user, set only on
+	// impersonation tokens.
+	ImpersonatorID *uint `json:"impersonator_id,omitempty"`
+	// SessionID is the login both tokens of a pair belong to; refresh
+	// tokens are stored and revoked under it.
+	SessionID string `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
+func (c *Claims) IsImpersonation() bool {
+	return c.ImpersonatorID != nil
+}
+
 type TokenPair struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
 	ExpiresAt    int64  `json:"expires_at"`
 	TokenType    string `json:"token_type"`
+
+	// RefreshID and RefreshExpiresAt describe the refresh token for the
+	// server-side record; they are not sent to the client.
+	RefreshID        string    `json:"-"`
+	RefreshExpiresAt time.Time `json:"-"`
 }
 
 type JWTService struct {
-	secret        []byte
+	keys          *Keys
 	accessExpiry  time.Duration
 	refreshExpiry time.Duration
 	issuer        string
 }
 
-func NewJWTService(secret string, accessExpiry, refreshExpiry time.Duration) *JWTService {
+func NewJWTService(keys *Keys, accessExpiry, refreshExpiry time.Duration) *JWTService {
 	return &JWTService{
-		secret:        []byte(secret),
+		keys:          keys,
 		accessExpiry:  accessExpiry,
 		refreshExpiry: refreshExpiry,
 		issuer:        "lumina-ai",
 	}
 }
 
-func (s *JWTService) GenerateTokenPair(userID uint, email, role, plan string) (*TokenPair, error) {
-	accessToken, accessExp, err := s.generateToken(userID, email, role, plan, AccessToken, s.accessExpiry)
+// GenerateTokenPair issues an access and a refresh token for one session.
+func (s *JWTService) GenerateTokenPair(userID uint, email, role, plan, sessionID string) (*TokenPair, error) {
+	accessToken, accessExp, err := s.signToken(&Claims{
+		UserID: userID, Email: email, Role: role, Plan: plan, TokenType: AccessToken, SessionID: sessionID,
+	}, s.accessExpiry)
 	if err != nil {
 		return nil, err
 	}
 
-	refreshToken, _, err := s.generateToken(userID, email, role, plan, RefreshToken, s.refreshExpiry)
+	refreshClaims := &Claims{
+		UserID: userID, Email: email, Role: role, Plan: plan, TokenType: RefreshToken, SessionID: sessionID,
+	}
+	refreshToken, refreshExp, err := s.signToken(refreshClaims, s.refreshExpiry)
 	if err != nil {
 		return nil, err
 	}
 
 	return &TokenPair{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-		ExpiresAt:    accessExp.Unix(),
-		TokenType:    "Bearer",
+		AccessToken:      accessToken,
+		RefreshToken:     refreshToken,
+		ExpiresAt:        accessExp.Unix(),
+		TokenType:        "Bearer",
+		RefreshID:        refreshClaims.ID,
+		RefreshExpiresAt: refreshExp,
 	}, nil
 }
 
-func (s *JWTService) generateToken(userID uint, email, role, plan string, tokenType TokenType, expiry time.Duration) (string, time.Time, error) {
+// GenerateImpersonationToken issues a lone access token for userID that
+// records adminID as the impersonator.
+func (s *JWTService) GenerateImpersonationToken(userID uint, email, role, plan string, adminID uint) (string, time.Time, error) {
+	return s.signToken(&Claims{
+		UserID:         userID,
+		Email:          email,
+		Role:           role,
+		Plan:           plan,
+		TokenType:      AccessToken,
+		ImpersonatorID: &adminID,
+	}, ImpersonationExpiry)
+}
+
+func (s *JWTService) signToken(claims *Claims, expiry time.Duration) (string, time.Time, error) {
 	now := time.Now()
 	expiresAt := now.Add(expiry)
 
-	claims := &Claims{
-		UserID:    userID,
-		Email:     email,
-		Role:      role,
-		Plan:      plan,
-		TokenType: tokenType,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ID:        uuid.New().String(),
-			Issuer:    s.issuer,
-			Subject:   email,
-			IssuedAt:  jwt.NewNumericDate(now),
-			ExpiresAt: jwt.NewNumericDate(expiresAt),
-			NotBefore: jwt.NewNumericDate(now),
-		},
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ID:        uuid.New().String(),
+		Issuer:    s.issuer,
+		Subject:   claims.Email,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+		// Whole seconds, so an instance whose clock is slightly behind
+		// still accepts the token straight away.
+		NotBefore: jwt.NewNumericDate(now.Truncate(time.Second)),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signedToken, err := token.SignedString(s.secret)
+	signedToken, err := s.keys.sign(claims)
 	if err != nil {
 		return "", time.Time{}, err
 	}
@@ -101,12 +141,7 @@ func (s *JWTService) generateToken(userID uint, email, role, plan string, tokenT
 }
 
 func (s *JWTService) ValidateToken(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, ErrInvalidToken
-		}
-		return s.secret, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, s.keys.keyFunc, jwt.WithValidMethods(s.keys.validMethods()))
 
 	if err != nil {
 		if errors.Is(err, jwt.ErrTokenExpired) {
@@ -123,17 +158,18 @@ func (s *JWTService) ValidateToken(tokenString string) (*Claims, error) {
 	return claims, nil
 }
 
-func (s *JWTService) RefreshTokens(refreshTokenString string) (*TokenPair, error) {
-	claims, err := s.ValidateToken(refreshTokenString)
+// ParseRefreshToken validates a refresh token. Whether it may still be
+// used is up to the session store.
+func (s *JWTService) ParseRefreshToken(tokenString string) (*Claims, error) {
+	claims, err := s.ValidateToken(tokenString)
 	if err != nil {
 		return nil, err
 	}
 
-	if claims.TokenType != RefreshToken {
+	if claims.TokenType != RefreshToken || claims.SessionID == "" {
 		return nil, ErrInvalidToken
 	}
-
-	return s.GenerateTokenPair(claims.UserID, claims.Email, claims.Role, claims.Plan)
+	return claims, nil
 }
 
 func (s *JWTService) GetClaimsFromToken(tokenString string) (*Claims, error) {
@@ -0,0 +1,29 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+// TestIssuedAtKeepsFractionalSeconds checks that the issue time survives
+// signing and parsing closely enough to order a token against a password
+// change made in the same second.
+func TestIssuedAtKeepsFractionalSeconds(t *testing.T) {
+	svc := NewJWTService(HMACKeys(testSecret), time.Minute, time.Hour)
+	before := time.Now()
+	pair, err := svc.GenerateTokenPair(1, "user@example.com", "user", "free", "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := svc.ValidateToken(pair.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuedAt := claims.IssuedAt.Time
+	if issuedAt.Before(before.Truncate(time.Microsecond).Add(-time.Microsecond)) || issuedAt.After(time.Now()) {
+		t.Errorf("issued at %v, want between %v and now", issuedAt, before)
+	}
+	if nbf := claims.NotBefore.Time; !nbf.Equal(nbf.Truncate(time.Second)) {
+		t.Errorf("not before %v, want whole seconds", nbf)
+	}
+}
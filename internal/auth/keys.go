@@ -0,0 +1,275 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Signing algorithms, as named in JWT_ALGORITHM and the alg header.
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	EdDSA = "EdDSA"
+)
+
+// minRSABits is the smallest RSA key accepted for signing or verifying.
+const minRSABits = 2048
+
+// KeyOptions is the key material Keys are built from.
+type KeyOptions struct {
+	Algorithm string
+	// Secret signs HS256 tokens, and is used to verify them while
+	// Algorithm is HS256 or until HS256Until.
+	Secret string
+	// PrivateKey is the PEM RSA or Ed25519 key for RS256 and EdDSA.
+	PrivateKey string
+	// PreviousPublicKeys are PEM public keys that signed tokens before the
+	// current one, so those keep verifying after a rotation.
+	PreviousPublicKeys string
+	HS256Until         time.Time
+}
+
+// Keys signs tokens with one key and verifies them against every key that
+// may have signed a token still in circulation. A token's key is picked
+// by its kid header, and its alg has to be the one that key is for, so a
+// token can't choose how it is checked.
+type Keys struct {
+	algorithm  string
+	method     jwt.SigningMethod
+	signKey    interface{}
+	kid        string
+	secret     []byte
+	hs256Until time.Time
+	// public holds the current and previous public keys by kid, in the
+	// order they are published.
+	public map[string]crypto.PublicKey
+	kids   []string
+}
+
+// JWK is one public key in a JWKS document.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// HMACKeys signs and verifies with secret alone.
+func HMACKeys(secret string) *Keys {
+	return &Keys{algorithm: HS256, method: jwt.SigningMethodHS256, signKey: []byte(secret), secret: []byte(secret), public: map[string]crypto.PublicKey{}}
+}
+
+// NewKeys loads the keys described by opts.
+func NewKeys(opts KeyOptions) (*Keys, error) {
+	k := HMACKeys(opts.Secret)
+	k.hs256Until = opts.HS256Until
+
+	switch opts.Algorithm {
+	case HS256, "":
+	case RS256, EdDSA:
+		if opts.PrivateKey == "" {
+			return nil, fmt.Errorf("JWT_PRIVATE_KEY is required for %s", opts.Algorithm)
+		}
+		signer, err := parsePrivateKey(opts.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("JWT_PRIVATE_KEY: %w", err)
+		}
+		if algorithmFor(signer.Public()) != opts.Algorithm {
+			return nil, fmt.Errorf("JWT_PRIVATE_KEY is not a key for %s", opts.Algorithm)
+		}
+		k.algorithm, k.signKey = opts.Algorithm, signer
+		k.method = jwt.GetSigningMethod(opts.Algorithm)
+		if k.kid, err = k.add(signer.Public()); err != nil {
+			return nil, fmt.Errorf("JWT_PRIVATE_KEY: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("JWT_ALGORITHM must be one of %s, %s, %s", HS256, RS256, EdDSA)
+	}
+
+	rest := []byte(opts.PreviousPublicKeys)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("JWT_PREVIOUS_PUBLIC_KEYS: %w", err)
+		}
+		if _, err := k.add(key); err != nil {
+			return nil, fmt.Errorf("JWT_PREVIOUS_PUBLIC_KEYS: %w", err)
+		}
+	}
+	return k, nil
+}
+
+// Algorithm is the algorithm new tokens are signed with.
+func (k *Keys) Algorithm() string {
+	return k.algorithm
+}
+
+// JWKS lists the public keys tokens are verified against. It is empty
+// with HS256, whose key can't be published.
+func (k *Keys) JWKS() JWKSet {
+	set := JWKSet{Keys: make([]JWK, 0, len(k.kids))}
+	for _, kid := range k.kids {
+		jwk := toJWK(k.public[kid])
+		jwk.Kid, jwk.Use = kid, "sig"
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+func (k *Keys) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.method, claims)
+	if k.kid != "" {
+		token.Header["kid"] = k.kid
+	}
+	return token.SignedString(k.signKey)
+}
+
+// acceptsHMAC reports whether HS256 tokens still verify: always while
+// they are what is issued, and during the migration window after.
+func (k *Keys) acceptsHMAC() bool {
+	return k.algorithm == HS256 || time.Now().Before(k.hs256Until)
+}
+
+// validMethods are the alg headers worth trying at all.
+func (k *Keys) validMethods() []string {
+	var methods []string
+	if k.acceptsHMAC() {
+		methods = append(methods, HS256)
+	}
+	seen := map[string]bool{}
+	for _, kid := range k.kids {
+		if alg := algorithmFor(k.public[kid]); !seen[alg] {
+			seen[alg] = true
+			methods = append(methods, alg)
+		}
+	}
+	return methods
+}
+
+// keyFunc picks the key a token is verified with. HMAC tokens only ever
+// get the secret and asymmetric ones only the public key named by their
+// kid, and only when their alg is that key's, so a token signed with
+// HMAC over a public key, or claiming another algorithm, fails.
+func (k *Keys) keyFunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		if !k.acceptsHMAC() || len(k.secret) == 0 {
+			return nil, ErrInvalidToken
+		}
+		return k.secret, nil
+	}
+	kid, _ := token.Header["kid"].(string)
+	key, ok := k.public[kid]
+	if !ok || token.Method.Alg() != algorithmFor(key) {
+		return nil, ErrInvalidToken
+	}
+	return key, nil
+}
+
+func (k *Keys) add(key crypto.PublicKey) (string, error) {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if key.N.BitLen() < minRSABits {
+			return "", fmt.Errorf("RSA keys must be at least %d bits", minRSABits)
+		}
+	case ed25519.PublicKey:
+	default:
+		return "", errors.New("only RSA and Ed25519 keys are supported")
+	}
+	kid := thumbprint(key)
+	if _, ok := k.public[kid]; !ok {
+		k.public[kid] = key
+		k.kids = append(k.kids, kid)
+	}
+	return kid, nil
+}
+
+func parsePrivateKey(data string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("unsupported private key")
+	}
+	return signer, nil
+}
+
+// algorithmFor is the one algorithm a public key verifies.
+func algorithmFor(key crypto.PublicKey) string {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		return RS256
+	case ed25519.PublicKey:
+		return EdDSA
+	}
+	return ""
+}
+
+func toJWK(key crypto.PublicKey) JWK {
+	b64 := base64.RawURLEncoding.EncodeToString
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return JWK{Kty: "RSA", Alg: RS256, N: b64(key.N.Bytes()), E: b64(big.NewInt(int64(key.E)).Bytes())}
+	case ed25519.PublicKey:
+		return JWK{Kty: "OKP", Alg: EdDSA, Crv: "Ed25519", X: b64(key)}
+	}
+	return JWK{}
+}
+
+// thumbprint is the RFC 7638 JWK thumbprint of key, used as its kid so
+// the same key always gets the same one.
+func thumbprint(key crypto.PublicKey) string {
+	jwk := toJWK(key)
+	var members interface{}
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	default:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	}
+	data, _ := json.Marshal(members)
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
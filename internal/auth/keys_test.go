@@ -0,0 +1,235 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testSecret = "keys-test-secret-at-least-32-characters"
+
+func privatePEM(t *testing.T, key crypto.Signer) string {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+func publicPEM(t *testing.T, key crypto.PublicKey) string {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func rsaKey(t *testing.T, bits int) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func ed25519Key(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func newKeys(t *testing.T, opts KeyOptions) *Keys {
+	t.Helper()
+	keys, err := NewKeys(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+// forge signs claims for user 1 with method and key, under kid if not
+// empty, the way an attacker holding only public material would.
+func forge(t *testing.T, method jwt.SigningMethod, key interface{}, kid string) string {
+	t.Helper()
+	now := time.Now()
+	token := jwt.NewWithClaims(method, &Claims{
+		UserID: 1, Role: "admin", TokenType: AccessToken,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		},
+	})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestKeysRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		opts KeyOptions
+	}{
+		{"HS256", KeyOptions{Algorithm: HS256, Secret: testSecret}},
+		{"RS256", KeyOptions{Algorithm: RS256, Secret: testSecret, PrivateKey: privatePEM(t, rsaKey(t, 2048))}},
+		{"EdDSA", KeyOptions{Algorithm: EdDSA, Secret: testSecret, PrivateKey: privatePEM(t, ed25519Key(t))}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := NewJWTService(newKeys(t, tt.opts), time.Minute, time.Hour)
+			pair, err := svc.GenerateTokenPair(7, "user@example.com", "user", "free", "session")
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims, err := svc.ValidateToken(pair.AccessToken)
+			if err != nil || claims.UserID != 7 {
+				t.Fatalf("ValidateToken = %+v, %v", claims, err)
+			}
+			parsed, _, err := jwt.NewParser().ParseUnverified(pair.AccessToken, &Claims{})
+			if err != nil || parsed.Method.Alg() != tt.name {
+				t.Errorf("token signed with %v (%v), want %s", parsed.Header["alg"], err, tt.name)
+			}
+		})
+	}
+}
+
+// TestHMACOverPublicKey is the classic confusion: an HS256 token keyed
+// with the server's published RSA key must not verify as if the server
+// had signed it.
+func TestHMACOverPublicKey(t *testing.T) {
+	signer := rsaKey(t, 2048)
+	pubPEM := publicPEM(t, &signer.PublicKey)
+	der, _ := x509.MarshalPKIXPublicKey(&signer.PublicKey)
+
+	for _, window := range []struct {
+		name  string
+		until time.Time
+	}{
+		{"after the HS256 window", time.Time{}},
+		{"during the HS256 window", time.Now().Add(time.Hour)},
+	} {
+		t.Run(window.name, func(t *testing.T) {
+			keys := newKeys(t, KeyOptions{Algorithm: RS256, Secret: testSecret, PrivateKey: privatePEM(t, signer), HS256Until: window.until})
+			svc := NewJWTService(keys, time.Minute, time.Hour)
+			kid := keys.JWKS().Keys[0].Kid
+
+			for name, key := range map[string][]byte{"PEM": []byte(pubPEM), "DER": der, "modulus": signer.PublicKey.N.Bytes()} {
+				for _, withKid := range []string{"", kid} {
+					if _, err := svc.ValidateToken(forge(t, jwt.SigningMethodHS256, key, withKid)); !errors.Is(err, ErrInvalidToken) {
+						t.Errorf("HS256 over the public key's %s, kid %q: %v, want ErrInvalidToken", name, withKid, err)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestAlgorithmMustMatchKid checks that a token signed by a key the server
+// trusts is still refused when it names another key's kid: it would
+// otherwise be checked with a key of a different algorithm.
+func TestAlgorithmMustMatchKid(t *testing.T) {
+	current, previous := rsaKey(t, 2048), ed25519Key(t)
+	keys := newKeys(t, KeyOptions{
+		Algorithm:          RS256,
+		Secret:             testSecret,
+		PrivateKey:         privatePEM(t, current),
+		PreviousPublicKeys: publicPEM(t, previous.Public()),
+	})
+	svc := NewJWTService(keys, time.Minute, time.Hour)
+	jwks := keys.JWKS().Keys
+	if len(jwks) != 2 || jwks[0].Alg != RS256 || jwks[1].Alg != EdDSA {
+		t.Fatalf("JWKS = %+v, want the RS256 key then the EdDSA one", jwks)
+	}
+	rsaKid, edKid := jwks[0].Kid, jwks[1].Kid
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"EdDSA under its own kid", forge(t, jwt.SigningMethodEdDSA, previous, edKid), true},
+		{"RS256 under its own kid", forge(t, jwt.SigningMethodRS256, current, rsaKid), true},
+		{"EdDSA under the RS256 kid", forge(t, jwt.SigningMethodEdDSA, previous, rsaKid), false},
+		{"RS256 under the EdDSA kid", forge(t, jwt.SigningMethodRS256, current, edKid), false},
+		{"EdDSA without a kid", forge(t, jwt.SigningMethodEdDSA, previous, ""), false},
+		{"unknown kid", forge(t, jwt.SigningMethodEdDSA, ed25519Key(t), "unknown"), false},
+		{"alg none", forge(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, rsaKid), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.ValidateToken(tt.token)
+			if tt.valid && err != nil {
+				t.Errorf("ValidateToken: %v", err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("ValidateToken: %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestHS256Window(t *testing.T) {
+	hmac := NewJWTService(HMACKeys(testSecret), time.Minute, time.Hour)
+	pair, err := hmac.GenerateTokenPair(1, "user@example.com", "user", "free", "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	private := privatePEM(t, ed25519Key(t))
+	for _, tt := range []struct {
+		name  string
+		until time.Time
+		valid bool
+	}{
+		{"during the window", time.Now().Add(time.Hour), true},
+		{"after the window", time.Now().Add(-time.Second), false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := NewJWTService(newKeys(t, KeyOptions{Algorithm: EdDSA, Secret: testSecret, PrivateKey: private, HS256Until: tt.until}), time.Minute, time.Hour)
+			if _, err := svc.ValidateToken(pair.AccessToken); (err == nil) != tt.valid {
+				t.Errorf("HS256 token: %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestNewKeysRejects(t *testing.T) {
+	ed := privatePEM(t, ed25519Key(t))
+	tests := []struct {
+		name string
+		opts KeyOptions
+	}{
+		{"unknown algorithm", KeyOptions{Algorithm: "ES256", Secret: testSecret}},
+		{"no private key", KeyOptions{Algorithm: RS256, Secret: testSecret}},
+		{"not PEM", KeyOptions{Algorithm: EdDSA, Secret: testSecret, PrivateKey: "not a key"}},
+		{"key for another algorithm", KeyOptions{Algorithm: RS256, Secret: testSecret, PrivateKey: ed}},
+		{"short RSA key", KeyOptions{Algorithm: RS256, Secret: testSecret, PrivateKey: privatePEM(t, rsaKey(t, 1024))}},
+		{"short previous RSA key", KeyOptions{Algorithm: EdDSA, Secret: testSecret, PrivateKey: ed, PreviousPublicKeys: publicPEM(t, &rsaKey(t, 1024).PublicKey)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewKeys(tt.opts); err == nil {
+				t.Error("NewKeys succeeded")
+			}
+		})
+	}
+}
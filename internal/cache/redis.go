@@ -3,6 +3,8 @@ package cache
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"sync/atomic"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -12,6 +14,18 @@ var ctx = context.Background()
 
 type RedisCache struct {
 	client *redis.Client
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// Stats counts Get calls since startup that found their key and that
+// didn't.
+type Stats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+	// HitRatio is Hits over all lookups, 0 before the first one.
+	HitRatio float64 `json:"hit_ratio"`
 }
 
 var Cache *RedisCache
@@ -43,6 +57,20 @@ func (c *RedisCache) Set(key string, value interface{}, expiration time.Duration
 
 func (c *RedisCache) Get(key string, dest interface{}) error {
 	val, err := c.client.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		c.misses.Add(1)
+	}
+	if err != nil {
+		return err
+	}
+	c.hits.Add(1)
+	return json.Unmarshal([]byte(val), dest)
+}
+
+// Take is Get that also deletes the key, atomically, for values that
+// must only be used once.
+func (c *RedisCache) Take(key string, dest interface{}) error {
+	val, err := c.client.GetDel(ctx, key).Result()
 	if err != nil {
 		return err
 	}
@@ -66,6 +94,13 @@ func (c *RedisCache) Exists(key string) bool {
 	return val > 0
 }
 
+// Has is Exists for callers that must tell a missing key from Redis being
+// unreachable.
+func (c *RedisCache) Has(hasCtx context.Context, key string) (bool, error) {
+	val, err := c.client.Exists(hasCtx, key).Result()
+	return val > 0, err
+}
+
 func (c *RedisCache) Incr(key string, expiration time.Duration) (int64, error) {
 	pipe := c.client.Pipeline()
 	incr := pipe.Incr(ctx, key)
@@ -77,6 +112,22 @@ func (c *RedisCache) Incr(key string, expiration time.Duration) (int64, error) {
 	return incr.Val(), nil
 }
 
+// Ping round-trips to Redis and returns how long it took.
+func (c *RedisCache) Ping(pingCtx context.Context) (time.Duration, error) {
+	start := time.Now()
+	err := c.client.Ping(pingCtx).Err()
+	return time.Since(start), err
+}
+
+// Stats returns the hit and miss counts for this instance.
+func (c *RedisCache) Stats() Stats {
+	s := Stats{Hits: c.hits.Load(), Misses: c.misses.Load()}
+	if total := s.Hits + s.Misses; total > 0 {
+		s.HitRatio = float64(s.Hits) / float64(total)
+	}
+	return s
+}
+
 func (c *RedisCache) Close() error {
 	return c.client.Close()
 }
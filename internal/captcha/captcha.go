@@ -0,0 +1,254 @@
+// Package captcha checks the Cloudflare Turnstile or hCaptcha tokens sent
+// with sign-ups and logins, which stops bots that get past the rate
+// limits by spreading over many addresses.
+//
+// Sign-ups need a token unless CAPTCHA_REGISTER is off. Logins need one
+// always, never, or (by default) once a login from the same IP or for the
+// same email has failed within the last hour; those failures are kept in
+// Redis, so without Redis logins are only challenged in "always" mode.
+// When the provider can't be reached it is left alone for a minute, and
+// requests meanwhile are let through or refused as CAPTCHA_FAIL_OPEN says.
+// Without CAPTCHA_SECRET nothing is checked.
+package captcha
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zesbe/lumina-ai/internal/cache"
+	"github.com/zesbe/lumina-ai/internal/config"
+	"github.com/zesbe/lumina-ai/internal/logger"
+)
+
+// Login modes, as named in CAPTCHA_LOGIN.
+const (
+	LoginAlways       = "always"
+	LoginAfterFailure = "after_failure"
+	LoginOff          = "off"
+)
+
+var (
+	// ErrMissing is a request that needed a token and came without one.
+	ErrMissing = errors.New("captcha token missing")
+	// ErrInvalid is a token the provider rejected.
+	ErrInvalid = errors.New("captcha token rejected")
+	// ErrUnavailable is the provider being unreachable with
+	// CAPTCHA_FAIL_OPEN off.
+	ErrUnavailable = errors.New("captcha provider unavailable")
+)
+
+const (
+	// outageBackoff is how long the provider is left alone after it
+	// failed to answer.
+	outageBackoff = time.Minute
+	// failureWindow is how long a failed login keeps its IP and email
+	// challenged.
+	failureWindow = time.Hour
+	// checkTimeout bounds the Redis lookup made on every login.
+	checkTimeout = 250 * time.Millisecond
+)
+
+// endpoints are the providers' siteverify URLs.
+var endpoints = map[string]string{
+	"turnstile": "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+	"hcaptcha":  "https://api.hcaptcha.com/siteverify",
+}
+
+type verifier struct {
+	cfg    config.Captcha
+	url    string
+	client *http.Client
+
+	mu        sync.Mutex
+	downUntil time.Time
+}
+
+var v *verifier
+
+// Init configures the verifier from cfg. Until Init is called with a
+// secret nothing is checked.
+func Init(cfg *config.Config) {
+	if !cfg.Captcha.Enabled() {
+		v = nil
+		return
+	}
+	endpoint := cfg.Captcha.VerifyURL
+	if endpoint == "" {
+		endpoint = endpoints[cfg.Captcha.Provider]
+	}
+	v = &verifier{
+		cfg:    cfg.Captcha,
+		url:    endpoint,
+		client: &http.Client{Timeout: cfg.Captcha.Timeout},
+	}
+}
+
+// OnRegister reports whether sign-ups need a token.
+func OnRegister() bool {
+	return v != nil && v.cfg.Register
+}
+
+// OnLogin reports whether a login from ip for email needs a token. A
+// failed Redis lookup counts as no, so an outage there doesn't block
+// every login.
+func OnLogin(ctx context.Context, ip, email string) bool {
+	if v == nil {
+		return false
+	}
+	switch v.cfg.Login {
+	case LoginAlways:
+		return true
+	case LoginAfterFailure:
+		if cache.Cache == nil {
+			return false
+		}
+		ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+		defer cancel()
+		for _, key := range []string{ipKey(ip), emailKey(email)} {
+			flagged, err := cache.Cache.Has(ctx, key)
+			if err != nil {
+				logger.FromContext(ctx).Warn("failed to check captcha state", "error", err)
+				return false
+			}
+			if flagged {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// LoginFailed remembers a failed login, so the next ones from ip or for
+// email need a token. It reports whether they do.
+func LoginFailed(ip, email string) bool {
+	if v == nil {
+		return false
+	}
+	switch v.cfg.Login {
+	case LoginAlways:
+		return true
+	case LoginAfterFailure:
+		if cache.Cache == nil {
+			return false
+		}
+		for _, key := range []string{ipKey(ip), emailKey(email)} {
+			if err := cache.Cache.Set(key, true, failureWindow); err != nil {
+				logger.L().Warn("failed to store captcha state", "error", err)
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// LoginSucceeded lifts the challenge for email. The IP's stays until it
+// expires, so logging into one account doesn't clear it for guesses at
+// others.
+func LoginSucceeded(email string) {
+	if v == nil || cache.Cache == nil {
+		return
+	}
+	if err := cache.Cache.Delete(emailKey(email)); err != nil {
+		logger.L().Warn("failed to clear captcha state", "error", err)
+	}
+}
+
+// Verify checks token with the provider. It returns nil for a good token,
+// and also while the provider is down if CAPTCHA_FAIL_OPEN is on.
+func Verify(ctx context.Context, token, ip string) error {
+	if v == nil {
+		return nil
+	}
+	if v.down() {
+		return v.unavailable()
+	}
+	if token == "" {
+		return ErrMissing
+	}
+
+	ok, codes, err := v.siteverify(ctx, token, ip)
+	if err != nil {
+		v.mu.Lock()
+		v.downUntil = time.Now().Add(outageBackoff)
+		v.mu.Unlock()
+		logger.FromContext(ctx).Error("captcha provider unavailable", "provider", v.cfg.Provider, "fail_open", v.cfg.FailOpen, "error", err)
+		return v.unavailable()
+	}
+	if !ok {
+		// Codes about the secret are a configuration problem, not a bot.
+		for _, code := range codes {
+			if strings.Contains(code, "secret") {
+				logger.FromContext(ctx).Error("captcha provider rejected the secret", "provider", v.cfg.Provider, "codes", codes)
+				break
+			}
+		}
+		return ErrInvalid
+	}
+	return nil
+}
+
+func (v *verifier) down() bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return time.Now().Before(v.downUntil)
+}
+
+func (v *verifier) unavailable() error {
+	if v.cfg.FailOpen {
+		return nil
+	}
+	return ErrUnavailable
+}
+
+// siteverify asks the provider about token. Both providers take the same
+// form and answer the same way.
+func (v *verifier) siteverify(ctx context.Context, token, ip string) (bool, []string, error) {
+	form := url.Values{"secret": {v.cfg.Secret}, "response": {token}}
+	if ip != "" {
+		form.Set("remoteip", ip)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return false, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, nil, fmt.Errorf("siteverify returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Success    bool     `json:"success"`
+		ErrorCodes []string `json:"error-codes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, nil, err
+	}
+	return result.Success, result.ErrorCodes, nil
+}
+
+func ipKey(ip string) string {
+	return "captcha_ip:" + ip
+}
+
+// emailKey hashes the address so Redis doesn't hold a list of who tried
+// to log in.
+func emailKey(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return "captcha_email:" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,158 @@
+package captcha
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zesbe/lumina-ai/internal/config"
+)
+
+// fakeProvider answers siteverify with status and body, counting calls
+// and keeping the last form it was sent.
+type fakeProvider struct {
+	*httptest.Server
+	calls atomic.Int32
+	form  atomic.Value
+}
+
+func newFakeProvider(t *testing.T, status int, body string) *fakeProvider {
+	f := &fakeProvider{}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.calls.Add(1)
+		if err := r.ParseForm(); err == nil {
+			f.form.Store(r.PostForm)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func setup(t *testing.T, endpoint string, failOpen bool) {
+	t.Helper()
+	Init(&config.Config{Captcha: config.Captcha{
+		Provider:  "turnstile",
+		Secret:    "test-secret",
+		VerifyURL: endpoint,
+		Register:  true,
+		Login:     LoginAlways,
+		FailOpen:  failOpen,
+		Timeout:   time.Second,
+	}})
+	t.Cleanup(func() { v = nil })
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		token    string
+		failOpen bool
+		want     error
+	}{
+		{name: "success", status: http.StatusOK, body: `{"success":true}`, token: "good", want: nil},
+		{name: "rejected", status: http.StatusOK, body: `{"success":false,"error-codes":["invalid-input-response"]}`, token: "bad", want: ErrInvalid},
+		{name: "rejected secret", status: http.StatusOK, body: `{"success":false,"error-codes":["invalid-input-secret"]}`, token: "good", want: ErrInvalid},
+		{name: "missing", status: http.StatusOK, body: `{"success":true}`, token: "", want: ErrMissing},
+		{name: "outage fail closed", status: http.StatusServiceUnavailable, body: ``, token: "good", want: ErrUnavailable},
+		{name: "outage fail open", status: http.StatusServiceUnavailable, body: ``, token: "good", failOpen: true, want: nil},
+		{name: "garbled answer fail closed", status: http.StatusOK, body: `<html>`, token: "good", want: ErrUnavailable},
+		{name: "rejected fail open", status: http.StatusOK, body: `{"success":false}`, token: "bad", failOpen: true, want: ErrInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newFakeProvider(t, tt.status, tt.body)
+			setup(t, provider.URL, tt.failOpen)
+
+			if err := Verify(context.Background(), tt.token, "203.0.113.7"); !errors.Is(err, tt.want) {
+				t.Errorf("Verify() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifySendsTheForm(t *testing.T) {
+	provider := newFakeProvider(t, http.StatusOK, `{"success":true}`)
+	setup(t, provider.URL, false)
+
+	if err := Verify(context.Background(), "good", "203.0.113.7"); err != nil {
+		t.Fatal(err)
+	}
+	form, _ := provider.form.Load().(url.Values)
+	want := map[string]string{"secret": "test-secret", "response": "good", "remoteip": "203.0.113.7"}
+	for key, value := range want {
+		if got := form[key]; len(got) != 1 || got[0] != value {
+			t.Errorf("form %s = %v, want %q", key, got, value)
+		}
+	}
+}
+
+// After an outage the provider is left alone for the backoff, and
+// requests meanwhile get the fail-open or fail-closed answer without it.
+func TestVerifyBacksOffAfterOutage(t *testing.T) {
+	for _, failOpen := range []bool{false, true} {
+		want := ErrUnavailable
+		if failOpen {
+			want = nil
+		}
+		provider := newFakeProvider(t, http.StatusBadGateway, ``)
+		setup(t, provider.URL, failOpen)
+
+		for i := 0; i < 3; i++ {
+			if err := Verify(context.Background(), "good", ""); !errors.Is(err, want) {
+				t.Errorf("fail open %v, attempt %d: Verify() = %v, want %v", failOpen, i, err, want)
+			}
+		}
+		if calls := provider.calls.Load(); calls != 1 {
+			t.Errorf("fail open %v: %d calls to the provider during the backoff, want 1", failOpen, calls)
+		}
+		// A missing token isn't refused as missing while the provider is
+		// down either; the outage answer decides.
+		if err := Verify(context.Background(), "", ""); !errors.Is(err, want) {
+			t.Errorf("fail open %v, no token: Verify() = %v, want %v", failOpen, err, want)
+		}
+
+		// Once the backoff is over the provider is asked again.
+		v.mu.Lock()
+		v.downUntil = time.Now().Add(-time.Second)
+		v.mu.Unlock()
+		Verify(context.Background(), "good", "")
+		if calls := provider.calls.Load(); calls != 2 {
+			t.Errorf("fail open %v: %d calls after the backoff, want 2", failOpen, calls)
+		}
+	}
+}
+
+func TestVerifyTimeout(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(slow.Close)
+	t.Cleanup(func() { close(release) })
+	setup(t, slow.URL, false)
+	v.client.Timeout = 50 * time.Millisecond
+
+	if err := Verify(context.Background(), "good", ""); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Verify() = %v, want %v", err, ErrUnavailable)
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	Init(&config.Config{})
+	if err := Verify(context.Background(), "", ""); err != nil {
+		t.Errorf("Verify() without a secret = %v", err)
+	}
+	if OnRegister() || OnLogin(context.Background(), "203.0.113.7", "a@example.com") {
+		t.Error("a token is asked for without a secret")
+	}
+}
@@ -0,0 +1,79 @@
+package config
+
+import "slices"
+
+// Capabilities are the generation options a plan may use. The generate
+// handlers refuse anything beyond them with a 403 naming the plan that
+// allows it, and GET /capabilities shows them so clients can grey out the
+// rest.
+type Capabilities struct {
+	VideoModels     []string `json:"video_models"`
+	MaxResolution   string   `json:"max_resolution"`
+	MaxDuration     int      `json:"max_duration"`
+	MusicModels     []string `json:"music_models"`
+	MaxMusicBitrate int      `json:"max_music_bitrate"`
+	VoiceCloning    bool     `json:"voice_cloning"`
+}
+
+// PlanOrder lists the plans from the least to the most capable.
+var PlanOrder = []string{"free", "basic", "pro", "enterprise"}
+
+// Resolutions are the video resolutions MiniMax offers, lowest first.
+// 768P is its standard HD tier, the free plan's "720p".
+var Resolutions = []string{"512P", "720P", "768P", "1080P"}
+
+var (
+	standardVideoModels = []string{"video-01", "T2V-01"}
+	allVideoModels      = []string{"video-01", "T2V-01", "T2V-01-Director", "MiniMax-Hailuo-02", "hailuo-02"}
+	musicModels         = []string{"music-2.0", "music-1.5"}
+)
+
+// defaultCapabilities is what each plan gets; the plans' feature lists
+// describe the same tiers.
+func defaultCapabilities() map[string]Capabilities {
+	return map[string]Capabilities{
+		"free": {
+			VideoModels: standardVideoModels, MaxResolution: "768P", MaxDuration: 6,
+			MusicModels: musicModels, MaxMusicBitrate: 256000,
+		},
+		"basic": {
+			VideoModels: allVideoModels, MaxResolution: "1080P", MaxDuration: 10,
+			MusicModels: musicModels, MaxMusicBitrate: 320000,
+		},
+		"pro": {
+			VideoModels: allVideoModels, MaxResolution: "1080P", MaxDuration: 10,
+			MusicModels: musicModels, MaxMusicBitrate: 320000, VoiceCloning: true,
+		},
+		"enterprise": {
+			VideoModels: allVideoModels, MaxResolution: "1080P", MaxDuration: 10,
+			MusicModels: musicModels, MaxMusicBitrate: 320000, VoiceCloning: true,
+		},
+	}
+}
+
+// CapabilitiesFor returns what plan may use; an unknown plan gets the free
+// plan's.
+func (c *Config) CapabilitiesFor(plan string) Capabilities {
+	if caps, ok := c.PlanCapabilities[plan]; ok {
+		return caps
+	}
+	return c.PlanCapabilities["free"]
+}
+
+// LowestPlanWith returns the least capable plan whose capabilities pass
+// allows, or false if none does.
+func (c *Config) LowestPlanWith(allows func(Capabilities) bool) (string, bool) {
+	for _, plan := range PlanOrder {
+		if allows(c.CapabilitiesFor(plan)) {
+			return plan, true
+		}
+	}
+	return "", false
+}
+
+// AllowsResolution reports whether resolution is at most caps'
+// MaxResolution. Unknown resolutions are never allowed.
+func (caps Capabilities) AllowsResolution(resolution string) bool {
+	rank := slices.Index(Resolutions, resolution)
+	return rank >= 0 && rank <= slices.Index(Resolutions, caps.MaxResolution)
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestAllowsResolution(t *testing.T) {
+	free := defaultCapabilities()["free"]
+	for resolution, want := range map[string]bool{
+		"512P": true, "720P": true, "768P": true, "1080P": false, "4K": false, "": false, "768p": false,
+	} {
+		if got := free.AllowsResolution(resolution); got != want {
+			t.Errorf("free AllowsResolution(%q) = %v, want %v", resolution, got, want)
+		}
+	}
+}
+
+func TestLowestPlanWith(t *testing.T) {
+	cfg := &Config{PlanCapabilities: defaultCapabilities()}
+	tests := []struct {
+		name   string
+		allows func(Capabilities) bool
+		want   string
+	}{
+		{"standard model", func(c Capabilities) bool { return slices.Contains(c.VideoModels, "T2V-01") }, "free"},
+		{"Hailuo-02", func(c Capabilities) bool { return slices.Contains(c.VideoModels, "MiniMax-Hailuo-02") }, "basic"},
+		{"768P", func(c Capabilities) bool { return c.AllowsResolution("768P") }, "free"},
+		{"1080P", func(c Capabilities) bool { return c.AllowsResolution("1080P") }, "basic"},
+		{"6 seconds", func(c Capabilities) bool { return c.MaxDuration >= 6 }, "free"},
+		{"10 seconds", func(c Capabilities) bool { return c.MaxDuration >= 10 }, "basic"},
+		{"256 kbps", func(c Capabilities) bool { return c.MaxMusicBitrate >= 256000 }, "free"},
+		{"320 kbps", func(c Capabilities) bool { return c.MaxMusicBitrate >= 320000 }, "basic"},
+		{"voice cloning", func(c Capabilities) bool { return c.VoiceCloning }, "pro"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, ok := cfg.LowestPlanWith(tt.allows); !ok || got != tt.want {
+				t.Errorf("LowestPlanWith = %q, %v; want %q", got, ok, tt.want)
+			}
+		})
+	}
+	if got, ok := cfg.LowestPlanWith(func(c Capabilities) bool { return c.AllowsResolution("4K") }); ok {
+		t.Errorf("4K is allowed from %q, want no plan", got)
+	}
+}
+
+func TestCapabilitiesForUnknownPlan(t *testing.T) {
+	cfg := &Config{PlanCapabilities: defaultCapabilities()}
+	if got := cfg.CapabilitiesFor("platinum"); got.MaxResolution != "768P" || got.VoiceCloning {
+		t.Errorf("unknown plan gets %+v, want the free plan's", got)
+	}
+	// Every plan allows at least what the one below it does.
+	for i := 1; i < len(PlanOrder); i++ {
+		lower, higher := cfg.CapabilitiesFor(PlanOrder[i-1]), cfg.CapabilitiesFor(PlanOrder[i])
+		if !higher.AllowsResolution(lower.MaxResolution) || higher.MaxDuration < lower.MaxDuration ||
+			higher.MaxMusicBitrate < lower.MaxMusicBitrate || lower.VoiceCloning && !higher.VoiceCloning {
+			t.Errorf("%s allows less than %s", PlanOrder[i], PlanOrder[i-1])
+		}
+		for _, model := range lower.VideoModels {
+			if !slices.Contains(higher.VideoModels, model) {
+				t.Errorf("%s lacks %s's video model %s", PlanOrder[i], PlanOrder[i-1], model)
+			}
+		}
+	}
+}
@@ -1,59 +1,480 @@
 package config
 
 import (
+	"fmt"
+	"log/slog"
 	"os"
 	"strconv"
+	"strings"
 	"time"
+
+	"github.com/zesbe/lumina-ai/internal/auth"
+	"github.com/zesbe/lumina-ai/internal/crypto"
 )
 
+// TextLimits caps the free-text generation fields, in characters (runes).
+type TextLimits struct {
+	Prompt    int
+	Lyrics    int
+	Narration int
+}
+
+// DBPool sizes the database/sql connection pool. It applies to the
+// primary and to each replica.
+type DBPool struct {
+	MaxOpen         int
+	MaxIdle         int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// Validate rejects pool settings database/sql would silently misread.
+func (p DBPool) Validate() error {
+	switch {
+	case p.MaxOpen < 1:
+		return fmt.Errorf("DB_MAX_OPEN must be at least 1, got %d", p.MaxOpen)
+	case p.MaxIdle < 0:
+		return fmt.Errorf("DB_MAX_IDLE must not be negative, got %d", p.MaxIdle)
+	case p.MaxIdle > p.MaxOpen:
+		return fmt.Errorf("DB_MAX_IDLE (%d) must not exceed DB_MAX_OPEN (%d)", p.MaxIdle, p.MaxOpen)
+	case p.ConnMaxLifetime < 0 || p.ConnMaxIdleTime < 0:
+		return fmt.Errorf("DB_CONN_MAX_LIFETIME and DB_CONN_MAX_IDLE_TIME must not be negative")
+	}
+	return nil
+}
+
+// LoginLockout is when repeated failed logins lock an account, and for
+// how long.
+type LoginLockout struct {
+	Threshold int
+	Base      time.Duration
+	Max       time.Duration
+	Window    time.Duration
+}
+
+// Validate rejects settings that would lock nobody or lock forever.
+func (l LoginLockout) Validate() error {
+	switch {
+	case l.Threshold < 1:
+		return fmt.Errorf("LOGIN_LOCKOUT_THRESHOLD must be at least 1, got %d", l.Threshold)
+	case l.Base <= 0 || l.Max <= 0 || l.Window <= 0:
+		return fmt.Errorf("LOGIN_LOCKOUT_BASE, LOGIN_LOCKOUT_MAX and LOGIN_FAILURE_WINDOW must be positive")
+	case l.Base > l.Max:
+		return fmt.Errorf("LOGIN_LOCKOUT_BASE (%s) must not exceed LOGIN_LOCKOUT_MAX (%s)", l.Base, l.Max)
+	}
+	return nil
+}
+
+// Captcha is which provider checks captcha tokens and when a token is
+// asked for. Without a secret no token is ever asked for.
+type Captcha struct {
+	Provider string
+	Secret   string
+	// VerifyURL replaces the provider's siteverify endpoint.
+	VerifyURL string
+	// Register asks for a token on every sign-up. Login is "always",
+	// "after_failure" (from the IP or for the account) or "off".
+	Register bool
+	Login    string
+	// FailOpen lets requests through while the provider can't be reached,
+	// instead of refusing them.
+	FailOpen bool
+	Timeout  time.Duration
+}
+
+// Enabled reports whether a captcha secret is configured.
+func (c Captcha) Enabled() bool {
+	return c.Secret != ""
+}
+
+// Loudness is the normalization pass run on generated music stored on
+// this server: two-pass EBU R128 (ffmpeg loudnorm) to Target LUFS with
+// true peaks kept under TruePeak dBTP.
+type Loudness struct {
+	Enabled  bool
+	Target   float64
+	TruePeak float64
+	// KeepOriginal keeps the unnormalized file next to the normalized one
+	// instead of replacing it.
+	KeepOriginal bool
+}
+
+// Watermark marks free-plan outputs: a corner logo on videos and a short
+// tag at the end of music. An empty path means the asset built into the
+// binary.
+type Watermark struct {
+	Enabled      bool
+	LogoPath     string
+	AudioTagPath string
+}
+
 type Config struct {
-	Environment       string
-	Port              string
-	DatabaseURL       string
-	RedisURL          string
-	JWTSecret         string
-	JWTExpiry         time.Duration
-	JWTRefreshExpiry  time.Duration
-	EncryptionKey     string
-	AllowedOrigins    string
-	RateLimitRequests int
-	RateLimitWindow   time.Duration
-	MiniMaxAPIKey     string
-	MiniMaxGroupID    string
-	StorageType       string
-	UploadPath        string
-	UploadMaxSize     int64
-	MTLSEnabled       bool
-	MTLSCAPath        string
+	Environment              string
+	Port                     string
+	DatabaseURL              string
+	DatabaseReplicaURLs      []string
+	DBPool                   DBPool
+	DBLogLevel               string
+	DBStatementTimeout       time.Duration
+	RedisURL                 string
+	JWTSecret                string
+	JWTAlgorithm             string
+	JWTPrivateKey            string
+	JWTPreviousPublicKeys    string
+	JWTHS256Until            time.Time
+	JWTKeys                  *auth.Keys
+	AdminEmail               string
+	AdminPassword            string
+	JWTExpiry                time.Duration
+	JWTRefreshExpiry         time.Duration
+	DenylistFailClosed       bool
+	LoginLockout             LoginLockout
+	Captcha                  Captcha
+	GoogleClientID           string
+	GoogleClientSecret       string
+	GoogleRedirectURL        string
+	GitHubClientID           string
+	GitHubClientSecret       string
+	GitHubRedirectURL        string
+	SMTPHost                 string
+	SMTPPort                 string
+	SMTPUsername             string
+	SMTPPassword             string
+	MailFrom                 string
+	MailFromName             string
+	AppURL                   string
+	PublicBaseURL            string
+	EncryptionKey            string
+	EncryptionKeys           string
+	FieldKeys                *crypto.Keyring
+	Argon2                   crypto.Argon2Params
+	AllowedOrigins           string
+	RateLimitRequests        int
+	RateLimitWindow          time.Duration
+	APIKeyRateLimit          int
+	MiniMaxAPIKey            string
+	MiniMaxGroupID           string
+	DemoMode                 bool
+	StorageType              string
+	UploadPath               string
+	UploadMaxSize            int64
+	JSONBodyLimit            int64
+	TextLimits               TextLimits
+	ProTextLimits            TextLimits
+	MaxActiveGenerations     int
+	ProMaxActiveGenerations  int
+	ModerationBlocklist      string
+	ModerationAPIURL         string
+	ModerationAPIKey         string
+	ModerationReloadInterval time.Duration
+	AuthTimeout              time.Duration
+	RequestTimeout           time.Duration
+	GenerateTimeout          time.Duration
+	// DuplicateGenerationWindow is how long after a generate request an
+	// identical one from the same user, while the first is still running,
+	// gets the first back instead of a second generation; 0 turns it off.
+	DuplicateGenerationWindow time.Duration
+	ShutdownGracePeriod       time.Duration
+	AuditRetention            time.Duration
+	AuditArchiveDir           string
+	GeoIPDBPath               string
+	PurgeRetention            time.Duration
+	AccountDeletionGrace      time.Duration
+	DataExportDir             string
+	DataExportTTL             time.Duration
+	MagicLinkBindIP           bool
+	DisposableDomainsURL      string
+	DisposableDomainsRefresh  time.Duration
+	EmailMXCheck              bool
+	MTLSEnabled               bool
+	MTLSCAPath                string
+	MTLSAllowedSubjects       []string
+	TLSCertPath               string
+	TLSKeyPath                string
+	HTTPRedirectPort          string
+	InsecureHTTP              bool
+	HealthPort                string
+	PprofAddr                 string
+	SentryDSN                 string
+	SentrySampleRate          float64
+	FFmpegTimeout             time.Duration
+	Loudness                  Loudness
+	Watermark                 Watermark
+	PlanCapabilities          map[string]Capabilities
+
+	parseErrors []string
 }
 
+// Load reads the configuration from the environment. Values that fail to
+// parse fall back to zero and are reported by Validate.
 func Load() *Config {
-	jwtExpiry, _ := time.ParseDuration(getEnv("JWT_EXPIRY", "15m"))
-	jwtRefreshExpiry, _ := time.ParseDuration(getEnv("JWT_REFRESH_EXPIRY", "168h"))
-	rateLimitWindow, _ := time.ParseDuration(getEnv("RATE_LIMIT_WINDOW", "1m"))
-	rateLimitRequests, _ := strconv.Atoi(getEnv("RATE_LIMIT_REQUESTS", "100"))
-	uploadMaxSize, _ := strconv.ParseInt(getEnv("UPLOAD_MAX_SIZE", "52428800"), 10, 64)
+	env := &envParser{}
+	environment := getEnv("ENVIRONMENT", "development")
+	dbLogLevel := "info"
+	if environment == "production" {
+		dbLogLevel = "warn"
+	}
+	dbMaxOpen := env.int("DB_MAX_OPEN", "20")
+	dbMaxIdle := env.int("DB_MAX_IDLE", "5")
+	dbConnMaxLifetime := env.duration("DB_CONN_MAX_LIFETIME", "30m")
+	dbConnMaxIdleTime := env.duration("DB_CONN_MAX_IDLE_TIME", "5m")
+	dbStatementTimeout := env.duration("DB_STATEMENT_TIMEOUT", "30s")
+	jwtExpiry := env.duration("JWT_EXPIRY", "15m")
+	jwtRefreshExpiry := env.duration("JWT_REFRESH_EXPIRY", "168h")
+	lockoutThreshold := env.int("LOGIN_LOCKOUT_THRESHOLD", "5")
+	lockoutBase := env.duration("LOGIN_LOCKOUT_BASE", "1m")
+	lockoutMax := env.duration("LOGIN_LOCKOUT_MAX", "1h")
+	failureWindow := env.duration("LOGIN_FAILURE_WINDOW", "1h")
+	rateLimitWindow := env.duration("RATE_LIMIT_WINDOW", "1m")
+	rateLimitRequests := env.int("RATE_LIMIT_REQUESTS", "100")
+	apiKeyRateLimit := env.int("API_KEY_RATE_LIMIT", "60")
+	uploadMaxSize := env.int64("UPLOAD_MAX_SIZE", "52428800")
+	jsonBodyLimit := env.int64("JSON_BODY_LIMIT", "1048576")
+	maxPrompt := env.int("MAX_PROMPT_CHARS", "2000")
+	maxLyrics := env.int("MAX_LYRICS_CHARS", "5000")
+	maxNarration := env.int("MAX_NARRATION_CHARS", "2000")
+	proMaxPrompt := env.int("PRO_MAX_PROMPT_CHARS", "4000")
+	proMaxLyrics := env.int("PRO_MAX_LYRICS_CHARS", "10000")
+	proMaxNarration := env.int("PRO_MAX_NARRATION_CHARS", "4000")
+	maxActiveGenerations := env.int("MAX_ACTIVE_GENERATIONS", "200")
+	proMaxActiveGenerations := env.int("PRO_MAX_ACTIVE_GENERATIONS", "200")
+	moderationReload := env.duration("MODERATION_RELOAD_INTERVAL", "1m")
+	authTimeout := env.duration("AUTH_TIMEOUT", "5s")
+	requestTimeout := env.duration("REQUEST_TIMEOUT", "10s")
+	generateTimeout := env.duration("GENERATE_TIMEOUT", "30s")
+	duplicateGenerationWindow := env.duration("DUPLICATE_GENERATION_WINDOW", "5m")
+	shutdownGracePeriod := env.duration("SHUTDOWN_GRACE_PERIOD", "60s")
+	auditRetention := env.duration("AUDIT_RETENTION", "8760h")
+	purgeRetention := env.duration("PURGE_RETENTION", "720h")
+	accountDeletionGrace := env.duration("ACCOUNT_DELETION_GRACE", "168h")
+	dataExportTTL := env.duration("DATA_EXPORT_TTL", "72h")
+	disposableRefresh := env.duration("DISPOSABLE_DOMAINS_REFRESH", "24h")
+	ffmpegTimeout := env.duration("FFMPEG_TIMEOUT", "2m")
+	loudness := Loudness{
+		Enabled:      getEnv("LOUDNESS_NORMALIZE", "true") == "true",
+		Target:       env.float("LOUDNESS_TARGET", "-14"),
+		TruePeak:     env.float("LOUDNESS_TRUE_PEAK", "-1"),
+		KeepOriginal: getEnv("LOUDNESS_KEEP_ORIGINAL", "true") == "true",
+	}
+	captcha := Captcha{
+		Provider:  getEnv("CAPTCHA_PROVIDER", "turnstile"),
+		Secret:    env.secret("CAPTCHA_SECRET"),
+		VerifyURL: getEnv("CAPTCHA_VERIFY_URL", ""),
+		Register:  getEnv("CAPTCHA_REGISTER", "true") == "true",
+		Login:     getEnv("CAPTCHA_LOGIN", "after_failure"),
+		FailOpen:  getEnv("CAPTCHA_FAIL_OPEN", "true") == "true",
+		Timeout:   env.duration("CAPTCHA_TIMEOUT", "3s"),
+	}
+	argon2 := *crypto.DefaultArgon2Params()
+	argon2.Memory = uint32(env.int("ARGON2_MEMORY", strconv.Itoa(int(argon2.Memory))))
+	argon2.Iterations = uint32(env.int("ARGON2_ITERATIONS", strconv.Itoa(int(argon2.Iterations))))
+	argon2.Parallelism = uint8(env.int("ARGON2_PARALLELISM", strconv.Itoa(int(argon2.Parallelism))))
 
 	return &Config{
-		Environment:       getEnv("ENVIRONMENT", "development"),
-		Port:              getEnv("PORT", "8082"),
-		DatabaseURL:       getEnv("DATABASE_URL", ""),
-		RedisURL:          getEnv("REDIS_URL", "redis://localhost:6379"),
-		JWTSecret:         getEnv("JWT_SECRET", ""),
-		JWTExpiry:         jwtExpiry,
-		JWTRefreshExpiry:  jwtRefreshExpiry,
-		EncryptionKey:     getEnv("ENCRYPTION_KEY", ""),
-		AllowedOrigins:    getEnv("ALLOWED_ORIGINS", "*"),
-		RateLimitRequests: rateLimitRequests,
-		RateLimitWindow:   rateLimitWindow,
-		MiniMaxAPIKey:     getEnv("MINIMAX_API_KEY", ""),
-		MiniMaxGroupID:    getEnv("MINIMAX_GROUP_ID", ""),
-		StorageType:       getEnv("STORAGE_TYPE", "local"),
-		UploadPath:        getEnv("UPLOAD_PATH", "./uploads"),
-		UploadMaxSize:     uploadMaxSize,
-		MTLSEnabled:       getEnv("MTLS_ENABLED", "false") == "true",
-		MTLSCAPath:        getEnv("MTLS_CA_PATH", ""),
+		parseErrors:         env.errs,
+		Environment:         environment,
+		Port:                getEnv("PORT", "8082"),
+		DatabaseURL:         env.secret("DATABASE_URL"),
+		DatabaseReplicaURLs: splitList(getEnv("DATABASE_REPLICA_URL", "")),
+		DBPool: DBPool{
+			MaxOpen:         dbMaxOpen,
+			MaxIdle:         dbMaxIdle,
+			ConnMaxLifetime: dbConnMaxLifetime,
+			ConnMaxIdleTime: dbConnMaxIdleTime,
+		},
+		DBLogLevel:                getEnv("DB_LOG_LEVEL", dbLogLevel),
+		DBStatementTimeout:        dbStatementTimeout,
+		RedisURL:                  getEnv("REDIS_URL", "redis://localhost:6379"),
+		JWTSecret:                 env.secret("JWT_SECRET"),
+		JWTAlgorithm:              getEnv("JWT_ALGORITHM", auth.HS256),
+		JWTPrivateKey:             env.secret("JWT_PRIVATE_KEY"),
+		JWTPreviousPublicKeys:     env.secret("JWT_PREVIOUS_PUBLIC_KEYS"),
+		JWTHS256Until:             env.time("JWT_HS256_ACCEPT_UNTIL"),
+		AdminEmail:                getEnv("ADMIN_EMAIL", ""),
+		AdminPassword:             env.secret("ADMIN_PASSWORD"),
+		JWTExpiry:                 jwtExpiry,
+		JWTRefreshExpiry:          jwtRefreshExpiry,
+		DenylistFailClosed:        getEnv("TOKEN_DENYLIST_FAIL_CLOSED", "false") == "true",
+		LoginLockout:              LoginLockout{Threshold: lockoutThreshold, Base: lockoutBase, Max: lockoutMax, Window: failureWindow},
+		Captcha:                   captcha,
+		GoogleClientID:            getEnv("GOOGLE_CLIENT_ID", ""),
+		GoogleClientSecret:        env.secret("GOOGLE_CLIENT_SECRET"),
+		GoogleRedirectURL:         getEnv("GOOGLE_REDIRECT_URL", ""),
+		GitHubClientID:            getEnv("GITHUB_CLIENT_ID", ""),
+		GitHubClientSecret:        env.secret("GITHUB_CLIENT_SECRET"),
+		GitHubRedirectURL:         getEnv("GITHUB_REDIRECT_URL", ""),
+		SMTPHost:                  getEnv("SMTP_HOST", ""),
+		SMTPPort:                  getEnv("SMTP_PORT", "587"),
+		SMTPUsername:              getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:              env.secret("SMTP_PASSWORD"),
+		MailFrom:                  getEnv("MAIL_FROM", "noreply@localhost"),
+		MailFromName:              getEnv("MAIL_FROM_NAME", "Lumina AI"),
+		AppURL:                    strings.TrimRight(getEnv("APP_URL", "http://localhost:3000"), "/"),
+		PublicBaseURL:             strings.TrimRight(getEnv("PUBLIC_BASE_URL", ""), "/"),
+		EncryptionKey:             env.secret("ENCRYPTION_KEY"),
+		EncryptionKeys:            env.secret("ENCRYPTION_KEYS"),
+		Argon2:                    argon2,
+		AllowedOrigins:            getEnv("ALLOWED_ORIGINS", "*"),
+		RateLimitRequests:         rateLimitRequests,
+		RateLimitWindow:           rateLimitWindow,
+		APIKeyRateLimit:           apiKeyRateLimit,
+		MiniMaxAPIKey:             env.secret("MINIMAX_API_KEY"),
+		MiniMaxGroupID:            getEnv("MINIMAX_GROUP_ID", ""),
+		DemoMode:                  getEnv("DEMO_MODE", "false") == "true",
+		StorageType:               getEnv("STORAGE_TYPE", "local"),
+		UploadPath:                getEnv("UPLOAD_PATH", "./uploads"),
+		UploadMaxSize:             uploadMaxSize,
+		JSONBodyLimit:             jsonBodyLimit,
+		TextLimits:                TextLimits{Prompt: maxPrompt, Lyrics: maxLyrics, Narration: maxNarration},
+		ProTextLimits:             TextLimits{Prompt: proMaxPrompt, Lyrics: proMaxLyrics, Narration: proMaxNarration},
+		MaxActiveGenerations:      maxActiveGenerations,
+		ProMaxActiveGenerations:   proMaxActiveGenerations,
+		ModerationBlocklist:       getEnv("MODERATION_BLOCKLIST", ""),
+		ModerationAPIURL:          getEnv("MODERATION_API_URL", ""),
+		ModerationAPIKey:          getEnv("MODERATION_API_KEY", ""),
+		ModerationReloadInterval:  moderationReload,
+		AuthTimeout:               authTimeout,
+		RequestTimeout:            requestTimeout,
+		GenerateTimeout:           generateTimeout,
+		DuplicateGenerationWindow: duplicateGenerationWindow,
+		ShutdownGracePeriod:       shutdownGracePeriod,
+		AuditRetention:            auditRetention,
+		AuditArchiveDir:           getEnv("AUDIT_ARCHIVE_DIR", ""),
+		GeoIPDBPath:               getEnv("GEOIP_DB_PATH", ""),
+		PurgeRetention:            purgeRetention,
+		AccountDeletionGrace:      accountDeletionGrace,
+		DataExportDir:             getEnv("DATA_EXPORT_DIR", "./exports"),
+		DataExportTTL:             dataExportTTL,
+		MagicLinkBindIP:           getEnv("MAGIC_LINK_BIND_IP", "false") == "true",
+		DisposableDomainsURL:      getEnv("DISPOSABLE_DOMAINS_URL", ""),
+		DisposableDomainsRefresh:  disposableRefresh,
+		EmailMXCheck:              getEnv("EMAIL_MX_CHECK", "false") == "true",
+		MTLSEnabled:               getEnv("MTLS_ENABLED", "false") == "true",
+		MTLSCAPath:                getEnv("MTLS_CA_PATH", ""),
+		MTLSAllowedSubjects:       splitList(getEnv("MTLS_ALLOWED_SUBJECTS", "")),
+		TLSCertPath:               getEnv("TLS_CERT_PATH", ""),
+		TLSKeyPath:                getEnv("TLS_KEY_PATH", ""),
+		HTTPRedirectPort:          getEnv("HTTP_REDIRECT_PORT", ""),
+		InsecureHTTP:              getEnv("INSECURE_HTTP", "false") == "true",
+		HealthPort:                getEnv("HEALTH_PORT", ""),
+		PprofAddr:                 getEnv("PPROF_ADDR", ""),
+		SentryDSN:                 env.secret("SENTRY_DSN"),
+		SentrySampleRate:          env.float("SENTRY_SAMPLE_RATE", "1"),
+		FFmpegTimeout:             ffmpegTimeout,
+		Loudness:                  loudness,
+		Watermark: Watermark{
+			Enabled:      getEnv("WATERMARK_ENABLED", "true") == "true",
+			LogoPath:     getEnv("WATERMARK_LOGO", ""),
+			AudioTagPath: getEnv("WATERMARK_AUDIO_TAG", ""),
+		},
+		PlanCapabilities: defaultCapabilities(),
+	}
+}
+
+// LogValue keeps secrets out of logs if the config is ever logged whole.
+func (c *Config) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("environment", c.Environment),
+		slog.String("port", c.Port),
+		slog.Int("replicas", len(c.DatabaseReplicaURLs)),
+		slog.String("storage", c.StorageType),
+		slog.String("jwt_algorithm", c.JWTAlgorithm),
+		slog.Bool("tls", c.TLSEnabled()),
+		slog.Bool("mtls", c.MTLSEnabled),
+	)
+}
+
+// TLSEnabled reports whether the server terminates TLS itself.
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCertPath != "" && c.TLSKeyPath != ""
+}
+
+// TextLimitsFor returns the text caps for a plan; Pro and Enterprise get
+// the higher tier.
+func (c *Config) TextLimitsFor(plan string) TextLimits {
+	switch plan {
+	case "pro", "enterprise":
+		return c.ProTextLimits
+	}
+	return c.TextLimits
+}
+
+// ActiveGenerationLimitFor returns how many generations may be running on
+// this instance before a user on plan is turned away; Pro and Enterprise
+// can be given more room.
+func (c *Config) ActiveGenerationLimitFor(plan string) int {
+	switch plan {
+	case "pro", "enterprise":
+		return c.ProMaxActiveGenerations
+	}
+	return c.MaxActiveGenerations
+}
+
+// envParser reads typed env values, collecting parse errors instead of
+// discarding them.
+type envParser struct {
+	errs []string
+}
+
+func (p *envParser) duration(key, defaultValue string) time.Duration {
+	d, err := time.ParseDuration(getEnv(key, defaultValue))
+	if err != nil {
+		p.errs = append(p.errs, fmt.Sprintf("%s: not a valid duration (e.g. 30s, 5m)", key))
+	}
+	return d
+}
+
+// time reads an optional RFC 3339 timestamp; unset is the zero time.
+func (p *envParser) time(key string) time.Time {
+	value := getEnv(key, "")
+	if value == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		p.errs = append(p.errs, fmt.Sprintf("%s: not a valid RFC 3339 time (e.g. 2025-01-31T12:00:00Z)", key))
+	}
+	return t
+}
+
+func (p *envParser) int(key, defaultValue string) int {
+	n, err := strconv.Atoi(getEnv(key, defaultValue))
+	if err != nil {
+		p.errs = append(p.errs, fmt.Sprintf("%s: not a valid integer", key))
+	}
+	return n
+}
+
+func (p *envParser) int64(key, defaultValue string) int64 {
+	n, err := strconv.ParseInt(getEnv(key, defaultValue), 10, 64)
+	if err != nil {
+		p.errs = append(p.errs, fmt.Sprintf("%s: not a valid integer", key))
+	}
+	return n
+}
+
+func (p *envParser) float(key, defaultValue string) float64 {
+	f, err := strconv.ParseFloat(getEnv(key, defaultValue), 64)
+	if err != nil {
+		p.errs = append(p.errs, fmt.Sprintf("%s: not a valid number", key))
 	}
+	return f
+}
+
+// secret reads key from the file named by key_FILE when that is set
+// (Docker and Kubernetes secret mounts), trimming trailing newlines, and
+// from key itself otherwise. Read errors name the file, never its content.
+func (p *envParser) secret(key string) string {
+	path := os.Getenv(key + "_FILE")
+	if path == "" {
+		return getEnv(key, "")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		p.errs = append(p.errs, fmt.Sprintf("%s_FILE: cannot read secret file: %v", key, err))
+		return ""
+	}
+	return strings.TrimRight(string(data), "\r\n")
 }
 
 func getEnv(key, defaultValue string) string {
@@ -62,3 +483,14 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// splitList parses a comma-separated env value, dropping empty entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
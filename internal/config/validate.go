@@ -0,0 +1,265 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"strings"
+
+	"github.com/zesbe/lumina-ai/internal/auth"
+	"github.com/zesbe/lumina-ai/internal/crypto"
+)
+
+// minJWTSecretLength is the shortest JWT_SECRET accepted in production;
+// HS256 wants at least as many bytes of key as the hash output.
+const minJWTSecretLength = 32
+
+// storageTypes are the STORAGE_TYPE values the server knows how to serve.
+var storageTypes = []string{"local"}
+
+var (
+	captchaProviders  = []string{"turnstile", "hcaptcha"}
+	captchaLoginModes = []string{"always", "after_failure", "off"}
+)
+
+// ValidationError lists every problem found in the configuration.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate checks the configuration before anything starts. Problems that
+// would make the server insecure or fail later are errors in production;
+// outside production the softer ones come back as warnings. A missing
+// JWT_SECRET in development is replaced with a random one, so tokens stop
+// working across restarts. JWTKeys is loaded here from the JWT settings,
+// and FieldKeys from ENCRYPTION_KEYS and ENCRYPTION_KEY.
+func (c *Config) Validate() (warnings []string, err error) {
+	problems := append([]string(nil), c.parseErrors...)
+	production := c.Environment == "production"
+
+	// strict is a problem in production and a warning elsewhere.
+	strict := func(format string, args ...interface{}) {
+		msg := fmt.Sprintf(format, args...)
+		if production {
+			problems = append(problems, msg)
+		} else {
+			warnings = append(warnings, msg)
+		}
+	}
+
+	switch {
+	case c.JWTSecret == "" && !production:
+		secret := make([]byte, minJWTSecretLength)
+		if _, err := rand.Read(secret); err != nil {
+			return warnings, err
+		}
+		c.JWTSecret = hex.EncodeToString(secret)
+		warnings = append(warnings, "JWT_SECRET is not set; using an ephemeral secret, tokens will not survive a restart")
+	case len(c.JWTSecret) < minJWTSecretLength:
+		strict("JWT_SECRET must be at least %d characters", minJWTSecretLength)
+	}
+
+	keys, err := auth.NewKeys(auth.KeyOptions{
+		Algorithm:          c.JWTAlgorithm,
+		Secret:             c.JWTSecret,
+		PrivateKey:         c.JWTPrivateKey,
+		PreviousPublicKeys: c.JWTPreviousPublicKeys,
+		HS256Until:         c.JWTHS256Until,
+	})
+	if err != nil {
+		problems = append(problems, err.Error())
+	} else {
+		c.JWTKeys = keys
+	}
+
+	if c.DatabaseURL == "" {
+		strict("DATABASE_URL is not set")
+	}
+
+	// Payment provider references are stored encrypted with these keys.
+	legacyKey := c.EncryptionKey
+	switch len(legacyKey) {
+	case 0, 16, 24, 32:
+	default:
+		problems = append(problems, "ENCRYPTION_KEY must be 16, 24 or 32 bytes for AES")
+		legacyKey = ""
+	}
+	fieldKeys, err := crypto.ParseKeyring(c.EncryptionKeys, legacyKey)
+	switch {
+	case err != nil:
+		problems = append(problems, "ENCRYPTION_KEYS: "+err.Error())
+	case fieldKeys == nil:
+		strict("ENCRYPTION_KEYS is not set; encrypted fields such as payment provider references can't be stored")
+	default:
+		c.FieldKeys = fieldKeys
+	}
+
+	if c.UploadMaxSize <= 0 {
+		problems = append(problems, "UPLOAD_MAX_SIZE must be positive")
+	}
+	if c.JSONBodyLimit <= 0 {
+		problems = append(problems, "JSON_BODY_LIMIT must be positive")
+	}
+	if !contains(storageTypes, c.StorageType) {
+		problems = append(problems, fmt.Sprintf("STORAGE_TYPE must be one of: %s", strings.Join(storageTypes, ", ")))
+	}
+
+	if c.JWTExpiry <= 0 || c.JWTRefreshExpiry <= 0 {
+		problems = append(problems, "JWT_EXPIRY and JWT_REFRESH_EXPIRY must be positive")
+	}
+	if c.RateLimitRequests <= 0 || c.RateLimitWindow <= 0 {
+		problems = append(problems, "RATE_LIMIT_REQUESTS and RATE_LIMIT_WINDOW must be positive")
+	}
+	if c.APIKeyRateLimit <= 0 {
+		problems = append(problems, "API_KEY_RATE_LIMIT must be positive")
+	}
+	if c.AuthTimeout <= 0 || c.RequestTimeout <= 0 || c.GenerateTimeout <= 0 {
+		problems = append(problems, "AUTH_TIMEOUT, REQUEST_TIMEOUT and GENERATE_TIMEOUT must be positive")
+	}
+	if c.MaxActiveGenerations <= 0 || c.ProMaxActiveGenerations <= 0 {
+		problems = append(problems, "MAX_ACTIVE_GENERATIONS and PRO_MAX_ACTIVE_GENERATIONS must be positive")
+	}
+	if c.DuplicateGenerationWindow < 0 {
+		problems = append(problems, "DUPLICATE_GENERATION_WINDOW must not be negative")
+	}
+	if c.ShutdownGracePeriod < 0 {
+		problems = append(problems, "SHUTDOWN_GRACE_PERIOD must not be negative")
+	}
+	if c.AccountDeletionGrace < 0 {
+		problems = append(problems, "ACCOUNT_DELETION_GRACE must not be negative")
+	}
+	if c.DataExportTTL <= 0 {
+		problems = append(problems, "DATA_EXPORT_TTL must be positive")
+	}
+	if c.FFmpegTimeout <= 0 {
+		problems = append(problems, "FFMPEG_TIMEOUT must be positive")
+	}
+	// The ranges loudnorm accepts.
+	if c.Loudness.Target < -70 || c.Loudness.Target > -5 {
+		problems = append(problems, "LOUDNESS_TARGET must be between -70 and -5 LUFS")
+	}
+	if c.Loudness.TruePeak < -9 || c.Loudness.TruePeak > 0 {
+		problems = append(problems, "LOUDNESS_TRUE_PEAK must be between -9 and 0 dBTP")
+	}
+
+	if err := c.DBPool.Validate(); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if err := c.LoginLockout.Validate(); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if err := c.Argon2.Validate(); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if !allOrNone(c.GoogleClientID, c.GoogleClientSecret, c.GoogleRedirectURL) {
+		problems = append(problems, "GOOGLE_CLIENT_ID, GOOGLE_CLIENT_SECRET and GOOGLE_REDIRECT_URL must be set together")
+	}
+	if !allOrNone(c.GitHubClientID, c.GitHubClientSecret, c.GitHubRedirectURL) {
+		problems = append(problems, "GITHUB_CLIENT_ID, GITHUB_CLIENT_SECRET and GITHUB_REDIRECT_URL must be set together")
+	}
+	if c.SMTPHost == "" && production {
+		warnings = append(warnings, "SMTP_HOST is not set; emails are logged instead of sent")
+	}
+	if _, err := mail.ParseAddress(c.MailFrom); err != nil {
+		problems = append(problems, "MAIL_FROM must be an email address")
+	}
+	if u, err := url.Parse(c.AppURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		problems = append(problems, "APP_URL must be an absolute http(s) URL, e.g. https://lumina.example.com")
+	}
+	if c.PublicBaseURL != "" {
+		if u, err := url.Parse(c.PublicBaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+			problems = append(problems, "PUBLIC_BASE_URL must be an absolute http(s) URL without a query, e.g. https://api.lumina.example.com")
+		}
+	} else if production {
+		warnings = append(warnings, "PUBLIC_BASE_URL is not set; media URLs are made absolute against each request's host")
+	}
+	if c.DisposableDomainsURL != "" {
+		if u, err := url.Parse(c.DisposableDomainsURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, "DISPOSABLE_DOMAINS_URL must be an absolute http(s) URL")
+		}
+		if c.DisposableDomainsRefresh <= 0 {
+			problems = append(problems, "DISPOSABLE_DOMAINS_REFRESH must be positive")
+		}
+	}
+	if c.Captcha.Enabled() {
+		if !contains(captchaProviders, c.Captcha.Provider) {
+			problems = append(problems, fmt.Sprintf("CAPTCHA_PROVIDER must be one of: %s", strings.Join(captchaProviders, ", ")))
+		}
+		if !contains(captchaLoginModes, c.Captcha.Login) {
+			problems = append(problems, fmt.Sprintf("CAPTCHA_LOGIN must be one of: %s", strings.Join(captchaLoginModes, ", ")))
+		}
+		if c.Captcha.VerifyURL != "" {
+			if u, err := url.Parse(c.Captcha.VerifyURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				problems = append(problems, "CAPTCHA_VERIFY_URL must be an absolute http(s) URL")
+			}
+		}
+		if c.Captcha.Timeout <= 0 {
+			problems = append(problems, "CAPTCHA_TIMEOUT must be positive")
+		}
+	}
+	if (c.TLSCertPath == "") != (c.TLSKeyPath == "") {
+		problems = append(problems, "TLS_CERT_PATH and TLS_KEY_PATH must be set together")
+	}
+	if c.MTLSEnabled && (c.MTLSCAPath == "" || !c.TLSEnabled()) {
+		problems = append(problems, "MTLS_CA_PATH, TLS_CERT_PATH and TLS_KEY_PATH are required when MTLS_ENABLED is true")
+	}
+	if c.HTTPRedirectPort != "" && !c.TLSEnabled() {
+		problems = append(problems, "HTTP_REDIRECT_PORT needs TLS_CERT_PATH and TLS_KEY_PATH")
+	}
+	if c.PprofAddr != "" && !isLoopback(c.PprofAddr) {
+		problems = append(problems, "PPROF_ADDR must be a loopback address such as 127.0.0.1:6060; the profiler has no authentication there")
+	}
+	if c.SentrySampleRate <= 0 || c.SentrySampleRate > 1 {
+		problems = append(problems, "SENTRY_SAMPLE_RATE must be greater than 0 and at most 1")
+	}
+	if production && !c.TLSEnabled() && !c.InsecureHTTP {
+		problems = append(problems, "TLS is disabled in production; set TLS_CERT_PATH and TLS_KEY_PATH, or INSECURE_HTTP=true behind a TLS-terminating proxy")
+	}
+
+	if len(problems) > 0 {
+		return warnings, &ValidationError{Problems: problems}
+	}
+	return warnings, nil
+}
+
+// allOrNone reports whether the values are all set or all empty.
+func allOrNone(values ...string) bool {
+	set := 0
+	for _, v := range values {
+		if v != "" {
+			set++
+		}
+	}
+	return set == 0 || set == len(values)
+}
+
+// isLoopback reports whether addr is a host:port that only accepts local
+// connections.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,219 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+// productionEnv is an environment Validate accepts in production without
+// warnings.
+var productionEnv = map[string]string{
+	"ENVIRONMENT":     "production",
+	"JWT_SECRET":      testSecret,
+	"DATABASE_URL":    "postgres://lumina@db/lumina",
+	"ENCRYPTION_KEY":  "abcdefghijklmnopqrstuvwxyz012345",
+	"SMTP_HOST":       "smtp.example.com",
+	"MAIL_FROM":       "noreply@lumina.example.com",
+	"APP_URL":         "https://lumina.example.com",
+	"PUBLIC_BASE_URL": "https://api.lumina.example.com",
+	"INSECURE_HTTP":   "true",
+}
+
+// load reads the configuration from productionEnv with overrides applied;
+// an empty override unsets the variable.
+func load(t *testing.T, overrides map[string]string) *Config {
+	t.Helper()
+	for _, kv := range os.Environ() {
+		key, _, _ := strings.Cut(kv, "=")
+		if key != "PATH" && key != "HOME" && key != "TMPDIR" {
+			t.Setenv(key, "")
+			os.Unsetenv(key)
+		}
+	}
+	for key, value := range productionEnv {
+		t.Setenv(key, value)
+	}
+	for key, value := range overrides {
+		t.Setenv(key, value)
+		if value == "" {
+			os.Unsetenv(key)
+		}
+	}
+	return Load()
+}
+
+func TestValidateAcceptsProduction(t *testing.T) {
+	cfg := load(t, nil)
+	warnings, err := cfg.Validate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("warnings %q, want none", warnings)
+	}
+	if cfg.JWTKeys == nil || cfg.FieldKeys == nil {
+		t.Error("Validate didn't load the JWT and field keys")
+	}
+}
+
+func TestValidateProblems(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{"missing JWT secret", map[string]string{"JWT_SECRET": ""}, "JWT_SECRET must be at least 32 characters"},
+		{"short JWT secret", map[string]string{"JWT_SECRET": "short"}, "JWT_SECRET must be at least 32 characters"},
+		{"missing database", map[string]string{"DATABASE_URL": ""}, "DATABASE_URL is not set"},
+		{"bad duration", map[string]string{"JWT_EXPIRY": "15 minutes"}, "JWT_EXPIRY: not a valid duration"},
+		{"bad integer", map[string]string{"RATE_LIMIT_REQUESTS": "lots"}, "RATE_LIMIT_REQUESTS: not a valid integer"},
+		{"bad number", map[string]string{"LOUDNESS_TARGET": "loud"}, "LOUDNESS_TARGET: not a valid number"},
+		{"zero expiry", map[string]string{"JWT_EXPIRY": "0s"}, "JWT_EXPIRY and JWT_REFRESH_EXPIRY must be positive"},
+		{"zero upload size", map[string]string{"UPLOAD_MAX_SIZE": "0"}, "UPLOAD_MAX_SIZE must be positive"},
+		{"negative upload size", map[string]string{"UPLOAD_MAX_SIZE": "-1"}, "UPLOAD_MAX_SIZE must be positive"},
+		{"zero body limit", map[string]string{"JSON_BODY_LIMIT": "0"}, "JSON_BODY_LIMIT must be positive"},
+		{"unknown storage", map[string]string{"STORAGE_TYPE": "s3"}, "STORAGE_TYPE must be one of: local"},
+		{"AES key length", map[string]string{"ENCRYPTION_KEY": "too-short"}, "ENCRYPTION_KEY must be 16, 24 or 32 bytes for AES"},
+		{"no encryption keys", map[string]string{"ENCRYPTION_KEY": ""}, "ENCRYPTION_KEYS is not set"},
+		{"unreadable secret file", map[string]string{"JWT_SECRET_FILE": "/nonexistent/jwt"}, "JWT_SECRET_FILE: cannot read secret file"},
+		{"negative grace", map[string]string{"SHUTDOWN_GRACE_PERIOD": "-1s"}, "SHUTDOWN_GRACE_PERIOD must not be negative"},
+		{"loudness range", map[string]string{"LOUDNESS_TARGET": "-2"}, "LOUDNESS_TARGET must be between -70 and -5 LUFS"},
+		{"partial oauth", map[string]string{"GOOGLE_CLIENT_ID": "id"}, "GOOGLE_CLIENT_ID, GOOGLE_CLIENT_SECRET and GOOGLE_REDIRECT_URL must be set together"},
+		{"bad mail from", map[string]string{"MAIL_FROM": "not an address"}, "MAIL_FROM must be an email address"},
+		{"relative app url", map[string]string{"APP_URL": "lumina.example.com"}, "APP_URL must be an absolute http(s) URL"},
+		{"base url with query", map[string]string{"PUBLIC_BASE_URL": "https://cdn.example.com/?a=1"}, "PUBLIC_BASE_URL must be an absolute http(s) URL without a query"},
+		{"unknown captcha provider", map[string]string{"CAPTCHA_SECRET": "s", "CAPTCHA_PROVIDER": "recaptcha"}, "CAPTCHA_PROVIDER must be one of"},
+		{"half TLS", map[string]string{"TLS_CERT_PATH": "/tls/cert.pem"}, "TLS_CERT_PATH and TLS_KEY_PATH must be set together"},
+		{"mTLS without TLS", map[string]string{"MTLS_ENABLED": "true", "MTLS_CA_PATH": "/tls/ca.pem"}, "MTLS_CA_PATH, TLS_CERT_PATH and TLS_KEY_PATH are required"},
+		{"public pprof", map[string]string{"PPROF_ADDR": "0.0.0.0:6060"}, "PPROF_ADDR must be a loopback address"},
+		{"sample rate", map[string]string{"SENTRY_SAMPLE_RATE": "0"}, "SENTRY_SAMPLE_RATE must be greater than 0"},
+		{"argon2 memory", map[string]string{"ARGON2_MEMORY": "4096"}, "ARGON2_MEMORY must be between 8192 and 1048576 KiB"},
+		{"argon2 iterations", map[string]string{"ARGON2_ITERATIONS": "0"}, "ARGON2_ITERATIONS must be between 1 and 20"},
+		{"argon2 parallelism", map[string]string{"ARGON2_PARALLELISM": "17"}, "ARGON2_PARALLELISM must be between 1 and 16"},
+		{"plain HTTP in production", map[string]string{"INSECURE_HTTP": ""}, "TLS is disabled in production"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := load(t, tt.env).Validate()
+			verr, ok := err.(*ValidationError)
+			if !ok {
+				t.Fatalf("Validate = %v, want a *ValidationError", err)
+			}
+			for _, p := range verr.Problems {
+				if strings.Contains(p, tt.want) {
+					return
+				}
+			}
+			t.Errorf("problems %q, want one containing %q", verr.Problems, tt.want)
+		})
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	_, err := load(t, map[string]string{"JWT_SECRET": "", "DATABASE_URL": "", "UPLOAD_MAX_SIZE": "0", "STORAGE_TYPE": "ftp"}).Validate()
+	verr, ok := err.(*ValidationError)
+	if !ok || len(verr.Problems) != 4 {
+		t.Fatalf("Validate = %v, want 4 problems", err)
+	}
+	if msg := err.Error(); !strings.HasPrefix(msg, "invalid configuration: ") || strings.Count(msg, "; ") != 3 {
+		t.Errorf("Error() = %q", msg)
+	}
+}
+
+func TestValidateDevelopmentWarns(t *testing.T) {
+	cfg := load(t, map[string]string{
+		"ENVIRONMENT":    "development",
+		"JWT_SECRET":     "",
+		"DATABASE_URL":   "",
+		"ENCRYPTION_KEY": "",
+		"INSECURE_HTTP":  "",
+	})
+	warnings, err := cfg.Validate()
+	if err != nil {
+		t.Fatalf("Validate = %v, want only warnings in development", err)
+	}
+	if len(cfg.JWTSecret) < minJWTSecretLength {
+		t.Errorf("JWT secret %q, want a generated one", cfg.JWTSecret)
+	}
+	if cfg.JWTKeys == nil {
+		t.Error("no JWT keys from the generated secret")
+	}
+	for _, want := range []string{"ephemeral secret", "DATABASE_URL is not set", "ENCRYPTION_KEYS is not set"} {
+		found := false
+		for _, w := range warnings {
+			found = found || strings.Contains(w, want)
+		}
+		if !found {
+			t.Errorf("warnings %q, want one containing %q", warnings, want)
+		}
+	}
+
+	// Each start gets its own secret, and a short one is still a warning.
+	other := load(t, map[string]string{"ENVIRONMENT": "development", "JWT_SECRET": ""})
+	other.Validate()
+	if other.JWTSecret == cfg.JWTSecret {
+		t.Error("two starts generated the same JWT secret")
+	}
+	short := load(t, map[string]string{"ENVIRONMENT": "development", "JWT_SECRET": "short"})
+	if _, err := short.Validate(); err != nil {
+		t.Errorf("short secret in development: %v, want a warning", err)
+	}
+
+	// Hard errors stay errors outside production.
+	if _, err := load(t, map[string]string{"ENVIRONMENT": "development", "UPLOAD_MAX_SIZE": "0"}).Validate(); err == nil {
+		t.Error("UPLOAD_MAX_SIZE=0 passed in development")
+	}
+}
+
+func TestSecretFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jwt")
+	if err := os.WriteFile(path, []byte(testSecret+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := load(t, map[string]string{"JWT_SECRET": "ignored", "JWT_SECRET_FILE": path})
+	if cfg.JWTSecret != testSecret {
+		t.Errorf("JWTSecret = %q, want the file's content without the newline", cfg.JWTSecret)
+	}
+	if _, err := cfg.Validate(); err != nil {
+		t.Error(err)
+	}
+	if cfg.JWTExpiry != 15*time.Minute {
+		t.Errorf("JWTExpiry = %v, want the 15m default", cfg.JWTExpiry)
+	}
+}
+
+func TestSecretFromFileTrimsTrailingNewlines(t *testing.T) {
+	tests := []struct{ name, content, want string }{
+		{"newline", testSecret + "\n", testSecret},
+		{"CRLF", testSecret + "\r\n", testSecret},
+		{"several newlines", testSecret + "\n\n", testSecret},
+		{"no newline", testSecret, testSecret},
+		{"other whitespace kept", " " + testSecret + "\t\n", " " + testSecret + "\t"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "jwt")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if got := load(t, map[string]string{"JWT_SECRET_FILE": path}).JWTSecret; got != tt.want {
+				t.Errorf("JWTSecret = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSecretFallsBackToEnv(t *testing.T) {
+	cfg := load(t, map[string]string{"JWT_SECRET_FILE": ""})
+	if cfg.JWTSecret != testSecret {
+		t.Errorf("JWTSecret = %q, want JWT_SECRET when JWT_SECRET_FILE is unset", cfg.JWTSecret)
+	}
+	if _, err := cfg.Validate(); err != nil {
+		t.Error(err)
+	}
+}
@@ -31,32 +31,43 @@ func NewAESCrypto(key string) (*AESCrypto, error) {
 }
 
 func (a *AESCrypto) Encrypt(plaintext []byte) (string, error) {
-	block, err := aes.NewCipher(a.key)
+	ciphertext, err := a.seal(nil, plaintext)
 	if err != nil {
 		return "", err
 	}
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+func (a *AESCrypto) Decrypt(ciphertextB64 string) ([]byte, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(ciphertextB64)
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+	return a.open(ciphertext)
+}
+
+// seal appends the nonce and the sealed plaintext to dst.
+func (a *AESCrypto) seal(dst, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(a.key)
+	if err != nil {
+		return nil, err
+	}
 
 	gcm, err := cipher.NewGCM(block)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	nonce := make([]byte, gcm.NonceSize())
 	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return "", err
+		return nil, err
 	}
 
-	ciphertext := gcm.Seal(nonce, nonce, plaintext, nil)
-
-	return base64.StdEncoding.EncodeToString(ciphertext), nil
+	return gcm.Seal(append(dst, nonce...), nonce, plaintext, nil), nil
 }
 
-func (a *AESCrypto) Decrypt(ciphertextB64 string) ([]byte, error) {
-	ciphertext, err := base64.StdEncoding.DecodeString(ciphertextB64)
-	if err != nil {
-		return nil, ErrInvalidCiphertext
-	}
-
+// open reverses seal for a ciphertext that starts with its nonce.
+func (a *AESCrypto) open(ciphertext []byte) ([]byte, error) {
 	block, err := aes.NewCipher(a.key)
 	if err != nil {
 		return nil, err
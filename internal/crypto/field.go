@@ -0,0 +1,131 @@
+package crypto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm/schema"
+)
+
+// Model fields tagged `gorm:"serializer:encrypted"` are stored encrypted
+// with the newest key in the field keyring and decrypted when read.
+// Stored values carry versionedPrefix and name their key version.
+// Values with legacyPrefix were written with ENCRYPTION_KEY before keys
+// were versioned and are read with the version 0 key. Values with
+// neither were written before the field was encrypted and are read as
+// they are. EncryptFields in the database package rewrites both kinds,
+// and values under old versions, with the newest key. Empty strings are
+// stored empty, so "is it set" queries keep working.
+const (
+	versionedPrefix = "encv:"
+	legacyPrefix    = "enc:"
+)
+
+// ErrNoFieldKey is writing an encrypted field without a key.
+var ErrNoFieldKey = errors.New("ENCRYPTION_KEYS is not set; encrypted fields can't be written")
+
+var fieldKeys *Keyring
+
+func init() {
+	schema.RegisterSerializer("encrypted", EncryptedSerializer{})
+}
+
+// SetFieldKeys sets the keys encrypted fields use. Without any they are
+// unreadable and unwritable, apart from empty values.
+func SetFieldKeys(keys *Keyring) {
+	fieldKeys = keys
+}
+
+// IsEncrypted reports whether a stored value is encrypted, with any key.
+func IsEncrypted(stored string) bool {
+	return strings.HasPrefix(stored, versionedPrefix) || strings.HasPrefix(stored, legacyPrefix)
+}
+
+// IsCurrent reports whether a stored value is encrypted with the newest
+// key, or is empty, so EncryptField would leave it as it is.
+func IsCurrent(stored string) bool {
+	if stored == "" {
+		return true
+	}
+	if fieldKeys == nil || !strings.HasPrefix(stored, versionedPrefix) {
+		return false
+	}
+	version, err := fieldKeys.Version(strings.TrimPrefix(stored, versionedPrefix))
+	return err == nil && version == fieldKeys.Current()
+}
+
+// EncryptField is the stored form of an encrypted field's value.
+func EncryptField(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	if fieldKeys == nil {
+		return "", ErrNoFieldKey
+	}
+	ciphertext, err := fieldKeys.Encrypt([]byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	return versionedPrefix + ciphertext, nil
+}
+
+// DecryptField reads a stored value back. Values stored before the field
+// was encrypted come back unchanged.
+func DecryptField(stored string) (string, error) {
+	if !IsEncrypted(stored) {
+		return stored, nil
+	}
+	if fieldKeys == nil {
+		return "", ErrNoFieldKey
+	}
+	var plaintext []byte
+	var err error
+	if ciphertext, ok := strings.CutPrefix(stored, versionedPrefix); ok {
+		plaintext, err = fieldKeys.Decrypt(ciphertext)
+	} else {
+		plaintext, err = fieldKeys.DecryptLegacy(strings.TrimPrefix(stored, legacyPrefix))
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// EncryptedSerializer is the GORM serializer behind the "encrypted" tag.
+// It supports string fields.
+type EncryptedSerializer struct{}
+
+// Scan decrypts the column into the field.
+func (EncryptedSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var stored string
+	switch v := dbValue.(type) {
+	case nil:
+	case string:
+		stored = v
+	case []byte:
+		stored = string(v)
+	default:
+		return fmt.Errorf("encrypted field %s: unsupported column value %T", field.Name, dbValue)
+	}
+	plaintext, err := DecryptField(stored)
+	if err != nil {
+		return fmt.Errorf("encrypted field %s: %w", field.Name, err)
+	}
+	return field.Set(ctx, dst, plaintext)
+}
+
+// Value encrypts the field for the column.
+func (EncryptedSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	plaintext, ok := fieldValue.(string)
+	if !ok {
+		return nil, fmt.Errorf("encrypted field %s: only strings can be encrypted, got %T", field.Name, fieldValue)
+	}
+	stored, err := EncryptField(plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("encrypted field %s: %w", field.Name, err)
+	}
+	return stored, nil
+}
@@ -2,8 +2,10 @@ package crypto
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"crypto/subtle"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"strings"
@@ -34,9 +36,53 @@ func DefaultArgon2Params() *Argon2Params {
 	}
 }
 
+// Bounds on configured Argon2 parameters. Below them hashes are cheap to
+// crack; above them a login ties up too much of a small container.
+const (
+	minArgon2Memory      = 8 * 1024
+	maxArgon2Memory      = 1024 * 1024
+	maxArgon2Iterations  = 20
+	maxArgon2Parallelism = 16
+)
+
+// passwordParams are the parameters new hashes are made with.
+var passwordParams = DefaultArgon2Params()
+
+// Validate rejects parameters outside the bounds above.
+func (p *Argon2Params) Validate() error {
+	switch {
+	case p.Memory < minArgon2Memory || p.Memory > maxArgon2Memory:
+		return fmt.Errorf("ARGON2_MEMORY must be between %d and %d KiB, got %d", minArgon2Memory, maxArgon2Memory, p.Memory)
+	case p.Iterations < 1 || p.Iterations > maxArgon2Iterations:
+		return fmt.Errorf("ARGON2_ITERATIONS must be between 1 and %d, got %d", maxArgon2Iterations, p.Iterations)
+	case p.Parallelism < 1 || p.Parallelism > maxArgon2Parallelism:
+		return fmt.Errorf("ARGON2_PARALLELISM must be between 1 and %d, got %d", maxArgon2Parallelism, p.Parallelism)
+	case p.SaltLength < 16 || p.KeyLength < 32:
+		return errors.New("argon2 salts must be at least 16 bytes and keys at least 32")
+	}
+	return nil
+}
+
+// SetPasswordParams makes params the ones new hashes are made with, and
+// the target NeedsRehash compares stored hashes to.
+func SetPasswordParams(params *Argon2Params) {
+	passwordParams = params
+}
+
 func HashPassword(password string) (string, error) {
-	params := DefaultArgon2Params()
-	return HashPasswordWithParams(password, params)
+	return HashPasswordWithParams(password, passwordParams)
+}
+
+// NeedsRehash reports whether encodedHash was made with parameters other
+// than the current ones, so it should be replaced the next time the
+// password is known. Hashes that can't be read are left alone; they don't
+// verify either.
+func NeedsRehash(encodedHash string) bool {
+	params, _, _, err := decodeHash(encodedHash)
+	if err != nil {
+		return false
+	}
+	return *params != *passwordParams
 }
 
 func HashPasswordWithParams(password string, params *Argon2Params) (string, error) {
@@ -157,3 +203,11 @@ func GenerateSecurePassword(length int) (string, error) {
 
 	return string(password), nil
 }
+
+// HashToken is the stored form of a bearer secret such as a refresh token.
+// The secret is already random, so a plain SHA-256 is enough: there is
+// nothing to brute-force.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
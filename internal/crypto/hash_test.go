@@ -0,0 +1,111 @@
+package crypto
+
+import (
+	"strings"
+	"testing"
+)
+
+// cheapParams keeps the hashing in these tests fast.
+var cheapParams = Argon2Params{Memory: 8 * 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+// withPasswordParams makes params the current ones for the rest of the test.
+func withPasswordParams(t *testing.T, params Argon2Params) {
+	t.Helper()
+	previous := passwordParams
+	SetPasswordParams(&params)
+	t.Cleanup(func() { SetPasswordParams(previous) })
+}
+
+func TestNeedsRehash(t *testing.T) {
+	withPasswordParams(t, cheapParams)
+	current, err := HashPassword("Str0ng!Passw0rd#")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if NeedsRehash(current) {
+		t.Errorf("%s needs a rehash under the parameters it was made with", current)
+	}
+
+	tests := []struct {
+		name   string
+		change func(*Argon2Params)
+	}{
+		{"more memory", func(p *Argon2Params) { p.Memory *= 2 }},
+		{"more iterations", func(p *Argon2Params) { p.Iterations++ }},
+		{"more threads", func(p *Argon2Params) { p.Parallelism++ }},
+		{"longer salt", func(p *Argon2Params) { p.SaltLength = 32 }},
+		{"longer key", func(p *Argon2Params) { p.KeyLength = 64 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := cheapParams
+			tt.change(&params)
+			withPasswordParams(t, params)
+			if !NeedsRehash(current) {
+				t.Errorf("%s doesn't need a rehash under %+v", current, params)
+			}
+			// The old hash keeps verifying until it is replaced.
+			if ok, err := VerifyPassword("Str0ng!Passw0rd#", current); !ok || err != nil {
+				t.Errorf("VerifyPassword = %v, %v", ok, err)
+			}
+			rehashed, err := HashPassword("Str0ng!Passw0rd#")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if NeedsRehash(rehashed) {
+				t.Errorf("%s still needs a rehash", rehashed)
+			}
+		})
+	}
+
+	for _, hash := range []string{"", "plain", "$argon2i$v=19$m=8192,t=1,p=1$c2FsdA$aGFzaA", strings.Replace(current, "v=19", "v=16", 1)} {
+		if NeedsRehash(hash) {
+			t.Errorf("NeedsRehash(%q) = true for a hash that can't be read", hash)
+		}
+	}
+}
+
+func TestHashPasswordUsesCurrentParams(t *testing.T) {
+	withPasswordParams(t, Argon2Params{Memory: 16 * 1024, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+	hash, err := HashPassword("Str0ng!Passw0rd#")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=16384,t=2,p=1$") {
+		t.Errorf("hash %s, want one made with m=16384,t=2,p=1", hash)
+	}
+	if ok, _ := VerifyPassword("wrong", hash); ok {
+		t.Error("a wrong password verified")
+	}
+}
+
+func TestArgon2ParamsValidate(t *testing.T) {
+	if err := DefaultArgon2Params().Validate(); err != nil {
+		t.Errorf("defaults: %v", err)
+	}
+	tests := []struct {
+		name   string
+		change func(*Argon2Params)
+		valid  bool
+	}{
+		{"least memory", func(p *Argon2Params) { p.Memory = 8 * 1024 }, true},
+		{"too little memory", func(p *Argon2Params) { p.Memory = 8*1024 - 1 }, false},
+		{"most memory", func(p *Argon2Params) { p.Memory = 1024 * 1024 }, true},
+		{"too much memory", func(p *Argon2Params) { p.Memory = 1024*1024 + 1 }, false},
+		{"no iterations", func(p *Argon2Params) { p.Iterations = 0 }, false},
+		{"too many iterations", func(p *Argon2Params) { p.Iterations = 21 }, false},
+		{"no threads", func(p *Argon2Params) { p.Parallelism = 0 }, false},
+		{"too many threads", func(p *Argon2Params) { p.Parallelism = 17 }, false},
+		{"short salt", func(p *Argon2Params) { p.SaltLength = 8 }, false},
+		{"short key", func(p *Argon2Params) { p.KeyLength = 16 }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := DefaultArgon2Params()
+			tt.change(params)
+			if err := params.Validate(); (err == nil) != tt.valid {
+				t.Errorf("Validate = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
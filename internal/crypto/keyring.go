@@ -0,0 +1,121 @@
+package crypto
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrUnknownKeyVersion is a ciphertext made with a key no longer in the
+// keyring.
+var ErrUnknownKeyVersion = errors.New("ciphertext was encrypted with an unknown key version")
+
+// Keyring holds the AES keys in use, each under a version from 0 to 255.
+// Encrypt uses the newest; Decrypt picks the key by the version byte the
+// ciphertext starts with, so rotating in a new key leaves everything
+// written with the old ones readable until it is re-encrypted.
+type Keyring struct {
+	current byte
+	keys    map[byte]*AESCrypto
+}
+
+// ParseKeyring reads a comma- or newline-separated list of version:key
+// entries, newest first, as ENCRYPTION_KEYS holds it. legacy, the single
+// ENCRYPTION_KEY from before keys were versioned, joins the list as
+// version 0 unless the list has its own version 0, and is the only key
+// when the list is empty. With neither it returns nil.
+func ParseKeyring(list, legacy string) (*Keyring, error) {
+	entries := strings.FieldsFunc(list, func(r rune) bool { return r == ',' || r == '\n' })
+	k := &Keyring{keys: make(map[byte]*AESCrypto)}
+	for i, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		v, key, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("key %d: want version:key", i+1)
+		}
+		version, err := strconv.ParseUint(v, 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("key %d: version must be a number from 0 to 255", i+1)
+		}
+		if _, dup := k.keys[byte(version)]; dup {
+			return nil, fmt.Errorf("key %d: version %d is listed twice", i+1, version)
+		}
+		aes, err := NewAESCrypto(key)
+		if err != nil {
+			return nil, fmt.Errorf("key %d (version %d): %w", i+1, version, err)
+		}
+		if len(k.keys) == 0 {
+			k.current = byte(version)
+		}
+		k.keys[byte(version)] = aes
+	}
+	if _, ok := k.keys[0]; !ok && legacy != "" {
+		aes, err := NewAESCrypto(legacy)
+		if err != nil {
+			return nil, err
+		}
+		k.keys[0] = aes
+	}
+	if len(k.keys) == 0 {
+		return nil, nil
+	}
+	return k, nil
+}
+
+// Current is the version new ciphertexts are made with.
+func (k *Keyring) Current() byte {
+	return k.current
+}
+
+// Encrypt seals plaintext with the newest key and returns the key version,
+// nonce and ciphertext, base64-encoded.
+func (k *Keyring) Encrypt(plaintext []byte) (string, error) {
+	sealed, err := k.keys[k.current].seal([]byte{k.current}, plaintext)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a ciphertext made by Encrypt with any key still in the
+// keyring.
+func (k *Keyring) Decrypt(ciphertextB64 string) ([]byte, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(ciphertextB64)
+	if err != nil || len(ciphertext) == 0 {
+		return nil, ErrInvalidCiphertext
+	}
+	return k.open(ciphertext[0], ciphertext[1:])
+}
+
+// Version is the key version a ciphertext made by Encrypt names.
+func (k *Keyring) Version(ciphertextB64 string) (byte, error) {
+	// Four base64 characters hold the first three bytes.
+	if len(ciphertextB64) < 4 {
+		return 0, ErrInvalidCiphertext
+	}
+	head, err := base64.StdEncoding.DecodeString(ciphertextB64[:4])
+	if err != nil {
+		return 0, ErrInvalidCiphertext
+	}
+	return head[0], nil
+}
+
+// DecryptLegacy opens a ciphertext from AESCrypto, which has no version
+// byte, with the version 0 key.
+func (k *Keyring) DecryptLegacy(ciphertextB64 string) ([]byte, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(ciphertextB64)
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+	return k.open(0, ciphertext)
+}
+
+func (k *Keyring) open(version byte, ciphertext []byte) ([]byte, error) {
+	aes, ok := k.keys[version]
+	if !ok {
+		return nil, fmt.Errorf("%w %d", ErrUnknownKeyVersion, version)
+	}
+	return aes.open(ciphertext)
+}
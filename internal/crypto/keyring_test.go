@@ -0,0 +1,193 @@
+package crypto
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const (
+	key0 = "version-0-key-is-32-bytes-long!!"
+	key1 = "version-1-key-is-32-bytes-long!!"
+	key2 = "version-2-key-is-32-bytes-long!!"
+)
+
+func keyring(t *testing.T, list, legacy string) *Keyring {
+	t.Helper()
+	k, err := ParseKeyring(list, legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+// withFieldKeys makes keys the field keys for the rest of the test.
+func withFieldKeys(t *testing.T, keys *Keyring) {
+	t.Helper()
+	previous := fieldKeys
+	SetFieldKeys(keys)
+	t.Cleanup(func() { SetFieldKeys(previous) })
+}
+
+func TestParseKeyring(t *testing.T) {
+	tests := []struct {
+		name     string
+		list     string
+		legacy   string
+		current  byte
+		versions []byte
+		wantErr  string
+	}{
+		{name: "legacy key alone", legacy: key0, current: 0, versions: []byte{0}},
+		{name: "newest first", list: "2:" + key2 + ", 1:" + key1, current: 2, versions: []byte{2, 1}},
+		{name: "legacy joins as version 0", list: "1:" + key1, legacy: key0, current: 1, versions: []byte{1, 0}},
+		{name: "listed version 0 wins over legacy", list: "1:" + key1 + "\n0:" + key2, legacy: key0, current: 1, versions: []byte{1, 0}},
+		{name: "nothing", current: 0},
+		{name: "no version", list: key1, wantErr: "key 1: want version:key"},
+		{name: "version out of range", list: "256:" + key1, wantErr: "key 1: version must be a number from 0 to 255"},
+		{name: "duplicate version", list: "1:" + key1 + ",1:" + key2, wantErr: "key 2: version 1 is listed twice"},
+		{name: "short key", list: "1:short", wantErr: "key 1 (version 1)"},
+		{name: "short legacy key", legacy: "short", wantErr: ErrInvalidKey.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := ParseKeyring(tt.list, tt.legacy)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tt.versions) == 0 {
+				if k != nil {
+					t.Errorf("keyring %+v, want nil", k)
+				}
+				return
+			}
+			if k.Current() != tt.current || len(k.keys) != len(tt.versions) {
+				t.Errorf("current %d with %d keys, want %d with %v", k.Current(), len(k.keys), tt.current, tt.versions)
+			}
+			for _, v := range tt.versions {
+				if _, ok := k.keys[v]; !ok {
+					t.Errorf("no version %d key", v)
+				}
+			}
+		})
+	}
+
+	// The listed version 0 is used, not the legacy key.
+	k := keyring(t, "1:"+key1+",0:"+key2, key0)
+	if string(k.keys[0].key) != key2 {
+		t.Error("version 0 is the legacy key, want the listed one")
+	}
+}
+
+func TestKeyringRotation(t *testing.T) {
+	before := keyring(t, "", key0)
+	old, err := before.Encrypt([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	after := keyring(t, "1:"+key1, key0)
+	fresh, err := after.Encrypt([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name       string
+		ciphertext string
+		version    byte
+	}{
+		{"written before the rotation", old, 0},
+		{"written after it", fresh, 1},
+	} {
+		if v, err := after.Version(tt.ciphertext); err != nil || v != tt.version {
+			t.Errorf("%s: Version = %d, %v; want %d", tt.name, v, err, tt.version)
+		}
+		if plaintext, err := after.Decrypt(tt.ciphertext); err != nil || string(plaintext) != "secret" {
+			t.Errorf("%s: Decrypt = %q, %v", tt.name, plaintext, err)
+		}
+	}
+
+	// Once version 0 is dropped its ciphertexts name a key that is gone.
+	retired := keyring(t, "1:"+key1, "")
+	if _, err := retired.Decrypt(old); !errors.Is(err, ErrUnknownKeyVersion) {
+		t.Errorf("Decrypt with the key retired: %v, want ErrUnknownKeyVersion", err)
+	}
+	if plaintext, err := retired.Decrypt(fresh); err != nil || string(plaintext) != "secret" {
+		t.Errorf("Decrypt with the current key = %q, %v", plaintext, err)
+	}
+
+	// A key under the right version that isn't the one used fails
+	// authentication rather than returning garbage.
+	wrong := keyring(t, "1:"+key2, "")
+	if _, err := wrong.Decrypt(fresh); err == nil {
+		t.Error("Decrypt with another key under the same version succeeded")
+	}
+	for _, bad := range []string{"", "abc", "not base64!"} {
+		if _, err := after.Version(bad); !errors.Is(err, ErrInvalidCiphertext) {
+			t.Errorf("Version(%q) = %v, want ErrInvalidCiphertext", bad, err)
+		}
+	}
+}
+
+func TestFieldEncryption(t *testing.T) {
+	aes, err := NewAESCrypto(key0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacyCiphertext, err := aes.Encrypt([]byte("from before versions"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy := legacyPrefix + legacyCiphertext
+
+	withFieldKeys(t, keyring(t, "", key0))
+	v0, err := EncryptField("written under v0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	withFieldKeys(t, keyring(t, "1:"+key1, key0))
+	v1, err := EncryptField("written under v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		stored  string
+		want    string
+		current bool
+	}{
+		{"plaintext", "cus_123", "cus_123", false},
+		{"empty", "", "", true},
+		{"legacy", legacy, "from before versions", false},
+		{"old version", v0, "written under v0", false},
+		{"current version", v1, "written under v1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := DecryptField(tt.stored); err != nil || got != tt.want {
+				t.Errorf("DecryptField = %q, %v; want %q", got, err, tt.want)
+			}
+			if got := IsCurrent(tt.stored); got != tt.current {
+				t.Errorf("IsCurrent = %v, want %v", got, tt.current)
+			}
+		})
+	}
+
+	if stored, err := EncryptField(""); err != nil || stored != "" {
+		t.Errorf("EncryptField(\"\") = %q, %v; want it stored empty", stored, err)
+	}
+	withFieldKeys(t, nil)
+	if _, err := EncryptField("x"); !errors.Is(err, ErrNoFieldKey) {
+		t.Errorf("EncryptField without keys: %v, want ErrNoFieldKey", err)
+	}
+	if _, err := DecryptField(v1); !errors.Is(err, ErrNoFieldKey) {
+		t.Errorf("DecryptField without keys: %v, want ErrNoFieldKey", err)
+	}
+}
@@ -1,52 +1,140 @@
 package database
 
 import (
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 
+	"github.com/zesbe/lumina-ai/internal/config"
+	"github.com/zesbe/lumina-ai/internal/crypto"
+	"github.com/zesbe/lumina-ai/internal/middleware"
 	"github.com/zesbe/lumina-ai/internal/models"
+	"github.com/zesbe/lumina-ai/internal/tracing"
 )
 
-func Connect(databaseURL string) (*gorm.DB, error) {
-	db, err := gorm.Open(postgres.Open(databaseURL), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
-	})
+// Connect opens the database and sets it up.
+func Connect(cfg *config.Config) (*gorm.DB, error) {
+	db, err := Open(cfg)
 	if err != nil {
 		return nil, err
 	}
+	if err := Setup(db, cfg); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Setup migrates db and seeds the plans, style presets, video templates
+// and first admin. Only a failed migration is an error; seeds that fail
+// are logged.
+func Setup(db *gorm.DB, cfg *config.Config) error {
+	if err := migrate(db); err != nil {
+		return err
+	}
 
-	sqlDB, err := db.DB()
+	if err := seedPlans(db); err != nil {
+		slog.Warn("failed to seed plans", "error", err)
+	}
+
+	if err := seedStylePresets(db); err != nil {
+		slog.Warn("failed to seed style presets", "error", err)
+	}
+
+	if err := seedVideoTemplates(db); err != nil {
+		slog.Warn("failed to seed video templates", "error", err)
+	}
+
+	if err := seedAdmin(db, cfg); err != nil {
+		slog.Error("failed to seed admin user", "error", err)
+	}
+
+	return nil
+}
+
+// Open opens the primary and, when replica URLs are configured, registers
+// them for Reader. Without replicas everything uses the primary. Unlike
+// Connect it leaves the schema alone.
+func Open(cfg *config.Config) (*gorm.DB, error) {
+	if err := cfg.DBPool.Validate(); err != nil {
+		return nil, err
+	}
+
+	open := func(dsn string) gorm.Dialector {
+		return postgres.Open(withStatementTimeout(dsn, cfg.DBStatementTimeout))
+	}
+
+	db, err := gorm.Open(open(cfg.DatabaseURL), &gorm.Config{
+		Logger: logger.Default.LogMode(logLevel(cfg.DBLogLevel)),
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	sqlDB.SetMaxIdleConns(10)
-	sqlDB.SetMaxOpenConns(100)
-	sqlDB.SetConnMaxLifetime(time.Hour)
+	if err := db.Use(tracing.GormPlugin{}); err != nil {
+		return nil, err
+	}
 
-	if err := migrate(db); err != nil {
+	if err := useReplicas(db, cfg.DatabaseReplicaURLs, open, cfg.DBPool); err != nil {
 		return nil, err
 	}
 
-	if err := seedPlans(db); err != nil {
-		log.Printf("Warning: Failed to seed plans: %v", err)
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
 	}
 
+	sqlDB.SetMaxOpenConns(cfg.DBPool.MaxOpen)
+	sqlDB.SetMaxIdleConns(cfg.DBPool.MaxIdle)
+	sqlDB.SetConnMaxLifetime(cfg.DBPool.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.DBPool.ConnMaxIdleTime)
+
 	return db, nil
 }
 
+// schemaModels are the tables AutoMigrate keeps up to date.
+var schemaModels = []interface{}{
+	&models.User{},
+	&models.Generation{},
+	&models.Plan{},
+	&models.Subscription{},
+	&models.CreditTransaction{},
+	&models.AuditLog{},
+	&models.ModerationRule{},
+	&models.FeatureFlag{},
+	&models.FeatureFlagOverride{},
+	&models.RefreshToken{},
+	&models.LinkedIdentity{},
+	&models.APIKey{},
+	&models.LoginEvent{},
+	&models.EmailChange{},
+	&models.AccountDeletion{},
+	&models.DataExport{},
+	&models.MagicLink{},
+	&models.NotificationPreferences{},
+	&models.Notification{},
+	&models.SecureAccountToken{},
+	&models.EmailVerification{},
+	&models.Referral{},
+	&models.DisposableDomain{},
+	&models.SavedPrompt{},
+	&models.Draft{},
+	&models.StylePreset{},
+	&models.VideoTemplate{},
+}
+
 func migrate(db *gorm.DB) error {
-	return db.AutoMigrate(
-		&models.User{},
-		&models.Generation{},
-		&models.Plan{},
-		&models.Subscription{},
-		&models.CreditTransaction{},
-	)
+	if err := db.AutoMigrate(schemaModels...); err != nil {
+		return err
+	}
+	return runMigrations(db)
 }
 
 func seedPlans(db *gorm.DB) error {
@@ -57,9 +145,139 @@ func seedPlans(db *gorm.DB) error {
 				if err := db.Create(&plan).Error; err != nil {
 					return err
 				}
-				log.Printf("Created plan: %s", plan.Name)
+				slog.Info("created plan", "plan", plan.Name)
 			}
 		}
 	}
 	return nil
 }
+
+// seedStylePresets adds the default presets that were never created.
+// Presets an admin deleted count as created, so they stay deleted.
+func seedStylePresets(db *gorm.DB) error {
+	for _, preset := range models.DefaultStylePresets {
+		var existing models.StylePreset
+		err := db.Unscoped().Where("name = ?", preset.Name).First(&existing).Error
+		if err != gorm.ErrRecordNotFound {
+			continue
+		}
+		preset.IsActive = true
+		if err := db.Create(&preset).Error; err != nil {
+			return err
+		}
+		slog.Info("created style preset", "preset", preset.Name)
+	}
+	return nil
+}
+
+// seedVideoTemplates adds the default templates that were never created.
+// Templates an admin deleted count as created, so they stay deleted.
+func seedVideoTemplates(db *gorm.DB) error {
+	for _, template := range models.DefaultVideoTemplates {
+		var existing models.VideoTemplate
+		err := db.Unscoped().Where("name = ?", template.Name).First(&existing).Error
+		if err != gorm.ErrRecordNotFound {
+			continue
+		}
+		template.IsActive = true
+		if err := db.Create(&template).Error; err != nil {
+			return err
+		}
+		slog.Info("created video template", "template", template.Name)
+	}
+	return nil
+}
+
+// seedAdmin bootstraps the first admin from ADMIN_EMAIL/ADMIN_PASSWORD.
+// It does nothing once any admin exists; an existing account with that
+// email is promoted and keeps its password. Later admins are promoted
+// through the API.
+func seedAdmin(db *gorm.DB, cfg *config.Config) error {
+	email := models.NormalizeEmail(cfg.AdminEmail)
+	if email == "" || cfg.AdminPassword == "" {
+		return nil
+	}
+
+	if cfg.Environment == "production" {
+		if v := middleware.NewValidator().Password("ADMIN_PASSWORD", cfg.AdminPassword); v.HasErrors() {
+			return fmt.Errorf("ADMIN_PASSWORD is too weak: %s", v.Errors()[0].Message)
+		}
+	}
+
+	var admins int64
+	if err := db.Model(&models.User{}).Where("role = ?", "admin").Count(&admins).Error; err != nil {
+		return err
+	}
+	if admins > 0 {
+		return nil
+	}
+
+	var user models.User
+	err := db.Where("LOWER(email) = ? AND email_conflict_with IS NULL", email).First(&user).Error
+	if err == nil {
+		if err := db.Model(&user).Updates(map[string]interface{}{"role": "admin", "is_verified": true}).Error; err != nil {
+			return err
+		}
+		slog.Info("promoted existing user to admin", "user_id", user.ID, "email", email)
+		return nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	hash, err := crypto.HashPassword(cfg.AdminPassword)
+	if err != nil {
+		return err
+	}
+	user = models.User{
+		Email:        email,
+		PasswordHash: hash,
+		Name:         "Admin",
+		Role:         "admin",
+		Plan:         "free",
+		Credits:      10,
+		IsActive:     true,
+		IsVerified:   true,
+	}
+	if err := db.Create(&user).Error; err != nil {
+		return err
+	}
+	slog.Info("created admin user", "user_id", user.ID, "email", email)
+	return nil
+}
+
+// withStatementTimeout adds a server-side statement_timeout to dsn, as a
+// backstop for queries whose context is never cancelled. A timeout already
+// in the DSN wins. Both URL and key=value DSNs are supported.
+func withStatementTimeout(dsn string, timeout time.Duration) string {
+	if timeout <= 0 || dsn == "" || strings.Contains(dsn, "statement_timeout") {
+		return dsn
+	}
+	ms := strconv.FormatInt(timeout.Milliseconds(), 10)
+
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return dsn
+		}
+		q := u.Query()
+		q.Set("statement_timeout", ms)
+		u.RawQuery = q.Encode()
+		return u.String()
+	}
+	return dsn + " statement_timeout=" + ms
+}
+
+// logLevel maps DB_LOG_LEVEL to GORM's levels. Info logs every statement,
+// so production defaults to warn (slow queries and errors).
+func logLevel(level string) logger.LogLevel {
+	switch level {
+	case "silent":
+		return logger.Silent
+	case "error":
+		return logger.Error
+	case "warn":
+		return logger.Warn
+	}
+	return logger.Info
+}
@@ -0,0 +1,32 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWithStatementTimeout(t *testing.T) {
+	tests := []struct {
+		dsn     string
+		timeout time.Duration
+		want    string
+	}{
+		{"postgres://u:p@db:5432/lumina?sslmode=disable", 30 * time.Second,
+			"postgres://u:p@db:5432/lumina?sslmode=disable&statement_timeout=30000"},
+		{"postgresql://u@db/lumina", 1500 * time.Millisecond,
+			"postgresql://u@db/lumina?statement_timeout=1500"},
+		{"host=db user=u dbname=lumina", 30 * time.Second,
+			"host=db user=u dbname=lumina statement_timeout=30000"},
+		// A timeout already in the DSN wins, and zero disables the backstop.
+		{"postgres://db/lumina?statement_timeout=5000", 30 * time.Second,
+			"postgres://db/lumina?statement_timeout=5000"},
+		{"host=db statement_timeout=5000", 30 * time.Second, "host=db statement_timeout=5000"},
+		{"postgres://db/lumina", 0, "postgres://db/lumina"},
+		{"", 30 * time.Second, ""},
+	}
+	for _, tt := range tests {
+		if got := withStatementTimeout(tt.dsn, tt.timeout); got != tt.want {
+			t.Errorf("withStatementTimeout(%q, %v) = %q, want %q", tt.dsn, tt.timeout, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"gorm.io/gorm"
+
+	"github.com/zesbe/lumina-ai/internal/crypto"
+)
+
+// encryptBatch is how many rows EncryptFields reads at a time.
+const encryptBatch = 500
+
+// encryptedColumn is a column whose model field is tagged
+// serializer:encrypted.
+type encryptedColumn struct {
+	Table  string
+	Key    string
+	Column string
+}
+
+// encryptedColumns finds the encrypted columns of every migrated model.
+func encryptedColumns(db *gorm.DB) ([]encryptedColumn, error) {
+	var columns []encryptedColumn
+	for _, model := range schemaModels {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return nil, err
+		}
+		if stmt.Schema.PrioritizedPrimaryField == nil {
+			continue
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.TagSettings["SERIALIZER"] == "encrypted" && field.DBName != "" {
+				columns = append(columns, encryptedColumn{
+					Table:  stmt.Schema.Table,
+					Key:    stmt.Schema.PrioritizedPrimaryField.DBName,
+					Column: field.DBName,
+				})
+			}
+		}
+	}
+	return columns, nil
+}
+
+// EncryptFields rewrites, in place, the values of encrypted columns that
+// aren't encrypted with the newest key: those written in plaintext before
+// the column was encrypted, and those written with a key since rotated
+// out. Rows are walked by primary key in batches, and each update only
+// applies if the value is still the one read, so it is safe to run
+// against a live database and to run again. It returns how many values
+// it rewrote.
+func EncryptFields(ctx context.Context, db *gorm.DB) (int, error) {
+	columns, err := encryptedColumns(db)
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for _, col := range columns {
+		encrypted := 0
+		var lastKey uint
+		for {
+			var rows []struct {
+				ID    uint
+				Value string
+			}
+			if err := db.WithContext(ctx).Table(col.Table).
+				Select(fmt.Sprintf("%s AS id, %s AS value", col.Key, col.Column)).
+				Where(fmt.Sprintf("%s > ? AND %s <> ''", col.Key, col.Column), lastKey).
+				Order(col.Key).Limit(encryptBatch).Scan(&rows).Error; err != nil {
+				return total, err
+			}
+			if len(rows) == 0 {
+				break
+			}
+			for _, row := range rows {
+				lastKey = row.ID
+				if crypto.IsCurrent(row.Value) {
+					continue
+				}
+				plaintext, err := crypto.DecryptField(row.Value)
+				if err != nil {
+					return total, fmt.Errorf("%s.%s %s=%d: %w", col.Table, col.Column, col.Key, row.ID, err)
+				}
+				stored, err := crypto.EncryptField(plaintext)
+				if err != nil {
+					return total, err
+				}
+				res := db.WithContext(ctx).Table(col.Table).
+					Where(fmt.Sprintf("%s = ? AND %s = ?", col.Key, col.Column), row.ID, row.Value).
+					Update(col.Column, stored)
+				if res.Error != nil {
+					return total, res.Error
+				}
+				encrypted += int(res.RowsAffected)
+			}
+		}
+		slog.Info("encrypted column", "table", col.Table, "column", col.Column, "rows", encrypted)
+		total += encrypted
+	}
+	return total, nil
+}
@@ -0,0 +1,158 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/zesbe/lumina-ai/internal/crypto"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+const (
+	key0 = "version-0-key-is-32-bytes-long!!"
+	key1 = "version-1-key-is-32-bytes-long!!"
+)
+
+func sqliteDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := db.AutoMigrate(&models.User{}, &models.Plan{}, &models.Subscription{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func useFieldKeys(t *testing.T, list, legacy string) {
+	t.Helper()
+	keys, err := crypto.ParseKeyring(list, legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crypto.SetFieldKeys(keys)
+	t.Cleanup(func() { crypto.SetFieldKeys(nil) })
+}
+
+// storeRaw writes a subscription with providerID stored as it is, past the
+// serializer, as rows written by older releases are.
+func storeRaw(t *testing.T, db *gorm.DB, userID uint, providerID string) {
+	t.Helper()
+	if err := db.Table("subscriptions").Create(map[string]interface{}{
+		"user_id": userID, "plan_id": 1, "status": "active", "payment_provider_id": providerID,
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func storedProviderIDs(t *testing.T, db *gorm.DB) []string {
+	t.Helper()
+	var stored []string
+	if err := db.Table("subscriptions").Order("id").Pluck("payment_provider_id", &stored).Error; err != nil {
+		t.Fatal(err)
+	}
+	return stored
+}
+
+func TestEncryptFieldsRotates(t *testing.T) {
+	db := sqliteDB(t)
+
+	// Rows from every era: before the column was encrypted, before keys
+	// were versioned, under version 0, and already under version 1.
+	aes, err := crypto.NewAESCrypto(key0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := aes.Encrypt([]byte("sub_legacy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	useFieldKeys(t, "", key0)
+	v0, err := crypto.EncryptField("sub_v0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	useFieldKeys(t, "1:"+key1, key0)
+	v1, err := crypto.EncryptField("sub_v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	storeRaw(t, db, 1, "sub_plain")
+	storeRaw(t, db, 2, "enc:"+legacy)
+	storeRaw(t, db, 3, v0)
+	storeRaw(t, db, 4, v1)
+	storeRaw(t, db, 5, "")
+
+	rewritten, err := EncryptFields(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rewritten != 3 {
+		t.Errorf("first sweep rewrote %d values, want 3", rewritten)
+	}
+	stored := storedProviderIDs(t, db)
+	for i, value := range stored {
+		if !crypto.IsCurrent(value) {
+			t.Errorf("row %d stored as %q, not under the newest key", i+1, value)
+		}
+	}
+	if stored[3] != v1 {
+		t.Error("a value already under the newest key was rewritten")
+	}
+
+	// Done once, a second run has nothing to do.
+	if rewritten, err := EncryptFields(context.Background(), db); err != nil || rewritten != 0 {
+		t.Errorf("second sweep rewrote %d values, %v; want 0", rewritten, err)
+	}
+	if again := storedProviderIDs(t, db); strings.Join(again, ",") != strings.Join(stored, ",") {
+		t.Error("second sweep changed stored values")
+	}
+
+	// Everything reads back with version 0 retired.
+	useFieldKeys(t, "1:"+key1, "")
+	var subs []models.Subscription
+	if err := db.Order("id").Find(&subs).Error; err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"sub_plain", "sub_legacy", "sub_v0", "sub_v1", ""}
+	for i, sub := range subs {
+		if sub.PaymentProviderID != want[i] {
+			t.Errorf("subscription %d reads %q, want %q", sub.ID, sub.PaymentProviderID, want[i])
+		}
+	}
+}
+
+func TestEncryptFieldsStopsOnUnknownVersion(t *testing.T) {
+	db := sqliteDB(t)
+	useFieldKeys(t, "", key0)
+	v0, err := crypto.EncryptField("sub_v0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	storeRaw(t, db, 1, "sub_plain")
+	storeRaw(t, db, 2, v0)
+
+	// Version 0 retired before its values were re-encrypted.
+	useFieldKeys(t, "1:"+key1, "")
+	_, err = EncryptFields(context.Background(), db)
+	if err == nil || !strings.Contains(err.Error(), "subscriptions.payment_provider_id id=2") {
+		t.Fatalf("err = %v, want one naming subscriptions.payment_provider_id id=2", err)
+	}
+	if stored := storedProviderIDs(t, db); stored[1] != v0 {
+		t.Error("the unreadable value was changed")
+	}
+}
@@ -0,0 +1,70 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Health is the result of a round trip to the primary plus its pool usage.
+type Health struct {
+	Status    string    `json:"status"`
+	LatencyMs int64     `json:"latency_ms"`
+	Error     string    `json:"error,omitempty"`
+	Pool      PoolStats `json:"pool"`
+}
+
+type PoolStats struct {
+	MaxOpen        int     `json:"max_open"`
+	Open           int     `json:"open"`
+	InUse          int     `json:"in_use"`
+	Idle           int     `json:"idle"`
+	WaitCount      int64   `json:"wait_count"`
+	WaitDurationMs int64   `json:"wait_duration_ms"`
+	Saturation     float64 `json:"saturation"`
+}
+
+// Stats reports the primary's connection pool.
+func Stats(db *gorm.DB) PoolStats {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return PoolStats{}
+	}
+	return poolStats(sqlDB.Stats())
+}
+
+func poolStats(s sql.DBStats) PoolStats {
+	stats := PoolStats{
+		MaxOpen:        s.MaxOpenConnections,
+		Open:           s.OpenConnections,
+		InUse:          s.InUse,
+		Idle:           s.Idle,
+		WaitCount:      s.WaitCount,
+		WaitDurationMs: s.WaitDuration.Milliseconds(),
+	}
+	if s.MaxOpenConnections > 0 {
+		stats.Saturation = float64(s.InUse) / float64(s.MaxOpenConnections)
+	}
+	return stats
+}
+
+// Check runs SELECT 1 against the primary within timeout.
+func Check(ctx context.Context, db *gorm.DB, timeout time.Duration) Health {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := db.WithContext(ctx).Exec("SELECT 1").Error
+	health := Health{
+		Status:    "ok",
+		LatencyMs: time.Since(start).Milliseconds(),
+		Pool:      Stats(db),
+	}
+	if err != nil {
+		health.Status = "down"
+		health.Error = err.Error()
+	}
+	return health
+}
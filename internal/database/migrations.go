@@ -0,0 +1,214 @@
+package database
+
+import (
+	"log/slog"
+	"regexp"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+// migration is a schema change AutoMigrate can't express, such as a
+// partial or descending index, or a rewrite of existing rows. Applied
+// versions are recorded in schema_migrations and never run again, so
+// append new entries rather than editing old ones.
+type migration struct {
+	Version string
+	SQL     []string
+	// Func runs after SQL, for rewrites that need Go.
+	Func func(db *gorm.DB) error
+}
+
+// Indexes are built CONCURRENTLY so a deploy doesn't block writes on a
+// large table; that can't run inside a transaction, so each statement
+// must be idempotent (IF NOT EXISTS) in case a migration is retried. A
+// concurrent build that fails leaves its index behind marked INVALID,
+// which IF NOT EXISTS would then skip, so runMigrations drops those first.
+var migrations = []migration{
+	{
+		Version: "20261016_hot_query_indexes",
+		SQL: []string{
+			// GetGenerations: a user's history, newest first, optionally
+			// filtered by type and status.
+			`CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_generations_user_created
+				ON generations (user_id, created_at DESC) WHERE deleted_at IS NULL`,
+			`CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_generations_user_type_status
+				ON generations (user_id, type, status) WHERE deleted_at IS NULL`,
+			// Explore only ever lists completed public content.
+			`CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_generations_public_created
+				ON generations (created_at DESC)
+				WHERE is_public AND status = 'completed' AND deleted_at IS NULL`,
+			// Stuck-job recovery scans in-flight generations by last update.
+			`CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_generations_inflight_updated
+				ON generations (status, updated_at)
+				WHERE status IN ('pending', 'processing') AND deleted_at IS NULL`,
+			// Per-user ledger, newest first.
+			`CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_credit_transactions_user_created
+				ON credit_transactions (user_id, created_at DESC)`,
+			// Ledger exports and analytics scan by date.
+			`CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_credit_transactions_created
+				ON credit_transactions (created_at)`,
+		},
+	},
+	{
+		Version: "20261016_users_email_lowercase",
+		SQL: []string{
+			// Addresses that differ only in case or surrounding spaces:
+			// the oldest account keeps it. The others keep their address
+			// as it was but are flagged with its ID and audited, and
+			// lookups by email skip them; support merges or contacts them.
+			`UPDATE users u SET email_conflict_with = k.id
+				FROM (SELECT DISTINCT ON (LOWER(TRIM(email))) id, LOWER(TRIM(email)) AS email
+					FROM users ORDER BY LOWER(TRIM(email)), created_at, id) k
+				WHERE LOWER(TRIM(u.email)) = k.email AND u.id <> k.id AND u.email_conflict_with IS NULL`,
+			`INSERT INTO audit_logs (action, target_type, target_id, ip, user_agent, metadata, created_at)
+				SELECT 'email_conflict', 'user', u.id::text, '', '',
+					jsonb_build_object('email', u.email, 'kept_user_id', u.email_conflict_with), NOW()
+				FROM users u
+				WHERE u.email_conflict_with IS NOT NULL AND NOT EXISTS (
+					SELECT 1 FROM audit_logs a
+					WHERE a.action = 'email_conflict' AND a.target_type = 'user' AND a.target_id = u.id::text)`,
+			// Lower-casing the kept address can make it equal to a flagged
+			// one, so the exact unique index AutoMigrate used to build
+			// gives way to a plain one for lookups.
+			`DROP INDEX CONCURRENTLY IF EXISTS idx_users_email`,
+			`UPDATE users SET email = LOWER(TRIM(email))
+				WHERE email <> LOWER(TRIM(email)) AND email_conflict_with IS NULL`,
+			`CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_users_email ON users (email)`,
+			// Sign-ups racing past Register's check hit this instead.
+			`CREATE UNIQUE INDEX CONCURRENTLY IF NOT EXISTS idx_users_email_lower
+				ON users (LOWER(email)) WHERE email_conflict_with IS NULL`,
+		},
+	},
+	{
+		Version: "20261016_generation_metadata_structure",
+		Func:    backfillGenerationMetadata,
+	},
+	{
+		Version: "20261016_users_verified_before_verification",
+		SQL: []string{
+			// Nothing verified addresses before; accounts from then keep
+			// generating rather than waiting on a mail they never got.
+			`UPDATE users SET is_verified = true WHERE is_verified = false`,
+		},
+	},
+}
+
+// backfillGenerationMetadata rewrites generation metadata stored before
+// it had a structure, the provider's extra info at the top level, with
+// the extra info under "provider". Values that aren't JSON are left for
+// ParseGenerationMetadata to return as they are.
+func backfillGenerationMetadata(db *gorm.DB) error {
+	var batch []models.Generation
+	return db.Unscoped().Select("id", "metadata").Where("metadata <> ''").
+		FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+			for _, g := range batch {
+				m := models.ParseGenerationMetadata(g.Metadata)
+				if m.Raw != "" {
+					continue
+				}
+				if encoded := m.Encode(); encoded != g.Metadata {
+					if err := db.Unscoped().Model(&models.Generation{}).Where("id = ?", g.ID).
+						UpdateColumn("metadata", encoded).Error; err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		}).Error
+}
+
+type schemaMigration struct {
+	Version   string `gorm:"primaryKey;size:100"`
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// runMigrations applies the migrations not yet recorded. They are
+// Postgres SQL, so other databases, such as the SQLite apptest runs on,
+// only get AutoMigrate.
+func runMigrations(db *gorm.DB) error {
+	if db.Dialector.Name() != "postgres" {
+		return nil
+	}
+	if err := db.AutoMigrate(&schemaMigration{}); err != nil {
+		return err
+	}
+
+	var applied []string
+	if err := db.Model(&schemaMigration{}).Pluck("version", &applied).Error; err != nil {
+		return err
+	}
+	done := make(map[string]bool, len(applied))
+	for _, v := range applied {
+		done[v] = true
+	}
+
+	for _, m := range migrations {
+		if done[m.Version] {
+			continue
+		}
+		start := time.Now()
+		for _, stmt := range m.SQL {
+			if err := dropInvalidIndex(db, stmt); err != nil {
+				return err
+			}
+			if err := db.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		if m.Func != nil {
+			if err := m.Func(db); err != nil {
+				return err
+			}
+		}
+		if err := db.Create(&schemaMigration{Version: m.Version, AppliedAt: time.Now()}).Error; err != nil {
+			return err
+		}
+		slog.Info("applied migration", "version", m.Version, "duration_ms", time.Since(start).Milliseconds())
+	}
+	return nil
+}
+
+var concurrentIndex = regexp.MustCompile(`(?i)^\s*CREATE\s+(?:UNIQUE\s+)?INDEX\s+CONCURRENTLY\s+IF\s+NOT\s+EXISTS\s+(\w+)`)
+
+// concurrentIndexName is the index stmt builds concurrently, or "" if it
+// isn't such a statement.
+func concurrentIndexName(stmt string) string {
+	if m := concurrentIndex.FindStringSubmatch(stmt); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// dropInvalidIndex drops the index stmt builds if an earlier build of it
+// failed part way, say on a duplicate key or a cancelled deploy, so the
+// retry builds it again instead of keeping an index the planner ignores
+// but every write still maintains.
+func dropInvalidIndex(db *gorm.DB, stmt string) error {
+	name := concurrentIndexName(stmt)
+	if name == "" {
+		return nil
+	}
+
+	var invalid bool
+	if err := db.Raw(`SELECT EXISTS (
+			SELECT 1 FROM pg_index i JOIN pg_class c ON c.oid = i.indexrelid
+			WHERE c.relname = ? AND c.relnamespace = current_schema()::regnamespace AND NOT i.indisvalid)`,
+		name,
+	).Row().Scan(&invalid); err != nil {
+		return err
+	}
+	if !invalid {
+		return nil
+	}
+
+	slog.Warn("dropping invalid index left by a failed build", "index", name)
+	// name is a bare identifier from the migration's own SQL.
+	return db.Exec("DROP INDEX CONCURRENTLY IF EXISTS " + name).Error
+}
@@ -0,0 +1,300 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestConcurrentIndexName(t *testing.T) {
+	tests := []struct {
+		stmt string
+		want string
+	}{
+		{"CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_a ON t (a)", "idx_a"},
+		{"\n\t\t\tcreate unique index concurrently if not exists idx_b\n\t\t\t\tON t (LOWER(b))", "idx_b"},
+		{"CREATE INDEX idx_c ON t (c)", ""},
+		{"CREATE INDEX CONCURRENTLY idx_d ON t (d)", ""},
+		{"UPDATE users SET email = LOWER(email)", ""},
+	}
+	for _, tt := range tests {
+		if got := concurrentIndexName(tt.stmt); got != tt.want {
+			t.Errorf("concurrentIndexName(%q) = %q, want %q", tt.stmt, got, tt.want)
+		}
+	}
+
+	// Every concurrent build in the migrations must be recognized, or a
+	// failed one would never be dropped and rebuilt.
+	for _, m := range migrations {
+		for _, stmt := range m.SQL {
+			if strings.Contains(strings.ToUpper(stmt), "CONCURRENTLY") && !strings.Contains(strings.ToUpper(stmt), "DROP") &&
+				concurrentIndexName(stmt) == "" {
+				t.Errorf("%s: concurrent index build isn't recognized:\n%s", m.Version, stmt)
+			}
+		}
+	}
+}
+
+// postgresDB opens TEST_DATABASE_URL in a schema of its own, dropped
+// when the test ends, and migrates it. Without the variable the test is
+// skipped: the migrations and plans are Postgres-only.
+func postgresDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(url), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// search_path is set per connection, so keep to one.
+	sqlDB.SetMaxOpenConns(1)
+
+	schema := fmt.Sprintf("migrations_test_%d", time.Now().UnixNano())
+	if err := db.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Exec("DROP SCHEMA " + schema + " CASCADE")
+		sqlDB.Close()
+	})
+	if err := db.Exec("SET search_path TO " + schema).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// indexState reports whether the index exists in the current schema and
+// whether it is valid.
+func indexState(t *testing.T, db *gorm.DB, name string) (exists, valid bool) {
+	t.Helper()
+	err := db.Raw(`SELECT i.indisvalid FROM pg_index i JOIN pg_class c ON c.oid = i.indexrelid
+		WHERE c.relname = ? AND c.relnamespace = current_schema()::regnamespace`, name).Row().Scan(&valid)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, false
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return true, valid
+}
+
+func TestMigrationsRebuildInvalidIndex(t *testing.T) {
+	db := postgresDB(t)
+	const index = "idx_users_email_lower"
+
+	// Reproduce a build that failed on duplicates: the index is left
+	// behind INVALID.
+	if err := db.Exec("DROP INDEX " + index).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec(`INSERT INTO users (email, password_hash, name, created_at, updated_at)
+		VALUES ('Dup@example.com', 'x', 'First', NOW() - INTERVAL '1 day', NOW()), ('dup@example.com', 'x', 'Second', NOW(), NOW())`).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec("CREATE UNIQUE INDEX CONCURRENTLY " + index + " ON users (LOWER(email))").Error; err == nil {
+		t.Fatal("building the unique index over duplicates succeeded")
+	}
+	if exists, valid := indexState(t, db, index); !exists || valid {
+		t.Fatalf("after the failed build: exists %v, valid %v; want an invalid index", exists, valid)
+	}
+
+	// Retrying the migration resolves the duplicates and must rebuild
+	// the index rather than skip it for already existing.
+	if err := db.Exec("DELETE FROM schema_migrations WHERE version = ?", "20261016_users_email_lowercase").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := runMigrations(db); err != nil {
+		t.Fatal(err)
+	}
+	if exists, valid := indexState(t, db, index); !exists || !valid {
+		t.Fatalf("after the retry: exists %v, valid %v; want a valid index", exists, valid)
+	}
+
+	// The newer account keeps its address, flagged, and is audited; the
+	// older one's is lower-cased, which the exact index would have refused.
+	var users []struct {
+		ID                uint
+		Name              string
+		Email             string
+		EmailConflictWith *uint
+	}
+	if err := db.Raw("SELECT id, name, email, email_conflict_with FROM users WHERE LOWER(email) = 'dup@example.com' ORDER BY id").
+		Scan(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users[0].Email != "dup@example.com" || users[0].EmailConflictWith != nil ||
+		users[1].Email != "dup@example.com" || users[1].EmailConflictWith == nil || *users[1].EmailConflictWith != users[0].ID {
+		t.Fatalf("users after the retry: %+v, want the first kept and the second flagged with its address", users)
+	}
+	var audited int64
+	if err := db.Raw("SELECT COUNT(*) FROM audit_logs WHERE action = 'email_conflict' AND target_id = ?", strconv.FormatUint(uint64(users[1].ID), 10)).
+		Scan(&audited).Error; err != nil {
+		t.Fatal(err)
+	}
+	if audited != 1 {
+		t.Errorf("%d email_conflict audit entries for the flagged account, want 1", audited)
+	}
+	if err := db.Exec(`INSERT INTO users (email, password_hash, name, created_at, updated_at)
+		VALUES ('DUP@example.com', 'x', 'Third', NOW(), NOW())`).Error; err == nil {
+		t.Error("the rebuilt index let a case-only duplicate in")
+	}
+}
+
+// TestHotQueryPlans seeds TEST_SEED_ROWS generations (200k by default)
+// and checks the planner uses the migration's indexes for the queries
+// they were added for. Run with -v to see each plan's execution time
+// with the indexes and again after dropping them.
+func TestHotQueryPlans(t *testing.T) {
+	db := postgresDB(t)
+
+	rows := 200000
+	if v := os.Getenv("TEST_SEED_ROWS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			t.Fatalf("TEST_SEED_ROWS: %v", err)
+		}
+		rows = n
+	}
+	seed := []string{
+		`INSERT INTO users (email, password_hash, name, created_at, updated_at)
+			SELECT 'user' || g || '@example.com', 'x', 'User', NOW(), NOW() FROM generate_series(1, 2000) g`,
+		fmt.Sprintf(`INSERT INTO generations (user_id, type, status, prompt, is_public, watermarked, created_at, updated_at)
+			SELECT u.min_id + g %% 2000,
+				(ARRAY['music', 'image', 'video'])[1 + g %% 3],
+				CASE WHEN g %% 500 = 0 THEN 'processing' WHEN g %% 10 = 0 THEN 'failed' ELSE 'completed' END,
+				'prompt', g %% 4 = 0, false,
+				NOW() - g * INTERVAL '1 minute', NOW() - g * INTERVAL '1 minute'
+			FROM generate_series(1, %d) g, (SELECT MIN(id) AS min_id FROM users) u`, rows),
+		fmt.Sprintf(`INSERT INTO credit_transactions (user_id, amount, type, created_at)
+			SELECT u.min_id + g %% 2000, -1, 'usage', NOW() - g * INTERVAL '1 minute'
+			FROM generate_series(1, %d) g, (SELECT MIN(id) AS min_id FROM users) u`, rows),
+		`ANALYZE users, generations, credit_transactions`,
+	}
+	for _, stmt := range seed {
+		if err := db.Exec(stmt).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	var userID uint
+	if err := db.Raw("SELECT MIN(id) + 42 FROM users").Row().Scan(&userID); err != nil {
+		t.Fatal(err)
+	}
+
+	queries := []struct {
+		name string
+		sql  string
+		// want lists the indexes any of which makes a good plan.
+		want []string
+	}{
+		{"history", fmt.Sprintf(`SELECT * FROM generations WHERE user_id = %d AND deleted_at IS NULL
+			ORDER BY created_at DESC LIMIT 20`, userID),
+			[]string{"idx_generations_user_created"}},
+		{"filtered history", fmt.Sprintf(`SELECT * FROM generations WHERE user_id = %d AND type = 'video' AND status = 'failed'
+			AND deleted_at IS NULL ORDER BY created_at DESC LIMIT 20`, userID),
+			[]string{"idx_generations_user_type_status", "idx_generations_user_created"}},
+		{"explore", `SELECT * FROM generations WHERE is_public = true AND status = 'completed' AND is_demo = false
+			AND (moderation_status IS NULL OR moderation_status NOT IN ('hidden')) AND deleted_at IS NULL
+			ORDER BY created_at DESC LIMIT 20`,
+			[]string{"idx_generations_public_created"}},
+		{"in-flight", `SELECT id FROM generations WHERE status IN ('pending', 'processing')
+			AND updated_at < NOW() - INTERVAL '10 minutes' AND deleted_at IS NULL`,
+			[]string{"idx_generations_inflight_updated"}},
+		{"ledger", fmt.Sprintf(`SELECT * FROM credit_transactions WHERE user_id = %d AND deleted_at IS NULL
+			ORDER BY created_at DESC LIMIT 20`, userID),
+			[]string{"idx_credit_transactions_user_created"}},
+	}
+
+	timings := make(map[string]float64, len(queries))
+	for _, q := range queries {
+		plan := explain(t, db, q.sql)
+		used := planIndexes(plan.Plan)
+		ok := false
+		for _, want := range q.want {
+			ok = ok || used[want]
+		}
+		if !ok {
+			t.Errorf("%s: plan uses indexes %v, want one of %v", q.name, keys(used), q.want)
+		}
+		timings[q.name] = plan.ExecutionTime
+	}
+
+	for _, m := range migrations[:1] {
+		for _, stmt := range m.SQL {
+			if err := db.Exec("DROP INDEX " + concurrentIndexName(stmt)).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	for _, q := range queries {
+		t.Logf("%-16s %9.2f ms with the indexes, %9.2f ms without (%d rows)",
+			q.name, timings[q.name], explain(t, db, q.sql).ExecutionTime, rows)
+	}
+}
+
+type queryPlan struct {
+	Plan          planNode `json:"Plan"`
+	ExecutionTime float64  `json:"Execution Time"`
+}
+
+type planNode struct {
+	NodeType  string     `json:"Node Type"`
+	IndexName string     `json:"Index Name"`
+	Plans     []planNode `json:"Plans"`
+}
+
+func explain(t *testing.T, db *gorm.DB, query string) queryPlan {
+	t.Helper()
+	var raw string
+	if err := db.Raw("EXPLAIN (ANALYZE, FORMAT JSON) " + query).Row().Scan(&raw); err != nil {
+		t.Fatal(err)
+	}
+	var plans []queryPlan
+	if err := json.Unmarshal([]byte(raw), &plans); err != nil || len(plans) != 1 {
+		t.Fatalf("EXPLAIN output %q: %v", raw, err)
+	}
+	return plans[0]
+}
+
+// planIndexes collects the indexes scanned anywhere in the plan.
+func planIndexes(node planNode) map[string]bool {
+	used := map[string]bool{}
+	var walk func(planNode)
+	walk = func(n planNode) {
+		if n.IndexName != "" {
+			used[n.IndexName] = true
+		}
+		for _, child := range n.Plans {
+			walk(child)
+		}
+	}
+	walk(node)
+	return used
+}
+
+func keys(m map[string]bool) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	return out
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+
+	"github.com/zesbe/lumina-ai/internal/cache"
+	"github.com/zesbe/lumina-ai/internal/config"
+)
+
+const (
+	replicaResolver = "replica"
+
+	// PrimaryPinDuration is how long a user's reads stay on the primary
+	// after they change something, to hide replica lag.
+	PrimaryPinDuration = 5 * time.Second
+)
+
+var (
+	hasReplica bool
+
+	// pins is the fallback when Redis isn't available; it only covers
+	// this instance.
+	pins sync.Map
+)
+
+// useReplicas registers the replicas under a named resolver rather than
+// globally, so queries stay on the primary unless they opt in via Reader.
+func useReplicas(db *gorm.DB, replicaURLs []string, open func(string) gorm.Dialector, pool config.DBPool) error {
+	if len(replicaURLs) == 0 {
+		return nil
+	}
+
+	replicas := make([]gorm.Dialector, len(replicaURLs))
+	for i, url := range replicaURLs {
+		replicas[i] = open(url)
+	}
+	resolver := dbresolver.Register(dbresolver.Config{
+		Replicas: replicas,
+		Policy:   dbresolver.RandomPolicy{},
+	}, replicaResolver).
+		SetMaxOpenConns(pool.MaxOpen).
+		SetMaxIdleConns(pool.MaxIdle).
+		SetConnMaxLifetime(pool.ConnMaxLifetime).
+		SetConnMaxIdleTime(pool.ConnMaxIdleTime)
+	if err := db.Use(resolver); err != nil {
+		return err
+	}
+
+	hasReplica = true
+	return nil
+}
+
+// Reader returns db routed to a read replica for heavy, lag-tolerant
+// reads. It falls back to the primary when no replica is configured or
+// userID wrote recently (pass 0 for anonymous or admin reads).
+func Reader(db *gorm.DB, userID uint) *gorm.DB {
+	if !hasReplica || (userID != 0 && isPinned(userID)) {
+		return db
+	}
+	return db.Clauses(dbresolver.Use(replicaResolver))
+}
+
+// PinPrimary keeps userID's reads on the primary for PrimaryPinDuration,
+// so they see their own writes.
+func PinPrimary(userID uint) {
+	if !hasReplica {
+		return
+	}
+	if cache.Cache != nil {
+		cache.Cache.Set(pinKey(userID), 1, PrimaryPinDuration)
+		return
+	}
+	pins.Store(userID, time.Now().Add(PrimaryPinDuration))
+}
+
+func isPinned(userID uint) bool {
+	if cache.Cache != nil {
+		return cache.Cache.Exists(pinKey(userID))
+	}
+	until, ok := pins.Load(userID)
+	if !ok {
+		return false
+	}
+	if time.Now().After(until.(time.Time)) {
+		pins.Delete(userID)
+		return false
+	}
+	return true
+}
+
+func pinKey(userID uint) string {
+	return fmt.Sprintf("db:pin:%d", userID)
+}
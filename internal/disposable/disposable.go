@@ -0,0 +1,288 @@
+// Package disposable recognizes addresses at throwaway mail services,
+// which get used to sign up again and again for the free credits.
+//
+// A domain is disposable when the bundled list, the list fetched from
+// DISPOSABLE_DOMAINS_URL or an admin's entry says so; admin entries win,
+// so a wrongly listed domain can be let through. Entries cover their
+// subdomains. With EMAIL_MX_CHECK a domain that has no mail servers is
+// turned away too; those lookups are cached in Redis.
+package disposable
+
+import (
+	"bufio"
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/zesbe/lumina-ai/internal/cache"
+	"github.com/zesbe/lumina-ai/internal/config"
+	"github.com/zesbe/lumina-ai/internal/logger"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+// Reasons an address is turned away.
+const (
+	ReasonListed = "disposable"
+	ReasonNoMX   = "no_mx"
+)
+
+const (
+	// overrideReload is how often admin entries made on another instance
+	// are picked up.
+	overrideReload = time.Minute
+	// mxCacheTTL is how long the outcome of an MX lookup is reused.
+	mxCacheTTL = 6 * time.Hour
+	mxTimeout  = 3 * time.Second
+	// maxListSize bounds the fetched list.
+	maxListSize = 10 << 20
+)
+
+//go:embed domains.txt
+var bundledList string
+
+// Verdict says why an address was turned away.
+type Verdict struct {
+	Domain string
+	Reason string
+}
+
+// Stats describes the lists in use, for the admin view.
+type Stats struct {
+	Bundled     int        `json:"bundled"`
+	Remote      int        `json:"remote"`
+	RefreshedAt *time.Time `json:"refreshed_at,omitempty"`
+}
+
+type service struct {
+	db      *gorm.DB
+	url     string
+	mxCheck bool
+	client  *http.Client
+	bundled map[string]bool
+
+	mu          sync.RWMutex
+	remote      map[string]bool
+	refreshedAt time.Time
+	// overrides maps an admin's domains to whether they are blocked.
+	overrides map[string]bool
+}
+
+var svc *service
+
+// Init loads the bundled list and the admin entries, and keeps the
+// entries and the remote list fresh in the background. Until Init is
+// called Check lets everything through.
+func Init(db *gorm.DB, cfg *config.Config) {
+	s := &service{
+		db:      db,
+		url:     cfg.DisposableDomainsURL,
+		mxCheck: cfg.EmailMXCheck,
+		client:  &http.Client{Timeout: 30 * time.Second},
+		bundled: parse(strings.NewReader(bundledList)),
+	}
+	svc = s
+
+	if err := Reload(context.Background()); err != nil {
+		logger.L().Error("failed to load disposable domain entries", "error", err)
+	}
+	go func() {
+		ticker := time.NewTicker(overrideReload)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := Reload(context.Background()); err != nil {
+				logger.L().Warn("failed to reload disposable domain entries", "error", err)
+			}
+		}
+	}()
+
+	if s.url != "" {
+		go func() {
+			ticker := time.NewTicker(cfg.DisposableDomainsRefresh)
+			defer ticker.Stop()
+			for {
+				if err := s.refresh(context.Background()); err != nil {
+					// The previous list, or only the bundled one, stays in use.
+					logger.L().Warn("failed to refresh disposable domain list", "url", s.url, "error", err)
+				}
+				<-ticker.C
+			}
+		}()
+	}
+}
+
+// Reload re-reads the admin entries.
+func Reload(ctx context.Context) error {
+	if svc == nil {
+		return nil
+	}
+	var entries []models.DisposableDomain
+	if err := svc.db.WithContext(ctx).Find(&entries).Error; err != nil {
+		return err
+	}
+	overrides := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		overrides[e.Domain] = e.Blocked
+	}
+	svc.mu.Lock()
+	svc.overrides = overrides
+	svc.mu.Unlock()
+	return nil
+}
+
+// refresh replaces the remote list. An empty or failed download keeps the
+// old one.
+func (s *service) refresh(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("list returned status %d", resp.StatusCode)
+	}
+	domains := parse(io.LimitReader(resp.Body, maxListSize))
+	if len(domains) == 0 {
+		return errors.New("list is empty")
+	}
+
+	s.mu.Lock()
+	s.remote, s.refreshedAt = domains, time.Now()
+	s.mu.Unlock()
+	logger.L().Info("refreshed disposable domain list", "domains", len(domains))
+	return nil
+}
+
+// Check returns why email should be turned away, or nil if it is fine.
+func Check(ctx context.Context, email string) *Verdict {
+	if svc == nil {
+		return nil
+	}
+	domain := Domain(email)
+	if domain == "" {
+		return nil
+	}
+	if svc.listed(domain) {
+		return &Verdict{Domain: domain, Reason: ReasonListed}
+	}
+	if svc.mxCheck && !receivesMail(ctx, domain) {
+		return &Verdict{Domain: domain, Reason: ReasonNoMX}
+	}
+	return nil
+}
+
+// Listed reports whether domain, or a domain above it, is disposable.
+func Listed(domain string) bool {
+	return svc != nil && svc.listed(Normalize(domain))
+}
+
+// CurrentStats describes the lists in use.
+func CurrentStats() Stats {
+	if svc == nil {
+		return Stats{}
+	}
+	svc.mu.RLock()
+	defer svc.mu.RUnlock()
+	stats := Stats{Bundled: len(svc.bundled), Remote: len(svc.remote)}
+	if !svc.refreshedAt.IsZero() {
+		refreshedAt := svc.refreshedAt
+		stats.RefreshedAt = &refreshedAt
+	}
+	return stats
+}
+
+// listed walks from domain up through its parents; the closest admin
+// entry decides, and otherwise any list naming one of them does.
+func (s *service) listed(domain string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for d := domain; d != ""; {
+		if blocked, ok := s.overrides[d]; ok {
+			return blocked
+		}
+		if s.bundled[d] || s.remote[d] {
+			return true
+		}
+		_, parent, found := strings.Cut(d, ".")
+		if !found {
+			break
+		}
+		d = parent
+	}
+	return false
+}
+
+// receivesMail reports whether domain publishes mail servers. Lookups
+// that fail for any reason other than the domain having none count as a
+// yes, so a DNS hiccup doesn't stop sign-ups.
+func receivesMail(ctx context.Context, domain string) bool {
+	key := "email_mx:" + domain
+	var ok bool
+	if cache.Cache != nil && cache.Cache.Get(key, &ok) == nil {
+		return ok
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, mxTimeout)
+	defer cancel()
+	records, err := net.DefaultResolver.LookupMX(ctx, domain)
+	var dnsErr *net.DNSError
+	switch {
+	case err == nil:
+		// A single "." is a null MX (RFC 7505): the domain takes no mail.
+		ok = len(records) > 0 && !(len(records) == 1 && records[0].Host == ".")
+	case errors.As(err, &dnsErr) && dnsErr.IsNotFound:
+		ok = false
+	default:
+		logger.FromContext(ctx).Warn("MX lookup failed", "domain", domain, "error", err)
+		return true
+	}
+
+	if cache.Cache != nil {
+		if err := cache.Cache.Set(key, ok, mxCacheTTL); err != nil {
+			logger.FromContext(ctx).Warn("failed to cache MX lookup", "domain", domain, "error", err)
+		}
+	}
+	return ok
+}
+
+// Domain is the normalized domain of an address, or "" if it has none.
+func Domain(email string) string {
+	at := strings.LastIndexByte(email, '@')
+	if at < 0 {
+		return ""
+	}
+	return Normalize(email[at+1:])
+}
+
+// Normalize lower-cases a domain and drops a trailing dot.
+func Normalize(domain string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+}
+
+// parse reads one domain per line, skipping blanks and # comments.
+func parse(r io.Reader) map[string]bool {
+	domains := map[string]bool{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		if line = Normalize(line); line != "" {
+			domains[line] = true
+		}
+	}
+	return domains
+}
@@ -0,0 +1,211 @@
+// Package erasure carries out account deletions once their grace period
+// is over. Each account is erased in steps that are safe to repeat, and a
+// deletion is only marked complete after the last one, so a run that
+// crashes half way is picked up and finished by the next. Logs name the
+// user ID and row counts, never the deleted data.
+package erasure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/zesbe/lumina-ai/internal/i18n"
+	"github.com/zesbe/lumina-ai/internal/logger"
+	"github.com/zesbe/lumina-ai/internal/mail"
+	"github.com/zesbe/lumina-ai/internal/models"
+	"github.com/zesbe/lumina-ai/internal/purge"
+	"github.com/zesbe/lumina-ai/internal/userstate"
+)
+
+const (
+	interval  = 10 * time.Minute
+	batchSize = 500
+)
+
+// Start checks for deletions that are due every few minutes.
+func Start(db *gorm.DB, uploadPath, exportDir string) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if _, err := Run(context.Background(), db, uploadPath, exportDir); err != nil {
+				logger.L().Error("account erasure failed", "error", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// Run erases every account whose deletion is due, resuming any that
+// were started before, and returns how many it finished.
+func Run(ctx context.Context, db *gorm.DB, uploadPath, exportDir string) (int, error) {
+	var due []models.AccountDeletion
+	if err := db.WithContext(ctx).Where("completed_at IS NULL AND scheduled_for <= ?", time.Now()).
+		Order("scheduled_for").Find(&due).Error; err != nil {
+		return 0, err
+	}
+
+	done := 0
+	for _, d := range due {
+		if err := ctx.Err(); err != nil {
+			return done, err
+		}
+		ok, err := erase(ctx, db.WithContext(ctx), d.ID, uploadPath, exportDir)
+		if err != nil {
+			return done, fmt.Errorf("user %d: %w", d.UserID, err)
+		}
+		if ok {
+			done++
+		}
+	}
+	return done, nil
+}
+
+// erase runs every step for one deletion. It reports false when the
+// deletion was cancelled before it could be claimed.
+func erase(ctx context.Context, db *gorm.DB, id uint, uploadPath, exportDir string) (bool, error) {
+	// Claiming clears the cancel token in the same statement, so a cancel
+	// either lands before this or finds nothing to cancel.
+	claim := db.Model(&models.AccountDeletion{}).Where("id = ? AND started_at IS NULL", id).
+		Updates(map[string]interface{}{"started_at": time.Now(), "cancel_token_hash": nil})
+	if claim.Error != nil {
+		return false, claim.Error
+	}
+	var d models.AccountDeletion
+	if err := db.First(&d, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	if d.CompletedAt != nil {
+		return false, nil
+	}
+	log := logger.L().With("user_id", d.UserID, "deletion_id", d.ID)
+	log.Info("erasing account", "public_content", d.PublicContent, "resumed", claim.RowsAffected == 0)
+
+	n, err := deleteGenerations(ctx, db, d, uploadPath)
+	if err != nil {
+		return false, err
+	}
+	log.Info("deleted generations", "count", n)
+
+	// Bundles first, for the same reason as media.
+	var exports []uint
+	if err := db.Model(&models.DataExport{}).Where("user_id = ?", d.UserID).Pluck("id", &exports).Error; err != nil {
+		return false, err
+	}
+	for _, id := range exports {
+		if err := os.Remove(filepath.Join(exportDir, fmt.Sprintf("%d.zip", id))); err != nil && !os.IsNotExist(err) {
+			return false, err
+		}
+	}
+
+	for _, table := range []struct {
+		name  string
+		model interface{}
+	}{
+		{"refresh_tokens", &models.RefreshToken{}},
+		{"api_keys", &models.APIKey{}},
+		{"linked_identities", &models.LinkedIdentity{}},
+		{"login_events", &models.LoginEvent{}},
+		{"email_changes", &models.EmailChange{}},
+		{"feature_flag_overrides", &models.FeatureFlagOverride{}},
+		{"data_exports", &models.DataExport{}},
+		{"secure_account_tokens", &models.SecureAccountToken{}},
+		{"email_verifications", &models.EmailVerification{}},
+		{"notification_preferences", &models.NotificationPreferences{}},
+		{"notifications", &models.Notification{}},
+		{"saved_prompts", &models.SavedPrompt{}},
+		{"drafts", &models.Draft{}},
+	} {
+		res := db.Where("user_id = ?", d.UserID).Delete(table.model)
+		if res.Error != nil {
+			return false, fmt.Errorf("%s: %w", table.name, res.Error)
+		}
+		log.Info("deleted rows", "table", table.name, "count", res.RowsAffected)
+	}
+	// Who invited whom goes too, from either side.
+	res := db.Where("referrer_id = ? OR referred_id = ?", d.UserID, d.UserID).Delete(&models.Referral{})
+	if res.Error != nil {
+		return false, fmt.Errorf("referrals: %w", res.Error)
+	}
+	log.Info("deleted rows", "table", "referrals", "count", res.RowsAffected)
+
+	// The user row stays, stripped of anything personal, so the credit
+	// ledger and billing records that point at it still add up.
+	if err := db.Unscoped().Model(&models.User{}).Where("id = ?", d.UserID).Updates(map[string]interface{}{
+		"email":             fmt.Sprintf("deleted-%d@deleted.invalid", d.UserID),
+		"name":              "Deleted user",
+		"password_hash":     "",
+		"avatar":            "",
+		"is_active":         false,
+		"is_verified":       false,
+		"publishing_banned": false,
+		"last_login_at":     nil,
+	}).Error; err != nil {
+		return false, err
+	}
+	userstate.Forget(d.UserID)
+	log.Info("anonymized user")
+
+	// Best effort: the account is gone either way, and retrying would
+	// mean keeping the address.
+	if d.Email != "" {
+		if err := mail.Send(ctx, mail.Message{
+			To:      d.Email,
+			Subject: i18n.Translate(d.Locale, "email.account_deleted.subject", nil),
+			Body:    i18n.Translate(d.Locale, "email.account_deleted.body", nil),
+		}); err != nil {
+			log.Warn("failed to send account deletion confirmation", "error", err)
+		}
+	}
+
+	if err := db.Model(&d).Updates(map[string]interface{}{"email": "", "completed_at": time.Now()}).Error; err != nil {
+		return false, err
+	}
+	log.Info("account erased")
+	return true, nil
+}
+
+// deleteGenerations hard-deletes the user's generations and their local
+// media, soft-deleted ones included, in batches. With PublicContentKeep,
+// generations on Explore stay up under the anonymized account.
+func deleteGenerations(ctx context.Context, db *gorm.DB, d models.AccountDeletion, uploadPath string) (int64, error) {
+	var total int64
+	for {
+		q := db.Unscoped().Select("id", "output_url", "thumbnail_url").Where("user_id = ?", d.UserID)
+		if d.PublicContent == models.PublicContentKeep {
+			q = q.Where("NOT (is_public = ? AND deleted_at IS NULL AND COALESCE(moderation_status, '') NOT IN ?)", true, models.OffExplore)
+		}
+		var batch []models.Generation
+		if err := q.Order("id").Limit(batchSize).Find(&batch).Error; err != nil {
+			return total, err
+		}
+		if len(batch) == 0 {
+			return total, nil
+		}
+		ids := make([]uint, len(batch))
+		for i, g := range batch {
+			ids[i] = g.ID
+		}
+		// Files go before the rows, so a crash in between leaves rows the
+		// next run finds again rather than files nothing points at.
+		for _, g := range batch {
+			purge.DeleteMedia(uploadPath, g.OutputURL, models.OriginalAudioURL(g.OutputURL), models.CleanMediaURL(g.OutputURL), g.ThumbnailURL)
+		}
+		if err := db.Unscoped().Delete(&models.Generation{}, ids).Error; err != nil {
+			return total, err
+		}
+		total += int64(len(batch))
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package flags
+
+import (
+	"context"
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"github.com/zesbe/lumina-ai/internal/logger"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+// TTL bounds how stale an instance's view of the flags can get; changes
+// made on another instance show up within this window.
+const TTL = 30 * time.Second
+
+// Subject is who a flag is evaluated for.
+type Subject struct {
+	UserID uint
+	Plan   string
+	Role   string
+}
+
+// FromRequest builds the subject from the JWT claims in Locals.
+func FromRequest(c *fiber.Ctx) Subject {
+	s := Subject{}
+	s.UserID, _ = c.Locals("userID").(uint)
+	s.Plan, _ = c.Locals("plan").(string)
+	s.Role, _ = c.Locals("role").(string)
+	return s
+}
+
+type flag struct {
+	enabled   bool
+	rollout   int
+	plans     map[string]bool
+	roles     map[string]bool
+	overrides map[uint]bool
+}
+
+type store struct {
+	db *gorm.DB
+
+	mu       sync.RWMutex
+	flags    map[string]flag
+	loadedAt time.Time
+}
+
+var s *store
+
+// Init enables flag evaluation. Until it is called every flag is off.
+func Init(db *gorm.DB) {
+	s = &store{db: db}
+}
+
+// Invalidate drops the cached flags so the next evaluation reloads them.
+func Invalidate() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.loadedAt = time.Time{}
+	s.mu.Unlock()
+}
+
+// IsEnabled reports whether key is on for subject. Unknown flags are off.
+func IsEnabled(ctx context.Context, key string, subject Subject) bool {
+	f, ok := snapshot(ctx)[key]
+	return ok && f.evaluate(key, subject)
+}
+
+// Evaluate returns every flag's value for subject.
+func Evaluate(ctx context.Context, subject Subject) map[string]bool {
+	all := snapshot(ctx)
+	result := make(map[string]bool, len(all))
+	for key, f := range all {
+		result[key] = f.evaluate(key, subject)
+	}
+	return result
+}
+
+func (f flag) evaluate(key string, subject Subject) bool {
+	if enabled, ok := f.overrides[subject.UserID]; ok && subject.UserID != 0 {
+		return enabled
+	}
+	if !f.enabled {
+		return false
+	}
+	if len(f.plans) > 0 && !f.plans[subject.Plan] {
+		return false
+	}
+	if len(f.roles) > 0 && !f.roles[subject.Role] {
+		return false
+	}
+	if f.rollout >= 100 {
+		return true
+	}
+	if f.rollout <= 0 || subject.UserID == 0 {
+		return false
+	}
+	return Bucket(key, subject.UserID) < f.rollout
+}
+
+// Bucket places a user in [0, 100) for a flag. It is a hash of the flag key
+// and user ID, so a user's bucket is stable across requests and instances
+// but differs between flags.
+func Bucket(key string, userID uint) int {
+	h := fnv.New32a()
+	h.Write([]byte(key + ":" + strconv.FormatUint(uint64(userID), 10)))
+	return int(h.Sum32() % 100)
+}
+
+func snapshot(ctx context.Context) map[string]flag {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.RLock()
+	flags, fresh := s.flags, time.Since(s.loadedAt) < TTL
+	s.mu.RUnlock()
+	if fresh {
+		return flags
+	}
+
+	loaded, err := load(ctx, s.db)
+	if err != nil {
+		// Keep serving the last good set rather than switching
+		// everything off because of a database hiccup.
+		logger.FromContext(ctx).Warn("failed to load feature flags", "error", err)
+		return flags
+	}
+
+	s.mu.Lock()
+	s.flags, s.loadedAt = loaded, time.Now()
+	s.mu.Unlock()
+	return loaded
+}
+
+func load(ctx context.Context, db *gorm.DB) (map[string]flag, error) {
+	var records []models.FeatureFlag
+	if err := db.WithContext(ctx).Preload("Overrides").Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	flags := make(map[string]flag, len(records))
+	for _, r := range records {
+		f := flag{
+			enabled:   r.Enabled,
+			rollout:   r.RolloutPercentage,
+			plans:     toSet(models.SplitList(r.Plans)),
+			roles:     toSet(models.SplitList(r.Roles)),
+			overrides: make(map[uint]bool, len(r.Overrides)),
+		}
+		for _, o := range r.Overrides {
+			f.overrides[o.UserID] = o.Enabled
+		}
+		flags[r.Key] = f
+	}
+	return flags, nil
+}
+
+func toSet(items []string) map[string]bool {
+	set := make(map[string]bool, len(items))
+	for _, item := range items {
+		set[item] = true
+	}
+	return set
+}
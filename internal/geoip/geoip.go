@@ -0,0 +1,330 @@
+// Package geoip turns IP addresses into rough, human-readable locations
+// ("Bandung, West Java, Indonesia") using a MaxMind DB file such as
+// GeoLite2-City.mmdb or GeoLite2-Country.mmdb. Only the parts of the
+// format needed for lookups are implemented; the file is read into memory
+// once and never written.
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"strings"
+)
+
+// metadataMarker precedes the metadata map at the end of the file.
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// DB is an open MaxMind DB.
+type DB struct {
+	buf        []byte
+	data       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	ipv4Start  uint
+}
+
+var db *DB
+
+// Init loads the database at path for Locate. An empty path leaves
+// lookups off.
+func Init(path string) error {
+	if path == "" {
+		return nil
+	}
+	d, err := Open(path)
+	if err != nil {
+		return err
+	}
+	db = d
+	return nil
+}
+
+// Locate returns "city, region, country" for ip, leaving out the parts
+// the database doesn't know, or "" when there is no database or no match.
+func Locate(ip string) string {
+	if db == nil {
+		return ""
+	}
+	record, err := db.Lookup(net.ParseIP(ip))
+	if err != nil || record == nil {
+		return ""
+	}
+	parts := make([]string, 0, 3)
+	for _, name := range []string{
+		englishName(record["city"]),
+		englishName(first(record["subdivisions"])),
+		englishName(record["country"]),
+	} {
+		if name != "" && (len(parts) == 0 || parts[len(parts)-1] != name) {
+			parts = append(parts, name)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Open reads a MaxMind DB file.
+func Open(path string) (*DB, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	i := bytes.LastIndex(buf, metadataMarker)
+	if i < 0 {
+		return nil, fmt.Errorf("%s: not a MaxMind DB file", path)
+	}
+	meta, _, err := decode(buf[i+len(metadataMarker):], 0)
+	if err != nil {
+		return nil, fmt.Errorf("%s: bad metadata: %w", path, err)
+	}
+	m, _ := meta.(map[string]interface{})
+	d := &DB{
+		buf:        buf,
+		nodeCount:  toUint(m["node_count"]),
+		recordSize: toUint(m["record_size"]),
+		ipVersion:  toUint(m["ip_version"]),
+	}
+	switch d.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("%s: unsupported record size %d", path, d.recordSize)
+	}
+	treeSize := d.nodeCount * d.recordSize / 4
+	if treeSize+16 > uint(i) {
+		return nil, fmt.Errorf("%s: search tree runs past the data section", path)
+	}
+	d.data = buf[treeSize+16 : i]
+
+	// IPv4 addresses live under ::/96 in an IPv6 tree.
+	if d.ipVersion == 6 {
+		for n := 0; n < 96 && d.ipv4Start < d.nodeCount; n++ {
+			d.ipv4Start = d.record(d.ipv4Start, 0)
+		}
+	}
+	return d, nil
+}
+
+// Lookup returns the record for ip, or nil when the database has none.
+func (d *DB) Lookup(ip net.IP) (map[string]interface{}, error) {
+	if ip == nil {
+		return nil, errors.New("invalid ip address")
+	}
+	node := uint(0)
+	bits := ip.To16()
+	if ip4 := ip.To4(); ip4 != nil {
+		bits = ip4
+		node = d.ipv4Start
+	} else if d.ipVersion == 4 {
+		return nil, nil
+	}
+
+	for i := 0; i < len(bits)*8 && node < d.nodeCount; i++ {
+		node = d.record(node, (bits[i/8]>>(7-uint(i%8)))&1)
+	}
+	if node <= d.nodeCount {
+		return nil, nil
+	}
+	offset := node - d.nodeCount - 16
+	if offset >= uint(len(d.data)) {
+		return nil, errors.New("corrupt search tree")
+	}
+	value, _, err := decode(d.data, offset)
+	if err != nil {
+		return nil, err
+	}
+	record, _ := value.(map[string]interface{})
+	return record, nil
+}
+
+// record reads the left (bit 0) or right (bit 1) record of a tree node.
+func (d *DB) record(node uint, bit byte) uint {
+	b := d.buf[node*d.recordSize/4:]
+	switch d.recordSize {
+	case 24:
+		b = b[uint(bit)*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[uint(bit)*4:]))
+	}
+}
+
+// Data section types.
+const (
+	typePointer = 1
+	typeString  = 2
+	typeDouble  = 3
+	typeBytes   = 4
+	typeUint16  = 5
+	typeUint32  = 6
+	typeMap     = 7
+	typeInt32   = 8
+	typeUint64  = 9
+	typeUint128 = 10
+	typeArray   = 11
+	typeBool    = 14
+	typeFloat   = 15
+)
+
+var errTruncated = errors.New("truncated data")
+
+// decode reads the value at offset in data and returns it with the offset
+// just past it. Pointers are relative to the start of data.
+func decode(data []byte, offset uint) (interface{}, uint, error) {
+	if offset >= uint(len(data)) {
+		return nil, 0, errTruncated
+	}
+	ctrl := data[offset]
+	offset++
+	kind := uint(ctrl >> 5)
+
+	if kind == typePointer {
+		ptr, next, err := pointer(data, offset, ctrl)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := decode(data, ptr)
+		return value, next, err
+	}
+	if kind == 0 {
+		if offset >= uint(len(data)) {
+			return nil, 0, errTruncated
+		}
+		kind = 7 + uint(data[offset])
+		offset++
+	}
+
+	size := uint(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if offset+n > uint(len(data)) {
+			return nil, 0, errTruncated
+		}
+		extra := uint(0)
+		for _, b := range data[offset : offset+n] {
+			extra = extra<<8 | uint(b)
+		}
+		offset += n
+		switch n {
+		case 1:
+			size = 29 + extra
+		case 2:
+			size = 285 + extra
+		default:
+			size = 65821 + extra
+		}
+	}
+
+	switch kind {
+	case typeMap:
+		m := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			key, next, err := decode(data, offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			value, next, err := decode(data, next)
+			if err != nil {
+				return nil, 0, err
+			}
+			k, _ := key.(string)
+			m[k] = value
+			offset = next
+		}
+		return m, offset, nil
+	case typeArray:
+		a := make([]interface{}, 0, size)
+		for i := uint(0); i < size; i++ {
+			value, next, err := decode(data, offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, value)
+			offset = next
+		}
+		return a, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	}
+
+	if offset+size > uint(len(data)) {
+		return nil, 0, errTruncated
+	}
+	b := data[offset : offset+size]
+	offset += size
+	switch kind {
+	case typeString:
+		return string(b), offset, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, errors.New("bad double")
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, errors.New("bad float")
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), offset, nil
+	case typeUint16, typeUint32, typeUint64, typeInt32:
+		v := uint64(0)
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		if kind == typeInt32 {
+			return int64(int32(v)), offset, nil
+		}
+		return v, offset, nil
+	case typeBytes, typeUint128:
+		return b, offset, nil
+	}
+	return nil, 0, fmt.Errorf("unsupported data type %d", kind)
+}
+
+func pointer(data []byte, offset uint, ctrl byte) (uint, uint, error) {
+	n := uint(ctrl>>3)&3 + 1
+	if offset+n > uint(len(data)) {
+		return 0, 0, errTruncated
+	}
+	v := uint(0)
+	if n < 4 {
+		v = uint(ctrl & 7)
+	}
+	for _, b := range data[offset : offset+n] {
+		v = v<<8 | uint(b)
+	}
+	switch n {
+	case 2:
+		v += 2048
+	case 3:
+		v += 526336
+	}
+	return v, offset + n, nil
+}
+
+func toUint(v interface{}) uint {
+	n, _ := v.(uint64)
+	return uint(n)
+}
+
+func first(v interface{}) interface{} {
+	if a, ok := v.([]interface{}); ok && len(a) > 0 {
+		return a[0]
+	}
+	return nil
+}
+
+func englishName(v interface{}) string {
+	m, _ := v.(map[string]interface{})
+	names, _ := m["names"].(map[string]interface{})
+	name, _ := names["en"].(string)
+	return name
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"errors"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/apikey"
+	"github.com/zesbe/lumina-ai/internal/audit"
+	"github.com/zesbe/lumina-ai/internal/crypto"
+	"github.com/zesbe/lumina-ai/internal/i18n"
+	"github.com/zesbe/lumina-ai/internal/mail"
+	"github.com/zesbe/lumina-ai/internal/middleware"
+	"github.com/zesbe/lumina-ai/internal/models"
+	"github.com/zesbe/lumina-ai/internal/session"
+	"github.com/zesbe/lumina-ai/internal/userstate"
+)
+
+// reauthWindow is how recently an account without a password must have
+// signed in to delete itself.
+const reauthWindow = 10 * time.Minute
+
+var errDeletionTokenInvalid = errors.New("deletion token invalid")
+
+// DeleteAccount schedules the caller's account for erasure after
+// ACCOUNT_DELETION_GRACE. The account is deactivated and signed out at
+// once; a link to cancel is mailed, and the erasure itself is done by the
+// erasure worker.
+func (h *Handlers) DeleteAccount() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+
+		var req models.DeleteAccountRequest
+		if apiErr := bindJSON(c, &req); apiErr != nil {
+			return apierror.Respond(c, apiErr)
+		}
+
+		if errs := middleware.ValidateRequest(c, &req); len(errs) > 0 {
+			return validationFailed(c, errs)
+		}
+		publicContent := req.PublicContent
+		if publicContent == "" {
+			publicContent = models.PublicContentDelete
+		}
+
+		var user models.User
+		if err := requestDB(c, h.db).First(&user, userID).Error; err != nil {
+			return notFound(c, "error.user_not_found")
+		}
+
+		// Accounts made through Google or GitHub have no password; for them
+		// a fresh sign-in stands in for it.
+		if user.PasswordHash != "" {
+			if valid, _ := crypto.VerifyPassword(req.Password, user.PasswordHash); !valid {
+				return errorResponse(c, fiber.StatusUnauthorized, apierror.CodeInvalidCredentials, i18n.T(c, "error.current_password_incorrect"))
+			}
+		} else {
+			started, err := session.StartedAt(requestDB(c, h.db), userID, currentSession(c))
+			if err != nil || time.Since(started) > reauthWindow {
+				return errorResponse(c, fiber.StatusUnauthorized, apierror.CodeReauthRequired, i18n.T(c, "error.reauth_required", i18n.Params{"minutes": int(reauthWindow.Minutes())}))
+			}
+		}
+
+		token, err := crypto.GenerateRandomToken(32)
+		if err != nil {
+			return internalError(c, "error.delete_account_failed")
+		}
+		tokenHash := crypto.HashToken(token)
+		deletion := models.AccountDeletion{
+			UserID:          user.ID,
+			Email:           user.Email,
+			Locale:          i18n.Locale(c),
+			PublicContent:   publicContent,
+			CancelTokenHash: &tokenHash,
+			ScheduledFor:    time.Now().Add(h.cfg.AccountDeletionGrace),
+		}
+
+		var sessionIDs, keyPrefixes []string
+		err = requestDB(c, h.db).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&deletion).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&user).Update("is_active", false).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&models.APIKey{}).Where("user_id = ?", user.ID).Pluck("prefix", &keyPrefixes).Error; err != nil {
+				return err
+			}
+			if sessionIDs, err = session.RevokeUser(tx, user.ID); err != nil {
+				return err
+			}
+
+			// Sent before committing: without the link the user couldn't
+			// change their mind, so no mail means no deletion.
+			return mail.Send(c.UserContext(), mail.Message{
+				To:      user.Email,
+				Subject: i18n.T(c, "email.account_deletion_scheduled.subject"),
+				Body: i18n.T(c, "email.account_deletion_scheduled.body", i18n.Params{
+					"date": deletion.ScheduledFor.UTC().Format("2 January 2006 15:04 MST"),
+					"link": h.cfg.AppURL + "/cancel-deletion?token=" + url.QueryEscape(token),
+				}),
+			})
+		})
+		if err != nil {
+			middleware.Log(c).Error("failed to schedule account deletion", "error", err)
+			return internalError(c, "error.delete_account_failed")
+		}
+
+		userstate.Forget(user.ID)
+		for _, prefix := range keyPrefixes {
+			apikey.Forget(prefix)
+		}
+		if current := currentSession(c); current != "" && !slices.Contains(sessionIDs, current) {
+			sessionIDs = append(sessionIDs, current)
+		}
+		h.endSessions(c, sessionIDs...)
+
+		audit.Record(c, models.AuditAccountDelete, audit.User(user.ID), fiber.Map{
+			"public_content": publicContent,
+			"scheduled_for":  deletion.ScheduledFor,
+			"sessions":       len(sessionIDs),
+		})
+
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+			"message":       i18n.T(c, "message.account_deletion_scheduled"),
+			"scheduled_for": deletion.ScheduledFor,
+		})
+	}
+}
+
+// CancelDeletion calls off a scheduled deletion with the token mailed
+// when it was requested, and reactivates the account. It works until the
+// erasure starts.
+func (h *Handlers) CancelDeletion() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.CancelDeletionRequest
+		if apiErr := bindJSON(c, &req); apiErr != nil {
+			return apierror.Respond(c, apiErr)
+		}
+
+		if errs := middleware.ValidateRequest(c, &req); len(errs) > 0 {
+			return validationFailed(c, errs)
+		}
+
+		var deletion models.AccountDeletion
+		err := requestDB(c, h.db).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("cancel_token_hash = ? AND started_at IS NULL", crypto.HashToken(req.Token)).
+				First(&deletion).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return errDeletionTokenInvalid
+				}
+				return err
+			}
+			if err := tx.Delete(&deletion).Error; err != nil {
+				return err
+			}
+			return tx.Model(&models.User{}).Where("id = ?", deletion.UserID).Update("is_active", true).Error
+		})
+		switch {
+		case errors.Is(err, errDeletionTokenInvalid):
+			return errorResponse(c, fiber.StatusBadRequest, apierror.CodeInvalidToken, i18n.T(c, "error.deletion_token_invalid"))
+		case err != nil:
+			middleware.Log(c).Error("failed to cancel account deletion", "error", err)
+			return internalError(c, "error.cancel_deletion_failed")
+		}
+		userstate.Forget(deletion.UserID)
+
+		audit.RecordAs(c, nil, models.AuditDeletionCancel, audit.User(deletion.UserID), nil)
+
+		return c.JSON(fiber.Map{
+			"message": i18n.T(c, "message.account_deletion_cancelled"),
+		})
+	}
+}
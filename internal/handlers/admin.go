@@ -0,0 +1,707 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/audit"
+	"github.com/zesbe/lumina-ai/internal/i18n"
+	"github.com/zesbe/lumina-ai/internal/lockout"
+	"github.com/zesbe/lumina-ai/internal/maintenance"
+	"github.com/zesbe/lumina-ai/internal/middleware"
+	"github.com/zesbe/lumina-ai/internal/models"
+	"github.com/zesbe/lumina-ai/internal/moderation"
+	"github.com/zesbe/lumina-ai/internal/services"
+	"github.com/zesbe/lumina-ai/internal/userstate"
+)
+
+var errNegativeBalance = errors.New("adjustment would make the balance negative")
+
+// AdjustUserCredits grants (positive amount) or removes (negative amount)
+// credits. The balance change and its ledger row are written in one
+// transaction under a row lock, and removals can't take the balance below
+// zero.
+func (h *Handlers) AdjustUserCredits() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		adminID := c.Locals("userID").(uint)
+		id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+		if err != nil {
+			return badRequest(c, "error.invalid_user_id")
+		}
+
+		var req models.AdjustCreditsRequest
+		if apiErr := bindJSON(c, &req); apiErr != nil {
+			return apierror.Respond(c, apiErr)
+		}
+
+		if errs := middleware.ValidateRequest(c, &req); len(errs) > 0 {
+			return validationFailed(c, errs)
+		}
+
+		var user models.User
+		var ledger models.CreditTransaction
+		err = requestDB(c, h.db).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, id).Error; err != nil {
+				return err
+			}
+
+			balance := user.Credits + req.Amount
+			if balance < 0 {
+				return errNegativeBalance
+			}
+
+			if err := tx.Model(&user).Update("credits", balance).Error; err != nil {
+				return err
+			}
+
+			ledger = models.CreditTransaction{
+				UserID:        user.ID,
+				Amount:        req.Amount,
+				Type:          "admin_adjustment",
+				Description:   truncate(fmt.Sprintf("Admin #%d: %s", adminID, req.Reason), 255),
+				BalanceBefore: user.Credits,
+				BalanceAfter:  balance,
+			}
+			if err := tx.Create(&ledger).Error; err != nil {
+				return err
+			}
+
+			user.Credits = balance
+			return nil
+		})
+
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return notFound(c, "error.user_not_found")
+		case errors.Is(err, errNegativeBalance):
+			return errorResponse(c, fiber.StatusUnprocessableEntity, apierror.CodeCreditsBelowZero, i18n.T(c, "error.credits_below_zero", i18n.Params{"credits": user.Credits}))
+		case err != nil:
+			return internalError(c, "error.adjust_credits_failed")
+		}
+
+		audit.Record(c, models.AuditCreditGrant, audit.User(user.ID), fiber.Map{
+			"amount":         req.Amount,
+			"reason":         req.Reason,
+			"balance_before": ledger.BalanceBefore,
+			"balance_after":  ledger.BalanceAfter,
+			"transaction_id": ledger.ID,
+		})
+
+		h.hub.SendToUser(user.ID, fiber.Map{
+			"type":    "credits_updated",
+			"credits": user.Credits,
+			"delta":   req.Amount,
+		})
+
+		return c.JSON(fiber.Map{
+			"message":     i18n.T(c, "message.credits_adjusted"),
+			"user":        user.ToResponse(),
+			"transaction": ledger,
+		})
+	}
+}
+
+// PromoteUser gives an existing user the admin role. Promoting someone
+// who is already an admin is a no-op.
+func (h *Handlers) PromoteUser() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+		if err != nil {
+			return badRequest(c, "error.invalid_user_id")
+		}
+
+		var user models.User
+		if err := requestDB(c, h.db).First(&user, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return notFound(c, "error.user_not_found")
+			}
+			return internalError(c, "error.update_role_failed")
+		}
+
+		if user.Role != "admin" {
+			previousRole := user.Role
+			if err := requestDB(c, h.db).Model(&user).Update("role", "admin").Error; err != nil {
+				return internalError(c, "error.update_role_failed")
+			}
+			userstate.Forget(user.ID)
+
+			audit.Record(c, models.AuditRoleChange, audit.User(user.ID), fiber.Map{
+				"from": previousRole,
+				"to":   "admin",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"message": i18n.T(c, "message.user_promoted"),
+			"user":    user.ToResponse(),
+		})
+	}
+}
+
+// ClearLockout lifts a login lockout and forgets the user's failed
+// attempts, e.g. once they have confirmed who they are to support.
+func (h *Handlers) ClearLockout() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+		if err != nil {
+			return badRequest(c, "error.invalid_user_id")
+		}
+
+		var user models.User
+		if err := requestDB(c, h.db).First(&user, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return notFound(c, "error.user_not_found")
+			}
+			return internalError(c, "error.clear_lockout_failed")
+		}
+
+		if err := lockout.Reset(user.ID); err != nil {
+			middleware.Log(c).Error("failed to clear login lockout", "error", err)
+			return internalError(c, "error.clear_lockout_failed")
+		}
+
+		audit.Record(c, models.AuditLockoutClear, audit.User(user.ID), nil)
+
+		return c.JSON(fiber.Map{
+			"message": i18n.T(c, "message.lockout_cleared"),
+		})
+	}
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
+
+// AdminListGenerations browses generations across all users, newest
+// first, filtered by user, type, status, model and created_at range.
+func (h *Handlers) AdminListGenerations() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		page, _ := strconv.Atoi(c.Query("page", "1"))
+		limit, _ := strconv.Atoi(c.Query("limit", "50"))
+
+		if page < 1 {
+			page = 1
+		}
+		if limit < 1 || limit > 200 {
+			limit = 50
+		}
+
+		query := requestDB(c, h.db).Model(&models.Generation{})
+
+		if user := c.Query("user"); user != "" {
+			userID, err := strconv.ParseUint(user, 10, 32)
+			if err != nil {
+				return badRequest(c, "error.invalid_user_id")
+			}
+			query = query.Where("user_id = ?", userID)
+		}
+		if genType := c.Query("type"); genType != "" {
+			query = query.Where("type = ?", genType)
+		}
+		if status := c.Query("status"); status != "" {
+			query = query.Where("status = ?", status)
+		}
+		if model := c.Query("model"); model != "" {
+			query = query.Where("model = ?", model)
+		}
+
+		from, to, err := parseDateRange(c.Query("from"), c.Query("to"))
+		if err != nil {
+			return errorResponse(c, fiber.StatusBadRequest, apierror.CodeBadRequest, i18n.Message(c, err))
+		}
+		if !from.IsZero() {
+			query = query.Where("created_at >= ?", from)
+		}
+		if !to.IsZero() {
+			query = query.Where("created_at < ?", to)
+		}
+
+		var total pageTotal
+		query.Count(&total.Total)
+
+		var generations []models.Generation
+		if err := query.Preload("User").Order("created_at DESC").Offset((page - 1) * limit).Limit(limit).Find(&generations).Error; err != nil {
+			return internalError(c, "error.fetch_generations_failed")
+		}
+
+		base := middleware.GetBaseURL(c)
+		responses := make([]models.AdminGenerationResponse, len(generations))
+		for i := range generations {
+			responses[i] = generations[i].ToAdminResponse(base)
+		}
+
+		return newPage(responses, page, limit, total).send(c, "generations")
+	}
+}
+
+func (h *Handlers) AdminGetGeneration() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		generation, err := findGenerationForAdmin(c, h.db)
+		if generation == nil {
+			return err
+		}
+
+		return c.JSON(fiber.Map{
+			"generation": generation.ToAdminResponse(middleware.GetBaseURL(c)),
+		})
+	}
+}
+
+// AdminFailGeneration marks a stuck pending/processing generation as
+// failed and refunds anything it was charged. A job still running for it
+// is cancelled, so it can't complete the generation afterwards.
+func (h *Handlers) AdminFailGeneration() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.ForceFailGenerationRequest
+		if apiErr := bindJSON(c, &req); apiErr != nil {
+			return apierror.Respond(c, apiErr)
+		}
+
+		if errs := middleware.ValidateRequest(c, &req); len(errs) > 0 {
+			return validationFailed(c, errs)
+		}
+
+		generation, err := findGenerationForAdmin(c, h.db)
+		if generation == nil {
+			return err
+		}
+
+		switch generation.Status {
+		case models.StatusPending, models.StatusProcessing, models.StatusInterrupted:
+		default:
+			return conflict(c, "error.generation_not_in_progress")
+		}
+
+		refunded, err := services.FinalizeGeneration(requestDB(c, h.db), generation, services.Outcome{
+			Status:       models.StatusFailed,
+			ErrorMessage: "Failed by support: " + req.Reason,
+			Description:  "Refund: generation failed by support",
+		})
+		if errors.Is(err, services.ErrGenerationSettled) {
+			// Its job finished between the lookup and the update.
+			return conflict(c, "error.generation_not_in_progress")
+		}
+		if err != nil {
+			return internalError(c, "error.update_generation_failed")
+		}
+		stopped := h.jobs.stop(generation.ID)
+
+		invalidateGenerations(h.cache, generation.UserID)
+
+		audit.Record(c, models.AuditGenerationFail, audit.Generation(generation.ID), fiber.Map{
+			"reason":      req.Reason,
+			"refunded":    refunded,
+			"job_stopped": stopped,
+		})
+
+		h.hub.SendToUser(generation.UserID, fiber.Map{
+			"type":       "generation_failed",
+			"generation": generation.ToResponse(middleware.GetBaseURL(c)),
+			"error":      generation.ErrorMessage,
+		})
+		notifyGeneration(requestDB(c, h.db), h.hub, i18n.Locale(c), generation)
+		mailGeneration(h.jobs.ctx, h.db, h.cfg, h.hub, i18n.Locale(c), middleware.GetBaseURL(c), *generation)
+
+		return c.JSON(fiber.Map{
+			"message":    i18n.T(c, "message.generation_failed_by_admin"),
+			"generation": generation.ToAdminResponse(middleware.GetBaseURL(c)),
+			"refunded":   refunded,
+		})
+	}
+}
+
+// AdminRetryGeneration re-runs a failed generation for its owner with the
+// stored inputs. The owner is charged on completion as usual, so they need
+// enough credits now.
+func (h *Handlers) AdminRetryGeneration() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		generation, err := findGenerationForAdmin(c, h.db)
+		if generation == nil {
+			return err
+		}
+
+		if generation.Status != models.StatusFailed {
+			return conflict(c, "error.generation_not_failed")
+		}
+
+		if !h.minimax.IsConfigured() {
+			return errorResponse(c, fiber.StatusServiceUnavailable, apierror.CodeProviderUnavailable, i18n.T(c, "error.provider_not_configured"))
+		}
+
+		// No new work starts while maintenance is on.
+		if state := maintenance.Current(); state.Enabled {
+			return middleware.MaintenanceResponse(c, state)
+		}
+
+		if generation.User.Credits < generation.CreditsCost {
+			return errorResponse(c, fiber.StatusPaymentRequired, apierror.CodeInsufficientCredits, i18n.T(c, "error.owner_insufficient_credits"))
+		}
+
+		previousError := generation.ErrorMessage
+		generation.Status = models.StatusProcessing
+		generation.ErrorMessage = ""
+		generation.OutputURL = ""
+		generation.MiniMaxJobID = ""
+		if err := requestDB(c, h.db).Save(generation).Error; err != nil {
+			return internalError(c, "error.update_generation_failed")
+		}
+
+		invalidateGenerations(h.cache, generation.UserID)
+
+		audit.Record(c, models.AuditGenerationRetry, audit.Generation(generation.ID), fiber.Map{
+			"previous_error": previousError,
+		})
+
+		h.hub.SendToUser(generation.UserID, fiber.Map{
+			"type":       "generation_started",
+			"generation": generation.ToResponse(middleware.GetBaseURL(c)),
+		})
+
+		// Stored text was HTML-escaped on the way in; the provider needs
+		// the original.
+		job := h.newGenerationJob(c, *generation)
+		switch generation.Type {
+		case models.TypeMusic:
+			go job.runMusic(models.GenerateMusicRequest{
+				Model:  generation.Model,
+				Title:  html.UnescapeString(generation.Title),
+				Prompt: html.UnescapeString(generation.Prompt),
+				Lyrics: html.UnescapeString(generation.Lyrics),
+				Style:  html.UnescapeString(generation.Style),
+			})
+		case models.TypeVideo:
+			go job.runVideo(models.GenerateVideoRequest{
+				Title:     html.UnescapeString(generation.Title),
+				Prompt:    html.UnescapeString(generation.Prompt),
+				Narration: html.UnescapeString(generation.Narration),
+				VoiceID:   generation.VoiceID,
+			})
+		}
+
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+			"message":    i18n.T(c, "message.generation_requeued"),
+			"generation": generation.ToAdminResponse(middleware.GetBaseURL(c)),
+		})
+	}
+}
+
+// AdminUnpublishGeneration takes a generation off Explore and marks it
+// removed so the owner can't republish it. Optionally the owner loses the
+// right to publish anything.
+func (h *Handlers) AdminUnpublishGeneration() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.UnpublishGenerationRequest
+		if apiErr := bindJSON(c, &req); apiErr != nil {
+			return apierror.Respond(c, apiErr)
+		}
+
+		if errs := middleware.ValidateRequest(c, &req); len(errs) > 0 {
+			return validationFailed(c, errs)
+		}
+
+		generation, err := findGenerationForAdmin(c, h.db)
+		if generation == nil {
+			return err
+		}
+
+		err = requestDB(c, h.db).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(generation).Updates(map[string]interface{}{
+				"is_public":         false,
+				"moderation_status": models.ModerationRemoved,
+				"moderation_reason": req.Reason,
+			}).Error; err != nil {
+				return err
+			}
+			if req.BanUserFromPublishing {
+				if err := tx.Model(&generation.User).Update("publishing_banned", true).Error; err != nil {
+					return err
+				}
+				// Anything else they have on Explore goes too.
+				return tx.Model(&models.Generation{}).
+					Where("user_id = ? AND is_public = ?", generation.UserID, true).
+					Update("is_public", false).Error
+			}
+			return nil
+		})
+		if err != nil {
+			return internalError(c, "error.update_generation_failed")
+		}
+
+		invalidateGenerations(h.cache, generation.UserID)
+
+		audit.Record(c, models.AuditContentTakedown, audit.Generation(generation.ID), fiber.Map{
+			"owner_id":                 generation.UserID,
+			"reason":                   req.Reason,
+			"ban_user_from_publishing": req.BanUserFromPublishing,
+		})
+
+		h.hub.SendToUser(generation.UserID, fiber.Map{
+			"type":          "generation_removed",
+			"generation_id": generation.ID,
+			"reason":        req.Reason,
+			"banned":        req.BanUserFromPublishing,
+		})
+		locale := i18n.Locale(c)
+		notify(requestDB(c, h.db), h.hub, locale, generationNotification(generation, models.NotifyContentModerated), i18n.Params{
+			"title":  generationTitle(locale, generation),
+			"reason": req.Reason,
+		})
+
+		return c.JSON(fiber.Map{
+			"message":    i18n.T(c, "message.generation_unpublished"),
+			"generation": generation.ToAdminResponse(middleware.GetBaseURL(c)),
+		})
+	}
+}
+
+// AdminModerationQueue lists the public generations the publish filter
+// held for review, oldest first, so they are handled in the order they
+// came in. Approve them with AdminApproveGeneration or take them down with
+// AdminUnpublishGeneration.
+func (h *Handlers) AdminModerationQueue() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		page, _ := strconv.Atoi(c.Query("page", "1"))
+		limit, _ := strconv.Atoi(c.Query("limit", "50"))
+
+		if page < 1 {
+			page = 1
+		}
+		if limit < 1 || limit > 200 {
+			limit = 50
+		}
+
+		query := requestDB(c, h.db).Model(&models.Generation{}).
+			Where("is_public = ? AND moderation_status = ?", true, models.ModerationPendingReview)
+
+		var total pageTotal
+		query.Count(&total.Total)
+
+		var generations []models.Generation
+		if err := query.Preload("User").Order("updated_at ASC, id ASC").Offset((page - 1) * limit).Limit(limit).Find(&generations).Error; err != nil {
+			return internalError(c, "error.fetch_generations_failed")
+		}
+
+		base := middleware.GetBaseURL(c)
+		responses := make([]models.AdminGenerationResponse, len(generations))
+		for i := range generations {
+			responses[i] = generations[i].ToAdminResponse(base)
+		}
+
+		return newPage(responses, page, limit, total).send(c, "generations")
+	}
+}
+
+// AdminApproveGeneration lets a generation held for review onto Explore.
+// The approval stands until the owner changes its title.
+func (h *Handlers) AdminApproveGeneration() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		generation, err := findGenerationForAdmin(c, h.db)
+		if generation == nil {
+			return err
+		}
+		if generation.ModerationStatus != models.ModerationPendingReview {
+			return conflict(c, "error.generation_not_held")
+		}
+
+		reason := generation.ModerationReason
+		if err := requestDB(c, h.db).Model(generation).Updates(map[string]interface{}{
+			"moderation_status": models.ModerationApproved,
+			"moderation_reason": "",
+		}).Error; err != nil {
+			return internalError(c, "error.update_generation_failed")
+		}
+		invalidateGenerations(h.cache, generation.UserID)
+
+		audit.Record(c, models.AuditContentApproved, audit.Generation(generation.ID), fiber.Map{
+			"owner_id": generation.UserID,
+			"reason":   reason,
+		})
+
+		return c.JSON(fiber.Map{
+			"message":    i18n.T(c, "message.generation_approved"),
+			"generation": generation.ToAdminResponse(middleware.GetBaseURL(c)),
+		})
+	}
+}
+
+// findGenerationForAdmin loads the :id generation of any user with its
+// owner. When it can't, it writes the 400/404 response itself and returns
+// a nil generation; callers then return the error as-is.
+func findGenerationForAdmin(c *fiber.Ctx, db *gorm.DB) (*models.Generation, error) {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return nil, badRequest(c, "error.invalid_generation_id")
+	}
+
+	var generation models.Generation
+	if err := requestDB(c, db).Preload("User").First(&generation, id).Error; err != nil {
+		return nil, notFound(c, "error.generation_not_found")
+	}
+	return &generation, nil
+}
+
+// ListModerationRules returns the blocklist, including inactive rules.
+func (h *Handlers) ListModerationRules() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var rules []models.ModerationRule
+		if err := requestDB(c, h.db).Order("created_at DESC").Find(&rules).Error; err != nil {
+			return internalError(c, "error.fetch_moderation_rules_failed")
+		}
+
+		return c.JSON(fiber.Map{
+			"rules": rules,
+		})
+	}
+}
+
+// CreateModerationRule adds a blocklist entry and reloads the rules so it
+// applies immediately on this instance (others pick it up on their next
+// reload).
+func (h *Handlers) CreateModerationRule() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.CreateModerationRuleRequest
+		if apiErr := bindJSON(c, &req); apiErr != nil {
+			return apierror.Respond(c, apiErr)
+		}
+
+		v := middleware.NewLocalizedValidator(i18n.Locale(c)).Struct(&req)
+		if _, err := moderation.CompilePattern(req.Pattern, req.IsRegex); req.Pattern != "" && err != nil {
+			v.AddRuleError("pattern", "invalid", nil)
+		}
+		if v.HasErrors() {
+			return validationFailed(c, v.Errors())
+		}
+
+		adminID := c.Locals("userID").(uint)
+		rule := models.ModerationRule{
+			Pattern:   req.Pattern,
+			IsRegex:   req.IsRegex,
+			Reason:    req.Reason,
+			IsActive:  true,
+			CreatedBy: &adminID,
+		}
+		if err := requestDB(c, h.db).Create(&rule).Error; err != nil {
+			return internalError(c, "error.save_moderation_rule_failed")
+		}
+
+		if err := moderation.Reload(c.UserContext()); err != nil {
+			middleware.Log(c).Warn("failed to reload moderation rules", "error", err)
+		}
+
+		audit.Record(c, models.AuditModerationRule, audit.Target{Type: "moderation_rule", ID: strconv.FormatUint(uint64(rule.ID), 10)}, fiber.Map{
+			"op":       "create",
+			"pattern":  rule.Pattern,
+			"is_regex": rule.IsRegex,
+		})
+
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"rule": rule,
+		})
+	}
+}
+
+func (h *Handlers) DeleteModerationRule() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+		if err != nil {
+			return badRequest(c, "error.invalid_rule_id")
+		}
+
+		var rule models.ModerationRule
+		if err := requestDB(c, h.db).First(&rule, id).Error; err != nil {
+			return notFound(c, "error.moderation_rule_not_found")
+		}
+
+		if err := requestDB(c, h.db).Delete(&rule).Error; err != nil {
+			return internalError(c, "error.save_moderation_rule_failed")
+		}
+
+		if err := moderation.Reload(c.UserContext()); err != nil {
+			middleware.Log(c).Warn("failed to reload moderation rules", "error", err)
+		}
+
+		audit.Record(c, models.AuditModerationRule, audit.Target{Type: "moderation_rule", ID: strconv.FormatUint(uint64(rule.ID), 10)}, fiber.Map{
+			"op":      "delete",
+			"pattern": rule.Pattern,
+		})
+
+		return c.JSON(fiber.Map{
+			"message": i18n.T(c, "message.moderation_rule_deleted"),
+		})
+	}
+}
+
+// GetModerationBlocks lists recently blocked generate requests. Blocks are
+// stored in the audit log, so this is a fixed-action view of it.
+func (h *Handlers) GetModerationBlocks() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		page, _ := strconv.Atoi(c.Query("page", "1"))
+		limit, _ := strconv.Atoi(c.Query("limit", "50"))
+
+		if page < 1 {
+			page = 1
+		}
+		if limit < 1 || limit > 200 {
+			limit = 50
+		}
+
+		query := requestDB(c, h.db).Model(&models.AuditLog{}).Where("action = ?", models.AuditModerationBlocked)
+
+		var total pageTotal
+		query.Count(&total.Total)
+
+		var entries []models.AuditLog
+		if err := query.Order("created_at DESC").Offset((page - 1) * limit).Limit(limit).Find(&entries).Error; err != nil {
+			return internalError(c, "error.fetch_audit_logs_failed")
+		}
+
+		return newPage(entries, page, limit, total).send(c, "blocks")
+	}
+}
+
+// parseDateRange parses optional from/to query values given either as
+// RFC 3339 timestamps or as UTC dates (YYYY-MM-DD). A date-only "to" is
+// inclusive, i.e. it covers the whole day.
+func parseDateRange(fromStr, toStr string) (time.Time, time.Time, error) {
+	var from, to time.Time
+	var err error
+
+	if fromStr != "" {
+		if from, _, err = parseDate(fromStr); err != nil {
+			return from, to, i18n.NewError("error.invalid_from_date")
+		}
+	}
+	if toStr != "" {
+		var dateOnly bool
+		if to, dateOnly, err = parseDate(toStr); err != nil {
+			return from, to, i18n.NewError("error.invalid_to_date")
+		}
+		if dateOnly {
+			to = to.AddDate(0, 0, 1)
+		}
+	}
+	if !from.IsZero() && !to.IsZero() && !to.After(from) {
+		return from, to, i18n.NewError("error.invalid_date_range")
+	}
+
+	return from, to, nil
+}
+
+func parseDate(value string) (time.Time, bool, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t.UTC(), true, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return t.UTC(), false, err
+}
@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/database"
+	"github.com/zesbe/lumina-ai/internal/i18n"
+	"github.com/zesbe/lumina-ai/internal/middleware"
+	"github.com/zesbe/lumina-ai/internal/models"
+	"github.com/zesbe/lumina-ai/internal/settings"
+)
+
+const (
+	analyticsDefaultDays = 30
+	analyticsTopStyles   = 10
+)
+
+type bucketCount struct {
+	Bucket time.Time
+	Count  int64
+}
+
+type generationBucket struct {
+	Bucket time.Time
+	Type   models.GenerationType
+	Status models.GenerationStatus
+	Count  int64
+}
+
+type modelFailures struct {
+	Model  string
+	Total  int64
+	Failed int64
+}
+
+type creditTotals struct {
+	Type     string
+	Consumed int64
+	Granted  int64
+}
+
+type styleCount struct {
+	Style string
+	Count int64
+}
+
+type presetOutcomes struct {
+	Name      string
+	Total     int64
+	Completed int64
+	Failed    int64
+}
+
+func (p presetOutcomes) successRate() float64 {
+	if p.Total == 0 {
+		return 0
+	}
+	return float64(p.Completed) / float64(p.Total)
+}
+
+// GetAnalytics reports signups, active users, generations, model failure
+// rates, credit flow, top styles and style presets ranked by success rate
+// for a UTC date range. Everything is
+// aggregated in SQL and the result is cached for a few minutes.
+//
+// from/to accept YYYY-MM-DD (to is inclusive) or RFC 3339 and default to
+// the last 30 days; granularity is day (default) or week, with weeks
+// starting on Monday.
+func (h *Handlers) GetAnalytics() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		granularity := c.Query("granularity", "day")
+		if granularity != "day" && granularity != "week" {
+			return badRequest(c, "error.invalid_granularity")
+		}
+
+		from, to, err := parseDateRange(c.Query("from"), c.Query("to"))
+		if err != nil {
+			return errorResponse(c, fiber.StatusBadRequest, apierror.CodeBadRequest, i18n.Message(c, err))
+		}
+		from, to = defaultAnalyticsRange(from, to, time.Now())
+
+		cacheKey := fmt.Sprintf("analytics:%s:%d:%d", granularity, from.Unix(), to.Unix())
+		if h.cache != nil {
+			var cached fiber.Map
+			if err := h.cache.Get(cacheKey, &cached); err == nil {
+				return c.JSON(cached)
+			}
+		}
+
+		result, err := buildAnalytics(database.Reader(requestDB(c, h.db), 0), from, to, granularity)
+		if err != nil {
+			middleware.Log(c).Error("analytics query failed", "error", err)
+			return internalError(c, "error.fetch_analytics_failed")
+		}
+
+		if ttl := settings.Current().AnalyticsCacheTTL(); h.cache != nil && ttl > 0 {
+			h.cache.Set(cacheKey, result, ttl)
+		}
+
+		return c.JSON(result)
+	}
+}
+
+// defaultAnalyticsRange fills in a missing end with the end of today and a
+// missing start with analyticsDefaultDays before the end, all in UTC.
+func defaultAnalyticsRange(from, to, now time.Time) (time.Time, time.Time) {
+	if to.IsZero() {
+		to = truncateDay(now.UTC()).AddDate(0, 0, 1)
+	}
+	if from.IsZero() {
+		from = to.AddDate(0, 0, -analyticsDefaultDays)
+	}
+	return from, to
+}
+
+// realGenerations leaves out demo mode's placeholder generations, which
+// never reached the provider and would skew the counts and failure rates.
+func realGenerations(db *gorm.DB) *gorm.DB {
+	return db.Model(&models.Generation{}).Where("generations.is_demo = ?", false)
+}
+
+func buildAnalytics(db *gorm.DB, from, to time.Time, granularity string) (fiber.Map, error) {
+	bucket := fmt.Sprintf("date_trunc('%s', created_at AT TIME ZONE 'UTC')", granularity)
+
+	var signups []bucketCount
+	if err := db.Model(&models.User{}).
+		Select(bucket+" AS bucket, COUNT(*) AS count").
+		Where("created_at >= ? AND created_at < ?", from, to).
+		Group("bucket").Order("bucket").
+		Scan(&signups).Error; err != nil {
+		return nil, err
+	}
+
+	// A user is active in a bucket if they generated something or logged in.
+	var active []bucketCount
+	if err := db.Raw(`
+		SELECT `+bucket+` AS bucket, COUNT(DISTINCT user_id) AS count
+		FROM (
+			SELECT user_id, created_at FROM generations
+			WHERE created_at >= ? AND created_at < ?
+			UNION ALL
+			SELECT actor_id AS user_id, created_at FROM audit_logs
+			WHERE action = ? AND actor_id IS NOT NULL AND created_at >= ? AND created_at < ?
+		) activity
+		GROUP BY bucket ORDER BY bucket`,
+		from, to, models.AuditLogin, from, to,
+	).Scan(&active).Error; err != nil {
+		return nil, err
+	}
+
+	var generations []generationBucket
+	if err := realGenerations(db).
+		Select(bucket+" AS bucket, type, status, COUNT(*) AS count").
+		Where("created_at >= ? AND created_at < ?", from, to).
+		Group("bucket, type, status").Order("bucket").
+		Scan(&generations).Error; err != nil {
+		return nil, err
+	}
+
+	var failures []modelFailures
+	if err := realGenerations(db).
+		Select("COALESCE(NULLIF(model, ''), 'unknown') AS model, COUNT(*) AS total, COUNT(*) FILTER (WHERE status = ?) AS failed", models.StatusFailed).
+		Where("created_at >= ? AND created_at < ?", from, to).
+		Group("1").Order("total DESC").
+		Scan(&failures).Error; err != nil {
+		return nil, err
+	}
+
+	var credits []creditTotals
+	if err := db.Model(&models.CreditTransaction{}).
+		Select("type, COALESCE(-SUM(amount) FILTER (WHERE amount < 0), 0) AS consumed, COALESCE(SUM(amount) FILTER (WHERE amount > 0), 0) AS granted").
+		Where("created_at >= ? AND created_at < ?", from, to).
+		Group("type").
+		Scan(&credits).Error; err != nil {
+		return nil, err
+	}
+
+	var styles []styleCount
+	if err := realGenerations(db).
+		Select("style, COUNT(*) AS count").
+		Where("created_at >= ? AND created_at < ? AND style <> ''", from, to).
+		Group("style").Order("count DESC").Limit(analyticsTopStyles).
+		Scan(&styles).Error; err != nil {
+		return nil, err
+	}
+
+	// Deleted presets are still joined, so their generations keep counting.
+	var presets []presetOutcomes
+	if err := realGenerations(db).
+		Select("style_presets.name AS name, COUNT(*) AS total, "+
+			"COUNT(*) FILTER (WHERE generations.status = ?) AS completed, "+
+			"COUNT(*) FILTER (WHERE generations.status = ?) AS failed", models.StatusCompleted, models.StatusFailed).
+		Joins("JOIN style_presets ON style_presets.id = generations.style_preset_id").
+		Where("generations.created_at >= ? AND generations.created_at < ?", from, to).
+		Group("style_presets.name").
+		Scan(&presets).Error; err != nil {
+		return nil, err
+	}
+
+	buckets := analyticsBuckets(from, to, granularity)
+
+	byBucket := make(map[string]fiber.Map, len(buckets))
+	generationSeries := make([]fiber.Map, len(buckets))
+	for i, b := range buckets {
+		entry := fiber.Map{"date": b, "total": int64(0), "by_type": fiber.Map{}, "by_status": fiber.Map{}}
+		byBucket[b] = entry
+		generationSeries[i] = entry
+	}
+	for _, g := range generations {
+		entry, ok := byBucket[formatBucket(g.Bucket)]
+		if !ok {
+			continue
+		}
+		entry["total"] = entry["total"].(int64) + g.Count
+		addCount(entry["by_type"].(fiber.Map), string(g.Type), g.Count)
+		addCount(entry["by_status"].(fiber.Map), string(g.Status), g.Count)
+	}
+
+	failureRates := make([]fiber.Map, len(failures))
+	for i, f := range failures {
+		rate := 0.0
+		if f.Total > 0 {
+			rate = float64(f.Failed) / float64(f.Total)
+		}
+		failureRates[i] = fiber.Map{"model": f.Model, "total": f.Total, "failed": f.Failed, "failure_rate": rate}
+	}
+
+	var consumed, granted int64
+	creditsByType := fiber.Map{}
+	for _, t := range credits {
+		consumed += t.Consumed
+		granted += t.Granted
+		creditsByType[t.Type] = fiber.Map{"consumed": t.Consumed, "granted": t.Granted}
+	}
+
+	topStyles := make([]fiber.Map, len(styles))
+	for i, s := range styles {
+		topStyles[i] = fiber.Map{"style": s.Style, "count": s.Count}
+	}
+
+	sort.SliceStable(presets, func(i, j int) bool {
+		ri, rj := presets[i].successRate(), presets[j].successRate()
+		if ri != rj {
+			return ri > rj
+		}
+		return presets[i].Total > presets[j].Total
+	})
+	presetRanking := make([]fiber.Map, len(presets))
+	for i, p := range presets {
+		presetRanking[i] = fiber.Map{
+			"name":         p.Name,
+			"total":        p.Total,
+			"completed":    p.Completed,
+			"failed":       p.Failed,
+			"success_rate": p.successRate(),
+		}
+	}
+
+	return fiber.Map{
+		"range": fiber.Map{
+			"from":        from.Format(time.RFC3339),
+			"to":          to.Format(time.RFC3339),
+			"granularity": granularity,
+			"timezone":    "UTC",
+		},
+		"signups":       fillSeries(buckets, signups),
+		"active_users":  fillSeries(buckets, active),
+		"generations":   generationSeries,
+		"failure_rates": failureRates,
+		"credits": fiber.Map{
+			"consumed": consumed,
+			"granted":  granted,
+			"by_type":  creditsByType,
+		},
+		"top_styles":    topStyles,
+		"style_presets": presetRanking,
+	}, nil
+}
+
+// analyticsBuckets lists every bucket start in [from, to) so days without
+// activity show up as zeros instead of gaps.
+func analyticsBuckets(from, to time.Time, granularity string) []string {
+	start := truncateDay(from.UTC())
+	step := 1
+	if granularity == "week" {
+		// date_trunc('week') starts weeks on Monday.
+		start = start.AddDate(0, 0, -((int(start.Weekday()) + 6) % 7))
+		step = 7
+	}
+
+	var buckets []string
+	for t := start; t.Before(to); t = t.AddDate(0, 0, step) {
+		buckets = append(buckets, formatBucket(t))
+	}
+	return buckets
+}
+
+func fillSeries(buckets []string, counts []bucketCount) []fiber.Map {
+	byBucket := make(map[string]int64, len(counts))
+	for _, c := range counts {
+		byBucket[formatBucket(c.Bucket)] = c.Count
+	}
+
+	series := make([]fiber.Map, len(buckets))
+	for i, b := range buckets {
+		series[i] = fiber.Map{"date": b, "count": byBucket[b]}
+	}
+	return series
+}
+
+func addCount(m fiber.Map, key string, n int64) {
+	current, _ := m[key].(int64)
+	m[key] = current + n
+}
+
+func formatBucket(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+func truncateDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
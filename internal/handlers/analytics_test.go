@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/zesbe/lumina-ai/internal/i18n"
+)
+
+func utc(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		panic(err)
+	}
+	return t.UTC()
+}
+
+func TestParseDateRange(t *testing.T) {
+	tests := []struct {
+		name             string
+		from, to         string
+		wantFrom, wantTo time.Time
+		wantErr          string
+	}{
+		{name: "empty"},
+		{name: "dates include the whole last day", from: "2026-03-01", to: "2026-03-31",
+			wantFrom: utc("2026-03-01T00:00:00Z"), wantTo: utc("2026-04-01T00:00:00Z")},
+		{name: "single day", from: "2026-03-08", to: "2026-03-08",
+			wantFrom: utc("2026-03-08T00:00:00Z"), wantTo: utc("2026-03-09T00:00:00Z")},
+		{name: "end of a leap february", from: "2028-02-29", to: "2028-02-29",
+			wantFrom: utc("2028-02-29T00:00:00Z"), wantTo: utc("2028-03-01T00:00:00Z")},
+		{name: "end of year", to: "2026-12-31", wantTo: utc("2027-01-01T00:00:00Z")},
+		{name: "timestamps are exclusive and converted to UTC", from: "2026-03-01T07:00:00+07:00", to: "2026-03-02T06:59:59+07:00",
+			wantFrom: utc("2026-03-01T00:00:00Z"), wantTo: utc("2026-03-01T23:59:59Z")},
+		{name: "timestamp across midnight UTC", from: "2026-03-01T23:30:00-05:00",
+			wantFrom: utc("2026-03-02T04:30:00Z")},
+		{name: "bad from", from: "03/01/2026", wantErr: "error.invalid_from_date"},
+		{name: "bad to", to: "2026-02-30", wantErr: "error.invalid_to_date"},
+		{name: "reversed", from: "2026-03-10", to: "2026-03-01", wantErr: "error.invalid_date_range"},
+		{name: "same instant", from: "2026-03-01T00:00:00Z", to: "2026-03-01T00:00:00Z", wantErr: "error.invalid_date_range"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to, err := parseDateRange(tt.from, tt.to)
+			if tt.wantErr != "" {
+				var e *i18n.Error
+				if !errors.As(err, &e) || e.Key != tt.wantErr {
+					t.Fatalf("error = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !from.Equal(tt.wantFrom) || !to.Equal(tt.wantTo) {
+				t.Errorf("range = %v – %v, want %v – %v", from, to, tt.wantFrom, tt.wantTo)
+			}
+			if !from.IsZero() && from.Location() != time.UTC || !to.IsZero() && to.Location() != time.UTC {
+				t.Errorf("range = %v – %v, want UTC", from, to)
+			}
+		})
+	}
+}
+
+func TestDefaultAnalyticsRange(t *testing.T) {
+	// 23:30 WIB is 16:30 UTC the same day, so today ends at the next
+	// midnight UTC, not Jakarta's.
+	jakarta := time.FixedZone("WIB", 7*3600)
+	now := time.Date(2026, 3, 15, 23, 30, 0, 0, jakarta)
+
+	from, to := defaultAnalyticsRange(time.Time{}, time.Time{}, now)
+	if want := utc("2026-03-16T00:00:00Z"); !to.Equal(want) {
+		t.Errorf("to = %v, want %v", to, want)
+	}
+	if want := utc("2026-02-14T00:00:00Z"); !from.Equal(want) {
+		t.Errorf("from = %v, want %v", from, want)
+	}
+
+	// 02:00 WIB is still the previous day in UTC.
+	from, to = defaultAnalyticsRange(time.Time{}, time.Time{}, time.Date(2026, 3, 16, 2, 0, 0, 0, jakarta))
+	if want := utc("2026-03-16T00:00:00Z"); !to.Equal(want) {
+		t.Errorf("early morning WIB: to = %v, want %v", to, want)
+	}
+
+	// A given start is kept; a given end sets the default start.
+	given := utc("2026-01-01T00:00:00Z")
+	if from, _ = defaultAnalyticsRange(given, time.Time{}, now); !from.Equal(given) {
+		t.Errorf("from = %v, want %v", from, given)
+	}
+	if from, _ = defaultAnalyticsRange(time.Time{}, given, now); !from.Equal(utc("2025-12-02T00:00:00Z")) {
+		t.Errorf("from = %v, want 30 days before the given end", from)
+	}
+}
+
+func TestAnalyticsBuckets(t *testing.T) {
+	tests := []struct {
+		name        string
+		from, to    time.Time
+		granularity string
+		want        []string
+	}{
+		{name: "days", from: utc("2026-03-01T00:00:00Z"), to: utc("2026-03-04T00:00:00Z"), granularity: "day",
+			want: []string{"2026-03-01", "2026-03-02", "2026-03-03"}},
+		{name: "partial days", from: utc("2026-03-01T12:00:00Z"), to: utc("2026-03-02T00:00:01Z"), granularity: "day",
+			want: []string{"2026-03-01", "2026-03-02"}},
+		{name: "non-UTC start uses the UTC day", from: time.Date(2026, 3, 2, 3, 0, 0, 0, time.FixedZone("WIB", 7*3600)),
+			to: utc("2026-03-02T12:00:00Z"), granularity: "day",
+			want: []string{"2026-03-01", "2026-03-02"}},
+		{name: "across a DST change elsewhere", from: utc("2026-03-07T00:00:00Z"), to: utc("2026-03-10T00:00:00Z"), granularity: "day",
+			want: []string{"2026-03-07", "2026-03-08", "2026-03-09"}},
+		{name: "month end", from: utc("2026-02-27T00:00:00Z"), to: utc("2026-03-02T00:00:00Z"), granularity: "day",
+			want: []string{"2026-02-27", "2026-02-28", "2026-03-01"}},
+		// 2026-03-04 is a Wednesday; its week starts Monday 2026-03-02.
+		{name: "weeks start on monday", from: utc("2026-03-04T00:00:00Z"), to: utc("2026-03-20T00:00:00Z"), granularity: "week",
+			want: []string{"2026-03-02", "2026-03-09", "2026-03-16"}},
+		{name: "sunday belongs to the previous week", from: utc("2026-03-08T00:00:00Z"), to: utc("2026-03-09T00:00:00Z"), granularity: "week",
+			want: []string{"2026-03-02"}},
+		{name: "monday starts its own week", from: utc("2026-03-09T00:00:00Z"), to: utc("2026-03-10T00:00:00Z"), granularity: "week",
+			want: []string{"2026-03-09"}},
+		{name: "empty range", from: utc("2026-03-09T00:00:00Z"), to: utc("2026-03-09T00:00:00Z"), granularity: "day"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := analyticsBuckets(tt.from, tt.to, tt.granularity); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("analyticsBuckets = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFillSeries(t *testing.T) {
+	buckets := []string{"2026-03-01", "2026-03-02", "2026-03-03"}
+	counts := []bucketCount{
+		{Bucket: utc("2026-03-01T00:00:00Z"), Count: 4},
+		{Bucket: utc("2026-03-03T00:00:00Z"), Count: 2},
+		{Bucket: utc("2026-02-28T00:00:00Z"), Count: 9},
+	}
+	want := []fiber.Map{
+		{"date": "2026-03-01", "count": int64(4)},
+		{"date": "2026-03-02", "count": int64(0)},
+		{"date": "2026-03-03", "count": int64(2)},
+	}
+	if got := fillSeries(buckets, counts); !reflect.DeepEqual(got, want) {
+		t.Errorf("fillSeries = %v, want %v", got, want)
+	}
+}
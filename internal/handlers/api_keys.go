@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/apikey"
+	"github.com/zesbe/lumina-ai/internal/audit"
+	"github.com/zesbe/lumina-ai/internal/i18n"
+	"github.com/zesbe/lumina-ai/internal/middleware"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+// maxAPIKeys is how many unrevoked, unexpired keys a user can hold.
+const maxAPIKeys = 10
+
+// ListAPIKeys lists the caller's keys that haven't been revoked. The keys
+// themselves are never shown again; the prefix tells them apart.
+func (h *Handlers) ListAPIKeys() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+
+		var keys []models.APIKey
+		if err := requestDB(c, h.db).Where("user_id = ? AND revoked_at IS NULL", userID).
+			Order("created_at DESC").Find(&keys).Error; err != nil {
+			return internalError(c, "error.fetch_api_keys_failed")
+		}
+
+		response := make([]models.APIKeyResponse, len(keys))
+		for i := range keys {
+			response[i] = keys[i].ToResponse()
+		}
+		return c.JSON(fiber.Map{"api_keys": response})
+	}
+}
+
+// CreateAPIKey issues a key. The response is the only time the key is
+// shown.
+func (h *Handlers) CreateAPIKey() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.CreateAPIKeyRequest
+		if apiErr := bindJSON(c, &req); apiErr != nil {
+			return apierror.Respond(c, apiErr)
+		}
+
+		v := middleware.NewLocalizedValidator(i18n.Locale(c)).Struct(&req)
+		for _, scope := range req.Scopes {
+			v.OneOf("scopes", scope, models.APIKeyScopes)
+		}
+		if v.HasErrors() {
+			return validationFailed(c, v.Errors())
+		}
+
+		scopes := []string{models.ScopeRead}
+		if len(req.Scopes) > 0 {
+			scopes = slices.Clone(req.Scopes)
+			slices.Sort(scopes)
+			scopes = slices.Compact(scopes)
+		}
+
+		userID := c.Locals("userID").(uint)
+		now := time.Now()
+
+		var active int64
+		if err := requestDB(c, h.db).Model(&models.APIKey{}).
+			Where("user_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", userID, now).
+			Count(&active).Error; err != nil {
+			return internalError(c, "error.create_api_key_failed")
+		}
+		if active >= maxAPIKeys {
+			return apierror.Respond(c, apierror.New(fiber.StatusConflict, apierror.CodeConflict,
+				i18n.T(c, "error.api_key_limit", i18n.Params{"max": maxAPIKeys})).With("max", maxAPIKeys))
+		}
+
+		key, prefix, hash, err := apikey.Generate()
+		if err != nil {
+			return internalError(c, "error.create_api_key_failed")
+		}
+		record := models.APIKey{
+			UserID:     userID,
+			Name:       req.Name,
+			Prefix:     prefix,
+			SecretHash: hash,
+			Scopes:     strings.Join(scopes, ","),
+		}
+		if req.ExpiresInDays > 0 {
+			expires := now.AddDate(0, 0, req.ExpiresInDays)
+			record.ExpiresAt = &expires
+		}
+		if err := requestDB(c, h.db).Create(&record).Error; err != nil {
+			return internalError(c, "error.create_api_key_failed")
+		}
+
+		audit.Record(c, models.AuditAPIKeyCreate, apiKeyTarget(record.ID), fiber.Map{
+			"name":   record.Name,
+			"prefix": record.Prefix,
+			"scopes": scopes,
+		})
+
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"message": i18n.T(c, "message.api_key_created"),
+			"api_key": record.ToResponse(),
+			"key":     key,
+		})
+	}
+}
+
+// RevokeAPIKey revokes one of the caller's keys. Other instances stop
+// accepting it within apikey.CacheTTL.
+func (h *Handlers) RevokeAPIKey() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+		if err != nil {
+			return badRequest(c, "error.invalid_api_key_id")
+		}
+
+		userID := c.Locals("userID").(uint)
+		var record models.APIKey
+		if err := requestDB(c, h.db).Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).First(&record).Error; err != nil {
+			return notFound(c, "error.api_key_not_found")
+		}
+
+		if err := requestDB(c, h.db).Model(&record).Update("revoked_at", time.Now()).Error; err != nil {
+			return internalError(c, "error.revoke_api_key_failed")
+		}
+		apikey.Forget(record.Prefix)
+
+		audit.Record(c, models.AuditAPIKeyRevoke, apiKeyTarget(record.ID), fiber.Map{
+			"name":   record.Name,
+			"prefix": record.Prefix,
+		})
+
+		return c.JSON(fiber.Map{
+			"message": i18n.T(c, "message.api_key_revoked"),
+		})
+	}
+}
+
+func apiKeyTarget(id uint) audit.Target {
+	return audit.Target{Type: "api_key", ID: strconv.FormatUint(uint64(id), 10)}
+}
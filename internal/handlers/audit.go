@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/audit"
+	"github.com/zesbe/lumina-ai/internal/i18n"
+	"github.com/zesbe/lumina-ai/internal/middleware"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+// auditExportLimit caps a CSV export; narrow the date range for more.
+const auditExportLimit = 100000
+
+var auditCSVHeader = []string{"id", "created_at", "actor_id", "action", "target_type", "target_id", "ip", "user_agent", "metadata"}
+
+// GetAuditLogs lists audit entries, newest first, filtered by actor,
+// action, target and created_at range. format=csv returns every matching
+// row (up to auditExportLimit) as a download instead of a page.
+func (h *Handlers) GetAuditLogs() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return listAuditLogs(c, requestDB(c, h.db).Model(&models.AuditLog{}), audit.Target{Type: "audit_log"})
+	}
+}
+
+// GetUserAuditLogs is the account history for support: everything the
+// user did plus everything done to them. Deleted users keep their history,
+// so the user doesn't have to exist.
+func (h *Handlers) GetUserAuditLogs() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+		if err != nil {
+			return badRequest(c, "error.invalid_user_id")
+		}
+
+		query := requestDB(c, h.db).Model(&models.AuditLog{}).
+			Where("actor_id = ? OR (target_type = ? AND target_id = ?)", userID, "user", strconv.FormatUint(userID, 10))
+		return listAuditLogs(c, query, audit.User(uint(userID)))
+	}
+}
+
+// listAuditLogs applies the shared query filters to query and writes a
+// page or a CSV export. Reading the log is itself audited against target.
+func listAuditLogs(c *fiber.Ctx, query *gorm.DB, target audit.Target) error {
+	if actor := c.Query("actor"); actor != "" {
+		actorID, err := strconv.ParseUint(actor, 10, 32)
+		if err != nil {
+			return badRequest(c, "error.invalid_actor_id")
+		}
+		query = query.Where("actor_id = ?", actorID)
+	}
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if targetType := c.Query("target_type"); targetType != "" {
+		query = query.Where("target_type = ?", targetType)
+	}
+	if targetID := c.Query("target_id"); targetID != "" {
+		query = query.Where("target_id = ?", targetID)
+	}
+
+	from, to, err := parseDateRange(c.Query("from"), c.Query("to"))
+	if err != nil {
+		return errorResponse(c, fiber.StatusBadRequest, apierror.CodeBadRequest, i18n.Message(c, err))
+	}
+	if !from.IsZero() {
+		query = query.Where("created_at >= ?", from)
+	}
+	if !to.IsZero() {
+		query = query.Where("created_at < ?", to)
+	}
+
+	format := c.Query("format", "json")
+	audit.Record(c, models.AuditLogView, target, fiber.Map{
+		"format":      format,
+		"actor":       c.Query("actor"),
+		"action":      c.Query("action"),
+		"target_type": c.Query("target_type"),
+		"target_id":   c.Query("target_id"),
+		"from":        c.Query("from"),
+		"to":          c.Query("to"),
+	})
+
+	if format == "csv" {
+		return exportAuditLogs(c, query, target)
+	}
+
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	var total pageTotal
+	query.Count(&total.Total)
+
+	var entries []models.AuditLog
+	if err := query.Order("created_at DESC").Offset((page - 1) * limit).Limit(limit).Find(&entries).Error; err != nil {
+		return internalError(c, "error.fetch_audit_logs_failed")
+	}
+
+	return newPage(entries, page, limit, total).send(c, "entries")
+}
+
+func exportAuditLogs(c *fiber.Ctx, query *gorm.DB, target audit.Target) error {
+	rows, err := query.Order("created_at DESC").Limit(auditExportLimit).Rows()
+	if err != nil {
+		return internalError(c, "error.fetch_audit_logs_failed")
+	}
+	defer rows.Close()
+
+	name := "audit"
+	if target.Type == "user" {
+		name += "-user-" + target.ID
+	}
+	c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s-%s.csv"`, name, time.Now().UTC().Format("20060102-150405")))
+
+	w := csv.NewWriter(c.Response().BodyWriter())
+	w.Write(auditCSVHeader)
+	for rows.Next() {
+		var entry models.AuditLog
+		if err := query.ScanRows(rows, &entry); err != nil {
+			middleware.Log(c).Error("failed to scan audit log row", "error", err)
+			break
+		}
+		actor := ""
+		if entry.ActorID != nil {
+			actor = strconv.FormatUint(uint64(*entry.ActorID), 10)
+		}
+		w.Write([]string{
+			strconv.FormatUint(uint64(entry.ID), 10),
+			entry.CreatedAt.UTC().Format(time.RFC3339),
+			actor,
+			string(entry.Action),
+			csvSafe(entry.TargetType),
+			csvSafe(entry.TargetID),
+			entry.IP,
+			csvSafe(entry.UserAgent),
+			csvSafe(entry.Metadata),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// csvSafe stops spreadsheet apps from treating user-controlled text as a
+// formula.
+func csvSafe(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
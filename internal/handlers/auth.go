@@ -1,56 +1,58 @@
 package handlers
 
 import (
-	"crypto/rand"
-	"encoding/base64"
+	"errors"
+	"slices"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
 
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/audit"
 	"github.com/zesbe/lumina-ai/internal/auth"
-	"github.com/zesbe/lumina-ai/internal/config"
+	"github.com/zesbe/lumina-ai/internal/captcha"
 	"github.com/zesbe/lumina-ai/internal/crypto"
+	"github.com/zesbe/lumina-ai/internal/disposable"
+	"github.com/zesbe/lumina-ai/internal/i18n"
+	"github.com/zesbe/lumina-ai/internal/lockout"
+	"github.com/zesbe/lumina-ai/internal/maintenance"
 	"github.com/zesbe/lumina-ai/internal/middleware"
 	"github.com/zesbe/lumina-ai/internal/models"
+	"github.com/zesbe/lumina-ai/internal/session"
+	"github.com/zesbe/lumina-ai/internal/userstate"
 )
 
-func Register(db *gorm.DB) fiber.Handler {
+func (h *Handlers) Register() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		var req models.RegisterRequest
-		if err := c.BodyParser(&req); err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":   "Bad Request",
-				"message": "Invalid request body",
-			})
+		if apiErr := bindJSON(c, &req); apiErr != nil {
+			return apierror.Respond(c, apiErr)
 		}
+		req.Email = models.NormalizeEmail(req.Email)
 
-		v := middleware.NewValidator()
-		v.Required("email", req.Email).Email("email", req.Email).NoSQLInjection("email", req.Email)
-		v.Required("password", req.Password).Password("password", req.Password)
-		v.Required("name", req.Name).MinLength("name", req.Name, 2).MaxLength("name", req.Name, 100).NoXSS("name", req.Name)
+		if errs := middleware.ValidateRequest(c, &req); len(errs) > 0 {
+			return validationFailed(c, errs)
+		}
 
-		if v.HasErrors() {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":   "Validation Failed",
-				"details": v.Errors(),
-			})
+		if captcha.OnRegister() {
+			if err := captcha.Verify(c.UserContext(), req.CaptchaToken, c.IP()); err != nil {
+				return captchaFailed(c, "register", err)
+			}
+		}
+		if verdict := disposable.Check(c.UserContext(), req.Email); verdict != nil {
+			return disposableEmail(c, "register", verdict)
 		}
 
-		var existingUser models.User
-		if err := db.Where("email = ?", req.Email).First(&existingUser).Error; err == nil {
-			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
-				"error":   "Conflict",
-				"message": "Email already registered",
-			})
+		if taken, err := emailTaken(requestDB(c, h.db), req.Email, 0); err != nil {
+			return internalError(c, "error.registration_failed")
+		} else if taken {
+			return errorResponse(c, fiber.StatusConflict, apierror.CodeEmailTaken, i18n.T(c, "error.email_registered"))
 		}
 
 		hashedPassword, err := crypto.HashPassword(req.Password)
 		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error":   "Internal Server Error",
-				"message": "Failed to process registration",
-			})
+			return internalError(c, "error.registration_failed")
 		}
 
 		user := models.User{
@@ -63,176 +65,324 @@ func Register(db *gorm.DB) fiber.Handler {
 			IsActive:     true,
 		}
 
-		if err := db.Create(&user).Error; err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error":   "Internal Server Error",
-				"message": "Failed to create user",
-			})
+		if err := requestDB(c, h.db).Create(&user).Error; err != nil {
+			// The unique index on lower(email) catches a sign-up racing
+			// this one past the check above.
+			if taken, _ := emailTaken(requestDB(c, h.db), req.Email, 0); taken {
+				return errorResponse(c, fiber.StatusConflict, apierror.CodeEmailTaken, i18n.T(c, "error.email_registered"))
+			}
+			return internalError(c, "error.create_user_failed")
+		}
+		recordReferral(c, h.db, &user, req.ReferralCode)
+		// The account stands without it; the link can be sent again.
+		if err := h.sendVerification(c, &user); err != nil {
+			middleware.Log(c).Error("failed to store email verification", "user_id", user.ID, "error", err)
 		}
 
 		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-			"message": "Registration successful",
+			"message": i18n.T(c, "message.registered"),
 			"user":    user.ToResponse(),
 		})
 	}
 }
 
-func Login(db *gorm.DB, cfg *config.Config) fiber.Handler {
-	jwtService := auth.NewJWTService(cfg.JWTSecret, cfg.JWTExpiry, cfg.JWTRefreshExpiry)
+func (h *Handlers) Login() fiber.Handler {
+	policy := lockout.Policy{
+		Threshold: h.cfg.LoginLockout.Threshold,
+		Base:      h.cfg.LoginLockout.Base,
+		Max:       h.cfg.LoginLockout.Max,
+		Window:    h.cfg.LoginLockout.Window,
+	}
 
 	return func(c *fiber.Ctx) error {
 		var req models.LoginRequest
-		if err := c.BodyParser(&req); err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":   "Bad Request",
-				"message": "Invalid request body",
-			})
+		if apiErr := bindJSON(c, &req); apiErr != nil {
+			return apierror.Respond(c, apiErr)
 		}
+		req.Email = models.NormalizeEmail(req.Email)
 
-		v := middleware.NewValidator()
-		v.Required("email", req.Email).Email("email", req.Email)
-		v.Required("password", req.Password)
-
-		if v.HasErrors() {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":   "Validation Failed",
-				"details": v.Errors(),
-			})
+		if errs := middleware.ValidateRequest(c, &req); len(errs) > 0 {
+			return validationFailed(c, errs)
+		}
+		if captcha.OnLogin(c.UserContext(), c.IP(), req.Email) {
+			if err := captcha.Verify(c.UserContext(), req.CaptchaToken, c.IP()); err != nil {
+				return captchaFailed(c, "login", err)
+			}
 		}
 
 		var user models.User
-		if err := db.Where("email = ? AND is_active = ?", req.Email, true).First(&user).Error; err != nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error":   "Unauthorized",
-				"message": "Invalid credentials",
-			})
+		err := requestDB(c, h.db).Where("email = ? AND is_active = ? AND email_conflict_with IS NULL", req.Email, true).First(&user).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// Rows the lowercasing migration hasn't reached yet.
+			err = requestDB(c, h.db).Where("LOWER(email) = ? AND is_active = ? AND email_conflict_with IS NULL", req.Email, true).
+				Order("id").First(&user).Error
+		}
+		if err != nil {
+			audit.RecordAs(c, nil, models.AuditLoginFailed, audit.Target{Type: "email", ID: req.Email}, fiber.Map{"reason": "unknown_user"})
+			return invalidCredentials(c, req.Email)
 		}
 
+		// A locked account is answered exactly like a wrong password, even
+		// when the password is right, so the lock gives nothing away. The
+		// password is still checked to keep the timing the same, and wrong
+		// ones keep lengthening the lock.
+		locked, err := lockout.Locked(c.UserContext(), user.ID)
+		if err != nil {
+			middleware.Log(c).Warn("failed to check login lockout", "error", err)
+		}
 		valid, err := crypto.VerifyPassword(req.Password, user.PasswordHash)
-		if err != nil || !valid {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error":   "Unauthorized",
-				"message": "Invalid credentials",
-			})
+		if err != nil || !valid || locked {
+			if err != nil || !valid {
+				loginFailed(c, policy, user.ID)
+			}
+			reason := "bad_password"
+			if locked {
+				reason = "locked"
+			}
+			audit.RecordAs(c, nil, models.AuditLoginFailed, audit.User(user.ID), fiber.Map{"reason": reason})
+			audit.RecordLogin(c, user.ID, "password", models.LoginFailed, reason)
+			return invalidCredentials(c, req.Email)
+		}
+
+		// Login stays open during maintenance so admins can get in; everyone
+		// else is told to come back later.
+		if state := maintenance.Current(); state.Enabled && user.Role != "admin" {
+			return middleware.MaintenanceResponse(c, state)
+		}
+
+		if crypto.NeedsRehash(user.PasswordHash) {
+			rehashPassword(c, h.db, &user, req.Password)
 		}
 
-		tokens, err := jwtService.GenerateTokenPair(user.ID, user.Email, user.Role, user.Plan)
+		tokens, err := h.startSession(c, &user)
 		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error":   "Internal Server Error",
-				"message": "Failed to generate tokens",
-			})
+			return internalError(c, "error.generate_tokens_failed")
 		}
 
 		now := time.Now()
-		db.Model(&user).Update("last_login_at", now)
+		requestDB(c, h.db).Model(&user).Update("last_login_at", now)
+		if err := lockout.Reset(user.ID); err != nil {
+			middleware.Log(c).Warn("failed to reset login failures", "error", err)
+		}
+		captcha.LoginSucceeded(req.Email)
+
+		audit.RecordAs(c, &user.ID, models.AuditLogin, audit.User(user.ID), nil)
+		audit.RecordLogin(c, user.ID, "password", models.LoginSucceeded, "")
 
 		return c.JSON(fiber.Map{
-			"message": "Login successful",
+			"message": i18n.T(c, "message.logged_in"),
 			"user":    user.ToResponse(),
 			"tokens":  tokens,
 		})
 	}
 }
 
-func RefreshToken(cfg *config.Config) fiber.Handler {
-	jwtService := auth.NewJWTService(cfg.JWTSecret, cfg.JWTExpiry, cfg.JWTRefreshExpiry)
+// invalidCredentials answers a failed login. It also marks the IP and
+// email for a captcha, and says so in the response when the next attempt
+// will need one.
+func invalidCredentials(c *fiber.Ctx, email string) error {
+	err := apierror.New(fiber.StatusUnauthorized, apierror.CodeInvalidCredentials, i18n.T(c, "error.invalid_credentials"))
+	if captcha.LoginFailed(c.IP(), email) {
+		err = err.With("captcha_required", true)
+	}
+	return apierror.Respond(c, err)
+}
+
+// rehashPassword replaces a hash made with older Argon2 parameters, now
+// that the password is known. It leaves password_changed_at alone, since
+// the password is the same and sessions should stay, and skips the update
+// if the hash changed in the meantime. A failure only means another try
+// on the next login.
+func rehashPassword(c *fiber.Ctx, db *gorm.DB, user *models.User, password string) {
+	hashed, err := crypto.HashPassword(password)
+	if err != nil {
+		middleware.Log(c).Warn("failed to rehash password", "user_id", user.ID, "error", err)
+		return
+	}
+	if err := requestDB(c, db).Model(&models.User{}).
+		Where("id = ? AND password_hash = ?", user.ID, user.PasswordHash).
+		Update("password_hash", hashed).Error; err != nil {
+		middleware.Log(c).Warn("failed to store rehashed password", "user_id", user.ID, "error", err)
+		return
+	}
+	user.PasswordHash = hashed
+	middleware.Log(c).Info("password rehashed with current parameters", "user_id", user.ID)
+}
 
+// loginFailed counts a failed login against the account and audits the
+// lock it starts, if any.
+func loginFailed(c *fiber.Ctx, policy lockout.Policy, userID uint) {
+	failures, lockedFor, err := policy.Fail(userID)
+	if err != nil {
+		middleware.Log(c).Warn("failed to count login failure", "error", err)
+		return
+	}
+	if lockedFor > 0 {
+		audit.RecordAs(c, nil, models.AuditAccountLocked, audit.User(userID), fiber.Map{
+			"failures":           failures,
+			"locked_for_seconds": int(lockedFor.Seconds()),
+		})
+	}
+}
+
+// RefreshToken exchanges a refresh token for a new pair. The presented
+// token is consumed; presenting it again ends the session, since only a
+// copy held by someone else would be: its refresh tokens are revoked and
+// its access tokens denied at once.
+func (h *Handlers) RefreshToken() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		var req models.RefreshTokenRequest
-		if err := c.BodyParser(&req); err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":   "Bad Request",
-				"message": "Invalid request body",
-			})
+		if apiErr := bindJSON(c, &req); apiErr != nil {
+			return apierror.Respond(c, apiErr)
 		}
 
 		if req.RefreshToken == "" {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":   "Bad Request",
-				"message": "Refresh token is required",
-			})
+			return badRequest(c, "error.refresh_token_required")
 		}
 
-		tokens, err := jwtService.RefreshTokens(req.RefreshToken)
-		if err != nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error":   "Unauthorized",
-				"message": "Invalid or expired refresh token",
-			})
+		tokens, claims, err := session.Rotate(requestDB(c, h.db), h.jwt, req.RefreshToken, session.DeviceOf(c))
+		switch {
+		case errors.Is(err, session.ErrReused):
+			middleware.Log(c).Warn("refresh token reused; session revoked", "user_id", claims.UserID, "session_id", claims.SessionID)
+			audit.RecordAs(c, &claims.UserID, models.AuditRefreshTokenReuse, audit.User(claims.UserID), fiber.Map{"session_id": claims.SessionID})
+			h.endSessions(c, claims.SessionID)
+			return errorResponse(c, fiber.StatusUnauthorized, apierror.CodeInvalidToken, i18n.T(c, "error.invalid_refresh_token"))
+		case errors.Is(err, session.ErrInvalid):
+			return errorResponse(c, fiber.StatusUnauthorized, apierror.CodeInvalidToken, i18n.T(c, "error.invalid_refresh_token"))
+		case err != nil:
+			middleware.Log(c).Error("failed to rotate refresh token", "error", err)
+			return internalError(c, "error.generate_tokens_failed")
 		}
 
 		return c.JSON(fiber.Map{
-			"message": "Token refreshed",
+			"message": i18n.T(c, "message.token_refreshed"),
 			"tokens":  tokens,
 		})
 	}
 }
 
-func Logout(c *fiber.Ctx) error {
-	return c.JSON(fiber.Map{
-		"message": "Logged out successfully",
-	})
+// Logout ends the session the access token belongs to: its refresh token
+// stops working, its access tokens are denied and its sockets closed.
+func (h *Handlers) Logout() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if claims, ok := c.Locals("claims").(*auth.Claims); ok && claims.SessionID != "" {
+			if err := session.Revoke(requestDB(c, h.db), claims.SessionID); err != nil {
+				middleware.Log(c).Error("failed to revoke session", "error", err)
+				return internalError(c, "error.logout_failed")
+			}
+			h.endSessions(c, claims.SessionID)
+		}
+
+		return c.JSON(fiber.Map{
+			"message": i18n.T(c, "message.logged_out"),
+		})
+	}
 }
 
-func GenerateCSRFToken(c *fiber.Ctx) error {
-	token := make([]byte, 32)
-	rand.Read(token)
-	csrfToken := base64.StdEncoding.EncodeToString(token)
+// LogoutAll ends every session of the user, this one included.
+func (h *Handlers) LogoutAll() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+
+		sessionIDs, err := session.RevokeUser(requestDB(c, h.db), userID)
+		if err != nil {
+			middleware.Log(c).Error("failed to revoke sessions", "error", err)
+			return internalError(c, "error.logout_failed")
+		}
+		if claims, ok := c.Locals("claims").(*auth.Claims); ok && claims.SessionID != "" && !slices.Contains(sessionIDs, claims.SessionID) {
+			sessionIDs = append(sessionIDs, claims.SessionID)
+		}
+		h.endSessions(c, sessionIDs...)
+		audit.Record(c, models.AuditLogoutAll, audit.User(userID), fiber.Map{"sessions": len(sessionIDs)})
+
+		return c.JSON(fiber.Map{
+			"message":  i18n.T(c, "message.logged_out_everywhere"),
+			"sessions": len(sessionIDs),
+		})
+	}
+}
 
-	return c.JSON(fiber.Map{
-		"csrf_token": csrfToken,
-	})
+// endSessions denies the access tokens of sessions whose refresh tokens
+// were just revoked and closes their sockets. Without the denial the
+// access tokens would keep working until they expire; that is logged but
+// doesn't fail the request, since the sessions can't be refreshed anyway.
+func (h *Handlers) endSessions(c *fiber.Ctx, sessionIDs ...string) {
+	if len(sessionIDs) == 0 {
+		return
+	}
+	if err := session.Deny(h.cfg.JWTExpiry, sessionIDs...); err != nil {
+		middleware.Log(c).Error("failed to deny access tokens", "sessions", len(sessionIDs), "error", err)
+	}
+	h.hub.CloseSessions("session_revoked", sessionIDs...)
 }
 
-func GetProfile(db *gorm.DB) fiber.Handler {
+// GenerateCSRFToken issues a signed double-submit token, set both as the
+// csrf_token cookie and in the body so the client can echo it in the
+// X-CSRF-Token header.
+func (h *Handlers) GenerateCSRFToken() fiber.Handler {
+	tokens := middleware.NewCSRFTokens(h.cfg.JWTSecret)
+
+	return func(c *fiber.Ctx) error {
+		csrfToken, expiresAt, err := tokens.Issue()
+		if err != nil {
+			return internalError(c, "error.csrf_token_failed")
+		}
+
+		c.Cookie(&fiber.Cookie{
+			Name:     middleware.CSRFCookieName,
+			Value:    csrfToken,
+			Path:     "/",
+			Expires:  expiresAt,
+			Secure:   h.cfg.Environment == "production",
+			HTTPOnly: true,
+			SameSite: fiber.CookieSameSiteStrictMode,
+		})
+
+		return c.JSON(fiber.Map{
+			"csrf_token": csrfToken,
+			"expires_at": expiresAt.Unix(),
+		})
+	}
+}
+
+func (h *Handlers) GetProfile() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		userID := c.Locals("userID").(uint)
 
 		var user models.User
-		if err := db.First(&user, userID).Error; err != nil {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-				"error":   "Not Found",
-				"message": "User not found",
-			})
+		if err := requestDB(c, h.db).First(&user, userID).Error; err != nil {
+			return notFound(c, "error.user_not_found")
 		}
 
-		return c.JSON(fiber.Map{
+		result := fiber.Map{
 			"user": user.ToResponse(),
-		})
+		}
+		// The dashboard can live without stats; the profile still loads.
+		if stats, err := profileStats(c, h.db, h.cache, userID); err != nil {
+			middleware.Log(c).Error("failed to compute profile stats", "error", err)
+		} else {
+			result["stats"] = stats
+		}
+		return c.JSON(result)
 	}
 }
 
-func UpdateProfile(db *gorm.DB) fiber.Handler {
+func (h *Handlers) UpdateProfile() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		userID := c.Locals("userID").(uint)
 
 		var req models.UpdateProfileRequest
-		if err := c.BodyParser(&req); err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":   "Bad Request",
-				"message": "Invalid request body",
-			})
+		if apiErr := bindJSON(c, &req); apiErr != nil {
+			return apierror.Respond(c, apiErr)
 		}
 
-		v := middleware.NewValidator()
-		if req.Name != "" {
-			v.MinLength("name", req.Name, 2).MaxLength("name", req.Name, 100).NoXSS("name", req.Name)
-		}
-
-		if v.HasErrors() {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":   "Validation Failed",
-				"details": v.Errors(),
-			})
+		if errs := middleware.ValidateRequest(c, &req); len(errs) > 0 {
+			return validationFailed(c, errs)
 		}
 
 		var user models.User
-		if err := db.First(&user, userID).Error; err != nil {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-				"error":   "Not Found",
-				"message": "User not found",
-			})
+		if err := requestDB(c, h.db).First(&user, userID).Error; err != nil {
+			return notFound(c, "error.user_not_found")
 		}
 
 		updates := make(map[string]interface{})
@@ -244,74 +394,93 @@ func UpdateProfile(db *gorm.DB) fiber.Handler {
 		}
 
 		if len(updates) > 0 {
-			if err := db.Model(&user).Updates(updates).Error; err != nil {
-				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-					"error":   "Internal Server Error",
-					"message": "Failed to update profile",
-				})
+			if err := requestDB(c, h.db).Model(&user).Updates(updates).Error; err != nil {
+				return internalError(c, "error.update_profile_failed")
 			}
 		}
 
-		db.First(&user, userID)
+		requestDB(c, h.db).First(&user, userID)
 
 		return c.JSON(fiber.Map{
-			"message": "Profile updated",
+			"message": i18n.T(c, "message.profile_updated"),
 			"user":    user.ToResponse(),
 		})
 	}
 }
 
-func ChangePassword(db *gorm.DB) fiber.Handler {
+// ChangePassword replaces the caller's password and ends every session of
+// the account, since whoever knew the old password may hold one. The
+// device the change was made from gets a new session straight away, in the
+// response, so only the others have to log in again.
+func (h *Handlers) ChangePassword() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		userID := c.Locals("userID").(uint)
 
 		var req models.ChangePasswordRequest
-		if err := c.BodyParser(&req); err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":   "Bad Request",
-				"message": "Invalid request body",
-			})
+		if apiErr := bindJSON(c, &req); apiErr != nil {
+			return apierror.Respond(c, apiErr)
 		}
 
-		v := middleware.NewValidator()
-		v.Required("current_password", req.CurrentPassword)
-		v.Required("new_password", req.NewPassword).Password("new_password", req.NewPassword)
-
-		if v.HasErrors() {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":   "Validation Failed",
-				"details": v.Errors(),
-			})
+		if errs := middleware.ValidateRequest(c, &req); len(errs) > 0 {
+			return validationFailed(c, errs)
 		}
 
 		var user models.User
-		if err := db.First(&user, userID).Error; err != nil {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-				"error":   "Not Found",
-				"message": "User not found",
-			})
+		if err := requestDB(c, h.db).First(&user, userID).Error; err != nil {
+			return notFound(c, "error.user_not_found")
 		}
 
 		valid, _ := crypto.VerifyPassword(req.CurrentPassword, user.PasswordHash)
 		if !valid {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error":   "Unauthorized",
-				"message": "Current password is incorrect",
-			})
+			return errorResponse(c, fiber.StatusUnauthorized, apierror.CodeInvalidCredentials, i18n.T(c, "error.current_password_incorrect"))
 		}
 
 		hashedPassword, err := crypto.HashPassword(req.NewPassword)
 		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error":   "Internal Server Error",
-				"message": "Failed to update password",
-			})
+			return internalError(c, "error.update_password_failed")
 		}
 
-		db.Model(&user).Update("password_hash", hashedPassword)
+		var sessionIDs []string
+		err = requestDB(c, h.db).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&user).Updates(map[string]interface{}{
+				"password_hash":       hashedPassword,
+				"password_changed_at": time.Now(),
+			}).Error; err != nil {
+				return err
+			}
+			sessionIDs, err = session.RevokeUser(tx, user.ID)
+			return err
+		})
+		if err != nil {
+			middleware.Log(c).Error("failed to change password", "error", err)
+			return internalError(c, "error.update_password_failed")
+		}
+		if claims, ok := c.Locals("claims").(*auth.Claims); ok && claims.SessionID != "" && !slices.Contains(sessionIDs, claims.SessionID) {
+			sessionIDs = append(sessionIDs, claims.SessionID)
+		}
+		// The denylist ends the sessions' access tokens at once where Redis
+		// is up; the new password_changed_at refuses them everywhere else
+		// as soon as the cached user state is dropped.
+		h.endSessions(c, sessionIDs...)
+		userstate.Forget(user.ID)
+		if err := lockout.Reset(user.ID); err != nil {
+			middleware.Log(c).Warn("failed to reset login failures", "error", err)
+		}
+
+		audit.Record(c, models.AuditPasswordChange, audit.User(user.ID), fiber.Map{"sessions": len(sessionIDs)})
+
+		tokens, err := session.Start(requestDB(c, h.db), h.jwt, &user, session.DeviceOf(c))
+		if err != nil {
+			// The password is changed either way; the user logs in again.
+			middleware.Log(c).Error("failed to start session after password change", "error", err)
+			return c.JSON(fiber.Map{
+				"message": i18n.T(c, "message.password_changed"),
+			})
+		}
 
 		return c.JSON(fiber.Map{
-			"message": "Password changed successfully",
+			"message": i18n.T(c, "message.password_changed"),
+			"tokens":  tokens,
 		})
 	}
 }
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/i18n"
+	"github.com/zesbe/lumina-ai/internal/middleware"
+)
+
+// StrictHeader turns strict body decoding off for one request when set to
+// "false". It is meant for clients that need time to stop sending stale
+// fields, not as a permanent mode.
+const StrictHeader = "X-Strict"
+
+// bindJSON decodes the request body into out. A JSON body must be a single
+// object with no fields out doesn't know and values of the right type, so
+// a misspelt field (voiceId for voice_id) is a 400 instead of a silent
+// default. Form bodies and requests with X-Strict: false are parsed as
+// leniently as before.
+func bindJSON(c *fiber.Ctx, out interface{}) *apierror.Error {
+	if strings.EqualFold(c.Get(StrictHeader), "false") || !strings.HasPrefix(string(c.Request().Header.ContentType()), fiber.MIMEApplicationJSON) {
+		if err := c.BodyParser(out); err != nil {
+			return apierror.New(fiber.StatusBadRequest, apierror.CodeBadRequest, i18n.T(c, "error.invalid_request_body"))
+		}
+		return nil
+	}
+	return decodeJSONObject(c, c.Body(), out)
+}
+
+// decodeJSONObject is the strict decoding of bindJSON, for JSON that
+// isn't the request body itself.
+func decodeJSONObject(c *fiber.Ctx, body []byte, out interface{}) *apierror.Error {
+	v := middleware.NewLocalizedValidator(i18n.Locale(c))
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] != '{' {
+		v.AddRuleError("body", "json_object", nil)
+		return bodyValidationError(c, v)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(out)
+	if err == nil {
+		if _, err := dec.Token(); err != io.EOF {
+			v.AddRuleError("body", "json_object", nil)
+			return bodyValidationError(c, v)
+		}
+		return nil
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		v.AddRuleError(typeErr.Field, "type", i18n.Params{"type": jsonType(typeErr.Type)})
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		v.AddRuleError(field, "unknown_field", nil)
+	default:
+		return apierror.New(fiber.StatusBadRequest, apierror.CodeBadRequest, i18n.T(c, "error.invalid_request_body"))
+	}
+	return bodyValidationError(c, v)
+}
+
+func bodyValidationError(c *fiber.Ctx, v *middleware.Validator) *apierror.Error {
+	return apierror.New(fiber.StatusBadRequest, apierror.CodeValidationFailed,
+		i18n.T(c, "error.validation_failed")).WithDetails(v.Errors())
+}
+
+// jsonType names the JSON type a Go type decodes from.
+func jsonType(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	default:
+		return "object"
+	}
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"slices"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/config"
+	"github.com/zesbe/lumina-ai/internal/i18n"
+	"github.com/zesbe/lumina-ai/internal/middleware"
+	"github.com/zesbe/lumina-ai/internal/models"
+	"github.com/zesbe/lumina-ai/internal/services"
+)
+
+// planCapabilities is one plan's entry in GetCapabilities.
+type planCapabilities struct {
+	Plan         string              `json:"plan"`
+	DisplayName  string              `json:"display_name"`
+	Capabilities config.Capabilities `json:"capabilities"`
+}
+
+// GetCapabilities is what the caller's plan may generate with, and every
+// plan's capabilities so clients can say which plan unlocks an option,
+// plus the aspect ratios each video model renders. The plan is the
+// current one, not the one in the token.
+func (h *Handlers) GetCapabilities() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		plan := callerPlan(c)
+		plans := make([]planCapabilities, len(config.PlanOrder))
+		for i, name := range config.PlanOrder {
+			plans[i] = planCapabilities{Plan: name, DisplayName: planDisplayName(name), Capabilities: h.cfg.CapabilitiesFor(name)}
+		}
+		aspectRatios := make(map[string][]string, len(services.VideoModelSpecs))
+		for model, spec := range services.VideoModelSpecs {
+			aspectRatios[model] = spec.AspectRatios
+		}
+		return c.JSON(fiber.Map{
+			"plan":          plan,
+			"capabilities":  h.cfg.CapabilitiesFor(plan),
+			"plans":         plans,
+			"aspect_ratios": aspectRatios,
+		})
+	}
+}
+
+// planRequirement is an option of a generate request the caller's plan
+// doesn't allow, and the least capable plan that does.
+type planRequirement struct {
+	Field string
+	Value interface{}
+	Plan  string
+}
+
+// requirePlan checks one option against the plans. It returns nil when
+// the caller's plan allows it; otherwise the plan needed, or, when no
+// plan allows it, an "invalid" error on field added to v.
+func requirePlan(c *fiber.Ctx, cfg *config.Config, v *middleware.Validator, field string, value interface{}, allows func(config.Capabilities) bool) *planRequirement {
+	if allows(cfg.CapabilitiesFor(callerPlan(c))) {
+		return nil
+	}
+	plan, ok := cfg.LowestPlanWith(allows)
+	if !ok {
+		v.AddRuleError(field, "invalid", nil)
+		return nil
+	}
+	return &planRequirement{Field: field, Value: value, Plan: plan}
+}
+
+// videoRequirement checks the model, resolution and duration of a video
+// request against the caller's plan, in that order.
+func videoRequirement(c *fiber.Ctx, cfg *config.Config, v *middleware.Validator, model, resolution string, duration int) *planRequirement {
+	checks := []*planRequirement{
+		requirePlan(c, cfg, v, "model", model, func(caps config.Capabilities) bool {
+			return slices.Contains(caps.VideoModels, model)
+		}),
+		requirePlan(c, cfg, v, "resolution", resolution, func(caps config.Capabilities) bool {
+			return caps.AllowsResolution(resolution)
+		}),
+		requirePlan(c, cfg, v, "duration", duration, func(caps config.Capabilities) bool {
+			return duration > 0 && duration <= caps.MaxDuration
+		}),
+	}
+	for _, r := range checks {
+		if r != nil {
+			return r
+		}
+	}
+	return nil
+}
+
+// musicRequirement checks the model and bitrate of a music request
+// against the caller's plan. A bitrate of 0 is the default, which every
+// plan allows.
+func musicRequirement(c *fiber.Ctx, cfg *config.Config, v *middleware.Validator, model string, bitrate int) *planRequirement {
+	if r := requirePlan(c, cfg, v, "model", model, func(caps config.Capabilities) bool {
+		return slices.Contains(caps.MusicModels, model)
+	}); r != nil {
+		return r
+	}
+	return requirePlan(c, cfg, v, "bitrate", bitrate, func(caps config.Capabilities) bool {
+		return bitrate <= caps.MaxMusicBitrate
+	})
+}
+
+// planRequired answers a generate request that needs a higher plan, naming
+// it.
+func planRequired(c *fiber.Ctx, r *planRequirement) error {
+	return apierror.Respond(c, apierror.New(fiber.StatusForbidden, apierror.CodePlanUpgradeRequired,
+		i18n.T(c, "error.plan_required", i18n.Params{"field": r.Field, "value": r.Value, "plan": planDisplayName(r.Plan)})).
+		With("field", r.Field).With("required_plan", r.Plan))
+}
+
+// callerPlan is the caller's current plan, which the auth middleware read
+// from userstate rather than the token.
+func callerPlan(c *fiber.Ctx) string {
+	plan, _ := c.Locals("plan").(string)
+	return plan
+}
+
+func planDisplayName(plan string) string {
+	for _, p := range models.DefaultPlans {
+		if string(p.Name) == plan {
+			return p.DisplayName
+		}
+	}
+	return plan
+}
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/audit"
+	"github.com/zesbe/lumina-ai/internal/captcha"
+	"github.com/zesbe/lumina-ai/internal/i18n"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+// captchaFailed answers a sign-up or login whose captcha didn't pass. A
+// missing or rejected token gets 403 CAPTCHA_REQUIRED so the client knows
+// to show the widget, with reason "missing" or "invalid".
+func captchaFailed(c *fiber.Ctx, flow string, err error) error {
+	if errors.Is(err, captcha.ErrUnavailable) {
+		return errorResponse(c, fiber.StatusServiceUnavailable, apierror.CodeServiceUnavailable, i18n.T(c, "error.captcha_unavailable"))
+	}
+
+	reason, key := "invalid", "error.captcha_invalid"
+	if errors.Is(err, captcha.ErrMissing) {
+		reason, key = "missing", "error.captcha_required"
+	} else {
+		audit.RecordAs(c, nil, models.AuditCaptchaFailed, audit.Target{Type: "ip", ID: c.IP()}, fiber.Map{"flow": flow})
+	}
+	return apierror.Respond(c, apierror.New(fiber.StatusForbidden, apierror.CodeCaptchaRequired, i18n.T(c, key)).With("reason", reason))
+}
@@ -1,47 +1,143 @@
 package handlers
 
 import (
-	"runtime"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"runtime/debug"
+	"strconv"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/config"
+	"github.com/zesbe/lumina-ai/internal/database"
+	"github.com/zesbe/lumina-ai/internal/i18n"
+	"github.com/zesbe/lumina-ai/internal/maintenance"
+	"github.com/zesbe/lumina-ai/internal/middleware"
+	"github.com/zesbe/lumina-ai/internal/reporting"
+	"github.com/zesbe/lumina-ai/internal/version"
 )
 
-func ErrorHandler(c *fiber.Ctx, err error) error {
-	code := fiber.StatusInternalServerError
-	message := "Internal Server Error"
+// requestDB scopes db to the request, so its queries are cancelled when
+// the route's deadline passes instead of running on after the response.
+func requestDB(c *fiber.Ctx, db *gorm.DB) *gorm.DB {
+	return db.WithContext(c.UserContext())
+}
+
+// panicReported marks a request whose panic ReportPanic already sent, so
+// ErrorHandler doesn't report the resulting 500 again.
+const panicReported = "panicReported"
+
+// ErrorHandler answers errors that handlers returned instead of writing.
+// Known kinds get their own status: a missing record is a 404, a passed
+// deadline a 504, failed validation or an unreadable body a 400, and a
+// *fiber.Error keeps its code (426 from the WebSocket upgrade, 413, ...).
+// Anything else is a 500 whose message is generic; the error itself is
+// logged with the request ID, and outside production it is also sent
+// under details.debug. Server errors (5xx) are reported.
+func ErrorHandler(cfg *config.Config) fiber.ErrorHandler {
+	production := cfg.Environment == "production"
+
+	return func(c *fiber.Ctx, err error) error {
+		apiErr := classifyError(c, err)
 
-	if e, ok := err.(*fiber.Error); ok {
-		code = e.Code
-		message = e.Message
+		if apiErr.Status >= fiber.StatusInternalServerError {
+			middleware.Log(c).Error("request failed", "status", apiErr.Status, "error", err)
+			if c.Locals(panicReported) == nil {
+				ev := reporting.FromRequest(c)
+				ev.Tags["status"] = strconv.Itoa(apiErr.Status)
+				reporting.Capture(err, ev)
+			}
+			if !production && apiErr.Code == apierror.CodeInternal {
+				apiErr.With("debug", err.Error())
+			}
+		}
+
+		return apierror.Respond(c, apiErr)
 	}
+}
 
-	return c.Status(code).JSON(fiber.Map{
-		"error":   message,
-		"message": err.Error(),
-	})
+// classifyError turns err into the error the client sees. Only messages
+// meant for clients pass through: an *apierror.Error's or *fiber.Error's
+// own, or a localized one.
+func classifyError(c *fiber.Ctx, err error) *apierror.Error {
+	var apiErr *apierror.Error
+	var fiberErr *fiber.Error
+	var validationErrs middleware.ValidationErrors
+	var queryErrs fiber.MultiError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var i18nErr *i18n.Error
+
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr
+	case errors.As(err, &fiberErr):
+		return apierror.New(fiberErr.Code, apierror.ForStatus(fiberErr.Code), fiberErr.Message)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return apierror.New(fiber.StatusNotFound, apierror.CodeNotFound, i18n.T(c, "error.not_found"))
+	case errors.Is(err, context.DeadlineExceeded):
+		return apierror.New(fiber.StatusGatewayTimeout, apierror.CodeTimeout, i18n.T(c, "error.timeout"))
+	case errors.As(err, &validationErrs):
+		return apierror.New(fiber.StatusBadRequest, apierror.CodeValidationFailed, i18n.T(c, "error.validation_failed")).
+			WithDetails([]middleware.ValidationError(validationErrs))
+	case errors.As(err, &queryErrs):
+		return apierror.New(fiber.StatusBadRequest, apierror.CodeBadRequest, i18n.T(c, "error.invalid_query"))
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return apierror.New(fiber.StatusBadRequest, apierror.CodeBadRequest, i18n.T(c, "error.invalid_request_body"))
+	case errors.As(err, &i18nErr):
+		return apierror.New(fiber.StatusInternalServerError, apierror.CodeInternal, i18n.Message(c, err))
+	default:
+		return apierror.New(fiber.StatusInternalServerError, apierror.CodeInternal, i18n.T(c, "error.internal"))
+	}
 }
 
-func HealthCheck(c *fiber.Ctx) error {
-	return c.JSON(fiber.Map{
-		"status":  "healthy",
-		"service": "lumina-ai-api",
-		"version": "2.0.0",
-	})
+// ReportPanic is the recover middleware's stack trace handler: it logs the
+// panic with its stack and reports it with the request attached.
+func ReportPanic(c *fiber.Ctx, e interface{}) {
+	middleware.Log(c).Error("panic recovered", "panic", e, "stack", string(debug.Stack()))
+
+	ev := reporting.FromRequest(c)
+	ev.Level = reporting.LevelFatal
+	reporting.Capture(fmt.Errorf("panic: %v", e), ev)
+	c.Locals(panicReported, true)
+}
+
+// HealthCheck stays 200 during maintenance so instances aren't pulled from
+// the pool; the load balancer and status page read the maintenance block.
+func (h *Handlers) HealthCheck() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{
+			"status":      "healthy",
+			"service":     "lumina-ai-api",
+			"version":     version.Version,
+			"maintenance": maintenance.Current(),
+		})
+	}
 }
 
-func ServerStats(c *fiber.Ctx) error {
-	var m runtime.MemStats
-	runtime.ReadMemStats(&m)
-
-	return c.JSON(fiber.Map{
-		"memory": fiber.Map{
-			"alloc_mb":       m.Alloc / 1024 / 1024,
-			"total_alloc_mb": m.TotalAlloc / 1024 / 1024,
-			"sys_mb":         m.Sys / 1024 / 1024,
-			"num_gc":         m.NumGC,
-		},
-		"goroutines": runtime.NumGoroutine(),
-		"cpu_cores":  runtime.NumCPU(),
-		"go_version": runtime.Version(),
-	})
+// dbHealthTimeout bounds the database round trip in DeepHealthCheck.
+const dbHealthTimeout = 2 * time.Second
+
+// DeepHealthCheck checks the database with a real query and reports its
+// latency and pool saturation, answering 503 when it is unreachable.
+func (h *Handlers) DeepHealthCheck() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		dbHealth := database.Check(c.UserContext(), h.db, dbHealthTimeout)
+
+		status, code := "healthy", fiber.StatusOK
+		if dbHealth.Status != "ok" {
+			status, code = "unhealthy", fiber.StatusServiceUnavailable
+		}
+
+		return c.Status(code).JSON(fiber.Map{
+			"status":   status,
+			"database": dbHealth,
+		})
+	}
 }
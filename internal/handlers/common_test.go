@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/config"
+	"github.com/zesbe/lumina-ai/internal/i18n"
+	"github.com/zesbe/lumina-ai/internal/middleware"
+)
+
+// slowQuery inserts a billion rows from a recursive CTE, which SQLite
+// takes many minutes over. It is a write because the SQLite driver
+// interrupts a statement on cancellation only while executing it, not
+// while rows are being read.
+const slowQuery = `INSERT INTO numbers (i)
+	WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 1000000000)
+	SELECT i FROM n`
+
+func TestRequestDBCancelsSlowQuery(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := db.Exec("CREATE TABLE numbers (i INTEGER)").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	queryErr := make(chan error, 1)
+	app := fiber.New()
+	app.Get("/slow", middleware.Timeout(100*time.Millisecond), func(c *fiber.Ctx) error {
+		err := requestDB(c, db).Exec(slowQuery).Error
+		queryErr <- err
+		return err
+	})
+
+	start := time.Now()
+	resp, err := app.Test(httptest.NewRequest("GET", "/slow", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	elapsed := time.Since(start)
+
+	if resp.StatusCode != fiber.StatusGatewayTimeout {
+		t.Errorf("status %d, want 504", resp.StatusCode)
+	}
+	select {
+	case err := <-queryErr:
+		if err == nil {
+			t.Fatal("the query ran to completion")
+		}
+	default:
+		t.Fatal("the handler returned without the query finishing")
+	}
+	if elapsed > 5*time.Second {
+		t.Errorf("request took %v; the query wasn't interrupted at the deadline", elapsed)
+	}
+
+	// The interrupted statement is rolled back and the connection is
+	// usable again.
+	var count int64
+	if err := db.Raw("SELECT COUNT(*) FROM numbers").Scan(&count).Error; err != nil || count != 0 {
+		t.Errorf("after the interrupt: %d rows, %v; want 0", count, err)
+	}
+}
+
+// leakyError reads like a driver error: it names a table and a
+// constraint, which clients must never see.
+var leakyError = errors.New(`pq: duplicate key value violates unique constraint "users_email_key" (/srv/lumina/internal/handlers/auth.go:120)`)
+
+// errorApp serves GET /fail, which returns whatever err gives it, behind
+// ErrorHandler for environment.
+func errorApp(environment string, err func(c *fiber.Ctx) error) *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler(&config.Config{Environment: environment})})
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("requestID", "req-123")
+		return c.Next()
+	})
+	app.All("/fail", err)
+	return app
+}
+
+func TestErrorHandler(t *testing.T) {
+	tests := []struct {
+		name string
+		err  func(c *fiber.Ctx) error
+		// body is sent as JSON when set.
+		body        string
+		query       string
+		wantStatus  int
+		wantCode    apierror.Code
+		wantMessage string
+	}{
+		{name: "record not found", err: func(*fiber.Ctx) error { return fmt.Errorf("load generation: %w", gorm.ErrRecordNotFound) },
+			wantStatus: 404, wantCode: apierror.CodeNotFound, wantMessage: "Not found"},
+		{name: "deadline passed", err: func(*fiber.Ctx) error { return fmt.Errorf("list generations: %w", context.DeadlineExceeded) },
+			wantStatus: 504, wantCode: apierror.CodeTimeout, wantMessage: "The request took too long to complete. Please try again."},
+		{name: "validation errors", err: func(*fiber.Ctx) error {
+			return middleware.ValidationErrors{{Field: "email", Code: "required", Message: "email is required"}}
+		}, wantStatus: 400, wantCode: apierror.CodeValidationFailed, wantMessage: "Some fields are invalid"},
+		{name: "unparseable query", query: "?page=abc", err: func(c *fiber.Ctx) error {
+			var q struct {
+				Page int `query:"page"`
+			}
+			return c.QueryParser(&q)
+		}, wantStatus: 400, wantCode: apierror.CodeBadRequest, wantMessage: "Invalid query parameters"},
+		{name: "malformed JSON body", body: `{"email": `, err: func(c *fiber.Ctx) error {
+			var body map[string]interface{}
+			return c.BodyParser(&body)
+		}, wantStatus: 400, wantCode: apierror.CodeBadRequest, wantMessage: "Invalid request body"},
+		{name: "mistyped JSON body", body: `{"age": "ten"}`, err: func(c *fiber.Ctx) error {
+			var body struct {
+				Age int `json:"age"`
+			}
+			return c.BodyParser(&body)
+		}, wantStatus: 400, wantCode: apierror.CodeBadRequest, wantMessage: "Invalid request body"},
+		{name: "truncated body", err: func(*fiber.Ctx) error { return io.ErrUnexpectedEOF },
+			wantStatus: 400, wantCode: apierror.CodeBadRequest, wantMessage: "Invalid request body"},
+		{name: "websocket upgrade required", err: func(*fiber.Ctx) error { return fiber.ErrUpgradeRequired },
+			wantStatus: 426, wantCode: apierror.CodeUpgradeRequired, wantMessage: "Upgrade Required"},
+		{name: "fiber error keeps its status", err: func(*fiber.Ctx) error { return fiber.ErrRequestEntityTooLarge },
+			wantStatus: 413, wantCode: apierror.CodePayloadTooLarge, wantMessage: "Request Entity Too Large"},
+		{name: "api error passes through", err: func(*fiber.Ctx) error {
+			return apierror.New(409, apierror.CodeConflict, "already exists")
+		}, wantStatus: 409, wantCode: apierror.CodeConflict, wantMessage: "already exists"},
+		{name: "localized error", err: func(*fiber.Ctx) error {
+			return fmt.Errorf("wrapped: %w", i18n.NewError("error.fetch_generations_failed"))
+		}, wantStatus: 500, wantCode: apierror.CodeInternal, wantMessage: "Failed to fetch generations"},
+		{name: "anything else", err: func(*fiber.Ctx) error { return leakyError },
+			wantStatus: 500, wantCode: apierror.CodeInternal, wantMessage: "Something went wrong on our side. Please try again"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(fiber.MethodPost, "/fail"+tt.query, strings.NewReader(tt.body))
+			if tt.body != "" {
+				req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			}
+			resp, err := errorApp("production", tt.err).Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			var body struct {
+				Code      apierror.Code `json:"code"`
+				Message   string        `json:"message"`
+				RequestID string        `json:"request_id"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.wantStatus || body.Code != tt.wantCode || body.Message != tt.wantMessage {
+				t.Errorf("got %d %s %q, want %d %s %q", resp.StatusCode, body.Code, body.Message, tt.wantStatus, tt.wantCode, tt.wantMessage)
+			}
+			if body.RequestID != "req-123" {
+				t.Errorf("request_id = %q, want req-123", body.RequestID)
+			}
+		})
+	}
+}
+
+// TestErrorHandlerHidesInternalsInProduction checks that an unexpected
+// error's own text is only sent outside production.
+func TestErrorHandlerHidesInternalsInProduction(t *testing.T) {
+	for _, tt := range []struct {
+		environment string
+		wantDebug   bool
+	}{
+		{"production", false},
+		{"development", true},
+	} {
+		t.Run(tt.environment, func(t *testing.T) {
+			app := errorApp(tt.environment, func(*fiber.Ctx) error { return leakyError })
+			resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/fail", nil), -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			raw, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			leaked := strings.Contains(string(raw), "users_email_key") || strings.Contains(string(raw), "auth.go")
+			if leaked != tt.wantDebug {
+				t.Errorf("body %s: error text sent = %v, want %v", raw, leaked, tt.wantDebug)
+			}
+			var body struct {
+				Debug string `json:"debug"`
+			}
+			json.Unmarshal(raw, &body)
+			if tt.wantDebug && body.Debug != leakyError.Error() {
+				t.Errorf("debug = %q, want the error", body.Debug)
+			}
+		})
+	}
+}
+
+// TestErrorEnvelopeMatchesHandlers checks that an error a handler answers
+// itself and the same error left to ErrorHandler look alike, in both
+// envelope versions.
+func TestErrorEnvelopeMatchesHandlers(t *testing.T) {
+	app := errorApp("production", func(c *fiber.Ctx) error {
+		if c.Query("by") == "handler" {
+			return notFound(c, "error.not_found")
+		}
+		return gorm.ErrRecordNotFound
+	})
+
+	for _, version := range []string{"", "2"} {
+		bodies := map[string]string{}
+		for _, by := range []string{"handler", "error_handler"} {
+			req := httptest.NewRequest(fiber.MethodGet, "/fail?by="+by, nil)
+			if version != "" {
+				req.Header.Set(apierror.VersionHeader, version)
+			}
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			raw, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != fiber.StatusNotFound {
+				t.Fatalf("version %q, %s: status %d, want 404", version, by, resp.StatusCode)
+			}
+			bodies[by] = string(raw)
+		}
+		if bodies["handler"] != bodies["error_handler"] {
+			t.Errorf("version %q: handler answered %s, ErrorHandler %s", version, bodies["handler"], bodies["error_handler"])
+		}
+	}
+}
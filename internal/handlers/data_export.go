@@ -0,0 +1,437 @@
+package handlers
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/audit"
+	"github.com/zesbe/lumina-ai/internal/config"
+	"github.com/zesbe/lumina-ai/internal/i18n"
+	"github.com/zesbe/lumina-ai/internal/logger"
+	"github.com/zesbe/lumina-ai/internal/mail"
+	"github.com/zesbe/lumina-ai/internal/middleware"
+	"github.com/zesbe/lumina-ai/internal/models"
+	"github.com/zesbe/lumina-ai/internal/purge"
+)
+
+const (
+	// dataExportTimeout bounds building one bundle, media included.
+	dataExportTimeout = 30 * time.Minute
+	// dataExportInterval is how often a user can ask for an export.
+	dataExportInterval = 24 * time.Hour
+)
+
+// dataExportBundle is data.json in an export. It holds the user's own
+// records only; anything pointing at another user would be an ID.
+type dataExportBundle struct {
+	ExportedAt         time.Time                    `json:"exported_at"`
+	Profile            models.UserResponse          `json:"profile"`
+	Subscription       *models.Subscription         `json:"subscription,omitempty"`
+	Generations        []models.GenerationResponse  `json:"generations"`
+	CreditTransactions []models.CreditTransaction   `json:"credit_transactions"`
+	LoginHistory       []models.LoginEvent          `json:"login_history"`
+	LinkedIdentities   []models.LinkedIdentity      `json:"linked_identities"`
+	APIKeys            []models.APIKeyResponse      `json:"api_keys"`
+	SavedPrompts       []models.SavedPromptResponse `json:"saved_prompts"`
+	Drafts             []models.DraftResponse       `json:"drafts"`
+}
+
+// exportLinks signs download links, so a link works without logging in
+// but can't be made up or extended.
+type exportLinks struct {
+	key []byte
+}
+
+func newExportLinks(secret string) exportLinks {
+	key := sha256.Sum256([]byte("data-export:" + secret))
+	return exportLinks{key: key[:]}
+}
+
+func (l exportLinks) sign(id uint, expires int64) string {
+	mac := hmac.New(sha256.New, l.key)
+	fmt.Fprintf(mac, "%d.%d", id, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// query is the part of a download link that proves it was issued.
+func (l exportLinks) query(export *models.DataExport) string {
+	expires := export.ExpiresAt.Unix()
+	return "expires=" + strconv.FormatInt(expires, 10) + "&signature=" + l.sign(export.ID, expires)
+}
+
+func (l exportLinks) response(export *models.DataExport) models.DataExportResponse {
+	res := models.DataExportResponse{DataExport: *export}
+	if export.Status == models.ExportReady && export.ExpiresAt != nil && time.Now().Before(*export.ExpiresAt) {
+		res.DownloadURL = fmt.Sprintf("/api/v1/exports/%d/download?%s", export.ID, l.query(export))
+	}
+	return res
+}
+
+// RequestDataExport queues a copy of everything the caller has stored
+// with us. Progress arrives on the WebSocket, and the download link is
+// mailed once the bundle is ready.
+func (h *Handlers) RequestDataExport() fiber.Handler {
+	links := newExportLinks(h.cfg.JWTSecret)
+
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+
+		var req models.DataExportRequest
+		if len(c.Body()) > 0 {
+			if apiErr := bindJSON(c, &req); apiErr != nil {
+				return apierror.Respond(c, apiErr)
+			}
+		}
+
+		// Failed exports don't count, so a user isn't locked out for a day
+		// by our mistake.
+		var recent int64
+		if err := requestDB(c, h.db).Model(&models.DataExport{}).
+			Where("user_id = ? AND created_at > ? AND status <> ?", userID, time.Now().Add(-dataExportInterval), models.ExportFailed).
+			Count(&recent).Error; err != nil {
+			return internalError(c, "error.data_export_failed")
+		}
+		if recent > 0 {
+			return errorResponse(c, fiber.StatusTooManyRequests, apierror.CodeDailyLimitReached, i18n.T(c, "error.data_export_daily_limit"))
+		}
+
+		export := models.DataExport{
+			UserID:       userID,
+			Status:       models.ExportPending,
+			IncludeMedia: req.IncludeMedia,
+			Locale:       i18n.Locale(c),
+		}
+		if err := requestDB(c, h.db).Create(&export).Error; err != nil {
+			middleware.Log(c).Error("failed to queue data export", "error", err)
+			return internalError(c, "error.data_export_failed")
+		}
+		h.startDataExport(export)
+
+		audit.Record(c, models.AuditDataExport, audit.User(userID), fiber.Map{"export_id": export.ID, "include_media": export.IncludeMedia})
+
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+			"message": i18n.T(c, "message.data_export_started"),
+			"export":  links.response(&export),
+		})
+	}
+}
+
+// GetDataExport returns the caller's latest export, with its download
+// link while it works.
+func (h *Handlers) GetDataExport() fiber.Handler {
+	links := newExportLinks(h.cfg.JWTSecret)
+
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+
+		var export models.DataExport
+		if err := requestDB(c, h.db).Where("user_id = ?", userID).Order("created_at DESC").First(&export).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return notFound(c, "error.data_export_not_found")
+			}
+			return internalError(c, "error.data_export_failed")
+		}
+
+		return c.JSON(fiber.Map{"export": links.response(&export)})
+	}
+}
+
+// DownloadDataExport serves a bundle to whoever holds a valid link. The
+// link is the credential, like the ones mailed for email changes, so it
+// can be opened straight from the mail.
+func (h *Handlers) DownloadDataExport() fiber.Handler {
+	links := newExportLinks(h.cfg.JWTSecret)
+
+	return func(c *fiber.Ctx) error {
+		id, err := c.ParamsInt("id")
+		if err != nil || id <= 0 {
+			return notFound(c, "error.data_export_not_found")
+		}
+		expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+		if err != nil || time.Now().Unix() > expires ||
+			!hmac.Equal([]byte(c.Query("signature")), []byte(links.sign(uint(id), expires))) {
+			return errorResponse(c, fiber.StatusForbidden, apierror.CodeInvalidToken, i18n.T(c, "error.data_export_link_invalid"))
+		}
+
+		var export models.DataExport
+		if err := requestDB(c, h.db).Where("id = ? AND status = ? AND expires_at > ?", id, models.ExportReady, time.Now()).
+			First(&export).Error; err != nil {
+			return notFound(c, "error.data_export_not_found")
+		}
+
+		c.Set(fiber.HeaderCacheControl, "private, no-store")
+		return c.Download(dataExportPath(h.cfg, export.ID), fmt.Sprintf("lumina-export-%s.zip", export.CreatedAt.UTC().Format("20060102")))
+	}
+}
+
+// ResumeDataExports restarts exports a previous shutdown cut off. Bundles
+// are written from scratch, so a half-written one is simply replaced.
+func (h *Handlers) ResumeDataExports() {
+	var exports []models.DataExport
+	if err := h.db.Where("status IN ?", []string{models.ExportPending, models.ExportProcessing}).Find(&exports).Error; err != nil {
+		logger.L().Error("failed to load unfinished data exports", "error", err)
+		return
+	}
+	for _, export := range exports {
+		h.startDataExport(export)
+	}
+	if len(exports) > 0 {
+		logger.L().Info("resuming data exports", "count", len(exports))
+	}
+}
+
+func dataExportPath(cfg *config.Config, id uint) string {
+	return filepath.Join(cfg.DataExportDir, fmt.Sprintf("%d.zip", id))
+}
+
+// startDataExport builds the bundle in the background. Shutdown cancels
+// it through the jobs context and leaves it for ResumeDataExports.
+func (h *Handlers) startDataExport(export models.DataExport) {
+	go func() {
+		ctx, cancel := context.WithTimeout(h.jobs.ctx, dataExportTimeout)
+		defer cancel()
+		h.runDataExport(ctx, export)
+	}()
+}
+
+func (h *Handlers) runDataExport(ctx context.Context, export models.DataExport) {
+	log := logger.L().With("user_id", export.UserID, "export_id", export.ID)
+	links := newExportLinks(h.cfg.JWTSecret)
+	db := h.db.WithContext(ctx)
+
+	lastSent := -1
+	progress := func(percent int) {
+		export.Progress = percent
+		db.Model(&export).Updates(map[string]interface{}{"status": export.Status, "progress": percent})
+		// Enough to move a progress bar without flooding the socket.
+		if percent-lastSent >= 5 || percent == 100 {
+			lastSent = percent
+			h.hub.SendToUser(export.UserID, fiber.Map{"type": "data_export_progress", "export": links.response(&export)})
+		}
+	}
+	export.Status = models.ExportProcessing
+	progress(0)
+
+	start := time.Now()
+	email, size, err := buildDataExport(ctx, db, h.cfg, export, progress)
+	if err != nil {
+		if h.jobs.ctx.Err() != nil {
+			log.Info("data export interrupted by shutdown")
+			return
+		}
+		log.Error("data export failed", "error", err)
+		export.Status = models.ExportFailed
+		db.Model(&export).Update("status", export.Status)
+		h.hub.SendToUser(export.UserID, fiber.Map{"type": "data_export_failed", "export": links.response(&export)})
+		return
+	}
+
+	now := time.Now()
+	expires := now.Add(h.cfg.DataExportTTL)
+	export.Status, export.Progress, export.SizeBytes = models.ExportReady, 100, size
+	export.ExpiresAt, export.CompletedAt = &expires, &now
+	if err := db.Model(&export).Updates(map[string]interface{}{
+		"status":       export.Status,
+		"progress":     export.Progress,
+		"size_bytes":   size,
+		"expires_at":   expires,
+		"completed_at": now,
+	}).Error; err != nil {
+		log.Error("failed to record finished data export", "error", err)
+		return
+	}
+	log.Info("data export finished", "bytes", size, "duration_ms", time.Since(start).Milliseconds())
+
+	h.hub.SendToUser(export.UserID, fiber.Map{"type": "data_export_ready", "export": links.response(&export)})
+	// The download link expires, so the notice points at the export
+	// rather than carrying it.
+	notify(db, h.hub, export.Locale, models.Notification{
+		UserID:  export.UserID,
+		Type:    models.NotifyDataExportReady,
+		RefType: "data_export",
+		RefID:   strconv.FormatUint(uint64(export.ID), 10),
+	}, i18n.Params{"hours": int(h.cfg.DataExportTTL.Hours())})
+	if err := mail.Send(ctx, mail.Message{
+		To:      email,
+		Subject: i18n.Translate(export.Locale, "email.data_export_ready.subject", nil),
+		Body: i18n.Translate(export.Locale, "email.data_export_ready.body", i18n.Params{
+			"link":  h.cfg.AppURL + "/download-export?id=" + strconv.FormatUint(uint64(export.ID), 10) + "&" + links.query(&export),
+			"hours": int(h.cfg.DataExportTTL.Hours()),
+		}),
+	}); err != nil {
+		log.Warn("failed to mail data export link", "error", err)
+	}
+}
+
+// buildDataExport writes the bundle next to its final path and moves it
+// there once complete, returning the user's email for the notice and the
+// bundle's size.
+func buildDataExport(ctx context.Context, db *gorm.DB, cfg *config.Config, export models.DataExport, progress func(int)) (string, int64, error) {
+	var user models.User
+	if err := db.First(&user, export.UserID).Error; err != nil {
+		return "", 0, err
+	}
+	bundle := dataExportBundle{
+		ExportedAt:         time.Now().UTC(),
+		Profile:            user.ToResponse(),
+		Generations:        []models.GenerationResponse{},
+		CreditTransactions: []models.CreditTransaction{},
+		LoginHistory:       []models.LoginEvent{},
+		LinkedIdentities:   []models.LinkedIdentity{},
+		APIKeys:            []models.APIKeyResponse{},
+		SavedPrompts:       []models.SavedPromptResponse{},
+		Drafts:             []models.DraftResponse{},
+	}
+
+	var subscription models.Subscription
+	switch err := db.Preload("Plan").Where("user_id = ?", user.ID).First(&subscription).Error; {
+	case err == nil:
+		bundle.Subscription = &subscription
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return "", 0, err
+	}
+
+	var generations []models.Generation
+	if err := db.Where("user_id = ?", user.ID).Order("id").Find(&generations).Error; err != nil {
+		return "", 0, err
+	}
+	for i := range generations {
+		// Built away from any request, so media URLs are only absolute when
+		// the base is configured.
+		bundle.Generations = append(bundle.Generations, generations[i].ToResponse(cfg.PublicBaseURL))
+	}
+	progress(20)
+
+	if err := db.Where("user_id = ?", user.ID).Order("id").Find(&bundle.CreditTransactions).Error; err != nil {
+		return "", 0, err
+	}
+	if err := db.Where("user_id = ?", user.ID).Order("created_at DESC").Find(&bundle.LoginHistory).Error; err != nil {
+		return "", 0, err
+	}
+	if err := db.Where("user_id = ?", user.ID).Order("id").Find(&bundle.LinkedIdentities).Error; err != nil {
+		return "", 0, err
+	}
+	var keys []models.APIKey
+	if err := db.Where("user_id = ? AND revoked_at IS NULL", user.ID).Order("id").Find(&keys).Error; err != nil {
+		return "", 0, err
+	}
+	for i := range keys {
+		bundle.APIKeys = append(bundle.APIKeys, keys[i].ToResponse())
+	}
+	var prompts []models.SavedPrompt
+	if err := db.Where("user_id = ?", user.ID).Order("id").Find(&prompts).Error; err != nil {
+		return "", 0, err
+	}
+	for i := range prompts {
+		bundle.SavedPrompts = append(bundle.SavedPrompts, prompts[i].ToResponse())
+	}
+	var drafts []models.Draft
+	if err := db.Where("user_id = ?", user.ID).Order("id").Find(&drafts).Error; err != nil {
+		return "", 0, err
+	}
+	for i := range drafts {
+		bundle.Drafts = append(bundle.Drafts, drafts[i].ToResponse())
+	}
+	progress(30)
+
+	if err := os.MkdirAll(cfg.DataExportDir, 0o700); err != nil {
+		return "", 0, err
+	}
+	final := dataExportPath(cfg, export.ID)
+	tmp := final + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp)
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: "data.json", Method: zip.Deflate, Modified: bundle.ExportedAt})
+	if err != nil {
+		return "", 0, err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(bundle); err != nil {
+		return "", 0, err
+	}
+	progress(40)
+
+	if export.IncludeMedia {
+		for i, g := range generations {
+			for _, u := range []string{g.OutputURL, g.ThumbnailURL} {
+				if err := ctx.Err(); err != nil {
+					return "", 0, err
+				}
+				if err := addExportMedia(zw, cfg.UploadPath, g.ID, u); err != nil {
+					return "", 0, err
+				}
+			}
+			progress(40 + 55*(i+1)/len(generations))
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return "", 0, err
+	}
+	if err := f.Close(); err != nil {
+		return "", 0, err
+	}
+	info, err := os.Stat(tmp)
+	if err != nil {
+		return "", 0, err
+	}
+	if err := os.Rename(tmp, final); err != nil {
+		return "", 0, err
+	}
+	return user.Email, info.Size(), nil
+}
+
+// addExportMedia copies a locally stored file into the bundle as
+// media/<generation id>/<name>. Remote URLs are only listed in data.json,
+// and files that have gone missing are skipped.
+func addExportMedia(zw *zip.Writer, uploadPath string, generationID uint, mediaURL string) error {
+	src, ok := purge.MediaPath(uploadPath, mediaURL)
+	if !ok {
+		return nil
+	}
+	f, err := os.Open(src)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	// Media is already compressed; storing it saves the CPU.
+	w, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     fmt.Sprintf("media/%d/%s", generationID, filepath.Base(src)),
+		Method:   zip.Store,
+		Modified: info.ModTime(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, f)
+	return err
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"errors"
+	"regexp"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/audit"
+	"github.com/zesbe/lumina-ai/internal/disposable"
+	"github.com/zesbe/lumina-ai/internal/i18n"
+	"github.com/zesbe/lumina-ai/internal/middleware"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+// disposableBlocksWindow is how far back the abuse view looks by default.
+const disposableBlocksWindow = 7 * 24 * time.Hour
+
+// domainPattern is a host name with at least two labels.
+var domainPattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}$`)
+
+// disposableEmail turns away an address at a throwaway domain, or one
+// that can't receive mail, with a code the frontend can recognize. The
+// attempt is audited with the caller's IP, which is what the abuse view
+// counts.
+func disposableEmail(c *fiber.Ctx, flow string, verdict *disposable.Verdict) error {
+	audit.Record(c, models.AuditDisposableEmail, audit.Target{Type: "email_domain", ID: verdict.Domain}, fiber.Map{
+		"flow":   flow,
+		"reason": verdict.Reason,
+	})
+	middleware.Log(c).Info("disposable email refused", "flow", flow, "domain", verdict.Domain, "reason", verdict.Reason)
+
+	key := "error.disposable_email"
+	if verdict.Reason == disposable.ReasonNoMX {
+		key = "error.email_undeliverable"
+	}
+	return apierror.Respond(c, apierror.New(fiber.StatusUnprocessableEntity, apierror.CodeDisposableEmail,
+		i18n.T(c, key)).With("reason", verdict.Reason))
+}
+
+// ListDisposableDomains returns the admin entries and the size of the
+// lists they correct.
+func (h *Handlers) ListDisposableDomains() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var entries []models.DisposableDomain
+		if err := requestDB(c, h.db).Order("domain").Find(&entries).Error; err != nil {
+			return internalError(c, "error.fetch_disposable_domains_failed")
+		}
+
+		return c.JSON(fiber.Map{
+			"domains": entries,
+			"lists":   disposable.CurrentStats(),
+		})
+	}
+}
+
+// SetDisposableDomain blocks a domain, or with blocked false lets a listed
+// one through, and reloads the entries so it applies here immediately
+// (other instances within a minute).
+func (h *Handlers) SetDisposableDomain() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.DisposableDomainRequest
+		if apiErr := bindJSON(c, &req); apiErr != nil {
+			return apierror.Respond(c, apiErr)
+		}
+
+		v := middleware.NewLocalizedValidator(i18n.Locale(c)).Struct(&req)
+		if req.Domain != "" && !domainPattern.MatchString(disposable.Normalize(req.Domain)) {
+			v.AddRuleError("domain", "invalid", nil)
+		}
+		if v.HasErrors() {
+			return validationFailed(c, v.Errors())
+		}
+
+		adminID := c.Locals("userID").(uint)
+		entry := models.DisposableDomain{
+			Domain:    disposable.Normalize(req.Domain),
+			Blocked:   req.Blocked == nil || *req.Blocked,
+			CreatedBy: &adminID,
+		}
+		if err := requestDB(c, h.db).Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "domain"}},
+			DoUpdates: clause.AssignmentColumns([]string{"blocked", "created_by", "updated_at"}),
+		}).Create(&entry).Error; err != nil {
+			return internalError(c, "error.save_disposable_domain_failed")
+		}
+		if err := disposable.Reload(c.UserContext()); err != nil {
+			middleware.Log(c).Warn("failed to reload disposable domain entries", "error", err)
+		}
+
+		audit.Record(c, models.AuditDisposableDomain, audit.Target{Type: "email_domain", ID: entry.Domain}, fiber.Map{
+			"op":      "set",
+			"blocked": entry.Blocked,
+		})
+
+		return c.JSON(fiber.Map{
+			"domain": entry,
+		})
+	}
+}
+
+// DeleteDisposableDomain removes an admin entry, so the domain is judged
+// by the lists again.
+func (h *Handlers) DeleteDisposableDomain() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		domain := disposable.Normalize(c.Params("domain"))
+
+		var entry models.DisposableDomain
+		if err := requestDB(c, h.db).Where("domain = ?", domain).First(&entry).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return notFound(c, "error.disposable_domain_not_found")
+			}
+			return internalError(c, "error.save_disposable_domain_failed")
+		}
+		if err := requestDB(c, h.db).Delete(&entry).Error; err != nil {
+			return internalError(c, "error.save_disposable_domain_failed")
+		}
+		if err := disposable.Reload(c.UserContext()); err != nil {
+			middleware.Log(c).Warn("failed to reload disposable domain entries", "error", err)
+		}
+
+		audit.Record(c, models.AuditDisposableDomain, audit.Target{Type: "email_domain", ID: entry.Domain}, fiber.Map{
+			"op":      "delete",
+			"blocked": entry.Blocked,
+		})
+
+		return c.JSON(fiber.Map{
+			"message": i18n.T(c, "message.disposable_domain_deleted"),
+			"listed":  disposable.Listed(domain),
+		})
+	}
+}
+
+// GetDisposableBlocks counts refused throwaway addresses by IP, most first,
+// over from/to (the last 7 days by default). The attempts are stored in
+// the audit log, so this is a view of it.
+func (h *Handlers) GetDisposableBlocks() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		from, to, err := parseDateRange(c.Query("from"), c.Query("to"))
+		if err != nil {
+			return errorResponse(c, fiber.StatusBadRequest, apierror.CodeBadRequest, i18n.Message(c, err))
+		}
+		if from.IsZero() {
+			from = time.Now().Add(-disposableBlocksWindow)
+		}
+
+		query := requestDB(c, h.db).Model(&models.AuditLog{}).
+			Select("ip, COUNT(*) AS attempts, MAX(created_at) AS last_at").
+			Where("action = ? AND created_at >= ?", models.AuditDisposableEmail, from)
+		if !to.IsZero() {
+			query = query.Where("created_at < ?", to)
+		}
+		var blocks []models.DisposableBlocks
+		if err := query.Group("ip").Order("attempts DESC").Limit(100).Scan(&blocks).Error; err != nil {
+			return internalError(c, "error.fetch_audit_logs_failed")
+		}
+
+		return c.JSON(fiber.Map{
+			"from":   from,
+			"blocks": blocks,
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/filesystem"
+	swaggerFiles "github.com/swaggo/files/v2"
+
+	"github.com/zesbe/lumina-ai/internal/openapi"
+)
+
+// swaggerInitializer replaces the bundled one, which loads the Petstore
+// example, to load our document instead.
+const swaggerInitializer = `window.onload = function() {
+  window.ui = SwaggerUIBundle({
+    url: "/api/v1/openapi.json",
+    dom_id: "#swagger-ui",
+    deepLinking: true,
+    presets: [SwaggerUIBundle.presets.apis, SwaggerUIStandalonePreset],
+    plugins: [SwaggerUIBundle.plugins.DownloadUrl],
+    layout: "StandaloneLayout"
+  });
+};
+`
+
+// OpenAPI serves the OpenAPI 3 document of the API.
+func (h *Handlers) OpenAPI() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(openapi.Document())
+	}
+}
+
+// SwaggerUI serves a bundled Swagger UI for the document. Mount it with
+// app.Use("/docs", ...).
+func (h *Handlers) SwaggerUI() fiber.Handler {
+	files := filesystem.New(filesystem.Config{
+		Root:  http.FS(swaggerFiles.FS),
+		Index: "index.html",
+	})
+
+	return func(c *fiber.Ctx) error {
+		switch c.Path() {
+		case "/docs":
+			// The page loads its assets by relative URL.
+			return c.Redirect("/docs/", fiber.StatusMovedPermanently)
+		case "/docs/swagger-initializer.js":
+			c.Set(fiber.HeaderContentType, "text/javascript; charset=utf-8")
+			return c.SendString(swaggerInitializer)
+		}
+		return files(c)
+	}
+}
@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/config"
+	"github.com/zesbe/lumina-ai/internal/i18n"
+	"github.com/zesbe/lumina-ai/internal/middleware"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+// ListDrafts lists the caller's drafts, most recently saved first.
+// Drafts are not generations and never show up in GetGenerations.
+func (h *Handlers) ListDrafts() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+
+		var drafts []models.Draft
+		if err := requestDB(c, h.db).Where("user_id = ?", userID).
+			Order("updated_at DESC, id DESC").Find(&drafts).Error; err != nil {
+			return internalError(c, "error.fetch_drafts_failed")
+		}
+
+		response := make([]models.DraftResponse, len(drafts))
+		for i := range drafts {
+			response[i] = drafts[i].ToResponse()
+		}
+		return c.JSON(fiber.Map{"drafts": response})
+	}
+}
+
+func (h *Handlers) GetDraft() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		draft, err := draftParam(c, h.db)
+		if draft == nil {
+			return err
+		}
+		return c.JSON(fiber.Map{"draft": draft.ToResponse()})
+	}
+}
+
+// CreateDraft saves a generate request without starting it, so nothing
+// is charged. A user can keep models.MaxDrafts.
+func (h *Handlers) CreateDraft() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		draft, err := parseDraft(c, h.cfg)
+		if draft == nil {
+			return err
+		}
+
+		userID := c.Locals("userID").(uint)
+		var saved int64
+		if err := requestDB(c, h.db).Model(&models.Draft{}).Where("user_id = ?", userID).Count(&saved).Error; err != nil {
+			return internalError(c, "error.create_draft_failed")
+		}
+		if saved >= models.MaxDrafts {
+			return apierror.Respond(c, apierror.New(fiber.StatusConflict, apierror.CodeConflict,
+				i18n.T(c, "error.draft_limit", i18n.Params{"max": models.MaxDrafts})).With("max", models.MaxDrafts))
+		}
+
+		draft.UserID = userID
+		if err := requestDB(c, h.db).Create(draft).Error; err != nil {
+			return internalError(c, "error.create_draft_failed")
+		}
+
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"message": i18n.T(c, "message.draft_created"),
+			"draft":   draft.ToResponse(),
+		})
+	}
+}
+
+// UpdateDraft replaces one of the caller's drafts. It is meant for
+// autosave: a single UPDATE, with the same result however often the same
+// body is sent, and only the new updated_at in the response.
+func (h *Handlers) UpdateDraft() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+		if err != nil {
+			return badRequest(c, "error.invalid_draft_id")
+		}
+		draft, err := parseDraft(c, h.cfg)
+		if draft == nil {
+			return err
+		}
+
+		userID := c.Locals("userID").(uint)
+		now := time.Now()
+		res := requestDB(c, h.db).Model(&models.Draft{}).Where("id = ? AND user_id = ?", id, userID).
+			Updates(map[string]interface{}{
+				"type":       draft.Type,
+				"title":      draft.Title,
+				"payload":    draft.Payload,
+				"updated_at": now,
+			})
+		if res.Error != nil {
+			return internalError(c, "error.update_draft_failed")
+		}
+		if res.RowsAffected == 0 {
+			return notFound(c, "error.draft_not_found")
+		}
+
+		return c.JSON(fiber.Map{
+			"id":         id,
+			"updated_at": now,
+		})
+	}
+}
+
+func (h *Handlers) DeleteDraft() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		draft, err := draftParam(c, h.db)
+		if draft == nil {
+			return err
+		}
+
+		if err := requestDB(c, h.db).Delete(draft).Error; err != nil {
+			return internalError(c, "error.delete_draft_failed")
+		}
+
+		return c.JSON(fiber.Map{
+			"message": i18n.T(c, "message.draft_deleted"),
+		})
+	}
+}
+
+// SubmitDraft sends one of the caller's drafts to GenerateMusic or
+// GenerateVideo as if it were the request body, so it is checked, charged
+// and started like any other, and answers with what they answer. The
+// draft is deleted once the generation is accepted and kept when it is
+// refused. It is claimed for the length of the request, so submitting it
+// twice at once starts one generation; a claim older than GENERATE_TIMEOUT
+// is from a request that died and is taken over.
+func (h *Handlers) SubmitDraft() fiber.Handler {
+	generate := map[models.GenerationType]fiber.Handler{
+		models.TypeMusic: h.GenerateMusic(),
+		models.TypeVideo: h.GenerateVideo(),
+	}
+
+	return func(c *fiber.Ctx) error {
+		draft, err := draftParam(c, h.db)
+		if draft == nil {
+			return err
+		}
+
+		now := time.Now()
+		claim := requestDB(c, h.db).Model(&models.Draft{}).
+			Where("id = ? AND (submitting_at IS NULL OR submitting_at < ?)", draft.ID, now.Add(-h.cfg.GenerateTimeout)).
+			Update("submitting_at", now)
+		if claim.Error != nil {
+			return internalError(c, "error.submit_draft_failed")
+		}
+		if claim.RowsAffected == 0 {
+			return conflict(c, "error.draft_submitting")
+		}
+
+		c.Request().SetBody([]byte(draft.Payload))
+		c.Request().Header.SetContentType(fiber.MIMEApplicationJSON)
+		err = generate[draft.Type](c)
+
+		// The response is written by now, so the draft is cleaned up
+		// whatever the request's deadline left of its context.
+		store := h.db.WithContext(h.jobs.ctx)
+		if err == nil && c.Response().StatusCode() < fiber.StatusMultipleChoices {
+			if err := store.Delete(draft).Error; err != nil {
+				middleware.Log(c).Error("failed to delete submitted draft", "draft_id", draft.ID, "error", err)
+			}
+			return nil
+		}
+		if err := store.Model(draft).Update("submitting_at", nil).Error; err != nil {
+			middleware.Log(c).Error("failed to release draft", "draft_id", draft.ID, "error", err)
+		}
+		return err
+	}
+}
+
+// parseDraft reads a DraftRequest into a draft without an owner. The
+// payload is decoded as strictly as the generate request itself and
+// checked by its rules, apart from required fields and minimum lengths,
+// which an unfinished request can't meet yet. When the body is refused it
+// writes the response itself and returns a nil draft; callers then return
+// the error as-is.
+func parseDraft(c *fiber.Ctx, cfg *config.Config) (*models.Draft, error) {
+	var req models.DraftRequest
+	if apiErr := bindJSON(c, &req); apiErr != nil {
+		return nil, apierror.Respond(c, apiErr)
+	}
+	v := middleware.NewLocalizedValidator(i18n.Locale(c)).Struct(&req)
+	if v.HasErrors() {
+		return nil, validationFailed(c, v.Errors())
+	}
+	if len(req.Payload) == 0 || string(req.Payload) == "null" {
+		req.Payload = json.RawMessage("{}")
+	}
+
+	limits := textLimits(c, cfg)
+	var payload interface{}
+	var title string
+	switch req.Type {
+	case models.TypeMusic:
+		var music models.GenerateMusicRequest
+		if apiErr := decodeDraftPayload(c, req.Payload, &music); apiErr != nil {
+			return nil, apierror.Respond(c, apiErr)
+		}
+		v.Struct(&music).
+			MaxLength("prompt", music.Prompt, limits.Prompt).
+			MaxLength("lyrics", music.Lyrics, limits.Lyrics)
+		payload, title = music, music.Title
+	default:
+		var video models.GenerateVideoRequest
+		if apiErr := decodeDraftPayload(c, req.Payload, &video); apiErr != nil {
+			return nil, apierror.Respond(c, apiErr)
+		}
+		v.Struct(&video).
+			MaxLength("prompt", video.Prompt, limits.Prompt).
+			MaxLength("narration", video.Narration, limits.Narration)
+		payload, title = video, video.Title
+	}
+
+	var errs []middleware.ValidationError
+	for _, e := range v.Errors() {
+		if e.Code != "required" && e.Code != "min_length" {
+			errs = append(errs, e)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, validationFailed(c, errs)
+	}
+
+	normalized, err := json.Marshal(payload)
+	if err != nil {
+		return nil, internalError(c, "error.create_draft_failed")
+	}
+	return &models.Draft{
+		Type:    req.Type,
+		Title:   middleware.SanitizeInput(title),
+		Payload: string(normalized),
+	}, nil
+}
+
+// decodeDraftPayload decodes a draft's payload as bindJSON would decode
+// the same request sent directly.
+func decodeDraftPayload(c *fiber.Ctx, payload json.RawMessage, out interface{}) *apierror.Error {
+	if strings.EqualFold(c.Get(StrictHeader), "false") {
+		if err := json.Unmarshal(payload, out); err != nil {
+			return apierror.New(fiber.StatusBadRequest, apierror.CodeBadRequest, i18n.T(c, "error.invalid_request_body"))
+		}
+		return nil
+	}
+	return decodeJSONObject(c, payload, out)
+}
+
+// draftParam loads the caller's :id draft. When it can't, it writes the
+// 400/404 response itself and returns a nil draft; callers then return
+// the error as-is.
+func draftParam(c *fiber.Ctx, db *gorm.DB) (*models.Draft, error) {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return nil, badRequest(c, "error.invalid_draft_id")
+	}
+
+	var draft models.Draft
+	userID := c.Locals("userID").(uint)
+	if err := requestDB(c, db).Where("id = ? AND user_id = ?", id, userID).First(&draft).Error; err != nil {
+		return nil, notFound(c, "error.draft_not_found")
+	}
+	return &draft, nil
+}
@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/audit"
+	"github.com/zesbe/lumina-ai/internal/crypto"
+	"github.com/zesbe/lumina-ai/internal/disposable"
+	"github.com/zesbe/lumina-ai/internal/i18n"
+	"github.com/zesbe/lumina-ai/internal/mail"
+	"github.com/zesbe/lumina-ai/internal/middleware"
+	"github.com/zesbe/lumina-ai/internal/models"
+	"github.com/zesbe/lumina-ai/internal/session"
+)
+
+const (
+	// emailChangeTTL is how long the link sent to the new address works.
+	emailChangeTTL = 24 * time.Hour
+	// emailChangeUndoTTL is how long the old address can undo a change.
+	emailChangeUndoTTL = 48 * time.Hour
+)
+
+var (
+	errEmailChangeInvalid = errors.New("email change token invalid")
+	errEmailTaken         = errors.New("email taken")
+)
+
+// ChangeEmail starts moving the caller's account to a new address. Nothing
+// changes until the link mailed to that address is followed.
+func (h *Handlers) ChangeEmail() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+
+		var req models.ChangeEmailRequest
+		if apiErr := bindJSON(c, &req); apiErr != nil {
+			return apierror.Respond(c, apiErr)
+		}
+
+		if errs := middleware.ValidateRequest(c, &req); len(errs) > 0 {
+			return validationFailed(c, errs)
+		}
+		newEmail := models.NormalizeEmail(req.NewEmail)
+
+		var user models.User
+		if err := requestDB(c, h.db).First(&user, userID).Error; err != nil {
+			return notFound(c, "error.user_not_found")
+		}
+
+		valid, _ := crypto.VerifyPassword(req.CurrentPassword, user.PasswordHash)
+		if !valid {
+			return errorResponse(c, fiber.StatusUnauthorized, apierror.CodeInvalidCredentials, i18n.T(c, "error.current_password_incorrect"))
+		}
+		if strings.EqualFold(newEmail, user.Email) {
+			return badRequest(c, "error.email_unchanged")
+		}
+		if verdict := disposable.Check(c.UserContext(), newEmail); verdict != nil {
+			return disposableEmail(c, "change_email", verdict)
+		}
+		if taken, err := emailTaken(requestDB(c, h.db), newEmail, user.ID); err != nil {
+			return internalError(c, "error.change_email_failed")
+		} else if taken {
+			return errorResponse(c, fiber.StatusConflict, apierror.CodeEmailTaken, i18n.T(c, "error.email_registered"))
+		}
+
+		token, err := crypto.GenerateRandomToken(32)
+		if err != nil {
+			return internalError(c, "error.change_email_failed")
+		}
+		change := models.EmailChange{
+			UserID:    user.ID,
+			OldEmail:  user.Email,
+			NewEmail:  newEmail,
+			TokenHash: crypto.HashToken(token),
+			ExpiresAt: time.Now().Add(emailChangeTTL),
+		}
+		// A new request replaces any earlier one still waiting.
+		err = requestDB(c, h.db).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("user_id = ? AND confirmed_at IS NULL", user.ID).Delete(&models.EmailChange{}).Error; err != nil {
+				return err
+			}
+			return tx.Create(&change).Error
+		})
+		if err != nil {
+			return internalError(c, "error.change_email_failed")
+		}
+
+		params := i18n.Params{
+			"email": newEmail,
+			"link":  h.cfg.AppURL + "/confirm-email-change?token=" + url.QueryEscape(token),
+			"hours": int(emailChangeTTL.Hours()),
+		}
+		if err := mail.Send(c.UserContext(), mail.Message{
+			To:      newEmail,
+			Subject: i18n.T(c, "email.confirm_email_change.subject"),
+			Body:    i18n.T(c, "email.confirm_email_change.body", params),
+		}); err != nil {
+			middleware.Log(c).Error("failed to send email change confirmation", "error", err)
+			requestDB(c, h.db).Delete(&change)
+			return internalError(c, "error.send_email_failed")
+		}
+
+		audit.Record(c, models.AuditEmailChangeRequest, audit.User(user.ID), fiber.Map{"new_email": newEmail})
+
+		return c.JSON(fiber.Map{
+			"message": i18n.T(c, "message.email_change_requested", i18n.Params{"email": newEmail}),
+		})
+	}
+}
+
+// ConfirmEmailChange applies a pending change with the token mailed to
+// the new address, which also counts as verifying it. The old address is
+// told, with a link to undo the change.
+func (h *Handlers) ConfirmEmailChange() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.EmailChangeTokenRequest
+		if apiErr := bindJSON(c, &req); apiErr != nil {
+			return apierror.Respond(c, apiErr)
+		}
+
+		if errs := middleware.ValidateRequest(c, &req); len(errs) > 0 {
+			return validationFailed(c, errs)
+		}
+
+		undoToken, err := crypto.GenerateRandomToken(32)
+		if err != nil {
+			return internalError(c, "error.change_email_failed")
+		}
+
+		var change models.EmailChange
+		var user models.User
+		err = requestDB(c, h.db).Transaction(func(tx *gorm.DB) error {
+			now := time.Now()
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("token_hash = ? AND confirmed_at IS NULL AND expires_at > ?", crypto.HashToken(req.Token), now).
+				First(&change).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return errEmailChangeInvalid
+				}
+				return err
+			}
+			if err := tx.First(&user, change.UserID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return errEmailChangeInvalid
+				}
+				return err
+			}
+			// The address moved some other way since the change was asked for.
+			if user.Email != change.OldEmail {
+				return errEmailChangeInvalid
+			}
+			if taken, err := emailTaken(tx, change.NewEmail, user.ID); err != nil {
+				return err
+			} else if taken {
+				return errEmailTaken
+			}
+
+			if err := tx.Model(&user).Updates(map[string]interface{}{"email": change.NewEmail, "is_verified": true}).Error; err != nil {
+				return err
+			}
+			undoHash := crypto.HashToken(undoToken)
+			undoExpires := now.Add(emailChangeUndoTTL)
+			return tx.Model(&change).Updates(map[string]interface{}{
+				"confirmed_at":    now,
+				"undo_token_hash": undoHash,
+				"undo_expires_at": undoExpires,
+			}).Error
+		})
+		switch {
+		case errors.Is(err, errEmailChangeInvalid):
+			return errorResponse(c, fiber.StatusBadRequest, apierror.CodeInvalidToken, i18n.T(c, "error.email_change_token_invalid"))
+		case errors.Is(err, errEmailTaken):
+			return errorResponse(c, fiber.StatusConflict, apierror.CodeEmailTaken, i18n.T(c, "error.email_registered"))
+		case err != nil:
+			middleware.Log(c).Error("failed to confirm email change", "error", err)
+			return internalError(c, "error.change_email_failed")
+		}
+
+		params := i18n.Params{
+			"old_email": change.OldEmail,
+			"new_email": change.NewEmail,
+			"link":      h.cfg.AppURL + "/undo-email-change?token=" + url.QueryEscape(undoToken),
+			"hours":     int(emailChangeUndoTTL.Hours()),
+		}
+		// The change is made either way; without this mail the old address
+		// just can't undo it.
+		if err := mail.Send(c.UserContext(), mail.Message{
+			To:      change.OldEmail,
+			Subject: i18n.T(c, "email.email_changed.subject"),
+			Body:    i18n.T(c, "email.email_changed.body", params),
+		}); err != nil {
+			middleware.Log(c).Error("failed to notify old address of email change", "error", err)
+		}
+
+		audit.RecordAs(c, &user.ID, models.AuditEmailChange, audit.User(user.ID), fiber.Map{
+			"from": change.OldEmail,
+			"to":   change.NewEmail,
+		})
+
+		user.Email = change.NewEmail
+		user.IsVerified = true
+		return c.JSON(fiber.Map{
+			"message": i18n.T(c, "message.email_changed"),
+			"user":    user.ToResponse(),
+		})
+	}
+}
+
+// UndoEmailChange puts the old address back with the token mailed to it.
+// Someone who didn't make the change may hold a session, so every session
+// is ended too.
+func (h *Handlers) UndoEmailChange() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.EmailChangeTokenRequest
+		if apiErr := bindJSON(c, &req); apiErr != nil {
+			return apierror.Respond(c, apiErr)
+		}
+
+		if errs := middleware.ValidateRequest(c, &req); len(errs) > 0 {
+			return validationFailed(c, errs)
+		}
+
+		var change models.EmailChange
+		var sessionIDs []string
+		err := requestDB(c, h.db).Transaction(func(tx *gorm.DB) error {
+			now := time.Now()
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("undo_token_hash = ? AND undone_at IS NULL AND undo_expires_at > ?", crypto.HashToken(req.Token), now).
+				First(&change).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return errEmailChangeInvalid
+				}
+				return err
+			}
+			var user models.User
+			if err := tx.First(&user, change.UserID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return errEmailChangeInvalid
+				}
+				return err
+			}
+			if user.Email != change.NewEmail {
+				return errEmailChangeInvalid
+			}
+			if taken, err := emailTaken(tx, change.OldEmail, user.ID); err != nil {
+				return err
+			} else if taken {
+				return errEmailTaken
+			}
+
+			if err := tx.Model(&user).Update("email", change.OldEmail).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&change).Update("undone_at", now).Error; err != nil {
+				return err
+			}
+			var err error
+			sessionIDs, err = session.RevokeUser(tx, user.ID)
+			return err
+		})
+		switch {
+		case errors.Is(err, errEmailChangeInvalid):
+			return errorResponse(c, fiber.StatusBadRequest, apierror.CodeInvalidToken, i18n.T(c, "error.email_change_token_invalid"))
+		case errors.Is(err, errEmailTaken):
+			return errorResponse(c, fiber.StatusConflict, apierror.CodeEmailTaken, i18n.T(c, "error.email_registered"))
+		case err != nil:
+			middleware.Log(c).Error("failed to undo email change", "error", err)
+			return internalError(c, "error.change_email_failed")
+		}
+		h.endSessions(c, sessionIDs...)
+
+		audit.RecordAs(c, nil, models.AuditEmailChangeUndo, audit.User(change.UserID), fiber.Map{
+			"from":     change.NewEmail,
+			"to":       change.OldEmail,
+			"sessions": len(sessionIDs),
+		})
+
+		return c.JSON(fiber.Map{
+			"message": i18n.T(c, "message.email_change_undone"),
+		})
+	}
+}
+
+// emailTaken reports whether an account other than userID uses email, in
+// any letter case. Deleted accounts count: their rows still hold the
+// address until they are purged.
+func emailTaken(db *gorm.DB, email string, userID uint) (bool, error) {
+	var n int64
+	err := db.Unscoped().Model(&models.User{}).
+		Where("LOWER(email) = LOWER(?) AND id <> ?", email, userID).Count(&n).Error
+	return n > 0, err
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/audit"
+	"github.com/zesbe/lumina-ai/internal/crypto"
+	"github.com/zesbe/lumina-ai/internal/i18n"
+	"github.com/zesbe/lumina-ai/internal/logger"
+	"github.com/zesbe/lumina-ai/internal/mail"
+	"github.com/zesbe/lumina-ai/internal/middleware"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+// emailVerificationTTL is how long a mailed verification link works.
+const emailVerificationTTL = 24 * time.Hour
+
+var errEmailVerificationInvalid = errors.New("email verification invalid")
+
+// sendVerification stores a verification token for user and mails the
+// link to their address in the background.
+func (h *Handlers) sendVerification(c *fiber.Ctx, user *models.User) error {
+	token, err := crypto.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+	if err := requestDB(c, h.db).Create(&models.EmailVerification{
+		UserID:    user.ID,
+		TokenHash: crypto.HashToken(token),
+		ExpiresAt: time.Now().Add(emailVerificationTTL),
+	}).Error; err != nil {
+		return err
+	}
+
+	msg := mail.Message{
+		To:      user.Email,
+		Subject: i18n.T(c, "email.verify_email.subject"),
+		Body: i18n.T(c, "email.verify_email.body", i18n.Params{
+			"link":  h.cfg.AppURL + "/verify-email?token=" + url.QueryEscape(token),
+			"hours": int(emailVerificationTTL.Hours()),
+		}),
+	}
+	userID := user.ID
+	go func() {
+		ctx, cancel := context.WithTimeout(h.jobs.ctx, 30*time.Second)
+		defer cancel()
+		if err := mail.Send(ctx, msg); err != nil {
+			logger.L().Error("failed to send verification email", "user_id", userID, "error", err)
+		}
+	}()
+	return nil
+}
+
+// emailNotVerified is the 403 for generating before the account's address
+// is verified.
+func emailNotVerified(c *fiber.Ctx) error {
+	return errorResponse(c, fiber.StatusForbidden, apierror.CodeEmailNotVerified, i18n.T(c, "error.email_not_verified"))
+}
+
+// VerifyEmail consumes the token from a verification mail and marks its
+// account's address verified. Any other link still out for the account
+// is used up with it.
+func (h *Handlers) VerifyEmail() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.VerifyEmailRequest
+		if apiErr := bindJSON(c, &req); apiErr != nil {
+			return apierror.Respond(c, apiErr)
+		}
+
+		if errs := middleware.ValidateRequest(c, &req); len(errs) > 0 {
+			return validationFailed(c, errs)
+		}
+
+		var verification models.EmailVerification
+		err := requestDB(c, h.db).Transaction(func(tx *gorm.DB) error {
+			now := time.Now()
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("token_hash = ? AND consumed_at IS NULL AND expires_at > ?", crypto.HashToken(req.Token), now).
+				First(&verification).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return errEmailVerificationInvalid
+				}
+				return err
+			}
+			if err := tx.Model(&models.EmailVerification{}).Where("user_id = ? AND consumed_at IS NULL", verification.UserID).
+				Update("consumed_at", now).Error; err != nil {
+				return err
+			}
+			res := tx.Model(&models.User{}).Where("id = ?", verification.UserID).Update("is_verified", true)
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				return errEmailVerificationInvalid
+			}
+			return nil
+		})
+		switch {
+		case errors.Is(err, errEmailVerificationInvalid):
+			return errorResponse(c, fiber.StatusBadRequest, apierror.CodeInvalidToken, i18n.T(c, "error.verification_link_invalid"))
+		case err != nil:
+			middleware.Log(c).Error("failed to verify email", "error", err)
+			return internalError(c, "error.email_verification_failed")
+		}
+
+		audit.RecordAs(c, &verification.UserID, models.AuditEmailVerified, audit.User(verification.UserID), nil)
+
+		return c.JSON(fiber.Map{
+			"message": i18n.T(c, "message.email_verified"),
+		})
+	}
+}
+
+// ResendVerification mails a new verification link to an account whose
+// address isn't verified yet. Like RequestMagicLink, the answer is the
+// same whether or not anything was sent.
+func (h *Handlers) ResendVerification() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.ResendVerificationRequest
+		if apiErr := bindJSON(c, &req); apiErr != nil {
+			return apierror.Respond(c, apiErr)
+		}
+
+		if errs := middleware.ValidateRequest(c, &req); len(errs) > 0 {
+			return validationFailed(c, errs)
+		}
+		email := models.NormalizeEmail(req.Email)
+
+		sent := fiber.Map{"message": i18n.T(c, "message.verification_sent", i18n.Params{"email": email})}
+
+		var user models.User
+		err := requestDB(c, h.db).Where("LOWER(email) = LOWER(?) AND email_conflict_with IS NULL", email).First(&user).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return c.JSON(sent)
+		case err != nil:
+			return internalError(c, "error.email_verification_failed")
+		}
+		if !user.IsActive || user.IsVerified {
+			return c.JSON(sent)
+		}
+
+		if err := h.sendVerification(c, &user); err != nil {
+			middleware.Log(c).Error("failed to store email verification", "error", err)
+			return internalError(c, "error.email_verification_failed")
+		}
+		return c.JSON(sent)
+	}
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/i18n"
+	"github.com/zesbe/lumina-ai/internal/middleware"
+)
+
+// Handlers answer every error through these, never with a fiber.Map of
+// their own, so each response carries a code and a request ID.
+
+// errorResponse writes an error with an already localized message.
+func errorResponse(c *fiber.Ctx, status int, code apierror.Code, message string) error {
+	return apierror.Respond(c, apierror.New(status, code, message))
+}
+
+// badRequest is a 400 with the message under key.
+func badRequest(c *fiber.Ctx, key string) error {
+	return errorResponse(c, fiber.StatusBadRequest, apierror.CodeBadRequest, i18n.T(c, key))
+}
+
+func invalidBody(c *fiber.Ctx) error {
+	return badRequest(c, "error.invalid_request_body")
+}
+
+func validationFailed(c *fiber.Ctx, errs []middleware.ValidationError) error {
+	return apierror.Respond(c, apierror.New(fiber.StatusBadRequest, apierror.CodeValidationFailed,
+		i18n.T(c, "error.validation_failed")).WithDetails(errs))
+}
+
+func notFound(c *fiber.Ctx, key string) error {
+	return errorResponse(c, fiber.StatusNotFound, apierror.CodeNotFound, i18n.T(c, key))
+}
+
+func conflict(c *fiber.Ctx, key string) error {
+	return errorResponse(c, fiber.StatusConflict, apierror.CodeConflict, i18n.T(c, key))
+}
+
+// internalError is a 500 with the message under key. The cause stays in
+// the logs; it is never sent to the client.
+func internalError(c *fiber.Ctx, key string) error {
+	return errorResponse(c, fiber.StatusInternalServerError, apierror.CodeInternal, i18n.T(c, key))
+}
+
+// bindQuery parses the query string into out and checks its validate
+// tags. Values that don't parse (page=abc) are field errors like any
+// other rule, never quietly replaced by a default.
+func bindQuery(c *fiber.Ctx, out interface{}) []middleware.ValidationError {
+	v := middleware.NewLocalizedValidator(i18n.Locale(c))
+	if err := c.QueryParser(out); err != nil {
+		var multi fiber.MultiError
+		if !errors.As(err, &multi) {
+			v.AddRuleError("query", "invalid", nil)
+			return v.Errors()
+		}
+		fields := make([]string, 0, len(multi))
+		for field := range multi {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			v.AddRuleError(field, "invalid", nil)
+		}
+		return v.Errors()
+	}
+	return v.Struct(out).Errors()
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestNoBareErrorMaps fails on any handler or middleware that answers
+// with c.JSON(fiber.Map{"error": ...}) instead of going through
+// errorResponse or apierror, which add the code and the request ID.
+func TestNoBareErrorMaps(t *testing.T) {
+	for _, dir := range []string{".", "../middleware"} {
+		files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, path := range files {
+			if strings.HasSuffix(path, "_test.go") {
+				continue
+			}
+			src, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fset := token.NewFileSet()
+			file, err := parser.ParseFile(fset, path, src, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ast.Inspect(file, func(n ast.Node) bool {
+				call, ok := n.(*ast.CallExpr)
+				if !ok {
+					return true
+				}
+				if sel, ok := call.Fun.(*ast.SelectorExpr); !ok || sel.Sel.Name != "JSON" {
+					return true
+				}
+				for _, arg := range call.Args {
+					if lit, ok := arg.(*ast.CompositeLit); ok && isFiberMap(lit.Type) && hasErrorKey(lit) {
+						t.Errorf("%s: JSON with a bare fiber.Map{\"error\": ...}; use errorResponse or apierror.Respond", fset.Position(lit.Pos()))
+					}
+				}
+				return true
+			})
+		}
+	}
+}
+
+func isFiberMap(expr ast.Expr) bool {
+	sel, ok := expr.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Map" {
+		return false
+	}
+	pkg, ok := sel.X.(*ast.Ident)
+	return ok && pkg.Name == "fiber"
+}
+
+func hasErrorKey(lit *ast.CompositeLit) bool {
+	for _, elt := range lit.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			continue
+		}
+		if key, ok := kv.Key.(*ast.BasicLit); ok && key.Kind == token.STRING {
+			if s, err := strconv.Unquote(key.Value); err == nil && s == "error" {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/zesbe/lumina-ai/internal/i18n"
+	"github.com/zesbe/lumina-ai/internal/middleware"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+// fieldSet is the fields a list endpoint lets clients pick with ?fields=,
+// and the ones ?view=compact stands for.
+type fieldSet struct {
+	allowed []string
+	compact []string
+}
+
+var (
+	generationFields = fieldSet{
+		allowed: jsonFields(reflect.TypeOf(models.GenerationResponse{})),
+		compact: []string{"id", "type", "title", "status", "thumbnail_url", "output_url", "aspect_ratio", "created_at"},
+	}
+	publicGenerationFields = fieldSet{
+		allowed: jsonFields(reflect.TypeOf(models.GenerationPublicResponse{})),
+		compact: []string{"id", "type", "title", "thumbnail_url", "output_url", "aspect_ratio", "created_at", "creator_name"},
+	}
+)
+
+// selectedFields reads ?fields= (or ?view=compact) against set. It returns
+// the fields sorted and without duplicates, or nil for the full shape.
+// Unknown fields fail validation, so a typo doesn't silently return
+// nothing.
+func selectedFields(c *fiber.Ctx, set fieldSet) ([]string, *middleware.Validator) {
+	v := middleware.NewLocalizedValidator(i18n.Locale(c))
+
+	raw := strings.TrimSpace(c.Query("fields"))
+	if raw == "" {
+		switch c.Query("view") {
+		case "", "full":
+			return nil, v
+		case "compact":
+			raw = strings.Join(set.compact, ",")
+		default:
+			v.AddRuleError("view", "one_of", i18n.Params{"options": "full, compact"})
+			return nil, v
+		}
+	}
+
+	seen := map[string]bool{}
+	var fields, unknown []string
+	for _, f := range strings.Split(raw, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" || seen[f] {
+			continue
+		}
+		seen[f] = true
+		if !slices.Contains(set.allowed, f) {
+			unknown = append(unknown, f)
+			continue
+		}
+		fields = append(fields, f)
+	}
+	if len(unknown) > 0 {
+		v.AddRuleError("fields", "unknown_fields", i18n.Params{
+			"unknown": strings.Join(unknown, ", "),
+			"options": strings.Join(set.allowed, ", "),
+		})
+		return nil, v
+	}
+	sort.Strings(fields)
+	return fields, v
+}
+
+// jsonFields lists the JSON names of t's fields.
+func jsonFields(t reflect.Type) []string {
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// project serializes each item and keeps only fields. The database query
+// and the response types are untouched; this only trims what is sent.
+// Fields an item omits (omitempty) stay omitted.
+func project[T any](items []T, fields []string) ([]map[string]json.RawMessage, error) {
+	out := make([]map[string]json.RawMessage, len(items))
+	for i, item := range items {
+		b, err := json.Marshal(item)
+		if err != nil {
+			return nil, err
+		}
+		var full map[string]json.RawMessage
+		if err := json.Unmarshal(b, &full); err != nil {
+			return nil, err
+		}
+		trimmed := make(map[string]json.RawMessage, len(fields))
+		for _, f := range fields {
+			if value, ok := full[f]; ok {
+				trimmed[f] = value
+			}
+		}
+		out[i] = trimmed
+	}
+	return out, nil
+}
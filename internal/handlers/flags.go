@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/audit"
+	"github.com/zesbe/lumina-ai/internal/flags"
+	"github.com/zesbe/lumina-ai/internal/i18n"
+	"github.com/zesbe/lumina-ai/internal/middleware"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+var flagKeyPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,99}$`)
+
+var (
+	flagPlans = []string{string(models.PlanFree), string(models.PlanBasic), string(models.PlanPro), string(models.PlanEnterprise)}
+	flagRoles = []string{"user", "admin"}
+)
+
+// GetFlags returns every flag evaluated for the current user so the
+// frontend can gate UI the same way the API gates behavior.
+func (h *Handlers) GetFlags() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{
+			"flags": flags.Evaluate(c.UserContext(), flags.FromRequest(c)),
+		})
+	}
+}
+
+func (h *Handlers) ListFeatureFlags() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var records []models.FeatureFlag
+		if err := requestDB(c, h.db).Preload("Overrides").Order("key").Find(&records).Error; err != nil {
+			return internalError(c, "error.fetch_flags_failed")
+		}
+
+		responses := make([]models.FeatureFlagResponse, len(records))
+		for i := range records {
+			responses[i] = records[i].ToResponse()
+		}
+
+		return c.JSON(fiber.Map{
+			"flags": responses,
+		})
+	}
+}
+
+// UpsertFeatureFlag creates or replaces the flag named by :key.
+func (h *Handlers) UpsertFeatureFlag() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := c.Params("key")
+
+		var req models.UpsertFeatureFlagRequest
+		if apiErr := bindJSON(c, &req); apiErr != nil {
+			return apierror.Respond(c, apiErr)
+		}
+
+		rollout := 100
+		if req.RolloutPercentage != nil {
+			rollout = *req.RolloutPercentage
+		}
+
+		v := middleware.NewLocalizedValidator(i18n.Locale(c)).Struct(&req)
+		if !flagKeyPattern.MatchString(key) {
+			v.AddRuleError("key", "invalid", nil)
+		}
+		if rollout < 0 || rollout > 100 {
+			v.AddRuleError("rollout_percentage", "max_value", i18n.Params{"max": 100})
+		}
+		for _, plan := range req.Plans {
+			v.OneOf("plans", plan, flagPlans)
+		}
+		for _, role := range req.Roles {
+			v.OneOf("roles", role, flagRoles)
+		}
+		if v.HasErrors() {
+			return validationFailed(c, v.Errors())
+		}
+
+		flag := models.FeatureFlag{
+			Key:               key,
+			Description:       req.Description,
+			Enabled:           req.Enabled,
+			RolloutPercentage: rollout,
+			Plans:             strings.Join(req.Plans, ","),
+			Roles:             strings.Join(req.Roles, ","),
+		}
+		if err := requestDB(c, h.db).Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "key"}},
+			DoUpdates: clause.AssignmentColumns([]string{"description", "enabled", "rollout_percentage", "plans", "roles", "updated_at"}),
+		}).Create(&flag).Error; err != nil {
+			return internalError(c, "error.save_flag_failed")
+		}
+
+		requestDB(c, h.db).Preload("Overrides").Where("key = ?", key).First(&flag)
+		flags.Invalidate()
+
+		audit.Record(c, models.AuditFeatureFlagChange, audit.Target{Type: "feature_flag", ID: key}, fiber.Map{
+			"op":                 "upsert",
+			"enabled":            flag.Enabled,
+			"rollout_percentage": flag.RolloutPercentage,
+			"plans":              req.Plans,
+			"roles":              req.Roles,
+		})
+
+		return c.JSON(fiber.Map{
+			"flag": flag.ToResponse(),
+		})
+	}
+}
+
+func (h *Handlers) DeleteFeatureFlag() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := c.Params("key")
+
+		result := requestDB(c, h.db).Where("key = ?", key).Delete(&models.FeatureFlag{})
+		if result.Error != nil {
+			return internalError(c, "error.save_flag_failed")
+		}
+		if result.RowsAffected == 0 {
+			return notFound(c, "error.flag_not_found")
+		}
+
+		flags.Invalidate()
+		audit.Record(c, models.AuditFeatureFlagChange, audit.Target{Type: "feature_flag", ID: key}, fiber.Map{"op": "delete"})
+
+		return c.JSON(fiber.Map{
+			"message": i18n.T(c, "message.flag_deleted"),
+		})
+	}
+}
+
+// SetFeatureFlagOverride forces a flag on or off for one user.
+func (h *Handlers) SetFeatureFlagOverride() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		flag, userID, err := findFlagAndUser(c, h.db)
+		if flag == nil {
+			return err
+		}
+
+		var req models.FeatureFlagOverrideRequest
+		if apiErr := bindJSON(c, &req); apiErr != nil {
+			return apierror.Respond(c, apiErr)
+		}
+
+		override := models.FeatureFlagOverride{FlagID: flag.ID, UserID: userID, Enabled: req.Enabled}
+		if err := requestDB(c, h.db).Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "flag_id"}, {Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"enabled"}),
+		}).Create(&override).Error; err != nil {
+			return internalError(c, "error.save_flag_failed")
+		}
+
+		flags.Invalidate()
+		audit.Record(c, models.AuditFeatureFlagChange, audit.Target{Type: "feature_flag", ID: flag.Key}, fiber.Map{
+			"op":      "override",
+			"user_id": userID,
+			"enabled": req.Enabled,
+		})
+
+		return c.JSON(fiber.Map{
+			"override": models.FeatureFlagOverrideResponse{UserID: userID, Enabled: req.Enabled},
+		})
+	}
+}
+
+func (h *Handlers) DeleteFeatureFlagOverride() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		flag, userID, err := findFlagAndUser(c, h.db)
+		if flag == nil {
+			return err
+		}
+
+		if err := requestDB(c, h.db).Where("flag_id = ? AND user_id = ?", flag.ID, userID).Delete(&models.FeatureFlagOverride{}).Error; err != nil {
+			return internalError(c, "error.save_flag_failed")
+		}
+
+		flags.Invalidate()
+		audit.Record(c, models.AuditFeatureFlagChange, audit.Target{Type: "feature_flag", ID: flag.Key}, fiber.Map{
+			"op":      "remove_override",
+			"user_id": userID,
+		})
+
+		return c.JSON(fiber.Map{
+			"message": i18n.T(c, "message.flag_override_removed"),
+		})
+	}
+}
+
+// findFlagAndUser resolves :key and :userId, writing the error response
+// itself and returning a nil flag when either is invalid.
+func findFlagAndUser(c *fiber.Ctx, db *gorm.DB) (*models.FeatureFlag, uint, error) {
+	userID, err := strconv.ParseUint(c.Params("userId"), 10, 32)
+	if err != nil {
+		return nil, 0, badRequest(c, "error.invalid_user_id")
+	}
+
+	var flag models.FeatureFlag
+	if err := requestDB(c, db).Where("key = ?", c.Params("key")).First(&flag).Error; err != nil {
+		return nil, 0, notFound(c, "error.flag_not_found")
+	}
+	return &flag, uint(userID), nil
+}
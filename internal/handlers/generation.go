@@ -1,45 +1,59 @@
 package handlers
 
 import (
-	"encoding/hex"
+	"context"
+	"encoding/json"
 	"fmt"
-	"log"
-	"os"
-	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/zesbe/lumina-ai/internal/cache"
 	"github.com/gofiber/websocket/v2"
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/cache"
 	"gorm.io/gorm"
 
+	"github.com/zesbe/lumina-ai/internal/audit"
+	"github.com/zesbe/lumina-ai/internal/auth"
 	"github.com/zesbe/lumina-ai/internal/config"
+	"github.com/zesbe/lumina-ai/internal/database"
+	"github.com/zesbe/lumina-ai/internal/i18n"
 	"github.com/zesbe/lumina-ai/internal/middleware"
 	"github.com/zesbe/lumina-ai/internal/models"
+	"github.com/zesbe/lumina-ai/internal/moderation"
 	"github.com/zesbe/lumina-ai/internal/services"
+	"github.com/zesbe/lumina-ai/internal/session"
+	"github.com/zesbe/lumina-ai/internal/settings"
 )
 
+// revokedSweepInterval is how often open sockets are checked against the
+// session denylist, to catch sessions logged out on another instance.
+const revokedSweepInterval = 30 * time.Second
+
 type WSClient struct {
-	Conn   *websocket.Conn
-	UserID uint
+	Conn      *websocket.Conn
+	UserID    uint
+	SessionID string
 }
 
 type WSHub struct {
-	clients map[*websocket.Conn]*WSClient
-	mu      sync.RWMutex
+	clients   map[*websocket.Conn]*WSClient
+	mu        sync.RWMutex
+	sweepOnce sync.Once
 }
 
-var hub = &WSHub{
-	clients: make(map[*websocket.Conn]*WSClient),
+// NewHub returns a hub with no connections.
+func NewHub() *WSHub {
+	return &WSHub{clients: make(map[*websocket.Conn]*WSClient)}
 }
 
-func (h *WSHub) Register(conn *websocket.Conn, userID uint) {
+func (h *WSHub) Register(conn *websocket.Conn, userID uint, sessionID string) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
-	h.clients[conn] = &WSClient{Conn: conn, UserID: userID}
+	h.clients[conn] = &WSClient{Conn: conn, UserID: userID, SessionID: sessionID}
 }
 
 func (h *WSHub) Unregister(conn *websocket.Conn) {
@@ -58,11 +72,92 @@ func (h *WSHub) SendToUser(userID uint, message interface{}) {
 	}
 }
 
-func WebSocketHandler() fiber.Handler {
+// Connected reports whether the user has a connection open on this
+// instance.
+func (h *WSHub) Connected(userID uint) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, client := range h.clients {
+		if client.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// Count returns the number of open connections.
+func (h *WSHub) Count() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.clients)
+}
+
+// CloseAll closes every connection with a going-away close frame carrying
+// reason, so clients know to reconnect elsewhere.
+func (h *WSHub) CloseAll(reason string) {
+	h.closeWhere(websocket.CloseGoingAway, reason, func(*WSClient) bool { return true })
+}
+
+// CloseSessions closes the connections opened with a token of one of the
+// sessions, with a policy-violation close frame carrying reason.
+func (h *WSHub) CloseSessions(reason string, sessionIDs ...string) {
+	h.closeWhere(websocket.ClosePolicyViolation, reason, func(client *WSClient) bool {
+		return client.SessionID != "" && slices.Contains(sessionIDs, client.SessionID)
+	})
+}
+
+func (h *WSHub) closeWhere(code int, reason string, match func(*WSClient) bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	msg := websocket.FormatCloseMessage(code, reason)
+	for conn, client := range h.clients {
+		if !match(client) {
+			continue
+		}
+		conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+		conn.Close()
+		delete(h.clients, conn)
+	}
+}
+
+// sweepRevoked closes connections whose session was logged out elsewhere.
+// Logging out on this instance closes them straight away.
+func (h *WSHub) sweepRevoked() {
+	ticker := time.NewTicker(revokedSweepInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		h.mu.RLock()
+		sessionIDs := map[string]bool{}
+		for _, client := range h.clients {
+			if client.SessionID != "" {
+				sessionIDs[client.SessionID] = true
+			}
+		}
+		h.mu.RUnlock()
+
+		var revoked []string
+		for id := range sessionIDs {
+			if denied, err := session.Denied(context.Background(), id); err == nil && denied {
+				revoked = append(revoked, id)
+			}
+		}
+		if len(revoked) > 0 {
+			h.CloseSessions("session_revoked", revoked...)
+		}
+	}
+}
+
+func (h *Handlers) WebSocketHandler() fiber.Handler {
 	return websocket.New(func(c *websocket.Conn) {
+		h.hub.sweepOnce.Do(func() { go h.hub.sweepRevoked() })
+
 		userID := c.Locals("userID").(uint)
-		hub.Register(c, userID)
-		defer hub.Unregister(c)
+		var sessionID string
+		if claims, ok := c.Locals("claims").(*auth.Claims); ok {
+			sessionID = claims.SessionID
+		}
+		h.hub.Register(c, userID, sessionID)
+		defer h.hub.Unregister(c)
 
 		for {
 			_, _, err := c.ReadMessage()
@@ -73,59 +168,111 @@ func WebSocketHandler() fiber.Handler {
 	})
 }
 
-func WebSocketUpgrade() fiber.Handler {
+func (h *Handlers) WebSocketUpgrade() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		if websocket.IsWebSocketUpgrade(c) {
+			// Connections made now would only be closed again by Drain.
+			if h.jobs.closing() {
+				return errorResponse(c, fiber.StatusServiceUnavailable, apierror.CodeShuttingDown, i18n.T(c, "error.shutting_down"))
+			}
 			return c.Next()
 		}
 		return fiber.ErrUpgradeRequired
 	}
 }
 
-func GenerateMusic(db *gorm.DB, cfg *config.Config) fiber.Handler {
-	minimax := services.NewMiniMaxService(cfg.MiniMaxAPIKey, cfg.MiniMaxGroupID)
-
+func (h *Handlers) GenerateMusic() fiber.Handler {
 	return func(c *fiber.Ctx) error {
+		if !h.cfg.DemoMode && !h.minimax.IsConfigured() {
+			return errorResponse(c, fiber.StatusServiceUnavailable, apierror.CodeProviderUnavailable, i18n.T(c, "error.provider_not_configured"))
+		}
+
 		userID := c.Locals("userID").(uint)
+		requestID := middleware.GetRequestID(c)
+		locale := i18n.Locale(c)
 
 		var req models.GenerateMusicRequest
-		if err := c.BodyParser(&req); err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":   "Bad Request",
-				"message": "Invalid request body",
-			})
+		if apiErr := bindJSON(c, &req); apiErr != nil {
+			return apierror.Respond(c, apiErr)
 		}
-
-		v := middleware.NewValidator()
-		v.Required("prompt", req.Prompt).MinLength("prompt", req.Prompt, 10).NoXSS("prompt", req.Prompt)
-		v.Required("lyrics", req.Lyrics).MinLength("lyrics", req.Lyrics, 10).NoXSS("lyrics", req.Lyrics)
-		if req.Title != "" {
-			v.NoXSS("title", req.Title)
+		if req.SavedPromptID != 0 {
+			saved, err := savedPromptFor(c, h.db, userID, req.SavedPromptID, models.TypeMusic)
+			if saved == nil {
+				return err
+			}
+			req.UseSavedPrompt(saved)
+		}
+		var preset *models.StylePreset
+		if req.StyleID != 0 {
+			found, err := stylePresetFor(c, h.db, req.StyleID)
+			if found == nil {
+				return err
+			}
+			preset = found
+			bitrate := req.Bitrate
+			req.UseStylePreset(preset)
+			// A preset's bitrate is a suggestion; cap it to the plan rather
+			// than refuse a bitrate the caller never asked for.
+			if maxBitrate := h.cfg.CapabilitiesFor(callerPlan(c)).MaxMusicBitrate; bitrate == 0 && req.Bitrate > maxBitrate {
+				req.Bitrate = maxBitrate
+			}
 		}
-		if req.Style != "" {
-			v.NoXSS("style", req.Style)
+		if req.Model == "" {
+			req.Model = "music-2.0"
 		}
 
+		limits := textLimits(c, h.cfg)
+		v := middleware.NewLocalizedValidator(locale).Struct(&req).
+			MaxLength("prompt", req.Prompt, limits.Prompt).
+			MaxLength("lyrics", req.Lyrics, limits.Lyrics)
+		if spec, ok := services.MusicModelSpecs[req.Model]; ok && req.DurationSeconds != 0 {
+			if req.DurationSeconds < spec.MinDuration {
+				v.AddRuleError("duration_seconds", "min_value", i18n.Params{"min": spec.MinDuration})
+			} else if req.DurationSeconds > spec.MaxDuration {
+				v.AddRuleError("duration_seconds", "max_value", i18n.Params{"max": spec.MaxDuration})
+			}
+		}
+		required := musicRequirement(c, h.cfg, v, req.Model, req.Bitrate)
 		if v.HasErrors() {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":   "Validation Failed",
-				"details": v.Errors(),
-			})
+			return validationFailed(c, v.Errors())
+		}
+		if required != nil {
+			return planRequired(c, required)
+		}
+		// From here on the request carries what will be sent, so that
+		// leaving out a default and spelling it out hash the same.
+		req.SetDefaults()
+
+		ctx := c.UserContext()
+
+		if verdict := moderation.Check(ctx,
+			moderation.Field{Name: "title", Text: req.Title},
+			moderation.Field{Name: "prompt", Text: req.Prompt},
+			moderation.Field{Name: "lyrics", Text: req.Lyrics},
+			moderation.Field{Name: "style", Text: req.Style},
+		); verdict != nil {
+			return policyViolation(c, models.TypeMusic, verdict)
 		}
 
 		var user models.User
-		if err := db.First(&user, userID).Error; err != nil {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-				"error":   "Not Found",
-				"message": "User not found",
-			})
+		if err := h.db.WithContext(ctx).First(&user, userID).Error; err != nil {
+			return notFound(c, "error.user_not_found")
+		}
+		if !user.IsVerified {
+			return emailNotVerified(c)
 		}
 
-		if user.Credits < 1 {
-			return c.Status(fiber.StatusPaymentRequired).JSON(fiber.Map{
-				"error":   "Payment Required",
-				"message": "Insufficient credits. Please upgrade your plan.",
-			})
+		runtime := settings.Current()
+		if limit, reached := dailyLimitReached(c, h.db, &user, runtime); reached {
+			return dailyLimitResponse(c, limit)
+		}
+
+		creditCost := runtime.MusicCost(req.DurationSeconds)
+		if h.cfg.DemoMode {
+			creditCost = 0
+		}
+		if user.Credits < creditCost {
+			return errorResponse(c, fiber.StatusPaymentRequired, apierror.CodeInsufficientCredits, i18n.T(c, "error.insufficient_credits"))
 		}
 
 		generation := models.Generation{
@@ -136,248 +283,102 @@ func GenerateMusic(db *gorm.DB, cfg *config.Config) fiber.Handler {
 			Prompt:      middleware.SanitizeInput(req.Prompt),
 			Lyrics:      middleware.SanitizeInput(req.Lyrics),
 			Style:       middleware.SanitizeInput(req.Style),
-			CreditsCost: 1,
+			Model:       req.Model,
+			CreditsCost: creditCost,
+			IsDemo:      h.cfg.DemoMode,
+
+			RequestedDuration: req.DurationSeconds,
+		}
+		if preset != nil {
+			generation.StylePresetID = &preset.ID
 		}
+		generation.RequestHash = requestHash(models.TypeMusic, generation.Title, generation.Prompt, generation.Lyrics,
+			generation.Style, generation.StylePresetID, req.Model, req.Format, req.Bitrate, req.DurationSeconds,
+			req.Normalize == nil || *req.Normalize)
 
-		if err := db.Create(&generation).Error; err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error":   "Internal Server Error",
-				"message": "Failed to create generation",
-			})
+		existing, err := createGeneration(h.db.WithContext(ctx), h.cfg.DuplicateGenerationWindow, req.Force, &generation)
+		if err != nil {
+			return internalError(c, "error.create_generation_failed")
+		}
+		if existing != nil {
+			return duplicateGeneration(c, existing)
 		}
+		invalidateGenerations(h.cache, userID)
 
-		hub.SendToUser(userID, fiber.Map{
+		h.hub.SendToUser(userID, fiber.Map{
 			"type":       "generation_started",
-			"generation": generation.ToResponse(),
+			"generation": generation.ToResponse(middleware.GetBaseURL(c)),
+			"request_id": requestID,
 		})
 
-		if !minimax.IsConfigured() {
-			generation.Status = models.StatusCompleted
-			generation.OutputURL = "https://www.soundhelix.com/examples/mp3/SoundHelix-Song-1.mp3"
-			db.Save(&generation)
-			// Invalidate cache
-			if cache.Cache != nil {
-				cache.Cache.DeletePattern(fmt.Sprintf("generations:%d:*", userID))
+		if generation.IsDemo {
+			if _, err := services.FinalizeGeneration(h.db.WithContext(ctx), &generation, services.Outcome{
+				Status:    models.StatusCompleted,
+				OutputURL: "https://www.soundhelix.com/examples/mp3/SoundHelix-Song-1.mp3",
+			}); err != nil {
+				return internalError(c, "error.update_generation_failed")
 			}
+			invalidateGenerations(h.cache, userID)
 
-			hub.SendToUser(userID, fiber.Map{
+			h.hub.SendToUser(userID, fiber.Map{
 				"type":       "generation_completed",
-				"generation": generation.ToResponse(),
+				"generation": generation.ToResponse(middleware.GetBaseURL(c)),
+				"request_id": requestID,
 			})
 
 			return c.JSON(fiber.Map{
-				"message":    "Music generated (demo mode)",
-				"generation": generation.ToResponse(),
+				"message":    i18n.T(c, "message.music_demo"),
+				"generation": generation.ToResponse(middleware.GetBaseURL(c)),
 			})
 		}
 
-		go func() {
-			fullPrompt := req.Prompt
-			if req.Style != "" {
-				fullPrompt = req.Style + ", " + req.Prompt
-			}
-
-			log.Printf("[Music] Starting generation for user %d, generation %d", userID, generation.ID)
-
-			// Step 1: Generate music
-			hub.SendToUser(userID, fiber.Map{
-				"type":       "generation_progress",
-				"generation": generation.ToResponse(),
-				"message":    "Creating music...",
-				"step":       1,
-				"totalSteps": 2,
-			})
-
-			format := req.Format
-			if format == "" { format = "mp3" }
-			bitrate := req.Bitrate
-			if bitrate <= 0 { bitrate = 256000 }
-			model := req.Model
-			if model == "" { model = "music-2.0" }
-			resp, err := minimax.GenerateMusic(fullPrompt, req.Lyrics, format, model, bitrate)
-			if err != nil {
-				log.Printf("[Music] Generation failed: %v", err)
-				generation.Status = models.StatusFailed
-				generation.ErrorMessage = err.Error()
-				db.Save(&generation)
-			// Invalidate cache
-			if cache.Cache != nil {
-				cache.Cache.DeletePattern(fmt.Sprintf("generations:%d:*", userID))
-			}
-
-				hub.SendToUser(userID, fiber.Map{
-					"type":       "generation_failed",
-					"generation": generation.ToResponse(),
-					"error":      err.Error(),
-				})
-				return
-			}
-
-			var audioURL string
-			audioData := resp.Data.Audio
-
-			if audioData != "" {
-				if strings.HasPrefix(audioData, "http") {
-					audioURL = audioData
-				} else {
-					audioBytes, err := hex.DecodeString(audioData)
-					if err != nil {
-						log.Printf("[Music] Failed to decode audio: %v", err)
-						generation.Status = models.StatusFailed
-						generation.ErrorMessage = "Failed to decode audio data"
-						db.Save(&generation)
-			// Invalidate cache
-			if cache.Cache != nil {
-				cache.Cache.DeletePattern(fmt.Sprintf("generations:%d:*", userID))
-			}
-
-						hub.SendToUser(userID, fiber.Map{
-							"type":       "generation_failed",
-							"generation": generation.ToResponse(),
-							"error":      "Failed to decode audio data",
-						})
-						return
-					}
-
-					fileName := fmt.Sprintf("%d.mp3", generation.ID)
-					filePath := filepath.Join("uploads", "audio", fileName)
-
-					os.MkdirAll(filepath.Dir(filePath), 0755)
-
-					if err := os.WriteFile(filePath, audioBytes, 0644); err != nil {
-						log.Printf("[Music] Failed to save audio: %v", err)
-						generation.Status = models.StatusFailed
-						generation.ErrorMessage = "Failed to save audio file"
-						db.Save(&generation)
-			// Invalidate cache
-			if cache.Cache != nil {
-				cache.Cache.DeletePattern(fmt.Sprintf("generations:%d:*", userID))
-			}
-
-						hub.SendToUser(userID, fiber.Map{
-							"type":       "generation_failed",
-							"generation": generation.ToResponse(),
-							"error":      "Failed to save audio file",
-						})
-						return
-					}
-
-					audioURL = "/uploads/audio/" + fileName
-					log.Printf("[Music] Saved audio file: %s (size: %d bytes)", fileName, len(audioBytes))
-				}
-			}
-
-			generation.OutputURL = audioURL
-
-			// Step 2: Generate album art
-			hub.SendToUser(userID, fiber.Map{
-				"type":       "generation_progress",
-				"generation": generation.ToResponse(),
-				"message":    "Creating album art...",
-				"step":       2,
-				"totalSteps": 2,
-			})
-
-			// Create album art prompt from style/genre
-			artPrompt := fmt.Sprintf("Album cover art, %s music, %s, modern design, professional artwork, high quality, artistic, beautiful colors", 
-				req.Style, req.Title)
-			
-			albumArtURL, err := minimax.GenerateImage(artPrompt)
-			if err != nil {
-				log.Printf("[Music] Album art generation failed: %v", err)
-				// Use placeholder gradient based on genre
-				colors := []string{"6366f1", "8b5cf6", "ec4899", "f43f5e", "f97316", "eab308", "22c55e", "14b8a6", "06b6d4", "3b82f6"}
-				colorIdx := int(generation.ID) % len(colors)
-				generation.ThumbnailURL = fmt.Sprintf("https://placehold.co/400x400/%s/white?text=%s", colors[colorIdx], "♪")
-			} else {
-				generation.ThumbnailURL = albumArtURL
-				log.Printf("[Music] Album art generated: %s", albumArtURL)
-			}
-
-			generation.Status = models.StatusCompleted
-			generation.Metadata = string(resp.ExtraInfo)
-			db.Save(&generation)
-			// Invalidate cache
-			if cache.Cache != nil {
-				cache.Cache.DeletePattern(fmt.Sprintf("generations:%d:*", userID))
-			}
-
-			db.Model(&user).Update("credits", gorm.Expr("credits - ?", 1))
-
-			db.Create(&models.CreditTransaction{
-				UserID:        userID,
-				Amount:        -1,
-				Type:          "usage",
-				Description:   "Music generation",
-				GenerationID:  &generation.ID,
-				BalanceBefore: user.Credits,
-				BalanceAfter:  user.Credits - 1,
-			})
-
-			log.Printf("[Music] Generation completed: %d, URL: %s", generation.ID, audioURL)
-
-			hub.SendToUser(userID, fiber.Map{
-				"type":       "generation_completed",
-				"generation": generation.ToResponse(),
-				"audioUrl":   audioURL,
-			})
-		}()
+		job := h.newGenerationJob(c, generation)
+		go job.runMusic(req)
 
 		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
-			"message":    "Music generation started",
-			"generation": generation.ToResponse(),
+			"message":    i18n.T(c, "message.music_started"),
+			"generation": generation.ToResponse(middleware.GetBaseURL(c)),
 		})
 	}
 }
 
-func GenerateVideo(db *gorm.DB, cfg *config.Config) fiber.Handler {
-	minimax := services.NewMiniMaxService(cfg.MiniMaxAPIKey, cfg.MiniMaxGroupID)
-
+func (h *Handlers) GenerateVideo() fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		userID := c.Locals("userID").(uint)
-
-		var req models.GenerateVideoRequest
-		if err := c.BodyParser(&req); err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":   "Bad Request",
-				"message": "Invalid request body",
-			})
+		if !h.cfg.DemoMode && !h.minimax.IsConfigured() {
+			return errorResponse(c, fiber.StatusServiceUnavailable, apierror.CodeProviderUnavailable, i18n.T(c, "error.provider_not_configured"))
 		}
 
-		v := middleware.NewValidator()
-		v.Required("prompt", req.Prompt).MinLength("prompt", req.Prompt, 10).NoXSS("prompt", req.Prompt)
-		if req.Title != "" {
-			v.NoXSS("title", req.Title)
-		}
-		if req.Narration != "" {
-			v.NoXSS("narration", req.Narration)
-		}
+		userID := c.Locals("userID").(uint)
+		requestID := middleware.GetRequestID(c)
+		locale := i18n.Locale(c)
 
-		if v.HasErrors() {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":   "Validation Failed",
-				"details": v.Errors(),
-			})
+		var req models.GenerateVideoRequest
+		if apiErr := bindJSON(c, &req); apiErr != nil {
+			return apierror.Respond(c, apiErr)
 		}
-
-		var user models.User
-		if err := db.First(&user, userID).Error; err != nil {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-				"error":   "Not Found",
-				"message": "User not found",
-			})
+		if req.SavedPromptID != 0 {
+			saved, err := savedPromptFor(c, h.db, userID, req.SavedPromptID, models.TypeVideo)
+			if saved == nil {
+				return err
+			}
+			req.UseSavedPrompt(saved)
 		}
-
-		creditCost := 2
-		if req.Narration != "" {
-			creditCost = 3
+		var template *models.VideoTemplate
+		if req.TemplateID != 0 {
+			found, err := videoTemplateFor(c, h.db, &req)
+			if found == nil {
+				return err
+			}
+			template = found
+			req.UseVideoTemplate(template)
 		}
 
-		if user.Credits < creditCost {
-			return c.Status(fiber.StatusPaymentRequired).JSON(fiber.Map{
-				"error":   "Payment Required",
-				"message": "Insufficient credits. Please upgrade your plan.",
-			})
+		limits := textLimits(c, h.cfg)
+		v := middleware.NewLocalizedValidator(locale).Struct(&req).
+			MaxLength("prompt", req.Prompt, limits.Prompt).
+			MaxLength("narration", req.Narration, limits.Narration)
+		if template == nil && len(req.TemplateValues) > 0 {
+			v.AddRuleError("template_values", "invalid", nil)
 		}
 
 		model := req.Model
@@ -392,16 +393,69 @@ func GenerateVideo(db *gorm.DB, cfg *config.Config) fiber.Handler {
 		if resolution == "" {
 			resolution = "768P"
 		}
+		aspectRatio := req.AspectRatio
+		if aspectRatio == "" {
+			aspectRatio = services.DefaultAspectRatio
+		}
+		// A ratio no model renders already failed oneof.
+		if supported := services.ModelsWithAspectRatio(aspectRatio); len(supported) > 0 && !services.SupportsAspectRatio(model, aspectRatio) {
+			v.AddRuleError("aspect_ratio", "unsupported_by_model", i18n.Params{
+				"value": aspectRatio, "model": model, "models": strings.Join(supported, ", "),
+			})
+		}
+		required := videoRequirement(c, h.cfg, v, model, resolution, duration)
+		if v.HasErrors() {
+			return validationFailed(c, v.Errors())
+		}
+		if required != nil {
+			return planRequired(c, required)
+		}
+
+		ctx := c.UserContext()
+
+		if verdict := moderation.Check(ctx,
+			moderation.Field{Name: "title", Text: req.Title},
+			moderation.Field{Name: "prompt", Text: req.Prompt},
+			moderation.Field{Name: "narration", Text: req.Narration},
+		); verdict != nil {
+			return policyViolation(c, models.TypeVideo, verdict)
+		}
+
+		var user models.User
+		if err := h.db.WithContext(ctx).First(&user, userID).Error; err != nil {
+			return notFound(c, "error.user_not_found")
+		}
+		if !user.IsVerified {
+			return emailNotVerified(c)
+		}
+
+		runtime := settings.Current()
+		if limit, reached := dailyLimitReached(c, h.db, &user, runtime); reached {
+			return dailyLimitResponse(c, limit)
+		}
+
+		creditCost := runtime.VideoCreditCost
+		if req.Narration != "" {
+			creditCost = runtime.NarratedVideoCreditCost
+		}
+		if h.cfg.DemoMode {
+			creditCost = 0
+		}
+
+		if user.Credits < creditCost {
+			return errorResponse(c, fiber.StatusPaymentRequired, apierror.CodeInsufficientCredits, i18n.T(c, "error.insufficient_credits"))
+		}
 
 		if req.Narration != "" {
 			_, err := services.CalculateOptimalSpeed(req.Narration, duration)
 			if err == services.ErrNarrationTooLong {
 				wordCount := len(strings.Fields(req.Narration))
 				maxWords := int(float64(duration) * 2.5 * 1.3)
-				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-					"error":   "Narration Too Long",
-					"message": fmt.Sprintf("Narration has %d words, max ~%d words for %ds video.", wordCount, maxWords, duration),
-				})
+				return errorResponse(c, fiber.StatusBadRequest, apierror.CodeNarrationTooLong, i18n.T(c, "error.narration_too_long", i18n.Params{
+					"words":     wordCount,
+					"max_words": maxWords,
+					"duration":  duration,
+				}))
 			}
 		}
 
@@ -417,439 +471,621 @@ func GenerateVideo(db *gorm.DB, cfg *config.Config) fiber.Handler {
 			Resolution:  resolution,
 			Model:       model,
 			CreditsCost: creditCost,
+			IsDemo:      h.cfg.DemoMode,
+			AspectRatio: aspectRatio,
+		}
+		if template != nil {
+			generation.VideoTemplateID = &template.ID
 		}
+		generation.RequestHash = requestHash(models.TypeVideo, generation.Title, generation.Prompt, generation.Narration,
+			generation.VoiceID, generation.VideoTemplateID, model, duration, resolution, aspectRatio)
 
-		if err := db.Create(&generation).Error; err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error":   "Internal Server Error",
-				"message": "Failed to create generation",
-			})
+		existing, err := createGeneration(h.db.WithContext(ctx), h.cfg.DuplicateGenerationWindow, req.Force, &generation)
+		if err != nil {
+			return internalError(c, "error.create_generation_failed")
+		}
+		if existing != nil {
+			return duplicateGeneration(c, existing)
 		}
+		invalidateGenerations(h.cache, userID)
 
-		hub.SendToUser(userID, fiber.Map{
+		h.hub.SendToUser(userID, fiber.Map{
 			"type":       "generation_started",
-			"generation": generation.ToResponse(),
+			"generation": generation.ToResponse(middleware.GetBaseURL(c)),
+			"request_id": requestID,
 		})
 
-		if !minimax.IsConfigured() {
-			generation.Status = models.StatusCompleted
-			generation.OutputURL = "https://www.w3schools.com/html/mov_bbb.mp4"
-			db.Save(&generation)
-			// Invalidate cache
-			if cache.Cache != nil {
-				cache.Cache.DeletePattern(fmt.Sprintf("generations:%d:*", userID))
+		if generation.IsDemo {
+			if _, err := services.FinalizeGeneration(h.db.WithContext(ctx), &generation, services.Outcome{
+				Status:    models.StatusCompleted,
+				OutputURL: "https://www.w3schools.com/html/mov_bbb.mp4",
+			}); err != nil {
+				return internalError(c, "error.update_generation_failed")
 			}
+			invalidateGenerations(h.cache, userID)
 
-			hub.SendToUser(userID, fiber.Map{
+			h.hub.SendToUser(userID, fiber.Map{
 				"type":       "generation_completed",
-				"generation": generation.ToResponse(),
+				"generation": generation.ToResponse(middleware.GetBaseURL(c)),
+				"request_id": requestID,
 			})
 
 			return c.JSON(fiber.Map{
-				"message":    "Video generated (demo mode)",
-				"generation": generation.ToResponse(),
+				"message":    i18n.T(c, "message.video_demo"),
+				"generation": generation.ToResponse(middleware.GetBaseURL(c)),
 			})
 		}
 
-		go func() {
-			log.Printf("[Video] Starting generation for user %d, generation %d, model: %s", userID, generation.ID, model)
-
-			totalSteps := 2
-			if req.Narration != "" {
-				totalSteps = 3
-			}
-
-			hub.SendToUser(userID, fiber.Map{
-				"type":       "generation_progress",
-				"generation": generation.ToResponse(),
-				"message":    "Generating video...",
-				"step":       1,
-				"totalSteps": totalSteps,
-			})
-
-			resp, err := minimax.GenerateVideo(req.Prompt, duration, resolution, model)
-			if err != nil {
-				log.Printf("[Video] API call failed: %v", err)
-				generation.Status = models.StatusFailed
-				generation.ErrorMessage = err.Error()
-				db.Save(&generation)
-			// Invalidate cache
-			if cache.Cache != nil {
-				cache.Cache.DeletePattern(fmt.Sprintf("generations:%d:*", userID))
-			}
-
-				hub.SendToUser(userID, fiber.Map{
-					"type":       "generation_failed",
-					"generation": generation.ToResponse(),
-					"error":      err.Error(),
-				})
-				return
-			}
-
-			generation.MiniMaxJobID = resp.TaskID
-			db.Save(&generation)
-			// Invalidate cache
-			if cache.Cache != nil {
-				cache.Cache.DeletePattern(fmt.Sprintf("generations:%d:*", userID))
-			}
-
-			timeout := time.Duration(300) * time.Second
-			if model == "MiniMax-Hailuo-02" {
-				timeout = time.Duration(600) * time.Second
-			}
-
-			status, err := minimax.WaitForCompletion(resp.TaskID, timeout)
-			if err != nil {
-				log.Printf("[Video] Processing failed: %v", err)
-				generation.Status = models.StatusFailed
-				generation.ErrorMessage = err.Error()
-				db.Save(&generation)
-			// Invalidate cache
-			if cache.Cache != nil {
-				cache.Cache.DeletePattern(fmt.Sprintf("generations:%d:*", userID))
-			}
-
-				hub.SendToUser(userID, fiber.Map{
-					"type":       "generation_failed",
-					"generation": generation.ToResponse(),
-					"error":      err.Error(),
-				})
-				return
-			}
-
-			videoURL := status.File.DownloadURL
-			log.Printf("[Video] Video generated: %s", videoURL)
-
-			if req.Narration != "" {
-				hub.SendToUser(userID, fiber.Map{
-					"type":       "generation_progress",
-					"generation": generation.ToResponse(),
-					"message":    "Generating voiceover...",
-					"step":       2,
-					"totalSteps": 3,
-				})
-
-				optimalSpeed, _ := services.CalculateOptimalSpeed(req.Narration, duration)
-				if optimalSpeed < 1.0 {
-					optimalSpeed = 1.0
-				}
-
-				ttsResp, err := minimax.GenerateTTSWithSpeed(req.Narration, req.VoiceID, optimalSpeed)
-				if err != nil {
-					log.Printf("[Video] TTS failed: %v", err)
-					generation.ErrorMessage = "TTS failed: " + err.Error()
-				} else {
-					hub.SendToUser(userID, fiber.Map{
-						"type":       "generation_progress",
-						"generation": generation.ToResponse(),
-						"message":    "Combining video with voiceover...",
-						"step":       3,
-						"totalSteps": 3,
-					})
-
-					outputFileName := fmt.Sprintf("%d_with_audio.mp4", generation.ID)
-					outputPath := filepath.Join("uploads", "video", outputFileName)
-					os.MkdirAll(filepath.Dir(outputPath), 0755)
-
-					err = minimax.CombineVideoWithAudio(videoURL, ttsResp.Data.Audio, outputPath)
-					if err != nil {
-						log.Printf("[Video] Combine failed: %v", err)
-						generation.ErrorMessage = "Combine failed: " + err.Error()
-					} else {
-						videoURL = "/uploads/video/" + outputFileName
-					}
-				}
-			}
-
-			generation.Status = models.StatusCompleted
-			generation.OutputURL = videoURL
-			db.Save(&generation)
-			// Invalidate cache
-			if cache.Cache != nil {
-				cache.Cache.DeletePattern(fmt.Sprintf("generations:%d:*", userID))
-			}
-
-			db.Model(&user).Update("credits", gorm.Expr("credits - ?", creditCost))
-
-			db.Create(&models.CreditTransaction{
-				UserID:        userID,
-				Amount:        -creditCost,
-				Type:          "usage",
-				Description:   "Video generation",
-				GenerationID:  &generation.ID,
-				BalanceBefore: user.Credits,
-				BalanceAfter:  user.Credits - creditCost,
-			})
-
-			log.Printf("[Video] Generation completed: %d, URL: %s", generation.ID, videoURL)
-
-			hub.SendToUser(userID, fiber.Map{
-				"type":       "generation_completed",
-				"generation": generation.ToResponse(),
-				"videoUrl":   videoURL,
-			})
-		}()
+		job := h.newGenerationJob(c, generation)
+		go job.runVideo(req)
 
 		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
-			"message":    "Video generation started",
-			"generation": generation.ToResponse(),
+			"message":    i18n.T(c, "message.video_started"),
+			"generation": generation.ToResponse(middleware.GetBaseURL(c)),
 		})
 	}
 }
 
-func GetGenerations(db *gorm.DB) fiber.Handler {
+// policyViolation rejects a generate request that failed moderation. It
+// runs before anything is created or charged, and the attempt is audited
+// so admins can review it.
+func policyViolation(c *fiber.Ctx, genType models.GenerationType, verdict *moderation.Verdict) error {
+	audit.Record(c, models.AuditModerationBlocked, audit.Target{Type: "generation_request"}, fiber.Map{
+		"type":    genType,
+		"field":   verdict.Field,
+		"source":  verdict.Source,
+		"rule_id": verdict.RuleID,
+		"reason":  verdict.Reason,
+	})
+	middleware.Log(c).Info("generation request blocked by moderation", "field", verdict.Field, "source", verdict.Source, "rule_id", verdict.RuleID)
+
+	return apierror.Respond(c, apierror.New(fiber.StatusUnprocessableEntity, apierror.CodePolicyViolation,
+		i18n.T(c, "error.policy_violation")).With("field", verdict.Field))
+}
+
+// textLimits returns the prompt/lyrics/narration caps for the caller's
+// plan. Every path that accepts these fields must apply them so oversized
+// text can't reach storage, WebSocket events or the provider.
+func textLimits(c *fiber.Ctx, cfg *config.Config) config.TextLimits {
+	plan, _ := c.Locals("plan").(string)
+	return cfg.TextLimitsFor(plan)
+}
+
+func (h *Handlers) GetGenerations() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		userID := c.Locals("userID").(uint)
 
-		page, _ := strconv.Atoi(c.Query("page", "1"))
-		limit, _ := strconv.Atoi(c.Query("limit", "20"))
-		genType := c.Query("type")
-		status := c.Query("status")
-
-		if page < 1 {
-			page = 1
+		var req models.ListGenerationsRequest
+		if errs := bindQuery(c, &req); len(errs) > 0 {
+			return validationFailed(c, errs)
 		}
-		if limit < 1 || limit > 100 {
-			limit = 20
+		req.SetDefaults()
+
+		fields, v := selectedFields(c, generationFields)
+		if v.HasErrors() {
+			return validationFailed(c, v.Errors())
 		}
 
-		// Try cache first
-		cacheKey := fmt.Sprintf("generations:%d:%d:%d:%s:%s", userID, page, limit, genType, status)
-		if cache.Cache != nil {
-			var cachedResult fiber.Map
-			if err := cache.Cache.Get(cacheKey, &cachedResult); err == nil {
-				log.Println("[Cache HIT] GetGenerations for user:", userID)
-				return c.JSON(cachedResult)
+		filters := generationFilters(&req)
+
+		// Try cache first. The base is part of the key since, unless it is
+		// configured, requests through different hosts get different URLs.
+		base := middleware.GetBaseURL(c)
+		cacheKey := fmt.Sprintf("generations:%d:%d:%d:%s:%s:%s:%s", userID, req.Page, req.Limit, filters, req.Sort, strings.Join(fields, ","), base)
+		if h.cache != nil {
+			var cached struct {
+				Generations json.RawMessage `json:"generations"`
+				Pagination  pagination      `json:"pagination"`
+			}
+			if err := h.cache.Get(cacheKey, &cached); err == nil {
+				middleware.Log(c).Debug("generations cache hit", "key", cacheKey)
+				setPageLinks(c, cached.Pagination)
+				return c.JSON(cached)
 			}
 		}
 
+		page, limit := req.Page, req.Limit
 		offset := (page - 1) * limit
 
-		query := db.Where("user_id = ?", userID)
-
-		if genType != "" {
-			query = query.Where("type = ?", genType)
-		}
-		if status != "" {
-			query = query.Where("status = ?", status)
-		}
-
-		var total int64
-		query.Model(&models.Generation{}).Count(&total)
+		query := ownGenerationsQuery(requestDB(c, h.db), userID, &req)
+		total, _ := countGenerations(h.cache, query, generationsCountKey(userID, filters), 0)
 
 		var generations []models.Generation
-		if err := query.Order("created_at DESC").Offset(offset).Limit(limit).Find(&generations).Error; err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error":   "Internal Server Error",
-				"message": "Failed to fetch generations",
-			})
+		if err := query.Order(req.OrderBy()).Offset(offset).Limit(limit).Find(&generations).Error; err != nil {
+			return internalError(c, "error.fetch_generations_failed")
 		}
 
 		responses := make([]models.GenerationResponse, len(generations))
 		for i, g := range generations {
-			responses[i] = g.ToResponse()
+			responses[i] = g.ToResponse(base)
 		}
-
-		result := fiber.Map{
-			"generations": responses,
-			"pagination": fiber.Map{
-				"page":        page,
-				"limit":       limit,
-				"total":       total,
-				"total_pages": (total + int64(limit) - 1) / int64(limit),
-			},
+		list := newPage(responses, page, limit, total)
+		result := list.body("generations")
+		if fields != nil {
+			projected, err := project(responses, fields)
+			if err != nil {
+				return internalError(c, "error.fetch_generations_failed")
+			}
+			result = newPage(projected, page, limit, total).body("generations")
 		}
 
 		// Cache for 30 seconds
-		if cache.Cache != nil {
-			cache.Cache.Set(cacheKey, result, 30*time.Second)
-			log.Println("[Cache SET] GetGenerations for user:", userID)
+		if h.cache != nil {
+			h.cache.Set(cacheKey, result, 30*time.Second)
+			middleware.Log(c).Debug("generations cache set", "key", cacheKey)
 		}
 
+		setPageLinks(c, list.Pagination)
 		return c.JSON(result)
 	}
 }
 
-
-func GetGeneration(db *gorm.DB) fiber.Handler {
+func (h *Handlers) GetGeneration() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		userID := c.Locals("userID").(uint)
 		id, err := strconv.ParseUint(c.Params("id"), 10, 32)
 		if err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":   "Bad Request",
-				"message": "Invalid generation ID",
-			})
+			return badRequest(c, "error.invalid_generation_id")
 		}
 
 		var generation models.Generation
-		if err := db.Where("id = ? AND user_id = ?", id, userID).First(&generation).Error; err != nil {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-				"error":   "Not Found",
-				"message": "Generation not found",
-			})
+		if err := requestDB(c, h.db).Where("id = ? AND user_id = ?", id, userID).First(&generation).Error; err != nil {
+			return notFound(c, "error.generation_not_found")
 		}
 
 		return c.JSON(fiber.Map{
-			"generation": generation.ToResponse(),
+			"generation": generation.ToResponse(middleware.GetBaseURL(c)),
 		})
 	}
 }
 
-func DeleteGeneration(db *gorm.DB) fiber.Handler {
+func (h *Handlers) DeleteGeneration() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		userID := c.Locals("userID").(uint)
 		id, err := strconv.ParseUint(c.Params("id"), 10, 32)
 		if err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":   "Bad Request",
-				"message": "Invalid generation ID",
-			})
+			return badRequest(c, "error.invalid_generation_id")
 		}
 
 		var generation models.Generation
-		if err := db.Where("id = ? AND user_id = ?", id, userID).First(&generation).Error; err != nil {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-				"error":   "Not Found",
-				"message": "Generation not found",
-			})
+		if err := requestDB(c, h.db).Where("id = ? AND user_id = ?", id, userID).First(&generation).Error; err != nil {
+			return notFound(c, "error.generation_not_found")
 		}
 
-		if err := db.Delete(&generation).Error; err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error":   "Internal Server Error",
-				"message": "Failed to delete generation",
-			})
+		if err := requestDB(c, h.db).Delete(&generation).Error; err != nil {
+			return internalError(c, "error.delete_generation_failed")
 		}
+		invalidateGenerations(h.cache, userID)
 
 		return c.JSON(fiber.Map{
-			"message": "Generation deleted",
+			"message": i18n.T(c, "message.generation_deleted"),
 		})
 	}
 }
 
-func ToggleFavorite(db *gorm.DB) fiber.Handler {
+func (h *Handlers) ToggleFavorite() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		userID := c.Locals("userID").(uint)
 		id, err := strconv.ParseUint(c.Params("id"), 10, 32)
 		if err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":   "Bad Request",
-				"message": "Invalid generation ID",
-			})
+			return badRequest(c, "error.invalid_generation_id")
 		}
 
 		var generation models.Generation
-		if err := db.Where("id = ? AND user_id = ?", id, userID).First(&generation).Error; err != nil {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-				"error":   "Not Found",
-				"message": "Generation not found",
-			})
+		if err := requestDB(c, h.db).Where("id = ? AND user_id = ?", id, userID).First(&generation).Error; err != nil {
+			return notFound(c, "error.generation_not_found")
 		}
 
 		generation.IsFavorite = !generation.IsFavorite
-		db.Save(&generation)
-			// Invalidate cache
-			if cache.Cache != nil {
-				cache.Cache.DeletePattern(fmt.Sprintf("generations:%d:*", userID))
+		requestDB(c, h.db).Save(&generation)
+		// Invalidate cache
+		invalidateGenerations(h.cache, userID)
+
+		return c.JSON(fiber.Map{
+			"message":    i18n.T(c, "message.favorite_toggled"),
+			"generation": generation.ToResponse(middleware.GetBaseURL(c)),
+		})
+	}
+}
+
+// UpdateGeneration renames one of the caller's generations. The title
+// goes through the same blocklist as at creation and, when the generation
+// is public, through the publish filter as TogglePublic would run it.
+func (h *Handlers) UpdateGeneration() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+		id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+		if err != nil {
+			return badRequest(c, "error.invalid_generation_id")
+		}
+
+		var req models.UpdateGenerationRequest
+		if apiErr := bindJSON(c, &req); apiErr != nil {
+			return apierror.Respond(c, apiErr)
+		}
+		if errs := middleware.ValidateRequest(c, &req); len(errs) > 0 {
+			return validationFailed(c, errs)
+		}
+
+		var generation models.Generation
+		if err := requestDB(c, h.db).Where("id = ? AND user_id = ?", id, userID).First(&generation).Error; err != nil {
+			return notFound(c, "error.generation_not_found")
+		}
+
+		if verdict := moderation.Check(c.UserContext(), moderation.Field{Name: "title", Text: req.Title}); verdict != nil {
+			return policyViolation(c, generation.Type, verdict)
+		}
+
+		message := "message.generation_updated"
+		generation.Title = middleware.SanitizeInput(req.Title)
+		if generation.IsPublic {
+			verdict := checkPublish(c, &generation)
+			if verdict != nil && !verdict.Soft {
+				return publishBlocked(c, &generation, verdict)
+			}
+			if applyPublishVerdict(c, &generation, verdict, true) {
+				message = "message.generation_held_for_review"
 			}
+		}
+
+		if err := requestDB(c, h.db).Model(&generation).
+			Select("title", "moderation_status", "moderation_reason").
+			Updates(&generation).Error; err != nil {
+			return internalError(c, "error.update_generation_failed")
+		}
+		invalidateGenerations(h.cache, userID)
 
 		return c.JSON(fiber.Map{
-			"message":    "Favorite toggled",
-			"generation": generation.ToResponse(),
+			"message":    i18n.T(c, message),
+			"generation": generation.ToResponse(middleware.GetBaseURL(c)),
 		})
 	}
 }
 
-// TogglePublic toggles the public/private status of a generation
-func TogglePublic(db *gorm.DB) fiber.Handler {
+// TogglePublic toggles the public/private status of a generation. Only a
+// completed generation can go public, as in BulkUpdateGenerations. Going
+// public runs the publish filter first: a hard match refuses it and a soft
+// one publishes it held for review, off Explore until an admin approves.
+func (h *Handlers) TogglePublic() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		userID := c.Locals("userID").(uint)
 		id, err := strconv.ParseUint(c.Params("id"), 10, 32)
 		if err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":   "Bad Request",
-				"message": "Invalid generation ID",
-			})
+			return badRequest(c, "error.invalid_generation_id")
 		}
 
 		var generation models.Generation
-		if err := db.Where("id = ? AND user_id = ?", id, userID).First(&generation).Error; err != nil {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-				"error":   "Not Found",
-				"message": "Generation not found",
-			})
+		if err := requestDB(c, h.db).Where("id = ? AND user_id = ?", id, userID).First(&generation).Error; err != nil {
+			return notFound(c, "error.generation_not_found")
+		}
+
+		message := "message.public_toggled"
+		if !generation.IsPublic {
+			if generation.ModerationStatus == models.ModerationRemoved {
+				return errorResponse(c, fiber.StatusForbidden, apierror.CodeContentRemoved, i18n.T(c, "error.generation_removed"))
+			}
+			if generation.Status != models.StatusCompleted {
+				return conflict(c, "error.generation_not_completed")
+			}
+
+			var user models.User
+			if err := requestDB(c, h.db).Select("id", "publishing_banned").First(&user, userID).Error; err != nil {
+				return notFound(c, "error.user_not_found")
+			}
+			if user.PublishingBanned {
+				return errorResponse(c, fiber.StatusForbidden, apierror.CodePublishingBanned, i18n.T(c, "error.publishing_banned"))
+			}
+
+			verdict := checkPublish(c, &generation)
+			if verdict != nil && !verdict.Soft {
+				return publishBlocked(c, &generation, verdict)
+			}
+			if applyPublishVerdict(c, &generation, verdict, false) {
+				message = "message.public_held_for_review"
+			}
 		}
 
 		generation.IsPublic = !generation.IsPublic
-		db.Save(&generation)
+		requestDB(c, h.db).Save(&generation)
+		invalidateGenerations(h.cache, userID)
 
 		return c.JSON(fiber.Map{
-			"message":    "Public status toggled",
+			"message":    i18n.T(c, message),
 			"is_public":  generation.IsPublic,
-			"generation": generation.ToResponse(),
+			"generation": generation.ToResponse(middleware.GetBaseURL(c)),
 		})
 	}
 }
 
-// GetPublicGenerations returns all public generations (for explore page)
-func GetPublicGenerations(db *gorm.DB) fiber.Handler {
+// Reasons BulkUpdateGenerations gives for skipping an ID.
+const (
+	skipNotFound     = "not_found"
+	skipNotCompleted = "not_completed"
+	skipRemoved      = "removed"
+	skipBlocked      = "publish_blocked"
+)
+
+// BulkUpdateGenerations favorites, unfavorites, publishes or unpublishes
+// up to MaxBulkGenerationIDs of the caller's generations in one UPDATE.
+// IDs that don't apply are skipped and listed with the reason rather than
+// failing the batch; IDs the caller doesn't own are reported as not found.
+// Publishing follows the TogglePublic rules, publish filter and completed
+// status included. Generations the filter holds for review are published
+// and listed under held.
+func (h *Handlers) BulkUpdateGenerations() fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		page, _ := strconv.Atoi(c.Query("page", "1"))
-		limit, _ := strconv.Atoi(c.Query("limit", "20"))
-		genType := c.Query("type")
+		userID := c.Locals("userID").(uint)
+
+		var req models.BulkGenerationRequest
+		if apiErr := bindJSON(c, &req); apiErr != nil {
+			return apierror.Respond(c, apiErr)
+		}
 
-		if page < 1 {
-			page = 1
+		v := middleware.NewLocalizedValidator(i18n.Locale(c)).Struct(&req)
+		if len(req.IDs) > models.MaxBulkGenerationIDs {
+			v.AddRuleError("ids", "max_items", i18n.Params{"max": models.MaxBulkGenerationIDs})
 		}
-		if limit < 1 || limit > 100 {
-			limit = 20
+		if v.HasErrors() {
+			return validationFailed(c, v.Errors())
 		}
 
-		offset := (page - 1) * limit
+		publish := req.Action == "publish"
+		if publish {
+			var user models.User
+			if err := requestDB(c, h.db).Select("id", "publishing_banned").First(&user, userID).Error; err != nil {
+				return notFound(c, "error.user_not_found")
+			}
+			if user.PublishingBanned {
+				return errorResponse(c, fiber.StatusForbidden, apierror.CodePublishingBanned, i18n.T(c, "error.publishing_banned"))
+			}
+		}
 
-		query := db.Where("is_public = ? AND status = ?", true, models.StatusCompleted)
+		columns := []string{"id", "status", "moderation_status"}
+		if publish {
+			columns = append(columns, "title", "style", "lyrics")
+		}
+		var owned []models.Generation
+		if err := requestDB(c, h.db).Select(columns).
+			Where("user_id = ? AND id IN ?", userID, req.IDs).
+			Find(&owned).Error; err != nil {
+			return internalError(c, "error.update_generations_failed")
+		}
+		byID := make(map[uint]models.Generation, len(owned))
+		for _, g := range owned {
+			byID[g.ID] = g
+		}
 
-		if genType != "" {
-			query = query.Where("type = ?", genType)
+		updated := []uint{}
+		skipped := []fiber.Map{}
+		held := []uint{}
+		// moderated are the generations whose moderation status the publish
+		// filter changed, written after the bulk update.
+		var moderated []models.Generation
+		seen := map[uint]bool{}
+		for _, id := range req.IDs {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+
+			g, ok := byID[id]
+			switch {
+			case !ok:
+				skipped = append(skipped, fiber.Map{"id": id, "reason": skipNotFound})
+			case publish && g.ModerationStatus == models.ModerationRemoved:
+				skipped = append(skipped, fiber.Map{"id": id, "reason": skipRemoved})
+			case publish && g.Status != models.StatusCompleted:
+				skipped = append(skipped, fiber.Map{"id": id, "reason": skipNotCompleted})
+			case publish:
+				verdict := checkPublish(c, &g)
+				if verdict != nil && !verdict.Soft {
+					audit.Record(c, models.AuditPublishBlocked, audit.Generation(id), publishAuditMeta(verdict))
+					skipped = append(skipped, fiber.Map{"id": id, "reason": skipBlocked})
+					continue
+				}
+				status := g.ModerationStatus
+				if applyPublishVerdict(c, &g, verdict, false) {
+					held = append(held, id)
+				}
+				if g.ModerationStatus != status {
+					moderated = append(moderated, g)
+				}
+				updated = append(updated, id)
+			default:
+				updated = append(updated, id)
+			}
 		}
 
-		var total int64
-		query.Model(&models.Generation{}).Count(&total)
+		if len(updated) > 0 {
+			column, value := "is_favorite", true
+			switch req.Action {
+			case "unfavorite":
+				value = false
+			case "publish":
+				column = "is_public"
+			case "unpublish":
+				column, value = "is_public", false
+			}
+			err := requestDB(c, h.db).Transaction(func(tx *gorm.DB) error {
+				if err := tx.Model(&models.Generation{}).
+					Where("user_id = ? AND id IN ?", userID, updated).
+					Update(column, value).Error; err != nil {
+					return err
+				}
+				for i := range moderated {
+					if err := tx.Model(&moderated[i]).
+						Select("moderation_status", "moderation_reason").
+						Updates(&moderated[i]).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return internalError(c, "error.update_generations_failed")
+			}
+			invalidateGenerations(h.cache, userID)
+		}
+
+		return c.JSON(fiber.Map{
+			"message": i18n.T(c, "message.generations_updated", i18n.Params{"count": len(updated)}),
+			"action":  req.Action,
+			"updated": updated,
+			"held":    held,
+			"skipped": skipped,
+		})
+	}
+}
+
+// GetPublicGenerations returns all public generations (for explore page)
+func (h *Handlers) GetPublicGenerations() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.ListPublicGenerationsRequest
+		if errs := bindQuery(c, &req); len(errs) > 0 {
+			return validationFailed(c, errs)
+		}
+		req.SetDefaults()
+
+		fields, v := selectedFields(c, publicGenerationFields)
+		if v.HasErrors() {
+			return validationFailed(c, v.Errors())
+		}
+
+		page, limit := req.Page, req.Limit
+		offset := (page - 1) * limit
+
+		query := publicGenerationsQuery(requestDB(c, h.db), req.Type)
+		total, _ := countGenerations(h.cache, query, "explore:count:"+req.Type, exploreCountCap)
 
 		var generations []models.Generation
-		if err := query.Preload("User").Order("created_at DESC").Offset(offset).Limit(limit).Find(&generations).Error; err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error":   "Internal Server Error",
-				"message": "Failed to fetch public generations",
-			})
+		if err := query.Preload("User").Order(req.OrderBy()).Offset(offset).Limit(limit).Find(&generations).Error; err != nil {
+			return internalError(c, "error.fetch_public_generations_failed")
 		}
 
-		// Build response with user name
-		responses := make([]fiber.Map, len(generations))
-		for i, g := range generations {
-			responses[i] = fiber.Map{
-				"id":            g.ID,
-				"type":          g.Type,
-				"title":         g.Title,
-				"style":         g.Style,
-				"duration":      g.Duration,
-				"output_url":    g.OutputURL,
-				"thumbnail_url": g.ThumbnailURL,
-				"created_at":    g.CreatedAt,
-				"creator_name":  g.User.Name,
-				"lyrics":        g.Lyrics,
+		base := middleware.GetBaseURL(c)
+		responses := make([]models.GenerationPublicResponse, len(generations))
+		for i := range generations {
+			responses[i] = generations[i].ToPublicResponse(base)
+		}
+		if fields != nil {
+			projected, err := project(responses, fields)
+			if err != nil {
+				return internalError(c, "error.fetch_public_generations_failed")
 			}
+			return newPage(projected, page, limit, total).send(c, "generations")
 		}
+		return newPage(responses, page, limit, total).send(c, "generations")
+	}
+}
 
-		return c.JSON(fiber.Map{
-			"generations": responses,
-			"pagination": fiber.Map{
-				"page":        page,
-				"limit":       limit,
-				"total":       total,
-				"total_pages": (total + int64(limit) - 1) / int64(limit),
-			},
-		})
+// RecordPlay counts a play of a generation on Explore, for the plays in
+// its public counts. Anyone can send it, so it is only a rough tally,
+// kept honest by the per-IP rate limit.
+func (h *Handlers) RecordPlay() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+		if err != nil {
+			return badRequest(c, "error.invalid_generation_id")
+		}
+
+		res := onExplore(requestDB(c, h.db).Model(&models.Generation{})).Where("id = ?", id).
+			UpdateColumn("play_count", gorm.Expr("play_count + 1"))
+		if res.Error != nil {
+			middleware.Log(c).Error("failed to record play", "generation_id", id, "error", res.Error)
+			return internalError(c, "error.record_play_failed")
+		}
+		if res.RowsAffected == 0 {
+			return notFound(c, "error.generation_not_found")
+		}
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// ownGenerationsQuery selects userID's generations matching the filters in
+// req, for the list endpoint and the GraphQL generations field alike.
+func ownGenerationsQuery(db *gorm.DB, userID uint, req *models.ListGenerationsRequest) *gorm.DB {
+	query := database.Reader(db, userID).Where("user_id = ?", userID)
+	if req.Type != "" {
+		query = query.Where("type = ?", req.Type)
+	}
+	if req.Status != "" {
+		query = query.Where("status = ?", req.Status)
+	}
+	if req.Favorite != nil {
+		query = query.Where("is_favorite = ?", *req.Favorite)
 	}
+	return query
+}
+
+// generationFilters is the part of the list cache keys naming the
+// filters in req.
+func generationFilters(req *models.ListGenerationsRequest) string {
+	favorite := ""
+	if req.Favorite != nil {
+		favorite = strconv.FormatBool(*req.Favorite)
+	}
+	return fmt.Sprintf("%s:%s:%s", req.Type, req.Status, favorite)
+}
+
+// generationsCountKey caches the total of a filtered list. It sits under
+// generations:<user>: so the usual invalidation on writes clears it too.
+func generationsCountKey(userID uint, filters string) string {
+	return fmt.Sprintf("generations:%d:count:%s", userID, filters)
+}
+
+// publicGenerationsQuery selects what Explore lists, of one type or of
+// every type when typ is "".
+func publicGenerationsQuery(db *gorm.DB, typ string) *gorm.DB {
+	query := onExplore(database.Reader(db, 0))
+	if typ != "" {
+		query = query.Where("type = ?", typ)
+	}
+	return query
+}
+
+// onExplore narrows db to the generations Explore shows.
+func onExplore(db *gorm.DB) *gorm.DB {
+	return db.Where("is_public = ? AND status = ? AND is_demo = ?", true, models.StatusCompleted, false).
+		Where("moderation_status IS NULL OR moderation_status NOT IN ?", models.OffExplore)
+}
+
+// invalidateGenerations drops the user's cached generation lists and keeps
+// their reads on the primary briefly, so the next list shows the change.
+func invalidateGenerations(redis *cache.RedisCache, userID uint) {
+	if redis != nil {
+		redis.DeletePattern(fmt.Sprintf("generations:%d:*", userID))
+	}
+	database.PinPrimary(userID)
+}
+
+// dailyLimitReached reports whether user has used up their plan's daily
+// generation limit for the current UTC day, and what the limit is. A
+// failed count lets the request through rather than blocking everyone.
+func dailyLimitReached(c *fiber.Ctx, db *gorm.DB, user *models.User, runtime settings.Settings) (int, bool) {
+	limit := runtime.DailyGenerationLimits[user.Plan]
+	if limit <= 0 {
+		return 0, false
+	}
+
+	var used int64
+	if err := requestDB(c, db).Model(&models.Generation{}).
+		Where("user_id = ? AND created_at >= ?", user.ID, utcDayStart(time.Now())).
+		Count(&used).Error; err != nil {
+		middleware.Log(c).Warn("failed to count today's generations", "error", err)
+		return limit, false
+	}
+	return limit, used >= int64(limit)
+}
+
+// dailyLimitResponse is the 429 for dailyLimitReached, retryable at the
+// next UTC midnight.
+func dailyLimitResponse(c *fiber.Ctx, limit int) error {
+	reset := utcDayStart(time.Now()).Add(24 * time.Hour)
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(time.Until(reset).Seconds())+1))
+	return errorResponse(c, fiber.StatusTooManyRequests, apierror.CodeDailyLimitReached, i18n.T(c, "error.daily_limit_reached", i18n.Params{"limit": limit}))
+}
+
+func utcDayStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
 }
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/zesbe/lumina-ai/internal/i18n"
+	"github.com/zesbe/lumina-ai/internal/middleware"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+// requestHash identifies a generate request by what it asks for, once
+// saved prompts, presets, templates and defaults are applied, so two
+// clicks on Generate hash the same. Text is compared with its whitespace
+// collapsed.
+func requestHash(kind models.GenerationType, settings ...interface{}) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s", kind)
+	for _, s := range settings {
+		switch v := s.(type) {
+		case string:
+			s = strings.Join(strings.Fields(v), " ")
+		case *uint:
+			// IDs of presets and templates; none is 0.
+			s = uint(0)
+			if v != nil {
+				s = *v
+			}
+		}
+		fmt.Fprintf(h, "\x00%v", s)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// createGeneration stores generation, unless the user already has one
+// with the same RequestHash pending or processing that started within
+// window; then that one is returned and nothing is stored. The check and
+// the insert run under a lock on the user's row, so identical requests
+// arriving together start one generation. With window 0 or force it only
+// stores.
+func createGeneration(db *gorm.DB, window time.Duration, force bool, generation *models.Generation) (*models.Generation, error) {
+	if window <= 0 || force {
+		return nil, db.Create(generation).Error
+	}
+
+	var existing *models.Generation
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&user, generation.UserID).Error; err != nil {
+			return err
+		}
+		var found models.Generation
+		err := tx.Where("user_id = ? AND request_hash = ? AND status IN ? AND created_at > ?",
+			generation.UserID, generation.RequestHash,
+			[]models.GenerationStatus{models.StatusPending, models.StatusProcessing}, time.Now().Add(-window)).
+			Order("created_at DESC").First(&found).Error
+		if err == nil {
+			existing = &found
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		return tx.Create(generation).Error
+	})
+	return existing, err
+}
+
+// duplicateGeneration answers a generate request that was already
+// running with the generation it started.
+func duplicateGeneration(c *fiber.Ctx, existing *models.Generation) error {
+	middleware.Log(c).Info("collapsed duplicate generate request", "generation_id", existing.ID)
+	return c.JSON(fiber.Map{
+		"message":      i18n.T(c, "message.generation_duplicate"),
+		"generation":   existing.ToResponse(middleware.GetBaseURL(c)),
+		"duplicate_of": existing.ID,
+	})
+}
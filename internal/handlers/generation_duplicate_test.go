@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+// duplicateDB opens a database with a user to generate for. Postgres
+// serializes createGeneration on a lock of the user's row, which SQLite
+// ignores; the nearest it has is taking the write lock as a transaction
+// begins, so that is how the database is opened. It is a file so that
+// several connections can wait on that lock.
+func duplicateDB(t *testing.T) (*gorm.DB, models.User) {
+	t.Helper()
+	dsn := "file:" + filepath.Join(t.TempDir(), "generations.db") + "?_txlock=immediate&_pragma=busy_timeout(5000)"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := db.AutoMigrate(&models.User{}, &models.Generation{}); err != nil {
+		t.Fatal(err)
+	}
+	user := models.User{Email: "duplicate@example.com", Name: "Duplicate", Role: "user", Plan: "free", IsActive: true}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return db, user
+}
+
+func newGeneration(user models.User, hash string) models.Generation {
+	return models.Generation{UserID: user.ID, Type: models.TypeMusic, Status: models.StatusProcessing, Prompt: "p", RequestHash: hash}
+}
+
+func TestRequestHash(t *testing.T) {
+	preset, other := uint(3), uint(4)
+	base := requestHash(models.TypeMusic, "Road home", "warm  folk\nsong", &preset, 256000)
+	tests := []struct {
+		name string
+		hash string
+		same bool
+	}{
+		{"whitespace collapsed", requestHash(models.TypeMusic, " Road   home", "warm folk song ", &preset, 256000), true},
+		{"another type", requestHash(models.TypeVideo, "Road home", "warm folk song", &preset, 256000), false},
+		{"another preset", requestHash(models.TypeMusic, "Road home", "warm folk song", &other, 256000), false},
+		{"no preset", requestHash(models.TypeMusic, "Road home", "warm folk song", (*uint)(nil), 256000), false},
+		{"another setting", requestHash(models.TypeMusic, "Road home", "warm folk song", &preset, 128000), false},
+		{"text moved between fields", requestHash(models.TypeMusic, "Road", "home warm folk song", &preset, 256000), false},
+	}
+	for _, tt := range tests {
+		if (tt.hash == base) != tt.same {
+			t.Errorf("%s: same hash %v, want %v", tt.name, tt.hash == base, tt.same)
+		}
+	}
+}
+
+func TestCreateGeneration(t *testing.T) {
+	db, user := duplicateDB(t)
+	running := newGeneration(user, "running")
+	if err := db.Create(&running).Error; err != nil {
+		t.Fatal(err)
+	}
+	finished := newGeneration(user, "finished")
+	finished.Status = models.StatusCompleted
+	old := newGeneration(user, "old")
+	old.CreatedAt = time.Now().Add(-time.Hour)
+	if err := db.Create(&[]models.Generation{finished, old}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		hash   string
+		window time.Duration
+		force  bool
+		want   uint
+	}{
+		{name: "same request running", hash: "running", window: time.Minute, want: running.ID},
+		{name: "forced", hash: "running", window: time.Minute, force: true},
+		{name: "check disabled", hash: "running"},
+		{name: "same request finished", hash: "finished", window: time.Minute},
+		{name: "same request out of the window", hash: "old", window: time.Minute},
+		{name: "another request", hash: "new", window: time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			generation := newGeneration(user, tt.hash)
+			existing, err := createGeneration(db, tt.window, tt.force, &generation)
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch {
+			case tt.want != 0 && (existing == nil || existing.ID != tt.want || generation.ID != 0):
+				t.Errorf("got %v and stored %d, want generation %d and nothing stored", existing, generation.ID, tt.want)
+			case tt.want == 0 && (existing != nil || generation.ID == 0):
+				t.Errorf("got %v and stored %d, want a new generation stored", existing, generation.ID)
+			}
+		})
+	}
+}
+
+// TestCreateGenerationRace sends two identical requests at once, both
+// before either has committed: a double click. Only one may start a
+// generation.
+func TestCreateGenerationRace(t *testing.T) {
+	db, user := duplicateDB(t)
+
+	// Each request's duplicate lookup waits for the other's, or for long
+	// enough that the other is plainly held back, so without the lock both
+	// would look before either inserts.
+	var lookups atomic.Int32
+	both := make(chan struct{})
+	db.Callback().Query().After("gorm:query").Register("test:meet_at_lookup", func(tx *gorm.DB) {
+		if tx.Statement.Table != "generations" {
+			return
+		}
+		if lookups.Add(1) == 2 {
+			close(both)
+		}
+		select {
+		case <-both:
+		case <-time.After(200 * time.Millisecond):
+		}
+	})
+
+	type result struct {
+		generation models.Generation
+		existing   *models.Generation
+		err        error
+	}
+	start := make(chan struct{})
+	results := make(chan result, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			<-start
+			generation := newGeneration(user, "double-click")
+			existing, err := createGeneration(db, time.Minute, false, &generation)
+			results <- result{generation, existing, err}
+		}()
+	}
+	close(start)
+
+	var stored, collapsed []uint
+	for i := 0; i < 2; i++ {
+		r := <-results
+		if r.err != nil {
+			t.Fatalf("createGeneration: %v", r.err)
+		}
+		if r.existing != nil {
+			collapsed = append(collapsed, r.existing.ID)
+		} else {
+			stored = append(stored, r.generation.ID)
+		}
+	}
+	if len(stored) != 1 || len(collapsed) != 1 || collapsed[0] != stored[0] {
+		t.Fatalf("stored %v, collapsed onto %v; want one generation and the other request given it", stored, collapsed)
+	}
+	var count int64
+	db.Model(&models.Generation{}).Where("request_hash = ?", "double-click").Count(&count)
+	if count != 1 {
+		t.Errorf("%d generations stored, want 1", count)
+	}
+}
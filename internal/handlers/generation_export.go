@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"github.com/zesbe/lumina-ai/internal/middleware"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+const (
+	// Like the ledger export, this outlives the request deadline.
+	generationExportTimeout = 15 * time.Minute
+	// generationExportBatch is how many rows are read per query; memory
+	// stays at one batch however long the history is.
+	generationExportBatch = 500
+)
+
+var generationCSVHeader = []string{"id", "type", "title", "prompt", "style", "status", "credits_cost", "created_at", "output_url"}
+
+type generationExportRow struct {
+	ID          uint                    `json:"id"`
+	Type        models.GenerationType   `json:"type"`
+	Title       string                  `json:"title"`
+	Prompt      string                  `json:"prompt"`
+	Style       string                  `json:"style"`
+	Status      models.GenerationStatus `json:"status"`
+	CreditsCost int                     `json:"credits_cost"`
+	CreatedAt   time.Time               `json:"created_at"`
+	OutputURL   string                  `json:"output_url"`
+}
+
+// ExportGenerations streams the caller's whole generation history, oldest
+// first, as CSV (default) or JSON lines (format=json). Rows are read in
+// batches keyed on id rather than one long cursor, so no connection is
+// held for the length of the download.
+func (h *Handlers) ExportGenerations() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+
+		format := c.Query("format", "csv")
+		if format != "csv" && format != "json" {
+			return badRequest(c, "error.invalid_generation_export_format")
+		}
+
+		ext, contentType := "csv", "text/csv; charset=utf-8"
+		if format == "json" {
+			ext, contentType = "jsonl", "application/x-ndjson"
+		}
+		c.Set(fiber.HeaderContentType, contentType)
+		c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="generations-%s.%s"`,
+			time.Now().UTC().Format("20060102"), ext))
+
+		log := middleware.Log(c).With("format", format)
+		base := middleware.GetBaseURL(c)
+		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			start := time.Now()
+			ctx, cancel := context.WithTimeout(context.Background(), generationExportTimeout)
+			defer cancel()
+
+			rows, err := writeGenerationExport(ctx, h.db, w, format, base, userID, func() { w.Flush() })
+			if err != nil {
+				log.Error("generation export failed", "rows", rows, "error", err)
+				return
+			}
+			log.Info("generation export finished", "rows", rows, "duration_ms", time.Since(start).Milliseconds())
+		})
+
+		return nil
+	}
+}
+
+func writeGenerationExport(ctx context.Context, db *gorm.DB, out io.Writer, format, base string, userID uint, flush func()) (int64, error) {
+	var write func(row *generationExportRow) error
+	var csvWriter *csv.Writer
+	if format == "json" {
+		enc := json.NewEncoder(out)
+		write = func(row *generationExportRow) error { return enc.Encode(row) }
+	} else {
+		csvWriter = csv.NewWriter(out)
+		if err := csvWriter.Write(generationCSVHeader); err != nil {
+			return 0, err
+		}
+		write = func(row *generationExportRow) error {
+			return csvWriter.Write([]string{
+				strconv.FormatUint(uint64(row.ID), 10),
+				string(row.Type),
+				csvSafe(row.Title),
+				csvSafe(row.Prompt),
+				csvSafe(row.Style),
+				string(row.Status),
+				strconv.Itoa(row.CreditsCost),
+				row.CreatedAt.UTC().Format(time.RFC3339),
+				row.OutputURL,
+			})
+		}
+	}
+
+	var n int64
+	var lastID uint
+	for {
+		var batch []generationExportRow
+		if err := db.WithContext(ctx).Model(&models.Generation{}).
+			Select("id, type, title, prompt, style, status, credits_cost, created_at, output_url").
+			Where("user_id = ? AND id > ?", userID, lastID).
+			Order("id").Limit(generationExportBatch).
+			Scan(&batch).Error; err != nil {
+			return n, err
+		}
+
+		for i := range batch {
+			batch[i].OutputURL = models.AbsoluteURL(base, batch[i].OutputURL)
+			if err := write(&batch[i]); err != nil {
+				return n, err
+			}
+			n++
+		}
+		if csvWriter != nil {
+			csvWriter.Flush()
+			if err := csvWriter.Error(); err != nil {
+				return n, err
+			}
+		}
+		flush()
+
+		if len(batch) < generationExportBatch {
+			return n, nil
+		}
+		lastID = batch[len(batch)-1].ID
+	}
+}
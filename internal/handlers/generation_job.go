@@ -0,0 +1,872 @@
+package handlers
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/audit"
+	"github.com/zesbe/lumina-ai/internal/cache"
+	"github.com/zesbe/lumina-ai/internal/config"
+	"github.com/zesbe/lumina-ai/internal/i18n"
+	"github.com/zesbe/lumina-ai/internal/logger"
+	"github.com/zesbe/lumina-ai/internal/middleware"
+	"github.com/zesbe/lumina-ai/internal/models"
+	"github.com/zesbe/lumina-ai/internal/reporting"
+	"github.com/zesbe/lumina-ai/internal/services"
+	"github.com/zesbe/lumina-ai/internal/settings"
+	"github.com/zesbe/lumina-ai/internal/tracing"
+	"github.com/zesbe/lumina-ai/internal/userstate"
+	"github.com/zesbe/lumina-ai/internal/watermark"
+)
+
+// interruptedMessage is recorded on generations that fail because the
+// server shut down under them.
+const interruptedMessage = "Interrupted by server shutdown"
+
+// settleTimeout bounds how long Drain waits for cancelled jobs to record
+// their final state.
+const settleTimeout = 10 * time.Second
+
+// queueFullRetryAfter is the Retry-After sent when too many generations
+// are running; jobs take a minute or more, so sooner is rarely useful.
+const queueFullRetryAfter = time.Minute
+
+// jobTracker follows the work shutdown has to wait for or cancel. Each
+// Handlers has its own, so an app drained in a test leaves the next one
+// alone.
+type jobTracker struct {
+	// ctx parents every generation job's context, and those of the other
+	// background tasks, so shutdown can cancel them all.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// running counts generate requests in flight and jobs that haven't
+	// settled, so shutdown can wait for them.
+	running sync.WaitGroup
+	// active is how many jobs are running, for ServerStats and the
+	// GenerationGate limit.
+	active atomic.Int64
+	// mu orders the draining check in GenerationGate against Drain
+	// starting to wait on running, and guards byGeneration.
+	mu       sync.Mutex
+	draining bool
+	// byGeneration is the running job of each generation, so settling one
+	// elsewhere can stop its job.
+	byGeneration map[uint]*generationJob
+}
+
+func newJobTracker() *jobTracker {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &jobTracker{ctx: ctx, cancel: cancel, byGeneration: map[uint]*generationJob{}}
+}
+
+func (t *jobTracker) track(j *generationJob) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.byGeneration[j.generation.ID] = j
+}
+
+func (t *jobTracker) untrack(j *generationJob) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.byGeneration[j.generation.ID] == j {
+		delete(t.byGeneration, j.generation.ID)
+	}
+}
+
+// stop cancels the running job of a generation that was just settled
+// elsewhere, such as by support failing it. The job then ends without
+// recording or announcing anything. It reports whether a job was running.
+func (t *jobTracker) stop(generationID uint) bool {
+	t.mu.Lock()
+	j := t.byGeneration[generationID]
+	t.mu.Unlock()
+	if j == nil {
+		return false
+	}
+	j.stopped.Store(true)
+	j.cancel()
+	return true
+}
+
+// closing reports whether Drain has started.
+func (t *jobTracker) closing() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.draining
+}
+
+// GenerationGate admits requests that start generations until shutdown
+// begins, then answers 503. Admitted requests count as running work, so
+// Drain also waits for a request that is about to start a job. While more
+// jobs are running than the caller's plan allows it also answers 503, with
+// Retry-After, before any generation is created or credit taken: when
+// MiniMax slows down, a quick "try again" beats a failure hours later.
+func (h *Handlers) GenerationGate() fiber.Handler {
+	retryAfter := strconv.Itoa(int(queueFullRetryAfter.Seconds()))
+
+	return func(c *fiber.Ctx) error {
+		plan, _ := c.Locals("plan").(string)
+		if h.jobs.active.Load() >= int64(h.cfg.ActiveGenerationLimitFor(plan)) {
+			c.Set(fiber.HeaderRetryAfter, retryAfter)
+			return errorResponse(c, fiber.StatusServiceUnavailable, apierror.CodeQueueFull, i18n.T(c, "error.queue_full"))
+		}
+
+		h.jobs.mu.Lock()
+		if h.jobs.draining {
+			h.jobs.mu.Unlock()
+			return errorResponse(c, fiber.StatusServiceUnavailable, apierror.CodeShuttingDown, i18n.T(c, "error.shutting_down"))
+		}
+		h.jobs.running.Add(1)
+		h.jobs.mu.Unlock()
+		defer h.jobs.running.Done()
+
+		return c.Next()
+	}
+}
+
+// Drain is the first step of shutdown. It stops new generations, closes
+// WebSocket connections with a server_shutdown message and gives running
+// jobs up to grace to finish. Jobs still running after that are cancelled:
+// video jobs MiniMax already accepted are marked interrupted and resumed
+// on the next start by ResumeInterrupted, the rest fail with a refund.
+// Drain returns once the jobs have recorded that, so the database and
+// Redis can be closed after it.
+func (h *Handlers) Drain(grace time.Duration) {
+	h.jobs.mu.Lock()
+	h.jobs.draining = true
+	h.jobs.mu.Unlock()
+
+	h.hub.CloseAll("server_shutdown")
+
+	if h.jobs.wait(grace) {
+		return
+	}
+	logger.L().Warn("cancelling generations still running after the grace period", "grace", grace)
+	h.jobs.cancel()
+	if !h.jobs.wait(settleTimeout) {
+		logger.L().Error("generations did not settle after cancellation; they will stay processing")
+	}
+}
+
+func (t *jobTracker) wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		t.running.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// ResumeInterrupted restarts video generations a previous shutdown cut
+// off, polling MiniMax for the tasks they were waiting on.
+func (h *Handlers) ResumeInterrupted() {
+	var generations []models.Generation
+	if err := h.db.Where("status = ? AND mini_max_job_id <> ''", models.StatusInterrupted).
+		Find(&generations).Error; err != nil {
+		logger.L().Error("failed to load interrupted generations", "error", err)
+		return
+	}
+
+	for _, generation := range generations {
+		job := h.newJob(context.Background(), logger.L(), "", i18n.DefaultLocale, generation)
+		go job.resumeVideo()
+	}
+	if len(generations) > 0 {
+		logger.L().Info("resuming interrupted generations", "count", len(generations))
+	}
+}
+
+// generationJob is the background half of a generate request. It owns a
+// copy of the generation so the request handler can return while the job
+// keeps updating it.
+type generationJob struct {
+	db        *gorm.DB
+	cfg       *config.Config
+	cache     *cache.RedisCache
+	jobs      *jobTracker
+	provider  *services.MiniMaxService
+	hub       *WSHub
+	log       *slog.Logger
+	span      trace.Span
+	cancel    context.CancelFunc
+	requestID string
+	locale    string
+	// baseURL is what media URLs in the job's events and email are made
+	// absolute against: the request's, or the configured one on resume.
+	baseURL    string
+	generation models.Generation
+	// stopped is set when the generation was settled elsewhere and the
+	// job cancelled; see jobTracker.stop.
+	stopped atomic.Bool
+}
+
+// newGenerationJob prepares a job for generation on behalf of the current
+// request: it gets its own trace linked to the request, a logger scoped to
+// the generation and a provider client bound to both.
+func (h *Handlers) newGenerationJob(c *fiber.Ctx, generation models.Generation) *generationJob {
+	job := h.newJob(c.UserContext(), middleware.Log(c), middleware.GetRequestID(c), i18n.Locale(c), generation)
+	job.baseURL = middleware.GetBaseURL(c)
+	return job
+}
+
+// newJob is newGenerationJob without a request; parent only supplies the
+// trace link. The job counts as running until its run method returns.
+func (h *Handlers) newJob(parent context.Context, log *slog.Logger, requestID, locale string, generation models.Generation) *generationJob {
+	ctx, span := tracing.StartJob(parent, "generation."+string(generation.Type),
+		attribute.Int64("generation.id", int64(generation.ID)),
+		attribute.String("request.id", requestID),
+	)
+	log = log.With("generation_id", generation.ID, "type", generation.Type, "job_trace_id", tracing.TraceID(ctx))
+	// The job outlives the request, so its context hangs off the tracker's
+	// rather than the request's.
+	ctx, cancel := context.WithCancel(trace.ContextWithSpan(h.jobs.ctx, span))
+	h.jobs.running.Add(1)
+	h.jobs.active.Add(1)
+
+	job := &generationJob{
+		db:         h.db.WithContext(ctx),
+		cfg:        h.cfg,
+		cache:      h.cache,
+		jobs:       h.jobs,
+		provider:   h.minimax.WithLogger(log).WithContext(ctx),
+		hub:        h.hub,
+		log:        log,
+		span:       span,
+		cancel:     cancel,
+		requestID:  requestID,
+		locale:     locale,
+		baseURL:    h.cfg.PublicBaseURL,
+		generation: generation,
+	}
+	h.jobs.track(job)
+	return job
+}
+
+// done ends the job's trace and releases it; run methods defer it.
+func (j *generationJob) done() {
+	j.span.End()
+	j.jobs.untrack(j)
+	j.cancel()
+	j.jobs.active.Add(-1)
+	j.jobs.running.Done()
+}
+
+// store is the job's database handle for recording an outcome. It
+// survives cancellation so a job cut off by shutdown can still say so.
+func (j *generationJob) store() *gorm.DB {
+	return j.db.WithContext(context.WithoutCancel(j.db.Statement.Context))
+}
+
+// interrupted reports whether shutdown cancelled the job.
+func (j *generationJob) interrupted() bool {
+	return j.jobs.ctx.Err() != nil
+}
+
+// complete settles a successful generation and then tells the cache and
+// the owner, adding extra to the completed event. If the result can't be
+// recorded the generation is failed instead and complete returns false.
+func (j *generationJob) complete(outcome services.Outcome, extra fiber.Map) bool {
+	charged, err := services.FinalizeGeneration(j.store(), &j.generation, outcome)
+	if errors.Is(err, services.ErrGenerationSettled) {
+		j.log.Warn("generation was settled while its job ran; result dropped")
+		return false
+	}
+	if err != nil {
+		j.log.Error("failed to record generation result", "error", err)
+		j.fail("Failed to save generation result")
+		return false
+	}
+	invalidateGenerations(j.cache, j.generation.UserID)
+	j.rewardReferral()
+
+	event := fiber.Map{
+		"type":       "generation_completed",
+		"generation": j.generation.ToResponse(j.baseURL),
+		"request_id": j.requestID,
+	}
+	for k, v := range extra {
+		event[k] = v
+	}
+	j.hub.SendToUser(j.generation.UserID, event)
+	notifyGeneration(j.store(), j.hub, j.locale, &j.generation)
+	mailGeneration(j.jobs.ctx, j.db, j.cfg, j.hub, j.locale, j.baseURL, j.generation)
+	notifyLowCredits(j.store(), j.hub, j.locale, j.generation.UserID, charged)
+	return true
+}
+
+// rewardReferral pays out the referral the owner signed up with, if this
+// was their first completed generation. A failure is only logged; the
+// referral stays pending and the next completion tries again.
+func (j *generationJob) rewardReferral() {
+	runtime := settings.Current()
+	referral, err := services.RewardReferral(j.store(), j.generation.UserID, runtime.ReferralBonusCredits, runtime.ReferralMonthlyCap)
+	if err != nil {
+		j.log.Error("failed to pay out referral", "error", err)
+		return
+	}
+	if referral == nil {
+		return
+	}
+	audit.RecordSystem(models.AuditReferralReward, audit.User(referral.ReferrerID), fiber.Map{
+		"referred_id":      referral.ReferredID,
+		"status":           referral.Status,
+		"referrer_credits": referral.ReferrerCredits,
+		"referred_credits": referral.ReferredCredits,
+		"generation_id":    j.generation.ID,
+	})
+}
+
+// fail settles a failed generation, refunding anything charged, and then
+// tells the cache and the owner.
+func (j *generationJob) fail(message string) {
+	if j.stopped.Load() {
+		// Whoever stopped the job has already settled the generation.
+		return
+	}
+	if j.interrupted() {
+		message = interruptedMessage
+	} else {
+		j.report(message)
+	}
+	_, err := services.FinalizeGeneration(j.store(), &j.generation, services.Outcome{
+		Status:       models.StatusFailed,
+		ErrorMessage: message,
+		Description:  "Refund: generation failed",
+	})
+	if errors.Is(err, services.ErrGenerationSettled) {
+		j.log.Warn("generation was settled while its job ran; failure dropped", "error_message", message)
+		return
+	}
+	if err != nil {
+		// The generation stays pending/processing for recovery to pick up.
+		j.log.Error("failed to record generation failure", "error", err)
+		return
+	}
+	invalidateGenerations(j.cache, j.generation.UserID)
+
+	j.hub.SendToUser(j.generation.UserID, fiber.Map{
+		"type":       "generation_failed",
+		"generation": j.generation.ToResponse(j.baseURL),
+		"request_id": j.requestID,
+		"error":      message,
+	})
+	notifyGeneration(j.store(), j.hub, j.locale, &j.generation)
+	mailGeneration(j.jobs.ctx, j.db, j.cfg, j.hub, j.locale, j.baseURL, j.generation)
+}
+
+// report sends a generation failure to error reporting, tagged so failures
+// can be grouped by model and provider error. Repeats for the same model
+// are throttled so an outage costs one event a minute.
+func (j *generationJob) report(message string) {
+	g := j.generation
+	reporting.Capture(errors.New(message), reporting.Event{
+		Tags: map[string]string{
+			"generation_id":   strconv.FormatUint(uint64(g.ID), 10),
+			"generation_type": string(g.Type),
+			"model":           g.Model,
+			"provider_error":  truncate(message, 200),
+			"request_id":      j.requestID,
+		},
+		Extra:       map[string]interface{}{"minimax_job_id": g.MiniMaxJobID},
+		UserID:      g.UserID,
+		ThrottleKey: "generation_failed:" + string(g.Type) + ":" + g.Model,
+	})
+}
+
+// interrupt records a job cut off by shutdown while MiniMax works on it,
+// for ResumeInterrupted to pick up by MiniMaxJobID.
+func (j *generationJob) interrupt() {
+	j.generation.Status = models.StatusInterrupted
+	if err := j.store().Omit("User").Save(&j.generation).Error; err != nil {
+		j.log.Error("failed to record interrupted generation", "error", err)
+		return
+	}
+	invalidateGenerations(j.cache, j.generation.UserID)
+	j.log.Info("generation interrupted by shutdown; will resume", "task_id", j.generation.MiniMaxJobID)
+}
+
+func (j *generationJob) runMusic(req models.GenerateMusicRequest) {
+	defer j.done()
+
+	provider, jobLog := j.provider, j.log
+	generation := &j.generation
+	userID, requestID, locale := generation.UserID, j.requestID, j.locale
+
+	fullPrompt := req.Prompt
+	if req.Style != "" {
+		fullPrompt = req.Style + ", " + req.Prompt
+	}
+
+	jobLog.Info("music generation started")
+
+	// Step 1: Generate music
+	j.hub.SendToUser(userID, fiber.Map{
+		"type":       "generation_progress",
+		"generation": generation.ToResponse(j.baseURL),
+		"request_id": requestID,
+		"message":    i18n.Translate(locale, "progress.creating_music", nil),
+		"step":       1,
+		"totalSteps": 2,
+	})
+
+	req.SetDefaults()
+	resp, err := provider.GenerateMusic(fullPrompt, req.Lyrics, req.Format, req.Model, req.Bitrate, req.DurationSeconds)
+	if err != nil {
+		jobLog.Error("music generation failed", "error", err)
+		j.fail(err.Error())
+		return
+	}
+
+	var audioURL string
+	var audioSize int64
+	var loudness *models.LoudnessMetadata
+	audioData := resp.Data.Audio
+	marked := j.wantsWatermark()
+
+	if audioData != "" {
+		if strings.HasPrefix(audioData, "http") {
+			audioURL = audioData
+		} else {
+			audioBytes, err := hex.DecodeString(audioData)
+			if err != nil {
+				jobLog.Error("failed to decode audio", "error", err)
+				j.fail("Failed to decode audio data")
+				return
+			}
+
+			fileName := fmt.Sprintf("%d.mp3", generation.ID)
+			filePath := filepath.Join("uploads", "audio", fileName)
+
+			os.MkdirAll(filepath.Dir(filePath), 0755)
+
+			if err := os.WriteFile(filePath, audioBytes, 0644); err != nil {
+				jobLog.Error("failed to save audio", "error", err)
+				j.fail("Failed to save audio file")
+				return
+			}
+
+			audioURL = "/uploads/audio/" + fileName
+			audioSize = int64(len(audioBytes))
+			jobLog.Info("saved audio file", "file", fileName, "bytes", len(audioBytes))
+
+			if j.cfg.Loudness.Enabled && (req.Normalize == nil || *req.Normalize) {
+				// The unnormalized original of a watermarked track would be a
+				// clean copy anyone can fetch, so it isn't kept.
+				audioSize, loudness = j.normalizeLoudness(filePath, audioURL, req.Bitrate, audioSize, j.cfg.Loudness.KeepOriginal && !marked)
+			}
+		}
+	}
+
+	if marked && audioURL != "" {
+		audioURL, audioSize = j.applyWatermark(audioURL, audioSize, "mp3", func(in, out string) error {
+			return watermark.Audio(j.db.Statement.Context, j.cfg.FFmpegTimeout, in, out, req.Bitrate)
+		})
+	}
+
+	generation.OutputURL = audioURL
+	meta := models.GenerationMetadata{Provider: resp.ExtraInfo, Loudness: loudness}
+	if audioURL != "" {
+		j.measureDuration(audioURL, &meta)
+	}
+
+	// Step 2: Generate album art
+	j.hub.SendToUser(userID, fiber.Map{
+		"type":       "generation_progress",
+		"generation": generation.ToResponse(j.baseURL),
+		"request_id": requestID,
+		"message":    i18n.Translate(locale, "progress.creating_album_art", nil),
+		"step":       2,
+		"totalSteps": 2,
+	})
+
+	// Create album art prompt from style/genre
+	artPrompt := fmt.Sprintf("Album cover art, %s music, %s, modern design, professional artwork, high quality, artistic, beautiful colors",
+		req.Style, req.Title)
+
+	albumArtURL, err := provider.GenerateImage(artPrompt)
+	if err != nil {
+		jobLog.Warn("album art generation failed", "error", err)
+		// Use placeholder gradient based on genre
+		colors := []string{"6366f1", "8b5cf6", "ec4899", "f43f5e", "f97316", "eab308", "22c55e", "14b8a6", "06b6d4", "3b82f6"}
+		colorIdx := int(generation.ID) % len(colors)
+		generation.ThumbnailURL = fmt.Sprintf("https://placehold.co/400x400/%s/white?text=%s", colors[colorIdx], "♪")
+	} else {
+		generation.ThumbnailURL = albumArtURL
+		jobLog.Info("album art generated", "url", albumArtURL)
+	}
+
+	if !j.complete(services.Outcome{
+		Status:       models.StatusCompleted,
+		OutputURL:    audioURL,
+		OutputBytes:  audioSize,
+		ThumbnailURL: generation.ThumbnailURL,
+		Metadata:     meta,
+		Charge:       generation.CreditsCost,
+		Description:  "Music generation",
+	}, fiber.Map{"audioUrl": models.AbsoluteURL(j.baseURL, audioURL)}) {
+		return
+	}
+
+	jobLog.Info("music generation completed", "url", audioURL)
+}
+
+const loudnessFailedNote = "normalization failed; the file is not normalized"
+
+// normalizeLoudness replaces the music file at path, served at url, with
+// a loudness-normalized copy, keeping the original alongside if
+// keepOriginal. It returns the size of the file now at path and what to
+// record in the metadata. If normalization fails the original is put back
+// and the generation goes on with it.
+func (j *generationJob) normalizeLoudness(path, url string, bitrate int, size int64, keepOriginal bool) (int64, *models.LoudnessMetadata) {
+	originalURL := models.OriginalAudioURL(url)
+	originalPath := filepath.Join(filepath.Dir(path), filepath.Base(originalURL))
+	if err := os.Rename(path, originalPath); err != nil {
+		j.log.Warn("loudness normalization skipped", "error", err)
+		return size, &models.LoudnessMetadata{Note: loudnessFailedNote}
+	}
+
+	target := services.LoudnessTarget{Integrated: j.cfg.Loudness.Target, TruePeak: j.cfg.Loudness.TruePeak}
+	measured, err := services.NormalizeLoudness(j.db.Statement.Context, j.cfg.FFmpegTimeout, originalPath, path, target, bitrate)
+	if err != nil {
+		j.log.Warn("loudness normalization failed; keeping the original", "error", err)
+		if err := os.Rename(originalPath, path); err != nil {
+			j.log.Error("failed to restore the original audio", "error", err)
+		}
+		return size, &models.LoudnessMetadata{Note: loudnessFailedNote}
+	}
+
+	result := &models.LoudnessMetadata{Normalized: true, Measurements: measured}
+	if keepOriginal {
+		result.OriginalURL = originalURL
+	} else if err := os.Remove(originalPath); err != nil {
+		j.log.Warn("failed to delete the unnormalized audio", "error", err)
+	}
+	if info, err := os.Stat(path); err == nil {
+		size = info.Size()
+	}
+	j.log.Info("normalized audio loudness", "input_lufs", measured.InputLUFS, "output_lufs", measured.OutputLUFS)
+	return size, result
+}
+
+// measureDuration probes the track at url, stored here or hosted by the
+// provider, and records its length in seconds as the generation's
+// duration. When a length was asked for, meta gets the actual one and
+// whether the provider ignored the request. A failed probe leaves the
+// duration unknown.
+func (j *generationJob) measureDuration(url string, meta *models.GenerationMetadata) {
+	in := url
+	if strings.HasPrefix(url, "/uploads/") {
+		in = uploadsFile(url)
+	}
+	seconds, err := services.ProbeDuration(j.db.Statement.Context, j.cfg.FFmpegTimeout, in)
+	if err != nil {
+		j.log.Warn("failed to probe the track length", "error", err)
+		return
+	}
+	j.generation.Duration = int(math.Round(seconds))
+
+	requested := j.generation.RequestedDuration
+	if requested <= 0 {
+		return
+	}
+	actual := math.Round(seconds*10) / 10
+	mismatch := math.Abs(seconds-float64(requested)) > durationTolerance(requested)
+	meta.ActualDurationSeconds, meta.DurationMismatch = &actual, &mismatch
+	if mismatch {
+		j.log.Warn("track length differs from the one requested", "requested", requested, "actual", seconds)
+	}
+}
+
+// durationTolerance is how far, in seconds, a track may be from the
+// requested length before it counts as a mismatch: the provider only
+// takes the length as a hint, and a watermark tag adds a little.
+func durationTolerance(requested int) float64 {
+	return math.Max(5, float64(requested)/4)
+}
+
+func (j *generationJob) runVideo(req models.GenerateVideoRequest) {
+	defer j.done()
+
+	db, provider, jobLog := j.db, j.provider, j.log
+	generation := &j.generation
+	userID, requestID, locale := generation.UserID, j.requestID, j.locale
+	duration, resolution, model := generation.Duration, generation.Resolution, generation.Model
+
+	jobLog.Info("video generation started", "model", model)
+
+	j.hub.SendToUser(userID, fiber.Map{
+		"type":       "generation_progress",
+		"generation": generation.ToResponse(j.baseURL),
+		"request_id": requestID,
+		"message":    i18n.Translate(locale, "progress.generating_video", nil),
+		"step":       1,
+		"totalSteps": videoSteps(req.Narration),
+	})
+
+	resp, err := provider.GenerateVideo(req.Prompt, duration, resolution, model, generation.VideoAspectRatio())
+	if err != nil {
+		jobLog.Error("video generation request failed", "error", err)
+		j.fail(err.Error())
+		return
+	}
+
+	generation.MiniMaxJobID = resp.TaskID
+	db.Save(generation)
+	// Invalidate cache
+	invalidateGenerations(j.cache, userID)
+
+	j.awaitVideo(req.Narration, req.VoiceID)
+}
+
+// resumeVideo picks up an interrupted video job where it stopped: waiting
+// for MiniMax to finish the task it already accepted.
+func (j *generationJob) resumeVideo() {
+	defer j.done()
+
+	// Claim the row so that when several instances start together only one
+	// of them resumes it.
+	generation := &j.generation
+	claim := j.db.Model(&models.Generation{}).
+		Where("id = ? AND status = ?", generation.ID, models.StatusInterrupted).
+		Update("status", models.StatusProcessing)
+	if claim.Error != nil {
+		j.log.Error("failed to resume generation", "error", claim.Error)
+		return
+	}
+	if claim.RowsAffected == 0 {
+		return
+	}
+	generation.Status = models.StatusProcessing
+	invalidateGenerations(j.cache, generation.UserID)
+	j.log.Info("video generation resumed", "task_id", generation.MiniMaxJobID)
+
+	// Stored text was HTML-escaped on the way in; the provider needs the
+	// original.
+	j.awaitVideo(html.UnescapeString(generation.Narration), generation.VoiceID)
+}
+
+func videoSteps(narration string) int {
+	if narration != "" {
+		return 3
+	}
+	return 2
+}
+
+// awaitVideo waits for the submitted MiniMax task, adds the voiceover if
+// there is narration and settles the generation.
+func (j *generationJob) awaitVideo(narration, voiceID string) {
+	provider, jobLog := j.provider, j.log
+	generation := &j.generation
+	userID, requestID, locale := generation.UserID, j.requestID, j.locale
+	duration, model, creditCost := generation.Duration, generation.Model, generation.CreditsCost
+	taskID := generation.MiniMaxJobID
+
+	timeout := time.Duration(300) * time.Second
+	if model == "MiniMax-Hailuo-02" {
+		timeout = time.Duration(600) * time.Second
+	}
+
+	status, err := provider.WaitForCompletion(taskID, timeout)
+	if err != nil {
+		if j.interrupted() {
+			j.interrupt()
+			return
+		}
+		jobLog.Error("video processing failed", "task_id", taskID, "error", err)
+		j.fail(err.Error())
+		return
+	}
+
+	videoURL := status.File.DownloadURL
+	var videoSize int64
+	jobLog.Info("video generated", "url", videoURL)
+
+	if narration != "" {
+		j.hub.SendToUser(userID, fiber.Map{
+			"type":       "generation_progress",
+			"generation": generation.ToResponse(j.baseURL),
+			"request_id": requestID,
+			"message":    i18n.Translate(locale, "progress.generating_voiceover", nil),
+			"step":       2,
+			"totalSteps": 3,
+		})
+
+		optimalSpeed, _ := services.CalculateOptimalSpeed(narration, duration)
+		if optimalSpeed < 1.0 {
+			optimalSpeed = 1.0
+		}
+
+		ttsResp, err := provider.GenerateTTSWithSpeed(narration, voiceID, optimalSpeed)
+		if err != nil {
+			jobLog.Warn("tts failed", "error", err)
+			generation.ErrorMessage = "TTS failed: " + err.Error()
+		} else {
+			j.hub.SendToUser(userID, fiber.Map{
+				"type":       "generation_progress",
+				"generation": generation.ToResponse(j.baseURL),
+				"request_id": requestID,
+				"message":    i18n.Translate(locale, "progress.combining_voiceover", nil),
+				"step":       3,
+				"totalSteps": 3,
+			})
+
+			outputFileName := fmt.Sprintf("%d_with_audio.mp4", generation.ID)
+			outputPath := filepath.Join("uploads", "video", outputFileName)
+			os.MkdirAll(filepath.Dir(outputPath), 0755)
+
+			err = provider.CombineVideoWithAudio(videoURL, ttsResp.Data.Audio, outputPath, j.cfg.FFmpegTimeout)
+			if err != nil {
+				jobLog.Warn("combining video with voiceover failed", "error", err)
+				generation.ErrorMessage = "Combine failed: " + err.Error()
+			} else {
+				videoURL = "/uploads/video/" + outputFileName
+				if info, err := os.Stat(outputPath); err == nil {
+					videoSize = info.Size()
+				}
+			}
+		}
+	}
+
+	if j.wantsWatermark() {
+		videoURL, videoSize = j.applyWatermark(videoURL, videoSize, "mp4", func(in, out string) error {
+			return watermark.Video(j.db.Statement.Context, j.cfg.FFmpegTimeout, in, out)
+		})
+	}
+
+	generation.ThumbnailURL = j.videoThumbnail(videoURL)
+
+	// A failed voiceover still delivers the silent video; ErrorMessage
+	// says why the narration is missing.
+	if !j.complete(services.Outcome{
+		Status:       models.StatusCompleted,
+		OutputURL:    videoURL,
+		OutputBytes:  videoSize,
+		ThumbnailURL: generation.ThumbnailURL,
+		ErrorMessage: generation.ErrorMessage,
+		Charge:       creditCost,
+		Description:  "Video generation",
+	}, fiber.Map{"videoUrl": models.AbsoluteURL(j.baseURL, videoURL)}) {
+		return
+	}
+
+	jobLog.Info("video generation completed", "url", videoURL)
+}
+
+// videoThumbnail extracts a thumbnail from the video at url, stored here
+// or hosted by the provider, and returns its URL. It returns "" if that
+// fails; the video is delivered without one.
+func (j *generationJob) videoThumbnail(url string) string {
+	in := url
+	if strings.HasPrefix(url, "/uploads/") {
+		in = uploadsFile(url)
+	}
+	thumbnailURL := fmt.Sprintf("/uploads/thumbnails/%d.jpg", j.generation.ID)
+	path := uploadsFile(thumbnailURL)
+	os.MkdirAll(filepath.Dir(path), 0755)
+	if err := services.ExtractThumbnail(j.db.Statement.Context, j.cfg.FFmpegTimeout, in, path); err != nil {
+		j.log.Warn("thumbnail extraction failed", "error", err)
+		return ""
+	}
+	return thumbnailURL
+}
+
+// wantsWatermark reports whether the output gets watermarked: watermarking
+// is on and the owner is on the free plan now, as the job completes. If
+// the plan can't be looked up the output is left clean.
+func (j *generationJob) wantsWatermark() bool {
+	if !j.cfg.Watermark.Enabled {
+		return false
+	}
+	state, err := userstate.Get(j.db.Statement.Context, j.generation.UserID)
+	if err != nil {
+		j.log.Error("failed to look up the owner's plan; leaving the output unwatermarked", "error", err)
+		return false
+	}
+	return watermarkedPlan(state.Plan)
+}
+
+// watermarkedPlan reports whether outputs made on plan are watermarked.
+func watermarkedPlan(plan string) bool {
+	return plan == "" || models.PlanType(plan) == models.PlanFree
+}
+
+// applyWatermark watermarks the output at url with mark, which writes a
+// marked copy of in to out. An output still hosted by the provider is
+// downloaded first, under uploads with extension ext. The clean file is
+// kept at models.CleanMediaURL for a re-render. It returns the URL and
+// size to record; if anything fails the output is delivered unwatermarked.
+func (j *generationJob) applyWatermark(url string, size int64, ext string, mark func(in, out string) error) (string, int64) {
+	if strings.HasPrefix(url, "http") {
+		kind := "video"
+		if j.generation.Type == models.TypeMusic {
+			kind = "audio"
+		}
+		local := fmt.Sprintf("/uploads/%s/%d.%s", kind, j.generation.ID, ext)
+		path := uploadsFile(local)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := j.provider.DownloadOutput(url, path); err != nil {
+			j.log.Error("failed to download the output for watermarking; delivering it unwatermarked", "error", err)
+			return url, size
+		}
+		url = local
+	}
+
+	path, cleanPath := uploadsFile(url), uploadsFile(models.CleanMediaURL(url))
+	os.MkdirAll(filepath.Dir(cleanPath), 0755)
+	if err := os.Rename(path, cleanPath); err != nil {
+		j.log.Error("failed to set aside the clean output; delivering it unwatermarked", "error", err)
+		return url, fileSize(path, size)
+	}
+	if err := mark(cleanPath, path); err != nil {
+		j.log.Error("watermarking failed; delivering the output unwatermarked", "error", err)
+		if err := os.Rename(cleanPath, path); err != nil {
+			j.log.Error("failed to restore the clean output", "error", err)
+		}
+		return url, fileSize(path, size)
+	}
+
+	j.generation.Watermarked = true
+	j.log.Info("watermarked output", "url", url)
+	return url, fileSize(path, size)
+}
+
+// uploadsFile is the file behind an /uploads/ URL written by a job.
+func uploadsFile(url string) string {
+	return filepath.Join("uploads", filepath.FromSlash(strings.TrimPrefix(url, "/uploads/")))
+}
+
+// fileSize is the size of the file at path, or fallback if it can't be
+// read.
+func fileSize(path string, fallback int64) int64 {
+	if info, err := os.Stat(path); err == nil {
+		return info.Size()
+	}
+	return fallback
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/config"
+	"github.com/zesbe/lumina-ai/internal/i18n"
+	"github.com/zesbe/lumina-ai/internal/logger"
+	"github.com/zesbe/lumina-ai/internal/mail"
+	"github.com/zesbe/lumina-ai/internal/middleware"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+const (
+	// mediaLinkTTL is how long the media link in a completion email works.
+	mediaLinkTTL = 7 * 24 * time.Hour
+	// generationMailAttempts is how many times a completion email is
+	// tried, generationMailBackoff apart and doubling.
+	generationMailAttempts = 4
+	generationMailBackoff  = 30 * time.Second
+	// generationMailTimeout bounds every attempt and wait together.
+	generationMailTimeout = 10 * time.Minute
+)
+
+// mediaLinks signs links to a generation's media, so the one in a
+// completion email opens without logging in but can't be made up or
+// extended.
+type mediaLinks struct {
+	key []byte
+}
+
+func newMediaLinks(secret string) mediaLinks {
+	key := sha256.Sum256([]byte("generation-media:" + secret))
+	return mediaLinks{key: key[:]}
+}
+
+func (l mediaLinks) sign(id uint, expires int64) string {
+	mac := hmac.New(sha256.New, l.key)
+	fmt.Fprintf(mac, "%d.%d", id, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// query is the part of a media link that proves it was issued.
+func (l mediaLinks) query(id uint, expires time.Time) string {
+	unix := expires.Unix()
+	return "expires=" + strconv.FormatInt(unix, 10) + "&signature=" + l.sign(id, unix)
+}
+
+// GenerationMedia redirects whoever holds a valid link from a completion
+// email to the generation's output. Like a data export link it is the
+// credential, so it can be opened straight from the mail.
+func (h *Handlers) GenerationMedia() fiber.Handler {
+	links := newMediaLinks(h.cfg.JWTSecret)
+
+	return func(c *fiber.Ctx) error {
+		id, err := c.ParamsInt("id")
+		if err != nil || id <= 0 {
+			return notFound(c, "error.generation_not_found")
+		}
+		expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+		if err != nil || time.Now().Unix() > expires ||
+			!hmac.Equal([]byte(c.Query("signature")), []byte(links.sign(uint(id), expires))) {
+			return errorResponse(c, fiber.StatusForbidden, apierror.CodeInvalidToken, i18n.T(c, "error.media_link_invalid"))
+		}
+
+		var generation models.Generation
+		if err := requestDB(c, h.db).Select("id", "output_url").
+			Where("id = ? AND status = ? AND output_url <> ''", id, models.StatusCompleted).
+			First(&generation).Error; err != nil {
+			return notFound(c, "error.generation_not_found")
+		}
+
+		c.Set(fiber.HeaderCacheControl, "private, no-store")
+		return c.Redirect(models.AbsoluteURL(middleware.GetBaseURL(c), generation.OutputURL), fiber.StatusFound)
+	}
+}
+
+// mailGeneration emails the owner of a generation that just completed or
+// failed, unless they have a socket open to see it happen or turned the
+// email off. It is sent in the background, retried, and only logged when
+// it fails for good, so the generation is settled whatever happens to it.
+// Sockets are only known on this instance, so a user connected to
+// another one still gets the email. base is the API's public base URL, for
+// showing a thumbnail stored here. Shutdown cancels it through parent.
+func mailGeneration(parent context.Context, db *gorm.DB, cfg *config.Config, hub *WSHub, locale, base string, generation models.Generation) {
+	if hub.Connected(generation.UserID) {
+		return
+	}
+	log := logger.L().With("user_id", generation.UserID, "generation_id", generation.ID)
+
+	go func() {
+		ctx, cancel := context.WithTimeout(parent, generationMailTimeout)
+		defer cancel()
+		db := db.WithContext(ctx)
+
+		if !wantsNotification(db, generation.UserID, models.PrefGenerationCompleteEmail) {
+			return
+		}
+		var user models.User
+		if err := db.Select("id", "email", "is_active").First(&user, generation.UserID).Error; err != nil || !user.IsActive {
+			return
+		}
+
+		msg := generationMessage(cfg, locale, base, &generation)
+		msg.To = user.Email
+		if err := mail.SendRetrying(ctx, msg, generationMailAttempts, generationMailBackoff); err != nil {
+			log.Error("failed to send generation email", "status", generation.Status, "error", err)
+		}
+	}()
+}
+
+// generationMessage is the email about a finished generation, without a
+// recipient: a signed link to the media when it completed, a link to try
+// again when it failed.
+func generationMessage(cfg *config.Config, locale, base string, generation *models.Generation) mail.Message {
+	id := strconv.FormatUint(uint64(generation.ID), 10)
+	params := i18n.Params{
+		"title":       generationTitle(locale, generation),
+		"error":       generation.ErrorMessage,
+		"days":        int(mediaLinkTTL.Hours() / 24),
+		"unsubscribe": cfg.AppURL + "/unsubscribe?token=" + newUnsubscribeTokens(cfg.JWTSecret).issue(generation.UserID, models.PrefGenerationCompleteEmail),
+	}
+
+	key := "email.generation_completed"
+	if generation.Status == models.StatusFailed {
+		key = "email.generation_failed"
+		params["link"] = cfg.AppURL + "/generations/" + id + "/retry"
+	} else {
+		params["link"] = cfg.AppURL + "/media?id=" + id + "&" + newMediaLinks(cfg.JWTSecret).query(generation.ID, time.Now().Add(mediaLinkTTL))
+	}
+	// A thumbnail stored here can only be shown when the API's base URL
+	// is known.
+	params["thumbnail"] = ""
+	if thumbnail := models.AbsoluteURL(base, generation.ThumbnailURL); strings.HasPrefix(thumbnail, "https://") || strings.HasPrefix(thumbnail, "http://") {
+		params["thumbnail"] = i18n.Translate(locale, "email.generation_completed.thumbnail", i18n.Params{"url": thumbnail})
+	}
+
+	return mail.Message{
+		Subject: i18n.Translate(locale, key+".subject", params),
+		Body:    i18n.Translate(locale, key+".body", params),
+	}
+}
@@ -0,0 +1,651 @@
+package handlers
+
+import (
+	"context"
+	"sort"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"gorm.io/gorm"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/database"
+	"github.com/zesbe/lumina-ai/internal/i18n"
+	"github.com/zesbe/lumina-ai/internal/middleware"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+const (
+	// graphqlMaxDepth is how deeply a query may nest fields. The deepest
+	// the schema goes, me { stats { generations { by_type { count } } } },
+	// is five.
+	graphqlMaxDepth = 6
+	// graphqlMaxComplexity caps what a query may resolve. Every field
+	// costs one, and what is selected under a paged list costs once per
+	// item the page can hold.
+	graphqlMaxComplexity = 1500
+	// graphqlDefaultLimit is the page size the list fields default to, as
+	// the REST lists do.
+	graphqlDefaultLimit = 20
+)
+
+// GraphQL serves the dashboard's read-only queries (me, generations,
+// generation, creditTransactions and publicFeed) over the same queries and
+// caches as the REST endpoints. A query is parsed, validated and checked
+// against the depth and complexity limits before anything runs; one that
+// fails gets a 400 with GraphQL errors. Mutations stay REST-only.
+func (h *Handlers) GraphQL() fiber.Handler {
+	schema := h.graphqlSchema()
+	return func(c *fiber.Ctx) error {
+		var req models.GraphQLRequest
+		if apiErr := bindJSON(c, &req); apiErr != nil {
+			return apierror.Respond(c, apiErr)
+		}
+		if errs := middleware.ValidateRequest(c, &req); len(errs) > 0 {
+			return validationFailed(c, errs)
+		}
+
+		doc, err := parser.Parse(parser.ParseParams{Source: req.Query})
+		if err != nil {
+			return graphqlRefused(c, apierror.CodeBadRequest, gqlerrors.FormatError(err))
+		}
+		if result := graphql.ValidateDocument(&schema, doc, nil); !result.IsValid {
+			return graphqlRefused(c, apierror.CodeBadRequest, result.Errors...)
+		}
+		if apiErr := h.checkGraphQLQuery(c, doc, req.Variables); apiErr != nil {
+			details, _ := apiErr.Details.(fiber.Map)
+			return graphqlRefused(c, apiErr.Code, gqlerrors.FormattedError{Message: apiErr.Message, Extensions: details})
+		}
+
+		r := &graphqlRequest{
+			c:        c,
+			userID:   c.Locals("userID").(uint),
+			creators: &creatorLoader{db: database.Reader(requestDB(c, h.db), 0), names: map[uint]string{}},
+		}
+		return c.JSON(graphql.Execute(graphql.ExecuteParams{
+			Schema:        schema,
+			AST:           doc,
+			OperationName: req.OperationName,
+			Args:          req.Variables,
+			Context:       context.WithValue(c.UserContext(), graphqlRequestKey{}, r),
+		}))
+	}
+}
+
+// graphqlRefused answers a query that didn't run, in the shape GraphQL
+// clients read errors from rather than the REST one, with code in each
+// error's extensions.
+func graphqlRefused(c *fiber.Ctx, code apierror.Code, errs ...gqlerrors.FormattedError) error {
+	for i := range errs {
+		if errs[i].Extensions == nil {
+			errs[i].Extensions = map[string]interface{}{}
+		}
+		errs[i].Extensions["code"] = code
+	}
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errs})
+}
+
+// checkGraphQLQuery refuses every operation in doc that isn't a query,
+// introspection in production, and anything past graphqlMaxDepth or
+// graphqlMaxComplexity. Details hold the limit that was hit.
+func (h *Handlers) checkGraphQLQuery(c *fiber.Ctx, doc *ast.Document, variables map[string]interface{}) *apierror.Error {
+	cost := queryCost{
+		fragments: map[string]*ast.FragmentDefinition{},
+		variables: variables,
+		memo:      map[string][2]int{},
+	}
+	var operations []*ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		switch def := def.(type) {
+		case *ast.FragmentDefinition:
+			cost.fragments[def.Name.Value] = def
+		case *ast.OperationDefinition:
+			operations = append(operations, def)
+		}
+	}
+
+	for _, op := range operations {
+		if op.Operation != ast.OperationTypeQuery {
+			return apierror.New(fiber.StatusBadRequest, apierror.CodeBadRequest,
+				i18n.T(c, "error.graphql_mutations_unsupported")).With("operation", op.Operation)
+		}
+		depth, complexity := cost.selectionSet(op.SelectionSet)
+		if cost.introspection && h.cfg.Environment == "production" {
+			return apierror.New(fiber.StatusBadRequest, apierror.CodeBadRequest,
+				i18n.T(c, "error.graphql_introspection_disabled"))
+		}
+		if depth > graphqlMaxDepth {
+			return apierror.New(fiber.StatusBadRequest, apierror.CodeBadRequest,
+				i18n.T(c, "error.graphql_too_deep", i18n.Params{"depth": depth, "max": graphqlMaxDepth})).
+				With("depth", depth).With("max_depth", graphqlMaxDepth)
+		}
+		if complexity > graphqlMaxComplexity {
+			return apierror.New(fiber.StatusBadRequest, apierror.CodeBadRequest,
+				i18n.T(c, "error.graphql_too_complex", i18n.Params{"complexity": complexity, "max": graphqlMaxComplexity})).
+				With("complexity", complexity).With("max_complexity", graphqlMaxComplexity)
+		}
+	}
+	return nil
+}
+
+// queryCost measures selection sets for checkGraphQLQuery. Introspection
+// fields are only noted, not measured: their depth is the schema's, not
+// the client's, and they read no data.
+type queryCost struct {
+	fragments     map[string]*ast.FragmentDefinition
+	variables     map[string]interface{}
+	introspection bool
+	// memo holds the depth and cost of each fragment, so a fragment
+	// spread many times over is walked once.
+	memo map[string][2]int
+}
+
+// selectionSet returns how deeply set nests and what it costs. Validation
+// has already ruled out fragment cycles and unknown fragments.
+func (q *queryCost) selectionSet(set *ast.SelectionSet) (depth, cost int) {
+	if set == nil {
+		return 0, 0
+	}
+	for _, sel := range set.Selections {
+		var d, c int
+		switch sel := sel.(type) {
+		case *ast.Field:
+			if name := sel.Name.Value; name == "__schema" || name == "__type" {
+				q.introspection = true
+				continue
+			}
+			d, c = q.selectionSet(sel.SelectionSet)
+			d, c = d+1, 1+c*q.multiplier(sel)
+		case *ast.InlineFragment:
+			d, c = q.selectionSet(sel.SelectionSet)
+		case *ast.FragmentSpread:
+			name := sel.Name.Value
+			m, ok := q.memo[name]
+			if !ok {
+				m[0], m[1] = q.selectionSet(q.fragments[name].SelectionSet)
+				q.memo[name] = m
+			}
+			d, c = m[0], m[1]
+		}
+		depth = max(depth, d)
+		cost += c
+	}
+	return depth, cost
+}
+
+// multiplier is how many times what is selected under field may resolve:
+// the page size for a paged list and once for anything else. A limit the
+// resolver will refuse is still counted as asked.
+func (q *queryCost) multiplier(field *ast.Field) int {
+	if !graphqlPagedFields[field.Name.Value] {
+		return 1
+	}
+	for _, arg := range field.Arguments {
+		if arg.Name.Value != "limit" {
+			continue
+		}
+		switch v := arg.Value.(type) {
+		case *ast.IntValue:
+			if n, err := strconv.Atoi(v.Value); err == nil {
+				return max(n, 1)
+			}
+		case *ast.Variable:
+			// JSON numbers decode as float64.
+			if n, ok := q.variables[v.Name.Value].(float64); ok {
+				return max(int(n), 1)
+			}
+		}
+	}
+	return graphqlDefaultLimit
+}
+
+// graphqlPagedFields are the fields taking page and limit.
+var graphqlPagedFields = map[string]bool{"generations": true, "creditTransactions": true, "publicFeed": true}
+
+// graphqlRequest is what resolvers need of the HTTP request, found in
+// their context under graphqlRequestKey.
+type graphqlRequest struct {
+	c        *fiber.Ctx
+	userID   uint
+	creators *creatorLoader
+}
+
+type graphqlRequestKey struct{}
+
+func graphqlRequestFrom(p graphql.ResolveParams) *graphqlRequest {
+	return p.Context.Value(graphqlRequestKey{}).(*graphqlRequest)
+}
+
+// fail is a resolver error with the localized message under key and code
+// in its extensions, as the REST endpoints would answer.
+func (r *graphqlRequest) fail(status int, code apierror.Code, key string) error {
+	return graphqlError{apierror.New(status, code, i18n.T(r.c, key))}
+}
+
+// validate checks the arguments in args by their validate tags, as
+// bindQuery checks a query string.
+func (r *graphqlRequest) validate(args interface{}) error {
+	v := middleware.NewLocalizedValidator(i18n.Locale(r.c)).Struct(args)
+	if !v.HasErrors() {
+		return nil
+	}
+	return graphqlError{apierror.New(fiber.StatusBadRequest, apierror.CodeValidationFailed,
+		i18n.T(r.c, "error.validation_failed")).WithDetails(v.Errors())}
+}
+
+// graphqlError puts an API error's code and details in the extensions of
+// the GraphQL error it becomes.
+type graphqlError struct{ err *apierror.Error }
+
+func (e graphqlError) Error() string { return e.err.Message }
+
+func (e graphqlError) Extensions() map[string]interface{} {
+	ext := map[string]interface{}{"code": e.err.Code}
+	if e.err.Details != nil {
+		ext["details"] = e.err.Details
+	}
+	return ext
+}
+
+// creatorLoader batches the publicFeed creator lookups of one request.
+// Each creator field queues its user and returns a thunk; the executor
+// runs thunks only once the whole page is resolved, so the first to run
+// loads every queued user in one query.
+type creatorLoader struct {
+	db      *gorm.DB
+	pending []uint
+	names   map[uint]string
+	err     error
+}
+
+func (l *creatorLoader) load(userID uint) func() (interface{}, error) {
+	if _, ok := l.names[userID]; !ok {
+		l.pending = append(l.pending, userID)
+	}
+	return func() (interface{}, error) {
+		if len(l.pending) > 0 {
+			ids := l.pending
+			l.pending = nil
+			var users []models.User
+			l.err = l.db.Select("id", "name").Where("id IN ?", ids).Find(&users).Error
+			// A deleted creator stays without a name, as on Explore.
+			for _, id := range ids {
+				l.names[id] = ""
+			}
+			for _, u := range users {
+				l.names[u.ID] = u.Name
+			}
+		}
+		if l.err != nil {
+			return nil, l.err
+		}
+		return creatorView{Name: l.names[userID]}, nil
+	}
+}
+
+type creatorView struct {
+	Name string `json:"name"`
+}
+
+// feedItem is a publicFeed entry: the public response and, for the
+// creator field only, whose it is.
+type feedItem struct {
+	models.GenerationPublicResponse
+	userID uint
+}
+
+// Resolve reads every field but creator off the public response.
+func (f feedItem) Resolve(p graphql.ResolveParams) (interface{}, error) {
+	p.Source = f.GenerationPublicResponse
+	return graphql.DefaultResolveFn(p)
+}
+
+// meView is what me resolves to; stats are only computed when asked for.
+type meView struct {
+	User models.UserResponse
+}
+
+// countEntry is one entry of a map of counts, which GraphQL has no type
+// for.
+type countEntry struct {
+	Key   string `json:"key"`
+	Count int64  `json:"count"`
+}
+
+func countEntries[K ~string](counts map[K]int64) []countEntry {
+	entries := make([]countEntry, 0, len(counts))
+	for k, n := range counts {
+		entries = append(entries, countEntry{Key: string(k), Count: n})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries
+}
+
+// creditTransactionsArgs are the creditTransactions arguments.
+type creditTransactionsArgs struct {
+	Type  string `json:"type" validate:"max=20"`
+	Page  int    `json:"page" validate:"min=1"`
+	Limit int    `json:"limit" validate:"min=1,max=100"`
+}
+
+func stringArg(p graphql.ResolveParams, name string) string {
+	s, _ := p.Args[name].(string)
+	return s
+}
+
+func intArg(p graphql.ResolveParams, name string) int {
+	n, _ := p.Args[name].(int)
+	return n
+}
+
+func (h *Handlers) resolveMe(p graphql.ResolveParams) (interface{}, error) {
+	r := graphqlRequestFrom(p)
+	var user models.User
+	if err := requestDB(r.c, h.db).First(&user, r.userID).Error; err != nil {
+		return nil, r.fail(fiber.StatusNotFound, apierror.CodeNotFound, "error.user_not_found")
+	}
+	return meView{User: user.ToResponse()}, nil
+}
+
+func (h *Handlers) resolveStats(p graphql.ResolveParams) (interface{}, error) {
+	r := graphqlRequestFrom(p)
+	stats, err := profileStats(r.c, h.db, h.cache, r.userID)
+	if err != nil {
+		middleware.Log(r.c).Error("failed to compute profile stats", "error", err)
+		return nil, r.fail(fiber.StatusInternalServerError, apierror.CodeInternal, "error.fetch_my_stats_failed")
+	}
+	return stats, nil
+}
+
+func (h *Handlers) resolveGenerations(p graphql.ResolveParams) (interface{}, error) {
+	r := graphqlRequestFrom(p)
+	var req models.ListGenerationsRequest
+	req.Type, req.Status, req.Sort = stringArg(p, "type"), stringArg(p, "status"), stringArg(p, "sort")
+	req.Page, req.Limit = intArg(p, "page"), intArg(p, "limit")
+	if favorite, ok := p.Args["favorite"].(bool); ok {
+		req.Favorite = &favorite
+	}
+	if err := r.validate(&req); err != nil {
+		return nil, err
+	}
+	req.SetDefaults()
+
+	query := ownGenerationsQuery(requestDB(r.c, h.db), r.userID, &req)
+	total, _ := countGenerations(h.cache, query, generationsCountKey(r.userID, generationFilters(&req)), 0)
+
+	var generations []models.Generation
+	if err := query.Order(req.OrderBy()).Offset((req.Page - 1) * req.Limit).Limit(req.Limit).Find(&generations).Error; err != nil {
+		return nil, r.fail(fiber.StatusInternalServerError, apierror.CodeInternal, "error.fetch_generations_failed")
+	}
+	base := middleware.GetBaseURL(r.c)
+	items := make([]models.GenerationResponse, len(generations))
+	for i := range generations {
+		items[i] = generations[i].ToResponse(base)
+	}
+	return newPage(items, req.Page, req.Limit, total), nil
+}
+
+// resolveGeneration is null when the caller has no generation by that ID.
+func (h *Handlers) resolveGeneration(p graphql.ResolveParams) (interface{}, error) {
+	r := graphqlRequestFrom(p)
+	id, err := strconv.ParseUint(stringArg(p, "id"), 10, 32)
+	if err != nil {
+		return nil, r.fail(fiber.StatusBadRequest, apierror.CodeBadRequest, "error.invalid_generation_id")
+	}
+	var generation models.Generation
+	if err := requestDB(r.c, h.db).Where("id = ? AND user_id = ?", id, r.userID).Limit(1).Find(&generation).Error; err != nil {
+		return nil, r.fail(fiber.StatusInternalServerError, apierror.CodeInternal, "error.fetch_generations_failed")
+	}
+	if generation.ID == 0 {
+		return nil, nil
+	}
+	return generation.ToResponse(middleware.GetBaseURL(r.c)), nil
+}
+
+func (h *Handlers) resolveCreditTransactions(p graphql.ResolveParams) (interface{}, error) {
+	r := graphqlRequestFrom(p)
+	args := creditTransactionsArgs{Type: stringArg(p, "type"), Page: intArg(p, "page"), Limit: intArg(p, "limit")}
+	if err := r.validate(&args); err != nil {
+		return nil, err
+	}
+	if args.Page == 0 {
+		args.Page = 1
+	}
+	if args.Limit == 0 {
+		args.Limit = graphqlDefaultLimit
+	}
+
+	query := database.Reader(requestDB(r.c, h.db), r.userID).Model(&models.CreditTransaction{}).Where("user_id = ?", r.userID)
+	if args.Type != "" {
+		query = query.Where("type = ?", args.Type)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, r.fail(fiber.StatusInternalServerError, apierror.CodeInternal, "error.fetch_transactions_failed")
+	}
+	var transactions []models.CreditTransaction
+	if err := query.Order("created_at DESC, id DESC").Offset((args.Page - 1) * args.Limit).Limit(args.Limit).Find(&transactions).Error; err != nil {
+		return nil, r.fail(fiber.StatusInternalServerError, apierror.CodeInternal, "error.fetch_transactions_failed")
+	}
+	return newPage(transactions, args.Page, args.Limit, pageTotal{Total: total}), nil
+}
+
+// resolvePublicFeed lists what Explore does. Creators aren't preloaded:
+// the creator field batches them through the request's creatorLoader.
+func (h *Handlers) resolvePublicFeed(p graphql.ResolveParams) (interface{}, error) {
+	r := graphqlRequestFrom(p)
+	var req models.ListPublicGenerationsRequest
+	req.Type, req.Sort = stringArg(p, "type"), stringArg(p, "sort")
+	req.Page, req.Limit = intArg(p, "page"), intArg(p, "limit")
+	if err := r.validate(&req); err != nil {
+		return nil, err
+	}
+	req.SetDefaults()
+
+	query := publicGenerationsQuery(requestDB(r.c, h.db), req.Type)
+	total, _ := countGenerations(h.cache, query, "explore:count:"+req.Type, exploreCountCap)
+
+	var generations []models.Generation
+	if err := query.Order(req.OrderBy()).Offset((req.Page - 1) * req.Limit).Limit(req.Limit).Find(&generations).Error; err != nil {
+		return nil, r.fail(fiber.StatusInternalServerError, apierror.CodeInternal, "error.fetch_public_generations_failed")
+	}
+	base := middleware.GetBaseURL(r.c)
+	items := make([]feedItem, len(generations))
+	for i := range generations {
+		items[i] = feedItem{GenerationPublicResponse: generations[i].ToPublicResponse(base), userID: generations[i].UserID}
+	}
+	return newPage(items, req.Page, req.Limit, total), nil
+}
+
+func resolveCreator(p graphql.ResolveParams) (interface{}, error) {
+	return graphqlRequestFrom(p).creators.load(p.Source.(feedItem).userID), nil
+}
+
+// graphqlSchema builds the schema. Fields are named as in the REST
+// responses, so a dashboard can move a view over without renaming
+// anything.
+func (h *Handlers) graphqlSchema() graphql.Schema {
+	nonNull := graphql.NewNonNull
+	list := func(t graphql.Type) graphql.Output { return nonNull(graphql.NewList(nonNull(t))) }
+	enum := func(name string, values ...string) *graphql.Enum {
+		config := graphql.EnumValueConfigMap{}
+		for _, v := range values {
+			config[v] = &graphql.EnumValueConfig{Value: v}
+		}
+		return graphql.NewEnum(graphql.EnumConfig{Name: name, Values: config})
+	}
+	object := func(name string, fields graphql.Fields) *graphql.Object {
+		return graphql.NewObject(graphql.ObjectConfig{Name: name, Fields: fields})
+	}
+	scalars := func(types map[string]graphql.Output) graphql.Fields {
+		fields := graphql.Fields{}
+		for name, t := range types {
+			fields[name] = &graphql.Field{Type: t}
+		}
+		return fields
+	}
+
+	generationType := enum("GenerationType", string(models.TypeMusic), string(models.TypeVideo))
+	generationStatus := enum("GenerationStatus", string(models.StatusPending), string(models.StatusProcessing),
+		string(models.StatusCompleted), string(models.StatusFailed), string(models.StatusInterrupted))
+	sortOrder := enum("Sort", "newest", "oldest")
+
+	pagination := object("Pagination", scalars(map[string]graphql.Output{
+		"page":              nonNull(graphql.Int),
+		"limit":             nonNull(graphql.Int),
+		"total":             nonNull(graphql.Int),
+		"total_pages":       nonNull(graphql.Int),
+		"total_is_estimate": nonNull(graphql.Boolean),
+	}))
+	page := func(name string, item graphql.Type) *graphql.Object {
+		return object(name, graphql.Fields{
+			"items":      &graphql.Field{Type: list(item)},
+			"pagination": &graphql.Field{Type: nonNull(pagination)},
+		})
+	}
+	pageArgs := func(args graphql.FieldConfigArgument) graphql.FieldConfigArgument {
+		args["page"] = &graphql.ArgumentConfig{Type: graphql.Int}
+		args["limit"] = &graphql.ArgumentConfig{Type: graphql.Int}
+		return args
+	}
+
+	user := object("User", scalars(map[string]graphql.Output{
+		"id":                nonNull(graphql.ID),
+		"email":             nonNull(graphql.String),
+		"name":              nonNull(graphql.String),
+		"avatar":            graphql.String,
+		"role":              nonNull(graphql.String),
+		"plan":              nonNull(graphql.String),
+		"credits":           nonNull(graphql.Int),
+		"is_active":         nonNull(graphql.Boolean),
+		"is_verified":       nonNull(graphql.Boolean),
+		"publishing_banned": nonNull(graphql.Boolean),
+		"last_login_at":     graphql.DateTime,
+		"created_at":        nonNull(graphql.DateTime),
+	}))
+	count := object("Count", scalars(map[string]graphql.Output{
+		"key":   nonNull(graphql.String),
+		"count": nonNull(graphql.Int),
+	}))
+	generationCounts := object("GenerationCounts", graphql.Fields{
+		"total": &graphql.Field{Type: nonNull(graphql.Int)},
+		"by_type": &graphql.Field{Type: list(count), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return countEntries(p.Source.(models.GenerationCounts).ByType), nil
+		}},
+		"by_status": &graphql.Field{Type: list(count), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return countEntries(p.Source.(models.GenerationCounts).ByStatus), nil
+		}},
+	})
+	profileStats := object("ProfileStats", scalars(map[string]graphql.Output{
+		"generations":              nonNull(generationCounts),
+		"favorites":                nonNull(graphql.Int),
+		"credits_spent_this_month": nonNull(graphql.Int),
+		// Bytes pass what a GraphQL Int, 32 bits, can hold.
+		"storage_bytes": nonNull(graphql.Float),
+	}))
+	me := object("Me", graphql.Fields{
+		"user":  &graphql.Field{Type: nonNull(user)},
+		"stats": &graphql.Field{Type: profileStats, Resolve: h.resolveStats},
+	})
+
+	generation := object("Generation", scalars(map[string]graphql.Output{
+		"id":                 nonNull(graphql.ID),
+		"type":               nonNull(graphql.String),
+		"status":             nonNull(graphql.String),
+		"title":              nonNull(graphql.String),
+		"prompt":             nonNull(graphql.String),
+		"lyrics":             graphql.String,
+		"narration":          graphql.String,
+		"voice_id":           graphql.String,
+		"style":              graphql.String,
+		"duration":           graphql.Int,
+		"resolution":         graphql.String,
+		"model":              graphql.String,
+		"output_url":         graphql.String,
+		"thumbnail_url":      graphql.String,
+		"error_message":      graphql.String,
+		"credits_cost":       nonNull(graphql.Int),
+		"is_favorite":        nonNull(graphql.Boolean),
+		"is_public":          nonNull(graphql.Boolean),
+		"is_demo":            nonNull(graphql.Boolean),
+		"moderation_status":  graphql.String,
+		"watermarked":        nonNull(graphql.Boolean),
+		"aspect_ratio":       graphql.String,
+		"requested_duration": graphql.Int,
+		"created_at":         nonNull(graphql.DateTime),
+	}))
+	transaction := object("CreditTransaction", scalars(map[string]graphql.Output{
+		"id":             nonNull(graphql.ID),
+		"amount":         nonNull(graphql.Int),
+		"type":           nonNull(graphql.String),
+		"description":    nonNull(graphql.String),
+		"generation_id":  graphql.ID,
+		"balance_before": nonNull(graphql.Int),
+		"balance_after":  nonNull(graphql.Int),
+		"created_at":     nonNull(graphql.DateTime),
+	}))
+	creator := object("Creator", scalars(map[string]graphql.Output{
+		"name": nonNull(graphql.String),
+	}))
+	publicFields := scalars(map[string]graphql.Output{
+		"id":            nonNull(graphql.ID),
+		"type":          nonNull(graphql.String),
+		"title":         nonNull(graphql.String),
+		"style":         nonNull(graphql.String),
+		"duration":      nonNull(graphql.Int),
+		"output_url":    nonNull(graphql.String),
+		"thumbnail_url": nonNull(graphql.String),
+		"lyrics":        graphql.String,
+		"aspect_ratio":  graphql.String,
+		"created_at":    nonNull(graphql.DateTime),
+	})
+	publicFields["counts"] = &graphql.Field{Type: nonNull(object("EngagementCounts", scalars(map[string]graphql.Output{
+		"plays": nonNull(graphql.Int),
+	})))}
+	publicFields["creator"] = &graphql.Field{Type: nonNull(creator), Resolve: resolveCreator}
+	publicGeneration := object("PublicGeneration", publicFields)
+
+	query := object("Query", graphql.Fields{
+		"me": &graphql.Field{Type: nonNull(me), Resolve: h.resolveMe},
+		"generations": &graphql.Field{
+			Type: nonNull(page("GenerationPage", generation)),
+			Args: pageArgs(graphql.FieldConfigArgument{
+				"type":     &graphql.ArgumentConfig{Type: generationType},
+				"status":   &graphql.ArgumentConfig{Type: generationStatus},
+				"favorite": &graphql.ArgumentConfig{Type: graphql.Boolean},
+				"sort":     &graphql.ArgumentConfig{Type: sortOrder},
+			}),
+			Resolve: h.resolveGenerations,
+		},
+		"generation": &graphql.Field{
+			Type:    generation,
+			Args:    graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: nonNull(graphql.ID)}},
+			Resolve: h.resolveGeneration,
+		},
+		"creditTransactions": &graphql.Field{
+			Type: nonNull(page("CreditTransactionPage", transaction)),
+			Args: pageArgs(graphql.FieldConfigArgument{
+				"type": &graphql.ArgumentConfig{Type: graphql.String},
+			}),
+			Resolve: h.resolveCreditTransactions,
+		},
+		"publicFeed": &graphql.Field{
+			Type: nonNull(page("PublicGenerationPage", publicGeneration)),
+			Args: pageArgs(graphql.FieldConfigArgument{
+				"type": &graphql.ArgumentConfig{Type: generationType},
+				"sort": &graphql.ArgumentConfig{Type: sortOrder},
+			}),
+			Resolve: h.resolvePublicFeed,
+		},
+	})
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: query})
+	if err != nil {
+		panic("handlers: GraphQL schema: " + err.Error())
+	}
+	return schema
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+func TestQueryCost(t *testing.T) {
+	tests := []struct {
+		name          string
+		query         string
+		variables     map[string]interface{}
+		depth, cost   int
+		introspection bool
+	}{
+		{name: "one field", query: `{ me { user { id } } }`, depth: 3, cost: 3},
+		{name: "siblings add up", query: `{ me { user { id email } stats { favorites } } }`, depth: 3, cost: 6},
+		{name: "default page size", query: `{ generations { items { id title } } }`, depth: 3, cost: 1 + 20*3},
+		{name: "literal limit", query: `{ generations(limit: 5) { items { id } pagination { total } } }`, depth: 3, cost: 1 + 5*4},
+		{name: "variable limit", query: `query($n: Int) { publicFeed(limit: $n) { items { creator { name } } } }`,
+			variables: map[string]interface{}{"n": float64(50)}, depth: 4, cost: 1 + 50*3},
+		{name: "unset variable limit", query: `query($n: Int) { creditTransactions(limit: $n) { items { id } } }`, depth: 3, cost: 1 + 20*2},
+		{name: "limit below one", query: `{ generations(limit: 0) { items { id } } }`, depth: 3, cost: 1 + 2},
+		{name: "lists multiply when nested", query: `{ generations(limit: 10) { items { generations(limit: 10) { items { id } } } } }`,
+			depth: 5, cost: 1 + 10*(1+1+10*2)},
+		{name: "fragments count where spread", query: `{ a: generations(limit: 2) { ...page } b: generations(limit: 3) { ...page } }
+			fragment page on GenerationPage { items { id title } }`, depth: 3, cost: (1 + 2*3) + (1 + 3*3)},
+		{name: "inline fragments", query: `{ me { ... on Me { user { id } } } }`, depth: 3, cost: 3},
+		{name: "introspection isn't measured", query: `{ __schema { types { fields { type { ofType { name } } } } } me { user { id } } }`,
+			depth: 3, cost: 3, introspection: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := parser.Parse(parser.ParseParams{Source: tt.query})
+			if err != nil {
+				t.Fatal(err)
+			}
+			q := queryCost{fragments: map[string]*ast.FragmentDefinition{}, variables: tt.variables, memo: map[string][2]int{}}
+			var op *ast.OperationDefinition
+			for _, def := range doc.Definitions {
+				switch def := def.(type) {
+				case *ast.FragmentDefinition:
+					q.fragments[def.Name.Value] = def
+				case *ast.OperationDefinition:
+					op = def
+				}
+			}
+			depth, cost := q.selectionSet(op.SelectionSet)
+			if depth != tt.depth || cost != tt.cost || q.introspection != tt.introspection {
+				t.Errorf("depth %d, cost %d, introspection %v; want %d, %d, %v", depth, cost, q.introspection, tt.depth, tt.cost, tt.introspection)
+			}
+		})
+	}
+}
+
+// TestQueryCostFragmentFanOut checks that fragments spreading one another
+// many times over are measured without walking every expansion.
+func TestQueryCostFragmentFanOut(t *testing.T) {
+	query := `{ me { ...f0 } }`
+	const levels = 40
+	for i := 0; i < levels; i++ {
+		query += ` fragment f` + strconv.Itoa(i) + ` on Me { ...f` + strconv.Itoa(i+1) + ` ...f` + strconv.Itoa(i+1) + ` }`
+	}
+	query += ` fragment f` + strconv.Itoa(levels) + ` on Me { user { id } }`
+
+	doc, err := parser.Parse(parser.ParseParams{Source: query})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := queryCost{fragments: map[string]*ast.FragmentDefinition{}, memo: map[string][2]int{}}
+	for _, def := range doc.Definitions {
+		if def, ok := def.(*ast.FragmentDefinition); ok {
+			q.fragments[def.Name.Value] = def
+		}
+	}
+	depth, cost := q.selectionSet(doc.Definitions[0].(*ast.OperationDefinition).SelectionSet)
+	if depth != 3 || cost <= graphqlMaxComplexity {
+		t.Errorf("depth %d, cost %d; want 3 and past the limit", depth, cost)
+	}
+}
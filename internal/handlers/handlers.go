@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"gorm.io/gorm"
+
+	"github.com/zesbe/lumina-ai/internal/auth"
+	"github.com/zesbe/lumina-ai/internal/cache"
+	"github.com/zesbe/lumina-ai/internal/config"
+	"github.com/zesbe/lumina-ai/internal/services"
+)
+
+// Handlers holds what the route handlers share, built once when the app
+// is. Every route's handler is a method on it, including the few that
+// need none of it, so routes.go wires them all alike. Uploads go to the
+// local filesystem at cfg.UploadPath, so storage isn't a field. The services
+// with state of their own (audit, moderation, disposable, captcha, flags,
+// apikey, userstate, mail, settings and maintenance) aren't fields either:
+// app.Init sets them up once per process and handlers call them directly.
+type Handlers struct {
+	db  *gorm.DB
+	cfg *config.Config
+	// cache is nil when Redis isn't configured; responses are then built
+	// fresh every time.
+	cache   *cache.RedisCache
+	minimax *services.MiniMaxService
+	jwt     *auth.JWTService
+	hub     *WSHub
+	jobs    *jobTracker
+}
+
+// New builds the handlers over db and cfg, caching in redis if not nil and
+// generating through minimax, with one JWT service and WebSocket hub for
+// all of them.
+func New(db *gorm.DB, cfg *config.Config, redis *cache.RedisCache, minimax *services.MiniMaxService) *Handlers {
+	return &Handlers{
+		db:      db,
+		cfg:     cfg,
+		cache:   redis,
+		minimax: minimax,
+		jwt:     auth.NewJWTService(cfg.JWTKeys, cfg.JWTExpiry, cfg.JWTRefreshExpiry),
+		hub:     NewHub(),
+		jobs:    newJobTracker(),
+	}
+}
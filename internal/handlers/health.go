@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/zesbe/lumina-ai/internal/health"
+)
+
+// readyCacheTTL is how long a readiness result is reused, so probes can't
+// turn into a flood of database and Redis round trips.
+const readyCacheTTL = 2 * time.Second
+
+// LiveCheck only says the process is serving requests; restart it if this
+// fails.
+func (h *Handlers) LiveCheck() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"status": "alive"})
+	}
+}
+
+// ReadyCheck reports whether this instance should receive traffic: 503
+// when a required dependency (the database) is down, 200 with degraded
+// entries when optional ones are missing or too many generations are
+// running. Dependency results are cached for a couple of seconds and
+// concurrent probes share one check.
+func (h *Handlers) ReadyCheck() fiber.Handler {
+	var (
+		mu   sync.Mutex
+		last health.Report
+	)
+
+	return func(c *fiber.Ctx) error {
+		mu.Lock()
+		if time.Since(last.CheckedAt) >= readyCacheTTL {
+			last = health.Check(c.UserContext(), h.db, h.cfg)
+		}
+		result := last
+		mu.Unlock()
+
+		// The job count is cheap and changes faster than the cache
+		// lives, so it is read on every probe.
+		checks := make(map[string]health.Dependency, len(result.Checks)+1)
+		for name, check := range result.Checks {
+			checks[name] = check
+		}
+		checks["generations"] = health.Generations(h.jobs.active.Load(), int64(h.cfg.MaxActiveGenerations))
+		result.Checks = checks
+
+		code := fiber.StatusOK
+		if result.Status != "ready" {
+			code = fiber.StatusServiceUnavailable
+		}
+		return c.Status(code).JSON(result)
+	}
+}
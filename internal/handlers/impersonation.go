@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/audit"
+	"github.com/zesbe/lumina-ai/internal/i18n"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+// Impersonate issues a short-lived access token that lets an admin see the
+// API as :userID does. The token can't be refreshed, is refused by
+// password and billing endpoints, and every request made with it is
+// audited against the admin.
+func (h *Handlers) Impersonate() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		adminID := c.Locals("userID").(uint)
+
+		userID, err := strconv.ParseUint(c.Params("userID"), 10, 32)
+		if err != nil {
+			return badRequest(c, "error.invalid_user_id")
+		}
+
+		var user models.User
+		if err := requestDB(c, h.db).Where("id = ? AND is_active = ?", userID, true).First(&user).Error; err != nil {
+			return notFound(c, "error.user_not_found")
+		}
+
+		if user.Role == "admin" {
+			return errorResponse(c, fiber.StatusForbidden, apierror.CodeForbidden, i18n.T(c, "error.cannot_impersonate_admin"))
+		}
+
+		token, expiresAt, err := h.jwt.GenerateImpersonationToken(user.ID, user.Email, user.Role, user.Plan, adminID)
+		if err != nil {
+			return internalError(c, "error.generate_tokens_failed")
+		}
+
+		audit.Record(c, models.AuditImpersonationStart, audit.User(user.ID), fiber.Map{
+			"expires_at": expiresAt.Unix(),
+		})
+
+		return c.JSON(fiber.Map{
+			"user": user.ToResponse(),
+			"token": fiber.Map{
+				"access_token":  token,
+				"expires_at":    expiresAt.Unix(),
+				"token_type":    "Bearer",
+				"impersonation": true,
+			},
+		})
+	}
+}
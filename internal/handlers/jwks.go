@@ -0,0 +1,15 @@
+package handlers
+
+import "github.com/gofiber/fiber/v2"
+
+// JWKS publishes the public keys tokens are signed with, so other
+// services can verify them without the secret. Keys only change on a
+// restart, so the document is built once.
+func (h *Handlers) JWKS() fiber.Handler {
+	set := h.cfg.JWTKeys.JWKS()
+
+	return func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+		return c.JSON(set)
+	}
+}
@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+// loginHistoryLimit is how many of the latest login attempts are shown.
+const loginHistoryLimit = 50
+
+// LoginHistory lists the caller's latest login attempts, successful or
+// not, newest first.
+func (h *Handlers) LoginHistory() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+
+		var events []models.LoginEvent
+		if err := requestDB(c, h.db).Where("user_id = ?", userID).
+			Order("created_at DESC").Limit(loginHistoryLimit).Find(&events).Error; err != nil {
+			return internalError(c, "error.fetch_login_history_failed")
+		}
+		return c.JSON(fiber.Map{"events": events})
+	}
+}
@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/audit"
+	"github.com/zesbe/lumina-ai/internal/crypto"
+	"github.com/zesbe/lumina-ai/internal/disposable"
+	"github.com/zesbe/lumina-ai/internal/i18n"
+	"github.com/zesbe/lumina-ai/internal/lockout"
+	"github.com/zesbe/lumina-ai/internal/logger"
+	"github.com/zesbe/lumina-ai/internal/mail"
+	"github.com/zesbe/lumina-ai/internal/middleware"
+	"github.com/zesbe/lumina-ai/internal/models"
+	"github.com/zesbe/lumina-ai/internal/session"
+)
+
+const (
+	// magicLinkTTL is how long a mailed sign-in link works.
+	magicLinkTTL = 10 * time.Minute
+	// magicLinkCooldown is how soon another link is mailed to the same
+	// address; requests in between are answered but send nothing.
+	magicLinkCooldown = time.Minute
+	magicLinkMethod   = "magic_link"
+)
+
+var errMagicLinkInvalid = errors.New("magic link invalid")
+
+// RequestMagicLink mails a sign-in link to an account's address, or a
+// sign-up link to an unknown one when register is set. The answer is the
+// same whether or not anything was sent, and the mail goes out after it,
+// so neither the body nor the timing tells which addresses have accounts.
+func (h *Handlers) RequestMagicLink() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.MagicLinkRequest
+		if apiErr := bindJSON(c, &req); apiErr != nil {
+			return apierror.Respond(c, apiErr)
+		}
+
+		if errs := middleware.ValidateRequest(c, &req); len(errs) > 0 {
+			return validationFailed(c, errs)
+		}
+		email := models.NormalizeEmail(req.Email)
+		// Checked before the lookup so the answer doesn't depend on
+		// whether the address has an account.
+		if req.Register {
+			if verdict := disposable.Check(c.UserContext(), email); verdict != nil {
+				return disposableEmail(c, "magic_link", verdict)
+			}
+		}
+
+		sent := fiber.Map{"message": i18n.T(c, "message.magic_link_sent", i18n.Params{"email": email})}
+
+		// Deleted accounts still hold their address until they are
+		// purged, so they are looked up too, and get nothing.
+		var user models.User
+		err := requestDB(c, h.db).Unscoped().Where("LOWER(email) = LOWER(?) AND email_conflict_with IS NULL", email).First(&user).Error
+		var target audit.Target
+		switch {
+		case err == nil:
+			if !user.IsActive || user.DeletedAt.Valid {
+				return c.JSON(sent)
+			}
+			email, target = user.Email, audit.User(user.ID)
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if !req.Register {
+				audit.RecordAs(c, nil, models.AuditMagicLinkRequest, audit.Target{Type: "email", ID: email}, fiber.Map{"reason": "unknown_user"})
+				return c.JSON(sent)
+			}
+			target = audit.Target{Type: "email", ID: email}
+		default:
+			return internalError(c, "error.magic_link_failed")
+		}
+
+		var recent int64
+		if err := requestDB(c, h.db).Model(&models.MagicLink{}).
+			Where("LOWER(email) = LOWER(?) AND consumed_at IS NULL AND created_at > ?", email, time.Now().Add(-magicLinkCooldown)).
+			Count(&recent).Error; err != nil {
+			return internalError(c, "error.magic_link_failed")
+		}
+		if recent > 0 {
+			return c.JSON(sent)
+		}
+
+		token, err := crypto.GenerateRandomToken(32)
+		if err != nil {
+			return internalError(c, "error.magic_link_failed")
+		}
+		link := models.MagicLink{
+			Email:     email,
+			TokenHash: crypto.HashToken(token),
+			Register:  target.Type == "email",
+			ExpiresAt: time.Now().Add(magicLinkTTL),
+		}
+		if h.cfg.MagicLinkBindIP {
+			link.Fingerprint = networkFingerprint(c.IP())
+		}
+		if err := requestDB(c, h.db).Create(&link).Error; err != nil {
+			middleware.Log(c).Error("failed to store magic link", "error", err)
+			return internalError(c, "error.magic_link_failed")
+		}
+
+		key := "email.magic_link"
+		if link.Register {
+			key = "email.magic_link_signup"
+		}
+		msg := mail.Message{
+			To:      email,
+			Subject: i18n.T(c, key+".subject"),
+			Body: i18n.T(c, key+".body", i18n.Params{
+				"link":    h.cfg.AppURL + "/magic-link?token=" + url.QueryEscape(token),
+				"minutes": int(magicLinkTTL.Minutes()),
+			}),
+		}
+		go func() {
+			ctx, cancel := context.WithTimeout(h.jobs.ctx, 30*time.Second)
+			defer cancel()
+			if err := mail.Send(ctx, msg); err != nil {
+				logger.L().Error("failed to send magic link", "error", err)
+			}
+		}()
+
+		audit.RecordAs(c, nil, models.AuditMagicLinkRequest, target, fiber.Map{"register": link.Register})
+
+		return c.JSON(sent)
+	}
+}
+
+// VerifyMagicLink consumes a mailed link and signs its owner in, creating
+// the account first for a sign-up link. Following the link proves the
+// address, so the account ends up verified either way.
+func (h *Handlers) VerifyMagicLink() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.MagicLinkVerifyRequest
+		if apiErr := bindJSON(c, &req); apiErr != nil {
+			return apierror.Respond(c, apiErr)
+		}
+
+		if errs := middleware.ValidateRequest(c, &req); len(errs) > 0 {
+			return validationFailed(c, errs)
+		}
+
+		var user models.User
+		var created bool
+		err := requestDB(c, h.db).Transaction(func(tx *gorm.DB) error {
+			now := time.Now()
+			var link models.MagicLink
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("token_hash = ? AND consumed_at IS NULL AND expires_at > ?", crypto.HashToken(req.Token), now).
+				First(&link).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return errMagicLinkInvalid
+				}
+				return err
+			}
+			// Left unconsumed, so the owner can still use it from the
+			// network it was asked for on.
+			if link.Fingerprint != "" && link.Fingerprint != networkFingerprint(c.IP()) {
+				return errMagicLinkInvalid
+			}
+			if err := tx.Model(&link).Update("consumed_at", now).Error; err != nil {
+				return err
+			}
+
+			err := tx.Unscoped().Where("LOWER(email) = LOWER(?) AND email_conflict_with IS NULL", link.Email).First(&user).Error
+			switch {
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				if !link.Register {
+					return errMagicLinkInvalid
+				}
+				user = models.User{
+					Email:      link.Email,
+					Name:       emailName(link.Email),
+					Role:       "user",
+					Plan:       "free",
+					Credits:    10,
+					IsActive:   true,
+					IsVerified: true,
+				}
+				if err := tx.Create(&user).Error; err != nil {
+					return err
+				}
+				created = true
+				return nil
+			case err != nil:
+				return err
+			case !user.IsActive || user.DeletedAt.Valid:
+				return errAccountDisabled
+			case !user.IsVerified:
+				return tx.Model(&user).Update("is_verified", true).Error
+			}
+			return nil
+		})
+		switch {
+		case errors.Is(err, errMagicLinkInvalid):
+			return errorResponse(c, fiber.StatusBadRequest, apierror.CodeInvalidToken, i18n.T(c, "error.magic_link_invalid"))
+		case errors.Is(err, errAccountDisabled):
+			audit.RecordAs(c, nil, models.AuditLoginFailed, audit.User(user.ID), fiber.Map{"reason": "inactive", "method": magicLinkMethod})
+			audit.RecordLogin(c, user.ID, magicLinkMethod, models.LoginFailed, "inactive")
+			return errorResponse(c, fiber.StatusForbidden, apierror.CodeForbidden, i18n.T(c, "error.account_disabled"))
+		case err != nil:
+			middleware.Log(c).Error("failed to sign in with magic link", "error", err)
+			return internalError(c, "error.magic_link_failed")
+		}
+
+		tokens, err := h.startSession(c, &user)
+		if err != nil {
+			return internalError(c, "error.generate_tokens_failed")
+		}
+
+		now := time.Now()
+		requestDB(c, h.db).Model(&user).Update("last_login_at", now)
+		// Getting in by mail says nothing about the password, but whoever
+		// was locked out is the owner now.
+		if err := lockout.Reset(user.ID); err != nil {
+			middleware.Log(c).Warn("failed to reset login failures", "error", err)
+		}
+
+		audit.RecordAs(c, &user.ID, models.AuditLogin, audit.User(user.ID), fiber.Map{"method": magicLinkMethod, "created": created})
+		audit.RecordLogin(c, user.ID, magicLinkMethod, models.LoginSucceeded, "")
+
+		status := fiber.StatusOK
+		if created {
+			status = fiber.StatusCreated
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"message": i18n.T(c, "message.logged_in"),
+			"user":    user.ToResponse(),
+			"tokens":  tokens,
+		})
+	}
+}
+
+// networkFingerprint hashes the network prefix around ip, so links don't
+// store where they were asked for.
+func networkFingerprint(ip string) string {
+	sum := sha256.Sum256([]byte(session.NetworkPrefix(ip)))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/audit"
+	"github.com/zesbe/lumina-ai/internal/maintenance"
+	"github.com/zesbe/lumina-ai/internal/middleware"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+func (h *Handlers) GetMaintenance() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{
+			"maintenance": maintenance.Current(),
+		})
+	}
+}
+
+// SetMaintenance flips the maintenance switch for every instance. While it
+// is on, non-admin traffic gets a 503 and no new generations start;
+// generations already running are left to finish.
+func (h *Handlers) SetMaintenance() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.SetMaintenanceRequest
+		if apiErr := bindJSON(c, &req); apiErr != nil {
+			return apierror.Respond(c, apiErr)
+		}
+
+		if errs := middleware.ValidateRequest(c, &req); len(errs) > 0 {
+			return validationFailed(c, errs)
+		}
+
+		state := maintenance.State{
+			Enabled: req.Enabled,
+			Message: req.Message,
+			ETA:     req.ETA,
+		}
+		if previous := maintenance.Current(); previous.Enabled && state.Enabled {
+			// Updating the message or ETA doesn't restart the clock.
+			state.StartedAt = previous.StartedAt
+		}
+		if err := maintenance.Set(state); err != nil {
+			middleware.Log(c).Error("failed to store maintenance state", "error", err)
+			return internalError(c, "error.save_maintenance_failed")
+		}
+
+		audit.Record(c, models.AuditMaintenanceChange, audit.Target{Type: "maintenance", ID: "global"}, fiber.Map{
+			"enabled": req.Enabled,
+			"message": req.Message,
+			"eta":     req.ETA,
+		})
+
+		return c.JSON(fiber.Map{
+			"maintenance": maintenance.Current(),
+		})
+	}
+}
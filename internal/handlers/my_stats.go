@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"github.com/zesbe/lumina-ai/internal/database"
+	"github.com/zesbe/lumina-ai/internal/middleware"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+const (
+	// myStatsTTL is how long a user's stats are cached. The key sits under
+	// generations:<user>: so generation writes clear it sooner.
+	myStatsTTL       = 10 * time.Minute
+	myStatsTopStyles = 5
+)
+
+// myStatsPeriods are the periods GetMyStats covers, back from the end of
+// today.
+var myStatsPeriods = map[string]func(time.Time) time.Time{
+	"30d": func(t time.Time) time.Time { return t.AddDate(0, 0, -30) },
+	"90d": func(t time.Time) time.Time { return t.AddDate(0, 0, -90) },
+	"1y":  func(t time.Time) time.Time { return t.AddDate(-1, 0, 0) },
+}
+
+// GetMyStats is the caller's own activity over a period, for graphs on
+// their profile: generations per bucket by type and status, credits spent
+// per bucket, success rate, top styles and how long generations take.
+// Every bucket in the period is listed, empty ones as zeros.
+//
+// period is 30d (default), 90d or 1y; granularity is day (default) or
+// week, with weeks starting on Monday; tz is an IANA time zone for the
+// bucket boundaries and defaults to UTC. This is not the admin analytics:
+// it only ever sees the caller's rows.
+func (h *Handlers) GetMyStats() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+
+		period := c.Query("period", "30d")
+		start, ok := myStatsPeriods[period]
+		if !ok {
+			return badRequest(c, "error.invalid_stats_period")
+		}
+		granularity := c.Query("granularity", "day")
+		if granularity != "day" && granularity != "week" {
+			return badRequest(c, "error.invalid_granularity")
+		}
+		tz := c.Query("tz", "UTC")
+		loc, err := time.LoadLocation(tz)
+		if err != nil || tz == "Local" || tz == "" {
+			return badRequest(c, "error.invalid_timezone")
+		}
+
+		now := time.Now().In(loc)
+		to := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, loc)
+		from := start(to)
+
+		cacheKey := fmt.Sprintf("generations:%d:stats:%s:%s:%s:%d", userID, period, granularity, loc, to.Unix())
+		if h.cache != nil {
+			var cached fiber.Map
+			if err := h.cache.Get(cacheKey, &cached); err == nil {
+				return c.JSON(cached)
+			}
+		}
+
+		result, err := buildMyStats(database.Reader(requestDB(c, h.db), userID), userID, from, to, granularity, loc)
+		if err != nil {
+			middleware.Log(c).Error("personal stats query failed", "error", err)
+			return internalError(c, "error.fetch_my_stats_failed")
+		}
+
+		if h.cache != nil {
+			h.cache.Set(cacheKey, result, myStatsTTL)
+		}
+		return c.JSON(result)
+	}
+}
+
+func buildMyStats(db *gorm.DB, userID uint, from, to time.Time, granularity string, loc *time.Location) (fiber.Map, error) {
+	// Buckets start at midnight in loc. date_trunc works on the local wall
+	// clock time, which comes back as a timestamp without a zone.
+	bucket := fmt.Sprintf("date_trunc('%s', created_at AT TIME ZONE ?)", granularity)
+	tz := loc.String()
+
+	var generations []generationBucket
+	if err := db.Model(&models.Generation{}).
+		Select(bucket+" AS bucket, type, status, COUNT(*) AS count", tz).
+		Where("user_id = ? AND created_at >= ? AND created_at < ?", userID, from, to).
+		Group("bucket, type, status").Order("bucket").
+		Scan(&generations).Error; err != nil {
+		return nil, err
+	}
+
+	// Usage rows are negative and refunds give them back, so the net of
+	// the two is what the bucket's generations cost.
+	var credits []bucketCount
+	if err := db.Model(&models.CreditTransaction{}).
+		Select(bucket+" AS bucket, COALESCE(-SUM(amount), 0) AS count", tz).
+		Where("user_id = ? AND type IN ? AND created_at >= ? AND created_at < ?", userID, []string{"usage", "refund"}, from, to).
+		Group("bucket").Order("bucket").
+		Scan(&credits).Error; err != nil {
+		return nil, err
+	}
+
+	var styles []styleCount
+	if err := db.Model(&models.Generation{}).
+		Select("style, COUNT(*) AS count").
+		Where("user_id = ? AND created_at >= ? AND created_at < ? AND style <> ''", userID, from, to).
+		Group("style").Order("count DESC, style").Limit(myStatsTopStyles).
+		Scan(&styles).Error; err != nil {
+		return nil, err
+	}
+
+	// Only generations that recorded when they completed have a duration.
+	var duration struct {
+		Average *float64
+	}
+	if err := db.Model(&models.Generation{}).
+		Select("AVG(EXTRACT(EPOCH FROM completed_at - created_at)) AS average").
+		Where("user_id = ? AND created_at >= ? AND created_at < ? AND completed_at IS NOT NULL", userID, from, to).
+		Scan(&duration).Error; err != nil {
+		return nil, err
+	}
+
+	// analyticsBuckets lists UTC days; giving it the local dates as if
+	// they were UTC lists the local days, which is what date_trunc returns.
+	buckets := analyticsBuckets(wallClockUTC(from), wallClockUTC(to), granularity)
+
+	byBucket := make(map[string]fiber.Map, len(buckets))
+	generationSeries := make([]fiber.Map, len(buckets))
+	for i, b := range buckets {
+		entry := fiber.Map{
+			"date":      b,
+			"total":     int64(0),
+			"by_type":   fiber.Map{string(models.TypeMusic): int64(0), string(models.TypeVideo): int64(0)},
+			"by_status": fiber.Map{},
+		}
+		byBucket[b] = entry
+		generationSeries[i] = entry
+	}
+	byType := fiber.Map{string(models.TypeMusic): int64(0), string(models.TypeVideo): int64(0)}
+	var total, completed, failed int64
+	for _, g := range generations {
+		total += g.Count
+		addCount(byType, string(g.Type), g.Count)
+		switch g.Status {
+		case models.StatusCompleted:
+			completed += g.Count
+		case models.StatusFailed:
+			failed += g.Count
+		}
+		entry, ok := byBucket[formatBucket(g.Bucket)]
+		if !ok {
+			continue
+		}
+		entry["total"] = entry["total"].(int64) + g.Count
+		addCount(entry["by_type"].(fiber.Map), string(g.Type), g.Count)
+		addCount(entry["by_status"].(fiber.Map), string(g.Status), g.Count)
+	}
+
+	// The success rate is over the generations that finished; without any
+	// it is null rather than a made-up 0 or 1.
+	var successRate *float64
+	if completed+failed > 0 {
+		rate := float64(completed) / float64(completed+failed)
+		successRate = &rate
+	}
+
+	var creditsSpent int64
+	for _, b := range credits {
+		creditsSpent += b.Count
+	}
+
+	topStyles := make([]fiber.Map, len(styles))
+	for i, s := range styles {
+		topStyles[i] = fiber.Map{"style": s.Style, "count": s.Count}
+	}
+
+	return fiber.Map{
+		"range": fiber.Map{
+			"from":        from.Format(time.RFC3339),
+			"to":          to.Format(time.RFC3339),
+			"granularity": granularity,
+			"timezone":    loc.String(),
+		},
+		"generations": fiber.Map{
+			"total":     total,
+			"completed": completed,
+			"failed":    failed,
+			"by_type":   byType,
+			"series":    generationSeries,
+		},
+		"credits_spent": fiber.Map{
+			"total":  creditsSpent,
+			"series": fillSeries(buckets, credits),
+		},
+		"success_rate":             successRate,
+		"top_styles":               topStyles,
+		"average_duration_seconds": duration.Average,
+	}, nil
+}
+
+// wallClockUTC is the UTC time with t's date and clock reading.
+func wallClockUTC(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/audit"
+	"github.com/zesbe/lumina-ai/internal/auth"
+	"github.com/zesbe/lumina-ai/internal/crypto"
+	"github.com/zesbe/lumina-ai/internal/geoip"
+	"github.com/zesbe/lumina-ai/internal/i18n"
+	"github.com/zesbe/lumina-ai/internal/lockout"
+	"github.com/zesbe/lumina-ai/internal/logger"
+	"github.com/zesbe/lumina-ai/internal/mail"
+	"github.com/zesbe/lumina-ai/internal/middleware"
+	"github.com/zesbe/lumina-ai/internal/models"
+	"github.com/zesbe/lumina-ai/internal/session"
+	"github.com/zesbe/lumina-ai/internal/userstate"
+)
+
+const (
+	// newDeviceQuietPeriod is how long after setting a new password a
+	// login from a new device goes unremarked; it is the owner signing
+	// back in everywhere.
+	newDeviceQuietPeriod = 10 * time.Minute
+	// secureAccountTTL is how long the link in a new-device notice works.
+	secureAccountTTL = 7 * 24 * time.Hour
+)
+
+var errSecureAccountInvalid = errors.New("secure account token invalid")
+
+// startSession logs user in from the requesting device and, when none of
+// their sessions came from a device like it, tells them about it.
+func (h *Handlers) startSession(c *fiber.Ctx, user *models.User) (*auth.TokenPair, error) {
+	device := session.DeviceOf(c)
+	known, err := session.KnownDevice(requestDB(c, h.db), user.ID, device)
+	if err != nil {
+		// Nobody is better off being locked out over a notice.
+		middleware.Log(c).Warn("failed to check login device", "error", err)
+		known = true
+	}
+
+	tokens, err := session.Start(requestDB(c, h.db), h.jwt, user, device)
+	if err != nil {
+		return nil, err
+	}
+	if !known {
+		h.notifyNewDevice(c, user, device)
+	}
+	return tokens, nil
+}
+
+// notifyNewDevice tells the user's open sockets about the login and, if
+// their preferences allow, mails them with a link to secure the account.
+// The mail goes out in the background so the login isn't held up.
+func (h *Handlers) notifyNewDevice(c *fiber.Ctx, user *models.User, device session.Device) {
+	if user.PasswordChangedAt != nil && time.Since(*user.PasswordChangedAt) < newDeviceQuietPeriod {
+		return
+	}
+	log := middleware.Log(c)
+	now := time.Now()
+	location := geoip.Locate(device.IP)
+
+	h.hub.SendToUser(user.ID, fiber.Map{
+		"type":     "new_device_login",
+		"device":   device.Name(),
+		"ip":       device.IP,
+		"location": location,
+		"at":       now,
+	})
+	audit.RecordAs(c, &user.ID, models.AuditNewDeviceLogin, audit.User(user.ID), fiber.Map{"device": device.Name(), "location": location})
+	where := location
+	if where == "" {
+		where = i18n.T(c, "email.new_device_login.location_unknown")
+	}
+	notify(requestDB(c, h.db), h.hub, i18n.Locale(c), models.Notification{
+		UserID: user.ID,
+		Type:   models.NotifyNewDeviceLogin,
+	}, i18n.Params{"device": device.Name(), "ip": device.IP, "location": where})
+
+	if !wantsNotification(requestDB(c, h.db), user.ID, models.PrefNewDeviceEmail) {
+		return
+	}
+
+	token, err := crypto.GenerateRandomToken(32)
+	if err != nil {
+		log.Error("failed to issue secure account token", "error", err)
+		return
+	}
+	if err := requestDB(c, h.db).Create(&models.SecureAccountToken{
+		UserID:    user.ID,
+		TokenHash: crypto.HashToken(token),
+		ExpiresAt: now.Add(secureAccountTTL),
+	}).Error; err != nil {
+		log.Error("failed to store secure account token", "error", err)
+		return
+	}
+
+	if location == "" {
+		location = i18n.T(c, "email.new_device_login.location_unknown")
+	}
+	unsubscribe := h.cfg.AppURL + "/unsubscribe?token=" + newUnsubscribeTokens(h.cfg.JWTSecret).issue(user.ID, models.PrefNewDeviceEmail)
+	msg := mail.Message{
+		To:      user.Email,
+		Subject: i18n.T(c, "email.new_device_login.subject"),
+		Body: i18n.T(c, "email.new_device_login.body", i18n.Params{
+			"time":        now.UTC().Format("2 January 2006 15:04 MST"),
+			"device":      device.Name(),
+			"ip":          device.IP,
+			"location":    location,
+			"link":        h.cfg.AppURL + "/secure-account?token=" + url.QueryEscape(token),
+			"unsubscribe": unsubscribe,
+		}),
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(h.jobs.ctx, 30*time.Second)
+		defer cancel()
+		if err := mail.Send(ctx, msg); err != nil {
+			logger.L().Error("failed to send new device notice", "user_id", user.ID, "error", err)
+		}
+	}()
+}
+
+// SecureAccount is where "this wasn't me" in a new-device notice leads.
+// The token from the mail, with a new password, ends every session of the
+// account and replaces the password, locking out whoever logged in.
+func (h *Handlers) SecureAccount() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.SecureAccountRequest
+		if apiErr := bindJSON(c, &req); apiErr != nil {
+			return apierror.Respond(c, apiErr)
+		}
+
+		if errs := middleware.ValidateRequest(c, &req); len(errs) > 0 {
+			return validationFailed(c, errs)
+		}
+
+		hashedPassword, err := crypto.HashPassword(req.NewPassword)
+		if err != nil {
+			return internalError(c, "error.secure_account_failed")
+		}
+
+		var token models.SecureAccountToken
+		var sessionIDs []string
+		err = requestDB(c, h.db).Transaction(func(tx *gorm.DB) error {
+			now := time.Now()
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", crypto.HashToken(req.Token), now).
+				First(&token).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return errSecureAccountInvalid
+				}
+				return err
+			}
+			// One use secures the account; the other notices' links have
+			// nothing left to do.
+			if err := tx.Model(&models.SecureAccountToken{}).Where("user_id = ? AND used_at IS NULL", token.UserID).
+				Update("used_at", now).Error; err != nil {
+				return err
+			}
+			res := tx.Model(&models.User{}).Where("id = ?", token.UserID).Updates(map[string]interface{}{
+				"password_hash":       hashedPassword,
+				"password_changed_at": now,
+			})
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				return errSecureAccountInvalid
+			}
+			sessionIDs, err = session.RevokeUser(tx, token.UserID)
+			return err
+		})
+		switch {
+		case errors.Is(err, errSecureAccountInvalid):
+			return errorResponse(c, fiber.StatusBadRequest, apierror.CodeInvalidToken, i18n.T(c, "error.secure_account_token_invalid"))
+		case err != nil:
+			middleware.Log(c).Error("failed to secure account", "error", err)
+			return internalError(c, "error.secure_account_failed")
+		}
+		h.endSessions(c, sessionIDs...)
+		userstate.Forget(token.UserID)
+		if err := lockout.Reset(token.UserID); err != nil {
+			middleware.Log(c).Warn("failed to reset login failures", "error", err)
+		}
+
+		audit.RecordAs(c, nil, models.AuditAccountSecured, audit.User(token.UserID), fiber.Map{"sessions": len(sessionIDs)})
+
+		return c.JSON(fiber.Map{
+			"message": i18n.T(c, "message.account_secured"),
+		})
+	}
+}
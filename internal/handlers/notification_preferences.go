@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/i18n"
+	"github.com/zesbe/lumina-ai/internal/logger"
+	"github.com/zesbe/lumina-ai/internal/middleware"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+// GetNotificationPreferences returns the caller's notification settings,
+// the defaults if they never changed them.
+func (h *Handlers) GetNotificationPreferences() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		prefs, err := notificationPreferences(requestDB(c, h.db), c.Locals("userID").(uint))
+		if err != nil {
+			return internalError(c, "error.fetch_notification_preferences_failed")
+		}
+		return c.JSON(fiber.Map{"preferences": prefs})
+	}
+}
+
+// UpdateNotificationPreferences changes the settings present in the body
+// and leaves the rest. Unknown keys are rejected by the strict body
+// decoding, so a misspelt one is an error rather than a silent no-op.
+func (h *Handlers) UpdateNotificationPreferences() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+
+		var req models.UpdateNotificationPreferencesRequest
+		if apiErr := bindJSON(c, &req); apiErr != nil {
+			return apierror.Respond(c, apiErr)
+		}
+
+		if req.ModerationNotices != nil && !*req.ModerationNotices {
+			v := middleware.NewLocalizedValidator(i18n.Locale(c))
+			v.AddRuleError(models.PrefModerationNotices, "always_on", nil)
+			return validationFailed(c, v.Errors())
+		}
+
+		prefs, err := notificationPreferences(requestDB(c, h.db), userID)
+		if err != nil {
+			return internalError(c, "error.update_notification_preferences_failed")
+		}
+		for name, value := range map[string]*bool{
+			models.PrefNewDeviceEmail:          req.NewDeviceEmail,
+			models.PrefGenerationCompleteEmail: req.GenerationCompleteEmail,
+			models.PrefMarketingEmail:          req.MarketingEmail,
+			models.PrefLowCreditAlerts:         req.LowCreditAlerts,
+		} {
+			if value != nil {
+				*prefs.Field(name) = *value
+			}
+		}
+		if err := saveNotificationPreferences(requestDB(c, h.db), &prefs); err != nil {
+			middleware.Log(c).Error("failed to save notification preferences", "error", err)
+			return internalError(c, "error.update_notification_preferences_failed")
+		}
+
+		return c.JSON(fiber.Map{
+			"message":     i18n.T(c, "message.notification_preferences_updated"),
+			"preferences": prefs,
+		})
+	}
+}
+
+// saveNotificationPreferences writes prefs, creating the row if the user
+// has none. The row is inserted with the defaults first and then updated
+// with every field, so a false isn't swapped for a column default.
+func saveNotificationPreferences(db *gorm.DB, prefs *models.NotificationPreferences) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		defaults := models.DefaultNotificationPreferences(prefs.UserID)
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&defaults).Error; err != nil {
+			return err
+		}
+		return tx.Model(prefs).Select("*").Updates(prefs).Error
+	})
+}
+
+// notificationPreferences loads a user's preferences, falling back to the
+// defaults when they have no row.
+func notificationPreferences(db *gorm.DB, userID uint) (models.NotificationPreferences, error) {
+	prefs := models.DefaultNotificationPreferences(userID)
+	err := db.Where("user_id = ?", userID).Limit(1).Find(&prefs).Error
+	return prefs, err
+}
+
+// wantsNotification reports whether userID has the named preference on.
+// Every sender asks before notifying or mailing. When the preferences
+// can't be loaded it says no, and logs why.
+func wantsNotification(db *gorm.DB, userID uint, name string) bool {
+	prefs, err := notificationPreferences(db, userID)
+	if err != nil {
+		logger.L().Warn("failed to load notification preferences", "user_id", userID, "error", err)
+		return false
+	}
+	return prefs.Allows(name)
+}
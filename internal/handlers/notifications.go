@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"html"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"github.com/zesbe/lumina-ai/internal/i18n"
+	"github.com/zesbe/lumina-ai/internal/logger"
+	"github.com/zesbe/lumina-ai/internal/middleware"
+	"github.com/zesbe/lumina-ai/internal/models"
+	"github.com/zesbe/lumina-ai/internal/settings"
+)
+
+// ListNotifications lists the caller's notifications, newest first, with
+// how many are unread. unread=true leaves out the ones already read.
+func (h *Handlers) ListNotifications() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+		page, _ := strconv.Atoi(c.Query("page", "1"))
+		limit, _ := strconv.Atoi(c.Query("limit", "20"))
+
+		if page < 1 {
+			page = 1
+		}
+		if limit < 1 || limit > 100 {
+			limit = 20
+		}
+
+		query := requestDB(c, h.db).Model(&models.Notification{}).Where("user_id = ?", userID)
+		if c.QueryBool("unread") {
+			query = query.Where("read_at IS NULL")
+		}
+
+		var total pageTotal
+		if err := query.Count(&total.Total).Error; err != nil {
+			return internalError(c, "error.fetch_notifications_failed")
+		}
+
+		notifications := []models.Notification{}
+		if err := query.Order("created_at DESC, id DESC").Offset((page - 1) * limit).Limit(limit).Find(&notifications).Error; err != nil {
+			return internalError(c, "error.fetch_notifications_failed")
+		}
+
+		unread, err := unreadNotifications(requestDB(c, h.db), userID)
+		if err != nil {
+			return internalError(c, "error.fetch_notifications_failed")
+		}
+
+		list := newPage(notifications, page, limit, total)
+		body := list.body("notifications")
+		body["unread"] = unread
+		setPageLinks(c, list.Pagination)
+		return c.JSON(body)
+	}
+}
+
+// MarkNotificationRead marks one of the caller's notifications read.
+// Marking it again changes nothing.
+func (h *Handlers) MarkNotificationRead() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+		id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+		if err != nil {
+			return badRequest(c, "error.invalid_notification_id")
+		}
+
+		var notification models.Notification
+		if err := requestDB(c, h.db).Where("id = ? AND user_id = ?", id, userID).First(&notification).Error; err != nil {
+			return notFound(c, "error.notification_not_found")
+		}
+		if notification.ReadAt == nil {
+			now := time.Now()
+			if err := requestDB(c, h.db).Model(&notification).Where("read_at IS NULL").Update("read_at", now).Error; err != nil {
+				return internalError(c, "error.update_notifications_failed")
+			}
+			notification.ReadAt = &now
+		}
+
+		unread, err := unreadNotifications(requestDB(c, h.db), userID)
+		if err != nil {
+			return internalError(c, "error.update_notifications_failed")
+		}
+		return c.JSON(fiber.Map{"notification": notification, "unread": unread})
+	}
+}
+
+// MarkAllNotificationsRead marks every unread notification of the caller
+// read.
+func (h *Handlers) MarkAllNotificationsRead() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+
+		res := requestDB(c, h.db).Model(&models.Notification{}).
+			Where("user_id = ? AND read_at IS NULL", userID).Update("read_at", time.Now())
+		if res.Error != nil {
+			middleware.Log(c).Error("failed to mark notifications read", "error", res.Error)
+			return internalError(c, "error.update_notifications_failed")
+		}
+
+		return c.JSON(fiber.Map{
+			"message": i18n.T(c, "message.notifications_read"),
+			"marked":  res.RowsAffected,
+			"unread":  0,
+		})
+	}
+}
+
+func unreadNotifications(db *gorm.DB, userID uint) (int64, error) {
+	var unread int64
+	err := db.Model(&models.Notification{}).Where("user_id = ? AND read_at IS NULL", userID).Count(&unread).Error
+	return unread, err
+}
+
+// notificationPreference is the preference that decides whether a type of
+// notification is sent. Types not listed always are.
+var notificationPreference = map[string]string{
+	models.NotifyCreditsLow:       models.PrefLowCreditAlerts,
+	models.NotifyContentModerated: models.PrefModerationNotices,
+}
+
+// notify puts n in its user's inbox, with the title and body of its type
+// in locale, and pushes it to their open sockets with the unread count so
+// the badge updates, unless the user turned that type off. A failure is
+// only logged: a missed notice is never worth failing what it was about.
+func notify(db *gorm.DB, hub *WSHub, locale string, n models.Notification, params i18n.Params) {
+	if pref, ok := notificationPreference[n.Type]; ok && !wantsNotification(db, n.UserID, pref) {
+		return
+	}
+	n.Title = i18n.Translate(locale, "notification."+n.Type+".title", params)
+	n.Body = i18n.Translate(locale, "notification."+n.Type+".body", params)
+	if err := db.Create(&n).Error; err != nil {
+		logger.L().Error("failed to store notification", "user_id", n.UserID, "type", n.Type, "error", err)
+		return
+	}
+
+	event := fiber.Map{"type": "notification", "notification": n}
+	if unread, err := unreadNotifications(db, n.UserID); err == nil {
+		event["unread"] = unread
+	}
+	hub.SendToUser(n.UserID, event)
+}
+
+// notifyGeneration tells the owner a generation completed or failed.
+func notifyGeneration(db *gorm.DB, hub *WSHub, locale string, generation *models.Generation) {
+	kind := models.NotifyGenerationCompleted
+	if generation.Status == models.StatusFailed {
+		kind = models.NotifyGenerationFailed
+	}
+	notify(db, hub, locale, generationNotification(generation, kind), i18n.Params{
+		"title": generationTitle(locale, generation),
+		"error": generation.ErrorMessage,
+	})
+}
+
+// notifyLowCredits tells the user when spending spent took their balance
+// from at least the low_credit_threshold setting to below it, so they
+// hear about it once rather than on every charge after.
+func notifyLowCredits(db *gorm.DB, hub *WSHub, locale string, userID uint, spent int) {
+	threshold := settings.Current().LowCreditThreshold
+	if threshold <= 0 || spent <= 0 {
+		return
+	}
+	var credits int
+	if err := db.Model(&models.User{}).Where("id = ?", userID).Select("credits").Scan(&credits).Error; err != nil {
+		logger.L().Warn("failed to check credit balance", "user_id", userID, "error", err)
+		return
+	}
+	if credits >= threshold || credits+spent < threshold {
+		return
+	}
+	notify(db, hub, locale, models.Notification{
+		UserID: userID,
+		Type:   models.NotifyCreditsLow,
+	}, i18n.Params{"credits": credits})
+}
+
+func generationNotification(generation *models.Generation, kind string) models.Notification {
+	id := strconv.FormatUint(uint64(generation.ID), 10)
+	return models.Notification{
+		UserID:  generation.UserID,
+		Type:    kind,
+		Link:    "/generations/" + id,
+		RefType: "generation",
+		RefID:   id,
+	}
+}
+
+// generationTitle is how notifications name a generation. Stored titles
+// are HTML-escaped.
+func generationTitle(locale string, generation *models.Generation) string {
+	if generation.Title == "" {
+		return i18n.Translate(locale, "notification.untitled", nil)
+	}
+	return html.UnescapeString(generation.Title)
+}
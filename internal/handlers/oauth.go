@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/audit"
+	"github.com/zesbe/lumina-ai/internal/i18n"
+	"github.com/zesbe/lumina-ai/internal/middleware"
+	"github.com/zesbe/lumina-ai/internal/models"
+	"github.com/zesbe/lumina-ai/internal/oauth"
+)
+
+var (
+	errOAuthEmailUnverified = errors.New("provider email not verified")
+	errAccountDisabled      = errors.New("account disabled")
+)
+
+// OAuthURL answers with the provider's consent URL. The state in it is
+// single-use and expires after oauth.StateTTL.
+func (h *Handlers) OAuthURL(provider oauth.Provider) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !provider.Configured() {
+			return errorResponse(c, fiber.StatusServiceUnavailable, apierror.CodeServiceUnavailable, i18n.T(c, "error.oauth_not_configured"))
+		}
+
+		state, err := oauth.NewState(provider.Name())
+		if err != nil {
+			middleware.Log(c).Error("failed to issue oauth state", "provider", provider.Name(), "error", err)
+			return internalError(c, "error.oauth_failed")
+		}
+
+		return c.JSON(fiber.Map{
+			"url":        provider.AuthURL(state),
+			"expires_in": int(oauth.StateTTL.Seconds()),
+		})
+	}
+}
+
+// OAuthCallback finishes a provider sign-in and answers like Login. The
+// provider account is matched by its linked identity first, then by a
+// verified email, which links it to the existing account; failing both, a
+// verified account is created.
+func (h *Handlers) OAuthCallback(provider oauth.Provider) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !provider.Configured() {
+			return errorResponse(c, fiber.StatusServiceUnavailable, apierror.CodeServiceUnavailable, i18n.T(c, "error.oauth_not_configured"))
+		}
+		log := middleware.Log(c).With("provider", provider.Name())
+
+		if reason := c.Query("error"); reason != "" {
+			return badRequest(c, "error.oauth_denied")
+		}
+		if err := oauth.ConsumeState(provider.Name(), c.Query("state")); err != nil {
+			return badRequest(c, "error.oauth_state_invalid")
+		}
+		code := c.Query("code")
+		if code == "" {
+			return badRequest(c, "error.oauth_state_invalid")
+		}
+
+		identity, err := provider.Exchange(c.UserContext(), code)
+		if err != nil {
+			log.Warn("oauth exchange failed", "error", err)
+			return errorResponse(c, fiber.StatusUnauthorized, apierror.CodeInvalidCredentials, i18n.T(c, "error.oauth_exchange_failed"))
+		}
+
+		user, created, err := oauthUser(requestDB(c, h.db), identity)
+		switch {
+		case errors.Is(err, errOAuthEmailUnverified):
+			return errorResponse(c, fiber.StatusForbidden, apierror.CodeForbidden, i18n.T(c, "error.oauth_email_unverified", i18n.Params{"provider": provider.Title()}))
+		case errors.Is(err, errAccountDisabled):
+			audit.RecordAs(c, nil, models.AuditLoginFailed, audit.User(user.ID), fiber.Map{"reason": "inactive", "method": provider.Name()})
+			audit.RecordLogin(c, user.ID, provider.Name(), models.LoginFailed, "inactive")
+			return errorResponse(c, fiber.StatusForbidden, apierror.CodeForbidden, i18n.T(c, "error.account_disabled"))
+		case err != nil:
+			log.Error("failed to sign in with oauth", "error", err)
+			return internalError(c, "error.oauth_failed")
+		}
+
+		tokens, err := h.startSession(c, user)
+		if err != nil {
+			return internalError(c, "error.generate_tokens_failed")
+		}
+
+		now := time.Now()
+		requestDB(c, h.db).Model(user).Update("last_login_at", now)
+		audit.RecordAs(c, &user.ID, models.AuditLogin, audit.User(user.ID), fiber.Map{"method": provider.Name(), "created": created})
+		audit.RecordLogin(c, user.ID, provider.Name(), models.LoginSucceeded, "")
+
+		status := fiber.StatusOK
+		if created {
+			status = fiber.StatusCreated
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"message": i18n.T(c, "message.logged_in"),
+			"user":    user.ToResponse(),
+			"tokens":  tokens,
+		})
+	}
+}
+
+// oauthUser finds the user behind identity, linking or creating one as
+// needed, and reports whether it was created. The user comes back with
+// errAccountDisabled too, for the audit entry.
+func oauthUser(db *gorm.DB, identity *oauth.Identity) (*models.User, bool, error) {
+	var user models.User
+	var created bool
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var link models.LinkedIdentity
+		err := tx.Where("provider = ? AND subject = ?", identity.Provider, identity.Subject).First(&link).Error
+		if err == nil {
+			return tx.First(&user, link.UserID).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		// Matching on an address the provider hasn't checked would hand
+		// the account to whoever typed it in.
+		if !identity.EmailVerified || identity.Email == "" {
+			return errOAuthEmailUnverified
+		}
+
+		err = tx.Where("LOWER(email) = LOWER(?) AND email_conflict_with IS NULL", identity.Email).First(&user).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			user = models.User{
+				Email:      models.NormalizeEmail(identity.Email),
+				Name:       oauthName(identity),
+				Avatar:     truncate(identity.Avatar, 500),
+				Role:       "user",
+				Plan:       "free",
+				Credits:    10,
+				IsActive:   true,
+				IsVerified: true,
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+			created = true
+		case err != nil:
+			return err
+		case !user.IsVerified:
+			// The provider just proved the address.
+			if err := tx.Model(&user).Update("is_verified", true).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Create(&models.LinkedIdentity{
+			UserID:   user.ID,
+			Provider: identity.Provider,
+			Subject:  identity.Subject,
+			Email:    identity.Email,
+		}).Error
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if !user.IsActive {
+		return &user, false, errAccountDisabled
+	}
+	return &user, created, nil
+}
+
+// oauthName is the display name for a new account: the provider's, or
+// the email's local part when that is missing or too short.
+func oauthName(identity *oauth.Identity) string {
+	name := strings.TrimSpace(middleware.SanitizeInput(identity.Name))
+	if len([]rune(name)) < 2 {
+		return emailName(identity.Email)
+	}
+	return string([]rune(name)[:min(len([]rune(name)), 100)])
+}
+
+// emailName is a display name made from an email's local part, for
+// accounts created without one. The user can change it later.
+func emailName(email string) string {
+	name, _, _ := strings.Cut(email, "@")
+	name = middleware.SanitizeInput(name)
+	return string([]rune(name)[:min(len([]rune(name)), 100)])
+}
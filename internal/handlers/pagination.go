@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+	"gorm.io/gorm"
+
+	"github.com/zesbe/lumina-ai/internal/cache"
+	"github.com/zesbe/lumina-ai/internal/models"
+	"github.com/zesbe/lumina-ai/internal/settings"
+)
+
+// exploreCountCap bounds the Explore count; past it the total is reported
+// as an estimate ("10,000+") instead of counting every row.
+const exploreCountCap = 10000
+
+type pageTotal struct {
+	Total      int64 `json:"total"`
+	IsEstimate bool  `json:"is_estimate"`
+}
+
+// countGenerations counts the rows matched by query without touching it,
+// capped at limit when limit > 0, and caches the result under cacheKey
+// for the list_count_cache_seconds setting. Totals only feed the page
+// count, so being a little behind is fine.
+func countGenerations(redis *cache.RedisCache, query *gorm.DB, cacheKey string, limit int64) (pageTotal, error) {
+	var total pageTotal
+	if redis != nil {
+		if err := redis.Get(cacheKey, &total); err == nil {
+			return total, nil
+		}
+	}
+
+	// Count on a fresh session so the page query keeps its own state.
+	counted := query.Session(&gorm.Session{}).Model(&models.Generation{})
+	if limit > 0 {
+		counted = query.Session(&gorm.Session{NewDB: true}).Table("(?) AS capped",
+			counted.Select("1").Limit(int(limit)+1))
+	}
+	if err := counted.Count(&total.Total).Error; err != nil {
+		return total, err
+	}
+	if limit > 0 && total.Total > limit {
+		total = pageTotal{Total: limit, IsEstimate: true}
+	}
+
+	if ttl := settings.Current().ListCountCacheTTL(); redis != nil && ttl > 0 {
+		redis.Set(cacheKey, total, ttl)
+	}
+	return total, nil
+}
+
+// pagination is the block every paged list returns next to its items.
+type pagination struct {
+	Page            int   `json:"page"`
+	Limit           int   `json:"limit"`
+	Total           int64 `json:"total"`
+	TotalPages      int64 `json:"total_pages"`
+	TotalIsEstimate bool  `json:"total_is_estimate"`
+	// NextCursor continues a list paged by cursor instead of page number;
+	// empty on the last page.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Paginated is one page of a list. Every list endpoint answers through it
+// so the pagination block and the Link header are the same everywhere.
+type Paginated[T any] struct {
+	Items      []T
+	Pagination pagination
+}
+
+func newPage[T any](items []T, page, limit int, total pageTotal) Paginated[T] {
+	return Paginated[T]{
+		Items: items,
+		Pagination: pagination{
+			Page:            page,
+			Limit:           limit,
+			Total:           total.Total,
+			TotalPages:      (total.Total + int64(limit) - 1) / int64(limit),
+			TotalIsEstimate: total.IsEstimate,
+		},
+	}
+}
+
+// body is the JSON response, with the items under key.
+func (p Paginated[T]) body(key string) fiber.Map {
+	return fiber.Map{key: p.Items, "pagination": p.Pagination}
+}
+
+// send sets the Link header and writes the page with the items under key.
+func (p Paginated[T]) send(c *fiber.Ctx, key string) error {
+	setPageLinks(c, p.Pagination)
+	return c.JSON(p.body(key))
+}
+
+// setPageLinks sets an RFC 8288 Link header with first, prev, next and
+// last. The URLs are the request's own path and query with only page (or
+// cursor) changed, so every active filter carries over. A cursor-paged
+// list only gets next.
+func setPageLinks(c *fiber.Ctx, p pagination) {
+	var links []string
+	link := func(rel, param, value string) {
+		args := fasthttp.AcquireArgs()
+		defer fasthttp.ReleaseArgs(args)
+		c.Request().URI().QueryArgs().CopyTo(args)
+		args.Del("cursor")
+		args.Set(param, value)
+		links = append(links, fmt.Sprintf(`<%s?%s>; rel="%s"`, c.Path(), args.QueryString(), rel))
+	}
+
+	if p.NextCursor != "" {
+		link("next", "cursor", p.NextCursor)
+	} else {
+		lastPage := int(p.TotalPages)
+		if lastPage < 1 {
+			lastPage = 1
+		}
+		link("first", "page", "1")
+		if p.Page > 1 {
+			link("prev", "page", strconv.Itoa(min(p.Page-1, lastPage)))
+		}
+		if p.Page < lastPage {
+			link("next", "page", strconv.Itoa(p.Page+1))
+		}
+		link("last", "page", strconv.Itoa(lastPage))
+	}
+	c.Set(fiber.HeaderLink, strings.Join(links, ", "))
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/pprof"
+)
+
+// Profiling serves the net/http/pprof endpoints under /debug/pprof. On the
+// API listener it sits behind admin auth; with PPROF_ADDR set it runs on a
+// loopback listener of its own instead, without auth.
+//
+// With an admin access token:
+//
+//	# 30s CPU profile
+//	curl -H "Authorization: Bearer $TOKEN" -o cpu.pprof 'https://api.example.com/debug/pprof/profile?seconds=30'
+//	# live heap
+//	curl -H "Authorization: Bearer $TOKEN" -o heap.pprof https://api.example.com/debug/pprof/heap
+//	# every goroutine's stack, as text
+//	curl -H "Authorization: Bearer $TOKEN" 'https://api.example.com/debug/pprof/goroutine?debug=2'
+//	# 5s execution trace
+//	curl -H "Authorization: Bearer $TOKEN" -o trace.out 'https://api.example.com/debug/pprof/trace?seconds=5'
+//
+// Then `go tool pprof cpu.pprof` or `go tool trace trace.out`. On the
+// loopback listener drop the header and use http://127.0.0.1:6060.
+func (h *Handlers) Profiling() fiber.Handler {
+	return pprof.New()
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"github.com/zesbe/lumina-ai/internal/cache"
+	"github.com/zesbe/lumina-ai/internal/database"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+// profileStatsTTL is how long a user's stats are cached. Generation
+// writes clear them sooner through invalidateGenerations.
+const profileStatsTTL = time.Minute
+
+// profileStats sums up the user's generations with one grouped query and
+// their net spend this month from the ledger. The key sits under
+// generations:<user>: so invalidateGenerations clears it.
+func profileStats(c *fiber.Ctx, db *gorm.DB, redis *cache.RedisCache, userID uint) (models.ProfileStats, error) {
+	cacheKey := fmt.Sprintf("generations:%d:profile_stats", userID)
+	var stats models.ProfileStats
+	if redis != nil {
+		if err := redis.Get(cacheKey, &stats); err == nil {
+			return stats, nil
+		}
+	}
+
+	reader := database.Reader(requestDB(c, db), userID)
+
+	var groups []struct {
+		Type         models.GenerationType
+		Status       models.GenerationStatus
+		Count        int64
+		Favorites    int64
+		StorageBytes int64
+	}
+	if err := reader.Model(&models.Generation{}).
+		Select("type, status, COUNT(*) AS count, "+
+			"COUNT(*) FILTER (WHERE is_favorite) AS favorites, "+
+			"COALESCE(SUM(output_bytes), 0) AS storage_bytes").
+		Where("user_id = ?", userID).
+		Group("type, status").
+		Scan(&groups).Error; err != nil {
+		return stats, err
+	}
+
+	stats.Generations = models.GenerationCounts{
+		ByType:   map[models.GenerationType]int64{models.TypeMusic: 0, models.TypeVideo: 0},
+		ByStatus: map[models.GenerationStatus]int64{},
+	}
+	for _, g := range groups {
+		stats.Generations.Total += g.Count
+		stats.Generations.ByType[g.Type] += g.Count
+		stats.Generations.ByStatus[g.Status] += g.Count
+		stats.Favorites += g.Favorites
+		stats.StorageBytes += g.StorageBytes
+	}
+
+	// Usage rows are negative and refunds give them back, so the net of
+	// the two is what the month's generations cost.
+	if err := reader.Model(&models.CreditTransaction{}).
+		Select("COALESCE(-SUM(amount), 0)").
+		Where("user_id = ? AND type IN ? AND created_at >= ?", userID, []string{"usage", "refund"}, utcMonthStart(time.Now())).
+		Scan(&stats.CreditsSpentThisMonth).Error; err != nil {
+		return stats, err
+	}
+
+	if redis != nil {
+		redis.Set(cacheKey, stats, profileStatsTTL)
+	}
+	return stats, nil
+}
+
+func utcMonthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"html"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/audit"
+	"github.com/zesbe/lumina-ai/internal/i18n"
+	"github.com/zesbe/lumina-ai/internal/middleware"
+	"github.com/zesbe/lumina-ai/internal/models"
+	"github.com/zesbe/lumina-ai/internal/moderation"
+)
+
+// checkPublish runs what Explore would show of generation through the
+// publish filter. Titles are stored HTML-escaped, so the text is checked
+// as people read it.
+func checkPublish(c *fiber.Ctx, generation *models.Generation) *moderation.Verdict {
+	return moderation.CheckPublish(c.UserContext(),
+		moderation.Field{Name: "title", Text: html.UnescapeString(generation.Title)},
+		moderation.Field{Name: "style", Text: html.UnescapeString(generation.Style)},
+		moderation.Field{Name: "lyrics", Text: html.UnescapeString(generation.Lyrics)},
+	)
+}
+
+// publishBlocked rejects publishing, or editing public content, that hit
+// a hard entry of the publish filter. The attempt is audited so admins can
+// review it.
+func publishBlocked(c *fiber.Ctx, generation *models.Generation, verdict *moderation.Verdict) error {
+	audit.Record(c, models.AuditPublishBlocked, audit.Generation(generation.ID), publishAuditMeta(verdict))
+	middleware.Log(c).Info("publishing blocked by moderation", "generation_id", generation.ID, "field", verdict.Field, "source", verdict.Source)
+
+	return apierror.Respond(c, apierror.New(fiber.StatusUnprocessableEntity, apierror.CodePublishBlocked,
+		i18n.T(c, "error.publish_blocked")).With("field", verdict.Field))
+}
+
+// applyPublishVerdict holds public generation for review after a soft
+// match, or lifts an earlier hold when the check came back clean. An
+// approval stands until the text changes, so textChanged is whether this
+// check is about new text. It reports whether the generation is now held,
+// after auditing it.
+func applyPublishVerdict(c *fiber.Ctx, generation *models.Generation, verdict *moderation.Verdict, textChanged bool) bool {
+	switch {
+	case verdict != nil && generation.ModerationStatus == models.ModerationApproved && !textChanged:
+		return false
+	case verdict != nil:
+		generation.ModerationStatus = models.ModerationPendingReview
+		generation.ModerationReason = verdict.Reason
+		audit.Record(c, models.AuditPublishHeld, audit.Generation(generation.ID), publishAuditMeta(verdict))
+		return true
+	case generation.ModerationStatus == models.ModerationPendingReview:
+		generation.ModerationStatus = ""
+		generation.ModerationReason = ""
+	}
+	return false
+}
+
+func publishAuditMeta(verdict *moderation.Verdict) fiber.Map {
+	return fiber.Map{
+		"field":  verdict.Field,
+		"source": verdict.Source,
+		"reason": verdict.Reason,
+	}
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/audit"
+	"github.com/zesbe/lumina-ai/internal/i18n"
+	"github.com/zesbe/lumina-ai/internal/logger"
+	"github.com/zesbe/lumina-ai/internal/middleware"
+	"github.com/zesbe/lumina-ai/internal/models"
+	"github.com/zesbe/lumina-ai/internal/purge"
+)
+
+// RunPurge permanently deletes soft-deleted rows older than the configured
+// retention (or retention_days). A dry run answers with the counts; a real
+// run can take a while, so it is started in the background and its counts
+// are logged.
+func (h *Handlers) RunPurge() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.RunPurgeRequest
+		if len(c.Body()) > 0 {
+			if apiErr := bindJSON(c, &req); apiErr != nil {
+				return apierror.Respond(c, apiErr)
+			}
+		}
+
+		if errs := middleware.ValidateRequest(c, &req); len(errs) > 0 {
+			return validationFailed(c, errs)
+		}
+
+		retention := h.cfg.PurgeRetention
+		if req.RetentionDays > 0 {
+			retention = time.Duration(req.RetentionDays) * 24 * time.Hour
+		}
+		if retention <= 0 {
+			return badRequest(c, "error.purge_retention_required")
+		}
+		opts := purge.Options{
+			Cutoff:     time.Now().Add(-retention),
+			DryRun:     req.DryRun,
+			UploadPath: h.cfg.UploadPath,
+			ExportDir:  h.cfg.DataExportDir,
+		}
+
+		audit.Record(c, models.AuditPurge, audit.Target{Type: "purge"}, fiber.Map{
+			"dry_run": opts.DryRun,
+			"cutoff":  opts.Cutoff.Format(time.RFC3339),
+		})
+
+		if opts.DryRun {
+			report, err := purge.Run(c.UserContext(), h.db, opts)
+			if err != nil {
+				return purgeError(c, err)
+			}
+			return c.JSON(fiber.Map{
+				"dry_run": true,
+				"cutoff":  opts.Cutoff,
+				"counts":  report,
+			})
+		}
+
+		if purge.Running() {
+			return purgeError(c, purge.ErrRunning)
+		}
+		go func() {
+			if _, err := purge.Run(context.Background(), h.db, opts); err != nil && !errors.Is(err, purge.ErrRunning) {
+				logger.L().Error("purge failed", "error", err)
+			}
+		}()
+
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+			"message": i18n.T(c, "message.purge_started"),
+			"cutoff":  opts.Cutoff,
+		})
+	}
+}
+
+func purgeError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, purge.ErrRunning) {
+		return conflict(c, "error.purge_running")
+	}
+	middleware.Log(c).Error("purge dry run failed", "error", err)
+	return internalError(c, "error.purge_failed")
+}
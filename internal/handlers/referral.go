@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"github.com/zesbe/lumina-ai/internal/middleware"
+	"github.com/zesbe/lumina-ai/internal/models"
+	"github.com/zesbe/lumina-ai/internal/services"
+	"github.com/zesbe/lumina-ai/internal/settings"
+)
+
+const (
+	// referralCodeAlphabet leaves out letters and digits that are easy
+	// to mix up when a code is read out or typed.
+	referralCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	referralCodeLength   = 8
+)
+
+// GetReferrals returns the caller's referral code, handing one out on the
+// first visit, and how their referrals have done.
+func (h *Handlers) GetReferrals() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+		db := requestDB(c, h.db)
+
+		code, err := referralCode(db, userID)
+		if err != nil {
+			middleware.Log(c).Error("failed to issue referral code", "error", err)
+			return internalError(c, "error.fetch_referrals_failed")
+		}
+
+		runtime := settings.Current()
+		stats := models.ReferralStats{
+			Code:         code,
+			Link:         h.cfg.AppURL + "/register?ref=" + code,
+			MonthlyCap:   runtime.ReferralMonthlyCap,
+			BonusCredits: runtime.ReferralBonusCredits,
+		}
+		var rows []struct {
+			Status  string
+			Count   int64
+			Credits int64
+		}
+		if err := db.Model(&models.Referral{}).
+			Select("status, COUNT(*) AS count, COALESCE(SUM(referrer_credits), 0) AS credits").
+			Where("referrer_id = ?", userID).Group("status").Scan(&rows).Error; err != nil {
+			return internalError(c, "error.fetch_referrals_failed")
+		}
+		for _, row := range rows {
+			switch row.Status {
+			case models.ReferralPending:
+				stats.Pending = row.Count
+			case models.ReferralRewarded:
+				stats.Rewarded = row.Count
+			case models.ReferralCapped:
+				stats.Capped = row.Count
+			}
+			stats.CreditsEarned += row.Credits
+		}
+		if stats.RewardsThisMonth, err = services.ReferralRewardsThisMonth(db, userID); err != nil {
+			return internalError(c, "error.fetch_referrals_failed")
+		}
+
+		return c.JSON(fiber.Map{"referrals": stats})
+	}
+}
+
+// referralCode returns the user's code, generating it if they have none.
+func referralCode(db *gorm.DB, userID uint) (string, error) {
+	var user models.User
+	if err := db.Select("id", "referral_code").First(&user, userID).Error; err != nil {
+		return "", err
+	}
+	if user.ReferralCode != nil {
+		return *user.ReferralCode, nil
+	}
+
+	for attempt := 1; ; attempt++ {
+		code, err := newReferralCode()
+		if err != nil {
+			return "", err
+		}
+		res := db.Model(&models.User{}).Where("id = ? AND referral_code IS NULL", userID).Update("referral_code", code)
+		switch {
+		case res.Error != nil && attempt < 3:
+			// Most likely another user's code; with 32^8 codes a second
+			// clash in a row is next to impossible.
+			continue
+		case res.Error != nil:
+			return "", res.Error
+		case res.RowsAffected == 0:
+			// A concurrent request handed one out first.
+			if err := db.Select("id", "referral_code").First(&user, userID).Error; err != nil {
+				return "", err
+			}
+			if user.ReferralCode == nil {
+				return "", errors.New("referral code not saved")
+			}
+			return *user.ReferralCode, nil
+		}
+		return code, nil
+	}
+}
+
+func newReferralCode() (string, error) {
+	b := make([]byte, referralCodeLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	// 256 is a multiple of the alphabet's 32 letters, so every letter is
+	// equally likely.
+	for i := range b {
+		b[i] = referralCodeAlphabet[int(b[i])%len(referralCodeAlphabet)]
+	}
+	return string(b), nil
+}
+
+// recordReferral links a new account to the owner of the code it signed
+// up with. A code that belongs to no active account, or to the same
+// mailbox under another +tag, is ignored without telling the client, so
+// trying codes reveals nothing and nobody refers themselves.
+func recordReferral(c *fiber.Ctx, db *gorm.DB, user *models.User, code string) {
+	if code == "" {
+		return
+	}
+	var referrer models.User
+	if err := requestDB(c, db).Where("referral_code = ? AND is_active = ?", strings.ToUpper(code), true).
+		Limit(1).Find(&referrer).Error; err != nil {
+		middleware.Log(c).Warn("failed to look up referral code", "error", err)
+		return
+	}
+	if referrer.ID == 0 || referrer.ID == user.ID || mailbox(referrer.Email) == mailbox(user.Email) {
+		return
+	}
+	if err := requestDB(c, db).Create(&models.Referral{
+		ReferrerID: referrer.ID,
+		ReferredID: user.ID,
+		Status:     models.ReferralPending,
+	}).Error; err != nil {
+		middleware.Log(c).Warn("failed to record referral", "error", err)
+	}
+}
+
+// mailbox is an address with case and any +tag dropped, which is where
+// mail to it ends up at most providers.
+func mailbox(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok {
+		return email
+	}
+	local, _, _ = strings.Cut(local, "+")
+	return local + "@" + domain
+}
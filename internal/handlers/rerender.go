@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"errors"
+	"os"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/i18n"
+	"github.com/zesbe/lumina-ai/internal/middleware"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+// errAlreadyClean is a re-render another request got to first.
+var errAlreadyClean = errors.New("generation is not watermarked")
+
+// RerenderGeneration swaps a watermarked output for the clean file kept
+// when it was marked, once the owner is on a paid plan. Nothing is sent to
+// the provider and nothing is charged.
+func (h *Handlers) RerenderGeneration() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+		id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+		if err != nil {
+			return badRequest(c, "error.invalid_generation_id")
+		}
+
+		var generation models.Generation
+		if err := requestDB(c, h.db).Where("id = ? AND user_id = ?", id, userID).First(&generation).Error; err != nil {
+			return notFound(c, "error.generation_not_found")
+		}
+		if plan, _ := c.Locals("plan").(string); watermarkedPlan(plan) {
+			return apierror.Respond(c, apierror.New(fiber.StatusForbidden, apierror.CodePlanUpgradeRequired, i18n.T(c, "error.plan_upgrade_required")))
+		}
+		if !generation.Watermarked {
+			return conflict(c, "error.generation_not_watermarked")
+		}
+
+		cleanURL := models.CleanMediaURL(generation.OutputURL)
+		if cleanURL == "" {
+			return conflict(c, "error.clean_output_missing")
+		}
+		path, cleanPath := uploadsFile(generation.OutputURL), uploadsFile(cleanURL)
+		info, err := os.Stat(cleanPath)
+		if err != nil {
+			return conflict(c, "error.clean_output_missing")
+		}
+
+		// The file is swapped last, inside the transaction, so the flag and
+		// the file only change together.
+		err = requestDB(c, h.db).Transaction(func(tx *gorm.DB) error {
+			result := tx.Model(&generation).Where("watermarked = ?", true).
+				Updates(map[string]interface{}{"watermarked": false, "output_bytes": info.Size()})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errAlreadyClean
+			}
+			return os.Rename(cleanPath, path)
+		})
+		if errors.Is(err, errAlreadyClean) {
+			return conflict(c, "error.generation_not_watermarked")
+		}
+		if err != nil {
+			return internalError(c, "error.rerender_failed")
+		}
+		generation.Watermarked = false
+		invalidateGenerations(h.cache, userID)
+
+		return c.JSON(fiber.Map{
+			"message":    i18n.T(c, "message.generation_rerendered"),
+			"generation": generation.ToResponse(middleware.GetBaseURL(c)),
+		})
+	}
+}
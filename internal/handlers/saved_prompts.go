@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/config"
+	"github.com/zesbe/lumina-ai/internal/database"
+	"github.com/zesbe/lumina-ai/internal/i18n"
+	"github.com/zesbe/lumina-ai/internal/middleware"
+	"github.com/zesbe/lumina-ai/internal/models"
+	"github.com/zesbe/lumina-ai/internal/settings"
+)
+
+const (
+	// promptHistoryLimit is how many distinct prompts the history lists.
+	promptHistoryLimit = 50
+	// promptHistoryScan is how many of the latest generations the history
+	// is built from, so a user with a long history costs a bounded read.
+	promptHistoryScan = 500
+)
+
+// ListSavedPrompts lists the caller's saved prompts, most recently
+// changed first.
+func (h *Handlers) ListSavedPrompts() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+
+		var prompts []models.SavedPrompt
+		if err := requestDB(c, h.db).Where("user_id = ?", userID).
+			Order("updated_at DESC, id DESC").Find(&prompts).Error; err != nil {
+			return internalError(c, "error.fetch_saved_prompts_failed")
+		}
+
+		response := make([]models.SavedPromptResponse, len(prompts))
+		for i := range prompts {
+			response[i] = prompts[i].ToResponse()
+		}
+		return c.JSON(fiber.Map{"prompts": response})
+	}
+}
+
+func (h *Handlers) GetSavedPrompt() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		prompt, err := savedPromptParam(c, h.db)
+		if prompt == nil {
+			return err
+		}
+		return c.JSON(fiber.Map{"prompt": prompt.ToResponse()})
+	}
+}
+
+// CreateSavedPrompt saves a prompt, up to the saved_prompt_limits entry of
+// the caller's plan.
+func (h *Handlers) CreateSavedPrompt() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.SavedPromptRequest
+		if apiErr := bindJSON(c, &req); apiErr != nil {
+			return apierror.Respond(c, apiErr)
+		}
+		if errs := validateSavedPrompt(c, h.cfg, &req); len(errs) > 0 {
+			return validationFailed(c, errs)
+		}
+
+		userID := c.Locals("userID").(uint)
+		plan, _ := c.Locals("plan").(string)
+		if limit := settings.Current().SavedPromptLimits[plan]; limit > 0 {
+			var saved int64
+			if err := requestDB(c, h.db).Model(&models.SavedPrompt{}).Where("user_id = ?", userID).Count(&saved).Error; err != nil {
+				return internalError(c, "error.create_saved_prompt_failed")
+			}
+			if saved >= int64(limit) {
+				return apierror.Respond(c, apierror.New(fiber.StatusConflict, apierror.CodeConflict,
+					i18n.T(c, "error.saved_prompt_limit", i18n.Params{"max": limit})).With("max", limit))
+			}
+		}
+
+		prompt := models.SavedPrompt{UserID: userID}
+		applySavedPrompt(&prompt, &req)
+		if err := requestDB(c, h.db).Create(&prompt).Error; err != nil {
+			return internalError(c, "error.create_saved_prompt_failed")
+		}
+
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"message": i18n.T(c, "message.saved_prompt_created"),
+			"prompt":  prompt.ToResponse(),
+		})
+	}
+}
+
+// UpdateSavedPrompt replaces one of the caller's saved prompts.
+func (h *Handlers) UpdateSavedPrompt() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		prompt, err := savedPromptParam(c, h.db)
+		if prompt == nil {
+			return err
+		}
+
+		var req models.SavedPromptRequest
+		if apiErr := bindJSON(c, &req); apiErr != nil {
+			return apierror.Respond(c, apiErr)
+		}
+		if errs := validateSavedPrompt(c, h.cfg, &req); len(errs) > 0 {
+			return validationFailed(c, errs)
+		}
+
+		applySavedPrompt(prompt, &req)
+		if err := requestDB(c, h.db).Save(prompt).Error; err != nil {
+			return internalError(c, "error.update_saved_prompt_failed")
+		}
+
+		return c.JSON(fiber.Map{
+			"message": i18n.T(c, "message.saved_prompt_updated"),
+			"prompt":  prompt.ToResponse(),
+		})
+	}
+}
+
+func (h *Handlers) DeleteSavedPrompt() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		prompt, err := savedPromptParam(c, h.db)
+		if prompt == nil {
+			return err
+		}
+
+		if err := requestDB(c, h.db).Delete(prompt).Error; err != nil {
+			return internalError(c, "error.delete_saved_prompt_failed")
+		}
+
+		return c.JSON(fiber.Map{
+			"message": i18n.T(c, "message.saved_prompt_deleted"),
+		})
+	}
+}
+
+// GetPromptHistory lists the prompts the caller generated from recently,
+// newest first, each once with the style and lyrics it was last used
+// with. ?type narrows it to music or video.
+func (h *Handlers) GetPromptHistory() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.PromptHistoryRequest
+		if errs := bindQuery(c, &req); len(errs) > 0 {
+			return validationFailed(c, errs)
+		}
+
+		userID := c.Locals("userID").(uint)
+		query := database.Reader(requestDB(c, h.db), userID).Model(&models.Generation{}).
+			Select("id", "type", "prompt", "style", "lyrics", "created_at").
+			Where("user_id = ? AND prompt <> ''", userID)
+		if req.Type != "" {
+			query = query.Where("type = ?", req.Type)
+		}
+
+		var generations []models.Generation
+		if err := query.Order("created_at DESC, id DESC").Limit(promptHistoryScan).Find(&generations).Error; err != nil {
+			return internalError(c, "error.fetch_prompt_history_failed")
+		}
+
+		return c.JSON(fiber.Map{"history": promptHistory(generations)})
+	}
+}
+
+// promptHistory collapses generations, newest first, to one entry per
+// prompt, keyed by the prompt's hash.
+func promptHistory(generations []models.Generation) []models.PromptHistoryEntry {
+	history := []models.PromptHistoryEntry{}
+	seen := make(map[[sha256.Size]byte]int)
+	for _, g := range generations {
+		key := sha256.Sum256([]byte(g.Prompt))
+		if i, ok := seen[key]; ok {
+			history[i].TimesUsed++
+			continue
+		}
+		if len(history) == promptHistoryLimit {
+			continue
+		}
+		seen[key] = len(history)
+		history = append(history, models.PromptHistoryEntry{
+			Type:         g.Type,
+			Prompt:       g.Prompt,
+			Style:        g.Style,
+			Lyrics:       g.Lyrics,
+			GenerationID: g.ID,
+			TimesUsed:    1,
+			LastUsedAt:   g.CreatedAt,
+		})
+	}
+	return history
+}
+
+// savedPromptParam loads the caller's :id saved prompt. When it can't, it
+// writes the 400/404 response itself and returns a nil prompt; callers
+// then return the error as-is.
+func savedPromptParam(c *fiber.Ctx, db *gorm.DB) (*models.SavedPrompt, error) {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return nil, badRequest(c, "error.invalid_saved_prompt_id")
+	}
+
+	var prompt models.SavedPrompt
+	userID := c.Locals("userID").(uint)
+	if err := requestDB(c, db).Where("id = ? AND user_id = ?", id, userID).First(&prompt).Error; err != nil {
+		return nil, notFound(c, "error.saved_prompt_not_found")
+	}
+	return &prompt, nil
+}
+
+// savedPromptFor loads the saved prompt a generate request names, which
+// has to be the caller's and for the type being generated. Like
+// savedPromptParam it responds itself and returns nil when it can't.
+func savedPromptFor(c *fiber.Ctx, db *gorm.DB, userID, id uint, genType models.GenerationType) (*models.SavedPrompt, error) {
+	var prompt models.SavedPrompt
+	if err := requestDB(c, db).Where("id = ? AND user_id = ?", id, userID).First(&prompt).Error; err != nil {
+		return nil, notFound(c, "error.saved_prompt_not_found")
+	}
+	if prompt.Type != genType {
+		v := middleware.NewLocalizedValidator(i18n.Locale(c))
+		v.AddRuleError("saved_prompt_id", "invalid", nil)
+		return nil, validationFailed(c, v.Errors())
+	}
+	return &prompt, nil
+}
+
+// validateSavedPrompt applies the tag rules and the caller's plan text
+// limits, as the generate endpoints would. Lyrics templates are for music
+// only.
+func validateSavedPrompt(c *fiber.Ctx, cfg *config.Config, req *models.SavedPromptRequest) []middleware.ValidationError {
+	limits := textLimits(c, cfg)
+	v := middleware.NewLocalizedValidator(i18n.Locale(c)).Struct(req).
+		MaxLength("prompt", req.Prompt, limits.Prompt).
+		MaxLength("lyrics_template", req.LyricsTemplate, limits.Lyrics)
+	if req.Type == models.TypeVideo && req.LyricsTemplate != "" {
+		v.AddRuleError("lyrics_template", "invalid", nil)
+	}
+	return v.Errors()
+}
+
+func applySavedPrompt(prompt *models.SavedPrompt, req *models.SavedPromptRequest) {
+	prompt.Type = req.Type
+	prompt.Name = middleware.SanitizeInput(req.Name)
+	prompt.Prompt = middleware.SanitizeInput(req.Prompt)
+	prompt.Style = middleware.SanitizeInput(req.Style)
+	prompt.LyricsTemplate = middleware.SanitizeInput(req.LyricsTemplate)
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/zesbe/lumina-ai/internal/audit"
+	"github.com/zesbe/lumina-ai/internal/auth"
+	"github.com/zesbe/lumina-ai/internal/i18n"
+	"github.com/zesbe/lumina-ai/internal/middleware"
+	"github.com/zesbe/lumina-ai/internal/models"
+	"github.com/zesbe/lumina-ai/internal/session"
+)
+
+// ListSessions lists the caller's active sessions, flagging the one the
+// request was made from.
+func (h *Handlers) ListSessions() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+
+		sessions, err := session.Active(requestDB(c, h.db), userID, currentSession(c))
+		if err != nil {
+			middleware.Log(c).Error("failed to list sessions", "error", err)
+			return internalError(c, "error.fetch_sessions_failed")
+		}
+		return c.JSON(fiber.Map{"sessions": sessions})
+	}
+}
+
+// RevokeSession ends one of the caller's sessions, which may be the
+// current one.
+func (h *Handlers) RevokeSession() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+		sessionID := c.Params("id")
+
+		found, err := session.RevokeOwned(requestDB(c, h.db), userID, sessionID)
+		if err != nil {
+			middleware.Log(c).Error("failed to revoke session", "error", err)
+			return internalError(c, "error.revoke_session_failed")
+		}
+		if !found {
+			return notFound(c, "error.session_not_found")
+		}
+		h.endSessions(c, sessionID)
+		audit.Record(c, models.AuditSessionRevoke, audit.User(userID), fiber.Map{"sessions": []string{sessionID}})
+
+		return c.JSON(fiber.Map{
+			"message": i18n.T(c, "message.session_revoked"),
+		})
+	}
+}
+
+// RevokeOtherSessions ends every session of the caller but the current
+// one.
+func (h *Handlers) RevokeOtherSessions() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(uint)
+
+		sessionIDs, err := session.RevokeOthers(requestDB(c, h.db), userID, currentSession(c))
+		if err != nil {
+			middleware.Log(c).Error("failed to revoke sessions", "error", err)
+			return internalError(c, "error.revoke_session_failed")
+		}
+		h.endSessions(c, sessionIDs...)
+		audit.Record(c, models.AuditSessionRevoke, audit.User(userID), fiber.Map{"sessions": sessionIDs})
+
+		return c.JSON(fiber.Map{
+			"message":  i18n.T(c, "message.other_sessions_revoked"),
+			"sessions": len(sessionIDs),
+		})
+	}
+}
+
+// currentSession is the session of the request's access token, if any.
+func currentSession(c *fiber.Ctx) string {
+	if claims, ok := c.Locals("claims").(*auth.Claims); ok {
+		return claims.SessionID
+	}
+	return ""
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/audit"
+	"github.com/zesbe/lumina-ai/internal/i18n"
+	"github.com/zesbe/lumina-ai/internal/middleware"
+	"github.com/zesbe/lumina-ai/internal/models"
+	"github.com/zesbe/lumina-ai/internal/moderation"
+	"github.com/zesbe/lumina-ai/internal/settings"
+)
+
+const (
+	// maxDailyGenerationLimit bounds each plan's daily_generation_limits
+	// entry.
+	maxDailyGenerationLimit = 100000
+	// maxSavedPromptLimit bounds each plan's saved_prompt_limits entry.
+	maxSavedPromptLimit = 10000
+	// maxPublishFilterEntries and maxPublishFilterEntryLength bound each
+	// publish_filters list.
+	maxPublishFilterEntries     = 1000
+	maxPublishFilterEntryLength = 200
+)
+
+// publishFilterLanguage is a language code such as en, id or pt-br.
+var publishFilterLanguage = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})?$`)
+
+func (h *Handlers) GetSettings() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{
+			"settings": settings.Current(),
+		})
+	}
+}
+
+// UpdateSettings changes the runtime settings for every instance. Fields
+// left out of the body keep their current value; daily_generation_limits,
+// saved_prompt_limits and publish_filters are replaced as a whole when
+// present.
+func (h *Handlers) UpdateSettings() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		before := settings.Current()
+		updated := before.Clone()
+		updated.DailyGenerationLimits = nil
+		updated.SavedPromptLimits = nil
+		updated.PublishFilters = nil
+		if apiErr := bindJSON(c, &updated); apiErr != nil {
+			return apierror.Respond(c, apiErr)
+		}
+		if updated.DailyGenerationLimits == nil {
+			updated.DailyGenerationLimits = before.DailyGenerationLimits
+		}
+		if updated.SavedPromptLimits == nil {
+			updated.SavedPromptLimits = before.SavedPromptLimits
+		}
+		if updated.PublishFilters == nil {
+			updated.PublishFilters = before.PublishFilters
+		}
+
+		v := middleware.NewLocalizedValidator(i18n.Locale(c)).Struct(&updated)
+		validatePlanLimits(v, "daily_generation_limits", updated.DailyGenerationLimits, maxDailyGenerationLimit)
+		validatePlanLimits(v, "saved_prompt_limits", updated.SavedPromptLimits, maxSavedPromptLimit)
+		for lang, filter := range updated.PublishFilters {
+			field := "publish_filters." + lang
+			if !publishFilterLanguage.MatchString(lang) {
+				v.AddRuleError(field, "invalid", nil)
+				continue
+			}
+			validatePublishList(v, field+".hard", filter.Hard)
+			validatePublishList(v, field+".soft", filter.Soft)
+		}
+		if v.HasErrors() {
+			return validationFailed(c, v.Errors())
+		}
+
+		if err := settings.Set(updated); err != nil {
+			middleware.Log(c).Error("failed to store runtime settings", "error", err)
+			return internalError(c, "error.save_settings_failed")
+		}
+
+		audit.Record(c, models.AuditSettingsChange, audit.Target{Type: "settings", ID: "runtime"}, fiber.Map{
+			"before": before,
+			"after":  updated,
+		})
+
+		return c.JSON(fiber.Map{
+			"settings": settings.Current(),
+		})
+	}
+}
+
+// validatePlanLimits checks a per-plan limit setting: every key a plan,
+// every value between 0 and ceiling.
+func validatePlanLimits(v *middleware.Validator, field string, limits map[string]int, ceiling int) {
+	for plan, limit := range limits {
+		name := field + "." + plan
+		if !isPlan(plan) {
+			v.AddRuleError(name, "invalid", nil)
+			continue
+		}
+		switch {
+		case limit < 0:
+			v.AddRuleError(name, "min_value", i18n.Params{"min": 0})
+		case limit > ceiling:
+			v.AddRuleError(name, "max_value", i18n.Params{"max": ceiling})
+		}
+	}
+}
+
+// validatePublishList checks that every entry of a publish filter list
+// compiles, so a typo is refused here rather than skipped at publish time.
+func validatePublishList(v *middleware.Validator, field string, entries []string) {
+	if len(entries) > maxPublishFilterEntries {
+		v.AddRuleError(field, "max_items", i18n.Params{"max": maxPublishFilterEntries})
+		return
+	}
+	for i, entry := range entries {
+		name := fmt.Sprintf("%s.%d", field, i)
+		if len(entry) > maxPublishFilterEntryLength {
+			v.AddRuleError(name, "max_length", i18n.Params{"max": maxPublishFilterEntryLength})
+		} else if _, err := moderation.CompilePublishEntry(entry); err != nil {
+			v.AddRuleError(name, "invalid", nil)
+		}
+	}
+}
+
+func isPlan(name string) bool {
+	for _, plan := range models.DefaultPlans {
+		if string(plan.Name) == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"context"
+	"runtime"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"github.com/zesbe/lumina-ai/internal/cache"
+	"github.com/zesbe/lumina-ai/internal/database"
+	"github.com/zesbe/lumina-ai/internal/models"
+	"github.com/zesbe/lumina-ai/internal/version"
+)
+
+// redisStatsTimeout bounds the Redis ping in ServerStats.
+const redisStatsTimeout = time.Second
+
+// startedAt is when the process started, for uptime.
+var startedAt = time.Now()
+
+// generationStatuses are always present in generations_last_hour, zero or
+// not, so scrapers see the same keys every time.
+var generationStatuses = []models.GenerationStatus{
+	models.StatusPending,
+	models.StatusProcessing,
+	models.StatusInterrupted,
+	models.StatusCompleted,
+	models.StatusFailed,
+}
+
+// PublicStats is the part of ServerStats that is safe for anyone to see.
+func (h *Handlers) PublicStats() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{
+			"version":        version.Version,
+			"uptime_seconds": int64(time.Since(startedAt).Seconds()),
+		})
+	}
+}
+
+// GetVersion reports the running build.
+func (h *Handlers) GetVersion() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(version.Get())
+	}
+}
+
+// ServerStats is the admin view of this instance for dashboards. The
+// nested keys are stable; add to them rather than renaming.
+func (h *Handlers) ServerStats() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+
+		byStatus, err := generationsByStatus(requestDB(c, h.db), time.Now().Add(-time.Hour))
+		if err != nil {
+			return internalError(c, "error.fetch_stats_failed")
+		}
+
+		return c.JSON(fiber.Map{
+			"service": fiber.Map{
+				"version":        version.Version,
+				"commit":         version.Commit,
+				"build_time":     version.BuildTime,
+				"started_at":     startedAt.UTC(),
+				"uptime_seconds": int64(time.Since(startedAt).Seconds()),
+			},
+			"runtime": fiber.Map{
+				"goroutines": runtime.NumGoroutine(),
+				"cpu_cores":  runtime.NumCPU(),
+				"go_version": runtime.Version(),
+				"memory": fiber.Map{
+					"alloc_mb":       m.Alloc / 1024 / 1024,
+					"total_alloc_mb": m.TotalAlloc / 1024 / 1024,
+					"sys_mb":         m.Sys / 1024 / 1024,
+					"num_gc":         m.NumGC,
+				},
+			},
+			"database": fiber.Map{
+				"pool": database.Stats(h.db),
+			},
+			"redis":                 redisStats(c.UserContext(), h.cache),
+			"cache":                 cacheStats(h.cache),
+			"websocket":             fiber.Map{"connections": h.hub.Count()},
+			"jobs":                  fiber.Map{"running": h.jobs.active.Load()},
+			"generations_last_hour": byStatus,
+		})
+	}
+}
+
+func redisStats(ctx context.Context, redis *cache.RedisCache) fiber.Map {
+	if redis == nil {
+		return fiber.Map{"connected": false, "latency_ms": 0}
+	}
+	pingCtx, cancel := context.WithTimeout(ctx, redisStatsTimeout)
+	defer cancel()
+	latency, err := redis.Ping(pingCtx)
+	if err != nil {
+		return fiber.Map{"connected": false, "latency_ms": 0, "error": err.Error()}
+	}
+	return fiber.Map{"connected": true, "latency_ms": float64(latency.Microseconds()) / 1000}
+}
+
+func cacheStats(redis *cache.RedisCache) cache.Stats {
+	if redis == nil {
+		return cache.Stats{}
+	}
+	return redis.Stats()
+}
+
+// generationsByStatus counts generations created since since, by status,
+// leaving out demo ones.
+func generationsByStatus(db *gorm.DB, since time.Time) (map[models.GenerationStatus]int64, error) {
+	var rows []struct {
+		Status models.GenerationStatus
+		Count  int64
+	}
+	if err := realGenerations(db).
+		Select("status, COUNT(*) AS count").
+		Where("created_at >= ?", since).
+		Group("status").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	counts := make(map[models.GenerationStatus]int64, len(generationStatuses))
+	for _, status := range generationStatuses {
+		counts[status] = 0
+	}
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	return counts, nil
+}
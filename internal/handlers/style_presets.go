@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/audit"
+	"github.com/zesbe/lumina-ai/internal/cache"
+	"github.com/zesbe/lumina-ai/internal/i18n"
+	"github.com/zesbe/lumina-ai/internal/middleware"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+const (
+	// stylePresetsCacheKey holds the picker list; admin changes delete it.
+	stylePresetsCacheKey = "style_presets"
+	stylePresetsTTL      = 10 * time.Minute
+)
+
+// catalogNamePattern is the name of a style preset or video template.
+var catalogNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,49}$`)
+
+// ListStylePresets is the music style picker: the active presets in their
+// sort order. It needs no login and is cached, here and by clients.
+func (h *Handlers) ListStylePresets() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+
+		if h.cache != nil {
+			var cached []models.StylePresetResponse
+			if err := h.cache.Get(stylePresetsCacheKey, &cached); err == nil {
+				return c.JSON(fiber.Map{"styles": cached})
+			}
+		}
+
+		var presets []models.StylePreset
+		if err := requestDB(c, h.db).Where("is_active = ?", true).
+			Order("sort_order, display_name").Find(&presets).Error; err != nil {
+			return internalError(c, "error.fetch_style_presets_failed")
+		}
+
+		response := make([]models.StylePresetResponse, len(presets))
+		for i := range presets {
+			response[i] = presets[i].ToResponse()
+		}
+		if h.cache != nil {
+			h.cache.Set(stylePresetsCacheKey, response, stylePresetsTTL)
+		}
+		return c.JSON(fiber.Map{"styles": response})
+	}
+}
+
+// AdminListStylePresets lists every preset, inactive ones included, with
+// its prompt fragment.
+func (h *Handlers) AdminListStylePresets() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var presets []models.StylePreset
+		if err := requestDB(c, h.db).Order("sort_order, display_name").Find(&presets).Error; err != nil {
+			return internalError(c, "error.fetch_style_presets_failed")
+		}
+
+		response := make([]models.AdminStylePresetResponse, len(presets))
+		for i := range presets {
+			response[i] = presets[i].ToAdminResponse()
+		}
+		return c.JSON(fiber.Map{"styles": response})
+	}
+}
+
+// UpsertStylePreset creates or replaces the preset named by :name. A
+// deleted preset of that name comes back under its old ID, so
+// generations that used it are counted together.
+func (h *Handlers) UpsertStylePreset() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		name := c.Params("name")
+
+		var req models.UpsertStylePresetRequest
+		if apiErr := bindJSON(c, &req); apiErr != nil {
+			return apierror.Respond(c, apiErr)
+		}
+
+		v := middleware.NewLocalizedValidator(i18n.Locale(c)).Struct(&req)
+		if !catalogNamePattern.MatchString(name) {
+			v.AddRuleError("name", "invalid", nil)
+		}
+		if v.HasErrors() {
+			return validationFailed(c, v.Errors())
+		}
+
+		preset := models.StylePreset{
+			Name:             name,
+			DisplayName:      req.DisplayName,
+			PromptFragment:   req.PromptFragment,
+			SuggestedBitrate: req.SuggestedBitrate,
+			SuggestedModel:   req.SuggestedModel,
+			ThumbnailURL:     req.ThumbnailURL,
+			SortOrder:        req.SortOrder,
+			IsActive:         req.IsActive == nil || *req.IsActive,
+		}
+		if err := requestDB(c, h.db).Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "name"}},
+			DoUpdates: clause.AssignmentColumns([]string{
+				"display_name", "prompt_fragment", "suggested_bitrate", "suggested_model",
+				"thumbnail_url", "sort_order", "is_active", "updated_at", "deleted_at",
+			}),
+		}).Create(&preset).Error; err != nil {
+			return internalError(c, "error.save_style_preset_failed")
+		}
+		requestDB(c, h.db).Where("name = ?", name).First(&preset)
+		forgetStylePresets(h.cache)
+
+		audit.Record(c, models.AuditStylePresetChange, audit.Target{Type: "style_preset", ID: preset.Name}, fiber.Map{
+			"op":        "upsert",
+			"id":        preset.ID,
+			"is_active": preset.IsActive,
+		})
+
+		return c.JSON(fiber.Map{
+			"style": preset.ToAdminResponse(),
+		})
+	}
+}
+
+// DeleteStylePreset takes a preset out of the catalog. The row is kept
+// soft-deleted for the analytics of generations that used it.
+func (h *Handlers) DeleteStylePreset() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var preset models.StylePreset
+		if err := requestDB(c, h.db).Where("name = ?", c.Params("name")).First(&preset).Error; err != nil {
+			return notFound(c, "error.style_preset_not_found")
+		}
+		if err := requestDB(c, h.db).Delete(&preset).Error; err != nil {
+			return internalError(c, "error.save_style_preset_failed")
+		}
+		forgetStylePresets(h.cache)
+
+		audit.Record(c, models.AuditStylePresetChange, audit.Target{Type: "style_preset", ID: preset.Name}, fiber.Map{
+			"op": "delete",
+			"id": preset.ID,
+		})
+
+		return c.JSON(fiber.Map{
+			"message": i18n.T(c, "message.style_preset_deleted"),
+		})
+	}
+}
+
+// stylePresetFor loads the active preset a generate request names. When
+// there is none it writes a validation error itself and returns nil;
+// callers then return the error as-is.
+func stylePresetFor(c *fiber.Ctx, db *gorm.DB, id uint) (*models.StylePreset, error) {
+	var preset models.StylePreset
+	if err := requestDB(c, db).Where("id = ? AND is_active = ?", id, true).First(&preset).Error; err != nil {
+		v := middleware.NewLocalizedValidator(i18n.Locale(c))
+		v.AddRuleError("style_id", "invalid", nil)
+		return nil, validationFailed(c, v.Errors())
+	}
+	return &preset, nil
+}
+
+func forgetStylePresets(redis *cache.RedisCache) {
+	if redis != nil {
+		redis.Delete(stylePresetsCacheKey)
+	}
+}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/audit"
+	"github.com/zesbe/lumina-ai/internal/i18n"
+	"github.com/zesbe/lumina-ai/internal/middleware"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+const (
+	// The export outlives the request deadline: the handler returns
+	// before the body is written.
+	transactionExportTimeout = 15 * time.Minute
+	transactionExportFlush   = 1000
+
+	headerRowCount     = "X-Row-Count"
+	headerExportStatus = "X-Export-Status"
+)
+
+var transactionCSVHeader = []string{"id", "created_at", "user_id", "user_email", "amount", "type", "description", "generation_id", "balance_before", "balance_after"}
+
+type transactionExportRow struct {
+	ID            uint      `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UserID        uint      `json:"user_id"`
+	UserEmail     string    `json:"user_email"`
+	Amount        int       `json:"amount"`
+	Type          string    `json:"type"`
+	Description   string    `json:"description"`
+	GenerationID  *uint     `json:"generation_id"`
+	BalanceBefore int       `json:"balance_before"`
+	BalanceAfter  int       `json:"balance_after"`
+}
+
+// ExportCreditTransactions streams every credit movement in a UTC date
+// range as CSV (default) or JSON lines (format=jsonl), oldest first. from
+// defaults to the start of the current month and to to now. Rows are
+// written as they are read, gzipped when the client accepts it, and the
+// number written is sent in the X-Row-Count trailer and logged so the
+// dump can be reconciled.
+func (h *Handlers) ExportCreditTransactions() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		format := c.Query("format", "csv")
+		if format != "csv" && format != "jsonl" {
+			return badRequest(c, "error.invalid_export_format")
+		}
+
+		from, to, err := parseDateRange(c.Query("from"), c.Query("to"))
+		if err != nil {
+			return errorResponse(c, fiber.StatusBadRequest, apierror.CodeBadRequest, i18n.Message(c, err))
+		}
+		now := time.Now().UTC()
+		if from.IsZero() {
+			from = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		}
+		if to.IsZero() {
+			to = now
+		}
+		txType := c.Query("type")
+
+		audit.Record(c, models.AuditTransactionExport, audit.Target{Type: "credit_transactions"}, fiber.Map{
+			"from":   from.Format(time.RFC3339),
+			"to":     to.Format(time.RFC3339),
+			"type":   txType,
+			"format": format,
+		})
+
+		ext, contentType := "csv", "text/csv; charset=utf-8"
+		if format == "jsonl" {
+			ext, contentType = "jsonl", "application/x-ndjson"
+		}
+		gzipped := strings.Contains(c.Get(fiber.HeaderAcceptEncoding), "gzip")
+
+		c.Set(fiber.HeaderContentType, contentType)
+		c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="transactions-%s-%s.%s"`,
+			from.Format("20060102"), to.Format("20060102"), ext))
+		c.Set(fiber.HeaderVary, fiber.HeaderAcceptEncoding)
+		if gzipped {
+			c.Set(fiber.HeaderContentEncoding, "gzip")
+		}
+		c.Response().Header.AddTrailer(headerRowCount)
+		c.Response().Header.AddTrailer(headerExportStatus)
+
+		log := middleware.Log(c).With("from", from, "to", to, "type", txType, "format", format)
+		resp := c.Response()
+
+		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			start := time.Now()
+			ctx, cancel := context.WithTimeout(context.Background(), transactionExportTimeout)
+			defer cancel()
+
+			var out io.Writer = w
+			var zw *gzip.Writer
+			if gzipped {
+				zw = gzip.NewWriter(w)
+				out = zw
+			}
+
+			rows, err := writeTransactionExport(ctx, h.db, out, format, from, to, txType, func() {
+				if zw != nil {
+					zw.Flush()
+				}
+				w.Flush()
+			})
+			if zw != nil {
+				if closeErr := zw.Close(); err == nil {
+					err = closeErr
+				}
+			}
+
+			// Trailers are written once this function returns.
+			resp.Header.Set(headerRowCount, strconv.FormatInt(rows, 10))
+			if err != nil {
+				resp.Header.Set(headerExportStatus, "failed")
+				log.Error("credit transaction export failed", "rows", rows, "error", err)
+				return
+			}
+			resp.Header.Set(headerExportStatus, "complete")
+			log.Info("credit transaction export finished", "rows", rows, "duration_ms", time.Since(start).Milliseconds())
+		})
+
+		return nil
+	}
+}
+
+func writeTransactionExport(ctx context.Context, db *gorm.DB, out io.Writer, format string, from, to time.Time, txType string, flush func()) (int64, error) {
+	query := db.WithContext(ctx).Model(&models.CreditTransaction{}).
+		Select("credit_transactions.id, credit_transactions.created_at, credit_transactions.user_id, users.email AS user_email, "+
+			"credit_transactions.amount, credit_transactions.type, credit_transactions.description, credit_transactions.generation_id, "+
+			"credit_transactions.balance_before, credit_transactions.balance_after").
+		Joins("LEFT JOIN users ON users.id = credit_transactions.user_id").
+		Where("credit_transactions.created_at >= ? AND credit_transactions.created_at < ?", from, to).
+		Order("credit_transactions.created_at, credit_transactions.id")
+	if txType != "" {
+		query = query.Where("credit_transactions.type = ?", txType)
+	}
+
+	rows, err := query.Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var write func(row *transactionExportRow) error
+	var csvWriter *csv.Writer
+	if format == "jsonl" {
+		enc := json.NewEncoder(out)
+		write = func(row *transactionExportRow) error { return enc.Encode(row) }
+	} else {
+		csvWriter = csv.NewWriter(out)
+		if err := csvWriter.Write(transactionCSVHeader); err != nil {
+			return 0, err
+		}
+		write = func(row *transactionExportRow) error {
+			generationID := ""
+			if row.GenerationID != nil {
+				generationID = strconv.FormatUint(uint64(*row.GenerationID), 10)
+			}
+			return csvWriter.Write([]string{
+				strconv.FormatUint(uint64(row.ID), 10),
+				row.CreatedAt.UTC().Format(time.RFC3339),
+				strconv.FormatUint(uint64(row.UserID), 10),
+				csvSafe(row.UserEmail),
+				strconv.Itoa(row.Amount),
+				row.Type,
+				csvSafe(row.Description),
+				generationID,
+				strconv.Itoa(row.BalanceBefore),
+				strconv.Itoa(row.BalanceAfter),
+			})
+		}
+	}
+
+	var n int64
+	for rows.Next() {
+		var row transactionExportRow
+		if err := db.ScanRows(rows, &row); err != nil {
+			return n, err
+		}
+		if err := write(&row); err != nil {
+			return n, err
+		}
+		n++
+		if n%transactionExportFlush == 0 {
+			if csvWriter != nil {
+				csvWriter.Flush()
+			}
+			flush()
+		}
+	}
+	if csvWriter != nil {
+		csvWriter.Flush()
+		if err := csvWriter.Error(); err != nil {
+			return n, err
+		}
+	}
+	return n, rows.Err()
+}
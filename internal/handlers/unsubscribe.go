@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/audit"
+	"github.com/zesbe/lumina-ai/internal/i18n"
+	"github.com/zesbe/lumina-ai/internal/middleware"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+// unsubscribable are the preferences an unsubscribe link can turn off:
+// the ones for email.
+var unsubscribable = map[string]bool{
+	models.PrefNewDeviceEmail:          true,
+	models.PrefGenerationCompleteEmail: true,
+	models.PrefMarketingEmail:          true,
+}
+
+// unsubscribeTokens signs the tokens in unsubscribe links. A token names
+// the user and the preference and never expires, so a link in an old
+// email still works; all it can do is turn that one email off.
+type unsubscribeTokens struct {
+	key []byte
+}
+
+func newUnsubscribeTokens(secret string) unsubscribeTokens {
+	key := sha256.Sum256([]byte("unsubscribe:" + secret))
+	return unsubscribeTokens{key: key[:]}
+}
+
+func (t unsubscribeTokens) sign(payload string) string {
+	mac := hmac.New(sha256.New, t.key)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// issue is a token turning preference off for userID.
+func (t unsubscribeTokens) issue(userID uint, preference string) string {
+	payload := fmt.Sprintf("%d.%s", userID, preference)
+	return payload + "." + t.sign(payload)
+}
+
+// parse returns the user and preference a token was issued for.
+func (t unsubscribeTokens) parse(token string) (uint, string, bool) {
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 || !hmac.Equal([]byte(token[i+1:]), []byte(t.sign(token[:i]))) {
+		return 0, "", false
+	}
+	id, preference, ok := strings.Cut(token[:i], ".")
+	if !ok {
+		return 0, "", false
+	}
+	userID, err := strconv.ParseUint(id, 10, 32)
+	if err != nil || !unsubscribable[preference] {
+		return 0, "", false
+	}
+	return uint(userID), preference, true
+}
+
+// Unsubscribe turns off the email an unsubscribe link was mailed with.
+// The token is the credential, so it works without logging in, and using
+// it again changes nothing.
+func (h *Handlers) Unsubscribe() fiber.Handler {
+	tokens := newUnsubscribeTokens(h.cfg.JWTSecret)
+
+	return func(c *fiber.Ctx) error {
+		var req models.UnsubscribeRequest
+		if apiErr := bindJSON(c, &req); apiErr != nil {
+			return apierror.Respond(c, apiErr)
+		}
+
+		if errs := middleware.ValidateRequest(c, &req); len(errs) > 0 {
+			return validationFailed(c, errs)
+		}
+
+		userID, preference, ok := tokens.parse(req.Token)
+		if !ok {
+			return errorResponse(c, fiber.StatusBadRequest, apierror.CodeInvalidToken, i18n.T(c, "error.unsubscribe_token_invalid"))
+		}
+
+		prefs, err := notificationPreferences(requestDB(c, h.db), userID)
+		if err != nil {
+			return internalError(c, "error.update_notification_preferences_failed")
+		}
+		*prefs.Field(preference) = false
+		if err := saveNotificationPreferences(requestDB(c, h.db), &prefs); err != nil {
+			middleware.Log(c).Error("failed to save notification preferences", "error", err)
+			return internalError(c, "error.update_notification_preferences_failed")
+		}
+
+		audit.RecordAs(c, nil, models.AuditUnsubscribe, audit.User(userID), fiber.Map{"preference": preference})
+
+		return c.JSON(fiber.Map{
+			"message":    i18n.T(c, "message.unsubscribed"),
+			"preference": preference,
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/audit"
+	"github.com/zesbe/lumina-ai/internal/cache"
+	"github.com/zesbe/lumina-ai/internal/i18n"
+	"github.com/zesbe/lumina-ai/internal/middleware"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+const (
+	// videoTemplatesCacheKey holds the picker list; admin changes delete it.
+	videoTemplatesCacheKey = "video_templates"
+	videoTemplatesTTL      = 10 * time.Minute
+)
+
+// ListVideoTemplates is the video template picker: the active templates
+// in their sort order, with the slots each one takes. It needs no login
+// and is cached, here and by clients.
+func (h *Handlers) ListVideoTemplates() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+
+		if h.cache != nil {
+			var cached []models.VideoTemplateResponse
+			if err := h.cache.Get(videoTemplatesCacheKey, &cached); err == nil {
+				return c.JSON(fiber.Map{"templates": cached})
+			}
+		}
+
+		var templates []models.VideoTemplate
+		if err := requestDB(c, h.db).Where("is_active = ?", true).
+			Order("sort_order, display_name").Find(&templates).Error; err != nil {
+			return internalError(c, "error.fetch_video_templates_failed")
+		}
+
+		response := make([]models.VideoTemplateResponse, len(templates))
+		for i := range templates {
+			response[i] = templates[i].ToResponse()
+		}
+		if h.cache != nil {
+			h.cache.Set(videoTemplatesCacheKey, response, videoTemplatesTTL)
+		}
+		return c.JSON(fiber.Map{"templates": response})
+	}
+}
+
+// AdminListVideoTemplates lists every template, inactive ones included.
+func (h *Handlers) AdminListVideoTemplates() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var templates []models.VideoTemplate
+		if err := requestDB(c, h.db).Order("sort_order, display_name").Find(&templates).Error; err != nil {
+			return internalError(c, "error.fetch_video_templates_failed")
+		}
+
+		response := make([]models.AdminVideoTemplateResponse, len(templates))
+		for i := range templates {
+			response[i] = templates[i].ToAdminResponse()
+		}
+		return c.JSON(fiber.Map{"templates": response})
+	}
+}
+
+// UpsertVideoTemplate creates or replaces the template named by :name. A
+// deleted template of that name comes back under its old ID.
+func (h *Handlers) UpsertVideoTemplate() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		name := c.Params("name")
+
+		var req models.UpsertVideoTemplateRequest
+		if apiErr := bindJSON(c, &req); apiErr != nil {
+			return apierror.Respond(c, apiErr)
+		}
+
+		template := models.VideoTemplate{
+			Name:              name,
+			DisplayName:       req.DisplayName,
+			BasePrompt:        req.BasePrompt,
+			DefaultModel:      req.DefaultModel,
+			DefaultDuration:   req.DefaultDuration,
+			DefaultResolution: req.DefaultResolution,
+			NarrationExpected: req.NarrationExpected,
+			ThumbnailURL:      req.ThumbnailURL,
+			SortOrder:         req.SortOrder,
+			IsActive:          req.IsActive == nil || *req.IsActive,
+		}
+
+		v := middleware.NewLocalizedValidator(i18n.Locale(c)).Struct(&req)
+		if !catalogNamePattern.MatchString(name) {
+			v.AddRuleError("name", "invalid", nil)
+		}
+		if template.HasMalformedSlot() {
+			v.AddRuleError("base_prompt", "invalid", nil)
+		}
+		if v.HasErrors() {
+			return validationFailed(c, v.Errors())
+		}
+
+		if err := requestDB(c, h.db).Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "name"}},
+			DoUpdates: clause.AssignmentColumns([]string{
+				"display_name", "base_prompt", "default_model", "default_duration", "default_resolution",
+				"narration_expected", "thumbnail_url", "sort_order", "is_active", "updated_at", "deleted_at",
+			}),
+		}).Create(&template).Error; err != nil {
+			return internalError(c, "error.save_video_template_failed")
+		}
+		requestDB(c, h.db).Where("name = ?", name).First(&template)
+		forgetVideoTemplates(h.cache)
+
+		audit.Record(c, models.AuditVideoTemplateChange, audit.Target{Type: "video_template", ID: template.Name}, fiber.Map{
+			"op":        "upsert",
+			"id":        template.ID,
+			"is_active": template.IsActive,
+		})
+
+		return c.JSON(fiber.Map{
+			"template": template.ToAdminResponse(),
+		})
+	}
+}
+
+// DeleteVideoTemplate takes a template out of the catalog. The row is
+// kept soft-deleted so generations rendered from it keep their reference.
+func (h *Handlers) DeleteVideoTemplate() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var template models.VideoTemplate
+		if err := requestDB(c, h.db).Where("name = ?", c.Params("name")).First(&template).Error; err != nil {
+			return notFound(c, "error.video_template_not_found")
+		}
+		if err := requestDB(c, h.db).Delete(&template).Error; err != nil {
+			return internalError(c, "error.save_video_template_failed")
+		}
+		forgetVideoTemplates(h.cache)
+
+		audit.Record(c, models.AuditVideoTemplateChange, audit.Target{Type: "video_template", ID: template.Name}, fiber.Map{
+			"op": "delete",
+			"id": template.ID,
+		})
+
+		return c.JSON(fiber.Map{
+			"message": i18n.T(c, "message.video_template_deleted"),
+		})
+	}
+}
+
+// videoTemplateFor loads the active template a generate request names and
+// checks the request's values against its slots: every required slot
+// filled, no unknown slots, each value safe and at most
+// models.MaxTemplateValueLength long. When either fails it writes a
+// validation error itself and returns nil; callers then return the error
+// as-is.
+func videoTemplateFor(c *fiber.Ctx, db *gorm.DB, req *models.GenerateVideoRequest) (*models.VideoTemplate, error) {
+	v := middleware.NewLocalizedValidator(i18n.Locale(c))
+
+	var template models.VideoTemplate
+	if err := requestDB(c, db).Where("id = ? AND is_active = ?", req.TemplateID, true).First(&template).Error; err != nil {
+		v.AddRuleError("template_id", "invalid", nil)
+		return nil, validationFailed(c, v.Errors())
+	}
+
+	slots := make(map[string]bool)
+	for _, slot := range template.Slots() {
+		slots[slot.Name] = true
+		if slot.Required && strings.TrimSpace(req.TemplateValues[slot.Name]) == "" {
+			v.AddRuleError("template_values."+slot.Name, "required", nil)
+		}
+	}
+	names := make([]string, 0, len(req.TemplateValues))
+	for name := range req.TemplateValues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		field, value := "template_values."+name, req.TemplateValues[name]
+		if !slots[name] {
+			v.AddRuleError(field, "invalid", nil)
+			continue
+		}
+		v.MaxLength(field, value, models.MaxTemplateValueLength).SafeHTML(field, value)
+	}
+	if v.HasErrors() {
+		return nil, validationFailed(c, v.Errors())
+	}
+	return &template, nil
+}
+
+func forgetVideoTemplates(redis *cache.RedisCache) {
+	if redis != nil {
+		redis.Delete(videoTemplatesCacheKey)
+	}
+}
@@ -0,0 +1,138 @@
+// Package health checks the services the API depends on. The readiness
+// endpoint and the -check startup command run the same checks.
+package health
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/zesbe/lumina-ai/internal/cache"
+	"github.com/zesbe/lumina-ai/internal/config"
+	"github.com/zesbe/lumina-ai/internal/database"
+	"github.com/zesbe/lumina-ai/internal/services"
+)
+
+// Timeout bounds each check.
+const Timeout = 2 * time.Second
+
+// Dependency is one line of the breakdown. Status is ok, degraded (working
+// without it, by design or not) or down.
+type Dependency struct {
+	Status    string `json:"status"`
+	Required  bool   `json:"required"`
+	LatencyMs int64  `json:"latency_ms,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Detail    string `json:"detail,omitempty"`
+}
+
+// Failed reports whether the dependency is configured but not working, as
+// opposed to deliberately left out.
+func (d Dependency) Failed() bool {
+	return d.Status == "down" || d.Error != ""
+}
+
+// Report is the result of Check.
+type Report struct {
+	Status    string                `json:"status"`
+	CheckedAt time.Time             `json:"checked_at"`
+	Checks    map[string]Dependency `json:"checks"`
+}
+
+// Check runs every check. The report is not_ready when a required
+// dependency (the database) is down.
+func Check(ctx context.Context, db *gorm.DB, cfg *config.Config) Report {
+	checks := map[string]Dependency{
+		"database": Database(ctx, db),
+		"redis":    Redis(ctx),
+		"ffmpeg":   FFmpeg(),
+		"minimax":  Provider(cfg),
+	}
+
+	status := "ready"
+	for _, check := range checks {
+		if check.Required && check.Status == "down" {
+			status = "not_ready"
+		}
+	}
+	return Report{Status: status, CheckedAt: time.Now(), Checks: checks}
+}
+
+// Database runs a trivial query on the primary.
+func Database(ctx context.Context, db *gorm.DB) Dependency {
+	h := database.Check(ctx, db, Timeout)
+	return Dependency{
+		Status:    h.Status,
+		Required:  true,
+		LatencyMs: h.LatencyMs,
+		Error:     h.Error,
+	}
+}
+
+// Redis reports Redis as degraded rather than down: without it the API
+// falls back to per-instance caches and limits.
+func Redis(ctx context.Context) Dependency {
+	if cache.Cache == nil {
+		return Dependency{Status: "degraded", Detail: "not configured"}
+	}
+	ctx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+	latency, err := cache.Cache.Ping(ctx)
+	if err != nil {
+		return Dependency{Status: "degraded", LatencyMs: latency.Milliseconds(), Error: err.Error()}
+	}
+	return Dependency{Status: "ok", LatencyMs: latency.Milliseconds()}
+}
+
+// FFmpeg looks for the binary used to add voiceovers to videos.
+func FFmpeg() Dependency {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		return Dependency{Status: "degraded", Error: err.Error(), Detail: "narrated videos will be silent"}
+	}
+	return Dependency{Status: "ok"}
+}
+
+// Provider reports whether MiniMax is configured, without calling it.
+func Provider(cfg *config.Config) Dependency {
+	switch {
+	case cfg.DemoMode:
+		return Dependency{Status: "ok", Detail: "demo mode"}
+	case cfg.MiniMaxAPIKey == "":
+		return Dependency{Status: "degraded", Detail: "not configured"}
+	}
+	return Dependency{Status: "ok"}
+}
+
+// Generations reports how many generations are running against limit.
+// A saturated instance is degraded rather than down: it refuses new
+// generations but everything else still works, so it stays in rotation.
+func Generations(active, limit int64) Dependency {
+	d := Dependency{Status: "ok", Detail: fmt.Sprintf("%d of %d running", active, limit)}
+	if active >= limit {
+		d.Status = "degraded"
+		d.Detail += "; new generations are refused"
+	}
+	return d
+}
+
+// ProviderKey is Provider plus one cheap authenticated MiniMax call, to
+// catch a key that is set but wrong.
+func ProviderKey(ctx context.Context, cfg *config.Config) Dependency {
+	d := Provider(cfg)
+	if d.Status != "ok" || cfg.MiniMaxAPIKey == "" {
+		return d
+	}
+	ctx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := services.NewMiniMaxService(cfg.MiniMaxAPIKey, cfg.MiniMaxGroupID).WithContext(ctx).VerifyKey()
+	d.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		d.Status, d.Error = "degraded", err.Error()
+	}
+	return d
+}
@@ -0,0 +1,161 @@
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const DefaultLocale = "en"
+
+// Params are substituted into "{name}" placeholders of a message template.
+type Params map[string]interface{}
+
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+var catalogs = map[string]map[string]string{}
+
+func init() {
+	entries, err := localeFiles.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	for _, entry := range entries {
+		data, err := localeFiles.ReadFile("locales/" + entry.Name())
+		if err != nil {
+			panic(err)
+		}
+		messages := map[string]string{}
+		if err := json.Unmarshal(data, &messages); err != nil {
+			panic(fmt.Sprintf("i18n: %s: %v", entry.Name(), err))
+		}
+		catalogs[strings.TrimSuffix(entry.Name(), path.Ext(entry.Name()))] = messages
+	}
+}
+
+// Supported reports whether a catalog is bundled for locale.
+func Supported(locale string) bool {
+	_, ok := catalogs[locale]
+	return ok
+}
+
+// Translate renders key in locale. Keys missing from the locale fall back
+// to English, and keys missing everywhere are returned as-is so a typo
+// shows up in the response instead of an empty string.
+func Translate(locale, key string, params Params) string {
+	template, ok := catalogs[locale][key]
+	if !ok {
+		if template, ok = catalogs[DefaultLocale][key]; !ok {
+			return key
+		}
+	}
+	if len(params) == 0 {
+		return template
+	}
+
+	pairs := make([]string, 0, len(params)*2)
+	for name, value := range params {
+		pairs = append(pairs, "{"+name+"}", fmt.Sprint(value))
+	}
+	return strings.NewReplacer(pairs...).Replace(template)
+}
+
+// Locale returns the request's locale: a supported ?lang= override wins,
+// then the best supported Accept-Language entry, then English. The result
+// is cached in Locals, and the response is marked as varying by
+// Accept-Language so shared caches don't serve one language to everyone.
+func Locale(c *fiber.Ctx) string {
+	if locale, ok := c.Locals("locale").(string); ok {
+		return locale
+	}
+	c.Vary(fiber.HeaderAcceptLanguage)
+
+	locale := normalize(c.Query("lang"))
+	if locale == "" {
+		locale = Match(c.Get(fiber.HeaderAcceptLanguage))
+	}
+	c.Locals("locale", locale)
+	return locale
+}
+
+// T translates key for the request's locale.
+func T(c *fiber.Ctx, key string, params ...Params) string {
+	var p Params
+	if len(params) > 0 {
+		p = params[0]
+	}
+	return Translate(Locale(c), key, p)
+}
+
+// Match picks the supported language with the highest q-value from an
+// Accept-Language header, e.g. "id-ID,id;q=0.9,en;q=0.8".
+func Match(header string) string {
+	best, bestQ := DefaultLocale, 0.0
+	for _, part := range strings.Split(header, ",") {
+		tag, weight, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(weight), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		if locale := normalize(tag); locale != "" && q > bestQ {
+			best, bestQ = locale, q
+		}
+	}
+	return best
+}
+
+// normalize reduces a language tag to a bundled locale, or "" if there is
+// none. Only the primary subtag matters: "id-ID" and "id" are the same.
+func normalize(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	// "in" is the pre-1989 code for Indonesian that older Java/Android
+	// clients still send.
+	if tag == "in" {
+		tag = "id"
+	}
+	if !Supported(tag) {
+		return ""
+	}
+	return tag
+}
+
+// Error is an error carrying a message key, so code that doesn't see the
+// request can still return a message that gets translated later.
+type Error struct {
+	Key    string
+	Params Params
+}
+
+func NewError(key string, params ...Params) *Error {
+	e := &Error{Key: key}
+	if len(params) > 0 {
+		e.Params = params[0]
+	}
+	return e
+}
+
+func (e *Error) Error() string {
+	return Translate(DefaultLocale, e.Key, e.Params)
+}
+
+// Message returns err's text in the request's locale when it wraps an
+// *Error, and err.Error() otherwise.
+func Message(c *fiber.Ctx, err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return Translate(Locale(c), e.Key, e.Params)
+	}
+	return err.Error()
+}
@@ -0,0 +1,168 @@
+package i18n
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", "en"},
+		{"id", "id"},
+		{"id-ID", "id"},
+		{"ID_id", "id"},
+		{"in-ID", "id"},
+		{"id-ID,id;q=0.9,en;q=0.8", "id"},
+		{"en-US,en;q=0.9,id;q=0.8", "en"},
+		{"fr-FR,id;q=0.5,en;q=0.4", "id"},
+		{"en;q=0.2, id;q=0.7", "id"},
+		{"fr-FR,de;q=0.9", "en"},
+		{"id;q=abc", "id"},
+		{"*", "en"},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.header); got != tt.want {
+			t.Errorf("Match(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	tests := []struct {
+		locale string
+		key    string
+		params Params
+		want   string
+	}{
+		{"en", "validation.min_length", Params{"field": "title", "min": 3}, "title must be at least 3 characters"},
+		{"id", "validation.min_length", Params{"field": "title", "min": 3}, "title minimal 3 karakter"},
+		{"en", "validation.password_uppercase", nil, "Password must contain at least one uppercase letter"},
+		{"id", "validation.password_uppercase", nil, "Kata sandi harus mengandung minimal satu huruf kapital"},
+		{"id", "error.not_found", nil, "Tidak ditemukan"},
+		// Unknown locales get English, unknown keys themselves.
+		{"fr", "error.not_found", nil, "Not found"},
+		{"id", "error.no_such_key", nil, "error.no_such_key"},
+		// Placeholders without a param are left for the reader to notice.
+		{"en", "validation.required", nil, "{field} is required"},
+	}
+	for _, tt := range tests {
+		if got := Translate(tt.locale, tt.key, tt.params); got != tt.want {
+			t.Errorf("Translate(%q, %q) = %q, want %q", tt.locale, tt.key, got, tt.want)
+		}
+	}
+}
+
+// TestCatalogsMatch keeps the bundled catalogs in step: every key has a
+// message in every locale, using the same placeholders.
+func TestCatalogsMatch(t *testing.T) {
+	placeholder := regexp.MustCompile(`\{[a-z_]+\}`)
+	placeholders := func(s string) []string {
+		found := placeholder.FindAllString(s, -1)
+		sort.Strings(found)
+		return found
+	}
+
+	if !Supported("en") || !Supported("id") {
+		t.Fatalf("bundled locales: %d catalogs, want en and id", len(catalogs))
+	}
+	for locale, messages := range catalogs {
+		for key, want := range catalogs[DefaultLocale] {
+			got, ok := messages[key]
+			if !ok {
+				t.Errorf("%s: %s is missing", locale, key)
+				continue
+			}
+			if got == "" {
+				t.Errorf("%s: %s is empty", locale, key)
+			}
+			if fmt.Sprint(placeholders(got)) != fmt.Sprint(placeholders(want)) {
+				t.Errorf("%s: %s uses %v, English uses %v", locale, key, placeholders(got), placeholders(want))
+			}
+		}
+		for key := range messages {
+			if _, ok := catalogs[DefaultLocale][key]; !ok {
+				t.Errorf("%s: %s has no English message", locale, key)
+			}
+		}
+	}
+}
+
+func TestLocale(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		acceptLanguage string
+		want           string
+	}{
+		{name: "default", want: "en"},
+		{name: "accept-language", acceptLanguage: "id-ID,id;q=0.9", want: "id"},
+		{name: "query overrides header", query: "?lang=en", acceptLanguage: "id-ID", want: "en"},
+		{name: "query alone", query: "?lang=id", want: "id"},
+		{name: "unsupported query falls back to the header", query: "?lang=fr", acceptLanguage: "id", want: "id"},
+		{name: "unsupported everywhere", query: "?lang=fr", acceptLanguage: "de-DE", want: "en"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Get("/", func(c *fiber.Ctx) error {
+				// The second call is answered from Locals.
+				return c.SendString(Locale(c) + " " + Locale(c) + " " + T(c, "error.not_found"))
+			})
+			req := httptest.NewRequest("GET", "/"+tt.query, nil)
+			if tt.acceptLanguage != "" {
+				req.Header.Set(fiber.HeaderAcceptLanguage, tt.acceptLanguage)
+			}
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := tt.want + " " + tt.want + " " + Translate(tt.want, "error.not_found", nil)
+			if string(body) != want {
+				t.Errorf("body %q, want %q", body, want)
+			}
+			if vary := resp.Header.Get(fiber.HeaderVary); vary != fiber.HeaderAcceptLanguage {
+				t.Errorf("Vary = %q, want Accept-Language", vary)
+			}
+		})
+	}
+}
+
+func TestErrorMessage(t *testing.T) {
+	err := fmt.Errorf("saving: %w", NewError("validation.min_length", Params{"field": "name", "min": 2}))
+	if got := err.Error(); got != "saving: name must be at least 2 characters" {
+		t.Errorf("Error() = %q", got)
+	}
+
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString(Message(c, err) + "|" + Message(c, errors.New("plain")))
+	})
+	resp, err := app.Test(httptest.NewRequest("GET", "/?lang=id", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(body); got != "name minimal 2 karakter|plain" {
+		t.Errorf("Message = %q", got)
+	}
+}
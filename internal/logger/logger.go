@@ -0,0 +1,56 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync/atomic"
+)
+
+type contextKey struct{}
+
+var base atomic.Pointer[slog.Logger]
+
+func init() {
+	base.Store(slog.Default())
+}
+
+// Init configures the process-wide logger: JSON in production, human
+// readable text everywhere else. It also becomes the slog default so stray
+// log.Printf calls end up in the same stream.
+func Init(environment string) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: slog.LevelInfo}
+
+	var handler slog.Handler
+	if environment == "production" {
+		handler = slog.NewJSONHandler(os.Stdout, opts)
+	} else {
+		opts.Level = slog.LevelDebug
+		handler = slog.NewTextHandler(os.Stdout, opts)
+	}
+
+	l := slog.New(handler).With("service", "lumina-ai-api")
+	base.Store(l)
+	slog.SetDefault(l)
+	return l
+}
+
+// L returns the process-wide logger.
+func L() *slog.Logger {
+	return base.Load()
+}
+
+// WithContext stores a (usually request or job scoped) logger in ctx.
+func WithContext(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the logger stored in ctx, falling back to L.
+func FromContext(ctx context.Context) *slog.Logger {
+	if ctx != nil {
+		if l, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+			return l
+		}
+	}
+	return L()
+}
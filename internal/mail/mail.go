@@ -0,0 +1,191 @@
+// Package mail sends plain-text email over SMTP. Without SMTP_HOST
+// messages are written to the log instead, bodies included outside
+// production so links can be followed in development.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/zesbe/lumina-ai/internal/config"
+	"github.com/zesbe/lumina-ai/internal/logger"
+)
+
+// sendTimeout bounds one delivery, connection to QUIT.
+const sendTimeout = 15 * time.Second
+
+// Message is one email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type sender struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     netmail.Address
+	// logBodies writes message bodies to the log when SMTP is off.
+	logBodies bool
+}
+
+var s *sender
+
+// Init configures delivery. Until it is called Send fails.
+func Init(cfg *config.Config) {
+	s = &sender{
+		host:      cfg.SMTPHost,
+		port:      cfg.SMTPPort,
+		username:  cfg.SMTPUsername,
+		password:  cfg.SMTPPassword,
+		from:      netmail.Address{Name: cfg.MailFromName, Address: cfg.MailFrom},
+		logBodies: cfg.Environment != "production",
+	}
+}
+
+// Send delivers msg, waiting for the server to accept it.
+func Send(ctx context.Context, msg Message) error {
+	if s == nil {
+		return errors.New("mail not initialized")
+	}
+	if s.host == "" {
+		attrs := []any{"to", msg.To, "subject", msg.Subject}
+		if s.logBodies {
+			attrs = append(attrs, "body", msg.Body)
+		}
+		logger.L().Info("SMTP not configured; email not sent", attrs...)
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+	return s.send(ctx, msg)
+}
+
+// SendRetrying is Send tried up to attempts times, waiting backoff after
+// the first failure and twice as long after each one after that. It gives
+// up early when ctx ends and returns the last error.
+func SendRetrying(ctx context.Context, msg Message, attempts int, backoff time.Duration) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = Send(ctx, msg); err == nil || attempt >= attempts {
+			return err
+		}
+		logger.L().Warn("email not sent; retrying", "attempt", attempt, "retry_in", backoff.String(), "error", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (s *sender) send(ctx context.Context, msg Message) error {
+	data, err := s.format(msg)
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(s.host, s.port)
+	tlsConfig := &tls.Config{ServerName: s.host}
+	var conn net.Conn
+	// Port 465 speaks TLS from the start; anything else is upgraded with
+	// STARTTLS when the server offers it.
+	if s.port == "465" {
+		conn, err = (&tls.Dialer{Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok && s.port != "465" {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if s.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.username, s.password, s.host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(s.from.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// format renders msg as a MIME message with a quoted-printable UTF-8
+// body.
+func (s *sender) format(msg Message) ([]byte, error) {
+	to, err := netmail.ParseAddress(msg.To)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient: %w", err)
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	domain := s.from.Address[strings.LastIndexByte(s.from.Address, '@')+1:]
+
+	var b bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&b, "%s: %s\r\n", name, value)
+	}
+	header("From", s.from.String())
+	header("To", to.String())
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", "<"+hex.EncodeToString(id)+"@"+domain+">")
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	b.WriteString("\r\n")
+
+	qp := quotedprintable.NewWriter(&b)
+	if _, err := qp.Write([]byte(strings.ReplaceAll(msg.Body, "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,94 @@
+package maintenance
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/zesbe/lumina-ai/internal/cache"
+	"github.com/zesbe/lumina-ai/internal/logger"
+)
+
+const (
+	redisKey = "maintenance"
+	// refreshInterval bounds how long an instance keeps serving a stale
+	// state after the switch is flipped elsewhere.
+	refreshInterval = 5 * time.Second
+)
+
+// State is the maintenance switch. It lives in Redis so every instance
+// sees the same value; without Redis it only applies to this process.
+type State struct {
+	Enabled   bool       `json:"enabled"`
+	Message   string     `json:"message,omitempty"`
+	ETA       *time.Time `json:"eta,omitempty"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+}
+
+var (
+	mu        sync.RWMutex
+	current   State
+	checkedAt time.Time
+)
+
+// Current returns the maintenance state, re-reading Redis at most every
+// few seconds so the check is cheap enough to run on every request.
+func Current() State {
+	mu.RLock()
+	state, fresh := current, time.Since(checkedAt) < refreshInterval
+	mu.RUnlock()
+	if fresh || cache.Cache == nil {
+		return state
+	}
+
+	var stored State
+	err := cache.Cache.Get(redisKey, &stored)
+	switch {
+	case errors.Is(err, redis.Nil):
+		stored = State{}
+	case err != nil:
+		// Keep the last known state if Redis is briefly unavailable.
+		logger.L().Warn("failed to read maintenance state", "error", err)
+		stored = state
+	}
+
+	mu.Lock()
+	current, checkedAt = stored, time.Now()
+	mu.Unlock()
+	return stored
+}
+
+// Enabled is shorthand for Current().Enabled.
+func Enabled() bool {
+	return Current().Enabled
+}
+
+// Set stores a new state and applies it to this instance immediately.
+func Set(state State) error {
+	if state.Enabled && state.StartedAt == nil {
+		now := time.Now().UTC()
+		state.StartedAt = &now
+	}
+	if !state.Enabled {
+		state = State{}
+	}
+
+	if cache.Cache != nil {
+		var err error
+		if state.Enabled {
+			err = cache.Cache.Set(redisKey, state, 0)
+		} else {
+			err = cache.Cache.Delete(redisKey)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	mu.Lock()
+	current, checkedAt = state, time.Now()
+	mu.Unlock()
+	return nil
+}
@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/apikey"
+	"github.com/zesbe/lumina-ai/internal/i18n"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+// APIKeyAuth authenticates requests whose Authorization header carries an
+// API key (Bearer lum_...) and leaves every other request to JWTAuth,
+// which must come after it. GET and HEAD need the read scope, everything
+// else the generate scope. Each key is limited to limit requests per
+// window of its own.
+func APIKeyAuth(limit int, window time.Duration) fiber.Handler {
+	limiter := keyedRateLimiter(limit, window, func(c *fiber.Ctx) string {
+		return fmt.Sprintf("key:%d", c.Locals("apiKeyID").(uint))
+	})
+
+	return func(c *fiber.Ctx) error {
+		key := bearerToken(c)
+		if !apikey.IsKey(key) {
+			return c.Next()
+		}
+
+		principal, err := apikey.Authenticate(c.UserContext(), key)
+		switch {
+		case errors.Is(err, apikey.ErrExpired):
+			return apierror.Respond(c, apierror.New(fiber.StatusUnauthorized, apierror.CodeTokenExpired, i18n.T(c, "error.api_key_expired")))
+		case errors.Is(err, apikey.ErrInvalid):
+			return apierror.Respond(c, apierror.New(fiber.StatusUnauthorized, apierror.CodeInvalidToken, i18n.T(c, "error.invalid_api_key")))
+		case err != nil:
+			Log(c).Error("failed to look up api key", "error", err)
+			return apierror.Respond(c, apierror.New(fiber.StatusServiceUnavailable, apierror.CodeServiceUnavailable, i18n.T(c, "error.auth_unavailable")))
+		}
+
+		// A downgraded account keeps its keys but can't use them.
+		if !slices.Contains(apikey.Plans, principal.Plan) {
+			return apierror.Respond(c, apierror.New(fiber.StatusForbidden, apierror.CodePlanUpgradeRequired, i18n.T(c, "error.plan_upgrade_required")))
+		}
+
+		scope := models.ScopeGenerate
+		if c.Method() == fiber.MethodGet || c.Method() == fiber.MethodHead {
+			scope = models.ScopeRead
+		}
+		if !principal.Allows(scope) {
+			return apierror.Respond(c, apierror.New(fiber.StatusForbidden, apierror.CodeInsufficientScope,
+				i18n.T(c, "error.api_key_scope", i18n.Params{"scope": scope})).With("scope", scope))
+		}
+
+		c.Locals("userID", principal.UserID)
+		c.Locals("email", principal.Email)
+		c.Locals("role", principal.Role)
+		c.Locals("plan", principal.Plan)
+		c.Locals("apiKeyID", principal.KeyID)
+		c.Locals("apiKeyScopes", principal.Scopes)
+		c.Locals("authSource", AuthSourceAPIKey)
+
+		return limiter(c)
+	}
+}
+
+// DenyAPIKey guards account and admin routes, which need a login: a
+// leaked key must not be able to change the password, mint more keys or
+// act as an admin.
+func DenyAPIKey() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if source, _ := c.Locals("authSource").(string); source == AuthSourceAPIKey {
+			return apierror.Respond(c, apierror.New(fiber.StatusForbidden, apierror.CodeAPIKeyForbidden, i18n.T(c, "error.api_key_forbidden")))
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import "github.com/gofiber/fiber/v2"
+
+// BaseURL exposes the public base URL of the API via c.Locals("baseURL"),
+// for making the relative media URLs in responses absolute. It is
+// configured, or, when that is empty, taken from the request: its scheme
+// and host, or X-Forwarded-Proto and X-Forwarded-Host behind a proxy.
+func BaseURL(configured string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		base := configured
+		if base == "" {
+			base = c.Protocol() + "://" + c.Hostname()
+		}
+		c.Locals("baseURL", base)
+		return c.Next()
+	}
+}
+
+// GetBaseURL returns the base URL stored by the BaseURL middleware, or ""
+// outside it, which leaves media URLs relative.
+func GetBaseURL(c *fiber.Ctx) string {
+	if base, ok := c.Locals("baseURL").(string); ok {
+		return base
+	}
+	return ""
+}
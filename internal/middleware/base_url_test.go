@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestBaseURL(t *testing.T) {
+	tests := []struct {
+		name       string
+		configured string
+		url        string
+		headers    map[string]string
+		want       string
+	}{
+		{name: "configured", configured: "https://api.example.com", url: "http://internal:8080/base", want: "https://api.example.com"},
+		{name: "from the request", url: "http://localhost:8080/base", want: "http://localhost:8080"},
+		{name: "behind a proxy", url: "http://10.0.0.5:8080/base",
+			headers: map[string]string{fiber.HeaderXForwardedProto: "https", fiber.HeaderXForwardedHost: "api.example.com"},
+			want:    "https://api.example.com"},
+		{name: "proxy forwarding the scheme only", url: "http://api.example.com/base",
+			headers: map[string]string{fiber.HeaderXForwardedProto: "https"},
+			want:    "https://api.example.com"},
+		{name: "configured wins over the proxy", configured: "https://api.example.com", url: "http://10.0.0.5:8080/base",
+			headers: map[string]string{fiber.HeaderXForwardedProto: "http", fiber.HeaderXForwardedHost: "evil.example.net"},
+			want:    "https://api.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Use(BaseURL(tt.configured))
+			app.Get("/base", func(c *fiber.Ctx) error { return c.SendString(GetBaseURL(c)) })
+
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if got := string(body); got != tt.want {
+				t.Errorf("base URL %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetBaseURLOutsideMiddleware(t *testing.T) {
+	app := fiber.New()
+	app.Get("/base", func(c *fiber.Ctx) error { return c.SendString("[" + GetBaseURL(c) + "]") })
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/base", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if body, _ := io.ReadAll(resp.Body); string(body) != "[]" {
+		t.Errorf("base URL %s, want none", body)
+	}
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"io"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/i18n"
+)
+
+// BodyLimit rejects request bodies larger than limit bytes with 413. The
+// declared Content-Length is checked first so oversized requests are
+// refused before their body is read; streamed (chunked) bodies are read
+// through a counting reader that stops at the limit. The app must run with
+// StreamRequestBody enabled for the early rejection to avoid buffering.
+func BodyLimit(limit int) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if cl := c.Request().Header.ContentLength(); cl > limit {
+			return bodyTooLarge(c, limit)
+		}
+
+		if stream := c.Request().BodyStream(); stream != nil {
+			body, err := io.ReadAll(io.LimitReader(stream, int64(limit)+1))
+			if err != nil {
+				return apierror.Respond(c, apierror.New(fiber.StatusBadRequest, apierror.CodeBadRequest, i18n.T(c, "error.read_body_failed")))
+			}
+			if len(body) > limit {
+				return bodyTooLarge(c, limit)
+			}
+			c.Request().SetBody(body)
+		} else if len(c.Body()) > limit {
+			return bodyTooLarge(c, limit)
+		}
+
+		return c.Next()
+	}
+}
+
+func bodyTooLarge(c *fiber.Ctx, limit int) error {
+	c.Set(fiber.HeaderConnection, "close")
+	return apierror.Respond(c, apierror.New(fiber.StatusRequestEntityTooLarge, apierror.CodePayloadTooLarge, i18n.T(c, "error.body_too_large")).With("limit", limit))
+}
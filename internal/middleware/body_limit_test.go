@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const testBodyLimit = 1 << 20
+
+// bodyLimitApp serves POST /login behind BodyLimit, recording whether the
+// handler got to parse the body.
+func bodyLimitApp(parsed *bool) *fiber.App {
+	app := fiber.New(fiber.Config{BodyLimit: 50 << 20, StreamRequestBody: true})
+	app.Post("/login", BodyLimit(testBodyLimit), func(c *fiber.Ctx) error {
+		*parsed = true
+		var body map[string]interface{}
+		if err := c.BodyParser(&body); err != nil {
+			return err
+		}
+		return c.JSON(fiber.Map{"bytes": len(c.Body())})
+	})
+	return app
+}
+
+// loginBody is a JSON login body of about size bytes.
+func loginBody(size int) []byte {
+	b, _ := json.Marshal(map[string]string{
+		"email":    "someone@example.com",
+		"password": strings.Repeat("x", size),
+	})
+	return b
+}
+
+func TestBodyLimitRejectsDeclaredLength(t *testing.T) {
+	var parsed bool
+	app := bodyLimitApp(&parsed)
+
+	req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(loginBody(2<<20)))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != fiber.StatusRequestEntityTooLarge {
+		t.Fatalf("status %d, want 413", resp.StatusCode)
+	}
+	if parsed {
+		t.Fatal("the handler parsed a body over the limit")
+	}
+	if !resp.Close {
+		t.Error("the connection is kept open after refusing the body")
+	}
+	var body struct {
+		Code  string `json:"code"`
+		Limit int    `json:"limit"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Code != "PAYLOAD_TOO_LARGE" {
+		t.Errorf("code = %q, want PAYLOAD_TOO_LARGE", body.Code)
+	}
+}
+
+func TestBodyLimitRejectsStreamedBody(t *testing.T) {
+	var parsed bool
+	app := bodyLimitApp(&parsed)
+
+	// A reader of unknown length is sent chunked, without Content-Length.
+	body := io.MultiReader(bytes.NewReader(loginBody(2 << 20)))
+	req := httptest.NewRequest(http.MethodPost, "/login", body)
+	req.ContentLength, req.TransferEncoding = -1, []string{"chunked"}
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != fiber.StatusRequestEntityTooLarge {
+		t.Fatalf("status %d, want 413", resp.StatusCode)
+	}
+	if parsed {
+		t.Fatal("the handler parsed a body over the limit")
+	}
+}
+
+func TestBodyLimitPassesBodiesWithinLimit(t *testing.T) {
+	for _, chunked := range []bool{false, true} {
+		var parsed bool
+		app := bodyLimitApp(&parsed)
+
+		payload := loginBody(testBodyLimit - 100)
+		var body io.Reader = bytes.NewReader(payload)
+		if chunked {
+			body = io.MultiReader(body)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/login", body)
+		if chunked {
+			req.ContentLength, req.TransferEncoding = -1, []string{"chunked"}
+		}
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got struct {
+			Bytes int `json:"bytes"`
+		}
+		json.NewDecoder(resp.Body).Decode(&got)
+		resp.Body.Close()
+
+		if resp.StatusCode != fiber.StatusOK || !parsed {
+			t.Fatalf("chunked=%v: status %d, parsed %v; want the body through", chunked, resp.StatusCode, parsed)
+		}
+		if got.Bytes != len(payload) {
+			t.Errorf("chunked=%v: handler saw %d bytes, want %d", chunked, got.Bytes, len(payload))
+		}
+	}
+}
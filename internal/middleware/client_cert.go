@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/i18n"
+)
+
+// ClientCert exposes the subject of the verified client certificate as
+// c.Locals("clientCertSubject"). With a non-empty allowlist, clients whose
+// common name or full subject isn't listed are refused. The TLS handshake
+// has already checked the certificate against the CA; this only narrows
+// which of those clients may call the API.
+func ClientCert(allowed []string) fiber.Handler {
+	allow := make(map[string]bool, len(allowed))
+	for _, subject := range allowed {
+		allow[subject] = true
+	}
+
+	return func(c *fiber.Ctx) error {
+		var cn, subject string
+		if state := c.Context().TLSConnectionState(); state != nil && len(state.PeerCertificates) > 0 {
+			cert := state.PeerCertificates[0]
+			cn, subject = cert.Subject.CommonName, cert.Subject.String()
+			c.Locals("clientCertSubject", subject)
+		}
+
+		if len(allow) > 0 && !allow[cn] && !allow[subject] {
+			return apierror.Respond(c, apierror.New(fiber.StatusForbidden, apierror.CodeForbidden, i18n.T(c, "error.client_cert_not_allowed")))
+		}
+		return c.Next()
+	}
+}
+
+// ClientCertSubject returns the subject stored by ClientCert, or "" for
+// connections without a client certificate.
+func ClientCertSubject(c *fiber.Ctx) string {
+	subject, _ := c.Locals("clientCertSubject").(string)
+	return subject
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// Compress compresses responses with brotli or gzip, whichever the client
+// prefers, at the default (balanced) level; it is what Fiber's compress
+// middleware does, plus a size floor. Bodies under minSize bytes are sent
+// as they are: the savings don't pay for the CPU. Paths under skipPrefixes,
+// WebSocket upgrades, event streams and streamed bodies are never touched,
+// since compression would break ranged requests and per-event flushing.
+//
+// Compression runs after the handler, so anything that hashes the body
+// (an ETag) sees it uncompressed and must be a weak validator.
+func Compress(minSize int, skipPrefixes ...string) fiber.Handler {
+	compressor := fasthttp.CompressHandlerBrotliLevel(func(*fasthttp.RequestCtx) {},
+		fasthttp.CompressBrotliDefaultCompression,
+		fasthttp.CompressDefaultCompression,
+	)
+
+	return func(c *fiber.Ctx) error {
+		if isLongLived(c) || hasPrefix(c.Path(), skipPrefixes) {
+			return c.Next()
+		}
+
+		if err := c.Next(); err != nil {
+			return err
+		}
+
+		resp := c.Response()
+		if resp.IsBodyStream() || len(resp.Body()) < minSize {
+			return nil
+		}
+		if strings.HasPrefix(string(resp.Header.ContentType()), "text/event-stream") {
+			return nil
+		}
+		compressor(c.Context())
+		return nil
+	}
+}
+
+func hasPrefix(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+
+	"github.com/zesbe/lumina-ai/internal/logger"
+)
+
+// CORS builds the CORS middleware from the comma-separated ALLOWED_ORIGINS
+// list. A wildcard keeps the API open but without credentials; an explicit
+// list enables credentialed requests and only reflects matching origins.
+func CORS(allowedOrigins, environment string) fiber.Handler {
+	origins := ParseOrigins(allowedOrigins)
+	wildcard := len(origins) == 0 || (len(origins) == 1 && origins[0] == "*")
+
+	if wildcard && environment == "production" {
+		logger.L().Warn("ALLOWED_ORIGINS is \"*\" in production; any site can call the API and credentialed CORS requests are disabled")
+	}
+
+	cfg := cors.Config{
+		AllowMethods: "GET,POST,PUT,DELETE,PATCH,OPTIONS",
+		AllowHeaders: "Origin,Content-Type,Accept,Accept-Version,Authorization,X-Request-ID,X-CSRF-Token,X-Strict,Upgrade,Connection",
+		MaxAge:       86400,
+	}
+	if wildcard {
+		cfg.AllowOrigins = "*"
+	} else {
+		cfg.AllowOrigins = strings.Join(origins, ",")
+		cfg.AllowCredentials = true
+	}
+
+	return cors.New(cfg)
+}
+
+// ParseOrigins splits a comma-separated origin list, trimming whitespace
+// and trailing slashes so "https://app.example.com/" matches the Origin
+// header browsers send. "*" anywhere in the list means any origin.
+func ParseOrigins(value string) []string {
+	var origins []string
+	for _, origin := range strings.Split(value, ",") {
+		origin = strings.TrimRight(strings.TrimSpace(origin), "/")
+		if origin == "" {
+			continue
+		}
+		if origin == "*" {
+			return []string{"*"}
+		}
+		origins = append(origins, strings.ToLower(origin))
+	}
+	return origins
+}
@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestParseOrigins(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{"", nil},
+		{"*", []string{"*"}},
+		{"https://app.example.com", []string{"https://app.example.com"}},
+		{" https://App.Example.com/ , http://localhost:3000,,", []string{"https://app.example.com", "http://localhost:3000"}},
+		{"https://app.example.com,*", []string{"*"}},
+	}
+	for _, tt := range tests {
+		if got := ParseOrigins(tt.value); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseOrigins(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	tests := []struct {
+		name            string
+		allowed         string
+		origin          string
+		wantOrigin      string
+		wantCredentials bool
+	}{
+		{name: "listed origin", allowed: "https://app.example.com,http://localhost:3000", origin: "https://app.example.com",
+			wantOrigin: "https://app.example.com", wantCredentials: true},
+		{name: "second listed origin", allowed: "https://app.example.com,http://localhost:3000", origin: "http://localhost:3000",
+			wantOrigin: "http://localhost:3000", wantCredentials: true},
+		{name: "listed with a trailing slash", allowed: "https://app.example.com/", origin: "https://app.example.com",
+			wantOrigin: "https://app.example.com", wantCredentials: true},
+		{name: "unlisted origin", allowed: "https://app.example.com", origin: "https://evil.example.com"},
+		{name: "lookalike origin", allowed: "https://app.example.com", origin: "https://app.example.com.evil.net"},
+		{name: "wildcard", allowed: "*", origin: "https://anywhere.example.org", wantOrigin: "*"},
+		{name: "unset", allowed: "", origin: "https://anywhere.example.org", wantOrigin: "*"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Use(CORS(tt.allowed, "development"))
+			app.Post("/api/v1/generate", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+
+			req := httptest.NewRequest(http.MethodOptions, "/api/v1/generate", nil)
+			req.Header.Set(fiber.HeaderOrigin, tt.origin)
+			req.Header.Set(fiber.HeaderAccessControlRequestMethod, http.MethodPost)
+			req.Header.Set(fiber.HeaderAccessControlRequestHeaders, "Authorization,Content-Type,X-CSRF-Token")
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != fiber.StatusNoContent {
+				t.Fatalf("status %d, want 204", resp.StatusCode)
+			}
+			if got := resp.Header.Get(fiber.HeaderAccessControlAllowOrigin); got != tt.wantOrigin {
+				t.Errorf("Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			credentials := resp.Header.Get(fiber.HeaderAccessControlAllowCredentials) == "true"
+			if credentials != tt.wantCredentials {
+				t.Errorf("Allow-Credentials = %v, want %v", credentials, tt.wantCredentials)
+			}
+			if tt.wantOrigin == "" {
+				return
+			}
+			if got := resp.Header.Get(fiber.HeaderAccessControlAllowMethods); got != "GET,POST,PUT,DELETE,PATCH,OPTIONS" {
+				t.Errorf("Allow-Methods = %q", got)
+			}
+			if got := resp.Header.Get(fiber.HeaderAccessControlMaxAge); got != "86400" {
+				t.Errorf("Max-Age = %q, want 86400", got)
+			}
+		})
+	}
+}
+
+func TestCORSSimpleRequest(t *testing.T) {
+	app := fiber.New()
+	app.Use(CORS("https://app.example.com", "production"))
+	app.Get("/api/v1/me", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+
+	for origin, want := range map[string]string{
+		"https://app.example.com":  "https://app.example.com",
+		"https://evil.example.com": "",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/me", nil)
+		req.Header.Set(fiber.HeaderOrigin, origin)
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if got := resp.Header.Get(fiber.HeaderAccessControlAllowOrigin); got != want {
+			t.Errorf("Origin %s: Allow-Origin = %q, want %q", origin, got, want)
+		}
+	}
+}
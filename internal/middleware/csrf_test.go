@@ -0,0 +1,140 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// expiredToken is a correctly signed token that expired a minute ago.
+func expiredToken(tokens *CSRFTokens) string {
+	payload := "bm9uY2U." + strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+	return payload + "." + tokens.sign(payload)
+}
+
+func TestCSRFTokensVerify(t *testing.T) {
+	tokens := NewCSRFTokens("csrf-test-secret")
+	valid, expiresAt, err := tokens.Issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Until(expiresAt); d < CSRFTokenTTL-time.Minute || d > CSRFTokenTTL {
+		t.Errorf("token expires in %v, want about %v", d, CSRFTokenTTL)
+	}
+
+	parts := strings.Split(valid, ".")
+	later := strconv.FormatInt(time.Now().Add(48*time.Hour).Unix(), 10)
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"valid", valid, nil},
+		{"expired", expiredToken(tokens), ErrCSRFExpired},
+		{"extended expiry", parts[0] + "." + later + "." + parts[2], ErrCSRFInvalid},
+		{"tampered signature", parts[0] + "." + parts[1] + "." + strings.Repeat("A", len(parts[2])), ErrCSRFInvalid},
+		{"other secret", expiredToken(NewCSRFTokens("other-secret")), ErrCSRFInvalid},
+		{"malformed", "not-a-token", ErrCSRFInvalid},
+		{"empty", "", ErrCSRFInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tokens.Verify(tt.token); !errors.Is(err, tt.want) {
+				t.Errorf("Verify = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSRFMiddleware(t *testing.T) {
+	tokens := NewCSRFTokens("csrf-test-secret")
+	valid, _, err := tokens.Issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _, err := tokens.Issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired := expiredToken(tokens)
+
+	app := fiber.New()
+	// Stands in for JWTAuth and APIKeyAuth, which record how the request
+	// was authenticated.
+	app.Use(func(c *fiber.Ctx) error {
+		if source := c.Get("X-Test-Auth-Source"); source != "" {
+			c.Locals("authSource", source)
+		}
+		return c.Next()
+	})
+	app.Use(CSRF(tokens))
+	app.All("/resource", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusNoContent) })
+
+	tests := []struct {
+		name   string
+		method string
+		source string
+		header string
+		cookie string
+		// want is the status, and wantMessage the message of a refusal.
+		want        int
+		wantMessage string
+	}{
+		{name: "cookie session with matching token", method: http.MethodPost, source: AuthSourceCookie, header: valid, cookie: valid, want: 204},
+		{name: "cookie session without token", method: http.MethodPost, source: AuthSourceCookie, want: 403, wantMessage: "missing CSRF token"},
+		{name: "header without cookie", method: http.MethodPut, source: AuthSourceCookie, header: valid, want: 403, wantMessage: "missing CSRF token"},
+		{name: "cookie without header", method: http.MethodDelete, source: AuthSourceCookie, cookie: valid, want: 403, wantMessage: "missing CSRF token"},
+		{name: "mismatched tokens", method: http.MethodPatch, source: AuthSourceCookie, header: valid, cookie: other, want: 403, wantMessage: "CSRF token mismatch"},
+		{name: "expired token", method: http.MethodPost, source: AuthSourceCookie, header: expired, cookie: expired, want: 403, wantMessage: "CSRF token has expired"},
+		{name: "forged token", method: http.MethodPost, source: AuthSourceCookie, header: "a.1.b", cookie: "a.1.b", want: 403, wantMessage: "invalid CSRF token"},
+		{name: "safe method on cookie session", method: http.MethodGet, source: AuthSourceCookie, want: 204},
+		{name: "head on cookie session", method: http.MethodHead, source: AuthSourceCookie, want: 204},
+		{name: "bearer only", method: http.MethodPost, source: "header", want: 204},
+		{name: "bearer with a stale cookie", method: http.MethodPost, source: "header", cookie: expired, want: 204},
+		{name: "api key", method: http.MethodDelete, source: AuthSourceAPIKey, want: 204},
+		{name: "unauthenticated", method: http.MethodPost, want: 204},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/resource", nil)
+			if tt.source != "" {
+				req.Header.Set("X-Test-Auth-Source", tt.source)
+			}
+			if tt.header != "" {
+				req.Header.Set(CSRFHeader, tt.header)
+			}
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: CSRFCookieName, Value: tt.cookie})
+			}
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.want {
+				t.Fatalf("status %d, want %d", resp.StatusCode, tt.want)
+			}
+			if tt.wantMessage == "" {
+				return
+			}
+			var body struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Code != "CSRF_FAILED" || body.Message != tt.wantMessage {
+				t.Errorf("body %+v, want CSRF_FAILED %q", body, tt.wantMessage)
+			}
+		})
+	}
+}
@@ -1,67 +1,160 @@
 package middleware
 
 import (
+	"errors"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/audit"
 	"github.com/zesbe/lumina-ai/internal/auth"
+	"github.com/zesbe/lumina-ai/internal/i18n"
+	"github.com/zesbe/lumina-ai/internal/logger"
+	"github.com/zesbe/lumina-ai/internal/models"
+	"github.com/zesbe/lumina-ai/internal/session"
+	"github.com/zesbe/lumina-ai/internal/userstate"
+)
+
+const (
+	AccessTokenCookie = "access_token"
+
+	AuthSourceHeader = "header"
+	AuthSourceCookie = "cookie"
+	AuthSourceQuery  = "query"
+	AuthSourceAPIKey = "api_key"
 )
 
-func JWTAuth(secret string) fiber.Handler {
-	jwtService := auth.NewJWTService(secret, 0, 0)
+// denylistWarnedAt throttles the warning logged while the denylist can't
+// be checked, to one a minute instead of one per request.
+var denylistWarnedAt atomic.Int64
+
+// JWTAuth authenticates the request's access token. Tokens of a session
+// that was logged out are refused; when Redis can't say whether the
+// session was, failClosed decides between refusing the request (503) and
+// letting it through. The role and plan in the token are replaced with
+// the user's current ones, and tokens of deactivated accounts, or issued
+// before the password was last changed, are refused. This catches tokens
+// of a revoked session even without Redis. Requests APIKeyAuth already
+// authenticated pass.
+func JWTAuth(keys *auth.Keys, failClosed bool) fiber.Handler {
+	jwtService := auth.NewJWTService(keys, 0, 0)
 
 	return func(c *fiber.Ctx) error {
-		var tokenString string
+		if source, _ := c.Locals("authSource").(string); source == AuthSourceAPIKey {
+			return c.Next()
+		}
+
+		var source string
 
 		// Check Authorization header first
-		authHeader := c.Get("Authorization")
-		if authHeader != "" {
-			parts := strings.Split(authHeader, " ")
-			if len(parts) == 2 && strings.ToLower(parts[0]) == "bearer" {
-				tokenString = parts[1]
+		tokenString := bearerToken(c)
+		if tokenString != "" {
+			source = AuthSourceHeader
+		}
+
+		// Browser sessions carry the token in a cookie (CSRF-checked)
+		if tokenString == "" {
+			if tokenString = c.Cookies(AccessTokenCookie); tokenString != "" {
+				source = AuthSourceCookie
 			}
 		}
 
 		// Fallback to query param for WebSocket
 		if tokenString == "" {
 			tokenString = c.Query("token")
+			source = AuthSourceQuery
 		}
 
 		if tokenString == "" {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error":   "Unauthorized",
-				"message": "Missing authorization",
-			})
+			return apierror.Respond(c, apierror.New(fiber.StatusUnauthorized, apierror.CodeUnauthorized, i18n.T(c, "error.missing_authorization")))
 		}
 
 		claims, err := jwtService.ValidateToken(tokenString)
 		if err != nil {
 			if err == auth.ErrExpiredToken {
-				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-					"error":   "Unauthorized",
-					"message": "Token has expired",
-					"code":    "TOKEN_EXPIRED",
-				})
+				return apierror.Respond(c, apierror.New(fiber.StatusUnauthorized, apierror.CodeTokenExpired, i18n.T(c, "error.token_expired")))
 			}
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error":   "Unauthorized",
-				"message": "Invalid token",
-			})
+			return apierror.Respond(c, apierror.New(fiber.StatusUnauthorized, apierror.CodeInvalidToken, i18n.T(c, "error.invalid_token")))
 		}
 
 		if claims.TokenType != auth.AccessToken {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error":   "Unauthorized",
-				"message": "Invalid token type",
-			})
+			return apierror.Respond(c, apierror.New(fiber.StatusUnauthorized, apierror.CodeInvalidToken, i18n.T(c, "error.invalid_token_type")))
+		}
+
+		revoked, err := session.Denied(c.UserContext(), claims.SessionID)
+		switch {
+		case err != nil && failClosed:
+			Log(c).Error("token denylist unavailable; refusing request", "error", err)
+			return apierror.Respond(c, apierror.New(fiber.StatusServiceUnavailable, apierror.CodeServiceUnavailable, i18n.T(c, "error.auth_unavailable")))
+		case err != nil:
+			if now := time.Now().Unix(); denylistWarnedAt.Load() < now-60 {
+				denylistWarnedAt.Store(now)
+				logger.L().Warn("token denylist unavailable; accepting tokens unchecked", "error", err)
+			}
+		case revoked:
+			return apierror.Respond(c, apierror.New(fiber.StatusUnauthorized, apierror.CodeInvalidToken, i18n.T(c, "error.session_revoked")))
+		}
+
+		state, err := userstate.Get(c.UserContext(), claims.UserID)
+		switch {
+		case errors.Is(err, userstate.ErrNotFound):
+			return apierror.Respond(c, apierror.New(fiber.StatusUnauthorized, apierror.CodeInvalidToken, i18n.T(c, "error.invalid_token")))
+		case err != nil:
+			Log(c).Error("failed to look up user state", "error", err)
+			return apierror.Respond(c, apierror.New(fiber.StatusServiceUnavailable, apierror.CodeServiceUnavailable, i18n.T(c, "error.auth_unavailable")))
+		case !state.Active:
+			return apierror.Respond(c, apierror.New(fiber.StatusForbidden, apierror.CodeForbidden, i18n.T(c, "error.account_disabled")))
+		case claims.IssuedAt == nil || !state.Accepts(claims.IssuedAt.Time):
+			return apierror.Respond(c, apierror.New(fiber.StatusUnauthorized, apierror.CodeInvalidToken, i18n.T(c, "error.session_revoked")))
 		}
 
 		c.Locals("userID", claims.UserID)
 		c.Locals("email", claims.Email)
-		c.Locals("role", claims.Role)
-		c.Locals("plan", claims.Plan)
+		c.Locals("role", state.Role)
+		c.Locals("plan", state.Plan)
 		c.Locals("claims", claims)
+		c.Locals("authSource", source)
+
+		// Everything done under an impersonation token is attributed to the
+		// admin behind it.
+		if claims.IsImpersonation() {
+			c.Locals("impersonatorID", *claims.ImpersonatorID)
+			audit.RecordAs(c, claims.ImpersonatorID, models.AuditImpersonatedRequest, audit.User(claims.UserID), fiber.Map{
+				"method": c.Method(),
+				"path":   c.Path(),
+			})
+		}
+
+		return c.Next()
+	}
+}
+
+// bearerToken is the token of a Bearer Authorization header.
+func bearerToken(c *fiber.Ctx) string {
+	parts := strings.Split(c.Get("Authorization"), " ")
+	if len(parts) == 2 && strings.ToLower(parts[0]) == "bearer" {
+		return parts[1]
+	}
+	return ""
+}
 
+// ImpersonatorID returns the admin behind an impersonation token, if the
+// request is using one.
+func ImpersonatorID(c *fiber.Ctx) (uint, bool) {
+	id, ok := c.Locals("impersonatorID").(uint)
+	return id, ok
+}
+
+// DenyImpersonation guards actions an admin must not take on a user's
+// behalf, such as changing their password or billing.
+func DenyImpersonation() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if _, ok := ImpersonatorID(c); ok {
+			return apierror.Respond(c, apierror.New(fiber.StatusForbidden, apierror.CodeImpersonationForbidden, i18n.T(c, "error.impersonation_forbidden")))
+		}
 		return c.Next()
 	}
 }
@@ -74,10 +167,7 @@ func RequireRole(roles ...string) fiber.Handler {
 				return c.Next()
 			}
 		}
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"error":   "Forbidden",
-			"message": "Insufficient permissions",
-		})
+		return apierror.Respond(c, apierror.New(fiber.StatusForbidden, apierror.CodeForbidden, i18n.T(c, "error.insufficient_permissions")))
 	}
 }
 
@@ -89,9 +179,6 @@ func RequirePlan(plans ...string) fiber.Handler {
 				return c.Next()
 			}
 		}
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"error":   "Forbidden",
-			"message": "Plan upgrade required",
-		})
+		return apierror.Respond(c, apierror.New(fiber.StatusForbidden, apierror.CodePlanUpgradeRequired, i18n.T(c, "error.plan_upgrade_required")))
 	}
 }
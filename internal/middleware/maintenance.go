@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/i18n"
+	"github.com/zesbe/lumina-ai/internal/maintenance"
+	"github.com/zesbe/lumina-ai/internal/settings"
+)
+
+// maintenanceExempt are the paths that keep working during maintenance so
+// the load balancer can probe, other services can still verify tokens and
+// admins can sign in and turn it off.
+// Login itself refuses non-admins while maintenance is on.
+var maintenanceExempt = []string{
+	"/health",
+	"/health/deep",
+	"/health/live",
+	"/health/ready",
+	"/.well-known/jwks.json",
+	"/api/v1/auth/login",
+	"/api/v1/auth/refresh",
+	"/api/v1/auth/csrf-token",
+	"/api/v1/admin/",
+}
+
+// Maintenance answers 503 for everything but the exempt paths while the
+// maintenance switch is on.
+func Maintenance() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		state := maintenance.Current()
+		if !state.Enabled || isMaintenanceExempt(c.Path()) {
+			return c.Next()
+		}
+		return MaintenanceResponse(c, state)
+	}
+}
+
+// MaintenanceResponse writes the 503 body, with Retry-After when an ETA is
+// known.
+func MaintenanceResponse(c *fiber.Ctx, state maintenance.State) error {
+	message := state.Message
+	if message == "" {
+		message = settings.Current().MaintenanceMessage
+	}
+	if message == "" {
+		message = i18n.T(c, "error.maintenance")
+	}
+
+	e := apierror.New(fiber.StatusServiceUnavailable, apierror.CodeMaintenance, message)
+	if state.ETA != nil {
+		e.With("eta", state.ETA)
+		if wait := time.Until(*state.ETA); wait > 0 {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(wait.Seconds())+1))
+		}
+	}
+
+	return apierror.Respond(c, e)
+}
+
+func isMaintenanceExempt(path string) bool {
+	path = strings.TrimRight(path, "/")
+	for _, exempt := range maintenanceExempt {
+		if path == strings.TrimRight(exempt, "/") || (strings.HasSuffix(exempt, "/") && strings.HasPrefix(path, exempt)) {
+			return true
+		}
+	}
+	return false
+}
@@ -6,13 +6,19 @@ import (
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/i18n"
 )
 
+// rateLimitCleanup is how often expired client windows are dropped.
+const rateLimitCleanup = time.Minute
+
 type rateLimiter struct {
 	requests map[string]*clientInfo
 	mu       sync.RWMutex
-	limit    int
-	window   time.Duration
+	// limits is read on every request so the limit can change at runtime.
+	limits func() (int, time.Duration)
 }
 
 type clientInfo struct {
@@ -20,15 +26,14 @@ type clientInfo struct {
 	lastReset time.Time
 }
 
-func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+func newRateLimiter(limits func() (int, time.Duration)) *rateLimiter {
 	rl := &rateLimiter{
 		requests: make(map[string]*clientInfo),
-		limit:    limit,
-		window:   window,
+		limits:   limits,
 	}
 
 	go func() {
-		ticker := time.NewTicker(window)
+		ticker := time.NewTicker(rateLimitCleanup)
 		defer ticker.Stop()
 		for range ticker.C {
 			rl.cleanup()
@@ -39,18 +44,19 @@ func newRateLimiter(limit int, window time.Duration) *rateLimiter {
 }
 
 func (rl *rateLimiter) cleanup() {
+	_, window := rl.limits()
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
 
 	now := time.Now()
 	for key, info := range rl.requests {
-		if now.Sub(info.lastReset) > rl.window {
+		if now.Sub(info.lastReset) > window {
 			delete(rl.requests, key)
 		}
 	}
 }
 
-func (rl *rateLimiter) isAllowed(clientID string) (bool, int, time.Time) {
+func (rl *rateLimiter) isAllowed(clientID string, limit int, window time.Duration) (bool, int, time.Time) {
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
 
@@ -62,37 +68,37 @@ func (rl *rateLimiter) isAllowed(clientID string) (bool, int, time.Time) {
 			count:     1,
 			lastReset: now,
 		}
-		return true, rl.limit - 1, now.Add(rl.window)
+		return true, limit - 1, now.Add(window)
 	}
 
-	if now.Sub(info.lastReset) > rl.window {
+	if now.Sub(info.lastReset) > window {
 		info.count = 1
 		info.lastReset = now
-		return true, rl.limit - 1, now.Add(rl.window)
+		return true, limit - 1, now.Add(window)
 	}
 
-	if info.count >= rl.limit {
-		resetTime := info.lastReset.Add(rl.window)
+	if info.count >= limit {
+		resetTime := info.lastReset.Add(window)
 		return false, 0, resetTime
 	}
 
 	info.count++
-	remaining := rl.limit - info.count
-	resetTime := info.lastReset.Add(rl.window)
+	remaining := limit - info.count
+	resetTime := info.lastReset.Add(window)
 
 	return true, remaining, resetTime
 }
 
-func RateLimiter(limit int, window time.Duration) fiber.Handler {
-	limiter := newRateLimiter(limit, window)
+// RateLimiter limits each user (or IP before login) to the current value
+// of limits per window. limits is called per request, so a changed limit
+// applies to the next request; counts already taken are kept.
+func RateLimiter(limits func() (int, time.Duration)) fiber.Handler {
+	limiter := newRateLimiter(limits)
 
 	return func(c *fiber.Ctx) error {
-		clientID := c.IP()
-		if userID := c.Locals("userID"); userID != nil {
-			clientID = fmt.Sprintf("user:%d", userID.(uint))
-		}
-
-		allowed, remaining, resetTime := limiter.isAllowed(clientID)
+		clientID := rateLimitKey(c)
+		limit, window := limits()
+		allowed, remaining, resetTime := limiter.isAllowed(clientID, limit, window)
 
 		c.Set("X-RateLimit-Limit", fmt.Sprintf("%d", limit))
 		c.Set("X-RateLimit-Remaining", fmt.Sprintf("%d", remaining))
@@ -102,24 +108,27 @@ func RateLimiter(limit int, window time.Duration) fiber.Handler {
 			retryAfter := int(time.Until(resetTime).Seconds())
 			c.Set("Retry-After", fmt.Sprintf("%d", retryAfter))
 
-			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
-				"error":       "Too Many Requests",
-				"message":     "Rate limit exceeded. Please try again later.",
-				"retry_after": retryAfter,
-			})
+			return apierror.Respond(c, apierror.New(fiber.StatusTooManyRequests, apierror.CodeRateLimited, i18n.T(c, "error.rate_limited")).With("retry_after", retryAfter))
 		}
 
 		return c.Next()
 	}
 }
 
+// StrictRateLimiter is a fixed limit of its own on top of the global one,
+// counted per user behind JWTAuth and per IP on public routes.
 func StrictRateLimiter(limit int, window time.Duration) fiber.Handler {
-	limiter := newRateLimiter(limit, window)
+	return keyedRateLimiter(limit, window, rateLimitKey)
+}
+
+// keyedRateLimiter is a fixed limit counted per value of key.
+func keyedRateLimiter(limit int, window time.Duration, key func(c *fiber.Ctx) string) fiber.Handler {
+	limiter := newRateLimiter(func() (int, time.Duration) { return limit, window })
 
 	return func(c *fiber.Ctx) error {
-		clientID := c.IP()
+		clientID := key(c)
 
-		allowed, remaining, resetTime := limiter.isAllowed(clientID)
+		allowed, remaining, resetTime := limiter.isAllowed(clientID, limit, window)
 
 		c.Set("X-RateLimit-Limit", fmt.Sprintf("%d", limit))
 		c.Set("X-RateLimit-Remaining", fmt.Sprintf("%d", remaining))
@@ -129,13 +138,17 @@ func StrictRateLimiter(limit int, window time.Duration) fiber.Handler {
 			retryAfter := int(time.Until(resetTime).Seconds())
 			c.Set("Retry-After", fmt.Sprintf("%d", retryAfter))
 
-			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
-				"error":       "Too Many Requests",
-				"message":     "Rate limit exceeded. Please try again later.",
-				"retry_after": retryAfter,
-			})
+			return apierror.Respond(c, apierror.New(fiber.StatusTooManyRequests, apierror.CodeRateLimited, i18n.T(c, "error.rate_limited")).With("retry_after", retryAfter))
 		}
 
 		return c.Next()
 	}
 }
+
+// rateLimitKey is the logged-in user, or the IP before login.
+func rateLimitKey(c *fiber.Ctx) string {
+	if userID, ok := c.Locals("userID").(uint); ok {
+		return fmt.Sprintf("user:%d", userID)
+	}
+	return c.IP()
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// RequestID accepts an incoming X-Request-ID or generates a new one, and
+// exposes it via c.Locals("requestID"), the user context and the response
+// header so handlers, background jobs and clients can share it.
+func RequestID() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.New().String()
+		}
+
+		c.Locals("requestID", id)
+		c.SetUserContext(WithRequestID(c.UserContext(), id))
+		c.Set(RequestIDHeader, id)
+
+		return c.Next()
+	}
+}
+
+// GetRequestID returns the request ID stored by the RequestID middleware.
+func GetRequestID(c *fiber.Ctx) string {
+	if id, ok := c.Locals("requestID").(string); ok {
+		return id
+	}
+	return ""
+}
+
+// WithRequestID attaches a request ID to ctx, e.g. for background jobs that
+// outlive the request.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID carried by ctx, if any.
+func RequestIDFromContext(ctx context.Context) string {
+	if id, ok := ctx.Value(requestIDKey{}).(string); ok {
+		return id
+	}
+	return ""
+}
+
+// validRequestID rejects client supplied IDs that are empty, too long or
+// contain characters that could break log lines.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, r := range id {
+		if r < 0x21 || r > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/zesbe/lumina-ai/internal/logger"
+	"github.com/zesbe/lumina-ai/internal/tracing"
+)
+
+// RequestLogger emits one structured access log line per request and
+// stores a request-scoped logger (carrying the request and trace IDs) in the
+// user context for handlers to use via Log. It must run after RequestID and
+// Tracing.
+func RequestLogger() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+
+		l := logger.L().With("request_id", GetRequestID(c))
+		if traceID := tracing.TraceID(c.UserContext()); traceID != "" {
+			l = l.With("trace_id", traceID)
+		}
+		c.SetUserContext(logger.WithContext(c.UserContext(), l))
+
+		chainErr := c.Next()
+		if chainErr != nil {
+			// Let the error handler write the response so the logged status
+			// matches what the client receives.
+			if err := c.App().ErrorHandler(c, chainErr); err != nil {
+				_ = c.SendStatus(fiber.StatusInternalServerError)
+			}
+		}
+
+		status := c.Response().StatusCode()
+		attrs := []any{
+			"method", c.Method(),
+			"path", c.Path(),
+			"status", status,
+			"latency_ms", time.Since(start).Milliseconds(),
+			"ip", c.IP(),
+		}
+		if userID, ok := c.Locals("userID").(uint); ok {
+			attrs = append(attrs, "user_id", userID)
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+		l.Log(c.UserContext(), level, "request", attrs...)
+
+		return nil
+	}
+}
+
+// Log returns the request-scoped logger, including the user ID once the
+// request has been authenticated.
+func Log(c *fiber.Ctx) *slog.Logger {
+	l := logger.FromContext(c.UserContext())
+	if userID, ok := c.Locals("userID").(uint); ok {
+		l = l.With("user_id", userID)
+	}
+	return l
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/i18n"
+)
+
+// Timeout puts a deadline on the request's user context. Handlers pass
+// c.UserContext() to db.WithContext and the provider client, so the
+// underlying work is cancelled when the deadline passes; the middleware
+// then replaces whatever the handler produced with a 504. WebSocket
+// upgrades and event streams are long-lived by design and are skipped.
+func Timeout(d time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if d <= 0 || isLongLived(c) {
+			return c.Next()
+		}
+
+		ctx, cancel := context.WithTimeout(c.UserContext(), d)
+		defer cancel()
+		c.SetUserContext(ctx)
+
+		err := c.Next()
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			Log(c).Warn("request timed out", "timeout_ms", d.Milliseconds())
+			return apierror.Respond(c, apierror.New(fiber.StatusGatewayTimeout, apierror.CodeTimeout, i18n.T(c, "error.timeout")).With("timeout_ms", d.Milliseconds()))
+		}
+		return err
+	}
+}
+
+func isLongLived(c *fiber.Ctx) bool {
+	if strings.EqualFold(c.Get(fiber.HeaderUpgrade), "websocket") {
+		return true
+	}
+	return strings.Contains(c.Get(fiber.HeaderAccept), "text/event-stream")
+}
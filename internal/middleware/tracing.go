@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/zesbe/lumina-ai/internal/tracing"
+)
+
+// Tracing starts a server span per request, continuing any incoming W3C
+// traceparent, and makes it the parent of everything done via
+// c.UserContext().
+func Tracing() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		carrier := propagation.MapCarrier{}
+		c.Request().Header.VisitAll(func(key, value []byte) {
+			carrier.Set(string(key), string(value))
+		})
+		ctx := otel.GetTextMapPropagator().Extract(c.UserContext(), carrier)
+
+		ctx, span := tracing.Tracer().Start(ctx, c.Method()+" "+c.Path(),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", c.Method()),
+				attribute.String("url.path", c.Path()),
+				attribute.String("client.address", c.IP()),
+				attribute.String("request.id", GetRequestID(c)),
+			),
+		)
+		defer span.End()
+
+		c.SetUserContext(ctx)
+
+		err := c.Next()
+
+		// Route is only known after matching.
+		if route := c.Route(); route != nil && route.Path != "" {
+			span.SetName(c.Method() + " " + route.Path)
+			span.SetAttributes(attribute.String("http.route", route.Path))
+		}
+		status := c.Response().StatusCode()
+		if err != nil {
+			if e, ok := err.(*fiber.Error); ok {
+				status = e.Code
+			}
+			tracing.RecordError(span, err)
+		}
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if status >= fiber.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+		if userID, ok := c.Locals("userID").(uint); ok {
+			span.SetAttributes(attribute.Int64("user.id", int64(userID)))
+		}
+
+		return err
+	}
+}
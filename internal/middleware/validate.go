@@ -0,0 +1,272 @@
+package middleware
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/zesbe/lumina-ai/internal/i18n"
+)
+
+// Validate checks a request struct against its `validate` tags and returns
+// the collected errors in the same shape as Validator.Errors.
+//
+// Rules are comma separated and applied in order, e.g.
+// `validate:"required,min=10,max=2000,noxss"`. Supported rules: required,
+// email, min, max, password, alphanum, nosqli, noxss, safehtml and oneof
+// (values separated by spaces). Integer fields take required, min and max,
+// and slices only required. Errors are reported under the field's json name.
+//
+// A tag that doesn't parse, such as a misspelled rule, a bound that isn't
+// a number or a rule the field's type doesn't support, panics the first
+// time a struct of its type is validated, rather than leaving the field
+// unchecked.
+func Validate(s interface{}) []ValidationError {
+	v := NewValidator()
+	v.Struct(s)
+	return v.Errors()
+}
+
+// ValidateRequest is Validate with messages in the request's locale.
+func ValidateRequest(c *fiber.Ctx, s interface{}) []ValidationError {
+	v := NewLocalizedValidator(i18n.Locale(c))
+	v.Struct(s)
+	return v.Errors()
+}
+
+// Struct runs the tag rules of s on this validator so dynamic checks can be
+// added to the same error list.
+func (v *Validator) Struct(s interface{}) *Validator {
+	rv := reflect.ValueOf(s)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return v
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return v
+	}
+	v.structValue(rv)
+	return v
+}
+
+func (v *Validator) structValue(rv reflect.Value) {
+	for _, f := range structRules(rv.Type()) {
+		fv := rv.Field(f.index)
+		// Embedded structs carry their own tags.
+		if f.embedded {
+			v.structValue(fv)
+			continue
+		}
+		for _, r := range f.rules {
+			v.applyRule(f.name, r, fv)
+		}
+	}
+}
+
+// rule is one parsed entry of a validate tag.
+type rule struct {
+	name string
+	// bound is the argument of min and max.
+	bound int64
+	// options are the values oneof allows.
+	options []string
+}
+
+// fieldRules are the rules of one tagged field, or an embedded struct to
+// descend into.
+type fieldRules struct {
+	index    int
+	name     string
+	embedded bool
+	rules    []rule
+}
+
+// parsedRules caches structRules by type, so tags are parsed once.
+var parsedRules sync.Map
+
+// structRules parses the validate tags of struct type rt, panicking on one
+// that doesn't parse; see Validate.
+func structRules(rt reflect.Type) []fieldRules {
+	if cached, ok := parsedRules.Load(rt); ok {
+		return cached.([]fieldRules)
+	}
+
+	var fields []fieldRules
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			fields = append(fields, fieldRules{index: i, embedded: true})
+			continue
+		}
+
+		tag := sf.Tag.Get("validate")
+		if tag == "" || tag == "-" || !sf.IsExported() {
+			continue
+		}
+		rules, err := parseRules(tag, sf.Type.Kind())
+		if err != nil {
+			panic(fmt.Sprintf("validate: %s.%s: %v", rt.Name(), sf.Name, err))
+		}
+		fields = append(fields, fieldRules{index: i, name: fieldName(sf), rules: rules})
+	}
+
+	parsedRules.Store(rt, fields)
+	return fields
+}
+
+// stringRules, intRules and sliceRules are the rules each kind of field
+// supports, and whether the rule takes a value.
+var (
+	stringRules = map[string]bool{
+		"required": false, "email": false, "min": true, "max": true, "password": false,
+		"alphanum": false, "nosqli": false, "noxss": false, "safehtml": false, "oneof": true,
+	}
+	intRules   = map[string]bool{"required": false, "min": true, "max": true}
+	sliceRules = map[string]bool{"required": false}
+)
+
+// parseRules parses a validate tag for a field of the given kind.
+func parseRules(tag string, kind reflect.Kind) ([]rule, error) {
+	var supported map[string]bool
+	switch kind {
+	case reflect.String:
+		supported = stringRules
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		supported = intRules
+	case reflect.Slice:
+		supported = sliceRules
+	default:
+		return nil, fmt.Errorf("%s fields can't be validated by tag", kind)
+	}
+
+	var rules []rule
+	for _, raw := range strings.Split(tag, ",") {
+		raw = strings.TrimSpace(raw)
+		name, arg, hasArg := strings.Cut(raw, "=")
+		takesArg, known := supported[name]
+		_, forStrings := stringRules[name]
+		switch {
+		case !known && forStrings:
+			return nil, fmt.Errorf("rule %q doesn't apply to %s fields", name, kind)
+		case !known:
+			return nil, fmt.Errorf("unknown rule %q", raw)
+		case takesArg && !hasArg:
+			return nil, fmt.Errorf("rule %q needs a value", name)
+		case !takesArg && hasArg:
+			return nil, fmt.Errorf("rule %q takes no value", name)
+		}
+
+		r := rule{name: name}
+		switch name {
+		case "min", "max":
+			n, err := strconv.ParseInt(arg, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: %q isn't a number", name, arg)
+			}
+			r.bound = n
+		case "oneof":
+			r.options = strings.Fields(arg)
+			if len(r.options) == 0 {
+				return nil, fmt.Errorf("rule %q lists no values", name)
+			}
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+func (v *Validator) applyRule(field string, r rule, fv reflect.Value) {
+	switch fv.Kind() {
+	case reflect.String:
+	case reflect.Slice:
+		if r.name == "required" && fv.Len() == 0 {
+			v.AddRuleError(field, "required", nil)
+		}
+		return
+	default:
+		v.applyNumericRule(field, r, fv)
+		return
+	}
+
+	value := fv.String()
+	switch r.name {
+	case "required":
+		v.Required(field, value)
+	case "email":
+		v.Email(field, value)
+	case "min":
+		v.MinLength(field, value, int(r.bound))
+	case "max":
+		v.MaxLength(field, value, int(r.bound))
+	case "password":
+		v.Password(field, value)
+	case "alphanum":
+		v.AlphaNumeric(field, value)
+	case "nosqli":
+		v.NoSQLInjection(field, value)
+	case "noxss":
+		v.NoXSS(field, value)
+	case "safehtml":
+		v.SafeHTML(field, value)
+	case "oneof":
+		v.OneOf(field, value, r.options)
+	}
+}
+
+func (v *Validator) applyNumericRule(field string, r rule, fv reflect.Value) {
+	var n int64
+	switch fv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = fv.Int()
+	default:
+		n = int64(fv.Uint())
+	}
+
+	switch r.name {
+	case "required":
+		if n == 0 {
+			v.AddRuleError(field, "required", nil)
+		}
+	case "min":
+		if n != 0 && n < r.bound {
+			v.AddRuleError(field, "min_value", i18n.Params{"min": r.bound})
+		}
+	case "max":
+		if n > r.bound {
+			v.AddRuleError(field, "max_value", i18n.Params{"max": r.bound})
+		}
+	}
+}
+
+// OneOf checks that a non-empty value is one of the allowed options.
+func (v *Validator) OneOf(field, value string, options []string) *Validator {
+	if value == "" {
+		return v
+	}
+	for _, option := range options {
+		if value == option {
+			return v
+		}
+	}
+	v.AddRuleError(field, "one_of", i18n.Params{"options": strings.Join(options, ", ")})
+	return v
+}
+
+func fieldName(sf reflect.StructField) string {
+	for _, key := range []string{"json", "query", "form"} {
+		if tag := sf.Tag.Get(key); tag != "" {
+			name, _, _ := strings.Cut(tag, ",")
+			if name != "" && name != "-" {
+				return name
+			}
+		}
+	}
+	return sf.Name
+}
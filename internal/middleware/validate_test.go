@@ -0,0 +1,287 @@
+package middleware
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		tag     string
+		kind    reflect.Kind
+		want    []rule
+		wantErr string
+	}{
+		{tag: "required", kind: reflect.String, want: []rule{{name: "required"}}},
+		{tag: "required, min=10 ,max=2000,noxss", kind: reflect.String, want: []rule{
+			{name: "required"}, {name: "min", bound: 10}, {name: "max", bound: 2000}, {name: "noxss"},
+		}},
+		{tag: "oneof=music video", kind: reflect.String, want: []rule{{name: "oneof", options: []string{"music", "video"}}}},
+		{tag: "email,nosqli,password,alphanum,safehtml", kind: reflect.String, want: []rule{
+			{name: "email"}, {name: "nosqli"}, {name: "password"}, {name: "alphanum"}, {name: "safehtml"},
+		}},
+		{tag: "required,min=1,max=100", kind: reflect.Int, want: []rule{{name: "required"}, {name: "min", bound: 1}, {name: "max", bound: 100}}},
+		{tag: "min=-5", kind: reflect.Int64, want: []rule{{name: "min", bound: -5}}},
+		{tag: "max=320000", kind: reflect.Uint, want: []rule{{name: "max", bound: 320000}}},
+		{tag: "required", kind: reflect.Slice, want: []rule{{name: "required"}}},
+
+		{tag: "requried", kind: reflect.String, wantErr: `unknown rule "requried"`},
+		{tag: "required,mni=3", kind: reflect.String, wantErr: `unknown rule "mni=3"`},
+		{tag: "required,", kind: reflect.String, wantErr: `unknown rule ""`},
+		{tag: "min", kind: reflect.String, wantErr: `rule "min" needs a value`},
+		{tag: "max=", kind: reflect.String, wantErr: `rule "max": "" isn't a number`},
+		{tag: "min=ten", kind: reflect.Int, wantErr: `rule "min": "ten" isn't a number`},
+		{tag: "required=true", kind: reflect.String, wantErr: `rule "required" takes no value`},
+		{tag: "oneof=", kind: reflect.String, wantErr: `rule "oneof" lists no values`},
+		{tag: "oneof", kind: reflect.String, wantErr: `rule "oneof" needs a value`},
+		{tag: "email", kind: reflect.Int, wantErr: `rule "email" doesn't apply to int fields`},
+		{tag: "noxss", kind: reflect.Slice, wantErr: `rule "noxss" doesn't apply to slice fields`},
+		{tag: "max=3", kind: reflect.Slice, wantErr: `rule "max" doesn't apply to slice fields`},
+		{tag: "required", kind: reflect.Bool, wantErr: "bool fields can't be validated by tag"},
+		{tag: "required", kind: reflect.Ptr, wantErr: "ptr fields can't be validated by tag"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.kind.String()+"/"+tt.tag, func(t *testing.T) {
+			got, err := parseRules(tt.tag, tt.kind)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("parseRules(%q) error = %v, want %q", tt.tag, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseRules(%q): %v", tt.tag, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseRules(%q) = %+v, want %+v", tt.tag, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStructPanicsOnBadTag(t *testing.T) {
+	type misspelled struct {
+		Email string `json:"email" validate:"requried"`
+	}
+	defer func() {
+		r := recover()
+		msg, _ := r.(string)
+		if !strings.Contains(msg, `misspelled.Email: unknown rule "requried"`) {
+			t.Fatalf("recovered %v, want a panic naming the field and rule", r)
+		}
+	}()
+	Validate(misspelled{Email: "a@example.com"})
+	t.Fatal("Validate didn't panic")
+}
+
+type embeddedRequest struct {
+	Name string `json:"name" validate:"required"`
+}
+
+type sampleRequest struct {
+	embeddedRequest
+	Email    string   `json:"email" validate:"required,email"`
+	Title    string   `json:"title" validate:"min=3,max=5"`
+	Kind     string   `json:"kind" validate:"oneof=music video"`
+	Password string   `json:"password" validate:"password"`
+	Page     int      `query:"page" validate:"min=1"`
+	Limit    int      `query:"limit" validate:"required,max=100"`
+	Bitrate  uint     `json:"bitrate" validate:"max=320000"`
+	IDs      []uint   `json:"ids" validate:"required"`
+	NoTag    string   `json:"no_tag"`
+	Skipped  string   `json:"skipped" validate:"-"`
+	Unnamed  string   `validate:"required"`
+	Dash     string   `json:"-" form:"dash_form" validate:"required"`
+	Ignored  []string `json:"ignored"`
+	private  string   `validate:"required"`
+}
+
+func validSample() sampleRequest {
+	return sampleRequest{
+		embeddedRequest: embeddedRequest{Name: "Ana"},
+		Email:           "ana@example.com",
+		Title:           "ábcd",
+		Kind:            "video",
+		Password:        "Str0ng!pass",
+		Page:            2,
+		Limit:           100,
+		Bitrate:         320000,
+		IDs:             []uint{1},
+		Unnamed:         "x",
+		Dash:            "x",
+	}
+}
+
+func TestValidateStruct(t *testing.T) {
+	type failure struct{ field, code string }
+	tests := []struct {
+		name   string
+		change func(*sampleRequest)
+		want   []failure
+	}{
+		{name: "valid", change: func(*sampleRequest) {}},
+		{name: "embedded required", change: func(r *sampleRequest) { r.Name = "  " },
+			want: []failure{{"name", "required"}}},
+		{name: "required and email run in order", change: func(r *sampleRequest) { r.Email = "" },
+			want: []failure{{"email", "required"}}},
+		{name: "email", change: func(r *sampleRequest) { r.Email = "not-an-email" },
+			want: []failure{{"email", "email"}}},
+		{name: "min counts runes", change: func(r *sampleRequest) { r.Title = "éé" },
+			want: []failure{{"title", "min_length"}}},
+		{name: "max counts runes", change: func(r *sampleRequest) { r.Title = "éééééé" },
+			want: []failure{{"title", "max_length"}}},
+		{name: "empty optional string skips bounds", change: func(r *sampleRequest) { r.Title = "" }},
+		{name: "oneof", change: func(r *sampleRequest) { r.Kind = "podcast" },
+			want: []failure{{"kind", "one_of"}}},
+		{name: "empty oneof is allowed", change: func(r *sampleRequest) { r.Kind = "" }},
+		{name: "password reports every missing class", change: func(r *sampleRequest) { r.Password = "abc" },
+			want: []failure{{"password", "password_length"}, {"password", "password_uppercase"}, {"password", "password_number"}, {"password", "password_special"}}},
+		{name: "int min", change: func(r *sampleRequest) { r.Page = -1 },
+			want: []failure{{"page", "min_value"}}},
+		{name: "zero int skips min", change: func(r *sampleRequest) { r.Page = 0 }},
+		{name: "int required and max", change: func(r *sampleRequest) { r.Limit = 0 },
+			want: []failure{{"limit", "required"}}},
+		{name: "int max", change: func(r *sampleRequest) { r.Limit = 101 },
+			want: []failure{{"limit", "max_value"}}},
+		{name: "uint max", change: func(r *sampleRequest) { r.Bitrate = 320001 },
+			want: []failure{{"bitrate", "max_value"}}},
+		{name: "slice required", change: func(r *sampleRequest) { r.IDs = nil },
+			want: []failure{{"ids", "required"}}},
+		{name: "go name without a json name", change: func(r *sampleRequest) { r.Unnamed = "" },
+			want: []failure{{"Unnamed", "required"}}},
+		{name: "form name when json is -", change: func(r *sampleRequest) { r.Dash = "" },
+			want: []failure{{"dash_form", "required"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := validSample()
+			tt.change(&req)
+			var got []failure
+			for _, e := range Validate(&req) {
+				got = append(got, failure{e.Field, e.Code})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateErrorShape(t *testing.T) {
+	req := validSample()
+	req.Title = "ab"
+	req.Page = -3
+
+	errs := Validate(req)
+	want := []ValidationError{
+		{Field: "title", Code: "min_length", Message: "title must be at least 3 characters", Params: map[string]interface{}{"min": 3}},
+		{Field: "page", Code: "min_value", Message: "page must be at least 1", Params: map[string]interface{}{"min": int64(1)}},
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("Validate = %+v, want %+v", errs, want)
+	}
+	for i := range want {
+		if errs[i].Field != want[i].Field || errs[i].Code != want[i].Code || errs[i].Message != want[i].Message {
+			t.Errorf("error %d = %+v, want %+v", i, errs[i], want[i])
+		}
+		if !reflect.DeepEqual(errs[i].Params, want[i].Params) {
+			t.Errorf("error %d params = %#v, want %#v", i, errs[i].Params, want[i].Params)
+		}
+	}
+}
+
+func TestValidateNonStructs(t *testing.T) {
+	var nilReq *sampleRequest
+	for _, s := range []interface{}{nil, nilReq, "text", 42, &nilReq} {
+		if errs := Validate(s); len(errs) != 0 {
+			t.Errorf("Validate(%#v) = %v, want no errors", s, errs)
+		}
+	}
+}
+
+func TestStructAddsToDynamicChecks(t *testing.T) {
+	req := validSample()
+	req.Email = ""
+	v := NewValidator()
+	v.AddError("custom", "custom failure")
+	v.Struct(&req).MaxLength("extra", "toolong", 3)
+
+	var fields []string
+	for _, e := range v.Errors() {
+		fields = append(fields, e.Field+":"+e.Code)
+	}
+	want := []string{"custom:invalid", "email:required", "extra:max_length"}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("errors = %v, want %v", fields, want)
+	}
+}
+
+// TestRepoTagsParse parses every validate tag in the packages that
+// declare request structs, so a misspelled rule fails here rather than on
+// the first request that reaches it.
+func TestRepoTagsParse(t *testing.T) {
+	fset := token.NewFileSet()
+	var checked int
+	for _, dir := range []string{"../models", "../settings", "../handlers"} {
+		files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, path := range files {
+			if strings.HasSuffix(path, "_test.go") {
+				continue
+			}
+			file, err := parser.ParseFile(fset, path, nil, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ast.Inspect(file, func(n ast.Node) bool {
+				field, ok := n.(*ast.Field)
+				if !ok || field.Tag == nil {
+					return true
+				}
+				raw, err := strconv.Unquote(field.Tag.Value)
+				if err != nil {
+					t.Fatalf("%s: %v", fset.Position(field.Pos()), err)
+				}
+				tag, ok := reflect.StructTag(raw).Lookup("validate")
+				if !ok || tag == "-" {
+					return true
+				}
+				checked++
+				if _, err := parseRules(tag, tagKind(field.Type)); err != nil {
+					t.Errorf("%s: %v", fset.Position(field.Pos()), err)
+				}
+				return true
+			})
+		}
+	}
+	if checked == 0 {
+		t.Fatal("found no validate tags")
+	}
+}
+
+// tagKind guesses the kind of a field from its declared type: named types
+// other than the integer ones are taken to be strings, as every named type
+// in the request structs is.
+func tagKind(expr ast.Expr) reflect.Kind {
+	switch e := expr.(type) {
+	case *ast.ArrayType:
+		return reflect.Slice
+	case *ast.StarExpr:
+		return reflect.Ptr
+	case *ast.Ident:
+		for k := reflect.Bool; k <= reflect.UnsafePointer; k++ {
+			if k.String() == e.Name && k != reflect.String {
+				return k
+			}
+		}
+	}
+	return reflect.String
+}
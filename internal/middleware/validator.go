@@ -5,22 +5,51 @@ import (
 	"regexp"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/gofiber/fiber/v2"
+	"golang.org/x/net/html"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/i18n"
 )
 
+// ValidationError describes one failed rule. Code is stable across
+// locales ("required", "min_length", ...) and Params holds the values the
+// message was rendered with, so clients can translate it themselves.
 type ValidationError struct {
-	Field   string `json:"field"`
-	Message string `json:"message"`
+	Field   string      `json:"field"`
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Params  i18n.Params `json:"params,omitempty"`
+}
+
+// ValidationErrors is a failed validation returned as an error; the
+// error handler answers it with a 400 listing each failure.
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	fields := make([]string, len(e))
+	for i, v := range e {
+		fields[i] = v.Field
+	}
+	return "validation failed: " + strings.Join(fields, ", ")
 }
 
 type Validator struct {
 	errors []ValidationError
+	locale string
 }
 
 func NewValidator() *Validator {
+	return NewLocalizedValidator(i18n.DefaultLocale)
+}
+
+// NewLocalizedValidator renders messages in locale.
+func NewLocalizedValidator(locale string) *Validator {
 	return &Validator{
 		errors: make([]ValidationError, 0),
+		locale: locale,
 	}
 }
 
@@ -32,16 +61,33 @@ func (v *Validator) Errors() []ValidationError {
 	return v.errors
 }
 
+// AddError records a free-form message under the generic "invalid" code.
 func (v *Validator) AddError(field, message string) {
 	v.errors = append(v.errors, ValidationError{
 		Field:   field,
+		Code:    "invalid",
 		Message: message,
 	})
 }
 
+// AddRuleError records a failed rule, rendering the "validation.<code>"
+// message in the validator's locale.
+func (v *Validator) AddRuleError(field, code string, params i18n.Params) {
+	args := i18n.Params{"field": field}
+	for k, val := range params {
+		args[k] = val
+	}
+	v.errors = append(v.errors, ValidationError{
+		Field:   field,
+		Code:    code,
+		Message: i18n.Translate(v.locale, "validation."+code, args),
+		Params:  params,
+	})
+}
+
 func (v *Validator) Required(field, value string) *Validator {
 	if strings.TrimSpace(value) == "" {
-		v.AddError(field, field+" is required")
+		v.AddRuleError(field, "required", nil)
 	}
 	return v
 }
@@ -52,17 +98,18 @@ func (v *Validator) Email(field, value string) *Validator {
 	}
 	_, err := mail.ParseAddress(value)
 	if err != nil {
-		v.AddError(field, "Invalid email format")
+		v.AddRuleError(field, "email", nil)
 	}
 	return v
 }
 
+// MinLength and MaxLength count characters (runes), not bytes.
 func (v *Validator) MinLength(field, value string, min int) *Validator {
 	if value == "" {
 		return v
 	}
-	if len(value) < min {
-		v.AddError(field, field+" must be at least "+string(rune(min+'0'))+" characters")
+	if utf8.RuneCountInString(value) < min {
+		v.AddRuleError(field, "min_length", i18n.Params{"min": min})
 	}
 	return v
 }
@@ -71,8 +118,8 @@ func (v *Validator) MaxLength(field, value string, max int) *Validator {
 	if value == "" {
 		return v
 	}
-	if len(value) > max {
-		v.AddError(field, field+" must be at most "+string(rune(max+'0'))+" characters")
+	if utf8.RuneCountInString(value) > max {
+		v.AddRuleError(field, "max_length", i18n.Params{"max": max})
 	}
 	return v
 }
@@ -104,19 +151,19 @@ func (v *Validator) Password(field, value string) *Validator {
 	}
 
 	if !hasMinLen {
-		v.AddError(field, "Password must be at least 8 characters")
+		v.AddRuleError(field, "password_length", i18n.Params{"min": 8})
 	}
 	if !hasUpper {
-		v.AddError(field, "Password must contain at least one uppercase letter")
+		v.AddRuleError(field, "password_uppercase", nil)
 	}
 	if !hasLower {
-		v.AddError(field, "Password must contain at least one lowercase letter")
+		v.AddRuleError(field, "password_lowercase", nil)
 	}
 	if !hasNumber {
-		v.AddError(field, "Password must contain at least one number")
+		v.AddRuleError(field, "password_number", nil)
 	}
 	if !hasSpecial {
-		v.AddError(field, "Password must contain at least one special character")
+		v.AddRuleError(field, "password_special", nil)
 	}
 
 	return v
@@ -128,7 +175,7 @@ func (v *Validator) AlphaNumeric(field, value string) *Validator {
 	}
 	matched, _ := regexp.MatchString("^[a-zA-Z0-9]+$", value)
 	if !matched {
-		v.AddError(field, field+" must contain only letters and numbers")
+		v.AddRuleError(field, "alphanumeric", nil)
 	}
 	return v
 }
@@ -180,7 +227,7 @@ func (v *Validator) NoSQLInjection(field, value string) *Validator {
 	lowerValue := strings.ToLower(value)
 	for _, pattern := range dangerousPatterns {
 		if strings.Contains(lowerValue, pattern) {
-			v.AddError(field, "Invalid characters detected")
+			v.AddRuleError(field, "invalid_characters", nil)
 			return v
 		}
 	}
@@ -215,29 +262,75 @@ func (v *Validator) NoXSS(field, value string) *Validator {
 	lowerValue := strings.ToLower(value)
 	for _, pattern := range dangerousPatterns {
 		if strings.Contains(lowerValue, pattern) {
-			v.AddError(field, "Invalid content detected")
+			v.AddRuleError(field, "invalid_content", nil)
 			return v
 		}
 	}
 	return v
 }
 
+// dangerousTags are elements that run or load content no matter what
+// attributes they carry.
+var dangerousTags = map[string]bool{
+	"script": true, "iframe": true, "frame": true, "frameset": true,
+	"object": true, "embed": true, "applet": true, "base": true,
+	"link": true, "meta": true, "style": true, "form": true,
+}
+
+// SafeHTML is the policy for creative text (prompts, lyrics, narration)
+// that is never rendered as HTML. Instead of substring matching, which
+// rejected lines like "data: the new oil", the value is tokenized and only
+// real tags are inspected: executable elements, on* event handler
+// attributes and script URLs are rejected; anything else, including stray
+// angle brackets and harmless tags, is left to output escaping. Fields that
+// end up inside HTML attributes should keep using NoXSS.
+func (v *Validator) SafeHTML(field, value string) *Validator {
+	if value == "" || !strings.Contains(value, "<") {
+		return v
+	}
+
+	z := html.NewTokenizer(strings.NewReader(value))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return v
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if unsafeTag(z.Token()) {
+				v.AddRuleError(field, "unsafe_html", nil)
+				return v
+			}
+		}
+	}
+}
+
+func unsafeTag(tok html.Token) bool {
+	if dangerousTags[strings.ToLower(tok.Data)] {
+		return true
+	}
+	for _, attr := range tok.Attr {
+		if strings.HasPrefix(strings.ToLower(attr.Key), "on") {
+			return true
+		}
+		scheme := strings.ToLower(strings.TrimSpace(attr.Val))
+		for _, prefix := range []string{"javascript:", "vbscript:", "data:"} {
+			if strings.HasPrefix(scheme, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func ValidateBody(validateFunc func(c *fiber.Ctx, v *Validator) error) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		v := NewValidator()
+		v := NewLocalizedValidator(i18n.Locale(c))
 
 		if err := validateFunc(c, v); err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":   "Bad Request",
-				"message": err.Error(),
-			})
+			return apierror.Respond(c, apierror.New(fiber.StatusBadRequest, apierror.CodeBadRequest, i18n.Message(c, err)))
 		}
 
 		if v.HasErrors() {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":   "Validation Failed",
-				"details": v.Errors(),
-			})
+			return apierror.Respond(c, apierror.New(fiber.StatusBadRequest, apierror.CodeValidationFailed, i18n.T(c, "error.validation_failed")).WithDetails(v.Errors()))
 		}
 
 		return c.Next()
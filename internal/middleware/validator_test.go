@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"testing"
+
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+func TestSafeHTML(t *testing.T) {
+	tests := []struct {
+		value string
+		ok    bool
+	}{
+		// Lyrics and prompts users reported as "Invalid content detected".
+		{"data: the new oil", true},
+		{"Verse 1:\ndata: the new oil, we drill it every night", true},
+		{"<img of you> in my mind, a picture that won't fade", true},
+		{"<<chorus>> sing it louder <3", true},
+		{"the crowd screams onload= like a song on repeat", true},
+		{"Big city lights, onclick=love, offline heart", true},
+		{"a < b and c > d, the math of us", true},
+		{"javascript: the language of my heart", true},
+		{"[Intro] <b>bold</b> and <i>soft</i>", true},
+		{"<img src=\"sunset.png\" alt=\"sunset\">", true},
+		{"", true},
+
+		// Real markup that runs or loads something.
+		{"<script>alert(1)</script>", false},
+		{"la la <SCRIPT src=//evil.example></SCRIPT>", false},
+		{"<img src=x onerror=alert(1)>", false},
+		{"<img src=x OnError=\"alert(1)\">", false},
+		{"<svg/onload=alert(1)>", false},
+		{"<a href=\"javascript:alert(1)\">click</a>", false},
+		{"<a href=\"  JavaScript:alert(1)\">click</a>", false},
+		{"<iframe src=\"https://evil.example\"></iframe>", false},
+		{"<object data=\"x.swf\"></object>", false},
+		{"<embed src=x>", false},
+		{"<img src=\"data:image/svg+xml;base64,PHN2Zz4=\">", false},
+		{"<a href=vbscript:msgbox(1)>x</a>", false},
+		{"<meta http-equiv=refresh content=0>", false},
+		{"<style>body{}</style>", false},
+		{"<div onmouseover='x()'>hover</div>", false},
+	}
+	for _, tt := range tests {
+		v := NewValidator().SafeHTML("lyrics", tt.value)
+		if v.HasErrors() == tt.ok {
+			t.Errorf("SafeHTML(%q) rejected = %v, want %v", tt.value, v.HasErrors(), !tt.ok)
+			continue
+		}
+		if !tt.ok && v.Errors()[0].Code != "unsafe_html" {
+			t.Errorf("SafeHTML(%q) code = %q, want unsafe_html", tt.value, v.Errors()[0].Code)
+		}
+	}
+}
+
+// TestNoXSSStaysStrict checks that values ending up in HTML attributes
+// still refuse the substrings creative text is now allowed to contain.
+func TestNoXSSStaysStrict(t *testing.T) {
+	for _, value := range []string{
+		"data:text/html;base64,PHNjcmlwdD4=",
+		"javascript:alert(1)",
+		"https://cdn.example.com/a.png\" onload=\"x()",
+		"<img src=a.png>",
+	} {
+		if !NewValidator().NoXSS("avatar", value).HasErrors() {
+			t.Errorf("NoXSS(%q) passed", value)
+		}
+	}
+	if NewValidator().NoXSS("avatar", "https://cdn.example.com/avatars/1.png").HasErrors() {
+		t.Error("NoXSS rejected a plain URL")
+	}
+}
+
+func TestCreativeFieldsUseSafeHTML(t *testing.T) {
+	music := models.GenerateMusicRequest{
+		Format: "mp3",
+		Prompt: "lo-fi ballad about data: the new oil",
+		Lyrics: "<img of you> in my mind\nthe crowd screams onload= again",
+		Style:  "pop <3",
+	}
+	if errs := Validate(music); len(errs) != 0 {
+		t.Errorf("reported lyrics rejected: %+v", errs)
+	}
+
+	music.Lyrics = "<img src=x onerror=alert(1)> and more lyrics"
+	if errs := Validate(music); len(errs) != 1 || errs[0].Field != "lyrics" || errs[0].Code != "unsafe_html" {
+		t.Errorf("Validate = %+v, want lyrics unsafe_html", errs)
+	}
+
+	profile := models.UpdateProfileRequest{Name: "Ana", Avatar: "data:image/png;base64,AAAA"}
+	if errs := Validate(profile); len(errs) != 1 || errs[0].Field != "avatar" || errs[0].Code != "invalid_content" {
+		t.Errorf("Validate = %+v, want avatar invalid_content", errs)
+	}
+}
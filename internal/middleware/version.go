@@ -0,0 +1,19 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/zesbe/lumina-ai/internal/version"
+)
+
+// VersionHeader carries the running build's version on every response.
+const VersionHeader = "X-Lumina-Version"
+
+// Version tags every response with the build version, so a bug report
+// with headers says which deploy served it.
+func Version() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Set(VersionHeader, version.Version)
+		return c.Next()
+	}
+}
@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// What happens to a deleted account's public generations.
+const (
+	PublicContentDelete = "delete"
+	PublicContentKeep   = "keep"
+)
+
+// AccountDeletion is a user's request to erase their account. The account
+// is deactivated at once and erased once ScheduledFor passes, unless the
+// request is cancelled first. The row outlives the erasure with Email and
+// the token cleared, as a record that it happened.
+type AccountDeletion struct {
+	ID     uint `gorm:"primaryKey"`
+	UserID uint `gorm:"not null;uniqueIndex"`
+	// Email and Locale address the final confirmation; Email is cleared
+	// once it is sent.
+	Email  string `gorm:"size:255"`
+	Locale string `gorm:"size:10"`
+	// PublicContent is PublicContentDelete or PublicContentKeep.
+	PublicContent string `gorm:"not null;size:10"`
+	// CancelTokenHash is the SHA-256 hash of the token mailed for
+	// cancelling, cleared once erasure starts.
+	CancelTokenHash *string   `gorm:"size:64;uniqueIndex"`
+	ScheduledFor    time.Time `gorm:"not null;index"`
+	// StartedAt is set when erasure begins; from then on the request
+	// can't be cancelled and a crashed run is resumed.
+	StartedAt   *time.Time
+	CompletedAt *time.Time
+	CreatedAt   time.Time
+}
+
+type DeleteAccountRequest struct {
+	// Password is required unless the account has none, in which case
+	// the session must have just signed in.
+	Password string `json:"password"`
+	// Confirmation must be the word DELETE, typed by the user.
+	Confirmation  string `json:"confirmation" validate:"required,oneof=DELETE"`
+	PublicContent string `json:"public_content" validate:"oneof=delete keep"`
+}
+
+type CancelDeletionRequest struct {
+	Token string `json:"token" validate:"required"`
+}
@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+// API key scopes. A read key can only make GET requests; a generate key
+// can also start and manage generations.
+const (
+	ScopeRead     = "read"
+	ScopeGenerate = "generate"
+)
+
+var APIKeyScopes = []string{ScopeRead, ScopeGenerate}
+
+// APIKey lets a program call the API as its owner. Only a hash of the key
+// is stored; Prefix is its first characters, kept to look the key up and
+// to tell keys apart in lists.
+type APIKey struct {
+	ID         uint   `gorm:"primaryKey"`
+	UserID     uint   `gorm:"not null;index"`
+	Name       string `gorm:"not null;size:100"`
+	Prefix     string `gorm:"not null;size:16;uniqueIndex"`
+	SecretHash string `gorm:"not null;size:64"`
+	Scopes     string `gorm:"not null;size:100"`
+	LastUsedAt *time.Time
+	ExpiresAt  *time.Time
+	RevokedAt  *time.Time
+	CreatedAt  time.Time
+}
+
+type APIKeyResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (k *APIKey) ToResponse() APIKeyResponse {
+	return APIKeyResponse{
+		ID:         k.ID,
+		Name:       k.Name,
+		Prefix:     k.Prefix,
+		Scopes:     SplitList(k.Scopes),
+		LastUsedAt: k.LastUsedAt,
+		ExpiresAt:  k.ExpiresAt,
+		CreatedAt:  k.CreatedAt,
+	}
+}
+
+type CreateAPIKeyRequest struct {
+	Name string `json:"name" validate:"required,min=1,max=100,noxss"`
+	// Scopes defaults to read only.
+	Scopes []string `json:"scopes"`
+	// ExpiresInDays leaves the key without expiry when unset.
+	ExpiresInDays int `json:"expires_in_days" validate:"min=1,max=365"`
+}
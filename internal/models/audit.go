@@ -0,0 +1,73 @@
+package models
+
+import (
+	"time"
+)
+
+type AuditAction string
+
+const (
+	AuditLogin               AuditAction = "login"
+	AuditLoginFailed         AuditAction = "login_failed"
+	AuditAccountLocked       AuditAction = "account_locked"
+	AuditLockoutClear        AuditAction = "lockout_clear"
+	AuditPasswordChange      AuditAction = "password_change"
+	AuditRefreshTokenReuse   AuditAction = "refresh_token_reuse"
+	AuditLogoutAll           AuditAction = "logout_all"
+	AuditSessionRevoke       AuditAction = "session_revoke"
+	AuditAPIKeyCreate        AuditAction = "api_key_create"
+	AuditAPIKeyRevoke        AuditAction = "api_key_revoke"
+	AuditEmailChangeRequest  AuditAction = "email_change_request"
+	AuditEmailChange         AuditAction = "email_change"
+	AuditEmailChangeUndo     AuditAction = "email_change_undo"
+	AuditAccountDelete       AuditAction = "account_deletion_request"
+	AuditDeletionCancel      AuditAction = "account_deletion_cancel"
+	AuditDataExport          AuditAction = "data_export_request"
+	AuditMagicLinkRequest    AuditAction = "magic_link_request"
+	AuditNewDeviceLogin      AuditAction = "new_device_login"
+	AuditAccountSecured      AuditAction = "account_secured"
+	AuditEmailVerified       AuditAction = "email_verified"
+	AuditPlanChange          AuditAction = "plan_change"
+	AuditCreditGrant         AuditAction = "credit_grant"
+	AuditContentTakedown     AuditAction = "content_takedown"
+	AuditImpersonationStart  AuditAction = "impersonation_start"
+	AuditImpersonatedRequest AuditAction = "impersonated_request"
+	AuditModerationBlocked   AuditAction = "moderation_blocked"
+	AuditModerationRule      AuditAction = "moderation_rule_change"
+	AuditGenerationFail      AuditAction = "generation_force_fail"
+	AuditGenerationRetry     AuditAction = "generation_retry"
+	AuditFeatureFlagChange   AuditAction = "feature_flag_change"
+	AuditMaintenanceChange   AuditAction = "maintenance_change"
+	AuditLogView             AuditAction = "audit_log_view"
+	AuditTransactionExport   AuditAction = "transaction_export"
+	AuditPurge               AuditAction = "purge_run"
+	AuditRoleChange          AuditAction = "role_change"
+	AuditSettingsChange      AuditAction = "settings_change"
+	AuditReferralReward      AuditAction = "referral_reward"
+	AuditDisposableEmail     AuditAction = "disposable_email_blocked"
+	AuditDisposableDomain    AuditAction = "disposable_domain_change"
+	AuditCaptchaFailed       AuditAction = "captcha_failed"
+	AuditEmailConflict       AuditAction = "email_conflict"
+	AuditUnsubscribe         AuditAction = "email_unsubscribe"
+	AuditPublishBlocked      AuditAction = "publish_blocked"
+	AuditPublishHeld         AuditAction = "publish_held"
+	AuditContentApproved     AuditAction = "content_approved"
+	AuditStylePresetChange   AuditAction = "style_preset_change"
+	AuditVideoTemplateChange AuditAction = "video_template_change"
+)
+
+// AuditLog is an append-only record of a sensitive operation. Rows are never
+// updated or deleted through the API; only the retention job removes them.
+// The composite indexes back the admin filters, which always sort by
+// created_at.
+type AuditLog struct {
+	ID         uint        `gorm:"primaryKey" json:"id"`
+	ActorID    *uint       `gorm:"index:idx_audit_logs_actor_created,priority:1" json:"actor_id,omitempty"`
+	Action     AuditAction `gorm:"not null;size:50;index:idx_audit_logs_action_created,priority:1" json:"action"`
+	TargetType string      `gorm:"size:50;index:idx_audit_logs_target,priority:1" json:"target_type,omitempty"`
+	TargetID   string      `gorm:"size:100;index:idx_audit_logs_target,priority:2" json:"target_id,omitempty"`
+	IP         string      `gorm:"size:64" json:"ip"`
+	UserAgent  string      `gorm:"size:255" json:"user_agent"`
+	Metadata   string      `gorm:"type:jsonb" json:"metadata,omitempty"`
+	CreatedAt  time.Time   `gorm:"index;index:idx_audit_logs_actor_created,priority:2;index:idx_audit_logs_action_created,priority:2;index:idx_audit_logs_target,priority:3" json:"created_at"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// Data export states.
+const (
+	ExportPending    = "pending"
+	ExportProcessing = "processing"
+	ExportReady      = "ready"
+	ExportFailed     = "failed"
+)
+
+// DataExport is a user's request for a copy of their data. The bundle is
+// a zip file written to DATA_EXPORT_DIR as <id>.zip and can be downloaded
+// with a signed link until ExpiresAt.
+type DataExport struct {
+	ID           uint   `gorm:"primaryKey" json:"id"`
+	UserID       uint   `gorm:"not null;index:idx_data_exports_user_created,priority:1" json:"-"`
+	Status       string `gorm:"not null;size:20" json:"status"`
+	IncludeMedia bool   `json:"include_media"`
+	// Progress is a percentage, for display.
+	Progress    int        `json:"progress"`
+	SizeBytes   int64      `json:"size_bytes,omitempty"`
+	Locale      string     `gorm:"size:10" json:"-"`
+	ExpiresAt   *time.Time `gorm:"index" json:"expires_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	CreatedAt   time.Time  `gorm:"index:idx_data_exports_user_created,priority:2" json:"created_at"`
+}
+
+type DataExportRequest struct {
+	// IncludeMedia adds the audio and video files stored by us; media
+	// hosted elsewhere is listed by URL either way.
+	IncludeMedia bool `json:"include_media"`
+}
+
+// DataExportResponse is an export with its download link once it is
+// ready.
+type DataExportResponse struct {
+	DataExport
+	DownloadURL string `json:"download_url,omitempty"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// DisposableDomain is an admin's correction to the disposable-domain
+// lists: a blocked entry adds a domain they miss, and an unblocked one
+// lets through a domain they list by mistake. Entries cover subdomains.
+type DisposableDomain struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Domain    string    `gorm:"not null;size:253;uniqueIndex" json:"domain"`
+	Blocked   bool      `gorm:"not null" json:"blocked"`
+	CreatedBy *uint     `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type DisposableDomainRequest struct {
+	Domain string `json:"domain" validate:"required,max=253"`
+	// Blocked defaults to true; false allows a listed domain.
+	Blocked *bool `json:"blocked"`
+}
+
+// DisposableBlocks is how many sign-ups with throwaway addresses came
+// from one IP, for spotting farms.
+type DisposableBlocks struct {
+	IP       string    `json:"ip"`
+	Attempts int64     `json:"attempts"`
+	LastAt   time.Time `json:"last_at"`
+}
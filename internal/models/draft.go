@@ -0,0 +1,53 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// MaxDrafts is how many drafts a user can keep.
+const MaxDrafts = 20
+
+// Draft is a generate request saved to finish later. Payload is the body
+// of /music/generate or /video/generate, as JSON; it is only sanitized
+// when the draft is submitted, like any other request.
+type Draft struct {
+	ID      uint           `gorm:"primaryKey"`
+	UserID  uint           `gorm:"not null;index"`
+	Type    GenerationType `gorm:"not null;size:20"`
+	Title   string         `gorm:"size:255"`
+	Payload string         `gorm:"type:text;not null"`
+	// SubmittingAt is set while the draft is being submitted, so a second
+	// submit can't start it twice.
+	SubmittingAt *time.Time
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+type DraftResponse struct {
+	ID        uint            `json:"id"`
+	Type      GenerationType  `json:"type"`
+	Title     string          `json:"title"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+func (d *Draft) ToResponse() DraftResponse {
+	return DraftResponse{
+		ID:        d.ID,
+		Type:      d.Type,
+		Title:     d.Title,
+		Payload:   json.RawMessage(d.Payload),
+		CreatedAt: d.CreatedAt,
+		UpdatedAt: d.UpdatedAt,
+	}
+}
+
+// DraftRequest creates a draft or replaces one. Payload is checked like
+// the generate request of Type, except that nothing is required and there
+// are no minimum lengths.
+type DraftRequest struct {
+	Type    GenerationType  `json:"type" validate:"required,oneof=music video"`
+	Payload json.RawMessage `json:"payload"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// EmailChange is a request to move an account to a new address. It
+// applies once the token sent to the new address is confirmed; after
+// that the old address holds an undo token for a while.
+type EmailChange struct {
+	ID       uint   `gorm:"primaryKey"`
+	UserID   uint   `gorm:"not null;index"`
+	OldEmail string `gorm:"not null;size:255"`
+	NewEmail string `gorm:"not null;size:255"`
+	// TokenHash and UndoTokenHash are SHA-256 hashes of the tokens mailed
+	// to the new and old address.
+	TokenHash     string `gorm:"not null;size:64;uniqueIndex"`
+	ExpiresAt     time.Time
+	ConfirmedAt   *time.Time
+	UndoTokenHash *string `gorm:"size:64;uniqueIndex"`
+	UndoExpiresAt *time.Time
+	UndoneAt      *time.Time
+	CreatedAt     time.Time
+}
+
+type ChangeEmailRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewEmail        string `json:"new_email" validate:"required,email,nosqli"`
+}
+
+type EmailChangeTokenRequest struct {
+	Token string `json:"token" validate:"required"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// EmailVerification is a link mailed to a new account's address. Following
+// it proves the address is the owner's and sets User.IsVerified.
+type EmailVerification struct {
+	ID     uint `gorm:"primaryKey"`
+	UserID uint `gorm:"not null;index"`
+	// TokenHash is a SHA-256 hash of the mailed token.
+	TokenHash  string    `gorm:"not null;size:64;uniqueIndex"`
+	ExpiresAt  time.Time `gorm:"index"`
+	ConsumedAt *time.Time
+	CreatedAt  time.Time
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email" validate:"required,email,nosqli"`
+}
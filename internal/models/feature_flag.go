@@ -0,0 +1,87 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// FeatureFlag gates a feature for a subset of users. A flag is on for a
+// user when it is enabled, the user's plan and role are targeted (empty
+// lists target everyone) and the user falls inside the rollout percentage.
+// Per-user overrides win over all of that.
+type FeatureFlag struct {
+	ID                uint   `gorm:"primaryKey"`
+	Key               string `gorm:"uniqueIndex;not null;size:100"`
+	Description       string `gorm:"size:255"`
+	Enabled           bool   `gorm:"default:false"`
+	RolloutPercentage int    `gorm:"default:100"`
+	Plans             string `gorm:"size:255"`
+	Roles             string `gorm:"size:255"`
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	Overrides         []FeatureFlagOverride `gorm:"foreignKey:FlagID;constraint:OnDelete:CASCADE"`
+}
+
+type FeatureFlagOverride struct {
+	ID        uint `gorm:"primaryKey"`
+	FlagID    uint `gorm:"uniqueIndex:idx_flag_override_user;not null"`
+	UserID    uint `gorm:"uniqueIndex:idx_flag_override_user;not null;index"`
+	Enabled   bool
+	CreatedAt time.Time
+}
+
+type FeatureFlagOverrideResponse struct {
+	UserID  uint `json:"user_id"`
+	Enabled bool `json:"enabled"`
+}
+
+type FeatureFlagResponse struct {
+	Key               string                        `json:"key"`
+	Description       string                        `json:"description,omitempty"`
+	Enabled           bool                          `json:"enabled"`
+	RolloutPercentage int                           `json:"rollout_percentage"`
+	Plans             []string                      `json:"plans"`
+	Roles             []string                      `json:"roles"`
+	Overrides         []FeatureFlagOverrideResponse `json:"overrides"`
+	UpdatedAt         time.Time                     `json:"updated_at"`
+}
+
+func (f *FeatureFlag) ToResponse() FeatureFlagResponse {
+	overrides := make([]FeatureFlagOverrideResponse, len(f.Overrides))
+	for i, o := range f.Overrides {
+		overrides[i] = FeatureFlagOverrideResponse{UserID: o.UserID, Enabled: o.Enabled}
+	}
+	return FeatureFlagResponse{
+		Key:               f.Key,
+		Description:       f.Description,
+		Enabled:           f.Enabled,
+		RolloutPercentage: f.RolloutPercentage,
+		Plans:             SplitList(f.Plans),
+		Roles:             SplitList(f.Roles),
+		Overrides:         overrides,
+		UpdatedAt:         f.UpdatedAt,
+	}
+}
+
+// SplitList parses a comma-separated column into its non-empty entries.
+func SplitList(value string) []string {
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+type UpsertFeatureFlagRequest struct {
+	Description       string   `json:"description" validate:"max=255,noxss"`
+	Enabled           bool     `json:"enabled"`
+	RolloutPercentage *int     `json:"rollout_percentage"`
+	Plans             []string `json:"plans"`
+	Roles             []string `json:"roles"`
+}
+
+type FeatureFlagOverrideRequest struct {
+	Enabled bool `json:"enabled"`
+}
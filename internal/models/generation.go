@@ -1,6 +1,8 @@
 package models
 
 import (
+	"path"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -17,13 +19,30 @@ const (
 	StatusProcessing GenerationStatus = "processing"
 	StatusCompleted  GenerationStatus = "completed"
 	StatusFailed     GenerationStatus = "failed"
+	// StatusInterrupted is a video job cut off by a shutdown after MiniMax
+	// accepted it. It is picked up again on the next start.
+	StatusInterrupted GenerationStatus = "interrupted"
+
+	// ModerationRemoved marks content taken down by an admin. The owner
+	// can't make it public again.
+	ModerationRemoved = "removed"
+	// ModerationPendingReview marks public content the publish filter held
+	// back. It stays off Explore until an admin approves or removes it.
+	ModerationPendingReview = "pending_review"
+	// ModerationApproved marks held content an admin let through. It
+	// isn't held again unless its text changes.
+	ModerationApproved = "approved"
 )
 
+// OffExplore are the moderation statuses that keep public content off
+// Explore.
+var OffExplore = []string{ModerationRemoved, ModerationPendingReview}
+
 type Generation struct {
 	ID           uint             `gorm:"primaryKey" json:"id"`
-	UserID       uint             `gorm:"index;not null" json:"user_id"`
+	UserID       uint             `gorm:"index;index:idx_generations_user_request,priority:1;not null" json:"user_id"`
 	Type         GenerationType   `gorm:"not null;size:20" json:"type"`
-	Status       GenerationStatus `gorm:"default:pending;size:20" json:"status"`
+	Status       GenerationStatus `gorm:"default:pending;size:20;index:idx_generations_status_created,priority:1" json:"status"`
 	Title        string           `gorm:"size:255" json:"title"`
 	Prompt       string           `gorm:"type:text;not null" json:"prompt"`
 	Lyrics       string           `gorm:"type:text" json:"lyrics,omitempty"`
@@ -38,88 +57,358 @@ type Generation struct {
 	MiniMaxJobID string           `gorm:"size:100" json:"minimax_job_id,omitempty"`
 	ErrorMessage string           `gorm:"type:text" json:"error_message,omitempty"`
 	Metadata     string           `gorm:"type:text" json:"metadata,omitempty"`
-	CreditsCost  int              `gorm:"default:1" json:"credits_cost"`
-	IsFavorite   bool             `gorm:"default:false" json:"is_favorite"`
-	IsPublic     bool             `gorm:"default:false" json:"is_public"`
-	CreatedAt    time.Time        `json:"created_at"`
-	UpdatedAt    time.Time        `json:"updated_at"`
-	DeletedAt    gorm.DeletedAt   `gorm:"index" json:"-"`
-	User         User             `gorm:"foreignKey:UserID" json:"-"`
+	// OutputBytes is the size of the output when we store it ourselves; 0
+	// when it is hosted by the provider.
+	OutputBytes int64 `gorm:"default:0" json:"-"`
+	// CreditsCost is set on every generation created; a default of 1 would
+	// turn a free demo generation's 0 into a charge on an admin retry.
+	CreditsCost int  `gorm:"default:0" json:"credits_cost"`
+	IsFavorite  bool `gorm:"default:false" json:"is_favorite"`
+	IsPublic    bool `gorm:"default:false" json:"is_public"`
+	// PlayCount is how many times the generation was played from
+	// Explore.
+	PlayCount int64 `gorm:"default:0;not null" json:"-"`
+	// IsDemo marks placeholder output from demo mode. It was never sent to
+	// the provider, is free and stays off Explore.
+	IsDemo bool `gorm:"default:false" json:"is_demo"`
+	// ModerationStatus is empty unless an admin or the publish filter
+	// acted on the content.
+	ModerationStatus string         `gorm:"size:20" json:"moderation_status,omitempty"`
+	ModerationReason string         `gorm:"size:500" json:"moderation_reason,omitempty"`
+	CreatedAt        time.Time      `gorm:"index:idx_generations_status_created,priority:2" json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+	DeletedAt        gorm.DeletedAt `gorm:"index" json:"-"`
+	User             User           `gorm:"foreignKey:UserID" json:"-"`
+	// CompletedAt is when the generation completed, for how long it took.
+	// Generations from before it was recorded have none.
+	CompletedAt *time.Time `json:"-"`
+	// StylePresetID is the style preset the generation was started with.
+	StylePresetID *uint `gorm:"index" json:"style_preset_id,omitempty"`
+	// VideoTemplateID is the video template the prompt was rendered from;
+	// Prompt is the rendered text.
+	VideoTemplateID *uint `gorm:"index" json:"video_template_id,omitempty"`
+	// Watermarked is set on outputs marked for a free plan; the clean file
+	// is kept at CleanMediaURL(OutputURL) for a re-render after upgrading.
+	Watermarked bool `gorm:"not null;default:false" json:"watermarked"`
+	// AspectRatio is the shape a video was rendered in; empty on music and
+	// on videos from before it could be chosen, which are 16:9.
+	AspectRatio string `gorm:"size:10" json:"aspect_ratio,omitempty"`
+	// RequestedDuration is the track length a music generation asked for,
+	// in seconds; Duration is the length of the file that came back.
+	RequestedDuration int `gorm:"default:0" json:"requested_duration,omitempty"`
+	// RequestHash identifies what the generate request asked for, to
+	// catch the same request sent twice while the first is running.
+	RequestHash string `gorm:"size:64;index:idx_generations_user_request,priority:2" json:"-"`
 }
 
 type GenerationResponse struct {
-	ID           uint             `json:"id"`
-	UserID       uint             `json:"user_id"`
-	Type         GenerationType   `json:"type"`
-	Status       GenerationStatus `json:"status"`
-	Title        string           `json:"title"`
-	Prompt       string           `json:"prompt"`
-	Lyrics       string           `json:"lyrics,omitempty"`
-	Narration    string           `json:"narration,omitempty"`
-	VoiceID      string           `json:"voice_id,omitempty"`
-	Style        string           `json:"style,omitempty"`
-	Duration     int              `json:"duration,omitempty"`
-	Resolution   string           `json:"resolution,omitempty"`
-	Model        string           `json:"model,omitempty"`
-	OutputURL    string           `json:"output_url,omitempty"`
-	ThumbnailURL string           `json:"thumbnail_url,omitempty"`
-	MiniMaxJobID string           `json:"minimax_job_id,omitempty"`
-	ErrorMessage string           `json:"error_message,omitempty"`
-	CreditsCost  int              `json:"credits_cost"`
-	IsFavorite   bool             `json:"is_favorite"`
-	IsPublic     bool             `json:"is_public"`
-	CreatedAt    time.Time        `json:"created_at"`
-}
-
-func (g *Generation) ToResponse() GenerationResponse {
+	ID                uint             `json:"id"`
+	UserID            uint             `json:"user_id"`
+	Type              GenerationType   `json:"type"`
+	Status            GenerationStatus `json:"status"`
+	Title             string           `json:"title"`
+	Prompt            string           `json:"prompt"`
+	Lyrics            string           `json:"lyrics,omitempty"`
+	Narration         string           `json:"narration,omitempty"`
+	VoiceID           string           `json:"voice_id,omitempty"`
+	Style             string           `json:"style,omitempty"`
+	Duration          int              `json:"duration,omitempty"`
+	Resolution        string           `json:"resolution,omitempty"`
+	Model             string           `json:"model,omitempty"`
+	OutputURL         string           `json:"output_url,omitempty"`
+	ThumbnailURL      string           `json:"thumbnail_url,omitempty"`
+	MiniMaxJobID      string           `json:"minimax_job_id,omitempty"`
+	ErrorMessage      string           `json:"error_message,omitempty"`
+	CreditsCost       int              `json:"credits_cost"`
+	IsFavorite        bool             `json:"is_favorite"`
+	IsPublic          bool             `json:"is_public"`
+	IsDemo            bool             `json:"is_demo"`
+	ModerationStatus  string           `json:"moderation_status,omitempty"`
+	ModerationReason  string           `json:"moderation_reason,omitempty"`
+	CreatedAt         time.Time        `json:"created_at"`
+	StylePresetID     *uint            `json:"style_preset_id,omitempty"`
+	VideoTemplateID   *uint            `json:"video_template_id,omitempty"`
+	Watermarked       bool             `json:"watermarked"`
+	AspectRatio       string           `json:"aspect_ratio,omitempty"`
+	RequestedDuration int              `json:"requested_duration,omitempty"`
+	// Metadata is only in the owner's view; the public one has none of
+	// it.
+	Metadata *GenerationMetadata `json:"metadata,omitempty"`
+}
+
+// ToResponse makes media stored on this server absolute against base, the
+// API's public base URL; with base "" they stay relative.
+func (g *Generation) ToResponse(base string) GenerationResponse {
 	return GenerationResponse{
+		ID:                g.ID,
+		UserID:            g.UserID,
+		Type:              g.Type,
+		Status:            g.Status,
+		Title:             g.Title,
+		Prompt:            g.Prompt,
+		Lyrics:            g.Lyrics,
+		Narration:         g.Narration,
+		VoiceID:           g.VoiceID,
+		Style:             g.Style,
+		Duration:          g.Duration,
+		Resolution:        g.Resolution,
+		Model:             g.Model,
+		OutputURL:         AbsoluteURL(base, g.OutputURL),
+		ThumbnailURL:      AbsoluteURL(base, g.ThumbnailURL),
+		MiniMaxJobID:      g.MiniMaxJobID,
+		ErrorMessage:      g.ErrorMessage,
+		CreditsCost:       g.CreditsCost,
+		IsFavorite:        g.IsFavorite,
+		IsPublic:          g.IsPublic,
+		IsDemo:            g.IsDemo,
+		ModerationStatus:  g.ModerationStatus,
+		ModerationReason:  g.ModerationReason,
+		CreatedAt:         g.CreatedAt,
+		StylePresetID:     g.StylePresetID,
+		VideoTemplateID:   g.VideoTemplateID,
+		Watermarked:       g.Watermarked,
+		AspectRatio:       g.VideoAspectRatio(),
+		RequestedDuration: g.RequestedDuration,
+		Metadata:          g.metadataResponse(base),
+	}
+}
+
+// VideoAspectRatio is the aspect ratio of a video, 16:9 when none was
+// recorded, or "" for music.
+func (g *Generation) VideoAspectRatio() string {
+	if g.Type != TypeVideo {
+		return ""
+	}
+	if g.AspectRatio == "" {
+		return "16:9"
+	}
+	return g.AspectRatio
+}
+
+// GenerationPublicResponse is what anyone may see of someone else's
+// generation, on Explore and wherever else one is shown to other users.
+// It is built field by field rather than trimmed from GenerationResponse,
+// so a field added to the owner's view doesn't leak here by default. A
+// test keeps every field on a reviewed list.
+type GenerationPublicResponse struct {
+	ID           uint           `json:"id"`
+	Type         GenerationType `json:"type"`
+	Title        string         `json:"title"`
+	Style        string         `json:"style"`
+	Duration     int            `json:"duration"`
+	OutputURL    string         `json:"output_url"`
+	ThumbnailURL string         `json:"thumbnail_url"`
+	// Lyrics are only set for music; a video's narration stays private.
+	Lyrics      string           `json:"lyrics,omitempty"`
+	CreatorName string           `json:"creator_name"`
+	Counts      EngagementCounts `json:"counts"`
+	CreatedAt   time.Time        `json:"created_at"`
+	// AspectRatio is only set for videos, for sizing the player.
+	AspectRatio string `json:"aspect_ratio,omitempty"`
+}
+
+// EngagementCounts are the public tallies of a generation.
+type EngagementCounts struct {
+	Plays int64 `json:"plays"`
+}
+
+// ToPublicResponse expects User to be preloaded. base is as for
+// ToResponse.
+func (g *Generation) ToPublicResponse(base string) GenerationPublicResponse {
+	resp := GenerationPublicResponse{
 		ID:           g.ID,
-		UserID:       g.UserID,
 		Type:         g.Type,
-		Status:       g.Status,
 		Title:        g.Title,
-		Prompt:       g.Prompt,
-		Lyrics:       g.Lyrics,
-		Narration:    g.Narration,
-		VoiceID:      g.VoiceID,
 		Style:        g.Style,
 		Duration:     g.Duration,
-		Resolution:   g.Resolution,
-		Model:        g.Model,
-		OutputURL:    g.OutputURL,
-		ThumbnailURL: g.ThumbnailURL,
-		MiniMaxJobID: g.MiniMaxJobID,
-		ErrorMessage: g.ErrorMessage,
-		CreditsCost:  g.CreditsCost,
-		IsFavorite:   g.IsFavorite,
-		IsPublic:     g.IsPublic,
+		OutputURL:    AbsoluteURL(base, g.OutputURL),
+		ThumbnailURL: AbsoluteURL(base, g.ThumbnailURL),
+		CreatorName:  g.User.Name,
+		Counts:       EngagementCounts{Plays: g.PlayCount},
 		CreatedAt:    g.CreatedAt,
+		AspectRatio:  g.VideoAspectRatio(),
+	}
+	if g.Type == TypeMusic {
+		resp.Lyrics = g.Lyrics
+	}
+	return resp
+}
+
+// AdminGenerationResponse is the support view of a generation: everything
+// in GenerationResponse plus the owner's email.
+type AdminGenerationResponse struct {
+	GenerationResponse
+	UserEmail string    `json:"user_email"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ToAdminResponse expects User to be preloaded. base is as for
+// ToResponse.
+func (g *Generation) ToAdminResponse(base string) AdminGenerationResponse {
+	return AdminGenerationResponse{
+		GenerationResponse: g.ToResponse(base),
+		UserEmail:          g.User.Email,
+		UpdatedAt:          g.UpdatedAt,
 	}
 }
 
 type GenerateMusicRequest struct {
-	Model   string `json:"model"`
-	Format  string `json:"format"`
-	Bitrate int    `json:"bitrate"`
-	Title  string `json:"title"`
-	Prompt string `json:"prompt"`
-	Lyrics string `json:"lyrics"`
-	Style  string `json:"style"`
+	Model   string `json:"model" validate:"max=50,noxss"`
+	Format  string `json:"format" validate:"oneof=mp3 wav pcm"`
+	Bitrate int    `json:"bitrate" validate:"max=320000"`
+	Title   string `json:"title" validate:"max=255,noxss"`
+	Prompt  string `json:"prompt" validate:"required,min=10,safehtml"`
+	Lyrics  string `json:"lyrics" validate:"required,min=10,safehtml"`
+	Style   string `json:"style" validate:"max=100,safehtml"`
+	// SavedPromptID fills in prompt, lyrics and style left empty from one
+	// of the caller's saved music prompts.
+	SavedPromptID uint `json:"saved_prompt_id"`
+	// StyleID is an active style preset to generate with.
+	StyleID uint `json:"style_id"`
+	// Normalize false skips loudness normalization; it defaults to true.
+	Normalize *bool `json:"normalize"`
+	// DurationSeconds is roughly how long the track should be; 0 leaves it
+	// to the model. The range depends on the model.
+	DurationSeconds int `json:"duration_seconds"`
+	// Force starts a generation even when the same request is already
+	// running.
+	Force bool `json:"force"`
+}
+
+// SetDefaults fills in the model, format and bitrate left out, as they
+// are sent to MiniMax. Plan checks read a bitrate of 0 as the default,
+// which every plan allows, so they run before it.
+func (r *GenerateMusicRequest) SetDefaults() {
+	if r.Model == "" {
+		r.Model = "music-2.0"
+	}
+	if r.Format == "" {
+		r.Format = "mp3"
+	}
+	if r.Bitrate <= 0 {
+		r.Bitrate = 256000
+	}
 }
 
 type GenerateVideoRequest struct {
-	Title      string `json:"title"`
-	Prompt     string `json:"prompt"`
+	Title      string `json:"title" validate:"max=255,noxss"`
+	Prompt     string `json:"prompt" validate:"required,min=10,safehtml"`
 	Duration   int    `json:"duration"`
-	Resolution string `json:"resolution"`
-	Model      string `json:"model"`
-	Narration  string `json:"narration"`
-	VoiceID    string `json:"voice_id"`
+	Resolution string `json:"resolution" validate:"max=20,noxss"`
+	Model      string `json:"model" validate:"max=50,noxss"`
+	Narration  string `json:"narration" validate:"safehtml"`
+	VoiceID    string `json:"voice_id" validate:"max=100,noxss"`
+	// SavedPromptID fills in the prompt, if left empty, from one of the
+	// caller's saved video prompts.
+	SavedPromptID uint `json:"saved_prompt_id"`
+	// TemplateID is an active video template to render the prompt from,
+	// with TemplateValues filling its slots.
+	TemplateID     uint              `json:"template_id"`
+	TemplateValues map[string]string `json:"template_values"`
+	// AspectRatio defaults to 16:9; not every model renders the others.
+	AspectRatio string `json:"aspect_ratio" validate:"oneof=16:9 9:16 1:1"`
+	// Force starts a generation even when the same request is already
+	// running.
+	Force bool `json:"force"`
+}
+
+// AbsoluteURL is url, a stored media URL, made absolute against base.
+// Stored URLs of files on this server are relative, so the base can change
+// freely; provider-hosted ones are already absolute and are returned as
+// they are, as is everything when base is "".
+func AbsoluteURL(base, url string) string {
+	if base == "" || !strings.HasPrefix(url, "/") || strings.HasPrefix(url, "//") {
+		return url
+	}
+	return base + url
+}
+
+// OriginalAudioURL is where the unnormalized file behind a music output
+// stored on this server is kept, or "" for other outputs.
+func OriginalAudioURL(outputURL string) string {
+	name, ok := strings.CutPrefix(outputURL, "/uploads/audio/")
+	if !ok || name == "" {
+		return ""
+	}
+	ext := path.Ext(name)
+	return "/uploads/audio/" + strings.TrimSuffix(name, ext) + ".original" + ext
+}
+
+// CleanMediaPrefix is where unwatermarked copies of outputs are kept. It is
+// under the upload directory but never served.
+const CleanMediaPrefix = "/uploads/clean/"
+
+// CleanMediaURL is where the unwatermarked file behind an output stored on
+// this server is kept, or "" for other outputs.
+func CleanMediaURL(outputURL string) string {
+	rel, ok := strings.CutPrefix(outputURL, "/uploads/")
+	if !ok || rel == "" || strings.HasPrefix(outputURL, CleanMediaPrefix) {
+		return ""
+	}
+	return CleanMediaPrefix + rel
+}
+
+// ListPublicGenerationsRequest is the query of the Explore feed. New
+// filters go here (or in ListGenerationsRequest when they only make sense
+// for the owner), with their rules in the validate tags.
+type ListPublicGenerationsRequest struct {
+	Type string `query:"type" validate:"oneof=music video"`
+	// Sort is newest (default) or oldest.
+	Sort  string `query:"sort" validate:"oneof=newest oldest"`
+	Page  int    `query:"page" validate:"min=1"`
+	Limit int    `query:"limit" validate:"min=1,max=100"`
+	// Fields is a comma-separated subset of the response fields; View
+	// "compact" is a preset subset. Both default to every field.
+	Fields string `query:"fields"`
+	View   string `query:"view"`
+}
+
+// SetDefaults fills in what the client left out.
+func (r *ListPublicGenerationsRequest) SetDefaults() {
+	if r.Page == 0 {
+		r.Page = 1
+	}
+	if r.Limit == 0 {
+		r.Limit = 20
+	}
+	if r.Sort == "" {
+		r.Sort = "newest"
+	}
 }
 
+// OrderBy is the ORDER BY clause for Sort.
+func (r *ListPublicGenerationsRequest) OrderBy() string {
+	if r.Sort == "oldest" {
+		return "created_at ASC"
+	}
+	return "created_at DESC"
+}
+
+// ListGenerationsRequest is the query of the caller's own list.
 type ListGenerationsRequest struct {
-	Type   string `query:"type"`
-	Status string `query:"status"`
-	Page   int    `query:"page"`
-	Limit  int    `query:"limit"`
+	ListPublicGenerationsRequest
+	Status   string `query:"status" validate:"oneof=pending processing completed failed interrupted"`
+	Favorite *bool  `query:"favorite"`
+}
+
+// MaxBulkGenerationIDs caps BulkGenerationRequest.IDs.
+const MaxBulkGenerationIDs = 100
+
+type BulkGenerationRequest struct {
+	IDs    []uint `json:"ids" validate:"required"`
+	Action string `json:"action" validate:"required,oneof=favorite unfavorite publish unpublish"`
+}
+
+// UpdateGenerationRequest edits a generation. Only the title can change.
+type UpdateGenerationRequest struct {
+	Title string `json:"title" validate:"required,max=255,noxss"`
+}
+
+type ForceFailGenerationRequest struct {
+	Reason string `json:"reason" validate:"required,max=500,noxss"`
+}
+
+type UnpublishGenerationRequest struct {
+	Reason                string `json:"reason" validate:"required,max=500,noxss"`
+	BanUserFromPublishing bool   `json:"ban_user_from_publishing"`
 }
@@ -0,0 +1,195 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// GenerationMetadata is what a generation records beyond its columns. It
+// is stored as JSON in Generation.Metadata; read and write it with
+// Generation.ReadMetadata, WriteMetadata and MergeMetadata rather than
+// touching the string.
+type GenerationMetadata struct {
+	// Provider is the provider's extra info about the output, as it sent
+	// it.
+	Provider json.RawMessage `json:"provider,omitempty"`
+	// Timings are how long the steps of the job took, in milliseconds, by
+	// step.
+	Timings map[string]int64 `json:"timings,omitempty"`
+	// Waveform is the peak level of a music track over its length, from 0
+	// to 1, for drawing it.
+	Waveform []float64 `json:"waveform,omitempty"`
+	// ProviderError is what the provider said when it failed the
+	// generation, next to the message shown to the user.
+	ProviderError string `json:"provider_error,omitempty"`
+	// TitleAutogenerated is set when the title wasn't given but made up.
+	TitleAutogenerated bool `json:"title_autogenerated,omitempty"`
+	// Loudness is how normalizing a music track went.
+	Loudness *LoudnessMetadata `json:"loudness,omitempty"`
+	// ActualDurationSeconds and DurationMismatch are only set when a
+	// track length was asked for: the length delivered, to a tenth of a
+	// second, and whether it is too far off.
+	ActualDurationSeconds *float64 `json:"actual_duration_seconds,omitempty"`
+	DurationMismatch      *bool    `json:"duration_mismatch,omitempty"`
+	// Raw is a stored value that couldn't be read, as it was.
+	Raw string `json:"raw,omitempty"`
+}
+
+// LoudnessMetadata is the outcome of loudness normalization.
+type LoudnessMetadata struct {
+	Normalized   bool      `json:"normalized"`
+	Note         string    `json:"note,omitempty"`
+	Measurements *Loudness `json:"measurements,omitempty"`
+	// OriginalURL is the unnormalized file, when it was kept.
+	OriginalURL string `json:"original_url,omitempty"`
+}
+
+// Loudness is what a normalization pass measured, before and after.
+type Loudness struct {
+	TargetLUFS     float64 `json:"target_lufs"`
+	InputLUFS      float64 `json:"input_lufs"`
+	InputTruePeak  float64 `json:"input_true_peak"`
+	InputLRA       float64 `json:"input_lra"`
+	OutputLUFS     float64 `json:"output_lufs"`
+	OutputTruePeak float64 `json:"output_true_peak"`
+	OutputLRA      float64 `json:"output_lra"`
+}
+
+// metadataKeys are the top-level keys of GenerationMetadata.
+var metadataKeys = func() map[string]bool {
+	keys := map[string]bool{}
+	t := reflect.TypeOf(GenerationMetadata{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		keys[name] = true
+	}
+	return keys
+}()
+
+// ParseGenerationMetadata reads stored metadata. Metadata from before it
+// had a structure is the provider's extra info, possibly with the
+// loudness and length fields beside it; anything at the top level that
+// isn't a field is taken as that and put under Provider. A value that
+// isn't a JSON object comes back as Raw, so reading never fails.
+func ParseGenerationMetadata(s string) GenerationMetadata {
+	if strings.TrimSpace(s) == "" {
+		return GenerationMetadata{}
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(s), &fields); err != nil {
+		return GenerationMetadata{Raw: s}
+	}
+	var m GenerationMetadata
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		return GenerationMetadata{Raw: s}
+	}
+
+	extra := map[string]json.RawMessage{}
+	for k, v := range fields {
+		if !metadataKeys[k] {
+			extra[k] = v
+		}
+	}
+	if len(extra) > 0 {
+		if len(m.Provider) > 0 {
+			extra["provider"] = m.Provider
+		}
+		b, err := json.Marshal(extra)
+		if err != nil {
+			return GenerationMetadata{Raw: s}
+		}
+		m.Provider = b
+	}
+	return m
+}
+
+// IsZero reports whether m records nothing.
+func (m GenerationMetadata) IsZero() bool {
+	return len(m.Provider) == 0 && len(m.Timings) == 0 && len(m.Waveform) == 0 &&
+		m.ProviderError == "" && !m.TitleAutogenerated && m.Loudness == nil &&
+		m.ActualDurationSeconds == nil && m.DurationMismatch == nil && m.Raw == ""
+}
+
+// Encode is m as stored, or "" when it records nothing.
+func (m GenerationMetadata) Encode() string {
+	if m.IsZero() {
+		return ""
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		// Only Provider can fail to marshal, by not being JSON; keep it
+		// the way unreadable values are kept.
+		m.Raw, m.Provider = string(m.Provider), nil
+		b, _ = json.Marshal(m)
+	}
+	return string(b)
+}
+
+// Merge sets the fields set in update, adding to Timings rather than
+// replacing them.
+func (m *GenerationMetadata) Merge(update GenerationMetadata) {
+	if len(update.Provider) > 0 && string(update.Provider) != "null" {
+		m.Provider = update.Provider
+	}
+	for step, ms := range update.Timings {
+		if m.Timings == nil {
+			m.Timings = map[string]int64{}
+		}
+		m.Timings[step] = ms
+	}
+	if len(update.Waveform) > 0 {
+		m.Waveform = update.Waveform
+	}
+	if update.ProviderError != "" {
+		m.ProviderError = update.ProviderError
+	}
+	if update.TitleAutogenerated {
+		m.TitleAutogenerated = true
+	}
+	if update.Loudness != nil {
+		m.Loudness = update.Loudness
+	}
+	if update.ActualDurationSeconds != nil {
+		m.ActualDurationSeconds = update.ActualDurationSeconds
+	}
+	if update.DurationMismatch != nil {
+		m.DurationMismatch = update.DurationMismatch
+	}
+	if update.Raw != "" {
+		m.Raw = update.Raw
+	}
+}
+
+// ReadMetadata is the generation's metadata; see ParseGenerationMetadata.
+func (g *Generation) ReadMetadata() GenerationMetadata {
+	return ParseGenerationMetadata(g.Metadata)
+}
+
+// WriteMetadata replaces the generation's metadata with m.
+func (g *Generation) WriteMetadata(m GenerationMetadata) {
+	g.Metadata = m.Encode()
+}
+
+// MergeMetadata sets the fields set in update on the generation's
+// metadata, keeping the rest.
+func (g *Generation) MergeMetadata(update GenerationMetadata) {
+	m := g.ReadMetadata()
+	m.Merge(update)
+	g.WriteMetadata(m)
+}
+
+// metadataResponse is the owner's view of the metadata, with a kept
+// original's URL made absolute against base, or nil when there is none.
+func (g *Generation) metadataResponse(base string) *GenerationMetadata {
+	m := g.ReadMetadata()
+	if m.IsZero() {
+		return nil
+	}
+	if m.Loudness != nil && m.Loudness.OriginalURL != "" {
+		loudness := *m.Loudness
+		loudness.OriginalURL = AbsoluteURL(base, loudness.OriginalURL)
+		m.Loudness = &loudness
+	}
+	return &m
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// publicGenerationReviewed are the JSON fields of GenerationPublicResponse,
+// nested ones by their path, that someone has checked are fine to show
+// anyone. Adding a field to the struct means reviewing it and adding it
+// here.
+var publicGenerationReviewed = []string{
+	"id", "type", "title", "style", "duration", "output_url", "thumbnail_url",
+	"lyrics", "creator_name", "counts", "counts.plays", "created_at", "aspect_ratio",
+}
+
+func TestPublicGenerationFieldsReviewed(t *testing.T) {
+	var fields []string
+	var walk func(prefix string, typ reflect.Type)
+	walk = func(prefix string, typ reflect.Type) {
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "" || name == "-" {
+				t.Errorf("GenerationPublicResponse field %s%s has no JSON name", prefix, field.Name)
+				continue
+			}
+			fields = append(fields, prefix+name)
+			if field.Type.Kind() == reflect.Struct && field.Type != reflect.TypeOf(time.Time{}) {
+				walk(prefix+name+".", field.Type)
+			}
+		}
+	}
+	walk("", reflect.TypeOf(GenerationPublicResponse{}))
+
+	for _, name := range fields {
+		if !slices.Contains(publicGenerationReviewed, name) {
+			t.Errorf("GenerationPublicResponse field %q is not in publicGenerationReviewed", name)
+		}
+	}
+	for _, name := range publicGenerationReviewed {
+		if !slices.Contains(fields, name) {
+			t.Errorf("publicGenerationReviewed lists %q, which GenerationPublicResponse doesn't have", name)
+		}
+	}
+}
+
+func TestToPublicResponse(t *testing.T) {
+	g := Generation{
+		ID: 7, Type: TypeVideo, Title: "Sunset", Style: "cinematic", Duration: 6,
+		Prompt: "secret prompt", Narration: "secret narration", Lyrics: "not for videos",
+		ErrorMessage: "secret error", MiniMaxJobID: "job-1", OutputURL: "/uploads/video/a.mp4",
+		PlayCount: 12, User: User{Name: "Ana", Email: "ana@example.com"},
+	}
+	resp := g.ToPublicResponse("https://api.example.com")
+	if resp.OutputURL != "https://api.example.com/uploads/video/a.mp4" || resp.CreatorName != "Ana" ||
+		resp.Counts.Plays != 12 || resp.Lyrics != "" || resp.AspectRatio != "16:9" {
+		t.Errorf("video response %+v", resp)
+	}
+
+	g.Type = TypeMusic
+	if resp := g.ToPublicResponse(""); resp.Lyrics != "not for videos" || resp.AspectRatio != "" {
+		t.Errorf("music response %+v, want lyrics and no aspect ratio", resp)
+	}
+}
+
+func TestAbsoluteURL(t *testing.T) {
+	tests := []struct {
+		name, base, url, want string
+	}{
+		{"stored on this server", "https://api.example.com", "/uploads/audio/42.mp3", "https://api.example.com/uploads/audio/42.mp3"},
+		{"base with a path", "https://example.com/api", "/uploads/images/1.jpg", "https://example.com/api/uploads/images/1.jpg"},
+		{"hosted by the provider", "https://api.example.com", "https://cdn.minimax.io/out/42.mp4", "https://cdn.minimax.io/out/42.mp4"},
+		{"scheme-relative", "https://api.example.com", "//cdn.example.net/a.mp3", "//cdn.example.net/a.mp3"},
+		{"no base", "", "/uploads/audio/42.mp3", "/uploads/audio/42.mp3"},
+		{"empty", "https://api.example.com", "", ""},
+	}
+	for _, tt := range tests {
+		if got := AbsoluteURL(tt.base, tt.url); got != tt.want {
+			t.Errorf("%s: AbsoluteURL(%q, %q) = %q, want %q", tt.name, tt.base, tt.url, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+package models
+
+// GraphQLRequest is the body of POST /api/v1/graphql, in the shape GraphQL
+// clients send.
+type GraphQLRequest struct {
+	Query         string                 `json:"query" validate:"required,max=8000"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+	// Extensions is accepted so clients that always send it aren't
+	// refused, and ignored.
+	Extensions map[string]interface{} `json:"extensions"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// LinkedIdentity ties a third-party account (Google, GitHub) to a user. A
+// user can have one per provider or several; each provider account
+// belongs to one user.
+type LinkedIdentity struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;index" json:"-"`
+	Provider  string    `gorm:"not null;size:20;uniqueIndex:idx_linked_identities_provider_subject,priority:1" json:"provider"`
+	Subject   string    `gorm:"not null;size:255;uniqueIndex:idx_linked_identities_provider_subject,priority:2" json:"-"`
+	Email     string    `gorm:"size:255" json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Login outcomes.
+const (
+	LoginSucceeded = "success"
+	LoginFailed    = "failure"
+)
+
+// LoginEvent is one attempt to log in to an account, shown to its owner
+// so they can spot logins that weren't theirs. Attempts for emails with
+// no account are only in the audit log.
+type LoginEvent struct {
+	ID     uint   `gorm:"primaryKey" json:"id"`
+	UserID uint   `gorm:"not null;index:idx_login_events_user_created,priority:1" json:"-"`
+	Method string `gorm:"not null;size:20" json:"method"`
+	// Outcome is LoginSucceeded or LoginFailed; Reason says why a login
+	// failed, e.g. bad_password or locked.
+	Outcome   string `gorm:"not null;size:10" json:"outcome"`
+	Reason    string `gorm:"size:30" json:"reason,omitempty"`
+	IP        string `gorm:"size:45" json:"ip"`
+	Location  string `gorm:"size:255" json:"location,omitempty"`
+	UserAgent string `gorm:"size:255" json:"user_agent"`
+	// CreatedAt also serves the purge's retention cutoff.
+	CreatedAt time.Time `gorm:"index:idx_login_events_user_created,priority:2;index" json:"created_at"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// MagicLink is a single-use sign-in link mailed to Email. It is keyed by
+// address rather than user so it can also create the account when
+// Register is set.
+type MagicLink struct {
+	ID    uint   `gorm:"primaryKey"`
+	Email string `gorm:"not null;size:255;index"`
+	// TokenHash is a SHA-256 hash of the mailed token.
+	TokenHash string `gorm:"not null;size:64;uniqueIndex"`
+	// Fingerprint is a hash of the requesting network, set when
+	// MAGIC_LINK_BIND_IP is on; the link then only works from there.
+	Fingerprint string `gorm:"size:64"`
+	Register    bool
+	ExpiresAt   time.Time `gorm:"index"`
+	ConsumedAt  *time.Time
+	CreatedAt   time.Time
+}
+
+type MagicLinkRequest struct {
+	Email string `json:"email" validate:"required,email,nosqli"`
+	// Register creates an account for an unknown address when the link
+	// is followed.
+	Register bool `json:"register"`
+}
+
+type MagicLinkVerifyRequest struct {
+	Token string `json:"token" validate:"required"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// SetMaintenanceRequest turns maintenance mode on or off. Message and ETA
+// are shown to clients while it is on; ETA is RFC 3339.
+type SetMaintenanceRequest struct {
+	Enabled bool       `json:"enabled"`
+	Message string     `json:"message" validate:"max=500,noxss"`
+	ETA     *time.Time `json:"eta"`
+}
+
+// RunPurgeRequest triggers the soft-delete purge. RetentionDays overrides
+// PURGE_RETENTION for this run.
+type RunPurgeRequest struct {
+	DryRun        bool `json:"dry_run"`
+	RetentionDays int  `json:"retention_days" validate:"max=3650"`
+}
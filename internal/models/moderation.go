@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+)
+
+// ModerationRule is an entry of the prompt blocklist. Plain patterns match
+// whole words case-insensitively; regex patterns are used as written with
+// case-insensitive matching.
+type ModerationRule struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Pattern   string    `gorm:"not null;size:500" json:"pattern"`
+	IsRegex   bool      `gorm:"default:false" json:"is_regex"`
+	Reason    string    `gorm:"size:255" json:"reason"`
+	IsActive  bool      `gorm:"default:true" json:"is_active"`
+	CreatedBy *uint     `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type CreateModerationRuleRequest struct {
+	Pattern string `json:"pattern" validate:"required,max=500"`
+	IsRegex bool   `json:"is_regex"`
+	Reason  string `json:"reason" validate:"max=255,noxss"`
+}
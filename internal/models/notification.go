@@ -0,0 +1,119 @@
+package models
+
+import "time"
+
+// NotificationPreferences is what a user wants to be told about. A user
+// without a row has the defaults, so rows only exist once changed.
+// Columns added after the table have database defaults so existing rows
+// get the default too. GORM would put such a default in place of a false
+// on insert, so rows are inserted with the defaults and then updated.
+type NotificationPreferences struct {
+	UserID uint `gorm:"primaryKey" json:"-"`
+	// NewDeviceEmail mails the user when their account is logged in to
+	// from a device it hasn't seen.
+	NewDeviceEmail bool `gorm:"not null" json:"new_device_email"`
+	// GenerationCompleteEmail mails the user when a generation finishes
+	// or fails while they aren't connected.
+	GenerationCompleteEmail bool `gorm:"not null;default:true" json:"generation_complete_email"`
+	// MarketingEmail opts the user in to news and offers.
+	MarketingEmail bool `gorm:"not null;default:false" json:"marketing_email"`
+	// LowCreditAlerts notifies the user when a charge takes their balance
+	// below the low_credit_threshold setting.
+	LowCreditAlerts bool `gorm:"not null;default:true" json:"low_credit_alerts"`
+	// ModerationNotices is always on: a user is always told when their
+	// content is taken down. It is shown so clients can list it.
+	ModerationNotices bool      `gorm:"-" json:"moderation_notices"`
+	UpdatedAt         time.Time `json:"-"`
+}
+
+// Notification preferences by their JSON name, as senders and unsubscribe
+// links refer to them.
+const (
+	PrefNewDeviceEmail          = "new_device_email"
+	PrefGenerationCompleteEmail = "generation_complete_email"
+	PrefMarketingEmail          = "marketing_email"
+	PrefLowCreditAlerts         = "low_credit_alerts"
+	PrefModerationNotices       = "moderation_notices"
+)
+
+// DefaultNotificationPreferences are the preferences of a user who never
+// changed them: everything about their account and generations on,
+// marketing off.
+func DefaultNotificationPreferences(userID uint) NotificationPreferences {
+	return NotificationPreferences{
+		UserID:                  userID,
+		NewDeviceEmail:          true,
+		GenerationCompleteEmail: true,
+		LowCreditAlerts:         true,
+		ModerationNotices:       true,
+	}
+}
+
+// Field is the setting for the named preference, or nil when there is no
+// such preference or it can't be turned off.
+func (p *NotificationPreferences) Field(name string) *bool {
+	switch name {
+	case PrefNewDeviceEmail:
+		return &p.NewDeviceEmail
+	case PrefGenerationCompleteEmail:
+		return &p.GenerationCompleteEmail
+	case PrefMarketingEmail:
+		return &p.MarketingEmail
+	case PrefLowCreditAlerts:
+		return &p.LowCreditAlerts
+	}
+	return nil
+}
+
+// Allows reports whether the named preference is on. Moderation notices
+// always are.
+func (p *NotificationPreferences) Allows(name string) bool {
+	if name == PrefModerationNotices {
+		return true
+	}
+	field := p.Field(name)
+	return field != nil && *field
+}
+
+// UnsubscribeRequest carries the token from an email's unsubscribe link.
+type UnsubscribeRequest struct {
+	Token string `json:"token" validate:"required,max=200"`
+}
+
+// UpdateNotificationPreferencesRequest changes the fields that are set.
+// ModerationNotices is accepted so clients can send back what they got,
+// but only as true.
+type UpdateNotificationPreferencesRequest struct {
+	NewDeviceEmail          *bool `json:"new_device_email"`
+	GenerationCompleteEmail *bool `json:"generation_complete_email"`
+	MarketingEmail          *bool `json:"marketing_email"`
+	LowCreditAlerts         *bool `json:"low_credit_alerts"`
+	ModerationNotices       *bool `json:"moderation_notices"`
+}
+
+// Notification types, by the event that wrote them.
+const (
+	NotifyGenerationCompleted = "generation_completed"
+	NotifyGenerationFailed    = "generation_failed"
+	NotifyCreditsLow          = "credits_low"
+	NotifyContentModerated    = "content_moderated"
+	NotifyNewDeviceLogin      = "new_device_login"
+	NotifyDataExportReady     = "data_export_ready"
+)
+
+// Notification is an entry in a user's in-app inbox, kept so events the
+// WebSocket pushed while they were away aren't lost. Title and body are
+// written in the language of the request behind the event. Link is the
+// web app path it opens, and RefType and RefID name what it is about.
+type Notification struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;index:idx_notifications_user_created,priority:1" json:"-"`
+	Type      string     `gorm:"size:50;not null" json:"type"`
+	Title     string     `gorm:"size:255;not null" json:"title"`
+	Body      string     `gorm:"type:text" json:"body"`
+	Link      string     `gorm:"size:500" json:"link,omitempty"`
+	RefType   string     `gorm:"size:50" json:"ref_type,omitempty"`
+	RefID     string     `gorm:"size:64" json:"ref_id,omitempty"`
+	ReadAt    *time.Time `gorm:"index" json:"read_at"`
+	CreatedAt time.Time  `gorm:"index:idx_notifications_user_created,priority:2" json:"created_at"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+const (
+	ReferralPending  = "pending"
+	ReferralRewarded = "rewarded"
+	// ReferralCapped is a referral that only paid the referred user,
+	// because the referrer had reached the monthly cap or their account
+	// is no longer active.
+	ReferralCapped = "capped"
+)
+
+// Referral links an account to the one whose code it signed up with. It
+// pays out once, on the referred account's first completed generation.
+type Referral struct {
+	ID         uint `gorm:"primaryKey" json:"-"`
+	ReferrerID uint `gorm:"not null;index" json:"-"`
+	// ReferredID is unique: an account is only ever referred once.
+	ReferredID uint   `gorm:"not null;uniqueIndex" json:"-"`
+	Status     string `gorm:"not null;size:20;index" json:"status"`
+	// ReferrerCredits and ReferredCredits are what each side was granted.
+	ReferrerCredits int        `json:"referrer_credits"`
+	ReferredCredits int        `json:"-"`
+	RewardedAt      *time.Time `gorm:"index" json:"rewarded_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// ReferralStats is what the referrals page shows a user.
+type ReferralStats struct {
+	Code string `json:"code"`
+	Link string `json:"link"`
+	// Pending are sign-ups that haven't generated anything yet.
+	Pending  int64 `json:"pending"`
+	Rewarded int64 `json:"rewarded"`
+	// Capped paid the referred user only.
+	Capped        int64 `json:"capped"`
+	CreditsEarned int64 `json:"credits_earned"`
+	// RewardsThisMonth counts towards MonthlyCap, per UTC month.
+	RewardsThisMonth int64 `json:"rewards_this_month"`
+	MonthlyCap       int   `json:"monthly_cap"`
+	BonusCredits     int   `json:"bonus_credits"`
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"html"
+	"time"
+)
+
+// SavedPrompt is a prompt a user keeps to generate from again. Its text
+// is stored sanitized, like a generation's.
+type SavedPrompt struct {
+	ID     uint           `gorm:"primaryKey"`
+	UserID uint           `gorm:"not null;index"`
+	Type   GenerationType `gorm:"not null;size:20"`
+	Name   string         `gorm:"not null;size:100"`
+	Prompt string         `gorm:"type:text;not null"`
+	Style  string         `gorm:"size:100"`
+	// LyricsTemplate is only kept for music.
+	LyricsTemplate string `gorm:"type:text"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+type SavedPromptResponse struct {
+	ID             uint           `json:"id"`
+	Type           GenerationType `json:"type"`
+	Name           string         `json:"name"`
+	Prompt         string         `json:"prompt"`
+	Style          string         `json:"style,omitempty"`
+	LyricsTemplate string         `json:"lyrics_template,omitempty"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+}
+
+func (p *SavedPrompt) ToResponse() SavedPromptResponse {
+	return SavedPromptResponse{
+		ID:             p.ID,
+		Type:           p.Type,
+		Name:           p.Name,
+		Prompt:         p.Prompt,
+		Style:          p.Style,
+		LyricsTemplate: p.LyricsTemplate,
+		CreatedAt:      p.CreatedAt,
+		UpdatedAt:      p.UpdatedAt,
+	}
+}
+
+// UseSavedPrompt fills in the fields of r left empty from p. The saved
+// text is unescaped, since the request is sanitized again when it is
+// stored.
+func (r *GenerateMusicRequest) UseSavedPrompt(p *SavedPrompt) {
+	if r.Prompt == "" {
+		r.Prompt = html.UnescapeString(p.Prompt)
+	}
+	if r.Style == "" {
+		r.Style = html.UnescapeString(p.Style)
+	}
+	if r.Lyrics == "" {
+		r.Lyrics = html.UnescapeString(p.LyricsTemplate)
+	}
+}
+
+// UseSavedPrompt fills in the prompt of r from p if it was left empty.
+func (r *GenerateVideoRequest) UseSavedPrompt(p *SavedPrompt) {
+	if r.Prompt == "" {
+		r.Prompt = html.UnescapeString(p.Prompt)
+	}
+}
+
+// SavedPromptRequest creates a saved prompt or replaces one.
+type SavedPromptRequest struct {
+	Type           GenerationType `json:"type" validate:"required,oneof=music video"`
+	Name           string         `json:"name" validate:"required,max=100,noxss"`
+	Prompt         string         `json:"prompt" validate:"required,min=10,safehtml"`
+	Style          string         `json:"style" validate:"max=100,safehtml"`
+	LyricsTemplate string         `json:"lyrics_template" validate:"safehtml"`
+}
+
+// PromptHistoryRequest is the query of the caller's prompt history.
+type PromptHistoryRequest struct {
+	Type string `query:"type" validate:"oneof=music video"`
+}
+
+// PromptHistoryEntry is a prompt the user generated from, with the
+// settings of the last generation that used it.
+type PromptHistoryEntry struct {
+	Type         GenerationType `json:"type"`
+	Prompt       string         `json:"prompt"`
+	Style        string         `json:"style,omitempty"`
+	Lyrics       string         `json:"lyrics,omitempty"`
+	GenerationID uint           `json:"generation_id"`
+	TimesUsed    int            `json:"times_used"`
+	LastUsedAt   time.Time      `json:"last_used_at"`
+}
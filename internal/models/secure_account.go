@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// SecureAccountToken comes with a new-device login notice. Following it
+// says the login wasn't the owner's: every session is ended and the
+// password replaced.
+type SecureAccountToken struct {
+	ID     uint `gorm:"primaryKey"`
+	UserID uint `gorm:"not null;index"`
+	// TokenHash is a SHA-256 hash of the mailed token.
+	TokenHash string    `gorm:"not null;size:64;uniqueIndex"`
+	ExpiresAt time.Time `gorm:"index"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+type SecureAccountRequest struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required,password"`
+}
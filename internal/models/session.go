@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// RefreshToken is the server-side record of an issued refresh token, keyed
+// on its JTI. Every token descended from one login shares a SessionID. A
+// token is consumed when it is exchanged for the next one; presenting it
+// again revokes the whole session.
+type RefreshToken struct {
+	ID        string `gorm:"primaryKey;size:36"`
+	SessionID string `gorm:"size:36;not null;index"`
+	UserID    uint   `gorm:"not null;index"`
+	TokenHash string `gorm:"size:64;not null"`
+	UserAgent string `gorm:"size:255"`
+	IP        string `gorm:"size:64"`
+	// Fingerprint is a hash of the device's browser and OS family and
+	// network prefix.
+	Fingerprint string    `gorm:"size:64"`
+	ExpiresAt   time.Time `gorm:"not null;index"`
+	ConsumedAt  *time.Time
+	RevokedAt   *time.Time
+	CreatedAt   time.Time
+}
@@ -0,0 +1,115 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// StylePreset is an entry of the music style picker. Generating with one
+// puts its prompt fragment in front of the user's prompt and fills in the
+// suggested model and bitrate when the request leaves them out. Deleted
+// presets are kept soft-deleted so generations that used one can still be
+// ranked by it.
+type StylePreset struct {
+	ID               uint   `gorm:"primaryKey"`
+	Name             string `gorm:"uniqueIndex;not null;size:50"`
+	DisplayName      string `gorm:"not null;size:100"`
+	PromptFragment   string `gorm:"not null;size:500"`
+	SuggestedBitrate int    `gorm:"default:0"`
+	SuggestedModel   string `gorm:"size:50"`
+	ThumbnailURL     string `gorm:"size:500"`
+	SortOrder        int    `gorm:"default:0"`
+	IsActive         bool   `gorm:"not null"`
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	DeletedAt        gorm.DeletedAt `gorm:"index"`
+}
+
+// StylePresetResponse is what the picker shows. The prompt fragment is
+// only in the admin view.
+type StylePresetResponse struct {
+	ID               uint   `json:"id"`
+	Name             string `json:"name"`
+	DisplayName      string `json:"display_name"`
+	SuggestedBitrate int    `json:"suggested_bitrate,omitempty"`
+	SuggestedModel   string `json:"suggested_model,omitempty"`
+	ThumbnailURL     string `json:"thumbnail_url,omitempty"`
+}
+
+func (p *StylePreset) ToResponse() StylePresetResponse {
+	return StylePresetResponse{
+		ID:               p.ID,
+		Name:             p.Name,
+		DisplayName:      p.DisplayName,
+		SuggestedBitrate: p.SuggestedBitrate,
+		SuggestedModel:   p.SuggestedModel,
+		ThumbnailURL:     p.ThumbnailURL,
+	}
+}
+
+type AdminStylePresetResponse struct {
+	StylePresetResponse
+	PromptFragment string    `json:"prompt_fragment"`
+	SortOrder      int       `json:"sort_order"`
+	IsActive       bool      `json:"is_active"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+func (p *StylePreset) ToAdminResponse() AdminStylePresetResponse {
+	return AdminStylePresetResponse{
+		StylePresetResponse: p.ToResponse(),
+		PromptFragment:      p.PromptFragment,
+		SortOrder:           p.SortOrder,
+		IsActive:            p.IsActive,
+		UpdatedAt:           p.UpdatedAt,
+	}
+}
+
+// UseStylePreset puts p's prompt fragment in front of r's prompt and
+// fills in the style, model and bitrate r left out from it.
+func (r *GenerateMusicRequest) UseStylePreset(p *StylePreset) {
+	if r.Prompt == "" {
+		r.Prompt = p.PromptFragment
+	} else {
+		r.Prompt = p.PromptFragment + ", " + r.Prompt
+	}
+	if r.Style == "" {
+		r.Style = p.DisplayName
+	}
+	if r.Model == "" {
+		r.Model = p.SuggestedModel
+	}
+	if r.Bitrate == 0 {
+		r.Bitrate = p.SuggestedBitrate
+	}
+}
+
+// UpsertStylePresetRequest creates or replaces the preset named in the
+// path.
+type UpsertStylePresetRequest struct {
+	DisplayName      string `json:"display_name" validate:"required,max=100,noxss"`
+	PromptFragment   string `json:"prompt_fragment" validate:"required,max=500,safehtml"`
+	SuggestedBitrate int    `json:"suggested_bitrate" validate:"min=0,max=320000"`
+	SuggestedModel   string `json:"suggested_model" validate:"max=50,noxss"`
+	ThumbnailURL     string `json:"thumbnail_url" validate:"max=500,noxss"`
+	SortOrder        int    `json:"sort_order"`
+	// IsActive defaults to true; inactive presets are hidden from the
+	// picker and refused by the generate endpoint.
+	IsActive *bool `json:"is_active"`
+}
+
+// DefaultStylePresets are seeded, active, on first start. Later changes
+// are made by admins and are never overwritten by the seed.
+var DefaultStylePresets = []StylePreset{
+	{Name: "pop", DisplayName: "Pop", PromptFragment: "catchy modern pop, bright synths, punchy drums, memorable chorus", SuggestedModel: "music-2.0", SuggestedBitrate: 256000, SortOrder: 10},
+	{Name: "rock", DisplayName: "Rock", PromptFragment: "driving rock band, distorted electric guitars, live drums, energetic", SuggestedModel: "music-2.0", SuggestedBitrate: 256000, SortOrder: 20},
+	{Name: "hip-hop", DisplayName: "Hip-Hop", PromptFragment: "hip-hop beat, deep 808 bass, crisp snares, laid-back groove", SuggestedModel: "music-2.0", SuggestedBitrate: 256000, SortOrder: 30},
+	{Name: "edm", DisplayName: "EDM", PromptFragment: "festival electronic dance music, four-on-the-floor kick, big build-up and drop", SuggestedModel: "music-2.0", SuggestedBitrate: 320000, SortOrder: 40},
+	{Name: "lofi", DisplayName: "Lo-fi", PromptFragment: "lo-fi chill beat, dusty vinyl texture, mellow keys, relaxed tempo", SuggestedModel: "music-2.0", SuggestedBitrate: 192000, SortOrder: 50},
+	{Name: "acoustic", DisplayName: "Acoustic", PromptFragment: "intimate acoustic arrangement, fingerpicked guitar, warm vocals", SuggestedModel: "music-2.0", SuggestedBitrate: 256000, SortOrder: 60},
+	{Name: "jazz", DisplayName: "Jazz", PromptFragment: "smooth jazz combo, upright bass, brushed drums, saxophone lead", SuggestedModel: "music-2.0", SuggestedBitrate: 256000, SortOrder: 70},
+	{Name: "cinematic", DisplayName: "Cinematic", PromptFragment: "epic cinematic orchestral score, soaring strings, powerful brass, dramatic percussion", SuggestedModel: "music-2.0", SuggestedBitrate: 320000, SortOrder: 80},
+	{Name: "rnb", DisplayName: "R&B", PromptFragment: "smooth contemporary R&B, silky vocals, lush chords, slow groove", SuggestedModel: "music-2.0", SuggestedBitrate: 256000, SortOrder: 90},
+	{Name: "dangdut", DisplayName: "Dangdut", PromptFragment: "Indonesian dangdut, tabla-like kendang rhythm, suling flute, melodic vocals", SuggestedModel: "music-2.0", SuggestedBitrate: 256000, SortOrder: 100},
+}
@@ -41,7 +41,7 @@ type Subscription struct {
 	CurrentPeriodEnd    time.Time      `json:"current_period_end"`
 	CancelAtPeriodEnd   bool           `gorm:"default:false" json:"cancel_at_period_end"`
 	PaymentProvider     string         `gorm:"size:50" json:"payment_provider,omitempty"`
-	PaymentProviderID   string         `gorm:"size:100" json:"payment_provider_id,omitempty"`
+	PaymentProviderID   string         `gorm:"size:255;serializer:encrypted" json:"payment_provider_id,omitempty"`
 	CreatedAt           time.Time      `json:"created_at"`
 	UpdatedAt           time.Time      `json:"updated_at"`
 	DeletedAt           gorm.DeletedAt `gorm:"index" json:"-"`
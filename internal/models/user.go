@@ -1,68 +1,107 @@
 package models
 
 import (
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
 )
 
 type User struct {
-	ID           uint           `gorm:"primaryKey" json:"id"`
-	Email        string         `gorm:"uniqueIndex;not null;size:255" json:"email"`
-	PasswordHash string         `gorm:"not null" json:"-"`
-	Name         string         `gorm:"not null;size:100" json:"name"`
-	Avatar       string         `gorm:"size:500" json:"avatar,omitempty"`
-	Role         string         `gorm:"default:user;size:20" json:"role"`
-	Plan         string         `gorm:"default:free;size:20" json:"plan"`
-	Credits      int            `gorm:"default:10" json:"credits"`
-	IsActive     bool           `gorm:"default:true" json:"is_active"`
-	IsVerified   bool           `gorm:"default:false" json:"is_verified"`
-	LastLoginAt  *time.Time     `json:"last_login_at,omitempty"`
-	CreatedAt    time.Time      `json:"created_at"`
-	UpdatedAt    time.Time      `json:"updated_at"`
-	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
-	Generations  []Generation   `gorm:"foreignKey:UserID" json:"-"`
+	ID           uint   `gorm:"primaryKey" json:"id"`
+	Email        string `gorm:"index;not null;size:255" json:"email"`
+	PasswordHash string `gorm:"not null" json:"-"`
+	Name         string `gorm:"not null;size:100" json:"name"`
+	Avatar       string `gorm:"size:500" json:"avatar,omitempty"`
+	Role         string `gorm:"default:user;size:20" json:"role"`
+	Plan         string `gorm:"default:free;size:20" json:"plan"`
+	Credits      int    `gorm:"default:10" json:"credits"`
+	IsActive     bool   `gorm:"default:true" json:"is_active"`
+	IsVerified   bool   `gorm:"default:false" json:"is_verified"`
+	// PublishingBanned stops the user from making generations public.
+	PublishingBanned bool       `gorm:"default:false" json:"publishing_banned"`
+	LastLoginAt      *time.Time `json:"last_login_at,omitempty"`
+	// PasswordChangedAt is when the password was last set by its owner.
+	PasswordChangedAt *time.Time `json:"-"`
+	ReferralCode      *string    `gorm:"size:16;uniqueIndex" json:"-"`
+	// EmailConflictWith is the older account that kept the address when
+	// addresses became case-insensitive. This one keeps it too, as it
+	// was, but lookups by email leave it out.
+	EmailConflictWith *uint          `gorm:"index" json:"-"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+	DeletedAt         gorm.DeletedAt `gorm:"index" json:"-"`
+	Generations       []Generation   `gorm:"foreignKey:UserID" json:"-"`
+}
+
+// NormalizeEmail is the form addresses are stored and looked up in:
+// trimmed and lower-cased, so the letter case someone types doesn't make
+// a different account.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
 }
 
 type UserResponse struct {
-	ID          uint       `json:"id"`
-	Email       string     `json:"email"`
-	Name        string     `json:"name"`
-	Avatar      string     `json:"avatar,omitempty"`
-	Role        string     `json:"role"`
-	Plan        string     `json:"plan"`
-	Credits     int        `json:"credits"`
-	IsActive    bool       `json:"is_active"`
-	IsVerified  bool       `json:"is_verified"`
-	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
-	CreatedAt   time.Time  `json:"created_at"`
+	ID               uint       `json:"id"`
+	Email            string     `json:"email"`
+	Name             string     `json:"name"`
+	Avatar           string     `json:"avatar,omitempty"`
+	Role             string     `json:"role"`
+	Plan             string     `json:"plan"`
+	Credits          int        `json:"credits"`
+	IsActive         bool       `json:"is_active"`
+	IsVerified       bool       `json:"is_verified"`
+	PublishingBanned bool       `json:"publishing_banned,omitempty"`
+	LastLoginAt      *time.Time `json:"last_login_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
 }
 
 func (u *User) ToResponse() UserResponse {
 	return UserResponse{
-		ID:          u.ID,
-		Email:       u.Email,
-		Name:        u.Name,
-		Avatar:      u.Avatar,
-		Role:        u.Role,
-		Plan:        u.Plan,
-		Credits:     u.Credits,
-		IsActive:    u.IsActive,
-		IsVerified:  u.IsVerified,
-		LastLoginAt: u.LastLoginAt,
-		CreatedAt:   u.CreatedAt,
+		ID:               u.ID,
+		Email:            u.Email,
+		Name:             u.Name,
+		Avatar:           u.Avatar,
+		Role:             u.Role,
+		Plan:             u.Plan,
+		Credits:          u.Credits,
+		IsActive:         u.IsActive,
+		IsVerified:       u.IsVerified,
+		PublishingBanned: u.PublishingBanned,
+		LastLoginAt:      u.LastLoginAt,
+		CreatedAt:        u.CreatedAt,
 	}
 }
 
+// ProfileStats sums up a user's generations for the dashboard.
+type ProfileStats struct {
+	Generations           GenerationCounts `json:"generations"`
+	Favorites             int64            `json:"favorites"`
+	CreditsSpentThisMonth int64            `json:"credits_spent_this_month"`
+	// StorageBytes counts outputs stored by us, not provider-hosted ones.
+	StorageBytes int64 `json:"storage_bytes"`
+}
+
+type GenerationCounts struct {
+	Total    int64                      `json:"total"`
+	ByType   map[GenerationType]int64   `json:"by_type"`
+	ByStatus map[GenerationStatus]int64 `json:"by_status"`
+}
+
 type RegisterRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
-	Name     string `json:"name"`
+	Email    string `json:"email" validate:"required,email,nosqli"`
+	Password string `json:"password" validate:"required,password"`
+	Name     string `json:"name" validate:"required,min=2,max=100,noxss"`
+	// ReferralCode credits whoever shared it once the new account makes
+	// its first generation. A code that doesn't count is ignored.
+	ReferralCode string `json:"referral_code,omitempty" validate:"max=16,alphanum"`
+	CaptchaToken string `json:"captcha_token,omitempty"`
 }
 
 type LoginRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email        string `json:"email" validate:"required,email"`
+	Password     string `json:"password" validate:"required"`
+	CaptchaToken string `json:"captcha_token,omitempty"`
 }
 
 type RefreshTokenRequest struct {
@@ -70,11 +109,16 @@ type RefreshTokenRequest struct {
 }
 
 type UpdateProfileRequest struct {
-	Name   string `json:"name"`
-	Avatar string `json:"avatar"`
+	Name   string `json:"name" validate:"min=2,max=100,noxss"`
+	Avatar string `json:"avatar" validate:"max=500,noxss"`
 }
 
 type ChangePasswordRequest struct {
-	CurrentPassword string `json:"current_password"`
-	NewPassword     string `json:"new_password"`
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,password"`
+}
+
+type AdjustCreditsRequest struct {
+	Amount int    `json:"amount" validate:"required"`
+	Reason string `json:"reason" validate:"required,max=200,noxss"`
 }
@@ -0,0 +1,191 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MaxTemplateValueLength caps each value filled into a template slot.
+const MaxTemplateValueLength = 200
+
+// templateSlotPattern matches a slot in a template's base prompt:
+// {{product}} is required and {{tagline?}} may be left out.
+var templateSlotPattern = regexp.MustCompile(`\{\{\s*([a-z][a-z0-9_]{0,49})(\?)?\s*\}\}`)
+
+var emptySlotCommas = regexp.MustCompile(`\s*,(\s*,)+`)
+
+// VideoTemplate is an entry of the video template picker: a base prompt
+// with slots the user fills in, and defaults for what the request leaves
+// out. Deleted templates are kept soft-deleted so generations keep their
+// reference.
+type VideoTemplate struct {
+	ID                uint   `gorm:"primaryKey"`
+	Name              string `gorm:"uniqueIndex;not null;size:50"`
+	DisplayName       string `gorm:"not null;size:100"`
+	BasePrompt        string `gorm:"type:text;not null"`
+	DefaultModel      string `gorm:"size:50"`
+	DefaultDuration   int    `gorm:"default:0"`
+	DefaultResolution string `gorm:"size:20"`
+	NarrationExpected bool   `gorm:"not null"`
+	ThumbnailURL      string `gorm:"size:500"`
+	SortOrder         int    `gorm:"default:0"`
+	IsActive          bool   `gorm:"not null"`
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	DeletedAt         gorm.DeletedAt `gorm:"index"`
+}
+
+// TemplateSlot is a placeholder of a template's base prompt.
+type TemplateSlot struct {
+	Name     string `json:"name"`
+	Required bool   `json:"required"`
+}
+
+// Slots lists t's slots in the order they first appear. A slot used both
+// with and without "?" is required.
+func (t *VideoTemplate) Slots() []TemplateSlot {
+	slots := []TemplateSlot{}
+	seen := make(map[string]int)
+	for _, m := range templateSlotPattern.FindAllStringSubmatch(t.BasePrompt, -1) {
+		required := m[2] == ""
+		if i, ok := seen[m[1]]; ok {
+			slots[i].Required = slots[i].Required || required
+			continue
+		}
+		seen[m[1]] = len(slots)
+		slots = append(slots, TemplateSlot{Name: m[1], Required: required})
+	}
+	return slots
+}
+
+// Render fills t's slots from values. The result is put on one line with
+// its whitespace collapsed, and the commas around an optional slot left
+// empty are dropped.
+func (t *VideoTemplate) Render(values map[string]string) string {
+	rendered := templateSlotPattern.ReplaceAllStringFunc(t.BasePrompt, func(slot string) string {
+		return values[templateSlotPattern.FindStringSubmatch(slot)[1]]
+	})
+	rendered = strings.Join(strings.Fields(rendered), " ")
+	rendered = emptySlotCommas.ReplaceAllString(rendered, ",")
+	return strings.Trim(rendered, ", ")
+}
+
+// HasMalformedSlot reports whether t's base prompt has a "{{" or "}}"
+// that isn't part of a valid slot.
+func (t *VideoTemplate) HasMalformedSlot() bool {
+	rest := templateSlotPattern.ReplaceAllString(t.BasePrompt, "")
+	return strings.Contains(rest, "{{") || strings.Contains(rest, "}}")
+}
+
+// VideoTemplateResponse is what the picker shows, the base prompt
+// included so a preview can be rendered as the user types.
+type VideoTemplateResponse struct {
+	ID                uint           `json:"id"`
+	Name              string         `json:"name"`
+	DisplayName       string         `json:"display_name"`
+	BasePrompt        string         `json:"base_prompt"`
+	Slots             []TemplateSlot `json:"slots"`
+	DefaultModel      string         `json:"default_model,omitempty"`
+	DefaultDuration   int            `json:"default_duration,omitempty"`
+	DefaultResolution string         `json:"default_resolution,omitempty"`
+	NarrationExpected bool           `json:"narration_expected"`
+	ThumbnailURL      string         `json:"thumbnail_url,omitempty"`
+}
+
+func (t *VideoTemplate) ToResponse() VideoTemplateResponse {
+	return VideoTemplateResponse{
+		ID:                t.ID,
+		Name:              t.Name,
+		DisplayName:       t.DisplayName,
+		BasePrompt:        t.BasePrompt,
+		Slots:             t.Slots(),
+		DefaultModel:      t.DefaultModel,
+		DefaultDuration:   t.DefaultDuration,
+		DefaultResolution: t.DefaultResolution,
+		NarrationExpected: t.NarrationExpected,
+		ThumbnailURL:      t.ThumbnailURL,
+	}
+}
+
+type AdminVideoTemplateResponse struct {
+	VideoTemplateResponse
+	SortOrder int       `json:"sort_order"`
+	IsActive  bool      `json:"is_active"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (t *VideoTemplate) ToAdminResponse() AdminVideoTemplateResponse {
+	return AdminVideoTemplateResponse{
+		VideoTemplateResponse: t.ToResponse(),
+		SortOrder:             t.SortOrder,
+		IsActive:              t.IsActive,
+		UpdatedAt:             t.UpdatedAt,
+	}
+}
+
+// UseVideoTemplate renders t with r's template values into r's prompt,
+// followed by whatever prompt r had, and fills in the model, duration and
+// resolution r left out from t's defaults. The values are expected to
+// have been checked against t's slots.
+func (r *GenerateVideoRequest) UseVideoTemplate(t *VideoTemplate) {
+	rendered := t.Render(r.TemplateValues)
+	if r.Prompt == "" {
+		r.Prompt = rendered
+	} else {
+		r.Prompt = rendered + ", " + r.Prompt
+	}
+	if r.Model == "" {
+		r.Model = t.DefaultModel
+	}
+	if r.Duration == 0 {
+		r.Duration = t.DefaultDuration
+	}
+	if r.Resolution == "" {
+		r.Resolution = t.DefaultResolution
+	}
+}
+
+// UpsertVideoTemplateRequest creates or replaces the template named in the
+// path.
+type UpsertVideoTemplateRequest struct {
+	DisplayName       string `json:"display_name" validate:"required,max=100,noxss"`
+	BasePrompt        string `json:"base_prompt" validate:"required,max=2000,safehtml"`
+	DefaultModel      string `json:"default_model" validate:"max=50,noxss"`
+	DefaultDuration   int    `json:"default_duration" validate:"min=0,max=10"`
+	DefaultResolution string `json:"default_resolution" validate:"max=20,noxss"`
+	NarrationExpected bool   `json:"narration_expected"`
+	ThumbnailURL      string `json:"thumbnail_url" validate:"max=500,noxss"`
+	SortOrder         int    `json:"sort_order"`
+	// IsActive defaults to true; inactive templates are hidden from the
+	// picker and refused by the generate endpoint.
+	IsActive *bool `json:"is_active"`
+}
+
+// DefaultVideoTemplates are seeded, active, on first start. Later changes
+// are made by admins and are never overwritten by the seed.
+var DefaultVideoTemplates = []VideoTemplate{
+	{
+		Name:        "product-showcase",
+		DisplayName: "Product showcase",
+		BasePrompt: "Slow 360-degree orbit around {{product}} on a clean studio turntable, soft key light with a subtle rim light, " +
+			"shallow depth of field, {{setting?}}, premium commercial look",
+		DefaultModel: "video-01", DefaultDuration: 6, DefaultResolution: "768P", SortOrder: 10,
+	},
+	{
+		Name:        "cinematic-intro",
+		DisplayName: "Cinematic intro",
+		BasePrompt: "Cinematic opening shot: sweeping aerial push-in over {{scene}}, golden hour light, anamorphic lens flares, " +
+			"dramatic atmosphere, {{mood?}}, film grain",
+		DefaultModel: "video-01", DefaultDuration: 6, DefaultResolution: "768P", SortOrder: 20,
+	},
+	{
+		Name:        "talking-head",
+		DisplayName: "Talking head",
+		BasePrompt: "Medium close-up of {{presenter}} speaking directly to the camera, steady eye-level framing, " +
+			"soft natural lighting, softly blurred {{background?}} background",
+		DefaultModel: "video-01", DefaultDuration: 6, DefaultResolution: "768P", NarrationExpected: true, SortOrder: 30,
+	},
+}
@@ -0,0 +1,64 @@
+package moderation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// HTTPChecker calls an external moderation API. It POSTs
+// {"input": "<text>"} and expects {"flagged": bool, "reason": "..."} back.
+type HTTPChecker struct {
+	url    string
+	apiKey string
+	client *http.Client
+}
+
+func NewHTTPChecker(url, apiKey string) *HTTPChecker {
+	return &HTTPChecker{
+		url:    url,
+		apiKey: apiKey,
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (h *HTTPChecker) Check(ctx context.Context, field Field) (*Verdict, error) {
+	body, err := json.Marshal(map[string]string{"input": field.Text})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if h.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+h.apiKey)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("moderation API returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Flagged bool   `json:"flagged"`
+		Reason  string `json:"reason"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	if !result.Flagged {
+		return nil, nil
+	}
+	return &Verdict{Field: field.Name, Source: SourceExternal, Reason: result.Reason}, nil
+}
@@ -0,0 +1,175 @@
+package moderation
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/zesbe/lumina-ai/internal/config"
+	"github.com/zesbe/lumina-ai/internal/logger"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+const (
+	SourceBlocklist = "blocklist"
+	SourceExternal  = "external"
+)
+
+// Field is one piece of user text to check, named after its request field.
+type Field struct {
+	Name string
+	Text string
+}
+
+// Verdict explains why a request was blocked.
+type Verdict struct {
+	Field  string
+	Source string
+	RuleID uint
+	Reason string
+	// Soft is a publish check match that holds content for review
+	// instead of blocking it.
+	Soft bool
+}
+
+// Checker is an additional moderation backend consulted after the local
+// blocklist, e.g. a hosted classifier.
+type Checker interface {
+	Check(ctx context.Context, field Field) (*Verdict, error)
+}
+
+type rule struct {
+	id     uint
+	re     *regexp.Regexp
+	reason string
+}
+
+type service struct {
+	db       *gorm.DB
+	static   []rule
+	external Checker
+
+	mu    sync.RWMutex
+	rules []rule
+}
+
+var svc *service
+
+// Init loads the blocklist from MODERATION_BLOCKLIST and the
+// moderation_rules table and keeps it fresh by reloading on an interval,
+// so rules added on another instance take effect everywhere. Until Init is
+// called Check allows everything.
+func Init(db *gorm.DB, cfg *config.Config) {
+	s := &service{db: db}
+	for _, term := range strings.Split(cfg.ModerationBlocklist, ",") {
+		if term = strings.TrimSpace(term); term == "" {
+			continue
+		}
+		re, _ := CompilePattern(term, false)
+		s.static = append(s.static, rule{re: re, reason: "blocked term"})
+	}
+	if cfg.ModerationAPIURL != "" {
+		s.external = NewHTTPChecker(cfg.ModerationAPIURL, cfg.ModerationAPIKey)
+	}
+	svc = s
+
+	if err := Reload(context.Background()); err != nil {
+		logger.L().Error("failed to load moderation rules", "error", err)
+	}
+
+	if cfg.ModerationReloadInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(cfg.ModerationReloadInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				if err := Reload(context.Background()); err != nil {
+					logger.L().Warn("failed to reload moderation rules", "error", err)
+				}
+			}
+		}()
+	}
+}
+
+// Reload replaces the database-backed rules. Rules whose pattern no longer
+// compiles are skipped rather than failing the whole set.
+func Reload(ctx context.Context) error {
+	if svc == nil {
+		return nil
+	}
+
+	var records []models.ModerationRule
+	if err := svc.db.WithContext(ctx).Where("is_active = ?", true).Find(&records).Error; err != nil {
+		return err
+	}
+
+	rules := make([]rule, 0, len(records))
+	for _, r := range records {
+		re, err := CompilePattern(r.Pattern, r.IsRegex)
+		if err != nil {
+			logger.L().Warn("skipping invalid moderation rule", "rule_id", r.ID, "error", err)
+			continue
+		}
+		rules = append(rules, rule{id: r.ID, re: re, reason: r.Reason})
+	}
+
+	svc.mu.Lock()
+	svc.rules = rules
+	svc.mu.Unlock()
+	return nil
+}
+
+// Check runs the fields through the blocklist and then the external
+// checker, returning the first violation or nil. An unreachable external
+// checker is logged and treated as a pass so an outage there doesn't stop
+// all generation.
+func Check(ctx context.Context, fields ...Field) *Verdict {
+	if svc == nil {
+		return nil
+	}
+
+	svc.mu.RLock()
+	rules := append(append([]rule{}, svc.static...), svc.rules...)
+	svc.mu.RUnlock()
+
+	for _, f := range fields {
+		if f.Text == "" {
+			continue
+		}
+		for _, r := range rules {
+			if r.re.MatchString(f.Text) {
+				return &Verdict{Field: f.Name, Source: SourceBlocklist, RuleID: r.id, Reason: r.reason}
+			}
+		}
+	}
+
+	if svc.external == nil {
+		return nil
+	}
+	for _, f := range fields {
+		if f.Text == "" {
+			continue
+		}
+		verdict, err := svc.external.Check(ctx, f)
+		if err != nil {
+			logger.FromContext(ctx).Warn("external moderation check failed", "field", f.Name, "error", err)
+			return nil
+		}
+		if verdict != nil {
+			return verdict
+		}
+	}
+	return nil
+}
+
+// CompilePattern turns a rule into a case-insensitive matcher. Plain terms
+// only match whole words, so "ass" doesn't block "class".
+func CompilePattern(pattern string, isRegex bool) (*regexp.Regexp, error) {
+	if !isRegex {
+		pattern = `\b` + regexp.QuoteMeta(pattern) + `\b`
+	}
+	return regexp.Compile("(?i)" + pattern)
+}
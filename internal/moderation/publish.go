@@ -0,0 +1,198 @@
+package moderation
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/zesbe/lumina-ai/internal/logger"
+	"github.com/zesbe/lumina-ai/internal/settings"
+)
+
+// SourcePublishFilter is a match against the publish lists.
+const SourcePublishFilter = "publish_filter"
+
+// leet undoes the digit and symbol swaps used to slip words past a list.
+var leet = strings.NewReplacer(
+	"0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "8", "b", "9", "g",
+	"@", "a", "$", "s", "!", "i", "|", "i", "+", "t", "€", "e",
+)
+
+type publishRule struct {
+	lang string
+	re   *regexp.Regexp
+	hard bool
+}
+
+// publishRules caches the compiled lists, recompiled when the settings
+// change.
+var publishRules struct {
+	sync.Mutex
+	source map[string]settings.PublishFilter
+	rules  []publishRule
+}
+
+// CompilePublishEntry compiles one publish list entry: a regular
+// expression between slashes, or else a word or phrase matched whole once
+// both it and the text have been normalized.
+func CompilePublishEntry(entry string) (*regexp.Regexp, error) {
+	if len(entry) > 2 && strings.HasPrefix(entry, "/") && strings.HasSuffix(entry, "/") {
+		return regexp.Compile("(?i)" + entry[1:len(entry)-1])
+	}
+	words := strings.Fields(normalize(entry))
+	if len(words) == 0 {
+		return nil, errors.New("entry has no letters or digits")
+	}
+	for i, w := range words {
+		words[i] = regexp.QuoteMeta(w)
+	}
+	return regexp.Compile(`(?i)\b` + strings.Join(words, `\s+`) + `\b`)
+}
+
+func compilePublishRules(filters map[string]settings.PublishFilter) []publishRule {
+	var rules []publishRule
+	for lang, f := range filters {
+		for _, list := range []struct {
+			entries []string
+			hard    bool
+		}{{f.Hard, true}, {f.Soft, false}} {
+			for _, entry := range list.entries {
+				re, err := CompilePublishEntry(entry)
+				if err != nil {
+					logger.L().Warn("skipping invalid publish filter entry", "lang", lang, "entry", entry, "error", err)
+					continue
+				}
+				rules = append(rules, publishRule{lang: lang, re: re, hard: list.hard})
+			}
+		}
+	}
+	return rules
+}
+
+func currentPublishRules() []publishRule {
+	filters := settings.Current().PublishFilters
+	publishRules.Lock()
+	defer publishRules.Unlock()
+	if publishRules.source == nil || !reflect.DeepEqual(publishRules.source, filters) {
+		publishRules.source = filters
+		publishRules.rules = compilePublishRules(filters)
+	}
+	return publishRules.rules
+}
+
+// normalize lowercases text, undoes leetspeak and squeezes stretched
+// letters, and puts a space wherever there is neither a letter nor a
+// digit.
+func normalize(text string) string {
+	text = leet.Replace(strings.ToLower(text))
+	return strings.Join(strings.FieldsFunc(squeeze(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// squeeze writes a letter repeated three or more times, as in "shiiit",
+// once. Doubled letters are left alone since plenty of words have them.
+func squeeze(text string) string {
+	runes := []rune(text)
+	var b strings.Builder
+	for i := 0; i < len(runes); {
+		j := i + 1
+		for j < len(runes) && runes[j] == runes[i] {
+			j++
+		}
+		if j-i >= 3 && unicode.IsLetter(runes[i]) {
+			b.WriteRune(runes[i])
+		} else {
+			b.WriteString(string(runes[i:j]))
+		}
+		i = j
+	}
+	return b.String()
+}
+
+// spelledOut joins runs of single letters, so "f u c k" and "f.u.c.k",
+// which normalize leaves as separate letters, read as the word.
+func spelledOut(normalized string) string {
+	words := strings.Fields(normalized)
+	out := make([]string, 0, len(words))
+	run := ""
+	for _, w := range words {
+		if len([]rune(w)) == 1 {
+			run += w
+			continue
+		}
+		if run != "" {
+			out = append(out, run)
+			run = ""
+		}
+		out = append(out, w)
+	}
+	if run != "" {
+		out = append(out, run)
+	}
+	return strings.Join(out, " ")
+}
+
+// CheckPublish runs text about to go on Explore through the publish
+// lists of settings.PublishFilters, then the external checker if one is
+// configured. Each field is matched as written and normalized, so
+// obfuscated spellings match too. It returns a hard match if there is
+// one, else the first soft match, else nil. A flag from the external
+// checker is soft: it is a judgement call an admin should confirm. As in
+// Check, an unreachable external checker is logged and passes.
+func CheckPublish(ctx context.Context, fields ...Field) *Verdict {
+	var soft *Verdict
+	rules := currentPublishRules()
+	for _, f := range fields {
+		if f.Text == "" {
+			continue
+		}
+		normalized := normalize(f.Text)
+		variants := []string{f.Text, normalized, spelledOut(normalized)}
+		for _, r := range rules {
+			if !r.hard && soft != nil {
+				continue
+			}
+			if !matchesAny(r.re, variants) {
+				continue
+			}
+			verdict := &Verdict{Field: f.Name, Source: SourcePublishFilter, Reason: r.lang + " publish list", Soft: !r.hard}
+			if r.hard {
+				return verdict
+			}
+			soft = verdict
+		}
+	}
+	if soft != nil || svc == nil || svc.external == nil {
+		return soft
+	}
+
+	for _, f := range fields {
+		if f.Text == "" {
+			continue
+		}
+		verdict, err := svc.external.Check(ctx, f)
+		if err != nil {
+			logger.FromContext(ctx).Warn("external moderation check failed", "field", f.Name, "error", err)
+			return nil
+		}
+		if verdict != nil {
+			verdict.Soft = true
+			return verdict
+		}
+	}
+	return nil
+}
+
+func matchesAny(re *regexp.Regexp, texts []string) bool {
+	for _, text := range texts {
+		if re.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,163 @@
+package moderation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/zesbe/lumina-ai/internal/settings"
+)
+
+// withPublishFilters makes filters the publish lists for the rest of the
+// test.
+func withPublishFilters(t *testing.T, filters map[string]settings.PublishFilter) {
+	t.Helper()
+	previous := settings.Current()
+	s := previous.Clone()
+	s.PublishFilters = filters
+	if err := settings.Set(s); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { settings.Set(previous) })
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Hello, World.", "hello world"},
+		{"$h!t", "shit"},
+		{"5H!7", "shit"},
+		{"sh1t", "shit"},
+		{"shiiiit", "shit"},
+		{"SHIIIIIT", "shit"},
+		{"s.h.i.t", "s h i t"},
+		// Doubled letters stay; digits that aren't leetspeak are kept.
+		{"book keeper", "book keeper"},
+		{"track 226", "track 226"},
+		{"  spaced\tout\n", "spaced out"},
+	}
+	for _, tt := range tests {
+		if got := normalize(tt.text); got != tt.want {
+			t.Errorf("normalize(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestSpelledOut(t *testing.T) {
+	tests := []struct {
+		normalized string
+		want       string
+	}{
+		{"s h i t", "shit"},
+		{"what the f u c k is this", "what the fuck is this"},
+		{"a b c", "abc"},
+		{"plain words only", "plain words only"},
+		{"x marks y", "x marks y"},
+	}
+	for _, tt := range tests {
+		if got := spelledOut(tt.normalized); got != tt.want {
+			t.Errorf("spelledOut(%q) = %q, want %q", tt.normalized, got, tt.want)
+		}
+	}
+}
+
+func TestCompilePublishEntry(t *testing.T) {
+	for _, entry := range []string{"", "...", "/(/"} {
+		if _, err := CompilePublishEntry(entry); err == nil {
+			t.Errorf("CompilePublishEntry(%q) succeeded", entry)
+		}
+	}
+	re, err := CompilePublishEntry("/b[a4]d\\s*word/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !re.MatchString("a B4D  WORD here") || re.MatchString("a bid word") {
+		t.Errorf("regexp entry %s matches the wrong text", re)
+	}
+	re, err = CompilePublishEntry("Bad  Phrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !re.MatchString("a bad phrase indeed") || re.MatchString("a badphrase") {
+		t.Errorf("phrase entry %s matches the wrong text", re)
+	}
+}
+
+func TestCheckPublishObfuscation(t *testing.T) {
+	withPublishFilters(t, map[string]settings.PublishFilter{
+		"en": {Hard: []string{"shit", "fuck", "bad phrase"}, Soft: []string{"damn"}},
+		"id": {Hard: []string{"anjing"}, Soft: []string{"/bodoh+/"}},
+	})
+
+	tests := []struct {
+		text string
+		want string // "hard", "soft" or "" for no match
+	}{
+		{"shit", "hard"},
+		{"SHIT happens", "hard"},
+		{"$h!t", "hard"},
+		{"5h!7", "hard"},
+		{"sh1t", "hard"},
+		{"shiiiit", "hard"},
+		{"s.h.i.t", "hard"},
+		{"s h i t", "hard"},
+		{"s-h-i-t storm", "hard"},
+		{"what the f u c k", "hard"},
+		{"fvck", ""},
+		{"a BAD   phrase", "hard"},
+		{"b@d phr@$e", "hard"},
+		{"dasar anj1ng", "hard"},
+		{"damn it", "soft"},
+		{"d4mn", "soft"},
+		{"bodohhh", "soft"},
+		// Near misses stay clean.
+		{"shitake mushrooms", ""},
+		{"a classic", ""},
+		{"the assassin", ""},
+		{"amsterdam night", ""},
+		{"bad phrasing", ""},
+		{"Scunthorpe", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			verdict := CheckPublish(context.Background(), Field{Name: "title", Text: tt.text})
+			got := ""
+			switch {
+			case verdict == nil:
+			case verdict.Soft:
+				got = "soft"
+			default:
+				got = "hard"
+			}
+			if got != tt.want {
+				t.Errorf("verdict %+v (%s), want %q", verdict, got, tt.want)
+			}
+			if verdict != nil && (verdict.Field != "title" || verdict.Source != SourcePublishFilter) {
+				t.Errorf("verdict %+v, want the title field and the publish filter as source", verdict)
+			}
+		})
+	}
+}
+
+func TestCheckPublishHardWinsOverSoft(t *testing.T) {
+	withPublishFilters(t, map[string]settings.PublishFilter{
+		"en": {Hard: []string{"shit"}, Soft: []string{"damn"}},
+	})
+	verdict := CheckPublish(context.Background(),
+		Field{Name: "title", Text: "damn"},
+		Field{Name: "style", Text: "lo-fi"},
+		Field{Name: "lyrics", Text: "oh sh!t"},
+	)
+	if verdict == nil || verdict.Soft || verdict.Field != "lyrics" || verdict.Reason != "en publish list" {
+		t.Errorf("verdict %+v, want a hard match on the lyrics", verdict)
+	}
+
+	// Changing the lists applies on the next check.
+	withPublishFilters(t, map[string]settings.PublishFilter{"en": {Soft: []string{"damn"}}})
+	verdict = CheckPublish(context.Background(), Field{Name: "title", Text: "damn"}, Field{Name: "lyrics", Text: "oh sh!t"})
+	if verdict == nil || !verdict.Soft || verdict.Field != "title" {
+		t.Errorf("verdict %+v, want a soft match on the title", verdict)
+	}
+}
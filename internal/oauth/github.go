@@ -0,0 +1,131 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	githubAuthURL  = "https://github.com/login/oauth/authorize"
+	githubTokenURL = "https://github.com/login/oauth/access_token"
+	githubAPIURL   = "https://api.github.com"
+)
+
+// GitHub signs users in with their GitHub account. The email is the
+// account's primary address from /user/emails, which also covers accounts
+// that keep their email private on their profile.
+type GitHub struct {
+	clientID     string
+	clientSecret string
+	redirectURL  string
+
+	authURL, tokenURL, apiURL string
+}
+
+func NewGitHub(clientID, clientSecret, redirectURL string) *GitHub {
+	return &GitHub{
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		redirectURL:  redirectURL,
+		authURL:      githubAuthURL,
+		tokenURL:     githubTokenURL,
+		apiURL:       githubAPIURL,
+	}
+}
+
+func (g *GitHub) Name() string {
+	return "github"
+}
+
+func (g *GitHub) Title() string {
+	return "GitHub"
+}
+
+func (g *GitHub) Configured() bool {
+	return g.clientID != "" && g.clientSecret != "" && g.redirectURL != ""
+}
+
+func (g *GitHub) AuthURL(state string) string {
+	q := url.Values{
+		"client_id":    {g.clientID},
+		"redirect_uri": {g.redirectURL},
+		"scope":        {"read:user user:email"},
+		"state":        {state},
+		"allow_signup": {"true"},
+	}
+	return g.authURL + "?" + q.Encode()
+}
+
+func (g *GitHub) Exchange(ctx context.Context, code string) (*Identity, error) {
+	// GitHub reports a bad code as a 200 with an error field.
+	var token struct {
+		AccessToken      string `json:"access_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := exchangeCode(ctx, g.tokenURL, url.Values{
+		"code":          {code},
+		"client_id":     {g.clientID},
+		"client_secret": {g.clientSecret},
+		"redirect_uri":  {g.redirectURL},
+	}, &token); err != nil {
+		return nil, err
+	}
+	if token.Error != "" || token.AccessToken == "" {
+		return nil, fmt.Errorf("%w: %s %s", ErrExchange, token.Error, token.ErrorDescription)
+	}
+
+	var user struct {
+		ID        int64  `json:"id"`
+		Login     string `json:"login"`
+		Name      string `json:"name"`
+		AvatarURL string `json:"avatar_url"`
+	}
+	if err := g.get(ctx, token.AccessToken, "/user", &user); err != nil {
+		return nil, err
+	}
+	if user.ID == 0 {
+		return nil, fmt.Errorf("%w: no user id in the answer", ErrExchange)
+	}
+
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := g.get(ctx, token.AccessToken, "/user/emails", &emails); err != nil {
+		return nil, err
+	}
+
+	identity := &Identity{
+		Provider: g.Name(),
+		Subject:  strconv.FormatInt(user.ID, 10),
+		Name:     user.Name,
+		Avatar:   user.AvatarURL,
+	}
+	if identity.Name == "" {
+		identity.Name = user.Login
+	}
+	for _, e := range emails {
+		if e.Primary {
+			identity.Email, identity.EmailVerified = e.Email, e.Verified
+			break
+		}
+	}
+	return identity, nil
+}
+
+// get calls the GitHub API with the user's access token.
+func (g *GitHub) get(ctx context.Context, accessToken, path string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, g.apiURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	return doJSON(req, out)
+}
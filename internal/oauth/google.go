@@ -0,0 +1,190 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	googleAuthURL  = "https://accounts.google.com/o/oauth2/v2/auth"
+	googleTokenURL = "https://oauth2.googleapis.com/token"
+	googleCertsURL = "https://www.googleapis.com/oauth2/v3/certs"
+
+	// googleKeysTTL is how long Google's signing keys are reused. They
+	// rotate over weeks; an unknown key ID fetches them sooner.
+	googleKeysTTL = time.Hour
+	// googleKeysMinRefresh stops tokens with made-up key IDs from making
+	// every callback fetch the keys.
+	googleKeysMinRefresh = time.Minute
+)
+
+// googleIssuers are the iss values Google signs ID tokens with.
+var googleIssuers = []string{"accounts.google.com", "https://accounts.google.com"}
+
+// Google signs users in with their Google account. The identity comes
+// from the ID token of the code exchange, checked against Google's
+// published keys, the client ID and the issuer.
+type Google struct {
+	clientID     string
+	clientSecret string
+	redirectURL  string
+
+	authURL, tokenURL, certsURL string
+	keys                        *keySet
+}
+
+func NewGoogle(clientID, clientSecret, redirectURL string) *Google {
+	return &Google{
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		redirectURL:  redirectURL,
+		authURL:      googleAuthURL,
+		tokenURL:     googleTokenURL,
+		certsURL:     googleCertsURL,
+		keys:         &keySet{},
+	}
+}
+
+func (g *Google) Name() string {
+	return "google"
+}
+
+func (g *Google) Title() string {
+	return "Google"
+}
+
+func (g *Google) Configured() bool {
+	return g.clientID != "" && g.clientSecret != "" && g.redirectURL != ""
+}
+
+func (g *Google) AuthURL(state string) string {
+	q := url.Values{
+		"client_id":     {g.clientID},
+		"redirect_uri":  {g.redirectURL},
+		"response_type": {"code"},
+		"scope":         {"openid email profile"},
+		"state":         {state},
+		"prompt":        {"select_account"},
+	}
+	return g.authURL + "?" + q.Encode()
+}
+
+type googleClaims struct {
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	Picture       string `json:"picture"`
+	jwt.RegisteredClaims
+}
+
+func (g *Google) Exchange(ctx context.Context, code string) (*Identity, error) {
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := exchangeCode(ctx, g.tokenURL, url.Values{
+		"code":          {code},
+		"client_id":     {g.clientID},
+		"client_secret": {g.clientSecret},
+		"redirect_uri":  {g.redirectURL},
+	}, &token); err != nil {
+		return nil, err
+	}
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("%w: no id_token in the answer", ErrExchange)
+	}
+
+	var claims googleClaims
+	if _, err := jwt.ParseWithClaims(token.IDToken, &claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return g.keys.get(ctx, g.certsURL, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithAudience(g.clientID),
+		jwt.WithExpirationRequired(),
+	); err != nil {
+		return nil, fmt.Errorf("%w: id token: %v", ErrExchange, err)
+	}
+	if !slices.Contains(googleIssuers, claims.Issuer) || claims.Subject == "" {
+		return nil, fmt.Errorf("%w: id token issuer %q", ErrExchange, claims.Issuer)
+	}
+
+	return &Identity{
+		Provider:      g.Name(),
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Name:          claims.Name,
+		Avatar:        claims.Picture,
+	}, nil
+}
+
+// keySet caches a provider's JWKS.
+type keySet struct {
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+func (k *keySet) get(ctx context.Context, certsURL, kid string) (*rsa.PublicKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	key, ok := k.keys[kid]
+	stale := time.Since(k.fetchedAt) > googleKeysTTL
+	if ok && !stale {
+		return key, nil
+	}
+	if stale || time.Since(k.fetchedAt) > googleKeysMinRefresh {
+		if err := k.fetch(ctx, certsURL); err != nil {
+			return nil, err
+		}
+		key, ok = k.keys[kid]
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+func (k *keySet) fetch(ctx context.Context, certsURL string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, certsURL, nil)
+	if err != nil {
+		return err
+	}
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := doJSON(req, &set); err != nil {
+		return err
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Kty != "RSA" {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(jwk.N)
+		e, errE := base64.RawURLEncoding.DecodeString(jwk.E)
+		if errN != nil || errE != nil {
+			continue
+		}
+		keys[jwk.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	k.keys, k.fetchedAt = keys, time.Now()
+	return nil
+}
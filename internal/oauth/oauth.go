@@ -0,0 +1,175 @@
+// Package oauth signs users in with third-party accounts. Each provider
+// builds its consent URL and turns the code it redirects back with into a
+// verified Identity; the handlers share everything else: the state
+// parameter, finding or creating the user and issuing tokens.
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zesbe/lumina-ai/internal/cache"
+)
+
+// StateTTL is how long a consent URL can be used.
+const StateTTL = 10 * time.Minute
+
+var (
+	// ErrInvalidState is a state value that was never issued, was issued
+	// for another provider, has expired or was already used.
+	ErrInvalidState = errors.New("invalid oauth state")
+	// ErrExchange is a code the provider wouldn't accept or an answer
+	// that didn't verify.
+	ErrExchange = errors.New("oauth exchange failed")
+)
+
+// Provider is one sign-in provider.
+type Provider interface {
+	// Name is the provider as it appears in routes and linked identities.
+	Name() string
+	// Title is the provider as users know it, for messages.
+	Title() string
+	// Configured reports whether the client credentials are set.
+	Configured() bool
+	// AuthURL is where to send the user to consent.
+	AuthURL(state string) string
+	// Exchange trades the code for the user's identity.
+	Exchange(ctx context.Context, code string) (*Identity, error)
+}
+
+// Identity is who the provider says the user is.
+type Identity struct {
+	Provider string
+	Subject  string
+	Email    string
+	// EmailVerified is the provider vouching for Email. Without it the
+	// address must not be matched against existing accounts.
+	EmailVerified bool
+	Name          string
+	Avatar        string
+}
+
+// httpClient is shared by the providers.
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// NewState issues a single-use state value for provider. It is kept in
+// Redis, or in this instance's memory when Redis isn't configured, in
+// which case the callback must reach the same instance.
+func NewState(provider string) (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	state := base64.RawURLEncoding.EncodeToString(b)
+
+	if cache.Cache != nil {
+		return state, cache.Cache.Set(stateKey(state), provider, StateTTL)
+	}
+	localStates.put(state, provider)
+	return state, nil
+}
+
+// ConsumeState checks that state was issued for provider and hasn't been
+// used, and uses it up.
+func ConsumeState(provider, state string) error {
+	if state == "" {
+		return ErrInvalidState
+	}
+
+	var issuedFor string
+	if cache.Cache != nil {
+		if err := cache.Cache.Take(stateKey(state), &issuedFor); err != nil {
+			return ErrInvalidState
+		}
+	} else {
+		issuedFor = localStates.take(state)
+	}
+	if issuedFor != provider {
+		return ErrInvalidState
+	}
+	return nil
+}
+
+func stateKey(state string) string {
+	return "oauth_state:" + state
+}
+
+type memoryStates struct {
+	mu     sync.Mutex
+	states map[string]memoryState
+}
+
+type memoryState struct {
+	provider string
+	expires  time.Time
+}
+
+var localStates = &memoryStates{states: map[string]memoryState{}}
+
+func (m *memoryStates) put(state, provider string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for k, v := range m.states {
+		if now.After(v.expires) {
+			delete(m.states, k)
+		}
+	}
+	m.states[state] = memoryState{provider: provider, expires: now.Add(StateTTL)}
+}
+
+func (m *memoryStates) take(state string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.states[state]
+	delete(m.states, state)
+	if !ok || time.Now().After(s.expires) {
+		return ""
+	}
+	return s.provider
+}
+
+// exchangeCode runs the standard authorization-code grant against
+// tokenURL and decodes the JSON answer into out.
+func exchangeCode(ctx context.Context, tokenURL string, form url.Values, out interface{}) error {
+	form.Set("grant_type", "authorization_code")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	return doJSON(req, out)
+}
+
+// doJSON sends req and decodes a 2xx JSON answer into out. Anything else
+// is ErrExchange with the status and the start of the body.
+func doJSON(req *http.Request, out interface{}) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%w: %s returned %d: %.200s", ErrExchange, req.URL.Host, resp.StatusCode, body)
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("%w: %v", ErrExchange, err)
+	}
+	return nil
+}
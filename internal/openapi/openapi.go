@@ -0,0 +1,301 @@
+// Package openapi describes the API as an OpenAPI 3 document. Operations
+// are listed by hand in Operations; request and response schemas are
+// derived from the Go types the handlers use, so field names and
+// validation rules can't drift from the code.
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/zesbe/lumina-ai/internal/version"
+)
+
+// undocumentedPrefixes are served but not part of the API: static files,
+// the docs themselves and profiling.
+var undocumentedPrefixes = []string{"/uploads", "/docs", "/debug/pprof"}
+
+const description = `Authenticate with the access token from login, either as ` + "`Authorization: Bearer <token>`" + ` or, for browsers, the access_token cookie. Cookie sessions must echo the CSRF token from /api/v1/auth/csrf-token in X-CSRF-Token on requests that change state.
+
+Programs on the Pro and Enterprise plans can use an API key from /api/v1/api-keys instead, as ` + "`Authorization: Bearer lum_...`" + `. A read key can make GET requests; a generate key can also start and manage generations. A request outside the key's scopes is a 403 INSUFFICIENT_SCOPE. Account and admin routes need a login and answer a key with 403 API_KEY_FORBIDDEN. Each key is also limited to API_KEY_RATE_LIMIT requests per minute.
+
+Every route counts toward the global rate limit: rate_limit_requests per rate_limit_window_seconds (runtime settings, RATE_LIMIT_REQUESTS and RATE_LIMIT_WINDOW at boot), per user once logged in and per IP before. Responses carry X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset; a 429 also carries Retry-After. Routes with limits of their own note them under x-rate-limit.
+
+JSON request bodies are decoded strictly: a field the operation doesn't define, a value of the wrong type or anything but a single object is a 400 VALIDATION_FAILED naming the field. Send ` + "`X-Strict: false`" + ` to decode a request leniently while a client is being fixed.
+
+Paged lists return a pagination block and a Link header with first, prev, next and last URLs that keep every other query parameter.
+
+Media URLs (output_url, thumbnail_url) are absolute. Files stored by the API are under its public base URL, or the scheme and host the request came in on when none is configured; provider-hosted files keep their own URLs.
+
+Every error carries a stable code (VALIDATION_FAILED, INSUFFICIENT_CREDITS, NOT_FOUND, RATE_LIMITED, ...; see the Error schema), a message localized by Accept-Language and the request ID. Validation failures list each failed rule under details. By default errors have the v1 shape, ` + "`{\"error\": \"Not Found\", \"message\": ..., \"code\": ..., \"request_id\": ...}`" + `; send ` + "`Accept-Version: 2`" + ` for ` + "`{\"error\": {\"code\", \"message\", \"details\", \"request_id\"}}`" + `, which will become the default.`
+
+var (
+	buildOnce sync.Once
+	document  map[string]interface{}
+)
+
+// Document returns the OpenAPI document. It is built once.
+func Document() map[string]interface{} {
+	buildOnce.Do(func() {
+		document = build()
+	})
+	return document
+}
+
+func build() map[string]interface{} {
+	cs := components{}
+	paths := map[string]Schema{}
+	for _, op := range Operations {
+		path := specPath(op.Path)
+		if paths[path] == nil {
+			paths[path] = Schema{}
+		}
+		paths[path][strings.ToLower(op.Method)] = cs.operation(op)
+	}
+
+	schemas := Schema{}
+	for name, s := range cs {
+		schemas[name] = s
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": Schema{
+			"title":       "Lumina AI API",
+			"version":     version.Version,
+			"description": description,
+		},
+		"paths": paths,
+		"components": Schema{
+			"schemas": schemas,
+			"securitySchemes": Schema{
+				"bearerAuth": Schema{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+				"apiKeyAuth": Schema{"type": "http", "scheme": "bearer", "bearerFormat": "lum_ API key"},
+				"cookieAuth": Schema{"type": "apiKey", "in": "cookie", "name": "access_token"},
+			},
+		},
+	}
+}
+
+func (cs components) operation(op Operation) Schema {
+	out := Schema{
+		"tags":    []string{op.Tag},
+		"summary": op.Summary,
+	}
+	desc := op.Description
+	if op.Access == Admin {
+		desc = strings.TrimSpace(desc + " Requires the admin role.")
+	}
+	if desc != "" {
+		out["description"] = desc
+	}
+	if op.RateLimit != "" {
+		out["x-rate-limit"] = op.RateLimit
+	}
+	switch {
+	case op.Access == User && !op.LoginOnly:
+		out["security"] = []Schema{{"bearerAuth": []string{}}, {"cookieAuth": []string{}}, {"apiKeyAuth": []string{}}}
+	case op.Access != Public:
+		out["security"] = []Schema{{"bearerAuth": []string{}}, {"cookieAuth": []string{}}}
+	}
+
+	params := pathParams(op.Path)
+	params = append(params, cs.queryParams(op.Query)...)
+	if len(params) > 0 {
+		out["parameters"] = params
+	}
+	if op.Body != nil {
+		out["requestBody"] = Schema{
+			"required": true,
+			"content":  Schema{fiber.MIMEApplicationJSON: Schema{"schema": cs.of(op.Body)}},
+		}
+	}
+
+	status := op.Status
+	if status == 0 {
+		status = fiber.StatusOK
+	}
+	success := Schema{"description": http.StatusText(status)}
+	switch {
+	case op.ContentType != "":
+		success["content"] = Schema{op.ContentType: Schema{"schema": Schema{"type": "string"}}}
+	case op.Response != nil:
+		success["content"] = Schema{fiber.MIMEApplicationJSON: Schema{"schema": cs.of(op.Response)}}
+	}
+
+	responses := Schema{strconv.Itoa(status): success}
+	errorSchema := Schema{"oneOf": []Schema{cs.of(Error{}), cs.of(ErrorEnvelope{})}}
+	errorResponse := func(code int) {
+		responses[strconv.Itoa(code)] = Schema{
+			"description": http.StatusText(code),
+			"content":     Schema{fiber.MIMEApplicationJSON: Schema{"schema": errorSchema}},
+		}
+	}
+	if op.Body != nil || op.Query != nil || len(pathParams(op.Path)) > 0 {
+		errorResponse(fiber.StatusBadRequest)
+	}
+	if op.Access != Public {
+		errorResponse(fiber.StatusUnauthorized)
+		errorResponse(fiber.StatusForbidden)
+	}
+	if strings.Contains(op.Path, "/:") {
+		errorResponse(fiber.StatusNotFound)
+	}
+	errorResponse(fiber.StatusTooManyRequests)
+	errorResponse(fiber.StatusInternalServerError)
+	out["responses"] = responses
+	return out
+}
+
+// of is the schema of v: v itself when it is a Schema, otherwise derived
+// from its type.
+func (cs components) of(v interface{}) Schema {
+	if s, ok := v.(Schema); ok {
+		return s
+	}
+	return cs.schemaOf(reflect.TypeOf(v))
+}
+
+func pathParams(path string) []Schema {
+	var params []Schema
+	for _, segment := range strings.Split(path, "/") {
+		if !strings.HasPrefix(segment, ":") {
+			continue
+		}
+		name := segment[1:]
+		schema := Schema{"type": "string"}
+		if name == "id" || strings.HasSuffix(name, "ID") || strings.HasSuffix(name, "Id") {
+			schema = Schema{"type": "integer"}
+		}
+		params = append(params, Schema{"name": name, "in": "path", "required": true, "schema": schema})
+	}
+	return params
+}
+
+// queryParams lists a []Param, or the query-tagged fields of a struct.
+func (cs components) queryParams(query interface{}) []Schema {
+	var params []Schema
+	switch q := query.(type) {
+	case nil:
+	case []Param:
+		for _, p := range q {
+			params = append(params, Schema{
+				"name":        p.Name,
+				"in":          "query",
+				"description": p.Description,
+				"schema":      Schema{"type": p.Type},
+			})
+		}
+	default:
+		params = cs.queryFields(reflect.TypeOf(q))
+	}
+	return params
+}
+
+func (cs components) queryFields(t reflect.Type) []Schema {
+	var params []Schema
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			params = append(params, cs.queryFields(sf.Type)...)
+			continue
+		}
+		name := sf.Tag.Get("query")
+		if name == "" || name == "-" {
+			continue
+		}
+		schema := cs.schemaOf(sf.Type)
+		rules, _ := constraints(sf)
+		for k, v := range rules {
+			schema[k] = v
+		}
+		params = append(params, Schema{"name": name, "in": "query", "schema": schema})
+	}
+	return params
+}
+
+// specPath turns a Fiber path into an OpenAPI one: /generations/:id
+// becomes /generations/{id}.
+func specPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// routePath normalizes a registered route path to the form used in
+// Operations: no duplicate or trailing slashes.
+func routePath(path string) string {
+	for strings.Contains(path, "//") {
+		path = strings.ReplaceAll(path, "//", "/")
+	}
+	if len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
+	return path
+}
+
+// Undocumented lists the routes, as "METHOD /path", that have no entry in
+// Operations. Pass it app.GetRoutes(true) once every route is registered.
+func Undocumented(routes []fiber.Route) []string {
+	documented := make(map[string]bool, len(Operations))
+	for _, op := range Operations {
+		documented[op.Method+" "+op.Path] = true
+	}
+
+	seen := map[string]bool{}
+	var missing []string
+	for _, r := range routes {
+		// Fiber adds a HEAD route for every GET.
+		if r.Method == fiber.MethodHead {
+			continue
+		}
+		path := routePath(r.Path)
+		if ignored(path) {
+			continue
+		}
+		key := r.Method + " " + path
+		if !documented[key] && !seen[key] {
+			seen[key] = true
+			missing = append(missing, key)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// Unserved lists the operations, as "METHOD /path", that no route serves:
+// documentation left behind when a route was removed or renamed.
+func Unserved(routes []fiber.Route) []string {
+	served := make(map[string]bool, len(routes))
+	for _, r := range routes {
+		served[r.Method+" "+routePath(r.Path)] = true
+	}
+
+	var stale []string
+	for _, op := range Operations {
+		if key := op.Method + " " + op.Path; !served[key] {
+			stale = append(stale, key)
+		}
+	}
+	sort.Strings(stale)
+	return stale
+}
+
+func ignored(path string) bool {
+	for _, prefix := range undocumentedPrefixes {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") || strings.HasPrefix(path, prefix+"*") {
+			return true
+		}
+	}
+	return false
+}
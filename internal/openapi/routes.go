@@ -0,0 +1,382 @@
+package openapi
+
+import (
+	"github.com/zesbe/lumina-ai/internal/auth"
+	"github.com/zesbe/lumina-ai/internal/health"
+	"github.com/zesbe/lumina-ai/internal/models"
+	"github.com/zesbe/lumina-ai/internal/settings"
+	"github.com/zesbe/lumina-ai/internal/version"
+)
+
+// Access is who may call an operation.
+type Access int
+
+const (
+	Public Access = iota
+	// User needs an access token.
+	User
+	// Admin needs an access token with the admin role.
+	Admin
+)
+
+// Param is a query parameter.
+type Param struct {
+	Name        string
+	Type        string
+	Description string
+}
+
+// Operation documents one route. Path is written the way it is
+// registered with Fiber, e.g. /api/v1/generations/:id.
+type Operation struct {
+	Method      string
+	Path        string
+	Tag         string
+	Summary     string
+	Description string
+	Access      Access
+	// LoginOnly marks a User operation that refuses API keys. Admin
+	// operations always do.
+	LoginOnly bool
+	// Query is a list of Params or a struct with query tags.
+	Query interface{}
+	Body  interface{}
+	// Status is the success status, 200 unless set.
+	Status   int
+	Response interface{}
+	// ContentType is the success body's type when it isn't JSON.
+	ContentType string
+	// RateLimit notes limits beyond the global one every route counts
+	// toward.
+	RateLimit string
+}
+
+func str(name, description string) Param {
+	return Param{Name: name, Type: "string", Description: description}
+}
+
+func integer(name, description string) Param {
+	return Param{Name: name, Type: "integer", Description: description}
+}
+
+var (
+	pageParams = []Param{
+		integer("page", "Page number, from 1."),
+		integer("limit", "Page size."),
+	}
+	dateRangeParams = []Param{
+		str("from", "Start of the range, RFC 3339 or YYYY-MM-DD."),
+		str("to", "End of the range, RFC 3339 or YYYY-MM-DD."),
+	}
+	oauthCallbackParams = []Param{
+		str("code", "Authorization code from the provider's redirect."),
+		str("state", "State from the provider's redirect; single use."),
+		str("error", "Set by the provider when the user declined."),
+	}
+	auditParams = append(append([]Param{
+		str("actor", "Actor user ID."),
+		str("action", "Audit action, e.g. login."),
+		str("target_type", "Target type, e.g. user."),
+		str("target_id", "Target ID."),
+		str("format", "json (default) or csv."),
+	}, dateRangeParams...), pageParams...)
+)
+
+const fieldsDescription = "fields is a comma-separated list of fields to return per item, e.g. id,title,status,thumbnail_url,output_url,created_at; view=compact is a preset. Unknown fields, and any query value that doesn't parse or is out of range, are a 400."
+
+const generateLimit = "Counts toward the daily generation limit of the caller's plan (the daily_generation_limits setting)."
+
+const generateDuplicate = " The same request sent again while the first is pending or processing, within DUPLICATE_GENERATION_WINDOW (5 minutes by default), answers 200 with that generation and duplicate_of its id instead of starting another; force: true starts another anyway."
+
+const generateUnverified = " An account whose email isn't verified yet gets a 403 EMAIL_NOT_VERIFIED; see /auth/verify-email."
+
+// Operations is every route the API serves. A route without an entry
+// here fails TestRoutesDocumented in internal/app; see Undocumented.
+var Operations = []Operation{
+	// Health
+	{Method: "GET", Path: "/health", Tag: "health", Summary: "Liveness with version and maintenance state", Response: HealthStatus{}},
+	{Method: "GET", Path: "/health/deep", Tag: "health", Summary: "Database round trip and pool saturation", Description: "503 when the database is unreachable.", Response: Schema{"type": "object"}},
+	{Method: "GET", Path: "/health/live", Tag: "health", Summary: "Liveness probe", Response: LiveStatus{}},
+	{Method: "GET", Path: "/health/ready", Tag: "health", Summary: "Readiness probe with a dependency breakdown", Description: "503 when a required dependency is down.", Response: health.Report{}},
+
+	// Auth
+	{Method: "GET", Path: "/.well-known/jwks.json", Tag: "auth", Summary: "Public keys tokens are signed with",
+		Description: "The current signing key and the previous ones listed in JWT_PREVIOUS_PUBLIC_KEYS, with RFC 7638 thumbprints as kid. Empty while JWT_ALGORITHM is HS256.",
+		Response:    auth.JWKSet{}},
+	{Method: "POST", Path: "/api/v1/auth/register", Tag: "auth", Summary: "Create an account", Body: models.RegisterRequest{}, Status: 201, Response: AuthResponse{},
+		Description: "A referral_code that doesn't count (unknown, inactive or the same mailbox) is ignored. With CAPTCHA_SECRET set, captcha_token is required unless CAPTCHA_REGISTER is false; without a good one the answer is 403 CAPTCHA_REQUIRED. A link to verify the email is mailed to it.",
+		RateLimit:   "5 requests per RATE_LIMIT_WINDOW per IP."},
+	{Method: "POST", Path: "/api/v1/auth/login", Tag: "auth", Summary: "Log in with email and password", Body: models.LoginRequest{}, Response: AuthResponse{},
+		Description: "Repeated wrong passwords lock the account for a while; a locked account gets the same 401 as a wrong password. With CAPTCHA_SECRET set, a failed login answers with captcha_required, and the next ones from that IP or for that email need a captcha_token (403 CAPTCHA_REQUIRED without a good one).",
+		RateLimit:   "10 requests per RATE_LIMIT_WINDOW per IP."},
+	{Method: "POST", Path: "/api/v1/auth/refresh", Tag: "auth", Summary: "Exchange a refresh token for a new token pair",
+		Description: "The presented token is consumed. Presenting a consumed token again is treated as theft: the whole session is revoked and the request gets a 401.",
+		Body:        models.RefreshTokenRequest{}, Response: TokenResponse{}},
+	{Method: "POST", Path: "/api/v1/auth/confirm-email-change", Tag: "auth", Summary: "Confirm an email change",
+		Description: "Takes the token mailed to the new address, which also marks it verified. The old address is mailed a link to undo the change within 48 hours.",
+		Body:        models.EmailChangeTokenRequest{}, Response: UserEnvelope{}, RateLimit: "10 requests per RATE_LIMIT_WINDOW per IP."},
+	{Method: "POST", Path: "/api/v1/auth/undo-email-change", Tag: "auth", Summary: "Undo an email change",
+		Description: "Takes the token mailed to the old address. Restores it and ends every session of the account.",
+		Body:        models.EmailChangeTokenRequest{}, Response: Message{}, RateLimit: "10 requests per RATE_LIMIT_WINDOW per IP."},
+	{Method: "POST", Path: "/api/v1/auth/magic-link", Tag: "auth", Summary: "Mail a sign-in link",
+		Description: "Mails a link that signs in within 10 minutes, once. With register, an address without an account gets a link that creates one. The answer is the same whether or not the address has an account, and at most one link a minute goes to an address. With MAGIC_LINK_BIND_IP the link only works from the network it was asked for on.",
+		Body:        models.MagicLinkRequest{}, Response: Message{}, RateLimit: "5 requests per RATE_LIMIT_WINDOW per IP."},
+	{Method: "POST", Path: "/api/v1/auth/magic-link/verify", Tag: "auth", Summary: "Sign in with a mailed link",
+		Description: "Consumes the token from the link and answers like login; 201 when it created the account, which is named after the email and verified.",
+		Body:        models.MagicLinkVerifyRequest{}, Response: AuthResponse{}, RateLimit: "10 requests per RATE_LIMIT_WINDOW per IP."},
+	{Method: "POST", Path: "/api/v1/auth/secure-account", Tag: "auth", Summary: "Secure the account after an unrecognized login",
+		Description: "Takes the token from a new-device notice and a new password. Every session of the account ends and the password is replaced. The link works for 7 days, and once used, links from the other notices stop working too.",
+		Body:        models.SecureAccountRequest{}, Response: Message{}, RateLimit: "10 requests per RATE_LIMIT_WINDOW per IP."},
+	{Method: "POST", Path: "/api/v1/auth/verify-email", Tag: "auth", Summary: "Verify the account's email",
+		Description: "Takes the token from the verification mail and marks the address verified, which generating needs. The link works for 24 hours, once; using it also uses up any other verification link sent to the account.",
+		Body:        models.VerifyEmailRequest{}, Response: Message{}, RateLimit: "10 requests per RATE_LIMIT_WINDOW per IP."},
+	{Method: "POST", Path: "/api/v1/auth/resend-verification", Tag: "auth", Summary: "Mail another verification link",
+		Description: "Mails a new verification link to an active account whose email isn't verified. The answer is the same whether or not anything was sent.",
+		Body:        models.ResendVerificationRequest{}, Response: Message{}, RateLimit: "3 requests per RATE_LIMIT_WINDOW per IP."},
+	{Method: "POST", Path: "/api/v1/auth/cancel-deletion", Tag: "auth", Summary: "Cancel an account deletion",
+		Description: "Takes the token mailed when the deletion was requested and reactivates the account, which then logs in again. Works until the erasure starts.",
+		Body:        models.CancelDeletionRequest{}, Response: Message{}, RateLimit: "10 requests per RATE_LIMIT_WINDOW per IP."},
+	{Method: "GET", Path: "/api/v1/auth/csrf-token", Tag: "auth", Summary: "Issue a CSRF token for cookie sessions",
+		Description: "Also set as the csrf_token cookie. Cookie-authenticated requests that change state send it back in X-CSRF-Token.", Response: CSRFTokenResponse{}},
+	{Method: "GET", Path: "/api/v1/auth/google", Tag: "auth", Summary: "Start signing in with Google",
+		Description: "Answers with the Google consent URL. Its state is single use and expires after expires_in seconds. 503 when Google sign-in isn't configured.",
+		Response:    OAuthURLResponse{}, RateLimit: "10 requests per RATE_LIMIT_WINDOW per IP."},
+	{Method: "GET", Path: "/api/v1/auth/google/callback", Tag: "auth", Summary: "Finish signing in with Google",
+		Description: "Pass on the query Google redirected back with. Signs in the account linked to the Google account, else the account with the same verified email, which gets linked; else creates a verified account and answers 201. An unverified Google email is a 403.",
+		Query:       oauthCallbackParams, Response: AuthResponse{}, RateLimit: "10 requests per RATE_LIMIT_WINDOW per IP."},
+	{Method: "GET", Path: "/api/v1/auth/github", Tag: "auth", Summary: "Start signing in with GitHub",
+		Description: "Answers with the GitHub consent URL. Its state is single use and expires after expires_in seconds. 503 when GitHub sign-in isn't configured.",
+		Response:    OAuthURLResponse{}, RateLimit: "10 requests per RATE_LIMIT_WINDOW per IP."},
+	{Method: "GET", Path: "/api/v1/auth/github/callback", Tag: "auth", Summary: "Finish signing in with GitHub",
+		Description: "Pass on the query GitHub redirected back with. The email is the account's primary one from /user/emails, so private emails work; it must be verified (403 otherwise). Accounts are matched, linked and created as with Google, and one account can be linked to both.",
+		Query:       oauthCallbackParams, Response: AuthResponse{}, RateLimit: "10 requests per RATE_LIMIT_WINDOW per IP."},
+
+	// Public
+	{Method: "GET", Path: "/api/v1/explore", Tag: "explore", Summary: "List public generations",
+		Description: fieldsDescription,
+		Query:       models.ListPublicGenerationsRequest{}, Response: PublicGenerationList{}},
+	{Method: "POST", Path: "/api/v1/explore/:id/play", Tag: "explore", Summary: "Count a play of a public generation",
+		Description: "Adds one to counts.plays. Needs no token. 404 when the generation isn't on Explore.",
+		Status:      204, RateLimit: "30 requests per RATE_LIMIT_WINDOW per IP."},
+	{Method: "GET", Path: "/api/v1/music/styles", Tag: "generations", Summary: "Style presets for the music picker",
+		Description: "Active presets in display order. Cached for a few minutes; pass one's id as style_id to /music/generate.",
+		Response:    StylePresetList{}},
+	{Method: "GET", Path: "/api/v1/video/templates", Tag: "generations", Summary: "Templates for the video picker",
+		Description: "Active templates in display order, each with its base prompt and slots. Cached for a few minutes; pass one's id as template_id to /video/generate.",
+		Response:    VideoTemplateList{}},
+	{Method: "GET", Path: "/api/v1/stats/public", Tag: "meta", Summary: "Version and uptime", Response: PublicStats{}},
+	{Method: "GET", Path: "/api/v1/version", Tag: "meta", Summary: "Build version, commit and time", Response: version.Info{}},
+	{Method: "GET", Path: "/api/v1/openapi.json", Tag: "meta", Summary: "This document", Response: Schema{"type": "object"}},
+
+	// Account
+	{Method: "GET", Path: "/api/v1/ws", Tag: "realtime", Access: User, Summary: "WebSocket of generation updates",
+		Description: "Upgrade to a WebSocket. Browsers pass the access token as the token query parameter. 503 while the server is shutting down."},
+	{Method: "GET", Path: "/api/v1/profile", Tag: "account", Access: User, Summary: "The caller's profile and dashboard stats",
+		Description: "stats is cached for a minute and left out if it can't be computed.", Response: ProfileResponse{}},
+	{Method: "PUT", Path: "/api/v1/profile", Tag: "account", Access: User, Summary: "Update name and avatar", Body: models.UpdateProfileRequest{}, Response: UserEnvelope{}},
+	{Method: "DELETE", Path: "/api/v1/profile", Tag: "account", Access: User, LoginOnly: true, Summary: "Delete the caller's account",
+		Description: "Needs the password, or for an account without one a sign-in in the last 10 minutes (401 REAUTH_REQUIRED otherwise), and confirmation set to DELETE. The account is signed out and deactivated at once and erased after ACCOUNT_DELETION_GRACE unless cancelled with the link mailed to it. public_content keep leaves public generations on Explore under an anonymous name. Credit and billing records are kept without personal data. Refused while impersonating.",
+		Body:        models.DeleteAccountRequest{}, Status: 202, Response: AccountDeletionScheduled{}, RateLimit: "5 requests per RATE_LIMIT_WINDOW per user."},
+	{Method: "POST", Path: "/api/v1/profile/export", Tag: "account", Access: User, LoginOnly: true, Summary: "Start exporting the caller's data",
+		Description: "Builds a zip with data.json (profile, subscription, generations, credit transactions, login history, linked identities and API keys) and, with include_media, the media files stored on this server. Progress is pushed over the WebSocket and a download link is mailed when it is ready; the link works for DATA_EXPORT_TTL. One export a day (429 DAILY_LIMIT_REACHED), not counting failed ones. Refused while impersonating.",
+		Body:        models.DataExportRequest{}, Status: 202, Response: DataExportEnvelope{}},
+	{Method: "GET", Path: "/api/v1/profile/export", Tag: "account", Access: User, LoginOnly: true, Summary: "The caller's latest data export",
+		Description: "download_url is set once it is ready and until it expires. 404 when there has been none.", Response: DataExportEnvelope{}},
+	{Method: "GET", Path: "/api/v1/exports/:id/download", Tag: "account", Summary: "Download a data export",
+		Description: "The signed link from download_url or the mail; needs no token. 403 INVALID_TOKEN once it has expired or when the signature doesn't match.",
+		Query:       []Param{integer("expires", "Unix time the link expires at."), str("signature", "Link signature.")}, ContentType: "application/zip", RateLimit: "10 requests per RATE_LIMIT_WINDOW per IP."},
+	{Method: "GET", Path: "/api/v1/media/:id", Tag: "account", Summary: "Open a generation's media",
+		Description: "The signed link from a completion email; needs no token and works for 7 days. Redirects (302) to the output. 403 INVALID_TOKEN once it has expired or when the signature doesn't match.",
+		Query:       []Param{integer("expires", "Unix time the link expires at."), str("signature", "Link signature.")}, Status: 302, RateLimit: "30 requests per RATE_LIMIT_WINDOW per IP."},
+	{Method: "POST", Path: "/api/v1/unsubscribe", Tag: "account", Summary: "Turn off an email from its unsubscribe link",
+		Description: "The token from the link names the user and the preference; needs no login and never expires. Using it again changes nothing. 400 INVALID_TOKEN when it doesn't check out.",
+		Body:        models.UnsubscribeRequest{}, Response: Unsubscribed{}, RateLimit: "10 requests per RATE_LIMIT_WINDOW per IP."},
+	{Method: "GET", Path: "/api/v1/profile/notifications", Tag: "account", Access: User, Summary: "The caller's notification preferences",
+		Description: "Everything is on by default except marketing_email. moderation_notices is always true.",
+		Response:    NotificationPreferencesEnvelope{}},
+	{Method: "PUT", Path: "/api/v1/profile/notifications", Tag: "account", Access: User, LoginOnly: true, Summary: "Change notification preferences",
+		Description: "Fields left out keep their value. Unknown fields, and moderation_notices set to false, are a 400 VALIDATION_FAILED.", Body: models.UpdateNotificationPreferencesRequest{}, Response: NotificationPreferencesEnvelope{}},
+	{Method: "GET", Path: "/api/v1/notifications", Tag: "account", Access: User, Summary: "The caller's notification inbox",
+		Description: "Newest first, with the number unread. New notifications are also pushed over the WebSocket as a notification event with the unread count. Read ones are deleted after 90 days.",
+		Query:       append([]Param{str("unread", "true to leave out notifications already read.")}, pageParams...), Response: NotificationList{}},
+	{Method: "POST", Path: "/api/v1/notifications/:id/read", Tag: "account", Access: User, Summary: "Mark a notification read",
+		Description: "Marking it again changes nothing.", Response: NotificationRead{}},
+	{Method: "POST", Path: "/api/v1/notifications/read-all", Tag: "account", Access: User, Summary: "Mark every notification read", Response: NotificationsReadAll{}},
+	{Method: "GET", Path: "/api/v1/referrals", Tag: "account", Access: User, Summary: "The caller's referral code and how their referrals did",
+		Description: "The code is generated on the first call. Both sides get referral_bonus_credits when the referred account completes its first generation; the referrer at most referral_monthly_cap times per UTC month.",
+		Response:    ReferralsEnvelope{}},
+	{Method: "GET", Path: "/api/v1/stats/me", Tag: "account", Access: User, Summary: "The caller's generation and credit stats over time",
+		Description: "Generations by type and status and credits spent per bucket, with every bucket in the period present, plus the success rate, top 5 styles and average seconds to complete. Cached for up to 10 minutes.",
+		Query: []Param{
+			str("period", "30d (default), 90d or 1y, back from the end of today."),
+			str("granularity", "day (default) or week, with weeks starting on Monday."),
+			str("tz", "IANA time zone for bucket boundaries. Defaults to UTC."),
+		},
+		Response: Schema{"type": "object"}},
+	{Method: "POST", Path: "/api/v1/profile/change-password", Tag: "account", Access: User, Summary: "Change password",
+		Description: "Ends every session of the account, including the caller's, and answers with tokens for a new session on this device. Refused while impersonating.",
+		LoginOnly:   true, Body: models.ChangePasswordRequest{}, Response: TokenResponse{}},
+	{Method: "POST", Path: "/api/v1/profile/change-email", Tag: "account", Access: User, LoginOnly: true, Summary: "Start changing the account's email",
+		Description: "Needs the current password. Mails a link to the new address; nothing changes until it is confirmed within 24 hours. Refused while impersonating.",
+		Body:        models.ChangeEmailRequest{}, Response: Message{}, RateLimit: "5 requests per RATE_LIMIT_WINDOW per user."},
+	{Method: "GET", Path: "/api/v1/profile/login-history", Tag: "account", Access: User, LoginOnly: true, Summary: "The caller's latest login attempts",
+		Description: "The last 50, newest first. Location is only set when the server has a GeoIP database.", Response: LoginHistory{}},
+	{Method: "POST", Path: "/api/v1/logout", Tag: "account", Access: User, Summary: "Log out",
+		Description: "Ends the current session: its refresh token is revoked, its access tokens are refused from now on and its WebSocket connections are closed.", LoginOnly: true, Response: Message{}},
+	{Method: "POST", Path: "/api/v1/logout-all", Tag: "account", Access: User, Summary: "Log out of every session",
+		Description: "Ends every session of the user, this one included. Refused under impersonation.", LoginOnly: true, Response: LogoutAllResponse{}},
+	{Method: "GET", Path: "/api/v1/flags", Tag: "account", Access: User, Summary: "Feature flags as evaluated for the caller", Response: EvaluatedFlags{}},
+	{Method: "GET", Path: "/api/v1/capabilities", Tag: "account", Access: User, Summary: "What the caller's plan may generate with",
+		Description: "The video models, highest resolution, longest duration, music models, highest bitrate and voice cloning access of the caller's current plan, and of every plan so an option can be labelled with the plan that unlocks it. The generate endpoints answer 403 PLAN_UPGRADE_REQUIRED with field and required_plan for anything beyond the caller's plan.",
+		Response:    CapabilityTable{}},
+	{Method: "POST", Path: "/api/v1/graphql", Tag: "account", Access: User, LoginOnly: true, Summary: "Read-only GraphQL queries for the dashboard",
+		Description: "Queries me (user and stats), generations (type, status, favorite, sort, page, limit), generation(id), creditTransactions (type, page, limit) and publicFeed (type, sort, page, limit), answered from the same queries and caches as the REST endpoints; fields are named as in the REST responses. Mutations are refused. A query nested more than 6 fields deep, or costing more than 1500, is a 400 with GraphQL errors before anything runs: each field costs 1 and what is selected under a list costs once per item of its limit (20 when left out). Parse and validation failures are 400s in the same shape, with extensions.code. Errors while resolving come back with a 200 next to the data that did resolve. Introspection is refused in production.",
+		Body:        models.GraphQLRequest{}, Response: Schema{"type": "object"}},
+
+	// Sessions
+	{Method: "GET", Path: "/api/v1/sessions", Tag: "account", Access: User, LoginOnly: true, Summary: "List the caller's active sessions",
+		Description: "One entry per login that can still be refreshed, most recently used first. user_agent and ip are from the latest login or refresh; current flags the session of this request. Refused while impersonating.",
+		Response:    SessionList{}},
+	{Method: "DELETE", Path: "/api/v1/sessions/:id", Tag: "account", Access: User, LoginOnly: true, Summary: "End a session",
+		Description: "Its refresh token stops working, its access tokens are refused and its WebSocket connections are closed. The current session can be ended too. Refused while impersonating.",
+		Response:    Message{}},
+	{Method: "POST", Path: "/api/v1/sessions/revoke-others", Tag: "account", Access: User, LoginOnly: true, Summary: "End every other session",
+		Description: "Ends every session of the user but the current one, like DELETE on each. Refused while impersonating.", Response: LogoutAllResponse{}},
+
+	// API keys
+	{Method: "GET", Path: "/api/v1/api-keys", Tag: "api-keys", Access: User, LoginOnly: true, Summary: "List the caller's API keys",
+		Description: "Revoked keys are left out. Keys themselves are never shown again; prefix tells them apart.", Response: APIKeyList{}},
+	{Method: "POST", Path: "/api/v1/api-keys", Tag: "api-keys", Access: User, LoginOnly: true, Summary: "Create an API key",
+		Description: "Pro and Enterprise only. scopes is any of read and generate (default read). key is shown in this response only. 409 when the caller already has 10 active keys. Refused while impersonating.",
+		Body:        models.CreateAPIKeyRequest{}, Status: 201, Response: CreatedAPIKey{}},
+	{Method: "DELETE", Path: "/api/v1/api-keys/:id", Tag: "api-keys", Access: User, LoginOnly: true, Summary: "Revoke an API key",
+		Description: "Every instance stops accepting the key within 30 seconds.", Response: Message{}},
+
+	// Generations
+	{Method: "GET", Path: "/api/v1/generations", Tag: "generations", Access: User, Summary: "List the caller's generations",
+		Description: fieldsDescription, Query: models.ListGenerationsRequest{}, Response: GenerationList{}},
+	{Method: "POST", Path: "/api/v1/generations/bulk", Tag: "generations", Access: User, Summary: "Favorite, unfavorite, publish or unpublish many generations",
+		Description: "Up to 100 IDs, applied in one update. IDs that don't apply are listed under skipped with a reason instead of failing the request. Publishing needs completed generations and is refused for users banned from publishing; the publish filter skips hard matches as publish_blocked and lists soft ones under held.",
+		Body:        models.BulkGenerationRequest{}, Response: BulkGenerationResult{}},
+	{Method: "GET", Path: "/api/v1/generations/export", Tag: "generations", Access: User, Summary: "Download the caller's whole generation history",
+		Description: "Streams every generation, oldest first, as CSV or newline-delimited JSON, with a dated filename in Content-Disposition.",
+		Query:       []Param{str("format", "csv (default) or json.")}, ContentType: "text/csv", RateLimit: "2 exports per hour per user."},
+	{Method: "GET", Path: "/api/v1/generations/:id", Tag: "generations", Access: User, Summary: "Get a generation", Response: GenerationEnvelope{}},
+	{Method: "DELETE", Path: "/api/v1/generations/:id", Tag: "generations", Access: User, Summary: "Delete a generation", Response: Message{}},
+	{Method: "POST", Path: "/api/v1/generations/:id/favorite", Tag: "generations", Access: User, Summary: "Toggle favorite", Response: GenerationEnvelope{}},
+	{Method: "PATCH", Path: "/api/v1/generations/:id", Tag: "generations", Access: User, Summary: "Rename a generation",
+		Description: "The title is checked like one given at creation (422 POLICY_VIOLATION) and, if the generation is public, by the publish filter: 422 PUBLISH_BLOCKED on a hard match, held for review (moderation_status pending_review) on a soft one.",
+		Body:        models.UpdateGenerationRequest{}, Response: GenerationEnvelope{}},
+	{Method: "POST", Path: "/api/v1/generations/:id/public", Tag: "generations", Access: User, Summary: "Toggle whether it is on Explore",
+		Description: "Only a completed generation can go public (409 otherwise); making one private always works. Going public runs the title, style and lyrics through the publish filter. A hard match is a 422 PUBLISH_BLOCKED; a soft one publishes it with moderation_status pending_review, off Explore until an admin approves it.",
+		Response:    GenerationEnvelope{}},
+	{Method: "POST", Path: "/api/v1/generations/:id/rerender", Tag: "generations", Access: User, Summary: "Replace a watermarked output with the clean one",
+		Description: "For a generation watermarked on the free plan, once the caller is on a paid plan (403 PLAN_UPGRADE_REQUIRED before). The clean file kept when it was marked replaces the output; nothing is generated again and nothing is charged. 409 if the generation isn't watermarked or the clean file is gone.",
+		Response:    GenerationEnvelope{}},
+	{Method: "POST", Path: "/api/v1/music/generate", Tag: "generations", Access: User, Summary: "Start a music generation",
+		Description: "Answers 202 and finishes in the background; progress arrives over the WebSocket. 503 while the server is shutting down, and 503 QUEUE_FULL with Retry-After while too many generations are running; no generation is created and no credit is taken then. saved_prompt_id fills in the fields left empty from one of the caller's saved prompts of the same type (404 if it isn't theirs, 400 for the other type). style_id puts an active style preset's prompt fragment in front of the prompt and fills in the style, model and bitrate when they are left out (400 for an unknown or inactive preset). The audio is loudness-normalized unless normalize is false; metadata.loudness has the measurements. On the free plan a short audio tag is added at the end (watermarked is true). A model or bitrate beyond the caller's plan is a 403 PLAN_UPGRADE_REQUIRED naming the plan that allows it (see /capabilities); a style preset's bitrate is capped to the plan instead. duration_seconds asks for a track length within the model's range (music-2.0: 15-300, music-1.5: 15-240; a 400 outside it); music-1.5 ignores it. A longer track can cost more (settings music_credit_cost_per_minute). The length of the file delivered is the generation's duration, with requested_duration the one asked for; metadata has actual_duration_seconds and duration_mismatch, true when the provider didn't keep to the request, which doesn't fail the generation." + generateDuplicate + generateUnverified,
+		Body:        models.GenerateMusicRequest{}, Status: 202, Response: GenerationEnvelope{}, RateLimit: generateLimit},
+	{Method: "POST", Path: "/api/v1/video/generate", Tag: "generations", Access: User, Summary: "Start a video generation",
+		Description: "Answers 202 and finishes in the background; progress arrives over the WebSocket. 503 while the server is shutting down, and 503 QUEUE_FULL with Retry-After while too many generations are running; no generation is created and no credit is taken then. saved_prompt_id fills in the fields left empty from one of the caller's saved prompts of the same type (404 if it isn't theirs, 400 for the other type). template_id renders an active video template with template_values into the prompt, followed by any prompt given, and fills in the model, duration and resolution when they are left out. Every required slot needs a value and values are at most 200 characters; unknown slots, an unknown or inactive template, or values without a template are a 400. On the free plan a logo is overlaid in the corner (watermarked is true). A model, resolution or duration beyond the caller's plan is a 403 PLAN_UPGRADE_REQUIRED naming the plan that allows it (see /capabilities), as are a template's defaults. aspect_ratio is 16:9 (default), 9:16 or 1:1; a ratio the model doesn't render is a 400 whose details list the models that do. The thumbnail is a frame of the video in the same ratio." + generateDuplicate + generateUnverified,
+		Body:        models.GenerateVideoRequest{}, Status: 202, Response: GenerationEnvelope{}, RateLimit: generateLimit},
+
+	// Saved prompts
+	{Method: "GET", Path: "/api/v1/prompts", Tag: "prompts", Access: User, Summary: "List the caller's saved prompts",
+		Description: "Most recently changed first.", Response: SavedPromptList{}},
+	{Method: "POST", Path: "/api/v1/prompts", Tag: "prompts", Access: User, Summary: "Save a prompt",
+		Description: "Validated like the generate endpoints, with the caller's plan text limits. lyrics_template is for music only. 409 once the caller has as many as saved_prompt_limits allows their plan.",
+		Body:        models.SavedPromptRequest{}, Status: 201, Response: SavedPromptEnvelope{}},
+	{Method: "GET", Path: "/api/v1/prompts/history", Tag: "prompts", Access: User, Summary: "Prompts the caller generated from recently",
+		Description: "Up to 50 distinct prompts from the caller's latest 500 generations, newest first, each with the style and lyrics it was last used with and how often it was used.",
+		Query:       models.PromptHistoryRequest{}, Response: PromptHistory{}},
+	{Method: "GET", Path: "/api/v1/prompts/:id", Tag: "prompts", Access: User, Summary: "Get a saved prompt", Response: SavedPromptEnvelope{}},
+	{Method: "PUT", Path: "/api/v1/prompts/:id", Tag: "prompts", Access: User, Summary: "Replace a saved prompt",
+		Body: models.SavedPromptRequest{}, Response: SavedPromptEnvelope{}},
+	{Method: "DELETE", Path: "/api/v1/prompts/:id", Tag: "prompts", Access: User, Summary: "Delete a saved prompt", Response: Message{}},
+
+	// Drafts
+	{Method: "GET", Path: "/api/v1/drafts", Tag: "drafts", Access: User, Summary: "List the caller's drafts",
+		Description: "Most recently saved first. Drafts are not generations and are not in /generations.", Response: DraftList{}},
+	{Method: "POST", Path: "/api/v1/drafts", Tag: "drafts", Access: User, Summary: "Save a generate request as a draft",
+		Description: "payload is a /music/generate or /video/generate body, by type. It is checked like one, except that nothing is required and there are no minimum lengths. Costs no credits. 409 once the caller has 20 drafts.",
+		Body:        models.DraftRequest{}, Status: 201, Response: DraftEnvelope{}},
+	{Method: "GET", Path: "/api/v1/drafts/:id", Tag: "drafts", Access: User, Summary: "Get a draft", Response: DraftEnvelope{}},
+	{Method: "PUT", Path: "/api/v1/drafts/:id", Tag: "drafts", Access: User, Summary: "Replace a draft",
+		Description: "Meant for autosave: idempotent, and answers with only id and updated_at.", Body: models.DraftRequest{}, Response: SavedDraft{}},
+	{Method: "DELETE", Path: "/api/v1/drafts/:id", Tag: "drafts", Access: User, Summary: "Delete a draft", Response: Message{}},
+	{Method: "POST", Path: "/api/v1/drafts/:id/submit", Tag: "drafts", Access: User, Summary: "Start a generation from a draft",
+		Description: "Runs the payload through /music/generate or /video/generate and answers as they do. The draft is deleted when the generation is accepted and kept when it is refused. 409 while the same draft is being submitted.",
+		Status:      202, Response: GenerationEnvelope{}, RateLimit: generateLimit},
+
+	// Admin
+	{Method: "GET", Path: "/api/v1/admin/audit", Tag: "admin", Access: Admin, Summary: "Search the audit log", Query: auditParams, Response: AuditLogList{}},
+	{Method: "GET", Path: "/api/v1/admin/users/:id/audit", Tag: "admin", Access: Admin, Summary: "Audit log of one user", Query: auditParams, Response: AuditLogList{}},
+	{Method: "GET", Path: "/api/v1/admin/analytics", Tag: "admin", Access: Admin, Summary: "Generation and signup analytics",
+		Query: append([]Param{str("granularity", "day (default) or week.")}, dateRangeParams...), Response: Schema{"type": "object"}},
+	{Method: "GET", Path: "/api/v1/admin/maintenance", Tag: "admin", Access: Admin, Summary: "Maintenance state", Response: MaintenanceEnvelope{}},
+	{Method: "POST", Path: "/api/v1/admin/maintenance", Tag: "admin", Access: Admin, Summary: "Turn maintenance mode on or off", Body: models.SetMaintenanceRequest{}, Response: MaintenanceEnvelope{}},
+	{Method: "POST", Path: "/api/v1/admin/purge", Tag: "admin", Access: Admin, Summary: "Purge soft-deleted rows",
+		Description: "A dry run answers 200 with counts; a real run answers 202 and purges in the background. 409 while a purge is running.",
+		Body:        models.RunPurgeRequest{}, Response: PurgeResponse{}},
+	{Method: "GET", Path: "/api/v1/admin/settings", Tag: "admin", Access: Admin, Summary: "Runtime settings", Response: SettingsEnvelope{}},
+	{Method: "PUT", Path: "/api/v1/admin/settings", Tag: "admin", Access: Admin, Summary: "Change runtime settings",
+		Description: "Fields left out keep their value.", Body: settings.Settings{}, Response: SettingsEnvelope{}},
+	{Method: "POST", Path: "/api/v1/admin/users/:id/credits", Tag: "admin", Access: Admin, Summary: "Add or remove credits", Body: models.AdjustCreditsRequest{}, Response: CreditAdjustment{}},
+	{Method: "POST", Path: "/api/v1/admin/users/:id/promote", Tag: "admin", Access: Admin, Summary: "Make a user an admin", Response: UserEnvelope{}},
+	{Method: "DELETE", Path: "/api/v1/admin/users/:id/lockout", Tag: "admin", Access: Admin, Summary: "Unlock an account locked by failed logins",
+		Description: "Also forgets the account's failed attempts.", Response: Message{}},
+	{Method: "POST", Path: "/api/v1/admin/impersonate/:userID", Tag: "admin", Access: Admin, Summary: "Issue a short-lived token acting as a user", Response: ImpersonationResponse{}},
+	{Method: "GET", Path: "/api/v1/admin/transactions/export", Tag: "admin", Access: Admin, Summary: "Export the credit ledger",
+		Description: "Streams CSV or JSON lines, gzipped when the client accepts it.",
+		Query:       append([]Param{str("format", "csv (default) or jsonl."), str("type", "Transaction type.")}, dateRangeParams...),
+		ContentType: "text/csv"},
+	{Method: "GET", Path: "/api/v1/admin/generations", Tag: "admin", Access: Admin, Summary: "Search all generations",
+		Query: append(append([]Param{
+			str("user", "Owner user ID."),
+			str("type", "music or video."),
+			str("status", "Generation status."),
+			str("model", "Model name."),
+		}, dateRangeParams...), pageParams...), Response: AdminGenerationList{}},
+	{Method: "GET", Path: "/api/v1/admin/generations/:id", Tag: "admin", Access: Admin, Summary: "Get any generation", Response: AdminGenerationEnvelope{}},
+	{Method: "POST", Path: "/api/v1/admin/generations/:id/fail", Tag: "admin", Access: Admin, Summary: "Mark a stuck generation failed and refund it", Body: models.ForceFailGenerationRequest{}, Response: AdminGenerationEnvelope{}},
+	{Method: "POST", Path: "/api/v1/admin/generations/:id/retry", Tag: "admin", Access: Admin, Summary: "Retry a failed generation", Status: 202, Response: AdminGenerationEnvelope{}},
+	{Method: "POST", Path: "/api/v1/admin/generations/:id/approve", Tag: "admin", Access: Admin, Summary: "Let a generation held for review onto Explore",
+		Description: "409 unless it is pending_review. The approval stands until the owner renames it.", Response: AdminGenerationEnvelope{}},
+	{Method: "POST", Path: "/api/v1/admin/generations/:id/unpublish", Tag: "admin", Access: Admin, Summary: "Take a generation off Explore", Body: models.UnpublishGenerationRequest{}, Response: AdminGenerationEnvelope{}},
+	{Method: "GET", Path: "/api/v1/admin/flags", Tag: "admin", Access: Admin, Summary: "List feature flags", Response: FeatureFlagList{}},
+	{Method: "PUT", Path: "/api/v1/admin/flags/:key", Tag: "admin", Access: Admin, Summary: "Create or update a feature flag", Body: models.UpsertFeatureFlagRequest{}, Response: FeatureFlagEnvelope{}},
+	{Method: "DELETE", Path: "/api/v1/admin/flags/:key", Tag: "admin", Access: Admin, Summary: "Delete a feature flag", Response: Message{}},
+	{Method: "PUT", Path: "/api/v1/admin/flags/:key/overrides/:userId", Tag: "admin", Access: Admin, Summary: "Force a flag on or off for a user", Body: models.FeatureFlagOverrideRequest{}, Response: FeatureFlagOverrideEnvelope{}},
+	{Method: "DELETE", Path: "/api/v1/admin/flags/:key/overrides/:userId", Tag: "admin", Access: Admin, Summary: "Remove a user's flag override", Response: Message{}},
+	{Method: "GET", Path: "/api/v1/admin/styles", Tag: "admin", Access: Admin, Summary: "List style presets, inactive ones included", Response: AdminStylePresetList{}},
+	{Method: "PUT", Path: "/api/v1/admin/styles/:name", Tag: "admin", Access: Admin, Summary: "Create or update a style preset",
+		Description: "name is lowercase letters, digits and dashes. Putting the name of a deleted preset brings it back with its old id. is_active defaults to true.",
+		Body:        models.UpsertStylePresetRequest{}, Response: StylePresetEnvelope{}},
+	{Method: "DELETE", Path: "/api/v1/admin/styles/:name", Tag: "admin", Access: Admin, Summary: "Delete a style preset",
+		Description: "Generations that used it keep counting toward it in analytics.",
+		Response:    Message{}},
+	{Method: "GET", Path: "/api/v1/admin/video-templates", Tag: "admin", Access: Admin, Summary: "List video templates, inactive ones included", Response: AdminVideoTemplateList{}},
+	{Method: "PUT", Path: "/api/v1/admin/video-templates/:name", Tag: "admin", Access: Admin, Summary: "Create or update a video template",
+		Description: "name is lowercase letters, digits and dashes. Slots in base_prompt are written {{slot}}, or {{slot?}} when they may be left empty. Putting the name of a deleted template brings it back with its old id. is_active defaults to true.",
+		Body:        models.UpsertVideoTemplateRequest{}, Response: VideoTemplateEnvelope{}},
+	{Method: "DELETE", Path: "/api/v1/admin/video-templates/:name", Tag: "admin", Access: Admin, Summary: "Delete a video template",
+		Description: "Generations rendered from it keep their video_template_id.",
+		Response:    Message{}},
+	{Method: "GET", Path: "/api/v1/admin/moderation/rules", Tag: "admin", Access: Admin, Summary: "List prompt blocklist rules", Response: ModerationRuleList{}},
+	{Method: "POST", Path: "/api/v1/admin/moderation/rules", Tag: "admin", Access: Admin, Summary: "Add a blocklist rule", Body: models.CreateModerationRuleRequest{}, Status: 201, Response: ModerationRuleEnvelope{}},
+	{Method: "DELETE", Path: "/api/v1/admin/moderation/rules/:id", Tag: "admin", Access: Admin, Summary: "Delete a blocklist rule", Response: Message{}},
+	{Method: "GET", Path: "/api/v1/admin/disposable-domains", Tag: "admin", Access: Admin, Summary: "Admin entries correcting the disposable-domain lists",
+		Response: DisposableDomainList{}},
+	{Method: "POST", Path: "/api/v1/admin/disposable-domains", Tag: "admin", Access: Admin, Summary: "Block a domain, or let a listed one through",
+		Description: "blocked defaults to true. Covers subdomains. Applies on other instances within a minute.",
+		Body:        models.DisposableDomainRequest{}, Response: DisposableDomainEnvelope{}},
+	{Method: "DELETE", Path: "/api/v1/admin/disposable-domains/:domain", Tag: "admin", Access: Admin, Summary: "Remove an admin entry",
+		Description: "The domain is judged by the bundled and remote lists again; listed says whether they block it.", Response: Message{}},
+	{Method: "GET", Path: "/api/v1/admin/disposable-domains/blocks", Tag: "admin", Access: Admin, Summary: "Refused throwaway addresses by IP",
+		Description: "The 100 IPs with the most refused sign-ups and email changes, over from/to (the last 7 days by default).",
+		Query:       dateRangeParams, Response: DisposableBlockList{}},
+	{Method: "GET", Path: "/api/v1/admin/moderation/queue", Tag: "admin", Access: Admin, Summary: "Generations the publish filter held for review",
+		Description: "Public generations with moderation_status pending_review, oldest first.", Query: pageParams, Response: AdminGenerationList{}},
+	{Method: "GET", Path: "/api/v1/admin/moderation/blocks", Tag: "admin", Access: Admin, Summary: "Recently blocked generate requests", Query: pageParams, Response: ModerationBlockList{}},
+	{Method: "GET", Path: "/api/v1/stats", Tag: "admin", Access: Admin, Summary: "Instance stats for dashboards", Response: Schema{"type": "object"}},
+}
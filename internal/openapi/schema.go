@@ -0,0 +1,207 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/auth"
+	"github.com/zesbe/lumina-ai/internal/middleware"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+// Schema is a JSON Schema object as OpenAPI 3.0 spells it.
+type Schema map[string]interface{}
+
+// enums lists the values of string types that are closed sets.
+var enums = map[reflect.Type][]string{
+	reflect.TypeOf(apierror.Code("")): codes(),
+	reflect.TypeOf(models.GenerationType("")): {
+		string(models.TypeMusic), string(models.TypeVideo),
+	},
+	reflect.TypeOf(models.GenerationStatus("")): {
+		string(models.StatusPending), string(models.StatusProcessing), string(models.StatusInterrupted),
+		string(models.StatusCompleted), string(models.StatusFailed),
+	},
+}
+
+func codes() []string {
+	values := make([]string, len(apierror.Codes))
+	for i, code := range apierror.Codes {
+		values[i] = string(code)
+	}
+	return values
+}
+
+// componentNames overrides the schema name of types from packages other
+// than models, which would otherwise be prefixed with the package name.
+var componentNames = map[reflect.Type]string{
+	reflect.TypeOf(auth.TokenPair{}):             "TokenPair",
+	reflect.TypeOf(middleware.ValidationError{}): "ValidationError",
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	rawType  = reflect.TypeOf(json.RawMessage{})
+)
+
+// components collects the named schemas referenced while building the
+// document.
+type components map[string]Schema
+
+// schemaOf describes t. Named structs become components and are
+// referenced; everything else is inlined.
+func (cs components) schemaOf(t reflect.Type) Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == timeType {
+		return Schema{"type": "string", "format": "date-time"}
+	}
+	if t == rawType {
+		// Passed through as it came: any JSON value.
+		return Schema{}
+	}
+	if values, ok := enums[t]; ok {
+		return Schema{"type": "string", "enum": values}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return Schema{"type": "string"}
+	case reflect.Bool:
+		return Schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return Schema{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return Schema{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return Schema{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return Schema{"type": "array", "items": cs.schemaOf(t.Elem())}
+	case reflect.Map:
+		return Schema{"type": "object", "additionalProperties": cs.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return cs.object(t)
+		}
+		name := componentName(t)
+		if _, ok := cs[name]; !ok {
+			cs[name] = nil // placeholder, for types that refer to themselves
+			cs[name] = cs.object(t)
+		}
+		return Schema{"$ref": "#/components/schemas/" + name}
+	}
+	// interface{} and anything else: any JSON value.
+	return Schema{}
+}
+
+func componentName(t reflect.Type) string {
+	if name, ok := componentNames[t]; ok {
+		return name
+	}
+	pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+	if pkg == "models" || pkg == "openapi" || strings.HasPrefix(strings.ToLower(t.Name()), pkg) {
+		return t.Name()
+	}
+	return strings.ToUpper(pkg[:1]) + pkg[1:] + t.Name()
+}
+
+// object describes a struct from its json and validate tags; embedded
+// structs are flattened the way encoding/json does. In request bodies
+// (types named ...Request) a field is required when validated as such; in
+// everything else, when it has no omitempty.
+func (cs components) object(t reflect.Type) Schema {
+	properties := Schema{}
+	var required []string
+	cs.fields(t, strings.HasSuffix(t.Name(), "Request"), properties, &required)
+
+	s := Schema{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+func (cs components) fields(t reflect.Type, isRequest bool, properties Schema, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if sf.Anonymous && name == "" && sf.Type.Kind() == reflect.Struct {
+			cs.fields(sf.Type, isRequest, properties, required)
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+
+		field := cs.schemaOf(sf.Type)
+		rules, isRequired := constraints(sf)
+		// Keywords next to a $ref are ignored in OpenAPI 3.0.
+		if _, isRef := field["$ref"]; !isRef {
+			for k, v := range rules {
+				field[k] = v
+			}
+		}
+		properties[name] = field
+
+		if isRequest && isRequired || !isRequest && !strings.Contains(opts, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// constraints turns the validate tag of sf into schema keywords, following
+// the rules middleware.Validate applies.
+func constraints(sf reflect.StructField) (Schema, bool) {
+	tag := sf.Tag.Get("validate")
+	if tag == "" || tag == "-" {
+		return nil, false
+	}
+
+	t := sf.Type
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	isString := t.Kind() == reflect.String
+
+	rules := Schema{}
+	required := false
+	for _, rule := range strings.Split(tag, ",") {
+		key, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		n, numErr := strconv.Atoi(arg)
+		switch {
+		case key == "required":
+			required = true
+		case key == "email":
+			rules["format"] = "email"
+		case key == "password":
+			rules["format"] = "password"
+			rules["minLength"] = 8
+			rules["description"] = "At least 8 characters with an upper-case letter, a lower-case letter, a digit and a symbol."
+		case key == "oneof":
+			rules["enum"] = strings.Fields(arg)
+		case key == "min" && numErr == nil && isString:
+			rules["minLength"] = n
+		case key == "max" && numErr == nil && isString:
+			rules["maxLength"] = n
+		case key == "min" && numErr == nil:
+			rules["minimum"] = n
+		case key == "max" && numErr == nil:
+			rules["maximum"] = n
+		}
+	}
+	return rules, required
+}
@@ -0,0 +1,360 @@
+package openapi
+
+import (
+	"time"
+
+	"github.com/zesbe/lumina-ai/internal/apierror"
+	"github.com/zesbe/lumina-ai/internal/auth"
+	"github.com/zesbe/lumina-ai/internal/config"
+	"github.com/zesbe/lumina-ai/internal/disposable"
+	"github.com/zesbe/lumina-ai/internal/maintenance"
+	"github.com/zesbe/lumina-ai/internal/models"
+	"github.com/zesbe/lumina-ai/internal/session"
+	"github.com/zesbe/lumina-ai/internal/settings"
+)
+
+// The types below only describe response bodies the handlers build as
+// fiber.Map, so their shapes have a name in the document.
+
+// Error is the v1 error body, the default. Facts about the error
+// (retry_after, limit, timeout_ms, eta, field) sit next to these fields.
+type Error struct {
+	Error     string        `json:"error"`
+	Message   string        `json:"message"`
+	Code      apierror.Code `json:"code"`
+	Details   interface{}   `json:"details,omitempty"`
+	RequestID string        `json:"request_id"`
+}
+
+// ErrorEnvelope is the error body for clients that send
+// "Accept-Version: 2".
+type ErrorEnvelope struct {
+	Error struct {
+		Code      apierror.Code `json:"code"`
+		Message   string        `json:"message"`
+		Details   interface{}   `json:"details,omitempty"`
+		RequestID string        `json:"request_id"`
+	} `json:"error"`
+}
+
+type Message struct {
+	Message string `json:"message"`
+}
+
+// Pagination is the envelope of every paged list.
+type Pagination struct {
+	Page       int   `json:"page"`
+	Limit      int   `json:"limit"`
+	Total      int64 `json:"total"`
+	TotalPages int64 `json:"total_pages"`
+	// TotalIsEstimate is set on the Explore list when the count was
+	// capped.
+	TotalIsEstimate bool `json:"total_is_estimate"`
+	// NextCursor is only set on lists paged by cursor.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+type AuthResponse struct {
+	Message string              `json:"message"`
+	User    models.UserResponse `json:"user"`
+	Tokens  auth.TokenPair      `json:"tokens,omitempty"`
+}
+
+type TokenResponse struct {
+	Message string         `json:"message"`
+	Tokens  auth.TokenPair `json:"tokens"`
+}
+
+type OAuthURLResponse struct {
+	URL       string `json:"url"`
+	ExpiresIn int    `json:"expires_in"`
+}
+
+type CSRFTokenResponse struct {
+	CSRFToken string `json:"csrf_token"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+type AccountDeletionScheduled struct {
+	Message      string    `json:"message"`
+	ScheduledFor time.Time `json:"scheduled_for"`
+}
+
+type DataExportEnvelope struct {
+	Message string                    `json:"message,omitempty"`
+	Export  models.DataExportResponse `json:"export"`
+}
+
+type NotificationList struct {
+	Notifications []models.Notification `json:"notifications"`
+	Unread        int64                 `json:"unread"`
+	Pagination    Pagination            `json:"pagination"`
+}
+
+type NotificationRead struct {
+	Notification models.Notification `json:"notification"`
+	Unread       int64               `json:"unread"`
+}
+
+type NotificationsReadAll struct {
+	Message string `json:"message"`
+	Marked  int64  `json:"marked"`
+	Unread  int64  `json:"unread"`
+}
+
+type Unsubscribed struct {
+	Message    string `json:"message"`
+	Preference string `json:"preference"`
+}
+
+type NotificationPreferencesEnvelope struct {
+	Message     string                         `json:"message,omitempty"`
+	Preferences models.NotificationPreferences `json:"preferences"`
+}
+
+type ReferralsEnvelope struct {
+	Referrals models.ReferralStats `json:"referrals"`
+}
+
+type UserEnvelope struct {
+	Message string              `json:"message,omitempty"`
+	User    models.UserResponse `json:"user"`
+}
+
+type ProfileResponse struct {
+	User  models.UserResponse `json:"user"`
+	Stats models.ProfileStats `json:"stats,omitempty"`
+}
+
+type GenerationEnvelope struct {
+	Message    string                    `json:"message,omitempty"`
+	Generation models.GenerationResponse `json:"generation"`
+	// DuplicateOf is set when the request was already running.
+	DuplicateOf uint `json:"duplicate_of,omitempty"`
+}
+
+type GenerationList struct {
+	Generations []models.GenerationResponse `json:"generations"`
+	Pagination  Pagination                  `json:"pagination"`
+}
+
+type BulkGenerationResult struct {
+	Message string               `json:"message"`
+	Action  string               `json:"action"`
+	Updated []uint               `json:"updated"`
+	Held    []uint               `json:"held"`
+	Skipped []BulkGenerationSkip `json:"skipped"`
+}
+
+type BulkGenerationSkip struct {
+	ID uint `json:"id"`
+	// Reason is not_found, not_completed, removed or publish_blocked.
+	Reason string `json:"reason"`
+}
+
+type PublicGenerationList struct {
+	Generations []models.GenerationPublicResponse `json:"generations"`
+	Pagination  Pagination                        `json:"pagination"`
+}
+
+type AdminGenerationEnvelope struct {
+	Message    string                         `json:"message,omitempty"`
+	Generation models.AdminGenerationResponse `json:"generation"`
+	// Refunded is set by fail: whether the credits went back to the owner.
+	Refunded bool `json:"refunded,omitempty"`
+}
+
+type AdminGenerationList struct {
+	Generations []models.AdminGenerationResponse `json:"generations"`
+	Pagination  Pagination                       `json:"pagination"`
+}
+
+type AuditLogList struct {
+	Entries    []models.AuditLog `json:"entries"`
+	Pagination Pagination        `json:"pagination"`
+}
+
+type ModerationBlockList struct {
+	Blocks     []models.AuditLog `json:"blocks"`
+	Pagination Pagination        `json:"pagination"`
+}
+
+type CreditAdjustment struct {
+	Message     string                   `json:"message"`
+	User        models.UserResponse      `json:"user"`
+	Transaction models.CreditTransaction `json:"transaction"`
+}
+
+type ImpersonationResponse struct {
+	User  models.UserResponse `json:"user"`
+	Token struct {
+		AccessToken   string `json:"access_token"`
+		ExpiresAt     int64  `json:"expires_at"`
+		TokenType     string `json:"token_type"`
+		Impersonation bool   `json:"impersonation"`
+	} `json:"token"`
+}
+
+type FeatureFlagEnvelope struct {
+	Flag models.FeatureFlagResponse `json:"flag"`
+}
+
+type FeatureFlagList struct {
+	Flags []models.FeatureFlagResponse `json:"flags"`
+}
+
+type StylePresetList struct {
+	Styles []models.StylePresetResponse `json:"styles"`
+}
+
+type AdminStylePresetList struct {
+	Styles []models.AdminStylePresetResponse `json:"styles"`
+}
+
+type StylePresetEnvelope struct {
+	Style models.AdminStylePresetResponse `json:"style"`
+}
+
+type VideoTemplateList struct {
+	Templates []models.VideoTemplateResponse `json:"templates"`
+}
+
+type AdminVideoTemplateList struct {
+	Templates []models.AdminVideoTemplateResponse `json:"templates"`
+}
+
+type VideoTemplateEnvelope struct {
+	Template models.AdminVideoTemplateResponse `json:"template"`
+}
+
+type FeatureFlagOverrideEnvelope struct {
+	Override models.FeatureFlagOverrideResponse `json:"override"`
+}
+
+// EvaluatedFlags maps each flag key to whether it is on for the caller.
+type EvaluatedFlags struct {
+	Flags map[string]bool `json:"flags"`
+}
+
+// CapabilityTable is what the caller's plan may generate with, next to
+// every plan's capabilities, least capable first, and what each video
+// model renders.
+type CapabilityTable struct {
+	Plan         string              `json:"plan"`
+	Capabilities config.Capabilities `json:"capabilities"`
+	Plans        []PlanCapabilities  `json:"plans"`
+	// AspectRatios maps each video model to the ratios it renders.
+	AspectRatios map[string][]string `json:"aspect_ratios"`
+}
+
+type PlanCapabilities struct {
+	Plan         string              `json:"plan"`
+	DisplayName  string              `json:"display_name"`
+	Capabilities config.Capabilities `json:"capabilities"`
+}
+
+type ModerationRuleEnvelope struct {
+	Rule models.ModerationRule `json:"rule"`
+}
+
+type DisposableDomainList struct {
+	Domains []models.DisposableDomain `json:"domains"`
+	Lists   disposable.Stats          `json:"lists"`
+}
+
+type DisposableDomainEnvelope struct {
+	Domain models.DisposableDomain `json:"domain"`
+}
+
+type DisposableBlockList struct {
+	From   time.Time                 `json:"from"`
+	Blocks []models.DisposableBlocks `json:"blocks"`
+}
+
+type ModerationRuleList struct {
+	Rules []models.ModerationRule `json:"rules"`
+}
+
+// PurgeResponse is the count of rows a dry run would remove, or the
+// message of a purge started in the background.
+type PurgeResponse struct {
+	Message string           `json:"message,omitempty"`
+	DryRun  bool             `json:"dry_run,omitempty"`
+	Cutoff  time.Time        `json:"cutoff"`
+	Counts  map[string]int64 `json:"counts,omitempty"`
+}
+
+type MaintenanceEnvelope struct {
+	Maintenance maintenance.State `json:"maintenance"`
+}
+
+type SettingsEnvelope struct {
+	Settings settings.Settings `json:"settings"`
+}
+
+type PublicStats struct {
+	Version       string `json:"version"`
+	UptimeSeconds int64  `json:"uptime_seconds"`
+}
+
+type HealthStatus struct {
+	Status      string            `json:"status"`
+	Service     string            `json:"service"`
+	Version     string            `json:"version"`
+	Maintenance maintenance.State `json:"maintenance"`
+}
+
+type LiveStatus struct {
+	Status string `json:"status"`
+}
+
+type SessionList struct {
+	Sessions []session.Info `json:"sessions"`
+}
+
+type LoginHistory struct {
+	Events []models.LoginEvent `json:"events"`
+}
+
+type APIKeyList struct {
+	APIKeys []models.APIKeyResponse `json:"api_keys"`
+}
+
+type SavedPromptList struct {
+	Prompts []models.SavedPromptResponse `json:"prompts"`
+}
+
+type SavedPromptEnvelope struct {
+	Message string                     `json:"message,omitempty"`
+	Prompt  models.SavedPromptResponse `json:"prompt"`
+}
+
+type PromptHistory struct {
+	History []models.PromptHistoryEntry `json:"history"`
+}
+
+type DraftList struct {
+	Drafts []models.DraftResponse `json:"drafts"`
+}
+
+type DraftEnvelope struct {
+	Message string               `json:"message,omitempty"`
+	Draft   models.DraftResponse `json:"draft"`
+}
+
+type SavedDraft struct {
+	ID        uint      `json:"id"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type CreatedAPIKey struct {
+	Message string                `json:"message"`
+	APIKey  models.APIKeyResponse `json:"api_key"`
+	Key     string                `json:"key"`
+}
+
+// LogoutAllResponse is the body of POST /logout-all.
+type LogoutAllResponse struct {
+	Message  string `json:"message"`
+	Sessions int    `json:"sessions"`
+}
@@ -0,0 +1,394 @@
+package purge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/zesbe/lumina-ai/internal/logger"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+const (
+	interval   = 24 * time.Hour
+	batchSize  = 500
+	batchPause = 200 * time.Millisecond
+
+	// LoginEventRetention is how long login history is kept, whatever
+	// the soft-delete cutoff.
+	LoginEventRetention = 90 * 24 * time.Hour
+	// ReadNotificationRetention is how long a notification is kept once
+	// it has been read. Unread ones stay until their user is purged.
+	ReadNotificationRetention = 90 * 24 * time.Hour
+)
+
+// ErrRunning is returned when a purge is already in progress on this
+// instance.
+var ErrRunning = errors.New("purge already running")
+
+var running atomic.Bool
+
+// Running reports whether a purge is in progress on this instance.
+func Running() bool {
+	return running.Load()
+}
+
+// Options controls a purge run.
+type Options struct {
+	// Cutoff is the soft-delete time before which rows are removed.
+	Cutoff time.Time
+	// DryRun only counts what would be removed.
+	DryRun bool
+	// UploadPath is where local media for /uploads/ URLs lives.
+	UploadPath string
+	// ExportDir is where data export bundles are written.
+	ExportDir string
+}
+
+// Report is the number of rows removed, or that would be, per table.
+type Report map[string]int64
+
+// step is one table in the purge, in foreign-key order.
+type step struct {
+	table string
+	model interface{}
+	// scope narrows the candidates beyond the soft-delete cutoff.
+	scope func(tx *gorm.DB) *gorm.DB
+	// beforeDelete runs in the batch transaction with the ids about to
+	// go and returns work to do once the batch is committed.
+	beforeDelete func(tx *gorm.DB, ids []uint) (func(), error)
+}
+
+// Start runs the purge daily, permanently deleting rows soft-deleted more
+// than retention ago. A retention of zero disables the schedule; the admin
+// endpoint still works.
+func Start(db *gorm.DB, retention time.Duration, uploadPath, exportDir string) {
+	if retention <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if _, err := Run(context.Background(), db, Options{
+				Cutoff:     time.Now().Add(-retention),
+				UploadPath: uploadPath,
+				ExportDir:  exportDir,
+			}); err != nil && !errors.Is(err, ErrRunning) {
+				logger.L().Error("purge failed", "error", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// Run purges soft-deleted rows older than opts.Cutoff: ledger entries and
+// subscriptions first, then generations (and their local media), then
+// users nothing references any more, and finally refresh tokens that
+// expired before it, login history older than LoginEventRetention,
+// notifications read more than ReadNotificationRetention ago, data
+// exports past their link's expiry and expired mailed tokens. Deletes are batched with a
+// pause between batches to keep lock times short, and batches are
+// claimed with SKIP LOCKED so several instances can run at once.
+func Run(ctx context.Context, db *gorm.DB, opts Options) (Report, error) {
+	if !running.CompareAndSwap(false, true) {
+		return nil, ErrRunning
+	}
+	defer running.Store(false)
+
+	report := Report{}
+	for _, s := range steps(opts) {
+		var n int64
+		var err error
+		if opts.DryRun {
+			n, err = count(ctx, db, s, opts.Cutoff)
+		} else {
+			n, err = purgeTable(ctx, db, s, opts.Cutoff)
+		}
+		report[s.table] = n
+		if err != nil {
+			return report, err
+		}
+	}
+
+	n, err := pruneRefreshTokens(ctx, db, opts)
+	report["refresh_tokens"] = n
+	if err != nil {
+		return report, err
+	}
+
+	n, err = pruneLoginEvents(ctx, db, opts)
+	report["login_events"] = n
+	if err != nil {
+		return report, err
+	}
+
+	n, err = pruneReadNotifications(ctx, db, opts)
+	report["notifications"] = n
+	if err != nil {
+		return report, err
+	}
+
+	n, err = pruneDataExports(ctx, db, opts)
+	report["data_exports"] = n
+	if err != nil {
+		return report, err
+	}
+
+	for _, t := range []struct {
+		table string
+		model interface{}
+	}{
+		{"magic_links", &models.MagicLink{}},
+		{"secure_account_tokens", &models.SecureAccountToken{}},
+		{"email_verifications", &models.EmailVerification{}},
+	} {
+		n, err = pruneExpired(ctx, db, opts, t.model)
+		report[t.table] = n
+		if err != nil {
+			return report, err
+		}
+	}
+
+	logger.L().Info("purge finished", "dry_run", opts.DryRun, "cutoff", opts.Cutoff, "counts", report)
+	return report, nil
+}
+
+func steps(opts Options) []step {
+	return []step{
+		{table: "credit_transactions", model: &models.CreditTransaction{}},
+		{table: "subscriptions", model: &models.Subscription{}},
+		{
+			table: "generations",
+			model: &models.Generation{},
+			beforeDelete: func(tx *gorm.DB, ids []uint) (func(), error) {
+				var media []models.Generation
+				if err := tx.Unscoped().Select("id", "output_url", "thumbnail_url").Where("id IN ?", ids).Find(&media).Error; err != nil {
+					return nil, err
+				}
+				return func() {
+					for _, g := range media {
+						DeleteMedia(opts.UploadPath, g.OutputURL, models.OriginalAudioURL(g.OutputURL), models.CleanMediaURL(g.OutputURL), g.ThumbnailURL)
+					}
+				}, nil
+			},
+		},
+		{
+			table: "users",
+			model: &models.User{},
+			// A user row can only go once the rows pointing at it have.
+			scope: func(tx *gorm.DB) *gorm.DB {
+				return tx.Where("NOT EXISTS (SELECT 1 FROM generations WHERE generations.user_id = users.id)").
+					Where("NOT EXISTS (SELECT 1 FROM subscriptions WHERE subscriptions.user_id = users.id)")
+			},
+			beforeDelete: func(tx *gorm.DB, ids []uint) (func(), error) {
+				if err := tx.Where("user_id IN ?", ids).Delete(&models.LoginEvent{}).Error; err != nil {
+					return nil, err
+				}
+				if err := tx.Where("user_id IN ?", ids).Delete(&models.EmailChange{}).Error; err != nil {
+					return nil, err
+				}
+				if err := tx.Where("user_id IN ?", ids).Delete(&models.AccountDeletion{}).Error; err != nil {
+					return nil, err
+				}
+				if err := tx.Where("user_id IN ?", ids).Delete(&models.DataExport{}).Error; err != nil {
+					return nil, err
+				}
+				if err := tx.Where("user_id IN ?", ids).Delete(&models.SecureAccountToken{}).Error; err != nil {
+					return nil, err
+				}
+				if err := tx.Where("user_id IN ?", ids).Delete(&models.EmailVerification{}).Error; err != nil {
+					return nil, err
+				}
+				if err := tx.Where("user_id IN ?", ids).Delete(&models.NotificationPreferences{}).Error; err != nil {
+					return nil, err
+				}
+				if err := tx.Where("user_id IN ?", ids).Delete(&models.Notification{}).Error; err != nil {
+					return nil, err
+				}
+				if err := tx.Where("referrer_id IN ? OR referred_id IN ?", ids, ids).Delete(&models.Referral{}).Error; err != nil {
+					return nil, err
+				}
+				return nil, tx.Where("user_id IN ?", ids).Delete(&models.FeatureFlagOverride{}).Error
+			},
+		},
+	}
+}
+
+func candidates(tx *gorm.DB, s step, cutoff time.Time) *gorm.DB {
+	q := tx.Unscoped().Model(s.model).Where(s.table+".deleted_at IS NOT NULL AND "+s.table+".deleted_at < ?", cutoff)
+	if s.scope != nil {
+		q = s.scope(q)
+	}
+	return q
+}
+
+func count(ctx context.Context, db *gorm.DB, s step, cutoff time.Time) (int64, error) {
+	var n int64
+	err := candidates(db.WithContext(ctx), s, cutoff).Count(&n).Error
+	return n, err
+}
+
+func purgeTable(ctx context.Context, db *gorm.DB, s step, cutoff time.Time) (int64, error) {
+	var total int64
+	for {
+		var ids []uint
+		var after func()
+		err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := candidates(tx, s, cutoff).
+				Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Order(s.table+".id").Limit(batchSize).
+				Pluck(s.table+".id", &ids).Error; err != nil {
+				return err
+			}
+			if len(ids) == 0 {
+				return nil
+			}
+			if s.beforeDelete != nil {
+				var err error
+				if after, err = s.beforeDelete(tx, ids); err != nil {
+					return err
+				}
+			}
+			return tx.Unscoped().Delete(s.model, ids).Error
+		})
+		if err != nil {
+			return total, err
+		}
+		if after != nil {
+			after()
+		}
+
+		total += int64(len(ids))
+		if len(ids) < batchSize {
+			return total, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return total, ctx.Err()
+		case <-time.After(batchPause):
+		}
+	}
+}
+
+// pruneRefreshTokens deletes refresh tokens that expired before the
+// cutoff. They are never soft-deleted; once expired they only serve to
+// recognize a reused token, and nobody else touches them, so one
+// statement is enough.
+func pruneRefreshTokens(ctx context.Context, db *gorm.DB, opts Options) (int64, error) {
+	q := db.WithContext(ctx).Where("expires_at < ?", opts.Cutoff)
+	if opts.DryRun {
+		var n int64
+		err := q.Model(&models.RefreshToken{}).Count(&n).Error
+		return n, err
+	}
+	res := q.Delete(&models.RefreshToken{})
+	return res.RowsAffected, res.Error
+}
+
+// pruneLoginEvents deletes login history older than
+// LoginEventRetention, in one statement like pruneRefreshTokens.
+func pruneLoginEvents(ctx context.Context, db *gorm.DB, opts Options) (int64, error) {
+	q := db.WithContext(ctx).Where("created_at < ?", time.Now().Add(-LoginEventRetention))
+	if opts.DryRun {
+		var n int64
+		err := q.Model(&models.LoginEvent{}).Count(&n).Error
+		return n, err
+	}
+	res := q.Delete(&models.LoginEvent{})
+	return res.RowsAffected, res.Error
+}
+
+// pruneReadNotifications deletes notifications read more than
+// ReadNotificationRetention ago, in one statement like
+// pruneRefreshTokens.
+func pruneReadNotifications(ctx context.Context, db *gorm.DB, opts Options) (int64, error) {
+	q := db.WithContext(ctx).Where("read_at < ?", time.Now().Add(-ReadNotificationRetention))
+	if opts.DryRun {
+		var n int64
+		err := q.Model(&models.Notification{}).Count(&n).Error
+		return n, err
+	}
+	res := q.Delete(&models.Notification{})
+	return res.RowsAffected, res.Error
+}
+
+// pruneDataExports deletes data exports, and their bundles, whose link
+// has expired or that failed. Rows younger than a day are kept so they
+// still count against the one-export-a-day limit.
+func pruneDataExports(ctx context.Context, db *gorm.DB, opts Options) (int64, error) {
+	q := db.WithContext(ctx).Model(&models.DataExport{}).
+		Where("(expires_at < ? OR status = ?) AND created_at < ?", time.Now(), models.ExportFailed, time.Now().Add(-24*time.Hour))
+	if opts.DryRun {
+		var n int64
+		err := q.Count(&n).Error
+		return n, err
+	}
+	var ids []uint
+	if err := q.Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		path := filepath.Join(opts.ExportDir, fmt.Sprintf("%d.zip", id))
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			logger.L().Warn("failed to delete data export", "path", path, "error", err)
+		}
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	res := db.WithContext(ctx).Delete(&models.DataExport{}, ids)
+	return res.RowsAffected, res.Error
+}
+
+// pruneExpired deletes mailed single-use tokens that have expired, used
+// or not, in one statement like pruneRefreshTokens.
+func pruneExpired(ctx context.Context, db *gorm.DB, opts Options, model interface{}) (int64, error) {
+	q := db.WithContext(ctx).Where("expires_at < ?", time.Now())
+	if opts.DryRun {
+		var n int64
+		err := q.Model(model).Count(&n).Error
+		return n, err
+	}
+	res := q.Delete(model)
+	return res.RowsAffected, res.Error
+}
+
+// DeleteMedia removes files behind /uploads/ URLs from uploadPath. Remote
+// URLs are left alone, and files that are already gone are not an error.
+func DeleteMedia(uploadPath string, urls ...string) {
+	for _, url := range urls {
+		path, ok := MediaPath(uploadPath, url)
+		if !ok {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			logger.L().Warn("failed to delete media file", "path", path, "error", err)
+		}
+	}
+}
+
+// MediaPath returns the file behind an /uploads/ URL, or false for remote
+// URLs and ones that would lead out of uploadPath.
+func MediaPath(uploadPath, url string) (string, bool) {
+	rel, ok := strings.CutPrefix(url, "/uploads/")
+	if !ok || rel == "" {
+		return "", false
+	}
+	path := filepath.Join(uploadPath, filepath.FromSlash(rel))
+	// Never follow a crafted URL out of the upload directory.
+	if !strings.HasPrefix(path, filepath.Clean(uploadPath)+string(filepath.Separator)) {
+		return "", false
+	}
+	return path, true
+}
@@ -0,0 +1,150 @@
+// Package reporting sends errors to an error tracker (Sentry). Without a
+// DSN it does nothing, so callers report unconditionally.
+package reporting
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/zesbe/lumina-ai/internal/config"
+)
+
+type Level string
+
+const (
+	LevelWarning Level = "warning"
+	LevelError   Level = "error"
+	LevelFatal   Level = "fatal"
+)
+
+// maxBodyBytes is the largest request body attached to an event.
+const maxBodyBytes = 8 << 10
+
+// throttleWindow is how long events sharing a ThrottleKey are dropped
+// after one is sent.
+const throttleWindow = time.Minute
+
+// Request is the HTTP request an error happened in.
+type Request struct {
+	Method  string
+	URL     string
+	Query   string
+	Headers map[string]string
+	Body    string
+}
+
+// Event is what is known about an error besides the error itself.
+// Capture scrubs credentials from it before it leaves the process.
+type Event struct {
+	Level   Level
+	Tags    map[string]string
+	Extra   map[string]interface{}
+	UserID  uint
+	Request *Request
+	// ThrottleKey limits events sharing it to one per minute, so a burst
+	// of the same failure, such as a provider outage, costs one event.
+	ThrottleKey string
+}
+
+// Reporter delivers events to an error tracker.
+type Reporter interface {
+	Capture(err error, ev Event)
+	// Flush waits up to timeout for queued events to be sent.
+	Flush(timeout time.Duration) bool
+}
+
+type noop struct{}
+
+func (noop) Capture(error, Event)     {}
+func (noop) Flush(time.Duration) bool { return true }
+
+var (
+	current Reporter = noop{}
+
+	throttleMu sync.Mutex
+	lastSent   = map[string]time.Time{}
+)
+
+// Init reports to Sentry when SENTRY_DSN is set. Events are sampled at
+// SENTRY_SAMPLE_RATE and tagged with the build version as the release.
+func Init(cfg *config.Config) error {
+	if cfg.SentryDSN == "" {
+		return nil
+	}
+	r, err := newSentry(cfg)
+	if err != nil {
+		return err
+	}
+	current = r
+	return nil
+}
+
+// Capture reports err. Level defaults to error.
+func Capture(err error, ev Event) {
+	if err == nil || !allow(ev.ThrottleKey) {
+		return
+	}
+	if ev.Level == "" {
+		ev.Level = LevelError
+	}
+	scrub(&ev)
+	current.Capture(err, ev)
+}
+
+// Flush waits up to timeout for queued events; call it before exiting.
+func Flush(timeout time.Duration) bool {
+	return current.Flush(timeout)
+}
+
+// FromRequest describes the request c is serving: method, URL, headers,
+// query and (small JSON) body, plus the request ID and user.
+func FromRequest(c *fiber.Ctx) Event {
+	ev := Event{Tags: map[string]string{}}
+	if id, ok := c.Locals("requestID").(string); ok {
+		ev.Tags["request_id"] = id
+	}
+	if userID, ok := c.Locals("userID").(uint); ok {
+		ev.UserID = userID
+	}
+
+	req := &Request{
+		Method:  c.Method(),
+		URL:     c.BaseURL() + c.Path(),
+		Query:   string(c.Request().URI().QueryString()),
+		Headers: map[string]string{},
+	}
+	c.Request().Header.VisitAll(func(key, value []byte) {
+		req.Headers[string(key)] = string(value)
+	})
+	if n := c.Request().Header.ContentLength(); n > 0 && n <= maxBodyBytes &&
+		strings.HasPrefix(string(c.Request().Header.ContentType()), fiber.MIMEApplicationJSON) {
+		req.Body = string(c.Body())
+	}
+	ev.Request = req
+	return ev
+}
+
+func allow(key string) bool {
+	if key == "" {
+		return true
+	}
+	throttleMu.Lock()
+	defer throttleMu.Unlock()
+
+	now := time.Now()
+	if last, ok := lastSent[key]; ok && now.Sub(last) < throttleWindow {
+		return false
+	}
+	lastSent[key] = now
+	if len(lastSent) > 1000 {
+		for k, t := range lastSent {
+			if now.Sub(t) >= throttleWindow {
+				delete(lastSent, k)
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,104 @@
+package reporting
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+)
+
+const filtered = "[Filtered]"
+
+// sensitiveHeaders are dropped from reported requests whatever their value.
+var sensitiveHeaders = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"cookie":              true,
+	"set-cookie":          true,
+	"x-api-key":           true,
+	"x-csrf-token":        true,
+}
+
+// sensitiveKeyParts mark body fields, query parameters and extras whose
+// values are never reported.
+var sensitiveKeyParts = []string{"password", "secret", "token", "api_key", "apikey", "authorization", "dsn"}
+
+func sensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, part := range sensitiveKeyParts {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// scrub replaces credentials in ev with a placeholder.
+func scrub(ev *Event) {
+	for k := range ev.Extra {
+		if sensitiveKey(k) {
+			ev.Extra[k] = filtered
+		}
+	}
+	req := ev.Request
+	if req == nil {
+		return
+	}
+	for k := range req.Headers {
+		if sensitiveHeaders[strings.ToLower(k)] || sensitiveKey(k) {
+			req.Headers[k] = filtered
+		}
+	}
+	req.Query = scrubQuery(req.Query)
+	req.Body = scrubBody(req.Body)
+}
+
+func scrubQuery(query string) string {
+	if query == "" {
+		return ""
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return filtered
+	}
+	for k := range values {
+		if sensitiveKey(k) {
+			values[k] = []string{filtered}
+		}
+	}
+	return values.Encode()
+}
+
+// scrubBody filters sensitive fields at any depth of a JSON body. Bodies
+// that aren't valid JSON are dropped rather than guessed at.
+func scrubBody(body string) string {
+	if body == "" {
+		return ""
+	}
+	var v interface{}
+	if err := json.Unmarshal([]byte(body), &v); err != nil {
+		return filtered
+	}
+	out, err := json.Marshal(scrubValue(v))
+	if err != nil {
+		return filtered
+	}
+	return string(out)
+}
+
+func scrubValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, inner := range v {
+			if sensitiveKey(k) {
+				v[k] = filtered
+			} else {
+				v[k] = scrubValue(inner)
+			}
+		}
+	case []interface{}:
+		for i, inner := range v {
+			v[i] = scrubValue(inner)
+		}
+	}
+	return v
+}
@@ -0,0 +1,59 @@
+package reporting
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+
+	"github.com/zesbe/lumina-ai/internal/config"
+	"github.com/zesbe/lumina-ai/internal/version"
+)
+
+type sentryReporter struct{}
+
+func newSentry(cfg *config.Config) (Reporter, error) {
+	err := sentry.Init(sentry.ClientOptions{
+		Dsn:              cfg.SentryDSN,
+		Environment:      cfg.Environment,
+		Release:          version.Version,
+		SampleRate:       cfg.SentrySampleRate,
+		AttachStacktrace: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sentryReporter{}, nil
+}
+
+func (sentryReporter) Capture(err error, ev Event) {
+	hub := sentry.CurrentHub().Clone()
+	scope := hub.Scope()
+	scope.SetLevel(sentry.Level(ev.Level))
+	scope.SetTags(ev.Tags)
+	if len(ev.Extra) > 0 {
+		scope.SetContext("details", sentry.Context(ev.Extra))
+	}
+	if ev.UserID != 0 {
+		scope.SetUser(sentry.User{ID: strconv.FormatUint(uint64(ev.UserID), 10)})
+	}
+	if req := ev.Request; req != nil {
+		// Set directly rather than through scope.SetRequest, which would
+		// read the headers again from an unscrubbed http.Request.
+		scope.AddEventProcessor(func(event *sentry.Event, _ *sentry.EventHint) *sentry.Event {
+			event.Request = &sentry.Request{
+				Method:      req.Method,
+				URL:         req.URL,
+				QueryString: req.Query,
+				Headers:     req.Headers,
+				Data:        req.Body,
+			}
+			return event
+		})
+	}
+	hub.CaptureException(err)
+}
+
+func (sentryReporter) Flush(timeout time.Duration) bool {
+	return sentry.Flush(timeout)
+}
@@ -0,0 +1,22 @@
+package server
+
+import (
+	"net"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RedirectToHTTPS permanently redirects every request to the same host
+// and path on httpsPort.
+func RedirectToHTTPS(httpsPort string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		host := c.Hostname()
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+		return c.Redirect("https://"+host+c.OriginalURL(), fiber.StatusPermanentRedirect)
+	}
+}
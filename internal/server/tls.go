@@ -0,0 +1,103 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/zesbe/lumina-ai/internal/logger"
+)
+
+// CertReloader serves a certificate pair from disk and can re-read it
+// without restarting, so renewed certificates are picked up by new
+// connections.
+type CertReloader struct {
+	certPath string
+	keyPath  string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+// NewCertReloader loads the pair once, failing if it can't be read.
+func NewCertReloader(certPath, keyPath string) (*CertReloader, error) {
+	r := &CertReloader{certPath: certPath, keyPath: keyPath}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload re-reads the pair. On error the previous certificate stays in
+// use.
+func (r *CertReloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certPath, r.keyPath)
+	if err != nil {
+		return fmt.Errorf("load server certificate: %w", err)
+	}
+	r.mu.Lock()
+	r.cert = &cert
+	r.mu.Unlock()
+	return nil
+}
+
+// GetCertificate is for tls.Config.GetCertificate.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// ReloadOnSIGHUP reloads the pair whenever the process receives SIGHUP.
+func (r *CertReloader) ReloadOnSIGHUP() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := r.Reload(); err != nil {
+				logger.L().Error("failed to reload TLS certificate", "error", err)
+				continue
+			}
+			logger.L().Info("reloaded TLS certificate", "cert", r.certPath)
+		}
+	}()
+}
+
+// TLSConfig serves the reloader's certificate.
+func TLSConfig(certs *CertReloader) *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certs.GetCertificate,
+	}
+}
+
+// MutualTLSConfig is TLSConfig that only accepts clients presenting a
+// certificate signed by a CA in caPath. An unreadable or empty CA file is
+// an error rather than a pool that trusts nothing.
+func MutualTLSConfig(certs *CertReloader, caPath string) (*tls.Config, error) {
+	pool, err := loadCAPool(caPath)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := TLSConfig(certs)
+	cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	cfg.ClientCAs = pool
+	return cfg, nil
+}
+
+func loadCAPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read client CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("client CA %s contains no PEM certificates", path)
+	}
+	return pool, nil
+}
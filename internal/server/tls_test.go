@@ -0,0 +1,264 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/zesbe/lumina-ai/internal/middleware"
+)
+
+// testCA is a certificate authority that issues test certificates.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a PEM certificate and key for subject, for server or
+// client use.
+func (ca *testCA) issue(t *testing.T, subject pkix.Name, server bool) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if server {
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		tmpl.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// serveMutualTLS starts an app behind MutualTLSConfig and ClientCert that
+// answers with the client certificate subject it saw.
+func serveMutualTLS(t *testing.T, ca *testCA, allowed []string) (addr string, certs *CertReloader, dir string) {
+	t.Helper()
+	dir = t.TempDir()
+	certPEM, keyPEM := ca.issue(t, pkix.Name{CommonName: "api.internal"}, true)
+	certs, err := NewCertReloader(writeFile(t, dir, "server.pem", certPEM), writeFile(t, dir, "server.key", keyPEM))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlsConfig, err := MutualTLSConfig(certs, writeFile(t, dir, "ca.pem", ca.pem))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Use(middleware.ClientCert(allowed))
+	app.Get("/whoami", func(c *fiber.Ctx) error {
+		return c.SendString(middleware.ClientCertSubject(c))
+	})
+	go app.Listener(ln)
+	t.Cleanup(func() { app.Shutdown() })
+	return ln.Addr().String(), certs, dir
+}
+
+// client trusts ca for the server and presents cert, if given.
+func client(t *testing.T, ca *testCA, certPEM, keyPEM []byte) *http.Client {
+	t.Helper()
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	cfg := &tls.Config{RootCAs: roots}
+	if certPEM != nil {
+		pair, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.Certificates = []tls.Certificate{pair}
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}, Timeout: 5 * time.Second}
+}
+
+func TestMutualTLS(t *testing.T) {
+	ca := newCA(t, "Lumina Internal CA")
+	rogue := newCA(t, "Rogue CA")
+	billingCert, billingKey := ca.issue(t, pkix.Name{CommonName: "billing", Organization: []string{"Lumina"}}, false)
+	reportsCert, reportsKey := ca.issue(t, pkix.Name{CommonName: "reports"}, false)
+	rogueCert, rogueKey := rogue.issue(t, pkix.Name{CommonName: "billing"}, false)
+
+	tests := []struct {
+		name       string
+		allowed    []string
+		cert, key  []byte
+		wantStatus int
+		wantBody   string
+		wantTLSErr bool
+	}{
+		{name: "trusted client", cert: billingCert, key: billingKey, wantStatus: 200, wantBody: "CN=billing,O=Lumina"},
+		{name: "no client certificate", wantTLSErr: true},
+		{name: "certificate from another CA", cert: rogueCert, key: rogueKey, wantTLSErr: true},
+		{name: "allowed by common name", allowed: []string{"billing"}, cert: billingCert, key: billingKey, wantStatus: 200, wantBody: "CN=billing,O=Lumina"},
+		{name: "allowed by subject", allowed: []string{"CN=reports"}, cert: reportsCert, key: reportsKey, wantStatus: 200, wantBody: "CN=reports"},
+		{name: "trusted but not allowed", allowed: []string{"billing"}, cert: reportsCert, key: reportsKey, wantStatus: 403},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, _, _ := serveMutualTLS(t, ca, tt.allowed)
+			resp, err := client(t, ca, tt.cert, tt.key).Get("https://" + addr + "/whoami")
+			if tt.wantTLSErr {
+				if err == nil {
+					resp.Body.Close()
+					t.Fatalf("status %d, want the handshake refused", resp.StatusCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status %d (%s), want %d", resp.StatusCode, body, tt.wantStatus)
+			}
+			if tt.wantBody != "" && string(body) != tt.wantBody {
+				t.Errorf("subject %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestCertReloaderPicksUpRenewedCertificate(t *testing.T) {
+	ca := newCA(t, "Lumina Internal CA")
+	addr, certs, dir := serveMutualTLS(t, ca, nil)
+	clientCert, clientKey := ca.issue(t, pkix.Name{CommonName: "billing"}, false)
+
+	serial := func() *big.Int {
+		t.Helper()
+		c := client(t, ca, clientCert, clientKey)
+		resp, err := c.Get("https://" + addr + "/whoami")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.TLS.PeerCertificates[0].SerialNumber
+	}
+	before := serial()
+
+	certPEM, keyPEM := ca.issue(t, pkix.Name{CommonName: "api.internal"}, true)
+	writeFile(t, dir, "server.pem", certPEM)
+	writeFile(t, dir, "server.key", keyPEM)
+	if err := certs.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if after := serial(); after.Cmp(before) == 0 {
+		t.Error("new connections still get the old certificate after Reload")
+	}
+
+	// A broken pair keeps the current certificate in use.
+	writeFile(t, dir, "server.key", []byte("not a key"))
+	if err := certs.Reload(); err == nil {
+		t.Fatal("Reload accepted a broken key")
+	}
+	serial()
+}
+
+func TestMutualTLSConfigRejectsBadCA(t *testing.T) {
+	ca := newCA(t, "Lumina Internal CA")
+	dir := t.TempDir()
+	certPEM, keyPEM := ca.issue(t, pkix.Name{CommonName: "api.internal"}, true)
+	certs, err := NewCertReloader(writeFile(t, dir, "server.pem", certPEM), writeFile(t, dir, "server.key", keyPEM))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, path, want string
+	}{
+		{"missing file", filepath.Join(dir, "missing.pem"), "read client CA"},
+		{"no certificates", writeFile(t, dir, "empty.pem", []byte("not a certificate\n")), "contains no PEM certificates"},
+	}
+	for _, tt := range tests {
+		if _, err := MutualTLSConfig(certs, tt.path); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+
+	cfg, err := MutualTLSConfig(certs, writeFile(t, dir, "ca.pem", ca.pem))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ClientAuth != tls.RequireAndVerifyClientCert || cfg.MinVersion != tls.VersionTLS12 {
+		t.Errorf("ClientAuth %v, MinVersion %x", cfg.ClientAuth, cfg.MinVersion)
+	}
+}
+
+func TestNewCertReloaderFailsOnBadPair(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := NewCertReloader(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")); err == nil {
+		t.Fatal("NewCertReloader accepted missing files")
+	}
+}
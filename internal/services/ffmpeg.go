@@ -0,0 +1,102 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrFFmpegTimeout is returned when an ffmpeg or ffprobe run outlives its
+// timeout.
+var ErrFFmpegTimeout = errors.New("ffmpeg timed out")
+
+// ffmpegOutputLimit is how much of ffmpeg's stderr is kept: the end,
+// where the error and loudnorm's measurements are.
+const ffmpegOutputLimit = 64 << 10
+
+// RunFFmpeg runs ffmpeg with args and returns the end of what it wrote to
+// stderr. It never reads stdin, and it is killed when ctx ends or after
+// timeout, whichever comes first. A failed run's error has the last line
+// of stderr.
+func RunFFmpeg(ctx context.Context, timeout time.Duration, args ...string) ([]byte, error) {
+	return runTool(ctx, timeout, "ffmpeg", nil, append([]string{"-nostdin", "-hide_banner"}, args...))
+}
+
+// ProbeDuration returns the length in seconds of the media at path, which
+// may be a URL, as ffprobe reads it from the container.
+func ProbeDuration(ctx context.Context, timeout time.Duration, path string) (float64, error) {
+	var stdout bytes.Buffer
+	if _, err := runTool(ctx, timeout, "ffprobe", &stdout, []string{
+		"-v", "error", "-show_entries", "format=duration", "-of", "default=noprint_wrappers=1:nokey=1", path,
+	}); err != nil {
+		return 0, err
+	}
+	seconds, err := strconv.ParseFloat(strings.TrimSpace(stdout.String()), 64)
+	if err != nil || seconds <= 0 || math.IsInf(seconds, 0) {
+		return 0, fmt.Errorf("ffprobe: no duration in %q", strings.TrimSpace(stdout.String()))
+	}
+	return seconds, nil
+}
+
+// runTool is RunFFmpeg for any of the ffmpeg tools, with stdout going to
+// stdout if it isn't nil.
+func runTool(ctx context.Context, timeout time.Duration, name string, stdout io.Writer, args []string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	stderr := &tailBuffer{limit: ffmpegOutputLimit}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.WaitDelay = 5 * time.Second
+
+	err := cmd.Run()
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return stderr.buf, ErrFFmpegTimeout
+	case ctx.Err() != nil:
+		return stderr.buf, ctx.Err()
+	case err != nil:
+		return stderr.buf, fmt.Errorf("%s: %w: %s", name, err, lastLine(stderr.buf))
+	}
+	return stderr.buf, nil
+}
+
+// thumbnailSize bounds the longer side of a video thumbnail, in pixels.
+const thumbnailSize = 480
+
+// ExtractThumbnail writes the frame one second into the video in, which
+// may be a URL, to out as a JPEG. It is scaled to fit thumbnailSize
+// square with the video's aspect ratio kept, so vertical and square
+// videos get vertical and square thumbnails.
+func ExtractThumbnail(ctx context.Context, timeout time.Duration, in, out string) error {
+	scale := fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease:force_divisible_by=2", thumbnailSize, thumbnailSize)
+	_, err := RunFFmpeg(ctx, timeout, "-y", "-ss", "1", "-i", in, "-frames:v", "1", "-vf", scale, "-q:v", "3", out)
+	return err
+}
+
+// tailBuffer keeps the last limit bytes written to it.
+type tailBuffer struct {
+	buf   []byte
+	limit int
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	if over := len(t.buf) - t.limit; over > 0 {
+		t.buf = append(t.buf[:0], t.buf[over:]...)
+	}
+	return len(p), nil
+}
+
+func lastLine(output []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
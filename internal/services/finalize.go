@@ -0,0 +1,150 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+var ErrInvalidOutcome = errors.New("outcome must be completed or failed")
+
+// ErrGenerationSettled is returned by FinalizeGeneration when the
+// generation already ended, such as a job finishing after support failed
+// it. Nothing is written.
+var ErrGenerationSettled = errors.New("generation already settled")
+
+// inProgress are the statuses a generation can still be finalized from.
+var inProgress = []models.GenerationStatus{models.StatusPending, models.StatusProcessing, models.StatusInterrupted}
+
+// Outcome is how a generation ended.
+type Outcome struct {
+	// Status is StatusCompleted or StatusFailed.
+	Status    models.GenerationStatus
+	OutputURL string
+	// OutputBytes is the size of an output stored under uploads.
+	OutputBytes  int64
+	ThumbnailURL string
+	// Metadata is merged into the generation's.
+	Metadata     models.GenerationMetadata
+	ErrorMessage string
+	// Charge is debited from the owner on completion.
+	Charge int
+	// Description goes on the ledger row: the usage entry on completion,
+	// the refund on failure.
+	Description string
+}
+
+// FinalizeGeneration records the end of a generation in one transaction:
+// the generation row and, on completion, the owner's debit and its ledger
+// row, or on failure a refund of anything already charged. Nothing is
+// written if any step fails, and generation is only updated in memory once
+// the transaction commits. It returns the credits moved, or
+// ErrGenerationSettled if the stored generation is no longer in progress.
+//
+// Callers invalidate caches and notify the owner after it returns, so
+// nobody is told about a state that was rolled back.
+func FinalizeGeneration(db *gorm.DB, generation *models.Generation, outcome Outcome) (int, error) {
+	if outcome.Status != models.StatusCompleted && outcome.Status != models.StatusFailed {
+		return 0, ErrInvalidOutcome
+	}
+
+	updated := *generation
+	updated.Status = outcome.Status
+	updated.ErrorMessage = outcome.ErrorMessage
+	if outcome.OutputURL != "" {
+		updated.OutputURL = outcome.OutputURL
+	}
+	if outcome.OutputBytes > 0 {
+		updated.OutputBytes = outcome.OutputBytes
+	}
+	if outcome.ThumbnailURL != "" {
+		updated.ThumbnailURL = outcome.ThumbnailURL
+	}
+	updated.MergeMetadata(outcome.Metadata)
+	if outcome.Status == models.StatusCompleted {
+		now := time.Now()
+		updated.CompletedAt = &now
+	}
+
+	var moved int
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// The status check and the write are one statement, so of two
+		// outcomes racing for the same generation only the first lands.
+		result := tx.Model(&updated).Where("status IN ?", inProgress).Select("*").Omit("User", "CreatedAt").Updates(&updated)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrGenerationSettled
+		}
+
+		if outcome.Status == models.StatusFailed {
+			var err error
+			moved, err = RefundGeneration(tx, &updated, outcome.Description)
+			return err
+		}
+
+		if outcome.Charge <= 0 {
+			return nil
+		}
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, updated.UserID).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&user).Update("credits", user.Credits-outcome.Charge).Error; err != nil {
+			return err
+		}
+		moved = outcome.Charge
+		return tx.Create(&models.CreditTransaction{
+			UserID:        user.ID,
+			Amount:        -outcome.Charge,
+			Type:          "usage",
+			Description:   outcome.Description,
+			GenerationID:  &updated.ID,
+			BalanceBefore: user.Credits,
+			BalanceAfter:  user.Credits - outcome.Charge,
+		}).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	*generation = updated
+	return moved, nil
+}
+
+// RefundGeneration gives back whatever the generation's ledger entries
+// net out to having charged, inside tx, and returns the amount.
+func RefundGeneration(tx *gorm.DB, generation *models.Generation, description string) (int, error) {
+	var charged int
+	if err := tx.Model(&models.CreditTransaction{}).
+		Where("generation_id = ?", generation.ID).
+		Select("COALESCE(-SUM(amount), 0)").Scan(&charged).Error; err != nil {
+		return 0, err
+	}
+	if charged <= 0 {
+		return 0, nil
+	}
+
+	var user models.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, generation.UserID).Error; err != nil {
+		return 0, err
+	}
+	if err := tx.Model(&user).Update("credits", user.Credits+charged).Error; err != nil {
+		return 0, err
+	}
+
+	return charged, tx.Create(&models.CreditTransaction{
+		UserID:        user.ID,
+		Amount:        charged,
+		Type:          "refund",
+		Description:   description,
+		GenerationID:  &generation.ID,
+		BalanceBefore: user.Credits,
+		BalanceAfter:  user.Credits + charged,
+	}).Error
+}
@@ -0,0 +1,266 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+var errInjected = errors.New("injected failure")
+
+func openDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := db.AutoMigrate(&models.User{}, &models.Generation{}, &models.CreditTransaction{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// failOn makes the next create or update of table fail, as a crash or a
+// lost connection in the middle of the transaction would.
+func failOn(t *testing.T, db *gorm.DB, op, table string) {
+	t.Helper()
+	fail := func(tx *gorm.DB) {
+		if tx.Statement.Table == table {
+			tx.AddError(errInjected)
+		}
+	}
+	var err error
+	switch op {
+	case "create":
+		err = db.Callback().Create().Before("gorm:create").Register("test:fail", fail)
+	case "update":
+		err = db.Callback().Update().Before("gorm:update").Register("test:fail", fail)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fixture is a user with 10 credits and a processing generation of
+// theirs, optionally already charged 3 credits.
+func fixture(t *testing.T, db *gorm.DB, charged bool) (models.User, models.Generation) {
+	t.Helper()
+	user := models.User{Email: "owner@example.com", PasswordHash: "x", Name: "Owner", Credits: 10}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	gen := models.Generation{UserID: user.ID, Type: models.TypeVideo, Status: models.StatusProcessing, Prompt: "a slow pan over the harbour"}
+	if err := db.Create(&gen).Error; err != nil {
+		t.Fatal(err)
+	}
+	if charged {
+		if err := db.Model(&user).Update("credits", 7).Error; err != nil {
+			t.Fatal(err)
+		}
+		user.Credits = 7
+		if err := db.Create(&models.CreditTransaction{UserID: user.ID, Amount: -3, Type: "usage", GenerationID: &gen.ID,
+			BalanceBefore: 10, BalanceAfter: 7}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return user, gen
+}
+
+type state struct {
+	status  models.GenerationStatus
+	output  string
+	credits int
+	ledger  []int
+}
+
+func snapshot(t *testing.T, db *gorm.DB, user models.User, gen models.Generation) state {
+	t.Helper()
+	var s state
+	var g models.Generation
+	if err := db.First(&g, gen.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	s.status, s.output = g.Status, g.OutputURL
+	var u models.User
+	if err := db.First(&u, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	s.credits = u.Credits
+	if err := db.Model(&models.CreditTransaction{}).Where("generation_id = ?", gen.ID).Order("id").
+		Pluck("amount", &s.ledger).Error; err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func (s state) equal(o state) bool {
+	if s.status != o.status || s.output != o.output || s.credits != o.credits || len(s.ledger) != len(o.ledger) {
+		return false
+	}
+	for i := range s.ledger {
+		if s.ledger[i] != o.ledger[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestFinalizeGeneration(t *testing.T) {
+	completed := Outcome{Status: models.StatusCompleted, OutputURL: "/uploads/out.mp4", Charge: 3, Description: "video"}
+	failed := Outcome{Status: models.StatusFailed, ErrorMessage: "provider error", Description: "refund"}
+
+	tests := []struct {
+		name      string
+		charged   bool
+		outcome   Outcome
+		want      state
+		wantMoved int
+	}{
+		{name: "completion debits and records usage", outcome: completed,
+			want: state{models.StatusCompleted, "/uploads/out.mp4", 7, []int{-3}}, wantMoved: 3},
+		{name: "free completion", outcome: Outcome{Status: models.StatusCompleted, OutputURL: "/uploads/out.mp4"},
+			want: state{models.StatusCompleted, "/uploads/out.mp4", 10, nil}},
+		{name: "failure refunds the charge", charged: true, outcome: failed,
+			want: state{models.StatusFailed, "", 10, []int{-3, 3}}, wantMoved: 3},
+		{name: "failure before any charge", outcome: failed,
+			want: state{models.StatusFailed, "", 10, nil}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openDB(t)
+			user, gen := fixture(t, db, tt.charged)
+
+			moved, err := FinalizeGeneration(db, &gen, tt.outcome)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if moved != tt.wantMoved {
+				t.Errorf("moved %d credits, want %d", moved, tt.wantMoved)
+			}
+			if got := snapshot(t, db, user, gen); !got.equal(tt.want) {
+				t.Errorf("stored %+v, want %+v", got, tt.want)
+			}
+			if gen.Status != tt.outcome.Status {
+				t.Errorf("in-memory status %q, want %q", gen.Status, tt.outcome.Status)
+			}
+			if tt.outcome.Status == models.StatusCompleted && gen.CompletedAt == nil {
+				t.Error("CompletedAt not set")
+			}
+		})
+	}
+}
+
+func TestFinalizeGenerationRollsBack(t *testing.T) {
+	completed := Outcome{Status: models.StatusCompleted, OutputURL: "/uploads/out.mp4", Charge: 3, Description: "video"}
+	failed := Outcome{Status: models.StatusFailed, ErrorMessage: "provider error", Description: "refund"}
+
+	tests := []struct {
+		name    string
+		charged bool
+		outcome Outcome
+		op      string
+		table   string
+	}{
+		{name: "generation save fails", outcome: completed, op: "update", table: "generations"},
+		{name: "debit fails", outcome: completed, op: "update", table: "users"},
+		{name: "usage row fails", outcome: completed, op: "create", table: "credit_transactions"},
+		{name: "refund credit fails", charged: true, outcome: failed, op: "update", table: "users"},
+		{name: "refund row fails", charged: true, outcome: failed, op: "create", table: "credit_transactions"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openDB(t)
+			user, gen := fixture(t, db, tt.charged)
+			before := snapshot(t, db, user, gen)
+			inMemory := gen
+
+			failOn(t, db, tt.op, tt.table)
+			moved, err := FinalizeGeneration(db, &gen, tt.outcome)
+			if !errors.Is(err, errInjected) {
+				t.Fatalf("error = %v, want the injected failure", err)
+			}
+			if moved != 0 {
+				t.Errorf("moved %d credits on failure", moved)
+			}
+			if got := snapshot(t, db, user, gen); !got.equal(before) {
+				t.Errorf("stored %+v after the failure, want it untouched: %+v", got, before)
+			}
+			if gen.Status != inMemory.Status || gen.OutputURL != inMemory.OutputURL || gen.CompletedAt != nil {
+				t.Errorf("in-memory generation changed to %q %q", gen.Status, gen.OutputURL)
+			}
+		})
+	}
+}
+
+func TestFinalizeGenerationRejectsOtherStatuses(t *testing.T) {
+	db := openDB(t)
+	user, gen := fixture(t, db, false)
+	before := snapshot(t, db, user, gen)
+
+	for _, status := range []models.GenerationStatus{models.StatusPending, models.StatusProcessing, ""} {
+		if _, err := FinalizeGeneration(db, &gen, Outcome{Status: status}); !errors.Is(err, ErrInvalidOutcome) {
+			t.Errorf("status %q: error = %v, want ErrInvalidOutcome", status, err)
+		}
+	}
+	if got := snapshot(t, db, user, gen); !got.equal(before) {
+		t.Errorf("stored %+v, want it untouched", got)
+	}
+}
+
+// TestFinalizeGenerationSettlesOnce has two copies of a processing
+// generation settle it, as support force-failing it while its job runs
+// does: only the first outcome is recorded.
+func TestFinalizeGenerationSettlesOnce(t *testing.T) {
+	completed := Outcome{Status: models.StatusCompleted, OutputURL: "/uploads/out.mp4", Charge: 3, Description: "video"}
+	failed := Outcome{Status: models.StatusFailed, ErrorMessage: "Failed by support: stuck", Description: "refund"}
+
+	tests := []struct {
+		name          string
+		first, second Outcome
+		want          state
+	}{
+		{name: "force-fail, then the job completes", first: failed, second: completed,
+			want: state{models.StatusFailed, "", 10, nil}},
+		{name: "the job completes, then force-fail", first: completed, second: failed,
+			want: state{models.StatusCompleted, "/uploads/out.mp4", 7, []int{-3}}},
+		{name: "failed twice", first: failed, second: failed,
+			want: state{models.StatusFailed, "", 10, nil}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openDB(t)
+			user, gen := fixture(t, db, false)
+			support, job := gen, gen
+
+			if _, err := FinalizeGeneration(db, &support, tt.first); err != nil {
+				t.Fatal(err)
+			}
+			moved, err := FinalizeGeneration(db, &job, tt.second)
+			if !errors.Is(err, ErrGenerationSettled) {
+				t.Fatalf("second outcome: error = %v, want ErrGenerationSettled", err)
+			}
+			if moved != 0 {
+				t.Errorf("second outcome moved %d credits", moved)
+			}
+			if got := snapshot(t, db, user, gen); !got.equal(tt.want) {
+				t.Errorf("stored %+v, want %+v", got, tt.want)
+			}
+			if job.Status != models.StatusProcessing {
+				t.Errorf("in-memory status %q after a refused outcome, want it unchanged", job.Status)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+// loudnessLRA is the loudness range loudnorm aims for; with linear
+// normalization it only matters when the range is already wider.
+const loudnessLRA = 11
+
+// LoudnessTarget is what NormalizeLoudness aims for: integrated loudness
+// in LUFS and the true-peak ceiling in dBTP.
+type LoudnessTarget struct {
+	Integrated float64
+	TruePeak   float64
+}
+
+// loudnormStats is the JSON loudnorm prints at the end of a run. It
+// prints numbers as strings, "-inf" for silence.
+type loudnormStats struct {
+	InputI       string `json:"input_i"`
+	InputTP      string `json:"input_tp"`
+	InputLRA     string `json:"input_lra"`
+	InputThresh  string `json:"input_thresh"`
+	OutputI      string `json:"output_i"`
+	OutputTP     string `json:"output_tp"`
+	OutputLRA    string `json:"output_lra"`
+	TargetOffset string `json:"target_offset"`
+}
+
+// NormalizeLoudness writes an MP3 of in normalized to target to out, at
+// bitrate bits per second, in two loudnorm passes: the first measures,
+// the second applies one linear gain from the measurements. Each pass is
+// one ffmpeg run bounded by timeout.
+func NormalizeLoudness(ctx context.Context, timeout time.Duration, in, out string, target LoudnessTarget, bitrate int) (*models.Loudness, error) {
+	filter := fmt.Sprintf("loudnorm=I=%g:TP=%g:LRA=%d", target.Integrated, target.TruePeak, loudnessLRA)
+
+	output, err := RunFFmpeg(ctx, timeout, "-i", in, "-af", filter+":print_format=json", "-f", "null", "-")
+	if err != nil {
+		return nil, err
+	}
+	measured, err := parseLoudnorm(output)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := strconv.ParseFloat(measured.InputI, 64); err != nil {
+		return nil, errors.New("loudnorm: input is silent")
+	}
+
+	// loudnorm resamples to 192 kHz internally; write the common rate back.
+	filter += fmt.Sprintf(":measured_I=%s:measured_TP=%s:measured_LRA=%s:measured_thresh=%s:offset=%s:linear=true:print_format=json",
+		measured.InputI, measured.InputTP, measured.InputLRA, measured.InputThresh, measured.TargetOffset)
+	output, err = RunFFmpeg(ctx, timeout, "-y", "-i", in, "-af", filter, "-ar", "44100",
+		"-c:a", "libmp3lame", "-b:a", strconv.Itoa(bitrate), out)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := parseLoudnorm(output)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.Loudness{
+		TargetLUFS:     target.Integrated,
+		InputLUFS:      loudnormNumber(applied.InputI),
+		InputTruePeak:  loudnormNumber(applied.InputTP),
+		InputLRA:       loudnormNumber(applied.InputLRA),
+		OutputLUFS:     loudnormNumber(applied.OutputI),
+		OutputTruePeak: loudnormNumber(applied.OutputTP),
+		OutputLRA:      loudnormNumber(applied.OutputLRA),
+	}, nil
+}
+
+// parseLoudnorm reads the last JSON object in ffmpeg's output, which is
+// where loudnorm prints its stats.
+func parseLoudnorm(output []byte) (*loudnormStats, error) {
+	start := bytes.LastIndexByte(output, '{')
+	end := bytes.LastIndexByte(output, '}')
+	if start < 0 || end < start {
+		return nil, errors.New("loudnorm: no measurements in ffmpeg output")
+	}
+	var stats loudnormStats
+	if err := json.Unmarshal(output[start:end+1], &stats); err != nil {
+		return nil, fmt.Errorf("loudnorm: %w", err)
+	}
+	return &stats, nil
+}
+
+// loudnormNumber parses one of loudnorm's numbers; "-inf" and anything
+// else unparseable is reported as 0 rather than breaking the JSON it ends
+// up in.
+func loudnormNumber(s string) float64 {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0
+	}
+	return f
+}
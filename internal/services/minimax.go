@@ -2,24 +2,31 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/zesbe/lumina-ai/internal/logger"
+	"github.com/zesbe/lumina-ai/internal/tracing"
 )
 
 var (
 	ErrMiniMaxAPIKeyMissing = errors.New("MiniMax API key is not configured")
 	ErrMiniMaxRequestFailed = errors.New("MiniMax API request failed")
 	ErrMiniMaxJobFailed     = errors.New("MiniMax job failed")
+	ErrMiniMaxUnauthorized  = errors.New("MiniMax rejected the API key")
 	ErrNarrationTooLong     = errors.New("narration too long for video duration")
 )
 
@@ -28,6 +35,8 @@ type MiniMaxService struct {
 	groupID    string
 	httpClient *http.Client
 	baseURL    string
+	logger     *slog.Logger
+	ctx        context.Context
 }
 
 type AudioSetting struct {
@@ -42,6 +51,9 @@ type MusicGenerationRequest struct {
 	Prompt       string       `json:"prompt"`
 	Lyrics       string       `json:"lyrics,omitempty"`
 	AudioSetting AudioSetting `json:"audio_setting"`
+	// Duration is the length asked for, in seconds, for models that take
+	// a hint.
+	Duration int `json:"duration,omitempty"`
 }
 
 type VideoGenerationRequest struct {
@@ -49,6 +61,9 @@ type VideoGenerationRequest struct {
 	Prompt     string `json:"prompt"`
 	Duration   int    `json:"duration,omitempty"`
 	Resolution string `json:"resolution,omitempty"`
+	// AspectRatio is only sent when it isn't the default, which every
+	// model renders.
+	AspectRatio string `json:"aspect_ratio,omitempty"`
 }
 
 type TTSRequest struct {
@@ -160,6 +175,58 @@ func NewMiniMaxService(apiKey, groupID string) *MiniMaxService {
 	}
 }
 
+// WithLogger returns a copy of the service that logs through l, so calls
+// made for a generation job carry its fields (generation ID, request ID).
+func (s *MiniMaxService) WithLogger(l *slog.Logger) *MiniMaxService {
+	clone := *s
+	clone.logger = l
+	return &clone
+}
+
+// WithContext returns a copy of the service whose calls are parented to
+// (and cancelled with) ctx.
+func (s *MiniMaxService) WithContext(ctx context.Context) *MiniMaxService {
+	clone := *s
+	clone.ctx = ctx
+	return &clone
+}
+
+// WithHTTPClient returns a copy of the service that makes its calls, and
+// downloads outputs, through client.
+func (s *MiniMaxService) WithHTTPClient(client *http.Client) *MiniMaxService {
+	clone := *s
+	clone.httpClient = client
+	return &clone
+}
+
+func (s *MiniMaxService) baseContext() context.Context {
+	if s.ctx != nil {
+		return s.ctx
+	}
+	return context.Background()
+}
+
+// startSpan starts a client span for a provider call; callers end it via
+// endSpan so failures are recorded.
+func (s *MiniMaxService) startSpan(name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(s.baseContext(), "minimax."+name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+func endSpan(span trace.Span, err error) {
+	tracing.RecordError(span, err)
+	span.End()
+}
+
+func (s *MiniMaxService) log() *slog.Logger {
+	if s.logger != nil {
+		return s.logger
+	}
+	return logger.L()
+}
+
 func (s *MiniMaxService) IsConfigured() bool {
 	return s.apiKey != ""
 }
@@ -193,7 +260,13 @@ func CalculateOptimalSpeed(text string, videoDuration int) (float64, error) {
 	return float64(int(requiredSpeed*10)) / 10, nil
 }
 
-func (s *MiniMaxService) GenerateMusic(prompt, lyrics, format, model string, bitrate int) (*MusicResponse, error) {
+// GenerateMusic asks for a track. duration is the length wanted in
+// seconds, 0 for the model's default; it is only passed on to models that
+// take a length hint.
+func (s *MiniMaxService) GenerateMusic(prompt, lyrics, format, model string, bitrate, duration int) (_ *MusicResponse, err error) {
+	ctx, span := s.startSpan("generate_music", attribute.String("minimax.model", model))
+	defer func() { endSpan(span, err) }()
+
 	if !s.IsConfigured() {
 		return nil, ErrMiniMaxAPIKeyMissing
 	}
@@ -209,6 +282,9 @@ func (s *MiniMaxService) GenerateMusic(prompt, lyrics, format, model string, bit
 			Format:     format,
 		},
 	}
+	if MusicModelSpecs[model].DurationHint {
+		reqBody.Duration = duration
+	}
 
 	jsonBody, err := json.Marshal(reqBody)
 	if err != nil {
@@ -217,7 +293,7 @@ func (s *MiniMaxService) GenerateMusic(prompt, lyrics, format, model string, bit
 
 	url := "https://api.minimax.io/v1/music_generation"
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonBody))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonBody))
 	if err != nil {
 		return nil, err
 	}
@@ -248,7 +324,10 @@ func (s *MiniMaxService) GenerateMusic(prompt, lyrics, format, model string, bit
 	return &result, nil
 }
 
-func (s *MiniMaxService) GenerateImage(prompt string) (string, error) {
+func (s *MiniMaxService) GenerateImage(prompt string) (_ string, err error) {
+	ctx, span := s.startSpan("generate_image")
+	defer func() { endSpan(span, err) }()
+
 	if !s.IsConfigured() {
 		return "", ErrMiniMaxAPIKeyMissing
 	}
@@ -265,9 +344,9 @@ func (s *MiniMaxService) GenerateImage(prompt string) (string, error) {
 	}
 
 	url := fmt.Sprintf("%s/image_generation?GroupId=%s", s.baseURL, s.groupID)
-	log.Printf("[MiniMax] Image generation started")
+	s.log().Info("minimax image generation started")
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonBody))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonBody))
 	if err != nil {
 		return "", err
 	}
@@ -286,7 +365,7 @@ func (s *MiniMaxService) GenerateImage(prompt string) (string, error) {
 		return "", err
 	}
 
-	log.Printf("[MiniMax] Image response: %s", string(body)[:200])
+	s.log().Debug("minimax image response", "body", truncate(string(body), 200))
 
 	var result ImageGenerationResponse
 	if err := json.Unmarshal(body, &result); err != nil {
@@ -308,7 +387,10 @@ func (s *MiniMaxService) GenerateTTS(text string, voiceID string) (*TTSResponse,
 	return s.GenerateTTSWithSpeed(text, voiceID, 1.0)
 }
 
-func (s *MiniMaxService) GenerateTTSWithSpeed(text string, voiceID string, speed float64) (*TTSResponse, error) {
+func (s *MiniMaxService) GenerateTTSWithSpeed(text string, voiceID string, speed float64) (_ *TTSResponse, err error) {
+	ctx, span := s.startSpan("generate_tts", attribute.String("minimax.voice_id", voiceID))
+	defer func() { endSpan(span, err) }()
+
 	if !s.IsConfigured() {
 		return nil, ErrMiniMaxAPIKeyMissing
 	}
@@ -346,9 +428,9 @@ func (s *MiniMaxService) GenerateTTSWithSpeed(text string, voiceID string, speed
 	}
 
 	url := fmt.Sprintf("https://api.minimax.io/v1/t2a_v2?GroupId=%s", s.groupID)
-	log.Printf("[TTS] Generating with speed: %.1fx, text length: %d chars", speed, len(text))
+	s.log().Info("minimax tts started", "speed", speed, "text_length", len(text))
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonBody))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonBody))
 	if err != nil {
 		return nil, err
 	}
@@ -379,7 +461,10 @@ func (s *MiniMaxService) GenerateTTSWithSpeed(text string, voiceID string, speed
 	return &result, nil
 }
 
-func (s *MiniMaxService) GenerateVideo(prompt string, duration int, resolution string, model string) (*VideoResponse, error) {
+func (s *MiniMaxService) GenerateVideo(prompt string, duration int, resolution string, model string, aspectRatio string) (_ *VideoResponse, err error) {
+	ctx, span := s.startSpan("generate_video", attribute.String("minimax.model", model))
+	defer func() { endSpan(span, err) }()
+
 	if !s.IsConfigured() {
 		return nil, ErrMiniMaxAPIKeyMissing
 	}
@@ -409,6 +494,9 @@ func (s *MiniMaxService) GenerateVideo(prompt string, duration int, resolution s
 		Prompt:   prompt,
 		Duration: duration,
 	}
+	if aspectRatio != DefaultAspectRatio {
+		reqBody.AspectRatio = aspectRatio
+	}
 
 	if model == "MiniMax-Hailuo-02" || model == "hailuo-02" {
 		if resolution == "" {
@@ -423,9 +511,9 @@ func (s *MiniMaxService) GenerateVideo(prompt string, duration int, resolution s
 	}
 
 	url := fmt.Sprintf("%s/video_generation?GroupId=%s", s.baseURL, s.groupID)
-	log.Printf("[MiniMax] Video - Model: %s, Duration: %d, Resolution: %s", model, duration, resolution)
+	s.log().Info("minimax video generation started", "model", model, "duration", duration, "resolution", resolution)
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonBody))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonBody))
 	if err != nil {
 		return nil, err
 	}
@@ -453,17 +541,22 @@ func (s *MiniMaxService) GenerateVideo(prompt string, duration int, resolution s
 		return nil, fmt.Errorf("%w: %s", ErrMiniMaxRequestFailed, result.BaseResp.StatusMsg)
 	}
 
+	span.SetAttributes(attribute.String("minimax.task_id", result.TaskID))
+
 	return &result, nil
 }
 
-func (s *MiniMaxService) GetTaskStatus(taskID string) (*MiniMaxTaskStatus, error) {
+func (s *MiniMaxService) GetTaskStatus(taskID string) (_ *MiniMaxTaskStatus, err error) {
+	ctx, span := s.startSpan("get_task_status", attribute.String("minimax.task_id", taskID))
+	defer func() { endSpan(span, err) }()
+
 	if !s.IsConfigured() {
 		return nil, ErrMiniMaxAPIKeyMissing
 	}
 
 	url := fmt.Sprintf("%s/query/video_generation?task_id=%s", s.baseURL, taskID)
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -493,14 +586,56 @@ func (s *MiniMaxService) GetTaskStatus(taskID string) (*MiniMaxTaskStatus, error
 	return &result, nil
 }
 
-func (s *MiniMaxService) GetFileDownloadURL(fileID string) (string, error) {
+// minimaxAuthFailed is the base_resp status code for a rejected key.
+const minimaxAuthFailed = 1004
+
+// VerifyKey makes the cheapest authenticated call available, looking up a
+// task that doesn't exist, to learn whether MiniMax accepts the key. Any
+// answer except an authentication failure counts as accepted.
+func (s *MiniMaxService) VerifyKey() (err error) {
+	ctx, span := s.startSpan("verify_key")
+	defer func() { endSpan(span, err) }()
+
+	if !s.IsConfigured() {
+		return ErrMiniMaxAPIKeyMissing
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", s.baseURL+"/query/video_generation?task_id=0", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.apiKey)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return ErrMiniMaxUnauthorized
+	}
+	var result MiniMaxTaskStatus
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("%w: unexpected response (HTTP %d)", ErrMiniMaxRequestFailed, resp.StatusCode)
+	}
+	if result.BaseResp.StatusCode == minimaxAuthFailed {
+		return ErrMiniMaxUnauthorized
+	}
+	return nil
+}
+
+func (s *MiniMaxService) GetFileDownloadURL(fileID string) (_ string, err error) {
+	ctx, span := s.startSpan("get_file", attribute.String("minimax.file_id", fileID))
+	defer func() { endSpan(span, err) }()
+
 	if !s.IsConfigured() {
 		return "", ErrMiniMaxAPIKeyMissing
 	}
 
 	url := fmt.Sprintf("%s/files/retrieve?file_id=%s", s.baseURL, fileID)
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return "", err
 	}
@@ -530,13 +665,19 @@ func (s *MiniMaxService) GetFileDownloadURL(fileID string) (string, error) {
 	return result.File.DownloadURL, nil
 }
 
-func (s *MiniMaxService) WaitForCompletion(taskID string, timeout time.Duration) (*MiniMaxTaskStatus, error) {
+func (s *MiniMaxService) WaitForCompletion(taskID string, timeout time.Duration) (_ *MiniMaxTaskStatus, err error) {
+	ctx, span := s.startSpan("wait_for_completion", attribute.String("minimax.task_id", taskID))
+	defer func() { endSpan(span, err) }()
+	s = s.WithContext(ctx)
+
 	deadline := time.Now().Add(timeout)
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
 
 	for {
 		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
 		case <-ticker.C:
 			if time.Now().After(deadline) {
 				return nil, errors.New("timeout")
@@ -547,7 +688,7 @@ func (s *MiniMaxService) WaitForCompletion(taskID string, timeout time.Duration)
 				continue
 			}
 
-			log.Printf("[MiniMax] Task %s: %s", taskID, status.Status)
+			s.log().Debug("minimax task status", "task_id", taskID, "status", status.Status)
 
 			switch status.Status {
 			case "Success", "Completed":
@@ -566,13 +707,19 @@ func (s *MiniMaxService) WaitForCompletion(taskID string, timeout time.Duration)
 	}
 }
 
-func (s *MiniMaxService) CombineVideoWithAudio(videoURL string, audioHex string, outputPath string) error {
+// CombineVideoWithAudio muxes the narration onto the video at videoURL.
+// The ffmpeg run is cancelled with the service's context and killed after
+// timeout.
+func (s *MiniMaxService) CombineVideoWithAudio(videoURL string, audioHex string, outputPath string, timeout time.Duration) (err error) {
+	ctx, span := s.startSpan("combine_video_audio")
+	defer func() { endSpan(span, err) }()
+
 	tempDir := filepath.Join(os.TempDir(), fmt.Sprintf("lumina_%d", time.Now().UnixNano()))
 	os.MkdirAll(tempDir, 0755)
 	defer os.RemoveAll(tempDir)
 
 	videoPath := filepath.Join(tempDir, "video.mp4")
-	if err := downloadFile(videoURL, videoPath); err != nil {
+	if err := s.download(ctx, videoURL, videoPath); err != nil {
 		return err
 	}
 
@@ -580,24 +727,53 @@ func (s *MiniMaxService) CombineVideoWithAudio(videoURL string, audioHex string,
 	audioBytes, _ := hex.DecodeString(audioHex)
 	os.WriteFile(audioPath, audioBytes, 0644)
 
-	cmd := exec.Command("ffmpeg", "-y", "-i", videoPath, "-i", audioPath, "-c:v", "copy", "-c:a", "aac", "-shortest", outputPath)
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("ffmpeg: %s", string(output))
-	}
+	_, err = RunFFmpeg(ctx, timeout, "-y", "-i", videoPath, "-i", audioPath, "-c:v", "copy", "-c:a", "aac", "-shortest", outputPath)
+	return err
+}
 
-	return nil
+// DownloadOutput saves the provider output at url to path. The file is
+// written next to path and moved into place once complete, so a failed
+// download never leaves a partial file behind.
+func (s *MiniMaxService) DownloadOutput(url, path string) (err error) {
+	ctx, span := s.startSpan("download_output")
+	defer func() { endSpan(span, err) }()
+	return s.download(ctx, url, path)
 }
 
-func downloadFile(url string, filepath string) error {
-	resp, err := http.Get(url)
+func (s *MiniMaxService) download(ctx context.Context, url, path string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.httpClient.Do(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download failed: HTTP %d", resp.StatusCode)
+	}
 
-	out, _ := os.Create(filepath)
-	defer out.Close()
+	tmp := path + ".part"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
 
-	io.Copy(out, resp.Body)
-	return nil
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
 }
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"slices"
+	"sort"
+)
+
+// DefaultAspectRatio is what every video model renders when no ratio is
+// asked for, and what videos from before the choice existed are.
+const DefaultAspectRatio = "16:9"
+
+// VideoModelSpec is what a MiniMax video model accepts beyond a prompt.
+type VideoModelSpec struct {
+	AspectRatios []string
+}
+
+// VideoModelSpecs are the MiniMax video models and what each supports.
+// Which plans may use them is config.Capabilities.
+var VideoModelSpecs = map[string]VideoModelSpec{
+	"video-01":          {AspectRatios: []string{"16:9"}},
+	"T2V-01":            {AspectRatios: []string{"16:9"}},
+	"T2V-01-Director":   {AspectRatios: []string{"16:9", "9:16"}},
+	"MiniMax-Hailuo-02": {AspectRatios: []string{"16:9", "9:16", "1:1"}},
+	"hailuo-02":         {AspectRatios: []string{"16:9", "9:16", "1:1"}},
+}
+
+// SupportsAspectRatio reports whether model renders ratio. Unknown models
+// only render the default.
+func SupportsAspectRatio(model, ratio string) bool {
+	if spec, ok := VideoModelSpecs[model]; ok {
+		return slices.Contains(spec.AspectRatios, ratio)
+	}
+	return ratio == DefaultAspectRatio
+}
+
+// ModelsWithAspectRatio lists the video models that render ratio, sorted.
+func ModelsWithAspectRatio(ratio string) []string {
+	var models []string
+	for model, spec := range VideoModelSpecs {
+		if slices.Contains(spec.AspectRatios, ratio) {
+			models = append(models, model)
+		}
+	}
+	sort.Strings(models)
+	return models
+}
+
+// MusicModelSpec is the track lengths a MiniMax music model can be asked
+// for, in seconds, and whether it takes a length hint at all; models that
+// don't are asked without one and their tracks come out as long as the
+// lyrics make them.
+type MusicModelSpec struct {
+	MinDuration  int
+	MaxDuration  int
+	DurationHint bool
+}
+
+// MusicModelSpecs are the MiniMax music models and the lengths each
+// produces.
+var MusicModelSpecs = map[string]MusicModelSpec{
+	"music-2.0": {MinDuration: 15, MaxDuration: 300, DurationHint: true},
+	"music-1.5": {MinDuration: 15, MaxDuration: 240},
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+// RewardReferral pays out the referral userID signed up with, if it is
+// still pending: bonus credits to them and, unless the referrer already
+// earned monthlyCap rewards this UTC month, to the referrer. It is called
+// when a generation completes, so the first completed one pays. It
+// returns the referral if it paid out, or nil. A bonus of zero pays
+// nothing and leaves referrals pending.
+func RewardReferral(db *gorm.DB, userID uint, bonus, monthlyCap int) (*models.Referral, error) {
+	if bonus <= 0 {
+		return nil, nil
+	}
+
+	var referral models.Referral
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("referred_id = ? AND status = ?", userID, models.ReferralPending).
+			Limit(1).Find(&referral).Error; err != nil || referral.ID == 0 {
+			return err
+		}
+
+		// Locking the referrer also keeps two of their referrals paying
+		// out at once from both fitting under the cap.
+		var referrer models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND is_active = ?", referral.ReferrerID, true).
+			Limit(1).Find(&referrer).Error; err != nil {
+			return err
+		}
+		referral.Status = models.ReferralCapped
+		if referrer.ID != 0 {
+			earned, err := ReferralRewardsThisMonth(tx, referrer.ID)
+			if err != nil {
+				return err
+			}
+			if earned < int64(monthlyCap) {
+				if err := grantReferralCredits(tx, &referrer, bonus, "Referral bonus"); err != nil {
+					return err
+				}
+				referral.Status, referral.ReferrerCredits = models.ReferralRewarded, bonus
+			}
+		}
+
+		var referred models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&referred, userID).Error; err != nil {
+			return err
+		}
+		if err := grantReferralCredits(tx, &referred, bonus, "Welcome bonus for joining through a referral"); err != nil {
+			return err
+		}
+		now := time.Now()
+		referral.ReferredCredits, referral.RewardedAt = bonus, &now
+		return tx.Save(&referral).Error
+	})
+	if err != nil || referral.RewardedAt == nil {
+		return nil, err
+	}
+	return &referral, nil
+}
+
+// ReferralRewardsThisMonth counts the referrals that paid referrerID in
+// the current UTC month, which is what the monthly cap applies to.
+func ReferralRewardsThisMonth(db *gorm.DB, referrerID uint) (int64, error) {
+	now := time.Now().UTC()
+	var n int64
+	err := db.Model(&models.Referral{}).
+		Where("referrer_id = ? AND status = ? AND rewarded_at >= ?", referrerID, models.ReferralRewarded,
+			time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)).
+		Count(&n).Error
+	return n, err
+}
+
+// grantReferralCredits adds amount to a user locked by the caller, with
+// its ledger row.
+func grantReferralCredits(tx *gorm.DB, user *models.User, amount int, description string) error {
+	before := user.Credits
+	if err := tx.Model(user).Update("credits", before+amount).Error; err != nil {
+		return err
+	}
+	return tx.Create(&models.CreditTransaction{
+		UserID:        user.ID,
+		Amount:        amount,
+		Type:          "referral",
+		Description:   description,
+		BalanceBefore: before,
+		BalanceAfter:  before + amount,
+	}).Error
+}
@@ -0,0 +1,45 @@
+package session
+
+import (
+	"context"
+	"time"
+
+	"github.com/zesbe/lumina-ai/internal/cache"
+)
+
+const (
+	denyPrefix = "revoked_session:"
+	// denyTimeout bounds the lookup JWTAuth makes on every request, so a
+	// struggling Redis slows requests down by at most this much.
+	denyTimeout = 250 * time.Millisecond
+)
+
+// Deny makes the access tokens of the given sessions stop working now
+// rather than when they expire. ttl is the access token lifetime: no token
+// of a session can outlive that, so neither does the entry. Access tokens
+// are denied by session rather than by JTI, so one lookup covers every
+// token a session still has out. Without Redis nothing can be denied and
+// only the refresh tokens are revoked.
+func Deny(ttl time.Duration, sessionIDs ...string) error {
+	if cache.Cache == nil {
+		return nil
+	}
+	for _, id := range sessionIDs {
+		if err := cache.Cache.Set(denyPrefix+id, true, ttl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Denied reports whether the session's access tokens were revoked. An
+// error means Redis couldn't be asked; what to do then is up to the
+// caller.
+func Denied(ctx context.Context, sessionID string) (bool, error) {
+	if cache.Cache == nil || sessionID == "" {
+		return false, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, denyTimeout)
+	defer cancel()
+	return cache.Cache.Has(ctx, denyPrefix+sessionID)
+}
@@ -0,0 +1,98 @@
+package session
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+// Family names the browser and operating system in a user agent, e.g.
+// "Chrome" and "Windows". Versions are left out, so updates don't make a
+// device look new; anything unrecognized is "Other".
+func Family(userAgent string) (browser, os string) {
+	browser, os = "Other", "Other"
+	switch {
+	case strings.Contains(userAgent, "Edg/"), strings.Contains(userAgent, "EdgA/"), strings.Contains(userAgent, "EdgiOS/"):
+		browser = "Edge"
+	case strings.Contains(userAgent, "OPR/"), strings.Contains(userAgent, "Opera"):
+		browser = "Opera"
+	case strings.Contains(userAgent, "SamsungBrowser/"):
+		browser = "Samsung Internet"
+	case strings.Contains(userAgent, "Firefox/"), strings.Contains(userAgent, "FxiOS/"):
+		browser = "Firefox"
+	case strings.Contains(userAgent, "Chrome/"), strings.Contains(userAgent, "CriOS/"):
+		browser = "Chrome"
+	case strings.Contains(userAgent, "Safari/"):
+		browser = "Safari"
+	}
+	switch {
+	case strings.Contains(userAgent, "Windows"):
+		os = "Windows"
+	case strings.Contains(userAgent, "Android"):
+		os = "Android"
+	case strings.Contains(userAgent, "iPhone"), strings.Contains(userAgent, "iPad"):
+		os = "iOS"
+	case strings.Contains(userAgent, "Mac OS X"), strings.Contains(userAgent, "Macintosh"):
+		os = "macOS"
+	case strings.Contains(userAgent, "CrOS"):
+		os = "ChromeOS"
+	case strings.Contains(userAgent, "Linux"):
+		os = "Linux"
+	}
+	return browser, os
+}
+
+// NetworkPrefix is the /24 (IPv4) or /48 (IPv6) around ip, which stays
+// the same through the address changes a phone or home connection goes
+// through but not a move to another network. It is empty for an address
+// that doesn't parse.
+func NetworkPrefix(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap()
+	bits := 48
+	if addr.Is4() {
+		bits = 24
+	}
+	prefix, _ := addr.Prefix(bits)
+	return prefix.String()
+}
+
+// Fingerprint identifies the device loosely, by browser and OS family and
+// network prefix, as a hex SHA-256.
+func (d Device) Fingerprint() string {
+	browser, os := Family(d.UserAgent)
+	sum := sha256.Sum256([]byte(browser + "/" + os + "|" + NetworkPrefix(d.IP)))
+	return hex.EncodeToString(sum[:])
+}
+
+// Name describes the device for people, e.g. "Chrome on Windows".
+func (d Device) Name() string {
+	browser, os := Family(d.UserAgent)
+	return browser + " on " + os
+}
+
+// KnownDevice reports whether any session of userID was issued to a
+// device with the same fingerprint. Until the user has a fingerprinted
+// session to compare against, every device counts as known, so neither
+// sign-up nor the first login after fingerprints were introduced looks
+// new.
+func KnownDevice(db *gorm.DB, userID uint, device Device) (bool, error) {
+	var fingerprints []string
+	if err := db.Model(&models.RefreshToken{}).Where("user_id = ? AND fingerprint <> ''", userID).
+		Distinct().Pluck("fingerprint", &fingerprints).Error; err != nil {
+		return false, err
+	}
+	if len(fingerprints) == 0 {
+		return true, nil
+	}
+	return slices.Contains(fingerprints, device.Fingerprint()), nil
+}
@@ -0,0 +1,260 @@
+// Package session keeps refresh tokens server-side so they can be rotated
+// and revoked. Each login starts a session; every refresh consumes the
+// presented token and issues the next one in the same session. A consumed
+// token coming back means two parties hold the session, so the whole
+// session is revoked.
+package session
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/zesbe/lumina-ai/internal/auth"
+	"github.com/zesbe/lumina-ai/internal/crypto"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+var (
+	// ErrInvalid is a refresh token that doesn't verify, was never
+	// recorded or has been revoked.
+	ErrInvalid = errors.New("invalid refresh token")
+	// ErrReused is a refresh token that was already exchanged. Its
+	// session has been revoked.
+	ErrReused = errors.New("refresh token reused")
+)
+
+// Info describes a session that can still be refreshed.
+type Info struct {
+	ID string `json:"id"`
+	// UserAgent and IP are those of the latest login or refresh.
+	UserAgent       string     `json:"user_agent"`
+	IP              string     `json:"ip"`
+	CreatedAt       time.Time  `json:"created_at"`
+	LastRefreshedAt *time.Time `json:"last_refreshed_at,omitempty"`
+	Current         bool       `json:"current"`
+}
+
+// Device is where a token was issued to.
+type Device struct {
+	UserAgent string
+	IP        string
+}
+
+// DeviceOf reads the device from the request.
+func DeviceOf(c *fiber.Ctx) Device {
+	return Device{
+		// Copy out of the fasthttp buffers, which are reused after the
+		// handler returns.
+		UserAgent: truncate(string(c.Request().Header.UserAgent()), 255),
+		IP:        c.IP(),
+	}
+}
+
+// Start opens a session for user and issues its first token pair.
+func Start(db *gorm.DB, jwt *auth.JWTService, user *models.User, device Device) (*auth.TokenPair, error) {
+	sessionID := uuid.NewString()
+	tokens, err := jwt.GenerateTokenPair(user.ID, user.Email, user.Role, user.Plan, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Create(record(tokens, user.ID, sessionID, device)).Error; err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// Rotate exchanges a refresh token for a new pair in the same session and
+// consumes it. The claims of the presented token come back with every
+// result that got as far as verifying it, so the caller can audit a reuse.
+func Rotate(db *gorm.DB, jwt *auth.JWTService, refreshToken string, device Device) (*auth.TokenPair, *auth.Claims, error) {
+	claims, err := jwt.ParseRefreshToken(refreshToken)
+	if err != nil {
+		return nil, nil, ErrInvalid
+	}
+
+	var tokens *auth.TokenPair
+	var reused bool
+	err = db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		// Consuming is a compare-and-set, so of two requests racing with
+		// the same token only one gets a new pair.
+		consumed := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND token_hash = ? AND consumed_at IS NULL AND revoked_at IS NULL", claims.ID, crypto.HashToken(refreshToken)).
+			Update("consumed_at", now)
+		if consumed.Error != nil {
+			return consumed.Error
+		}
+
+		if consumed.RowsAffected == 0 {
+			var existing models.RefreshToken
+			if err := tx.Where("id = ?", claims.ID).First(&existing).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return ErrInvalid
+				}
+				return err
+			}
+			if existing.TokenHash != crypto.HashToken(refreshToken) || existing.RevokedAt != nil {
+				return ErrInvalid
+			}
+			// Consumed before: revoke, and commit that rather than
+			// returning an error that would roll it back.
+			reused = true
+			return revokeSession(tx, existing.SessionID, now)
+		}
+
+		// The new pair carries the user's current role and plan, not the
+		// ones the session started with, and a deactivated account can't
+		// refresh at all.
+		var user models.User
+		if err := tx.Select("id", "email", "role", "plan", "is_active").First(&user, claims.UserID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalid
+			}
+			return err
+		}
+		if !user.IsActive {
+			return ErrInvalid
+		}
+
+		tokens, err = jwt.GenerateTokenPair(user.ID, user.Email, user.Role, user.Plan, claims.SessionID)
+		if err != nil {
+			return err
+		}
+		return tx.Create(record(tokens, claims.UserID, claims.SessionID, device)).Error
+	})
+	switch {
+	case err != nil:
+		return nil, claims, err
+	case reused:
+		return nil, claims, ErrReused
+	}
+	return tokens, claims, nil
+}
+
+// Active lists the user's sessions that can still be refreshed, most
+// recently used first. current is the caller's session, flagged in the
+// list.
+func Active(db *gorm.DB, userID uint, current string) ([]Info, error) {
+	// Each live session has exactly one unconsumed token, the latest.
+	var live []models.RefreshToken
+	if err := db.Where("user_id = ? AND consumed_at IS NULL AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("created_at DESC").Find(&live).Error; err != nil {
+		return nil, err
+	}
+	if len(live) == 0 {
+		return []Info{}, nil
+	}
+
+	ids := make([]string, len(live))
+	for i, t := range live {
+		ids[i] = t.SessionID
+	}
+	var starts []struct {
+		SessionID string
+		StartedAt time.Time
+	}
+	if err := db.Model(&models.RefreshToken{}).Select("session_id, MIN(created_at) AS started_at").
+		Where("session_id IN ?", ids).Group("session_id").Scan(&starts).Error; err != nil {
+		return nil, err
+	}
+	startedAt := make(map[string]time.Time, len(starts))
+	for _, s := range starts {
+		startedAt[s.SessionID] = s.StartedAt
+	}
+
+	sessions := make([]Info, len(live))
+	for i, t := range live {
+		info := Info{
+			ID:        t.SessionID,
+			UserAgent: t.UserAgent,
+			IP:        t.IP,
+			CreatedAt: t.CreatedAt,
+			Current:   t.SessionID == current,
+		}
+		if started, ok := startedAt[t.SessionID]; ok && started.Before(t.CreatedAt) {
+			refreshed := t.CreatedAt
+			info.CreatedAt, info.LastRefreshedAt = started, &refreshed
+		}
+		sessions[i] = info
+	}
+	return sessions, nil
+}
+
+// StartedAt returns when userID logged in to start the session, which
+// tells how recently they proved who they are.
+func StartedAt(db *gorm.DB, userID uint, sessionID string) (time.Time, error) {
+	var first models.RefreshToken
+	err := db.Select("created_at").Where("session_id = ? AND user_id = ?", sessionID, userID).
+		Order("created_at").First(&first).Error
+	return first.CreatedAt, err
+}
+
+// Revoke ends one session; its refresh tokens stop working.
+func Revoke(db *gorm.DB, sessionID string) error {
+	return revokeSession(db, sessionID, time.Now())
+}
+
+// RevokeOwned ends a session of userID and reports whether there was one
+// to end, so users can't touch each other's sessions.
+func RevokeOwned(db *gorm.DB, userID uint, sessionID string) (bool, error) {
+	result := db.Model(&models.RefreshToken{}).
+		Where("session_id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+// RevokeUser ends every session of a user and returns their IDs.
+func RevokeUser(db *gorm.DB, userID uint) ([]string, error) {
+	return revokeUserExcept(db, userID, "")
+}
+
+// RevokeOthers ends every session of a user but keep and returns their
+// IDs.
+func RevokeOthers(db *gorm.DB, userID uint, keep string) ([]string, error) {
+	return revokeUserExcept(db, userID, keep)
+}
+
+func revokeUserExcept(db *gorm.DB, userID uint, keep string) ([]string, error) {
+	var sessionIDs []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		scope := func() *gorm.DB {
+			return tx.Model(&models.RefreshToken{}).
+				Where("user_id = ? AND revoked_at IS NULL AND session_id <> ?", userID, keep)
+		}
+		if err := scope().Distinct().Pluck("session_id", &sessionIDs).Error; err != nil {
+			return err
+		}
+		return scope().Update("revoked_at", time.Now()).Error
+	})
+	return sessionIDs, err
+}
+
+func revokeSession(tx *gorm.DB, sessionID string, now time.Time) error {
+	return tx.Model(&models.RefreshToken{}).
+		Where("session_id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", now).Error
+}
+
+func record(tokens *auth.TokenPair, userID uint, sessionID string, device Device) *models.RefreshToken {
+	return &models.RefreshToken{
+		ID:          tokens.RefreshID,
+		SessionID:   sessionID,
+		UserID:      userID,
+		TokenHash:   crypto.HashToken(tokens.RefreshToken),
+		UserAgent:   device.UserAgent,
+		IP:          device.IP,
+		Fingerprint: device.Fingerprint(),
+		ExpiresAt:   tokens.RefreshExpiresAt,
+	}
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
@@ -0,0 +1,187 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/zesbe/lumina-ai/internal/auth"
+	"github.com/zesbe/lumina-ai/internal/cache"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+var testDevice = Device{UserAgent: "test", IP: "192.0.2.1"}
+
+func openDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := db.AutoMigrate(&models.User{}, &models.RefreshToken{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// start opens a session for a new active user.
+func start(t *testing.T, db *gorm.DB, jwt *auth.JWTService) (*models.User, *auth.TokenPair) {
+	t.Helper()
+	user := &models.User{Email: "session@example.com", Name: "Session", Role: "user", Plan: "free", IsActive: true}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := Start(db, jwt, user, testDevice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user, tokens
+}
+
+func testJWT() *auth.JWTService {
+	return auth.NewJWTService(auth.HMACKeys("session-test-secret-at-least-32-characters"), 15*time.Minute, time.Hour)
+}
+
+func TestRotateReuseRevokesSession(t *testing.T) {
+	db, jwt := openDB(t), testJWT()
+	user, first := start(t, db, jwt)
+
+	second, claims, err := Rotate(db, jwt, first.RefreshToken, testDevice)
+	if err != nil {
+		t.Fatalf("first rotation: %v", err)
+	}
+	third, _, err := Rotate(db, jwt, second.RefreshToken, testDevice)
+	if err != nil {
+		t.Fatalf("second rotation: %v", err)
+	}
+
+	// The first token again: someone else holds a copy.
+	_, reused, err := Rotate(db, jwt, first.RefreshToken, testDevice)
+	if !errors.Is(err, ErrReused) {
+		t.Fatalf("reusing a consumed token: %v, want ErrReused", err)
+	}
+	if reused == nil || reused.UserID != user.ID || reused.SessionID != claims.SessionID {
+		t.Fatalf("claims of the reused token = %+v, want user %d session %s", reused, user.ID, claims.SessionID)
+	}
+
+	// The whole session goes, the live token included.
+	if _, _, err := Rotate(db, jwt, third.RefreshToken, testDevice); !errors.Is(err, ErrInvalid) {
+		t.Errorf("latest token after reuse: %v, want ErrInvalid", err)
+	}
+	var live int64
+	db.Model(&models.RefreshToken{}).Where("session_id = ? AND revoked_at IS NULL", claims.SessionID).Count(&live)
+	if live != 0 {
+		t.Errorf("%d tokens of the session still unrevoked", live)
+	}
+	if active, err := Active(db, user.ID, ""); err != nil || len(active) != 0 {
+		t.Errorf("Active = %v, %v; want no sessions", active, err)
+	}
+
+	// Reusing it once more is just invalid: there is nothing left to
+	// revoke.
+	if _, _, err := Rotate(db, jwt, first.RefreshToken, testDevice); !errors.Is(err, ErrInvalid) {
+		t.Errorf("reuse after revocation: %v, want ErrInvalid", err)
+	}
+}
+
+func TestRotateLeavesOtherSessions(t *testing.T) {
+	db, jwt := openDB(t), testJWT()
+	user, first := start(t, db, jwt)
+	other, err := Start(db, jwt, user, testDevice)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := Rotate(db, jwt, first.RefreshToken, testDevice); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Rotate(db, jwt, first.RefreshToken, testDevice); !errors.Is(err, ErrReused) {
+		t.Fatalf("reuse: %v, want ErrReused", err)
+	}
+	if _, _, err := Rotate(db, jwt, other.RefreshToken, testDevice); err != nil {
+		t.Errorf("the user's other session: %v, want it to keep working", err)
+	}
+}
+
+func TestRotateRejects(t *testing.T) {
+	db, jwt := openDB(t), testJWT()
+	user, tokens := start(t, db, jwt)
+
+	if _, _, err := Rotate(db, jwt, tokens.AccessToken, testDevice); !errors.Is(err, ErrInvalid) {
+		t.Errorf("access token: %v, want ErrInvalid", err)
+	}
+	if _, _, err := Rotate(db, jwt, tokens.RefreshToken+"x", testDevice); !errors.Is(err, ErrInvalid) {
+		t.Errorf("tampered token: %v, want ErrInvalid", err)
+	}
+	other := auth.NewJWTService(auth.HMACKeys("another-secret-that-is-32-characters-long"), 15*time.Minute, time.Hour)
+	if _, _, err := Rotate(db, other, tokens.RefreshToken, testDevice); !errors.Is(err, ErrInvalid) {
+		t.Errorf("token signed with another key: %v, want ErrInvalid", err)
+	}
+
+	// A deactivated account can't refresh, and the token isn't spent on
+	// the attempt.
+	db.Model(user).Update("is_active", false)
+	if _, _, err := Rotate(db, jwt, tokens.RefreshToken, testDevice); !errors.Is(err, ErrInvalid) {
+		t.Errorf("deactivated user: %v, want ErrInvalid", err)
+	}
+	db.Model(user).Update("is_active", true)
+	if _, _, err := Rotate(db, jwt, tokens.RefreshToken, testDevice); err != nil {
+		t.Errorf("after reactivating: %v", err)
+	}
+}
+
+func TestRevokedSessionCantRefresh(t *testing.T) {
+	db, jwt := openDB(t), testJWT()
+	_, tokens := start(t, db, jwt)
+	claims, err := jwt.ParseRefreshToken(tokens.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Revoke(db, claims.SessionID); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Rotate(db, jwt, tokens.RefreshToken, testDevice); !errors.Is(err, ErrInvalid) {
+		t.Errorf("after logout: %v, want ErrInvalid", err)
+	}
+}
+
+func TestDeny(t *testing.T) {
+	mr := miniredis.RunT(t)
+	if err := cache.InitRedis("redis://" + mr.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cache.Cache.Close()
+		cache.Cache = nil
+	})
+
+	if err := Deny(15*time.Minute, "revoked-1", "revoked-2"); err != nil {
+		t.Fatal(err)
+	}
+	for id, want := range map[string]bool{"revoked-1": true, "revoked-2": true, "live": false, "": false} {
+		if got, err := Denied(context.Background(), id); err != nil || got != want {
+			t.Errorf("Denied(%q) = %v, %v; want %v", id, got, err, want)
+		}
+	}
+
+	// No access token outlives the entry's TTL, so neither does it.
+	mr.FastForward(15*time.Minute + time.Second)
+	if got, _ := Denied(context.Background(), "revoked-1"); got {
+		t.Error("entry outlived the access token lifetime")
+	}
+}
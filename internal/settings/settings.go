@@ -0,0 +1,205 @@
+package settings
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/zesbe/lumina-ai/internal/cache"
+	"github.com/zesbe/lumina-ai/internal/logger"
+)
+
+const (
+	redisKey = "runtime_settings"
+	// refreshInterval bounds how long an instance keeps using stale
+	// settings after they are changed elsewhere.
+	refreshInterval = 5 * time.Second
+)
+
+// Settings are the knobs that can be changed at runtime, without a
+// restart. Everything else in config.Config is read once at boot.
+type Settings struct {
+	RateLimitRequests      int `json:"rate_limit_requests" validate:"required,min=1,max=1000000"`
+	RateLimitWindowSeconds int `json:"rate_limit_window_seconds" validate:"required,min=1,max=86400"`
+	// ListCountCacheSeconds is how long list totals are reused.
+	ListCountCacheSeconds int `json:"list_count_cache_seconds" validate:"min=0,max=3600"`
+	AnalyticsCacheSeconds int `json:"analytics_cache_seconds" validate:"min=0,max=86400"`
+	// MaintenanceMessage is shown during maintenance when the switch was
+	// flipped without a message of its own.
+	MaintenanceMessage      string `json:"maintenance_message" validate:"max=500,noxss"`
+	MusicCreditCost         int    `json:"music_credit_cost" validate:"min=0,max=1000"`
+	VideoCreditCost         int    `json:"video_credit_cost" validate:"min=0,max=1000"`
+	NarratedVideoCreditCost int    `json:"narrated_video_credit_cost" validate:"min=0,max=1000"`
+	// MusicCreditCostPerMinute is added to MusicCreditCost for each
+	// started minute past the first of a requested track length.
+	MusicCreditCostPerMinute int `json:"music_credit_cost_per_minute" validate:"min=0,max=1000"`
+	// DailyGenerationLimits caps generations started per UTC day, by
+	// plan. Plans that aren't listed, or are listed as 0, are unlimited.
+	DailyGenerationLimits map[string]int `json:"daily_generation_limits"`
+	// ReferralBonusCredits go to both sides of a referral when the
+	// referred account completes its first generation; 0 pauses payouts.
+	ReferralBonusCredits int `json:"referral_bonus_credits" validate:"min=0,max=1000"`
+	// ReferralMonthlyCap is how many referrals pay the referrer per UTC
+	// month; the referred side is paid regardless.
+	ReferralMonthlyCap int `json:"referral_monthly_cap" validate:"min=0,max=1000"`
+	// LowCreditThreshold is the balance a charge has to take a user below
+	// for them to get a credits_low notification; 0 sends none.
+	LowCreditThreshold int `json:"low_credit_threshold" validate:"min=0,max=100000"`
+	// PublishFilters are the lists a generation's title, style and lyrics
+	// are checked against before it goes on Explore, by language code.
+	// The text's language isn't known, so every list is checked.
+	PublishFilters map[string]PublishFilter `json:"publish_filters"`
+	// SavedPromptLimits caps how many saved prompts a user can keep, by
+	// plan. Plans that aren't listed, or are listed as 0, are unlimited.
+	SavedPromptLimits map[string]int `json:"saved_prompt_limits"`
+}
+
+// MusicCost is what a music generation asking for seconds of audio costs;
+// 0 is no length asked for.
+func (s Settings) MusicCost(seconds int) int {
+	cost := s.MusicCreditCost
+	if seconds > 60 {
+		cost += s.MusicCreditCostPerMinute * ((seconds - 1) / 60)
+	}
+	return cost
+}
+
+// PublishFilter is one language's publish lists. An entry is a word or
+// phrase, matched whole and without regard to case or leetspeak, or a
+// regular expression between slashes. A hard match stops publishing; a
+// soft one holds the generation for an admin to review.
+type PublishFilter struct {
+	Hard []string `json:"hard"`
+	Soft []string `json:"soft"`
+}
+
+// RateLimitWindow is RateLimitWindowSeconds as a duration.
+func (s Settings) RateLimitWindow() time.Duration {
+	return time.Duration(s.RateLimitWindowSeconds) * time.Second
+}
+
+// ListCountCacheTTL is ListCountCacheSeconds as a duration; zero means
+// don't cache.
+func (s Settings) ListCountCacheTTL() time.Duration {
+	return time.Duration(s.ListCountCacheSeconds) * time.Second
+}
+
+// AnalyticsCacheTTL is AnalyticsCacheSeconds as a duration; zero means
+// don't cache.
+func (s Settings) AnalyticsCacheTTL() time.Duration {
+	return time.Duration(s.AnalyticsCacheSeconds) * time.Second
+}
+
+// Clone returns a copy that shares no maps or slices with s.
+func (s Settings) Clone() Settings {
+	limits := make(map[string]int, len(s.DailyGenerationLimits))
+	for plan, n := range s.DailyGenerationLimits {
+		limits[plan] = n
+	}
+	s.DailyGenerationLimits = limits
+	savedPrompts := make(map[string]int, len(s.SavedPromptLimits))
+	for plan, n := range s.SavedPromptLimits {
+		savedPrompts[plan] = n
+	}
+	s.SavedPromptLimits = savedPrompts
+	filters := make(map[string]PublishFilter, len(s.PublishFilters))
+	for lang, f := range s.PublishFilters {
+		filters[lang] = PublishFilter{
+			Hard: append(make([]string, 0, len(f.Hard)), f.Hard...),
+			Soft: append(make([]string, 0, len(f.Soft)), f.Soft...),
+		}
+	}
+	s.PublishFilters = filters
+	return s
+}
+
+var (
+	mu        sync.RWMutex
+	defaults  Settings
+	current   Settings
+	checkedAt time.Time
+	hooks     []func(old, new Settings)
+)
+
+// Init sets the values used until an admin changes them, normally taken
+// from the boot config. Settings stored in Redis take precedence.
+func Init(d Settings) {
+	mu.Lock()
+	defaults, current, checkedAt = d.Clone(), d.Clone(), time.Time{}
+	mu.Unlock()
+}
+
+// OnChange registers fn to run whenever this instance picks up new
+// settings, whether set here or on another instance.
+func OnChange(fn func(old, new Settings)) {
+	mu.Lock()
+	hooks = append(hooks, fn)
+	mu.Unlock()
+}
+
+// Current returns the settings, re-reading Redis at most every few seconds
+// so it is cheap enough to call on every request. Callers get their own
+// copy.
+func Current() Settings {
+	mu.RLock()
+	s, fresh := current, time.Since(checkedAt) < refreshInterval
+	mu.RUnlock()
+	if fresh || cache.Cache == nil {
+		return s.Clone()
+	}
+
+	// Stored settings are read over the defaults, so fields added since
+	// they were saved start from their boot value rather than zero.
+	mu.RLock()
+	stored := defaults.Clone()
+	mu.RUnlock()
+	err := cache.Cache.Get(redisKey, &stored)
+	switch {
+	case errors.Is(err, redis.Nil):
+	case err != nil:
+		// Keep the last known settings if Redis is briefly unavailable.
+		logger.L().Warn("failed to read runtime settings", "error", err)
+		stored = s
+	}
+
+	apply(stored)
+	return stored.Clone()
+}
+
+// Set stores new settings for every instance and applies them here
+// immediately. Callers validate first.
+func Set(s Settings) error {
+	s = s.Clone()
+	if cache.Cache != nil {
+		if err := cache.Cache.Set(redisKey, s, 0); err != nil {
+			return err
+		}
+	}
+	apply(s)
+	return nil
+}
+
+// RateLimit returns the global rate limit, for middleware.RateLimiter.
+func RateLimit() (int, time.Duration) {
+	s := Current()
+	return s.RateLimitRequests, s.RateLimitWindow()
+}
+
+func apply(s Settings) {
+	s = s.Clone()
+	mu.Lock()
+	old := current
+	current, checkedAt = s, time.Now()
+	changed := !reflect.DeepEqual(old, s)
+	fns := hooks
+	mu.Unlock()
+
+	if changed {
+		for _, fn := range fns {
+			fn(old.Clone(), s.Clone())
+		}
+	}
+}
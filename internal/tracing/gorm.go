@@ -0,0 +1,86 @@
+package tracing
+
+import (
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const gormSpanKey = "tracing:span"
+
+// GormPlugin creates a client span for every GORM operation, parented to
+// the span in the statement context (use db.WithContext to connect them).
+type GormPlugin struct{}
+
+func (GormPlugin) Name() string {
+	return "lumina:tracing"
+}
+
+func (p GormPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	hooks := []struct {
+		name   string
+		before func(string, func(*gorm.DB)) error
+		after  func(string, func(*gorm.DB)) error
+	}{
+		{"create", cb.Create().Before("gorm:create").Register, cb.Create().After("gorm:create").Register},
+		{"query", cb.Query().Before("gorm:query").Register, cb.Query().After("gorm:query").Register},
+		{"update", cb.Update().Before("gorm:update").Register, cb.Update().After("gorm:update").Register},
+		{"delete", cb.Delete().Before("gorm:delete").Register, cb.Delete().After("gorm:delete").Register},
+		{"row", cb.Row().Before("gorm:row").Register, cb.Row().After("gorm:row").Register},
+		{"raw", cb.Raw().Before("gorm:raw").Register, cb.Raw().After("gorm:raw").Register},
+	}
+
+	for _, h := range hooks {
+		op := h.name
+		if err := h.before("tracing:before_"+op, func(tx *gorm.DB) { before(tx, op) }); err != nil {
+			return err
+		}
+		if err := h.after("tracing:after_"+op, after); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func before(tx *gorm.DB, op string) {
+	if tx.Statement == nil || tx.Statement.Context == nil {
+		return
+	}
+	// Queries without a traced context would only produce orphan root
+	// spans, so leave them out.
+	if !trace.SpanContextFromContext(tx.Statement.Context).IsValid() {
+		return
+	}
+	ctx, span := Tracer().Start(tx.Statement.Context, "db."+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			attribute.String("db.operation", op),
+			attribute.String("db.sql.table", tx.Statement.Table),
+		),
+	)
+	tx.Statement.Context = ctx
+	tx.InstanceSet(gormSpanKey, span)
+}
+
+func after(tx *gorm.DB) {
+	v, ok := tx.InstanceGet(gormSpanKey)
+	if !ok {
+		return
+	}
+	span, ok := v.(trace.Span)
+	if !ok {
+		return
+	}
+	defer span.End()
+
+	if tx.Statement != nil && tx.Statement.SQL.Len() > 0 {
+		span.SetAttributes(attribute.String("db.statement", tx.Statement.SQL.String()))
+	}
+	span.SetAttributes(attribute.Int64("db.rows_affected", tx.RowsAffected))
+	if tx.Error != nil && tx.Error != gorm.ErrRecordNotFound {
+		RecordError(span, tx.Error)
+	}
+}
@@ -0,0 +1,113 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/zesbe/lumina-ai/internal/version"
+)
+
+const instrumentationName = "github.com/zesbe/lumina-ai"
+
+// Init installs an OTLP/HTTP tracer provider configured through the
+// standard OTEL_* environment variables. When no exporter endpoint is set
+// (or OTEL_SDK_DISABLED=true) tracing stays a no-op and the returned
+// shutdown function does nothing.
+func Init(ctx context.Context, environment string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	if !Enabled() {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		semconv.ServiceName("lumina-ai-api"),
+		semconv.ServiceVersion(version.Version),
+		semconv.DeploymentEnvironment(environment),
+	))
+	if err != nil {
+		return nil, err
+	}
+	// Let OTEL_SERVICE_NAME / OTEL_RESOURCE_ATTRIBUTES override the defaults.
+	if envRes, err := resource.New(ctx, resource.WithFromEnv()); err == nil {
+		if merged, err := resource.Merge(res, envRes); err == nil {
+			res = merged
+		}
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Enabled reports whether an OTLP endpoint is configured.
+func Enabled() bool {
+	if strings.EqualFold(os.Getenv("OTEL_SDK_DISABLED"), "true") {
+		return false
+	}
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" ||
+		os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// Tracer returns the application tracer from the global provider.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Start starts a child span of whatever span ctx carries.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// StartJob starts the root span of a background job. The job gets its own
+// trace, linked to the request that spawned it, so a ten minute video job
+// doesn't stretch the request trace.
+func StartJob(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer().Start(context.Background(), name,
+		trace.WithNewRoot(),
+		trace.WithLinks(trace.LinkFromContext(ctx)),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+// TraceID returns the hex trace ID carried by ctx, or "" when there is no
+// sampled span.
+func TraceID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.HasTraceID() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
+
+// RecordError marks the span as failed.
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
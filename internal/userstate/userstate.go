@@ -0,0 +1,101 @@
+// Package userstate answers what an access token can't: a user's role,
+// plan, whether the account is still active right now and since when its
+// tokens count. Tokens carry
+// the role and plan from when they were issued, so a demoted admin or a
+// deactivated account would otherwise keep working until the token
+// expires.
+//
+// Lookups are cached in Redis for CacheTTL. Code that changes a user's
+// role, plan, active flag or password calls Forget, so every instance sees the
+// change on its next request; the TTL only bounds edits made straight in
+// the database. Without Redis every lookup reads the database.
+package userstate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/zesbe/lumina-ai/internal/cache"
+	"github.com/zesbe/lumina-ai/internal/logger"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+// CacheTTL is how long a lookup is reused.
+const CacheTTL = time.Minute
+
+// ErrNotFound is a user that no longer exists.
+var ErrNotFound = errors.New("user not found")
+
+// State is what requests are authorized on.
+type State struct {
+	Role   string `json:"role"`
+	Plan   string `json:"plan"`
+	Active bool   `json:"active"`
+	// TokensSince is when the password was last set; tokens issued
+	// before it were issued to whoever knew the old one.
+	TokensSince time.Time `json:"tokens_since"`
+}
+
+// Accepts reports whether a token issued at issuedAt is still good. Both
+// times keep their fraction of a second, so a token issued in the same
+// second as a password change, but before it, is refused.
+func (s State) Accepts(issuedAt time.Time) bool {
+	return !issuedAt.Before(s.TokensSince)
+}
+
+var db *gorm.DB
+
+// Init enables lookups. Until it is called Get fails.
+func Init(database *gorm.DB) {
+	db = database
+}
+
+// Get returns the user's current state.
+func Get(ctx context.Context, userID uint) (State, error) {
+	var state State
+	if cache.Cache != nil {
+		if err := cache.Cache.Get(key(userID), &state); err == nil {
+			return state, nil
+		}
+	}
+	if db == nil {
+		return state, errors.New("userstate not initialized")
+	}
+
+	var user models.User
+	if err := db.WithContext(ctx).Select("id", "role", "plan", "is_active", "password_changed_at").First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return state, ErrNotFound
+		}
+		return state, err
+	}
+	state = State{Role: user.Role, Plan: user.Plan, Active: user.IsActive}
+	if user.PasswordChangedAt != nil {
+		state.TokensSince = *user.PasswordChangedAt
+	}
+	if cache.Cache != nil {
+		if err := cache.Cache.Set(key(userID), state, CacheTTL); err != nil {
+			logger.L().Warn("failed to cache user state", "user_id", userID, "error", err)
+		}
+	}
+	return state, nil
+}
+
+// Forget drops the cached state after the user's role, plan, active flag
+// or password changed.
+func Forget(userID uint) {
+	if cache.Cache == nil {
+		return
+	}
+	if err := cache.Cache.Delete(key(userID)); err != nil {
+		logger.L().Warn("failed to forget user state", "user_id", userID, "error", err)
+	}
+}
+
+func key(userID uint) string {
+	return fmt.Sprintf("user_state:%d", userID)
+}
@@ -0,0 +1,147 @@
+package userstate
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/zesbe/lumina-ai/internal/cache"
+	"github.com/zesbe/lumina-ai/internal/models"
+)
+
+// setup points the package at a fresh SQLite database, with a miniredis
+// cache in front of it.
+func setup(t *testing.T) (*gorm.DB, *miniredis.Miniredis) {
+	t.Helper()
+	database, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := database.AutoMigrate(&models.User{}); err != nil {
+		t.Fatal(err)
+	}
+	Init(database)
+	t.Cleanup(func() { db = nil })
+
+	mr := miniredis.RunT(t)
+	if err := cache.InitRedis("redis://" + mr.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cache.Cache.Close()
+		cache.Cache = nil
+	})
+	return database, mr
+}
+
+// TestGetCachedUntilForget checks that an edit made straight in the
+// database is hidden by the cached state until Forget drops it.
+func TestGetCachedUntilForget(t *testing.T) {
+	database, mr := setup(t)
+	user := models.User{Email: "state@example.com", Name: "State", Role: "user", Plan: "free", IsActive: true}
+	if err := database.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	get := func() State {
+		t.Helper()
+		state, err := Get(context.Background(), user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return state
+	}
+	if state := get(); state != (State{Role: "user", Plan: "free", Active: true}) {
+		t.Fatalf("state = %+v", state)
+	}
+	if !mr.Exists(key(user.ID)) {
+		t.Fatal("state wasn't cached")
+	}
+
+	if err := database.Model(&user).Updates(map[string]interface{}{"role": "admin", "plan": "pro", "is_active": false}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if state := get(); state.Role != "user" || !state.Active {
+		t.Errorf("state = %+v before Forget, want the cached one", state)
+	}
+
+	Forget(user.ID)
+	if state := get(); state != (State{Role: "admin", Plan: "pro", Active: false}) {
+		t.Errorf("state = %+v after Forget, want the edit", state)
+	}
+}
+
+func TestGetMissingUser(t *testing.T) {
+	setup(t)
+	if _, err := Get(context.Background(), 42); !errors.Is(err, ErrNotFound) {
+		t.Errorf("error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestAccepts(t *testing.T) {
+	changed := time.Date(2026, 3, 1, 12, 0, 0, 500_000_000, time.UTC)
+	tests := []struct {
+		name     string
+		since    time.Time
+		issuedAt time.Time
+		want     bool
+	}{
+		{"password never changed", time.Time{}, changed, true},
+		{"issued the same second, before the change", changed, changed.Add(-time.Millisecond), false},
+		{"issued at the change", changed, changed, true},
+		{"issued the same second, after the change", changed, changed.Add(time.Millisecond), true},
+		{"issued a second before", changed, changed.Add(-time.Second), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (State{TokensSince: tt.since}).Accepts(tt.issuedAt); got != tt.want {
+				t.Errorf("Accepts = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestGetKeepsFractionalSeconds checks that the time the password changed
+// keeps its fraction of a second read from the database and from the cache.
+func TestGetKeepsFractionalSeconds(t *testing.T) {
+	database, mr := setup(t)
+	changed := time.Date(2026, 3, 1, 12, 0, 0, 250_000_000, time.UTC)
+	user := models.User{Email: "state@example.com", Name: "State", Role: "user", Plan: "pro", IsActive: true, PasswordChangedAt: &changed}
+	if err := database.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	for _, from := range []string{"database", "cache"} {
+		state, err := Get(context.Background(), user.ID)
+		if err != nil {
+			t.Fatalf("%s: %v", from, err)
+		}
+		if state.Role != "user" || state.Plan != "pro" || !state.Active || !state.TokensSince.Equal(changed) {
+			t.Errorf("%s: state = %+v, want tokens since %v", from, state, changed)
+		}
+		if state.Accepts(changed.Add(-time.Millisecond)) {
+			t.Errorf("%s: accepts a token issued just before the change", from)
+		}
+	}
+	if !mr.Exists(key(user.ID)) {
+		t.Error("state wasn't cached")
+	}
+	Forget(user.ID)
+	if mr.Exists(key(user.ID)) {
+		t.Error("Forget left the cached state")
+	}
+}
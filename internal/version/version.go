@@ -0,0 +1,52 @@
+// Package version describes the running build. The values are set at link
+// time, e.g.
+//
+//	go build -ldflags "\
+//	  -X github.com/zesbe/lumina-ai/internal/version.Version=v2.1.0 \
+//	  -X github.com/zesbe/lumina-ai/internal/version.Commit=$(git rev-parse --short HEAD) \
+//	  -X github.com/zesbe/lumina-ai/internal/version.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)" \
+//	  ./cmd/api
+//
+// A plain go build inside a git checkout still gets the commit and its
+// time from the build info.
+package version
+
+import "runtime/debug"
+
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildTime = ""
+)
+
+// Info is what the build says about itself; none of it is secret.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+}
+
+func init() {
+	if Commit != "" {
+		return
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			Commit = s.Value
+		case "vcs.time":
+			if BuildTime == "" {
+				BuildTime = s.Value
+			}
+		}
+	}
+}
+
+// Get returns the build description.
+func Get() Info {
+	return Info{Version: Version, Commit: Commit, BuildTime: BuildTime}
+}
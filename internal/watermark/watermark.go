@@ -0,0 +1,100 @@
+// Package watermark marks free-plan outputs: a logo in the corner of
+// videos and a short audio tag at the end of music. Both are ffmpeg runs
+// over a file already stored on this server.
+package watermark
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/zesbe/lumina-ai/internal/config"
+	"github.com/zesbe/lumina-ai/internal/services"
+)
+
+// The assets built into the binary, used when no path is configured.
+var (
+	//go:embed assets/logo.png
+	defaultLogo []byte
+	//go:embed assets/tag.wav
+	defaultTag []byte
+)
+
+const (
+	// logoMargin is the logo's distance from the bottom-right corner, in
+	// pixels.
+	logoMargin = 16
+	// logoOpacity keeps the logo light enough not to spoil the video.
+	logoOpacity = 0.6
+)
+
+var logoPath, tagPath string
+
+// Init resolves the assets from cfg, writing the built-in ones to temporary
+// files since ffmpeg reads inputs by path. Until it is called Video and
+// Audio fail.
+func Init(cfg config.Watermark) error {
+	var err error
+	if logoPath, err = asset(cfg.LogoPath, defaultLogo, "lumina-logo-*.png"); err != nil {
+		return fmt.Errorf("watermark logo: %w", err)
+	}
+	if tagPath, err = asset(cfg.AudioTagPath, defaultTag, "lumina-tag-*.wav"); err != nil {
+		return fmt.Errorf("watermark audio tag: %w", err)
+	}
+	return nil
+}
+
+func asset(configured string, builtin []byte, pattern string) (string, error) {
+	if configured != "" {
+		if _, err := os.Stat(configured); err != nil {
+			return "", err
+		}
+		return configured, nil
+	}
+
+	f, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(builtin); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), f.Close()
+}
+
+// Video writes in with the logo overlaid in its bottom-right corner to
+// out. The audio, if any, is copied as is.
+func Video(ctx context.Context, timeout time.Duration, in, out string) error {
+	if logoPath == "" {
+		return errors.New("watermark: not initialized")
+	}
+	filter := fmt.Sprintf("[1:v]format=rgba,colorchannelmixer=aa=%g[logo];[0:v][logo]overlay=main_w-overlay_w-%d:main_h-overlay_h-%d[v]",
+		logoOpacity, logoMargin, logoMargin)
+	_, err := services.RunFFmpeg(ctx, timeout, "-y", "-i", in, "-i", logoPath,
+		"-filter_complex", filter, "-map", "[v]", "-map", "0:a?",
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "20", "-c:a", "copy",
+		"-movflags", "+faststart", out)
+	return err
+}
+
+// Audio writes in with the tag appended to its end to out, as an MP3 at
+// bitrate bits per second.
+func Audio(ctx context.Context, timeout time.Duration, in, out string, bitrate int) error {
+	if tagPath == "" {
+		return errors.New("watermark: not initialized")
+	}
+	// concat needs both inputs in the same format; the tag is mono and at a
+	// lower rate.
+	const format = "aformat=sample_fmts=fltp:sample_rates=44100:channel_layouts=stereo"
+	filter := "[0:a]" + format + "[track];[1:a]" + format + "[tag];[track][tag]concat=n=2:v=0:a=1[a]"
+	_, err := services.RunFFmpeg(ctx, timeout, "-y", "-i", in, "-i", tagPath,
+		"-filter_complex", filter, "-map", "[a]", "-map_metadata", "0",
+		"-c:a", "libmp3lame", "-b:a", strconv.Itoa(bitrate), out)
+	return err
+}